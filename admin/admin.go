@@ -0,0 +1,123 @@
+// admin/admin.go
+package admin
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"vad-application/auth"
+	"vad-application/cluster"
+	"vad-application/events"
+	"vad-application/quota"
+	"vad-application/session"
+)
+
+// defaultReason is told to clients whose session is closed without one.
+const defaultReason = "closed by an operator"
+
+// Session is an open session as operators see it.
+type Session struct {
+	session.Stats
+	Subject    string `json:"subject,omitempty"`
+	Tenant     string `json:"tenant,omitempty"`
+	Route      string `json:"route,omitempty"`
+	RemoteAddr string `json:"remote_addr"`
+	// Duration is how long, in seconds, the session has been open.
+	Duration float64 `json:"duration"`
+}
+
+func describe(s *session.Session) Session {
+	return Session{
+		Stats:      s.Stats(),
+		Subject:    s.Subject,
+		Tenant:     s.Tenant,
+		Route:      s.Route,
+		RemoteAddr: s.RemoteAddr().String(),
+		Duration:   time.Since(s.Started).Seconds(),
+	}
+}
+
+// Handler serves the admin API over the bridge's open sessions:
+//
+//	GET    /admin/sessions              open sessions, oldest first
+//	GET    /admin/sessions?scope=cluster those of every replica in the registry
+//	GET    /admin/sessions/{id}         one session and its latest events
+//	DELETE /admin/sessions/{id}?reason= closes the session, telling the client why
+//	GET    /admin/feed                  snapshots of the sessions and backends
+//	GET    /admin/usage                 audio used this day and month, by subject and tenant
+//	GET    /admin/usage/{subject}       that of one subject, with its quotas
+//	GET    /admin/tenants/{tenant}/usage that of all of one tenant's callers
+//
+// and maintenance mode; see handleMaintenance. Sessions taken from SIP,
+// WebRTC, Twilio, NATS or MQTT aren't listed, nor drained by maintenance.
+// registry is nil without one.
+func Handler(m *session.Manager, health Health, registry *cluster.Registry, quotas *quota.Quotas, logger *slog.Logger) http.Handler {
+	log := logger.With("component", "admin")
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/feed", feed(m, health))
+	handleMaintenance(mux, m, log)
+	mux.HandleFunc("GET /admin/sessions", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("scope") == "cluster" {
+			if registry == nil {
+				http.Error(w, "no session registry configured", http.StatusNotFound)
+				return
+			}
+			list, err := registry.Sessions(r.Context())
+			if err != nil {
+				log.Warn("Session registry unavailable", "err", err)
+				http.Error(w, "session registry unavailable", http.StatusBadGateway)
+				return
+			}
+			reply(w, list)
+			return
+		}
+		list := []Session{}
+		for _, s := range m.List() {
+			list = append(list, describe(s))
+		}
+		reply(w, list)
+	})
+	mux.HandleFunc("GET /admin/usage", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, quotas.All())
+	})
+	mux.HandleFunc("GET /admin/usage/{subject}", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, quotas.Usage(r.PathValue("subject")))
+	})
+	mux.HandleFunc("GET /admin/tenants/{tenant}/usage", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, quotas.TenantUsage(r.PathValue("tenant")))
+	})
+	mux.HandleFunc("GET /admin/sessions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		s, ok := m.Get(r.PathValue("id"))
+		if !ok {
+			http.Error(w, "session not found", http.StatusNotFound)
+			return
+		}
+		reply(w, struct {
+			Session
+			Events []events.Event `json:"recent_events"`
+		}{describe(s), s.Recent()})
+	})
+	mux.HandleFunc("DELETE /admin/sessions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		s, ok := m.Get(r.PathValue("id"))
+		if !ok {
+			http.Error(w, "session not found", http.StatusNotFound)
+			return
+		}
+		reason := r.URL.Query().Get("reason")
+		if reason == "" {
+			reason = defaultReason
+		}
+		id, _ := auth.FromContext(r.Context())
+		log.Info("Closing session", "session_id", s.ID, "operator", id.Subject, "reason", reason)
+		s.Terminate(reason)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
+
+func reply(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,22 @@
+// admin/dashboard.go
+package admin
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+// Dashboard serves the operations dashboard under /admin/dashboard/. The
+// page holds no data: it asks for an admin API key and reads the admin API
+// with it.
+func Dashboard() http.Handler {
+	files, err := fs.Sub(dashboardFiles, "dashboard")
+	if err != nil {
+		panic(err)
+	}
+	return http.StripPrefix("/admin/dashboard/", http.FileServerFS(files))
+}
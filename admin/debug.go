@@ -0,0 +1,185 @@
+// admin/debug.go
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"runtime/pprof"
+	"runtime/trace"
+	"strconv"
+	"time"
+)
+
+// maxProfile bounds the CPU profiles and traces one request may take.
+const maxProfile = 5 * time.Minute
+
+// Runtime is a snapshot of the Go runtime, from GET /debug/runtime.
+type Runtime struct {
+	Goroutines int   `json:"goroutines"`
+	Threads    int   `json:"threads"`
+	CPUs       int   `json:"cpus"`
+	GOMAXPROCS int   `json:"gomaxprocs"`
+	HeapAlloc  int64 `json:"heap_alloc_bytes"`
+	HeapInuse  int64 `json:"heap_inuse_bytes"`
+	HeapSys    int64 `json:"heap_sys_bytes"`
+	HeapObjs   int64 `json:"heap_objects"`
+	StackInuse int64 `json:"stack_inuse_bytes"`
+	Sys        int64 `json:"sys_bytes"`
+	// TotalAlloc counts the bytes ever allocated; Mallocs and Frees the
+	// objects.
+	TotalAlloc int64 `json:"total_alloc_bytes"`
+	Mallocs    int64 `json:"mallocs"`
+	Frees      int64 `json:"frees"`
+	NumGC      int64 `json:"gc_cycles"`
+	// GCPause is the total time the world was stopped for GC, and
+	// LastGCPause that of the latest cycle, in seconds.
+	GCPause     float64   `json:"gc_pause_total_seconds"`
+	LastGCPause float64   `json:"gc_pause_last_seconds"`
+	LastGC      time.Time `json:"last_gc"`
+	// GCCPUFraction is the share of the CPU time GC has used since start.
+	GCCPUFraction float64 `json:"gc_cpu_fraction"`
+	NextGC        int64   `json:"next_gc_bytes"`
+}
+
+// Debug serves the runtime's diagnostics, profiles in the formats of
+// net/http/pprof so that go tool pprof reads them:
+//
+//	GET  /debug/pprof/                    the available profiles
+//	GET  /debug/pprof/{name}?debug=       a profile: heap, goroutine, allocs,
+//	                                      block, mutex or threadcreate
+//	GET  /debug/pprof/heap?gc=1           a heap profile taken after a GC
+//	GET  /debug/pprof/profile?seconds=30  a CPU profile
+//	GET  /debug/pprof/trace?seconds=5     an execution trace
+//	GET  /debug/goroutines                the stacks of every goroutine, as text
+//	GET  /debug/runtime                   goroutine, memory and GC figures
+//	POST /debug/gc                        collects garbage, returning memory to the OS
+//
+// net/http/pprof itself is not used: importing it would serve the profiles
+// unauthenticated on http.DefaultServeMux.
+func Debug() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /debug/pprof/{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(w, "profile\tcount")
+		for _, p := range pprof.Profiles() {
+			fmt.Fprintf(w, "%s\t%d\n", p.Name(), p.Count())
+		}
+		fmt.Fprintln(w, "profile\t(CPU, ?seconds=)")
+		fmt.Fprintln(w, "trace\t(execution trace, ?seconds=)")
+	})
+	mux.HandleFunc("GET /debug/pprof/profile", func(w http.ResponseWriter, r *http.Request) {
+		d, ok := seconds(w, r, 30*time.Second)
+		if !ok {
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", `attachment; filename="profile"`)
+		if err := pprof.StartCPUProfile(w); err != nil {
+			// Another profile is running.
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		sleep(r, d)
+		pprof.StopCPUProfile()
+	})
+	mux.HandleFunc("GET /debug/pprof/trace", func(w http.ResponseWriter, r *http.Request) {
+		d, ok := seconds(w, r, 5*time.Second)
+		if !ok {
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", `attachment; filename="trace"`)
+		if err := trace.Start(w); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		sleep(r, d)
+		trace.Stop()
+	})
+	mux.HandleFunc("GET /debug/pprof/{profile}", func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("profile")
+		p := pprof.Lookup(name)
+		if p == nil {
+			http.Error(w, "unknown profile "+strconv.Quote(name), http.StatusNotFound)
+			return
+		}
+		level, _ := strconv.Atoi(r.URL.Query().Get("debug"))
+		if name == "heap" && r.URL.Query().Get("gc") == "1" {
+			runtime.GC()
+		}
+		if level > 0 {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		} else {
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+		}
+		p.WriteTo(w, level)
+	})
+	mux.HandleFunc("GET /debug/goroutines", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		pprof.Lookup("goroutine").WriteTo(w, 2)
+	})
+	mux.HandleFunc("GET /debug/runtime", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, readRuntime())
+	})
+	mux.HandleFunc("POST /debug/gc", func(w http.ResponseWriter, r *http.Request) {
+		debug.FreeOSMemory()
+		reply(w, readRuntime())
+	})
+	return mux
+}
+
+func readRuntime() Runtime {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	rt := Runtime{
+		Goroutines:    runtime.NumGoroutine(),
+		Threads:       pprof.Lookup("threadcreate").Count(),
+		CPUs:          runtime.NumCPU(),
+		GOMAXPROCS:    runtime.GOMAXPROCS(0),
+		HeapAlloc:     int64(ms.HeapAlloc),
+		HeapInuse:     int64(ms.HeapInuse),
+		HeapSys:       int64(ms.HeapSys),
+		HeapObjs:      int64(ms.HeapObjects),
+		StackInuse:    int64(ms.StackInuse),
+		Sys:           int64(ms.Sys),
+		TotalAlloc:    int64(ms.TotalAlloc),
+		Mallocs:       int64(ms.Mallocs),
+		Frees:         int64(ms.Frees),
+		NumGC:         int64(ms.NumGC),
+		GCPause:       time.Duration(ms.PauseTotalNs).Seconds(),
+		GCCPUFraction: ms.GCCPUFraction,
+		NextGC:        int64(ms.NextGC),
+	}
+	if ms.NumGC > 0 {
+		rt.LastGCPause = time.Duration(ms.PauseNs[(ms.NumGC+255)%256]).Seconds()
+		rt.LastGC = time.Unix(0, int64(ms.LastGC)).UTC()
+	}
+	return rt
+}
+
+// seconds parses the seconds parameter of r, def when absent, answering 400
+// when it is not a positive number up to maxProfile.
+func seconds(w http.ResponseWriter, r *http.Request, def time.Duration) (time.Duration, bool) {
+	v := r.URL.Query().Get("seconds")
+	if v == "" {
+		return def, true
+	}
+	n, err := strconv.ParseFloat(v, 64)
+	d := time.Duration(n * float64(time.Second))
+	if err != nil || d <= 0 || d > maxProfile {
+		http.Error(w, fmt.Sprintf("seconds: want a number up to %d", int(maxProfile.Seconds())), http.StatusBadRequest)
+		return 0, false
+	}
+	return d, true
+}
+
+// sleep waits d, or less if the client goes away.
+func sleep(r *http.Request, d time.Duration) {
+	select {
+	case <-time.After(d):
+	case <-r.Context().Done():
+	}
+}
@@ -0,0 +1,120 @@
+// admin/feed.go
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"vad-application/session"
+)
+
+// feedInterval is how often the feed sends a snapshot.
+const feedInterval = time.Second
+
+// Backend is a VAD backend as operators see it.
+type Backend struct {
+	Addr string `json:"addr"`
+	// Role is "primary" or "canary".
+	Role string `json:"role"`
+	// Healthy is the result of the latest probe; Available adds that the
+	// backend's circuit is closed.
+	Healthy   bool  `json:"healthy"`
+	Available bool  `json:"available"`
+	Active    int64 `json:"active"`
+}
+
+// Health lists the backends; the bridge passes nil when its VAD is
+// embedded.
+type Health func() []Backend
+
+// Snapshot is the state of the bridge at one moment.
+type Snapshot struct {
+	Time     time.Time `json:"time"`
+	Draining bool      `json:"draining"`
+	Sessions []Session `json:"sessions"`
+	Backends []Backend `json:"backends"`
+	// Maintenance is set in maintenance mode.
+	Maintenance *MaintenanceState `json:"maintenance,omitempty"`
+	// Throughput per second since the previous snapshot, of the sessions
+	// open now.
+	BytesInRate  float64 `json:"bytes_in_per_second"`
+	BytesOutRate float64 `json:"bytes_out_per_second"`
+	EventRate    float64 `json:"events_per_second"`
+}
+
+// totals are a session's counters, as of the previous snapshot.
+type totals struct {
+	in, out, events int64
+}
+
+// feed serves GET /admin/feed: a Snapshot every feedInterval, as SSE events
+// named "snapshot". The stream ends once the bridge drains.
+func feed(m *session.Manager, health Health) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		ticker := time.NewTicker(feedInterval)
+		defer ticker.Stop()
+		prev := map[string]totals{}
+		var last time.Time
+		for {
+			now := time.Now()
+			snap := Snapshot{Time: now, Draining: m.Draining(), Sessions: []Session{}, Backends: []Backend{}}
+			if health != nil {
+				snap.Backends = append(snap.Backends, health()...)
+			}
+			if st := maintenanceState(m); st.Enabled {
+				snap.Maintenance = &st
+			}
+			next := make(map[string]totals, len(prev))
+			var delta totals
+			for _, s := range m.List() {
+				d := describe(s)
+				snap.Sessions = append(snap.Sessions, d)
+				t := totals{in: d.BytesIn, out: d.BytesOut}
+				for _, n := range d.Events {
+					t.events += n
+				}
+				p := prev[d.ID]
+				delta.in += t.in - p.in
+				delta.out += t.out - p.out
+				delta.events += t.events - p.events
+				next[d.ID] = t
+			}
+			if elapsed := now.Sub(last).Seconds(); !last.IsZero() && elapsed > 0 {
+				snap.BytesInRate = float64(delta.in) / elapsed
+				snap.BytesOutRate = float64(delta.out) / elapsed
+				snap.EventRate = float64(delta.events) / elapsed
+			}
+			prev, last = next, now
+
+			data, err := json.Marshal(snap)
+			if err != nil {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "event: snapshot\ndata: %s\n\n", data); err != nil {
+				return
+			}
+			flusher.Flush()
+			// The server waits for open requests as it shuts down.
+			if snap.Draining {
+				return
+			}
+			select {
+			case <-ticker.C:
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}
+}
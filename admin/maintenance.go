@@ -0,0 +1,86 @@
+// admin/maintenance.go
+package admin
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"vad-application/auth"
+	"vad-application/session"
+)
+
+// Maintenance mode defaults, for PUT /admin/maintenance without them.
+const (
+	defaultGrace      = 2 * time.Minute
+	defaultRetryAfter = 30 * time.Second
+)
+
+// MaintenanceState is maintenance mode as operators see it.
+type MaintenanceState struct {
+	Enabled  bool       `json:"enabled"`
+	Since    *time.Time `json:"since,omitempty"`
+	Deadline *time.Time `json:"deadline,omitempty"`
+	// RetryAfter is what refused clients are told to wait, in seconds.
+	RetryAfter int `json:"retry_after,omitempty"`
+	// Sessions counts those still open.
+	Sessions int `json:"sessions"`
+}
+
+func maintenanceState(m *session.Manager) MaintenanceState {
+	st := MaintenanceState{Sessions: m.Len()}
+	if mt, ok := m.Maintenance(); ok {
+		st.Enabled = true
+		st.Since, st.Deadline = &mt.Since, &mt.Deadline
+		st.RetryAfter = int(mt.RetryAfter.Round(time.Second).Seconds())
+	}
+	return st
+}
+
+// handleMaintenance serves maintenance mode:
+//
+//	GET    /admin/maintenance                      its state
+//	PUT    /admin/maintenance?grace=&retry_after=  enters it, or moves the deadline
+//	DELETE /admin/maintenance                      leaves it
+//
+// grace and retry_after are Go durations, such as 90s.
+func handleMaintenance(mux *http.ServeMux, m *session.Manager, log *slog.Logger) {
+	mux.HandleFunc("GET /admin/maintenance", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, maintenanceState(m))
+	})
+	mux.HandleFunc("PUT /admin/maintenance", func(w http.ResponseWriter, r *http.Request) {
+		grace, ok := duration(w, r, "grace", defaultGrace)
+		if !ok {
+			return
+		}
+		retryAfter, ok := duration(w, r, "retry_after", defaultRetryAfter)
+		if !ok {
+			return
+		}
+		mt := m.EnterMaintenance(grace, retryAfter)
+		id, _ := auth.FromContext(r.Context())
+		log.Info("Entering maintenance", "operator", id.Subject, "deadline", mt.Deadline,
+			"retry_after", retryAfter.String(), "sessions", m.Len())
+		reply(w, maintenanceState(m))
+	})
+	mux.HandleFunc("DELETE /admin/maintenance", func(w http.ResponseWriter, r *http.Request) {
+		m.ExitMaintenance()
+		id, _ := auth.FromContext(r.Context())
+		log.Info("Leaving maintenance", "operator", id.Subject)
+		reply(w, maintenanceState(m))
+	})
+}
+
+// duration reads a non-negative duration parameter, or def when missing.
+func duration(w http.ResponseWriter, r *http.Request, name string, def time.Duration) (time.Duration, bool) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, true
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		http.Error(w, name+": not a non-negative duration", http.StatusBadRequest)
+		return 0, false
+	}
+	return d, true
+}
@@ -0,0 +1,104 @@
+// asr/asr.go
+package asr
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+
+	"vad-application/audio"
+)
+
+// maxErrorBody caps the response text kept from a failed request.
+const maxErrorBody = 512
+
+// Transcript is what a Transcriber heard in one segment.
+type Transcript struct {
+	Text string `json:"text"`
+	// Language is the language detected, when the service reports it.
+	Language string `json:"language,omitempty"`
+}
+
+// Transcriber turns one speech segment, PCM in audio.Backend's format,
+// into text. Language is a BCP 47 hint and may be empty.
+type Transcriber interface {
+	Transcribe(ctx context.Context, pcm []byte, language string) (Transcript, error)
+}
+
+// HTTPConfig describes an HTTP speech-to-text service.
+type HTTPConfig struct {
+	// URL takes multipart uploads the way OpenAI's
+	// /v1/audio/transcriptions does, which Whisper servers such as
+	// faster-whisper-server and whisper.cpp's server accept too.
+	URL string
+	// Model is sent as the model field; empty leaves it out.
+	Model string
+	// APIKey, when set, is sent as a bearer token.
+	APIKey string
+}
+
+// HTTP is a Transcriber posting each segment as a WAV file.
+type HTTP struct {
+	cfg    HTTPConfig
+	client *http.Client
+}
+
+// NewHTTP returns a Transcriber for the service at cfg.URL. Requests are
+// bounded by their context.
+func NewHTTP(cfg HTTPConfig) (*HTTP, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("asr: invalid URL %q", cfg.URL)
+	}
+	return &HTTP{cfg: cfg, client: &http.Client{}}, nil
+}
+
+// Transcribe implements Transcriber.
+func (t *HTTP) Transcribe(ctx context.Context, pcm []byte, language string) (Transcript, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("file", "segment.wav")
+	if err != nil {
+		return Transcript{}, err
+	}
+	fw.Write(audio.WAVHeader(audio.Backend, uint32(len(pcm))))
+	fw.Write(pcm)
+	if t.cfg.Model != "" {
+		mw.WriteField("model", t.cfg.Model)
+	}
+	if language != "" {
+		mw.WriteField("language", language)
+	}
+	mw.WriteField("response_format", "json")
+	if err := mw.Close(); err != nil {
+		return Transcript{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.cfg.URL, &body)
+	if err != nil {
+		return Transcript{}, err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	if t.cfg.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+t.cfg.APIKey)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return Transcript{}, fmt.Errorf("asr: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return Transcript{}, fmt.Errorf("asr: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	var tr Transcript
+	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
+		return Transcript{}, fmt.Errorf("asr: decoding response: %w", err)
+	}
+	return tr, nil
+}
@@ -0,0 +1,83 @@
+// audio/agc.go
+package audio
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Bounds of the level automatic gain control may aim for.
+const (
+	MinAGCTargetDBFS = -40
+	MaxAGCTargetDBFS = -3
+)
+
+// Gain control tuning. Levels are measured over blocks of agcBlock; quieter
+// blocks than agcGateDBFS are taken for pauses and leave the gain alone, so
+// that noise between words is not pumped up.
+const (
+	agcBlock     = 0.01 // seconds
+	agcGateDBFS  = -55
+	agcMaxGainDB = 30
+	agcMinGainDB = -20
+	// agcAttack and agcRelease are how far, per block, the gain moves
+	// toward a lower and a higher one.
+	agcAttack  = 0.3
+	agcRelease = 0.02
+	// agcCeiling is the peak, as a fraction of full scale, no gain may
+	// push a block past.
+	agcCeiling = 0.9
+)
+
+// gainControl brings 16-bit mono PCM to a target RMS level: it raises quiet
+// microphones slowly, turns hot ones down fast, and limits every block's
+// peak so nothing clips.
+type gainControl struct {
+	out    Format
+	target float64
+	block  int
+	gain   float64
+}
+
+// NewGainControl returns automatic gain control for 16-bit mono PCM in
+// format in, aiming for targetDBFS.
+func NewGainControl(in Format, targetDBFS float64) Converter {
+	return &gainControl{
+		out:    in,
+		target: targetDBFS,
+		block:  max(int(agcBlock*float64(in.SampleRate)), 1) * 2,
+		gain:   1,
+	}
+}
+
+func (g *gainControl) Output() Format { return g.out }
+
+func (g *gainControl) Convert(dst, src []byte) ([]byte, error) {
+	var m Meter
+	for len(src) >= 2 {
+		n := min(len(src)&^1, g.block)
+		blk := src[:n]
+		src = src[n:]
+
+		m.Reset()
+		m.Write(blk)
+		rms, peak := m.Level()
+		if level := DBFS(rms); level > agcGateDBFS {
+			want := math.Pow(10, min(max(g.target-level, agcMinGainDB), agcMaxGainDB)/20)
+			rate := agcRelease
+			if want < g.gain {
+				rate = agcAttack
+			}
+			g.gain += (want - g.gain) * rate
+		}
+		gain := g.gain
+		if peak*gain > agcCeiling {
+			gain = agcCeiling / peak
+		}
+		for i := 0; i+2 <= len(blk); i += 2 {
+			v := float32(int16(binary.LittleEndian.Uint16(blk[i:])))
+			dst = binary.LittleEndian.AppendUint16(dst, uint16(clip16(v*float32(gain))))
+		}
+	}
+	return dst, nil
+}
@@ -0,0 +1,40 @@
+// audio/channels.go
+package audio
+
+import "encoding/binary"
+
+// MaxChannels is the most interleaved channels accepted in PCM input.
+const MaxChannels = 8
+
+// channelMixer turns interleaved multi-channel 16-bit PCM into mono, either
+// by averaging all channels or by keeping one.
+type channelMixer struct {
+	out      Format
+	channels int
+	// pick is the 1-based channel to keep; zero averages them all.
+	pick int
+}
+
+func newChannelMixer(in Format, pick int) channelMixer {
+	out := in
+	out.Channels = 1
+	return channelMixer{out: out, channels: in.Channels, pick: pick}
+}
+
+func (m channelMixer) Output() Format { return m.out }
+
+func (m channelMixer) Convert(dst, src []byte) ([]byte, error) {
+	frame := 2 * m.channels
+	for i := 0; i+frame <= len(src); i += frame {
+		if m.pick > 0 {
+			dst = append(dst, src[i+2*(m.pick-1)], src[i+2*(m.pick-1)+1])
+			continue
+		}
+		var sum int
+		for c := 0; c < m.channels; c++ {
+			sum += int(int16(binary.LittleEndian.Uint16(src[i+2*c:])))
+		}
+		dst = binary.LittleEndian.AppendUint16(dst, uint16(int16(sum/m.channels)))
+	}
+	return dst, nil
+}
@@ -0,0 +1,142 @@
+// audio/convert.go
+package audio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Converter turns audio in a client's format into the format sent to the
+// backend.
+type Converter interface {
+	// Convert appends the converted form of src to dst and returns it. On
+	// error src is skipped and the converter remains usable.
+	Convert(dst, src []byte) ([]byte, error)
+	// Output is the format Convert produces.
+	Output() Format
+}
+
+// Options tune how a stream is converted.
+type Options struct {
+	// Channel selects the 1-based channel kept from multi-channel input;
+	// zero downmixes all channels.
+	Channel int
+	// Denoise and AGCTargetDBFS ask for NewDenoiser and NewGainControl,
+	// which the processing pipeline runs after conversion.
+	Denoise       bool
+	AGCTargetDBFS float64
+}
+
+// Validate checks opts against the input format.
+func (o Options) Validate(in Format) error {
+	if o.Channel < 0 || o.Channel > in.Channels {
+		return fmt.Errorf("channel %d out of range 1-%d", o.Channel, in.Channels)
+	}
+	if o.Denoise && !DenoiseEnabled {
+		return errDenoiseDisabled
+	}
+	if t := o.AGCTargetDBFS; t != 0 && (t < MinAGCTargetDBFS || t > MaxAGCTargetDBFS) {
+		return fmt.Errorf("agc_target_dbfs %g out of range %d to %d", t, MinAGCTargetDBFS, MaxAGCTargetDBFS)
+	}
+	return nil
+}
+
+// NewConverter returns the converter from a validated input format to
+// Backend, or nil when the audio can be forwarded as is. Converters keep
+// state between calls, so each stream needs its own.
+func NewConverter(in Format, opts Options) (Converter, error) {
+	var stages []Converter
+	last := func() Format { return stages[len(stages)-1].Output() }
+	switch in.Encoding {
+	case Float32:
+		stages = append(stages, floatToPCM{out: in.WithEncoding(PCM16)})
+	case Mulaw:
+		stages = append(stages, g711Decoder{out: in.WithEncoding(PCM16), table: mulawTable})
+	case Alaw:
+		stages = append(stages, g711Decoder{out: in.WithEncoding(PCM16), table: alawTable})
+	case Opus:
+		// libopus downmixes by itself; it only needs every channel decoded
+		// when one is to be picked.
+		channels := 1
+		if opts.Channel > 0 {
+			channels = in.Channels
+		}
+		dec, err := newOpusDecoder(Backend.SampleRate, channels)
+		if err != nil {
+			return nil, err
+		}
+		stages = append(stages, dec)
+	}
+	f := in
+	if len(stages) > 0 {
+		f = last()
+	}
+	if f.Channels > 1 {
+		stages = append(stages, newChannelMixer(f, opts.Channel))
+		f = last()
+	}
+	if f.SampleRate != Backend.SampleRate {
+		stages = append(stages, newResampler(f, Backend.SampleRate))
+	}
+	return newChain(stages), nil
+}
+
+// newChain runs stages in sequence; it is nil without any.
+func newChain(stages []Converter) Converter {
+	switch len(stages) {
+	case 0:
+		return nil
+	case 1:
+		return stages[0]
+	}
+	return &chain{stages: stages, scratch: make([][]byte, len(stages)-1)}
+}
+
+// chain runs converters in sequence, reusing one buffer per intermediate
+// stage.
+type chain struct {
+	stages  []Converter
+	scratch [][]byte
+}
+
+func (c *chain) Output() Format { return c.stages[len(c.stages)-1].Output() }
+
+func (c *chain) Convert(dst, src []byte) ([]byte, error) {
+	last := len(c.stages) - 1
+	for i, st := range c.stages[:last] {
+		out, err := st.Convert(c.scratch[i][:0], src)
+		c.scratch[i] = out
+		if err != nil {
+			return dst, err
+		}
+		src = out
+	}
+	return c.stages[last].Convert(dst, src)
+}
+
+// floatToPCM converts 32-bit float samples to 16-bit PCM, clipping values
+// outside [-1, 1].
+type floatToPCM struct{ out Format }
+
+func (c floatToPCM) Output() Format { return c.out }
+
+func (c floatToPCM) Convert(dst, src []byte) ([]byte, error) {
+	for i := 0; i+4 <= len(src); i += 4 {
+		v := math.Float32frombits(binary.LittleEndian.Uint32(src[i:]))
+		dst = binary.LittleEndian.AppendUint16(dst, uint16(floatSample(v)))
+	}
+	return dst, nil
+}
+
+func floatSample(v float32) int16 {
+	switch {
+	case v != v: // NaN
+		return 0
+	case v >= 1:
+		return math.MaxInt16
+	case v <= -1:
+		return math.MinInt16
+	}
+	return int16(v * 32767)
+}
@@ -0,0 +1,20 @@
+// audio/denoise.go
+package audio
+
+// denoiseRate is the sample rate RNNoise works at.
+const denoiseRate = 48000
+
+// NewDenoiser returns noise suppression for 16-bit mono PCM in format in,
+// which is resampled to denoiseRate and back around RNNoise if need be. It
+// fails unless built with the rnnoise tag.
+func NewDenoiser(in Format) (Converter, error) {
+	if in.SampleRate == denoiseRate {
+		return newRNNoise(in)
+	}
+	up := newResampler(in, denoiseRate)
+	rn, err := newRNNoise(up.Output())
+	if err != nil {
+		return nil, err
+	}
+	return newChain([]Converter{up, rn, newResampler(rn.Output(), in.SampleRate)}), nil
+}
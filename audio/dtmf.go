@@ -0,0 +1,138 @@
+// audio/dtmf.go
+package audio
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+// DTMF frequencies, in Hz, and the keys at their crossings.
+var (
+	dtmfRows = [4]float64{697, 770, 852, 941}
+	dtmfCols = [4]float64{1209, 1336, 1477, 1633}
+	dtmfKeys = [4]string{"123A", "456B", "789C", "*0#D"}
+)
+
+// DTMF detection tuning. Tones are looked for in blocks of dtmfBlock, the
+// classic 205 samples at 8 kHz; a key counts once two blocks in a row hear
+// it, and is released after two that do not.
+const (
+	dtmfBlock = 205.0 / 8000 // seconds
+	// dtmfMinDBFS is the quietest block that may hold a tone.
+	dtmfMinDBFS = -45
+	// dtmfShare is how much of the block's energy the two tones must
+	// carry together; speech spreads its energy much wider.
+	dtmfShare = 0.6
+	// dtmfTwist bounds the ratio of the two tones' power either way.
+	dtmfTwist = 6.3 // +8 dB
+	// dtmfMargin is how much stronger a tone must be than the next one in
+	// its group.
+	dtmfMargin = 6.3
+)
+
+// DTMFDigit is a key press heard in the audio, At into the stream.
+type DTMFDigit struct {
+	Digit string
+	At    time.Duration
+}
+
+// DTMFDetector finds telephone keypad tones in 16-bit mono PCM with the
+// Goertzel algorithm.
+type DTMFDetector struct {
+	rate   int
+	coeffs [8]float64
+	block  []float64
+	// samples counts the samples seen; cand and hits track the key of the
+	// latest blocks, active the one last reported.
+	samples      int64
+	cand, active string
+	hits         int
+}
+
+// NewDTMFDetector returns a detector for audio in format in.
+func NewDTMFDetector(in Format) *DTMFDetector {
+	n := int(dtmfBlock * float64(in.SampleRate))
+	d := &DTMFDetector{rate: in.SampleRate, block: make([]float64, 0, n)}
+	for i, f := range append(dtmfRows[:], dtmfCols[:]...) {
+		k := math.Round(f * float64(n) / float64(in.SampleRate))
+		d.coeffs[i] = 2 * math.Cos(2*math.Pi*k/float64(n))
+	}
+	return d
+}
+
+// Detect returns the key presses starting in pcm.
+func (d *DTMFDetector) Detect(pcm []byte) []DTMFDigit {
+	var found []DTMFDigit
+	for ; len(pcm) >= 2; pcm = pcm[2:] {
+		d.block = append(d.block, float64(int16(binary.LittleEndian.Uint16(pcm))))
+		d.samples++
+		if len(d.block) < cap(d.block) {
+			continue
+		}
+		key := d.key(d.block)
+		d.block = d.block[:0]
+		if key == d.cand {
+			d.hits++
+		} else {
+			d.cand, d.hits = key, 1
+		}
+		if d.hits == 2 && d.cand != d.active {
+			d.active = d.cand
+			if d.active != "" {
+				start := d.samples - int64(2*cap(d.block))
+				found = append(found, DTMFDigit{Digit: d.active, At: time.Duration(start) * time.Second / time.Duration(d.rate)})
+			}
+		}
+	}
+	return found
+}
+
+// key returns the key whose tones fill block, if any.
+func (d *DTMFDetector) key(block []float64) string {
+	var energy float64
+	for _, x := range block {
+		energy += x * x
+	}
+	n := float64(len(block))
+	if energy == 0 || DBFS(math.Sqrt(energy/n)/32768) < dtmfMinDBFS {
+		return ""
+	}
+	var power [8]float64
+	for i, c := range d.coeffs {
+		var s1, s2 float64
+		for _, x := range block {
+			s1, s2 = x+c*s1-s2, s1
+		}
+		// Scaled so that a lone full-block sine makes 1.
+		power[i] = 2 * (s1*s1 + s2*s2 - c*s1*s2) / (n * energy)
+	}
+	row, rowNext := strongest(power[:4])
+	col, colNext := strongest(power[4:])
+	pr, pc := power[row], power[4+col]
+	switch {
+	case pr+pc < dtmfShare,
+		pr > pc*dtmfTwist || pc > pr*dtmfTwist,
+		pr < rowNext*dtmfMargin || pc < colNext*dtmfMargin:
+		return ""
+	}
+	return dtmfKeys[row][col : col+1]
+}
+
+// strongest returns the index of the largest of p and the next largest
+// value.
+func strongest(p []float64) (int, float64) {
+	best := 0
+	for i := range p {
+		if p[i] > p[best] {
+			best = i
+		}
+	}
+	var next float64
+	for i := range p {
+		if i != best && p[i] > next {
+			next = p[i]
+		}
+	}
+	return best, next
+}
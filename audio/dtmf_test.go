@@ -0,0 +1,143 @@
+// audio/dtmf_test.go
+package audio
+
+import (
+	"encoding/binary"
+	"math"
+	"math/rand/v2"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dtmfSignal renders keys, each held for on and followed by off of
+// silence, at rate. noise adds white noise of that amplitude.
+func dtmfSignal(rate int, keys string, on, off time.Duration, noise float64) []byte {
+	rng := rand.New(rand.NewPCG(1, 2))
+	var b []byte
+	appendSample := func(v float64) {
+		v += noise * (2*rng.Float64() - 1)
+		b = binary.LittleEndian.AppendUint16(b, uint16(int16(max(min(v, 32767), -32768))))
+	}
+	for _, k := range keys {
+		row, col := dtmfPosition(k)
+		n := int(on.Seconds() * float64(rate))
+		for i := range n {
+			t := float64(i) / float64(rate)
+			appendSample(6000*math.Sin(2*math.Pi*dtmfRows[row]*t) + 6000*math.Sin(2*math.Pi*dtmfCols[col]*t))
+		}
+		for range int(off.Seconds() * float64(rate)) {
+			appendSample(0)
+		}
+	}
+	return b
+}
+
+// dtmfPosition returns the row and column of key k.
+func dtmfPosition(k rune) (row, col int) {
+	for row, keys := range dtmfKeys {
+		if col := strings.IndexRune(keys, k); col >= 0 {
+			return row, col
+		}
+	}
+	panic("no key " + string(k))
+}
+
+func digits(found []DTMFDigit) string {
+	var s strings.Builder
+	for _, d := range found {
+		s.WriteString(d.Digit)
+	}
+	return s.String()
+}
+
+func TestDTMFDetector(t *testing.T) {
+	tests := []struct {
+		name  string
+		rate  int
+		keys  string
+		on    time.Duration
+		noise float64
+	}{
+		{"every key at 8 kHz", 8000, "0123456789*#ABCD", 100 * time.Millisecond, 0},
+		{"every key at 16 kHz", 16000, "0123456789*#ABCD", 100 * time.Millisecond, 0},
+		{"short presses", 8000, "159", 65 * time.Millisecond, 0},
+		{"repeated key", 8000, "5555", 80 * time.Millisecond, 0},
+		{"noisy line", 8000, "2580", 100 * time.Millisecond, 1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDTMFDetector(Format{SampleRate: tt.rate, Channels: 1}.WithEncoding(PCM16))
+			found := d.Detect(dtmfSignal(tt.rate, tt.keys, tt.on, 60*time.Millisecond, tt.noise))
+			if got := digits(found); got != tt.keys {
+				t.Fatalf("detected %q, want %q", got, tt.keys)
+			}
+			// Each press is placed at the block where it starts, which may
+			// begin before it.
+			period := tt.on + 60*time.Millisecond
+			block := time.Duration(dtmfBlock * float64(time.Second))
+			for i, f := range found {
+				if start := time.Duration(i) * period; f.At <= start-block || f.At >= start+block {
+					t.Errorf("key %d at %v, want near %v", i, f.At, start)
+				}
+			}
+		})
+	}
+}
+
+func TestDTMFDetectorChunked(t *testing.T) {
+	pcm := dtmfSignal(8000, "741", 100*time.Millisecond, 50*time.Millisecond, 0)
+	d := NewDTMFDetector(Format{SampleRate: 8000, Channels: 1}.WithEncoding(PCM16))
+	var found []DTMFDigit
+	// Chunks of whole samples that don't line up with the blocks.
+	for i := 0; i < len(pcm); i += 38 {
+		found = append(found, d.Detect(pcm[i:min(i+38, len(pcm))])...)
+	}
+	if got := digits(found); got != "741" {
+		t.Errorf("detected %q across chunks, want %q", got, "741")
+	}
+}
+
+func TestDTMFDetectorRejects(t *testing.T) {
+	rate := 8000
+	signal := func(f func(t float64) float64) []byte {
+		var b []byte
+		for i := range rate {
+			v := f(float64(i) / float64(rate))
+			b = binary.LittleEndian.AppendUint16(b, uint16(int16(v)))
+		}
+		return b
+	}
+	tests := []struct {
+		name string
+		pcm  []byte
+	}{
+		{"silence", make([]byte, 2*rate)},
+		{"single tone", signal(func(t float64) float64 { return 8000 * math.Sin(2*math.Pi*770*t) })},
+		{"too quiet", signal(func(t float64) float64 {
+			return 50*math.Sin(2*math.Pi*770*t) + 50*math.Sin(2*math.Pi*1336*t)
+		})},
+		{"too much twist", signal(func(t float64) float64 {
+			return 10000*math.Sin(2*math.Pi*770*t) + 800*math.Sin(2*math.Pi*1336*t)
+		})},
+		{"harmonic-rich voice", signal(func(t float64) float64 {
+			var v float64
+			for h := 1; h <= 12; h++ {
+				v += 2500 / float64(h) * math.Sin(2*math.Pi*140*float64(h)*t)
+			}
+			return v
+		})},
+		{"noise", func() []byte {
+			rng := rand.New(rand.NewPCG(3, 4))
+			return signal(func(float64) float64 { return 8000 * (2*rng.Float64() - 1) })
+		}()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDTMFDetector(Format{SampleRate: rate, Channels: 1}.WithEncoding(PCM16))
+			if found := d.Detect(tt.pcm); len(found) > 0 {
+				t.Errorf("detected %q", digits(found))
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+// audio/format.go
+package audio
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Encoding names a sample encoding as clients spell it.
+type Encoding string
+
+const (
+	// PCM16 is signed 16-bit little-endian PCM, what the VAD backend reads.
+	PCM16 Encoding = "pcm_s16le"
+	// Float32 is 32-bit little-endian IEEE float PCM in [-1, 1], what Web
+	// Audio produces natively.
+	Float32 Encoding = "pcm_f32le"
+	// Mulaw and Alaw are 8-bit G.711 companded PCM, as sent by telephony
+	// providers, usually at 8 kHz.
+	Mulaw Encoding = "pcm_mulaw"
+	Alaw  Encoding = "pcm_alaw"
+	// Opus carries one raw Opus packet per frame, as produced by the
+	// WebCodecs AudioEncoder. Decoding needs a build with -tags opus.
+	Opus Encoding = "opus"
+)
+
+// bitDepth is the sample size of each supported encoding; packetized
+// encodings have none.
+var bitDepth = map[Encoding]int{
+	PCM16:   16,
+	Float32: 32,
+	Mulaw:   8,
+	Alaw:    8,
+	Opus:    0,
+}
+
+// encodingAliases maps the names other systems use, such as MIME types and
+// RTP payload names, to an Encoding.
+var encodingAliases = map[string]Encoding{
+	"s16le":         PCM16,
+	"linear16":      PCM16,
+	"audio/l16":     PCM16,
+	"f32le":         Float32,
+	"mulaw":         Mulaw,
+	"ulaw":          Mulaw,
+	"pcmu":          Mulaw,
+	"audio/x-mulaw": Mulaw,
+	"audio/basic":   Mulaw,
+	"alaw":          Alaw,
+	"pcma":          Alaw,
+	"audio/x-alaw":  Alaw,
+	"audio/opus":    Opus,
+}
+
+// ParseEncoding resolves an encoding name or one of its aliases,
+// case-insensitively. Unknown names are returned as is for Validate to
+// reject.
+func ParseEncoding(name string) Encoding {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if e, ok := encodingAliases[name]; ok {
+		return e
+	}
+	return Encoding(name)
+}
+
+var errOpusDisabled = errors.New("opus support not compiled in (build with -tags opus)")
+
+var errDenoiseDisabled = errors.New("noise suppression not compiled in (build with -tags rnnoise)")
+
+// opusRates are the sample rates an Opus encoder can run at.
+var opusRates = map[int]bool{8000: true, 12000: true, 16000: true, 24000: true, 48000: true}
+
+// Format describes the audio carried by a stream's binary frames.
+type Format struct {
+	Encoding   Encoding `json:"encoding"`
+	SampleRate int      `json:"sample_rate"`
+	BitDepth   int      `json:"bit_depth"`
+	Channels   int      `json:"channels"`
+}
+
+// Sample rates accepted from clients; rates other than Backend's are
+// resampled.
+const (
+	MinSampleRate = 8000
+	MaxSampleRate = 96000
+)
+
+// Backend is the format the VAD backend expects: 16 kHz 16-bit mono PCM.
+var Backend = Format{Encoding: PCM16, SampleRate: 16000, BitDepth: 16, Channels: 1}
+
+// Validate reports whether the bridge can deliver audio in f to the backend.
+func (f Format) Validate() error {
+	depth, ok := bitDepth[f.Encoding]
+	if !ok {
+		return fmt.Errorf("unsupported encoding %q", f.Encoding)
+	}
+	if f.BitDepth != depth {
+		return fmt.Errorf("encoding %s has bit depth %d, not %d", f.Encoding, depth, f.BitDepth)
+	}
+	if f.Encoding == Opus {
+		return f.validateOpus()
+	}
+	if f.SampleRate < MinSampleRate || f.SampleRate > MaxSampleRate {
+		return fmt.Errorf("unsupported sample rate %d (want %d-%d)", f.SampleRate, MinSampleRate, MaxSampleRate)
+	}
+	if f.Channels < 1 || f.Channels > MaxChannels {
+		return fmt.Errorf("unsupported channel count %d (want 1-%d)", f.Channels, MaxChannels)
+	}
+	return nil
+}
+
+func (f Format) validateOpus() error {
+	if !opusEnabled {
+		return errOpusDisabled
+	}
+	if !opusRates[f.SampleRate] {
+		return fmt.Errorf("unsupported opus sample rate %d", f.SampleRate)
+	}
+	if f.Channels != 1 && f.Channels != 2 {
+		return fmt.Errorf("unsupported opus channel count %d (want 1 or 2)", f.Channels)
+	}
+	return nil
+}
+
+// WithEncoding returns f using e, with the bit depth that goes with it.
+func (f Format) WithEncoding(e Encoding) Format {
+	f.Encoding = e
+	f.BitDepth = bitDepth[e]
+	return f
+}
+
+// FrameSize is the size in bytes of one sample across all channels. Frames
+// of audio must be a multiple of it. It is zero for packetized encodings.
+func (f Format) FrameSize() int {
+	return f.BitDepth / 8 * f.Channels
+}
+
+func (f Format) String() string {
+	return fmt.Sprintf("%s/%dHz/%dch", f.Encoding, f.SampleRate, f.Channels)
+}
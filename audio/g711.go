@@ -0,0 +1,61 @@
+// audio/g711.go
+package audio
+
+import "encoding/binary"
+
+// G.711 decoding tables, indexed by the encoded byte.
+var (
+	mulawTable = g711Table(decodeMulaw)
+	alawTable  = g711Table(decodeAlaw)
+)
+
+func g711Table(decode func(byte) int16) *[256]int16 {
+	var t [256]int16
+	for i := range t {
+		t[i] = decode(byte(i))
+	}
+	return &t
+}
+
+// decodeMulaw expands one ITU-T G.711 µ-law sample.
+func decodeMulaw(u byte) int16 {
+	u = ^u
+	t := (int(u&0x0f)<<3 + 0x84) << ((u & 0x70) >> 4)
+	if u&0x80 != 0 {
+		return int16(0x84 - t)
+	}
+	return int16(t - 0x84)
+}
+
+// decodeAlaw expands one ITU-T G.711 A-law sample.
+func decodeAlaw(a byte) int16 {
+	a ^= 0x55
+	t := int(a&0x0f) << 4
+	switch seg := (a & 0x70) >> 4; seg {
+	case 0:
+		t += 8
+	case 1:
+		t += 0x108
+	default:
+		t = (t + 0x108) << (seg - 1)
+	}
+	if a&0x80 != 0 {
+		return int16(t)
+	}
+	return int16(-t)
+}
+
+// g711Decoder expands 8-bit companded samples to 16-bit PCM.
+type g711Decoder struct {
+	out   Format
+	table *[256]int16
+}
+
+func (d g711Decoder) Output() Format { return d.out }
+
+func (d g711Decoder) Convert(dst, src []byte) ([]byte, error) {
+	for _, b := range src {
+		dst = binary.LittleEndian.AppendUint16(dst, uint16(d.table[b]))
+	}
+	return dst, nil
+}
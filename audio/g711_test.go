@@ -0,0 +1,75 @@
+// audio/g711_test.go
+package audio
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestG711Tables(t *testing.T) {
+	tests := []struct {
+		name  string
+		table *[256]int16
+		code  byte
+		want  int16
+	}{
+		{"mulaw zero", mulawTable, 0xff, 0},
+		{"mulaw negative zero", mulawTable, 0x7f, 0},
+		{"mulaw max", mulawTable, 0x80, 32124},
+		{"mulaw min", mulawTable, 0x00, -32124},
+		{"mulaw smallest step", mulawTable, 0xfe, 8},
+		{"mulaw segment edge", mulawTable, 0xef, 132},
+		{"alaw smallest", alawTable, 0xd5, 8},
+		{"alaw smallest negative", alawTable, 0x55, -8},
+		{"alaw max", alawTable, 0xaa, 32256},
+		{"alaw min", alawTable, 0x2a, -32256},
+		{"alaw segment edge", alawTable, 0xc5, 264},
+	}
+	for _, tt := range tests {
+		if got := tt.table[tt.code]; got != tt.want {
+			t.Errorf("%s: decode(%#02x) = %d, want %d", tt.name, tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestG711Symmetry(t *testing.T) {
+	for b := range 256 {
+		// The top bit is the sign.
+		if m, n := mulawTable[b], mulawTable[b^0x80]; m != -n {
+			t.Errorf("mulaw %#02x = %d, but %#02x = %d", b, m, b^0x80, n)
+		}
+		if m, n := alawTable[b], alawTable[b^0x80]; m != -n {
+			t.Errorf("alaw %#02x = %d, but %#02x = %d", b, m, b^0x80, n)
+		}
+	}
+}
+
+func TestG711Monotonic(t *testing.T) {
+	// µ-law codes count down from the loudest positive sample; A-law ones,
+	// with the even bits inverted, count up in magnitude.
+	for c := 1; c < 128; c++ {
+		if prev, cur := mulawTable[0x80|(c-1)], mulawTable[0x80|c]; cur >= prev {
+			t.Errorf("mulaw %#02x = %d does not fall below %#02x = %d", 0x80|c, cur, 0x80|(c-1), prev)
+		}
+		a := func(c int) int16 { return alawTable[byte(0x80|c)^0x55] }
+		if prev, cur := a(c-1), a(c); cur <= prev {
+			t.Errorf("alaw magnitude %d = %d does not exceed %d = %d", c, cur, c-1, prev)
+		}
+	}
+}
+
+func TestG711Decoder(t *testing.T) {
+	d := g711Decoder{out: Format{SampleRate: 8000, Channels: 1}.WithEncoding(PCM16), table: mulawTable}
+	dst, err := d.Convert([]byte{0xaa}, []byte{0xff, 0x80, 0x00})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dst) != 7 || dst[0] != 0xaa {
+		t.Fatalf("Convert = %x, want the samples appended to dst", dst)
+	}
+	for i, want := range []int16{0, 32124, -32124} {
+		if got := int16(binary.LittleEndian.Uint16(dst[1+2*i:])); got != want {
+			t.Errorf("sample %d = %d, want %d", i, got, want)
+		}
+	}
+}
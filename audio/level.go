@@ -0,0 +1,59 @@
+// audio/level.go
+package audio
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// FloorDBFS is the level reported for silence: the quietest 16-bit signal.
+const FloorDBFS = -96
+
+// Meter accumulates the RMS and peak level of 16-bit little-endian PCM.
+// The zero value is ready to use.
+type Meter struct {
+	sumSquares float64
+	samples    int
+	peak       int
+}
+
+// Write adds the samples in pcm.
+func (m *Meter) Write(pcm []byte) {
+	for i := 0; i+1 < len(pcm); i += 2 {
+		v := int(int16(binary.LittleEndian.Uint16(pcm[i:])))
+		m.sumSquares += float64(v * v)
+		m.samples++
+		if v < 0 {
+			v = -v
+		}
+		m.peak = max(m.peak, v)
+	}
+}
+
+// Level returns the RMS and peak of the samples written since the last
+// Reset, as fractions of full scale.
+func (m *Meter) Level() (rms, peak float64) {
+	if m.samples == 0 {
+		return 0, 0
+	}
+	return math.Sqrt(m.sumSquares/float64(m.samples)) / 32768, float64(m.peak) / 32768
+}
+
+// Samples returns how many samples were written since the last Reset.
+func (m *Meter) Samples() int {
+	return m.samples
+}
+
+// Reset forgets the samples written so far.
+func (m *Meter) Reset() {
+	*m = Meter{}
+}
+
+// DBFS converts a fraction of full scale to decibels, no lower than
+// FloorDBFS.
+func DBFS(v float64) float64 {
+	if v <= 0 {
+		return FloorDBFS
+	}
+	return max(20*math.Log10(v), FloorDBFS)
+}
@@ -0,0 +1,114 @@
+// audio/ogg.go
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// oggReader splits the first logical bitstream of an Ogg file into packets.
+// Page checksums are not verified; corrupt packets fail to decode instead.
+type oggReader struct {
+	r      io.Reader
+	serial uint32
+	seen   bool
+	// segments left on the current page, and the packet being assembled.
+	lacing []byte
+	packet []byte
+}
+
+// next returns the next complete packet.
+func (o *oggReader) next() ([]byte, error) {
+	o.packet = o.packet[:0]
+	for {
+		for len(o.lacing) > 0 {
+			n := int(o.lacing[0])
+			o.lacing = o.lacing[1:]
+			start := len(o.packet)
+			o.packet = append(o.packet, make([]byte, n)...)
+			if _, err := io.ReadFull(o.r, o.packet[start:]); err != nil {
+				return nil, fmt.Errorf("ogg: %w", err)
+			}
+			// A segment shorter than 255 bytes ends the packet.
+			if n < 255 {
+				return o.packet, nil
+			}
+		}
+		if err := o.readPage(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// readPage reads page headers until one of the tracked stream, and loads
+// its lacing table.
+func (o *oggReader) readPage() error {
+	for {
+		var hdr [27]byte
+		if _, err := io.ReadFull(o.r, hdr[:]); err != nil {
+			if err == io.EOF && len(o.packet) == 0 {
+				return io.EOF
+			}
+			return fmt.Errorf("ogg: %w", err)
+		}
+		if string(hdr[:4]) != "OggS" {
+			return errors.New("ogg: lost page sync")
+		}
+		serial := binary.LittleEndian.Uint32(hdr[14:])
+		lacing := make([]byte, hdr[26])
+		if _, err := io.ReadFull(o.r, lacing); err != nil {
+			return fmt.Errorf("ogg: %w", err)
+		}
+		if !o.seen {
+			o.serial, o.seen = serial, true
+		}
+		if serial == o.serial {
+			o.lacing = lacing
+			return nil
+		}
+		// Skip pages of other multiplexed streams.
+		var size int64
+		for _, n := range lacing {
+			size += int64(n)
+		}
+		if _, err := io.CopyN(io.Discard, o.r, size); err != nil {
+			return fmt.Errorf("ogg: %w", err)
+		}
+	}
+}
+
+// oggOpusSource yields the Opus packets of an Ogg Opus file.
+type oggOpusSource struct {
+	ogg *oggReader
+	f   Format
+}
+
+func openOggOpus(r io.Reader) (Source, error) {
+	o := &oggReader{r: r}
+	head, err := o.next()
+	if err != nil {
+		return nil, err
+	}
+	if len(head) < 19 || !bytes.HasPrefix(head, []byte("OpusHead")) {
+		return nil, errors.New("ogg: only Opus streams are supported")
+	}
+	// Opus always decodes at 48 kHz; the header's input rate is advisory.
+	f := Format{SampleRate: 48000, Channels: int(head[9])}.WithEncoding(Opus)
+	if err := f.Validate(); err != nil {
+		return nil, fmt.Errorf("ogg: %w", err)
+	}
+	// The comment header follows; it carries no audio.
+	if _, err := o.next(); err != nil {
+		return nil, err
+	}
+	return &oggOpusSource{ogg: o, f: f}, nil
+}
+
+func (s *oggOpusSource) Format() Format { return s.f }
+
+func (s *oggOpusSource) ReadFrame() ([]byte, error) {
+	return s.ogg.next()
+}
@@ -0,0 +1,103 @@
+// audio/ogg_test.go
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+)
+
+// oggPage encodes a page of stream serial holding segments, which the
+// lacing table describes as they are: a 255-byte segment continues a
+// packet.
+func oggPage(serial uint32, segments ...[]byte) []byte {
+	hdr := make([]byte, 27)
+	copy(hdr, "OggS")
+	binary.LittleEndian.PutUint32(hdr[14:], serial)
+	hdr[26] = byte(len(segments))
+	var body []byte
+	for _, s := range segments {
+		hdr = append(hdr, byte(len(s)))
+		body = append(body, s...)
+	}
+	return append(hdr, body...)
+}
+
+func TestOggReader(t *testing.T) {
+	full := bytes.Repeat([]byte{'x'}, 255)
+	tests := []struct {
+		name    string
+		in      []byte
+		want    []string
+		wantErr bool
+	}{
+		{"one packet per segment", oggPage(1, []byte("ab"), []byte("cde")), []string{"ab", "cde"}, false},
+		{"packet across segments", oggPage(1, full, []byte("y")), []string{string(full) + "y"}, false},
+		{"packet across pages", append(oggPage(1, full), oggPage(1, []byte("z"))...), []string{string(full) + "z"}, false},
+		{"empty packet", oggPage(1, []byte{}, []byte("a")), []string{"", "a"}, false},
+		{"other streams skipped", append(append(oggPage(1, []byte("a")), oggPage(2, []byte("other"))...), oggPage(1, []byte("b"))...),
+			[]string{"a", "b"}, false},
+		{"no pages", nil, nil, false},
+		{"lost sync", append(oggPage(1, []byte("a")), "junk that is long enough to be a header"...), []string{"a"}, true},
+		{"truncated header", append(oggPage(1, []byte("a")), "OggS"...), []string{"a"}, true},
+		{"truncated lacing", oggPage(1, []byte("a"))[:27], nil, true},
+		{"segment past the end", oggPage(1, []byte("abc"))[:29], nil, true},
+		{"packet unfinished at the end", oggPage(1, full), nil, true},
+		{"skipped page truncated", append(oggPage(1, []byte("a")), oggPage(2, []byte("other"))[:30]...), []string{"a"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &oggReader{r: bytes.NewReader(tt.in)}
+			var got []string
+			var err error
+			for {
+				var p []byte
+				if p, err = o.next(); err != nil {
+					break
+				}
+				got = append(got, string(p))
+			}
+			if tt.wantErr == (err == io.EOF) {
+				t.Errorf("next error = %v, want a failure %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d packets, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("packet %d = %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestOpenOggOpus(t *testing.T) {
+	if _, err := openOggOpus(bytes.NewReader(oggPage(7, []byte("Speex   header")))); err == nil {
+		t.Error("openOggOpus accepted a stream that isn't Opus")
+	}
+
+	head := append([]byte("OpusHead\x01\x02"), make([]byte, 9)...)
+	in := append(oggPage(7, head), oggPage(7, []byte("OpusTags"), []byte{0xf8, 1, 2}, []byte{0xf8, 3})...)
+	src, err := openOggOpus(bytes.NewReader(in))
+	if errors.Is(err, errOpusDisabled) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Format{SampleRate: 48000, Channels: 2}.WithEncoding(Opus)); src.Format() != want {
+		t.Errorf("Format = %v, want %v", src.Format(), want)
+	}
+	for _, want := range [][]byte{{0xf8, 1, 2}, {0xf8, 3}} {
+		p, err := src.ReadFrame()
+		if err != nil || !bytes.Equal(p, want) {
+			t.Fatalf("ReadFrame = %x, %v; want %x", p, err, want)
+		}
+	}
+	if _, err := src.ReadFrame(); err != io.EOF {
+		t.Errorf("ReadFrame after the last packet = %v, want io.EOF", err)
+	}
+}
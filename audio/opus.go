@@ -0,0 +1,67 @@
+// audio/opus.go
+
+//go:build opus && cgo
+
+package audio
+
+/*
+#cgo pkg-config: opus
+#include <opus.h>
+*/
+import "C"
+
+import (
+	"encoding/binary"
+	"fmt"
+	"unsafe"
+)
+
+const opusEnabled = true
+
+// maxOpusFrame is the longest Opus packet, 120 ms, in samples at 48 kHz.
+const maxOpusFrame = 5760
+
+// opusDecoder decodes one raw Opus packet per Convert call straight to PCM
+// at the requested rate and channel count; libopus up- or downmixes streams
+// with a different number of channels itself.
+type opusDecoder struct {
+	out Format
+	// mem holds the libopus decoder state. It contains no Go pointers, so
+	// it may live on the Go heap.
+	mem []byte
+	pcm []int16
+}
+
+func newOpusDecoder(rate, channels int) (Converter, error) {
+	d := &opusDecoder{
+		out: Format{Encoding: PCM16, SampleRate: rate, BitDepth: 16, Channels: channels},
+		mem: make([]byte, C.opus_decoder_get_size(C.int(channels))),
+		pcm: make([]int16, maxOpusFrame*rate/48000*channels),
+	}
+	if rc := C.opus_decoder_init(d.state(), C.opus_int32(rate), C.int(channels)); rc != C.OPUS_OK {
+		return nil, fmt.Errorf("opus: %s", C.GoString(C.opus_strerror(rc)))
+	}
+	return d, nil
+}
+
+func (d *opusDecoder) state() *C.OpusDecoder {
+	return (*C.OpusDecoder)(unsafe.Pointer(&d.mem[0]))
+}
+
+func (d *opusDecoder) Output() Format { return d.out }
+
+func (d *opusDecoder) Convert(dst, src []byte) ([]byte, error) {
+	if len(src) == 0 {
+		return dst, nil
+	}
+	n := C.opus_decode(d.state(),
+		(*C.uchar)(unsafe.Pointer(&src[0])), C.opus_int32(len(src)),
+		(*C.opus_int16)(unsafe.Pointer(&d.pcm[0])), C.int(len(d.pcm)/d.out.Channels), 0)
+	if n < 0 {
+		return dst, fmt.Errorf("opus: %s", C.GoString(C.opus_strerror(n)))
+	}
+	for _, v := range d.pcm[:int(n)*d.out.Channels] {
+		dst = binary.LittleEndian.AppendUint16(dst, uint16(v))
+	}
+	return dst, nil
+}
@@ -0,0 +1,11 @@
+// audio/opus_disabled.go
+
+//go:build !opus || !cgo
+
+package audio
+
+const opusEnabled = false
+
+func newOpusDecoder(rate, channels int) (Converter, error) {
+	return nil, errOpusDisabled
+}
@@ -0,0 +1,117 @@
+// audio/resample.go
+package audio
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// zeroCrossings is how many sinc lobes the filter keeps on each side. Eight
+// is plenty for speech detection and keeps the per-sample cost low.
+const zeroCrossings = 8
+
+// resampler converts 16-bit mono PCM between sample rates with a polyphase
+// windowed-sinc filter. It keeps the tail of each chunk so the output is
+// continuous across chunks.
+type resampler struct {
+	out Format
+	// An output sample is produced every m/l input samples.
+	l, m int
+	// half is the filter's reach, in input samples, on each side.
+	half  int
+	table [][]float32
+	// buf holds the input samples not yet fully consumed, and t is the
+	// position of the next output sample in buf, in 1/l input samples.
+	buf []float32
+	t   int
+}
+
+func newResampler(in Format, rate int) *resampler {
+	g := gcd(in.SampleRate, rate)
+	r := &resampler{out: in, l: rate / g, m: in.SampleRate / g}
+	r.out.SampleRate = rate
+
+	// Downsampling must also cut everything above the new Nyquist rate.
+	cutoff := math.Min(1, float64(rate)/float64(in.SampleRate))
+	r.half = int(math.Ceil(zeroCrossings / cutoff))
+	r.table = make([][]float32, r.l)
+	for p := range r.table {
+		taps := make([]float32, 2*r.half)
+		var sum float64
+		coef := make([]float64, len(taps))
+		for j := range taps {
+			d := float64(r.half-1-j) + float64(p)/float64(r.l)
+			coef[j] = cutoff * sinc(cutoff*d) * blackman(d/float64(r.half))
+			sum += coef[j]
+		}
+		for j := range taps {
+			// Unity gain at DC for every phase.
+			taps[j] = float32(coef[j] / sum)
+		}
+		r.table[p] = taps
+	}
+	// Start with silence as history so the first sample is centred.
+	r.buf = make([]float32, r.half)
+	r.t = r.half * r.l
+	return r
+}
+
+func (r *resampler) Output() Format { return r.out }
+
+func (r *resampler) Convert(dst, src []byte) ([]byte, error) {
+	for i := 0; i+2 <= len(src); i += 2 {
+		r.buf = append(r.buf, float32(int16(binary.LittleEndian.Uint16(src[i:]))))
+	}
+	for {
+		i, p := r.t/r.l, r.t%r.l
+		start := i - r.half + 1
+		if start+2*r.half > len(r.buf) {
+			break
+		}
+		var acc float32
+		for j, c := range r.table[p] {
+			acc += c * r.buf[start+j]
+		}
+		dst = binary.LittleEndian.AppendUint16(dst, uint16(clip16(acc)))
+		r.t += r.m
+	}
+	// Drop the input no future output sample reaches back to.
+	if drop := r.t/r.l - r.half + 1; drop > 0 {
+		n := copy(r.buf, r.buf[drop:])
+		r.buf = r.buf[:n]
+		r.t -= drop * r.l
+	}
+	return dst, nil
+}
+
+func clip16(v float32) int16 {
+	switch {
+	case v >= math.MaxInt16:
+		return math.MaxInt16
+	case v <= math.MinInt16:
+		return math.MinInt16
+	}
+	return int16(math.Round(float64(v)))
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// blackman is the Blackman window over x in [-1, 1].
+func blackman(x float64) float64 {
+	if x < -1 || x > 1 {
+		return 0
+	}
+	return 0.42 + 0.5*math.Cos(math.Pi*x) + 0.08*math.Cos(2*math.Pi*x)
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
@@ -0,0 +1,110 @@
+// audio/resample_test.go
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// tone returns n samples of a sine at freq Hz, sampled at rate.
+func tone(n, rate int, freq, amp float64) []byte {
+	b := make([]byte, 0, 2*n)
+	for i := range n {
+		v := amp * math.Sin(2*math.Pi*freq*float64(i)/float64(rate))
+		b = binary.LittleEndian.AppendUint16(b, uint16(int16(v)))
+	}
+	return b
+}
+
+// samples decodes 16-bit PCM.
+func samples(b []byte) []float64 {
+	s := make([]float64, len(b)/2)
+	for i := range s {
+		s[i] = float64(int16(binary.LittleEndian.Uint16(b[2*i:])))
+	}
+	return s
+}
+
+func rms(s []float64) float64 {
+	var sum float64
+	for _, v := range s {
+		sum += v * v
+	}
+	return math.Sqrt(sum / float64(len(s)))
+}
+
+func TestResamplerChunking(t *testing.T) {
+	in := tone(8000, 44100, 440, 10000)
+	for _, rates := range [][2]int{{44100, 16000}, {8000, 16000}, {48000, 16000}, {22050, 16000}} {
+		f := Format{SampleRate: rates[0], Channels: 1}.WithEncoding(PCM16)
+		whole, _ := newResampler(f, rates[1]).Convert(nil, in)
+
+		// Chunks of odd sizes, some splitting a sample, must make the same
+		// output as one chunk.
+		r := newResampler(f, rates[1])
+		var pieces, carry []byte
+		for i, sizes := 0, []int{1, 7, 160, 33, 2, 999}; i < len(in); {
+			n := min(sizes[(i/7)%len(sizes)], len(in)-i)
+			chunk := append(carry, in[i:i+n]...)
+			whole := len(chunk) - len(chunk)%2
+			pieces, _ = r.Convert(pieces, chunk[:whole])
+			carry = append([]byte(nil), chunk[whole:]...)
+			i += n
+		}
+		if !bytes.Equal(pieces, whole) {
+			t.Errorf("%d to %d Hz: chunked output (%d bytes) differs from whole (%d bytes)", rates[0], rates[1], len(pieces), len(whole))
+		}
+	}
+}
+
+func TestResamplerLength(t *testing.T) {
+	for _, rates := range [][2]int{{8000, 16000}, {48000, 16000}, {44100, 16000}, {16000, 16000}} {
+		f := Format{SampleRate: rates[0], Channels: 1}.WithEncoding(PCM16)
+		n := rates[0] // one second
+		out, _ := newResampler(f, rates[1]).Convert(nil, tone(n, rates[0], 300, 1000))
+		// Output lags the input by the filter's reach.
+		got, want := len(out)/2, rates[1]
+		if got > want || got < want-want/50 {
+			t.Errorf("%d to %d Hz: 1 s became %d samples, want about %d", rates[0], rates[1], got, want)
+		}
+	}
+}
+
+func TestResamplerFrequencyResponse(t *testing.T) {
+	f := Format{SampleRate: 48000, Channels: 1}.WithEncoding(PCM16)
+	tests := []struct {
+		name             string
+		freq             float64
+		minGain, maxGain float64
+	}{
+		{"speech passes", 1000, 0.97, 1.03},
+		{"above nyquist is cut", 12000, 0, 0.05},
+	}
+	for _, tt := range tests {
+		in := tone(f.SampleRate, f.SampleRate, tt.freq, 10000)
+		out, _ := newResampler(f, 16000).Convert(nil, in)
+		s := samples(out)
+		// Skip the filter's start-up.
+		gain := rms(s[1000:]) / rms(samples(in)[3000:])
+		if gain < tt.minGain || gain > tt.maxGain {
+			t.Errorf("%s: %g Hz gain = %.3f, want %.2f-%.2f", tt.name, tt.freq, gain, tt.minGain, tt.maxGain)
+		}
+	}
+}
+
+func TestResamplerDC(t *testing.T) {
+	f := Format{SampleRate: 8000, Channels: 1}.WithEncoding(PCM16)
+	var in []byte
+	dc := int16(-12000)
+	for range 4000 {
+		in = binary.LittleEndian.AppendUint16(in, uint16(dc))
+	}
+	out, _ := newResampler(f, 16000).Convert(nil, in)
+	for i, v := range samples(out)[100:] {
+		if math.Abs(v+12000) > 1 {
+			t.Fatalf("sample %d = %g, want -12000", 100+i, v)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+// audio/rnnoise.go
+
+//go:build rnnoise && cgo
+
+package audio
+
+/*
+#cgo pkg-config: rnnoise
+#include <rnnoise.h>
+*/
+import "C"
+
+import (
+	"encoding/binary"
+	"unsafe"
+)
+
+// DenoiseEnabled reports whether noise suppression is built in.
+const DenoiseEnabled = true
+
+// rnnoiseFilter suppresses noise in 16-bit mono PCM at denoiseRate with
+// RNNoise, one 10 ms frame at a time, holding partial frames until the next
+// call.
+type rnnoiseFilter struct {
+	out Format
+	// mem holds the RNNoise state. It contains no Go pointers, so it may
+	// live on the Go heap.
+	mem     []byte
+	pending []float32
+	frame   []float32
+}
+
+func newRNNoise(in Format) (Converter, error) {
+	d := &rnnoiseFilter{
+		out:   in,
+		mem:   make([]byte, C.rnnoise_get_size()),
+		frame: make([]float32, C.rnnoise_get_frame_size()),
+	}
+	// A nil model selects the one built into the library.
+	C.rnnoise_init(d.state(), nil)
+	return d, nil
+}
+
+func (d *rnnoiseFilter) state() *C.DenoiseState {
+	return (*C.DenoiseState)(unsafe.Pointer(&d.mem[0]))
+}
+
+func (d *rnnoiseFilter) Output() Format { return d.out }
+
+func (d *rnnoiseFilter) Convert(dst, src []byte) ([]byte, error) {
+	// RNNoise works on floats at 16-bit scale.
+	for i := 0; i+2 <= len(src); i += 2 {
+		d.pending = append(d.pending, float32(int16(binary.LittleEndian.Uint16(src[i:]))))
+	}
+	n := len(d.frame)
+	done := 0
+	for ; done+n <= len(d.pending); done += n {
+		in := d.pending[done : done+n]
+		C.rnnoise_process_frame(d.state(),
+			(*C.float)(unsafe.Pointer(&d.frame[0])), (*C.float)(unsafe.Pointer(&in[0])))
+		for _, v := range d.frame {
+			dst = binary.LittleEndian.AppendUint16(dst, uint16(clip16(v)))
+		}
+	}
+	rest := copy(d.pending, d.pending[done:])
+	d.pending = d.pending[:rest]
+	return dst, nil
+}
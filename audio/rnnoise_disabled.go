@@ -0,0 +1,11 @@
+// audio/rnnoise_disabled.go
+
+//go:build !rnnoise || !cgo
+
+package audio
+
+const DenoiseEnabled = false
+
+func newRNNoise(in Format) (Converter, error) {
+	return nil, errDenoiseDisabled
+}
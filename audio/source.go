@@ -0,0 +1,103 @@
+// audio/source.go
+package audio
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+// ErrUnknownContainer is returned by OpenFile for data that does not start
+// with a recognised file header; it may still be raw audio.
+var ErrUnknownContainer = errors.New("unrecognised audio container")
+
+// ErrShortHeader is returned by ParseStreamHeader when the header runs past
+// the bytes given.
+var ErrShortHeader = errors.New("audio header incomplete")
+
+// frameDuration is how much audio a Source returns per frame where the
+// container leaves it free, in Hz: 1/50 s.
+const frameDuration = 50
+
+// Source yields the audio frames of a file or stream in its Format.
+type Source interface {
+	Format() Format
+	// ReadFrame returns the next frame, or io.EOF after the last one.
+	ReadFrame() ([]byte, error)
+}
+
+// OpenFile detects the container of r from its first bytes and returns a
+// Source for the audio inside. WAV, FLAC and Ogg Opus are understood.
+func OpenFile(r *bufio.Reader) (Source, error) {
+	magic, err := r.Peek(4)
+	if err != nil && len(magic) == 0 {
+		if err == io.EOF {
+			return nil, errors.New("empty audio file")
+		}
+		return nil, err
+	}
+	switch {
+	case bytes.Equal(magic, []byte("RIFF")):
+		return openWAV(r)
+	case bytes.Equal(magic, []byte("fLaC")):
+		return openFLAC(r)
+	case bytes.Equal(magic, []byte("OggS")):
+		return openOggOpus(r)
+	}
+	return nil, ErrUnknownContainer
+}
+
+// ParseStreamHeader parses the container header at the start of a stream
+// delivered in pieces, such as WebSocket frames. Only WAV can be unwrapped
+// this way. It returns the format, the offset of the first sample in b and
+// the size of the audio data, or -1 if the header leaves it open.
+func ParseStreamHeader(b []byte) (f Format, offset int, size int64, err error) {
+	switch {
+	case len(b) < 4 && bytes.HasPrefix([]byte("RIFF"), b):
+		// Too little to tell yet.
+		return Format{}, 0, 0, ErrShortHeader
+	case bytes.HasPrefix(b, []byte("RIFF")):
+	case bytes.HasPrefix(b, []byte("fLaC")), bytes.HasPrefix(b, []byte("OggS")):
+		return Format{}, 0, 0, errors.New("FLAC and Ogg audio can only be uploaded as files")
+	default:
+		return Format{}, 0, 0, ErrUnknownContainer
+	}
+	r := bytes.NewReader(b)
+	f, size, err = readWAVHeader(r)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return Format{}, 0, 0, ErrShortHeader
+	}
+	return f, len(b) - r.Len(), size, err
+}
+
+// NewRawSource reads headerless audio in format f from r. Packetized
+// encodings need a container to delimit their packets.
+func NewRawSource(r io.Reader, f Format) (Source, error) {
+	if f.FrameSize() == 0 {
+		return nil, errors.New(string(f.Encoding) + " audio needs a container")
+	}
+	return &rawSource{r: r, f: f, buf: make([]byte, f.FrameSize()*max(f.SampleRate/frameDuration, 1))}, nil
+}
+
+// rawSource cuts a byte stream into frames of whole samples.
+type rawSource struct {
+	r   io.Reader
+	f   Format
+	buf []byte
+}
+
+func (s *rawSource) Format() Format { return s.f }
+
+func (s *rawSource) ReadFrame() ([]byte, error) {
+	n, err := io.ReadFull(s.r, s.buf)
+	if err == io.ErrUnexpectedEOF {
+		// Drop a trailing partial sample.
+		n -= n % s.f.FrameSize()
+		err = nil
+	}
+	if n == 0 && err == nil {
+		err = io.EOF
+	}
+	return s.buf[:n], err
+}
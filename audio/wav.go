@@ -0,0 +1,148 @@
+// audio/wav.go
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// WAVE format tags.
+const (
+	wavePCM        = 1
+	waveFloat      = 3
+	waveAlaw       = 6
+	waveMulaw      = 7
+	waveExtensible = 0xfffe
+)
+
+// openWAV parses a RIFF/WAVE header and returns a Source for its data chunk.
+func openWAV(r io.Reader) (Source, error) {
+	f, size, err := readWAVHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if size >= 0 {
+		r = io.LimitReader(r, size)
+	}
+	return NewRawSource(r, f)
+}
+
+// readWAVHeader reads a RIFF/WAVE header up to the start of the samples. It
+// returns the data chunk's size, or -1 if the writer left it open.
+func readWAVHeader(r io.Reader) (Format, int64, error) {
+	var hdr [12]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return Format{}, 0, fmt.Errorf("wav: %w", err)
+	}
+	if string(hdr[8:12]) != "WAVE" {
+		return Format{}, 0, errors.New("wav: RIFF file is not WAVE")
+	}
+
+	var f Format
+	for {
+		var ch [8]byte
+		if _, err := io.ReadFull(r, ch[:]); err != nil {
+			return Format{}, 0, fmt.Errorf("wav: no data chunk: %w", err)
+		}
+		id, size := string(ch[:4]), binary.LittleEndian.Uint32(ch[4:])
+		switch id {
+		case "fmt ":
+			var err error
+			if f, err = parseWAVFormat(r, size); err != nil {
+				return Format{}, 0, err
+			}
+		case "data":
+			if f.Encoding == "" {
+				return Format{}, 0, errors.New("wav: data chunk before fmt chunk")
+			}
+			// Streaming writers leave the size at 0 or its maximum.
+			if size == 0 || size == 0xffffffff {
+				return f, -1, nil
+			}
+			return f, int64(size), nil
+		default:
+			// Chunks are padded to an even size.
+			if _, err := io.CopyN(io.Discard, r, int64(size)+int64(size&1)); err != nil {
+				return Format{}, 0, fmt.Errorf("wav: %w", err)
+			}
+		}
+	}
+}
+
+// maxWAVFormatSize bounds the fmt chunk. WAVE_FORMAT_EXTENSIBLE needs 40
+// bytes; anything far beyond that is corrupt or hostile.
+const maxWAVFormatSize = 1024
+
+func parseWAVFormat(r io.Reader, size uint32) (Format, error) {
+	if size < 16 {
+		return Format{}, errors.New("wav: fmt chunk too short")
+	}
+	if size > maxWAVFormatSize {
+		return Format{}, fmt.Errorf("wav: fmt chunk of %d bytes too long", size)
+	}
+	// Only the first 40 bytes are parsed; the rest, and the pad byte, are
+	// skipped.
+	b := make([]byte, min(size, 40))
+	if _, err := io.ReadFull(r, b); err != nil {
+		return Format{}, fmt.Errorf("wav: %w", err)
+	}
+	if rest := int64(size) - int64(len(b)) + int64(size&1); rest > 0 {
+		if _, err := io.CopyN(io.Discard, r, rest); err != nil {
+			return Format{}, fmt.Errorf("wav: %w", err)
+		}
+	}
+	tag := binary.LittleEndian.Uint16(b[0:])
+	channels := int(binary.LittleEndian.Uint16(b[2:]))
+	rate := int(binary.LittleEndian.Uint32(b[4:]))
+	bits := int(binary.LittleEndian.Uint16(b[14:]))
+	if tag == waveExtensible && size >= 40 {
+		// The real tag leads the sub-format GUID.
+		tag = binary.LittleEndian.Uint16(b[24:])
+	}
+
+	var enc Encoding
+	switch {
+	case tag == wavePCM && bits == 16:
+		enc = PCM16
+	case tag == waveFloat && bits == 32:
+		enc = Float32
+	case tag == waveMulaw && bits == 8:
+		enc = Mulaw
+	case tag == waveAlaw && bits == 8:
+		enc = Alaw
+	default:
+		return Format{}, fmt.Errorf("wav: unsupported format tag %d with %d-bit samples", tag, bits)
+	}
+	f := Format{SampleRate: rate, Channels: channels}.WithEncoding(enc)
+	if err := f.Validate(); err != nil {
+		return Format{}, fmt.Errorf("wav: %w", err)
+	}
+	return f, nil
+}
+
+// WAVHeaderSize is the size of the canonical PCM WAV header.
+const WAVHeaderSize = 44
+
+// WAVHeader returns the canonical header of a PCM WAV file holding dataSize
+// bytes of audio in f; 0xffffffff marks a stream of unknown length.
+func WAVHeader(f Format, dataSize uint32) []byte {
+	riffSize := dataSize
+	if dataSize != 0xffffffff {
+		riffSize = dataSize + WAVHeaderSize - 8
+	}
+	b := make([]byte, 0, WAVHeaderSize)
+	b = append(b, "RIFF"...)
+	b = binary.LittleEndian.AppendUint32(b, riffSize)
+	b = append(b, "WAVEfmt "...)
+	b = binary.LittleEndian.AppendUint32(b, 16)
+	b = binary.LittleEndian.AppendUint16(b, 1) // PCM
+	b = binary.LittleEndian.AppendUint16(b, uint16(f.Channels))
+	b = binary.LittleEndian.AppendUint32(b, uint32(f.SampleRate))
+	b = binary.LittleEndian.AppendUint32(b, uint32(f.SampleRate*f.FrameSize()))
+	b = binary.LittleEndian.AppendUint16(b, uint16(f.FrameSize()))
+	b = binary.LittleEndian.AppendUint16(b, uint16(f.BitDepth))
+	b = append(b, "data"...)
+	return binary.LittleEndian.AppendUint32(b, dataSize)
+}
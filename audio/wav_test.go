@@ -0,0 +1,178 @@
+// audio/wav_test.go
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// chunk encodes a RIFF chunk, padding odd bodies. size overrides the
+// recorded size when not negative.
+func chunk(id string, body []byte, size int64) []byte {
+	if size < 0 {
+		size = int64(len(body))
+	}
+	b := append([]byte(id), binary.LittleEndian.AppendUint32(nil, uint32(size))...)
+	b = append(b, body...)
+	if len(body)%2 == 1 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// fmtBody encodes a fmt chunk body.
+func fmtBody(tag uint16, channels, rate, bits int) []byte {
+	b := binary.LittleEndian.AppendUint16(nil, tag)
+	b = binary.LittleEndian.AppendUint16(b, uint16(channels))
+	b = binary.LittleEndian.AppendUint32(b, uint32(rate))
+	b = binary.LittleEndian.AppendUint32(b, uint32(rate*channels*bits/8))
+	b = binary.LittleEndian.AppendUint16(b, uint16(channels*bits/8))
+	return binary.LittleEndian.AppendUint16(b, uint16(bits))
+}
+
+// extensible encodes a WAVE_FORMAT_EXTENSIBLE fmt body whose sub-format
+// is tag.
+func extensible(tag uint16, channels, rate, bits int) []byte {
+	b := fmtBody(waveExtensible, channels, rate, bits)
+	b = binary.LittleEndian.AppendUint16(b, 22) // cbSize
+	b = binary.LittleEndian.AppendUint16(b, uint16(bits))
+	b = binary.LittleEndian.AppendUint32(b, 0) // channel mask
+	b = binary.LittleEndian.AppendUint16(b, tag)
+	return append(b, "\x00\x00\x00\x00\x10\x00\x80\x00\x00\xaa\x00\x38\x9b\x71"...)
+}
+
+func riff(chunks ...[]byte) []byte {
+	b := []byte("RIFF\x00\x00\x00\x00WAVE")
+	for _, c := range chunks {
+		b = append(b, c...)
+	}
+	return b
+}
+
+func TestReadWAVHeader(t *testing.T) {
+	pcm := Format{SampleRate: 16000, Channels: 1}.WithEncoding(PCM16)
+	tests := []struct {
+		name    string
+		in      []byte
+		want    Format
+		size    int64
+		wantErr bool
+	}{
+		{"canonical", WAVHeader(pcm, 320), pcm, 320, false},
+		{"open-ended max", WAVHeader(pcm, 0xffffffff), pcm, -1, false},
+		{"open-ended zero", riff(chunk("fmt ", fmtBody(wavePCM, 1, 16000, 16), -1), chunk("data", nil, 0)), pcm, -1, false},
+		{"stereo float", riff(chunk("fmt ", fmtBody(waveFloat, 2, 48000, 32), -1), chunk("data", nil, 8)),
+			Format{SampleRate: 48000, Channels: 2}.WithEncoding(Float32), 8, false},
+		{"mulaw", riff(chunk("fmt ", fmtBody(waveMulaw, 1, 8000, 8), -1), chunk("data", nil, 160)),
+			Format{SampleRate: 8000, Channels: 1}.WithEncoding(Mulaw), 160, false},
+		{"alaw", riff(chunk("fmt ", fmtBody(waveAlaw, 1, 8000, 8), -1), chunk("data", nil, 160)),
+			Format{SampleRate: 8000, Channels: 1}.WithEncoding(Alaw), 160, false},
+		{"extensible", riff(chunk("fmt ", extensible(wavePCM, 1, 16000, 16), -1), chunk("data", nil, 2)), pcm, 2, false},
+		{"chunks skipped", riff(chunk("LIST", []byte("odd"), -1), chunk("fmt ", fmtBody(wavePCM, 1, 16000, 16), -1),
+			chunk("fact", []byte{1, 2, 3, 4}, -1), chunk("data", nil, 4)), pcm, 4, false},
+		{"fmt with extra bytes", riff(chunk("fmt ", append(fmtBody(wavePCM, 1, 16000, 16), make([]byte, 51)...), -1),
+			chunk("data", nil, 4)), pcm, 4, false},
+		{"not wave", []byte("RIFF\x00\x00\x00\x00AVI "), Format{}, 0, true},
+		{"data before fmt", riff(chunk("data", nil, 4)), Format{}, 0, true},
+		{"no data chunk", riff(chunk("fmt ", fmtBody(wavePCM, 1, 16000, 16), -1)), Format{}, 0, true},
+		{"fmt too short", riff(chunk("fmt ", make([]byte, 14), -1)), Format{}, 0, true},
+		{"fmt size wraps", riff(chunk("fmt ", fmtBody(wavePCM, 1, 16000, 16), 0xffffffff)), Format{}, 0, true},
+		{"fmt size huge", riff(chunk("fmt ", fmtBody(wavePCM, 1, 16000, 16), 0x7ffffff0)), Format{}, 0, true},
+		{"fmt truncated", riff(chunk("fmt ", fmtBody(wavePCM, 1, 16000, 16), 40)), Format{}, 0, true},
+		{"skipped chunk truncated", riff(chunk("LIST", nil, 0x7fffffff)), Format{}, 0, true},
+		{"8-bit pcm", riff(chunk("fmt ", fmtBody(wavePCM, 1, 8000, 8), -1), chunk("data", nil, 4)), Format{}, 0, true},
+		{"no channels", riff(chunk("fmt ", fmtBody(wavePCM, 0, 16000, 16), -1), chunk("data", nil, 4)), Format{}, 0, true},
+		{"truncated riff", []byte("RIFF\x00\x00"), Format{}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, size, err := readWAVHeader(bytes.NewReader(tt.in))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("readWAVHeader = %v, %d; want an error", f, size)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readWAVHeader: %v", err)
+			}
+			if f != tt.want || size != tt.size {
+				t.Errorf("readWAVHeader = %v, %d; want %v, %d", f, size, tt.want, tt.size)
+			}
+		})
+	}
+}
+
+func TestParseStreamHeader(t *testing.T) {
+	pcm := Format{SampleRate: 16000, Channels: 1}.WithEncoding(PCM16)
+	header := WAVHeader(pcm, 4)
+	tests := []struct {
+		name   string
+		in     []byte
+		want   Format
+		offset int
+		size   int64
+		err    error
+	}{
+		{"header alone", header, pcm, WAVHeaderSize, 4, nil},
+		{"header and samples", append(header[:len(header):len(header)], 1, 2, 3, 4), pcm, WAVHeaderSize, 4, nil},
+		{"open-ended", WAVHeader(pcm, 0xffffffff), pcm, WAVHeaderSize, -1, nil},
+		{"magic only", []byte("RIFF"), Format{}, 0, 0, ErrShortHeader},
+		{"split in fmt", header[:20], Format{}, 0, 0, ErrShortHeader},
+		{"split in data chunk header", header[:WAVHeaderSize-2], Format{}, 0, 0, ErrShortHeader},
+		{"raw audio", []byte{0, 1, 2, 3, 4, 5}, Format{}, 0, 0, ErrUnknownContainer},
+		{"empty", nil, Format{}, 0, 0, ErrShortHeader},
+		{"magic split", []byte("RI"), Format{}, 0, 0, ErrShortHeader},
+		{"short raw audio", []byte{1, 2}, Format{}, 0, 0, ErrUnknownContainer},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, offset, size, err := ParseStreamHeader(tt.in)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("ParseStreamHeader error = %v, want %v", err, tt.err)
+			}
+			if f != tt.want || offset != tt.offset || size != tt.size {
+				t.Errorf("ParseStreamHeader = %v, %d, %d; want %v, %d, %d", f, offset, size, tt.want, tt.offset, tt.size)
+			}
+		})
+	}
+
+	for _, magic := range []string{"fLaC", "OggS"} {
+		if _, _, _, err := ParseStreamHeader([]byte(magic + "\x00\x00\x00\x00")); err == nil || errors.Is(err, ErrUnknownContainer) {
+			t.Errorf("ParseStreamHeader(%q...) error = %v, want a file-only error", magic, err)
+		}
+	}
+	// A fmt chunk claiming more than any real one must fail outright, not
+	// wait for more of the header.
+	oversized := riff(chunk("fmt ", fmtBody(wavePCM, 1, 16000, 16), 0xffffffff))
+	if _, _, _, err := ParseStreamHeader(oversized); err == nil || errors.Is(err, ErrShortHeader) {
+		t.Errorf("ParseStreamHeader(oversized fmt) error = %v, want a format error", err)
+	}
+}
+
+func TestWAVSource(t *testing.T) {
+	pcm := Format{SampleRate: 16000, Channels: 1}.WithEncoding(PCM16)
+	samples := make([]byte, 1000)
+	for i := range samples {
+		samples[i] = byte(i)
+	}
+	// Bytes past the data chunk are not audio.
+	in := append(append(WAVHeader(pcm, uint32(len(samples))), samples...), "LIST\x04\x00\x00\x00junk"...)
+	src, err := openWAV(bytes.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []byte
+	for {
+		frame, err := src.ReadFrame()
+		got = append(got, frame...)
+		if err != nil {
+			break
+		}
+	}
+	if !bytes.Equal(got, samples) {
+		t.Errorf("read %d bytes of audio, want the %d of the data chunk", len(got), len(samples))
+	}
+}
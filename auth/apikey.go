@@ -0,0 +1,145 @@
+// auth/apikey.go
+package auth
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+	"gopkg.in/yaml.v3"
+)
+
+// APIKeyHeader is the header machine callers put their key in. The key may
+// also be sent as "Authorization: ApiKey <key>".
+const APIKeyHeader = "X-API-Key"
+
+// APIKey describes one machine caller. Only the SHA-256 of the key is stored,
+// as produced by `printf %s "$KEY" | sha256sum`.
+type APIKey struct {
+	Name          string `yaml:"name"`
+	SHA256        string `yaml:"sha256"`
+	RatePerMinute int    `yaml:"rate_per_minute"`
+	Tenant        string `yaml:"tenant"`
+}
+
+// LoadAPIKeyFile reads keys from a YAML file of the form
+//
+//	keys:
+//	  - name: ingest
+//	    sha256: 9f86d081884c7d65...
+//	    rate_per_minute: 120
+//	    tenant: acme
+func LoadAPIKeyFile(path string) ([]APIKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("auth: %w", err)
+	}
+	var file struct {
+		Keys []APIKey `yaml:"keys"`
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&file); err != nil {
+		return nil, fmt.Errorf("auth: %s: %w", path, err)
+	}
+	return file.Keys, nil
+}
+
+// ParseAPIKeys parses "name:sha256[:rate_per_minute[:tenant]]" entries, the
+// format used to deliver keys through the environment. An empty rate uses
+// the default.
+func ParseAPIKeys(specs []string) ([]APIKey, error) {
+	keys := make([]APIKey, 0, len(specs))
+	for _, spec := range specs {
+		parts := strings.Split(spec, ":")
+		if len(parts) < 2 || len(parts) > 4 {
+			return nil, fmt.Errorf("auth: invalid API key entry %q", spec)
+		}
+		k := APIKey{Name: parts[0], SHA256: parts[1]}
+		if len(parts) == 4 {
+			k.Tenant = parts[3]
+		}
+		if len(parts) >= 3 && parts[2] != "" {
+			n, err := strconv.Atoi(parts[2])
+			if err != nil {
+				return nil, fmt.Errorf("auth: invalid rate in API key entry %q", spec)
+			}
+			k.RatePerMinute = n
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// APIKeys authenticates requests by API key and enforces each key's rate
+// limit.
+type APIKeys struct {
+	byHash map[[sha256.Size]byte]*apiKeyEntry
+}
+
+type apiKeyEntry struct {
+	name    string
+	tenant  string
+	limiter *rate.Limiter // nil when unlimited
+}
+
+// NewAPIKeys builds the key store. Keys without their own rate use
+// defaultRatePerMinute; zero means unlimited.
+func NewAPIKeys(keys []APIKey, defaultRatePerMinute int) (*APIKeys, error) {
+	s := &APIKeys{byHash: map[[sha256.Size]byte]*apiKeyEntry{}}
+	for _, k := range keys {
+		raw, err := hex.DecodeString(k.SHA256)
+		if err != nil || len(raw) != sha256.Size {
+			return nil, fmt.Errorf("auth: API key %q: sha256 must be 64 hex characters", k.Name)
+		}
+		var h [sha256.Size]byte
+		copy(h[:], raw)
+		if _, dup := s.byHash[h]; dup {
+			return nil, fmt.Errorf("auth: API key %q is listed twice", k.Name)
+		}
+
+		e := &apiKeyEntry{name: k.Name, tenant: k.Tenant}
+		rpm := k.RatePerMinute
+		if rpm == 0 {
+			rpm = defaultRatePerMinute
+		}
+		if rpm > 0 {
+			e.limiter = rate.NewLimiter(rate.Limit(float64(rpm)/60), rpm)
+		}
+		s.byHash[h] = e
+	}
+	return s, nil
+}
+
+// Authenticate implements Authenticator.
+func (s *APIKeys) Authenticate(r *http.Request) (Identity, error) {
+	key := r.Header.Get(APIKeyHeader)
+	if key == "" {
+		if k, ok := strings.CutPrefix(r.Header.Get("Authorization"), "ApiKey "); ok {
+			key = strings.TrimSpace(k)
+		}
+	}
+	if key == "" {
+		return Identity{}, ErrNoCredentials
+	}
+
+	e, ok := s.byHash[sha256.Sum256([]byte(key))]
+	if !ok {
+		return Identity{}, fmt.Errorf("auth: unknown API key")
+	}
+	if e.limiter != nil {
+		res := e.limiter.Reserve()
+		if d := res.Delay(); d > 0 {
+			res.Cancel()
+			return Identity{}, &RateLimitError{RetryAfter: max(d, time.Second)}
+		}
+	}
+	return Identity{Subject: e.name, Method: "apikey", Tenant: e.tenant}, nil
+}
@@ -0,0 +1,182 @@
+// auth/apikey_test.go
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func keyHash(key string) string {
+	h := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(h[:])
+}
+
+func withKey(header, value string) *http.Request {
+	r := httptest.NewRequest("GET", "/ws", nil)
+	if header != "" {
+		r.Header.Set(header, value)
+	}
+	return r
+}
+
+func TestAPIKeys(t *testing.T) {
+	s, err := NewAPIKeys([]APIKey{
+		{Name: "ingest", SHA256: keyHash("key-ingest"), Tenant: "acme"},
+		{Name: "batch", SHA256: keyHash("key-batch")},
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An empty subject means the request is refused; err is what it is
+	// refused with when that matters.
+	tests := []struct {
+		name    string
+		r       *http.Request
+		subject string
+		err     error
+	}{
+		{"header", withKey(APIKeyHeader, "key-ingest"), "ingest", nil},
+		{"authorization", withKey("Authorization", "ApiKey key-batch"), "batch", nil},
+		{"unknown key", withKey(APIKeyHeader, "key-unknown"), "", nil},
+		{"hash as key", withKey(APIKeyHeader, keyHash("key-ingest")), "", nil},
+		{"key prefix", withKey(APIKeyHeader, "key-ingest-x"), "", nil},
+		{"none", withKey("", ""), "", ErrNoCredentials},
+		{"bearer token", withKey("Authorization", "Bearer key-ingest"), "", ErrNoCredentials},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := s.Authenticate(tt.r)
+			if tt.subject == "" {
+				if err == nil || (tt.err != nil && err != tt.err) || (tt.err == nil && err == ErrNoCredentials) {
+					t.Errorf("Authenticate = %+v, %v; want refused", id, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id.Subject != tt.subject || id.Method != "apikey" {
+				t.Errorf("identity = %+v, want subject %q", id, tt.subject)
+			}
+		})
+	}
+	if id, _ := s.Authenticate(withKey(APIKeyHeader, "key-ingest")); id.Tenant != "acme" {
+		t.Errorf("tenant = %q, want acme", id.Tenant)
+	}
+}
+
+func TestAPIKeysRevoked(t *testing.T) {
+	keys := []APIKey{
+		{Name: "old", SHA256: keyHash("key-old")},
+		{Name: "new", SHA256: keyHash("key-new")},
+	}
+	before, err := NewAPIKeys(keys, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := before.Authenticate(withKey(APIKeyHeader, "key-old")); err != nil {
+		t.Fatalf("key refused before revocation: %v", err)
+	}
+	// Revoking a key is dropping it from the list the store is built from.
+	after, err := NewAPIKeys(keys[1:], 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := after.Authenticate(withKey(APIKeyHeader, "key-old")); err == nil || err == ErrNoCredentials {
+		t.Errorf("revoked key = %+v, %v; want rejected", id, err)
+	}
+	if _, err := after.Authenticate(withKey(APIKeyHeader, "key-new")); err != nil {
+		t.Errorf("remaining key refused: %v", err)
+	}
+}
+
+func TestAPIKeysRateLimit(t *testing.T) {
+	s, err := NewAPIKeys([]APIKey{
+		{Name: "slow", SHA256: keyHash("key-slow"), RatePerMinute: 2},
+		{Name: "default", SHA256: keyHash("key-default")},
+	}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 2 {
+		if _, err := s.Authenticate(withKey(APIKeyHeader, "key-slow")); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+	}
+	var rl *RateLimitError
+	if _, err := s.Authenticate(withKey(APIKeyHeader, "key-slow")); !errors.As(err, &rl) || rl.RetryAfter <= 0 {
+		t.Errorf("third request = %v, want a rate limit error", err)
+	}
+	// Keys have their own budgets; the default applies to those without.
+	if _, err := s.Authenticate(withKey(APIKeyHeader, "key-default")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Authenticate(withKey(APIKeyHeader, "key-default")); !errors.As(err, &rl) {
+		t.Errorf("second request on the default rate = %v, want a rate limit error", err)
+	}
+}
+
+func TestNewAPIKeysInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []APIKey
+	}{
+		{"short hash", []APIKey{{Name: "a", SHA256: "abcd"}}},
+		{"not hex", []APIKey{{Name: "a", SHA256: "zz" + keyHash("x")[2:]}}},
+		{"duplicate", []APIKey{{Name: "a", SHA256: keyHash("x")}, {Name: "b", SHA256: keyHash("x")}}},
+	}
+	for _, tt := range tests {
+		if _, err := NewAPIKeys(tt.keys, 0); err == nil {
+			t.Errorf("%s: NewAPIKeys took %+v", tt.name, tt.keys)
+		}
+	}
+}
+
+func TestParseAPIKeys(t *testing.T) {
+	h := keyHash("k")
+	tests := []struct {
+		spec    string
+		want    APIKey
+		wantErr bool
+	}{
+		{"ingest:" + h, APIKey{Name: "ingest", SHA256: h}, false},
+		{"ingest:" + h + ":120", APIKey{Name: "ingest", SHA256: h, RatePerMinute: 120}, false},
+		{"ingest:" + h + "::acme", APIKey{Name: "ingest", SHA256: h, Tenant: "acme"}, false},
+		{"ingest", APIKey{}, true},
+		{"ingest:" + h + ":fast", APIKey{}, true},
+		{"ingest:" + h + ":1:acme:extra", APIKey{}, true},
+	}
+	for _, tt := range tests {
+		keys, err := ParseAPIKeys([]string{tt.spec})
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseAPIKeys took %q", tt.spec)
+			}
+			continue
+		}
+		if err != nil || len(keys) != 1 || keys[0] != tt.want {
+			t.Errorf("ParseAPIKeys(%q) = %+v, %v; want %+v", tt.spec, keys, err, tt.want)
+		}
+	}
+}
+
+func TestLoadAPIKeyFile(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "keys.yaml")
+	os.WriteFile(good, []byte("keys:\n  - name: ingest\n    sha256: "+keyHash("k")+"\n    rate_per_minute: 60\n"), 0o600)
+	keys, err := LoadAPIKeyFile(good)
+	if err != nil || len(keys) != 1 || keys[0].Name != "ingest" || keys[0].RatePerMinute != 60 {
+		t.Errorf("LoadAPIKeyFile = %+v, %v", keys, err)
+	}
+	typo := filepath.Join(dir, "typo.yaml")
+	os.WriteFile(typo, []byte("keys:\n  - name: ingest\n    sha265: "+keyHash("k")+"\n"), 0o600)
+	if _, err := LoadAPIKeyFile(typo); err == nil {
+		t.Error("LoadAPIKeyFile took an unknown field")
+	}
+}
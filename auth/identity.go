@@ -0,0 +1,29 @@
+// auth/identity.go
+package auth
+
+import "context"
+
+// Identity is the authenticated caller of a request.
+type Identity struct {
+	// Subject identifies the user or machine, e.g. the JWT "sub" claim.
+	Subject string
+	// Method names how the caller authenticated ("jwt", ...).
+	Method string
+	// Tenant is the tenant the credentials belong to, if they name one.
+	Tenant string
+	// Claims holds the verified token claims, if any.
+	Claims map[string]any
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a copy of ctx carrying id.
+func WithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// FromContext returns the identity stored by an authentication middleware.
+func FromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	return id, ok
+}
@@ -0,0 +1,125 @@
+// auth/jwt.go
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/MicahParks/keyfunc/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+)
+
+// SubprotocolTokenPrefix marks a Sec-WebSocket-Protocol entry carrying a
+// bearer token, for browsers which cannot set headers on WebSocket requests:
+//
+//	new WebSocket(url, ["vad.json.v1", "bearer." + jwt])
+const SubprotocolTokenPrefix = "bearer."
+
+// JWTConfig configures token validation. Keys are taken from JWKSURL, or
+// from Secret for HMAC-signed tokens.
+type JWTConfig struct {
+	JWKSURL  string
+	Secret   string
+	Issuer   string
+	Audience string
+	// QueryParam and Cookie name the places a token is looked for besides
+	// the Authorization header and the WebSocket subprotocol.
+	QueryParam string
+	Cookie     string
+	// TenantClaim names the claim holding the caller's tenant, if any.
+	TenantClaim string
+}
+
+// JWT validates bearer tokens on incoming requests.
+type JWT struct {
+	cfg     JWTConfig
+	keyfunc jwt.Keyfunc
+	parser  *jwt.Parser
+}
+
+// NewJWT prepares a validator. With a JWKS URL the key set is fetched now
+// and refreshed in the background until ctx is done.
+func NewJWT(ctx context.Context, cfg JWTConfig) (*JWT, error) {
+	v := &JWT{cfg: cfg}
+
+	switch {
+	case cfg.JWKSURL != "":
+		k, err := keyfunc.NewDefaultCtx(ctx, []string{cfg.JWKSURL})
+		if err != nil {
+			return nil, fmt.Errorf("auth: JWKS: %w", err)
+		}
+		v.keyfunc = k.Keyfunc
+	case cfg.Secret != "":
+		secret := []byte(cfg.Secret)
+		v.keyfunc = func(*jwt.Token) (any, error) { return secret, nil }
+	default:
+		return nil, errors.New("auth: JWT validation needs a JWKS URL or a secret")
+	}
+
+	opts := []jwt.ParserOption{jwt.WithExpirationRequired()}
+	if cfg.JWKSURL != "" {
+		opts = append(opts, jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "PS256", "EdDSA"}))
+	} else {
+		opts = append(opts, jwt.WithValidMethods([]string{"HS256", "HS384", "HS512"}))
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+	v.parser = jwt.NewParser(opts...)
+	return v, nil
+}
+
+// Authenticate implements Authenticator.
+func (v *JWT) Authenticate(r *http.Request) (Identity, error) {
+	raw := v.token(r)
+	if raw == "" {
+		return Identity{}, ErrNoCredentials
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := v.parser.ParseWithClaims(raw, claims, v.keyfunc); err != nil {
+		return Identity{}, fmt.Errorf("auth: %w", err)
+	}
+	sub, _ := claims.GetSubject()
+	if sub == "" {
+		return Identity{}, errors.New("auth: token has no subject")
+	}
+	id := Identity{Subject: sub, Method: "jwt", Claims: claims}
+	if v.cfg.TenantClaim != "" {
+		id.Tenant, _ = claims[v.cfg.TenantClaim].(string)
+	}
+	return id, nil
+}
+
+// token finds the raw JWT in the Authorization header, the WebSocket
+// subprotocol list, the query string or the cookie, in that order.
+func (v *JWT) token(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); h != "" {
+		if t, ok := strings.CutPrefix(h, "Bearer "); ok {
+			return strings.TrimSpace(t)
+		}
+	}
+	for _, p := range websocket.Subprotocols(r) {
+		if t, ok := strings.CutPrefix(p, SubprotocolTokenPrefix); ok {
+			return t
+		}
+	}
+	if v.cfg.QueryParam != "" {
+		if t := r.URL.Query().Get(v.cfg.QueryParam); t != "" {
+			return t
+		}
+	}
+	if v.cfg.Cookie != "" {
+		if c, err := r.Cookie(v.cfg.Cookie); err == nil {
+			return c.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,230 @@
+// auth/jwt_test.go
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testSecret = "s3cret-s3cret-s3cret-s3cret-s3cret"
+
+func sign(t *testing.T, method jwt.SigningMethod, key any, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	tok := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		tok.Header["kid"] = kid
+	}
+	s, err := tok.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func claims(mod func(jwt.MapClaims)) jwt.MapClaims {
+	c := jwt.MapClaims{
+		"sub":    "alice",
+		"iss":    "https://issuer.example.com",
+		"aud":    "vad-bridge",
+		"exp":    time.Now().Add(time.Hour).Unix(),
+		"iat":    time.Now().Unix(),
+		"tenant": "acme",
+	}
+	if mod != nil {
+		mod(c)
+	}
+	return c
+}
+
+func bearer(token string) *http.Request {
+	r := httptest.NewRequest("GET", "/ws", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	return r
+}
+
+func TestJWTSecret(t *testing.T) {
+	v, err := NewJWT(context.Background(), JWTConfig{
+		Secret:      testSecret,
+		Issuer:      "https://issuer.example.com",
+		Audience:    "vad-bridge",
+		TenantClaim: "tenant",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := []byte(testSecret)
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{"good", sign(t, jwt.SigningMethodHS256, secret, "", claims(nil)), true},
+		{"HS512", sign(t, jwt.SigningMethodHS512, secret, "", claims(nil)), true},
+		{"expired", sign(t, jwt.SigningMethodHS256, secret, "", claims(func(c jwt.MapClaims) {
+			c["exp"] = time.Now().Add(-time.Minute).Unix()
+		})), false},
+		{"no expiry", sign(t, jwt.SigningMethodHS256, secret, "", claims(func(c jwt.MapClaims) { delete(c, "exp") })), false},
+		{"not yet valid", sign(t, jwt.SigningMethodHS256, secret, "", claims(func(c jwt.MapClaims) {
+			c["nbf"] = time.Now().Add(time.Hour).Unix()
+		})), false},
+		{"wrong audience", sign(t, jwt.SigningMethodHS256, secret, "", claims(func(c jwt.MapClaims) { c["aud"] = "other" })), false},
+		{"wrong issuer", sign(t, jwt.SigningMethodHS256, secret, "", claims(func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" })), false},
+		{"no subject", sign(t, jwt.SigningMethodHS256, secret, "", claims(func(c jwt.MapClaims) { delete(c, "sub") })), false},
+		{"bad signature", sign(t, jwt.SigningMethodHS256, []byte("another-secret-another-secret-00"), "", claims(nil)), false},
+		{"tampered payload", tamper(t, sign(t, jwt.SigningMethodHS256, secret, "", claims(nil))), false},
+		{"alg none", sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "", claims(nil)), false},
+		{"asymmetric alg", sign(t, jwt.SigningMethodRS256, rsaKey, "", claims(nil)), false},
+		{"garbage", "not.a.jwt", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := v.Authenticate(bearer(tt.token))
+			if !tt.ok {
+				if err == nil {
+					t.Errorf("accepted %s token: %+v", tt.name, id)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id.Subject != "alice" || id.Method != "jwt" || id.Tenant != "acme" {
+				t.Errorf("identity = %+v", id)
+			}
+		})
+	}
+}
+
+// tamper swaps the subject in a signed token's payload.
+func tamper(t *testing.T, token string) string {
+	t.Helper()
+	parts := strings.Split(token, ".")
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c map[string]any
+	if err := json.Unmarshal(payload, &c); err != nil {
+		t.Fatal(err)
+	}
+	c["sub"] = "mallory"
+	payload, _ = json.Marshal(c)
+	return parts[0] + "." + base64.RawURLEncoding.EncodeToString(payload) + "." + parts[2]
+}
+
+func TestJWTSources(t *testing.T) {
+	v, err := NewJWT(context.Background(), JWTConfig{Secret: testSecret, QueryParam: "token", Cookie: "vad_token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	good := sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", claims(nil))
+	tests := []struct {
+		name string
+		set  func(r *http.Request)
+		err  error
+	}{
+		{"header", func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+good) }, nil},
+		{"subprotocol", func(r *http.Request) {
+			r.Header.Set("Sec-WebSocket-Protocol", "vad.json.v1, "+SubprotocolTokenPrefix+good)
+		}, nil},
+		{"query", func(r *http.Request) { r.URL.RawQuery = "token=" + good }, nil},
+		{"cookie", func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "vad_token", Value: good}) }, nil},
+		{"none", func(*http.Request) {}, ErrNoCredentials},
+		{"other scheme", func(r *http.Request) { r.Header.Set("Authorization", "Basic YWxpY2U6eA==") }, ErrNoCredentials},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/ws", nil)
+			tt.set(r)
+			_, err := v.Authenticate(r)
+			if err != tt.err {
+				t.Errorf("Authenticate = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestJWTJWKS(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks, _ := json.Marshal(map[string]any{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": "k1",
+		"alg": "RS256",
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(jwks)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	v, err := NewJWT(ctx, JWTConfig{JWKSURL: srv.URL, Audience: "vad-bridge"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The public key as PEM, which a verifier confused into HMAC would
+	// use as the secret.
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{"good", sign(t, jwt.SigningMethodRS256, key, "k1", claims(nil)), true},
+		{"expired", sign(t, jwt.SigningMethodRS256, key, "k1", claims(func(c jwt.MapClaims) {
+			c["exp"] = time.Now().Add(-time.Minute).Unix()
+		})), false},
+		{"wrong audience", sign(t, jwt.SigningMethodRS256, key, "k1", claims(func(c jwt.MapClaims) { c["aud"] = "other" })), false},
+		{"unknown key", sign(t, jwt.SigningMethodRS256, other, "k2", claims(nil)), false},
+		{"other key under known kid", sign(t, jwt.SigningMethodRS256, other, "k1", claims(nil)), false},
+		{"no kid", sign(t, jwt.SigningMethodRS256, key, "", claims(nil)), false},
+		{"HMAC with the public key", sign(t, jwt.SigningMethodHS256, pubPEM, "k1", claims(nil)), false},
+		{"HMAC with the modulus", sign(t, jwt.SigningMethodHS256, key.N.Bytes(), "k1", claims(nil)), false},
+		{"alg none", sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "k1", claims(nil)), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := v.Authenticate(bearer(tt.token))
+			if tt.ok != (err == nil) {
+				t.Errorf("Authenticate = %+v, %v; want ok = %v", id, err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestNewJWTNeedsKeys(t *testing.T) {
+	if _, err := NewJWT(context.Background(), JWTConfig{Audience: "vad-bridge"}); err == nil {
+		t.Error("NewJWT took a config without keys")
+	}
+}
@@ -0,0 +1,63 @@
+// auth/middleware.go
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ErrNoCredentials is returned by an Authenticator when the request does not
+// carry the kind of credentials it handles.
+var ErrNoCredentials = errors.New("auth: no credentials")
+
+// RateLimitError is returned when a caller is authenticated but over its
+// request budget.
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string { return "auth: rate limit exceeded" }
+
+// Authenticator identifies the caller of a request.
+type Authenticator interface {
+	Authenticate(r *http.Request) (Identity, error)
+}
+
+// Middleware admits requests accepted by any of the authenticators and
+// stores the caller's identity in the request context. Credentials that are
+// present but invalid are rejected even if another authenticator could have
+// accepted the request, so a bad API key never falls through to anonymous
+// handling.
+func Middleware(next http.Handler, authenticators ...Authenticator) http.Handler {
+	if len(authenticators) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, a := range authenticators {
+			id, err := a.Authenticate(r)
+			if errors.Is(err, ErrNoCredentials) {
+				continue
+			}
+			var rl *RateLimitError
+			if errors.As(err, &rl) {
+				w.Header().Set("Retry-After", strconv.Itoa(int(rl.RetryAfter.Seconds()+0.999)))
+				http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+				return
+			}
+			if err != nil {
+				unauthorized(w)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), id)))
+			return
+		}
+		unauthorized(w)
+	})
+}
+
+func unauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	http.Error(w, "unauthorized", http.StatusUnauthorized)
+}
@@ -0,0 +1,72 @@
+// authn.go
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"vad-application/auth"
+	"vad-application/config"
+)
+
+// newAuthenticators builds the configured caller authentication methods.
+func newAuthenticators(cfg config.Config) ([]auth.Authenticator, error) {
+	var as []auth.Authenticator
+
+	if cfg.JWTJWKSURL != "" || cfg.JWTSecret != "" {
+		jwtAuth, err := auth.NewJWT(context.Background(), auth.JWTConfig{
+			JWKSURL:     cfg.JWTJWKSURL,
+			Secret:      cfg.JWTSecret,
+			Issuer:      cfg.JWTIssuer,
+			Audience:    cfg.JWTAudience,
+			QueryParam:  cfg.JWTQueryParam,
+			Cookie:      cfg.JWTCookie,
+			TenantClaim: cfg.TenantClaim,
+		})
+		if err != nil {
+			return nil, err
+		}
+		as = append(as, jwtAuth)
+	}
+
+	keys, err := auth.ParseAPIKeys(cfg.APIKeys)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.APIKeysFile != "" {
+		fromFile, err := auth.LoadAPIKeyFile(cfg.APIKeysFile)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, fromFile...)
+	}
+	if len(keys) > 0 {
+		store, err := auth.NewAPIKeys(keys, cfg.APIKeyRatePerMinute)
+		if err != nil {
+			return nil, err
+		}
+		as = append(as, store)
+	}
+
+	return as, nil
+}
+
+// newAdminAuthenticator checks the callers of the admin API; it is nil
+// when no admin key is configured.
+func newAdminAuthenticator(cfg config.Config) (auth.Authenticator, error) {
+	if len(cfg.AdminAPIKeys) == 0 {
+		return nil, nil
+	}
+	keys, err := auth.ParseAPIKeys(cfg.AdminAPIKeys)
+	if err != nil {
+		return nil, err
+	}
+	return auth.NewAPIKeys(keys, 0)
+}
+
+// protect wraps endpoints that require an authenticated caller, and
+// finds the tenant the request belongs to. Authentication is skipped when
+// no method is configured.
+func (b *bridge) protect(h http.Handler) http.Handler {
+	return auth.Middleware(b.resolver.Middleware(h), b.authenticators...)
+}
@@ -0,0 +1,389 @@
+// backend/balancer.go
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pb "vad-application/grpc_modules"
+	"vad-application/metrics"
+	"vad-application/reporting"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Balancing policies for NewBalancer.
+const (
+	RoundRobin       = "round_robin"
+	LeastConnections = "least_connections"
+)
+
+// ErrNoBackend is returned by Pick when every backend is unhealthy or has
+// its circuit open.
+var ErrNoBackend = errors.New("backend: no backend available")
+
+// BalancerConfig describes the backends behind a Balancer.
+type BalancerConfig struct {
+	Addrs []string
+	// Policy is RoundRobin or LeastConnections.
+	Policy string
+	// PoolSize is the number of connections to each backend.
+	PoolSize int
+
+	// HealthInterval is how often every backend is probed with the gRPC
+	// health protocol, each probe taking at most HealthTimeout. Backends
+	// failing it get no new sessions. Zero disables probing.
+	HealthInterval time.Duration
+	HealthTimeout  time.Duration
+	HealthService  string
+
+	// BreakerFailures consecutive stream failures open a backend's circuit
+	// for BreakerCooldown. Zero disables the breaker.
+	BreakerFailures int
+	BreakerCooldown time.Duration
+
+	// Discovery, when set, replaces Addrs: it is asked for the backends at
+	// start and every RefreshInterval after.
+	Discovery       Resolver
+	RefreshInterval time.Duration
+
+	// WarmStreams ProcessAudio streams are kept open on each backend, with
+	// WarmMetadata, for sessions to claim through ClaimStream. Zero
+	// disables them.
+	WarmStreams  int
+	WarmMetadata metadata.MD
+
+	// Errors, when set, is told when a backend's circuit opens or it fails
+	// its health checks.
+	Errors *reporting.Reporter
+}
+
+// discoveryTimeout bounds one lookup of the backend set.
+const discoveryTimeout = 10 * time.Second
+
+// Backend is one VAD server behind a Balancer.
+type Backend struct {
+	Addr string
+	pool *Pool
+	log  *slog.Logger
+	// service is the health service used by Ping.
+	service string
+	breaker breaker
+	errs    *reporting.Reporter
+	// healthy is the result of the latest probe.
+	healthy atomic.Bool
+	// active counts the streams open on it.
+	active atomic.Int64
+	// warm holds streams opened ahead of sessions; wake tells keepWarm one
+	// was claimed, and is nil without warm streams.
+	warm warmPool
+	wake chan<- struct{}
+}
+
+// Client returns a client whose streams are counted against this backend.
+// Each stream is counted until its context is done, so callers must cancel
+// it once the stream is finished.
+func (be *Backend) Client() (pb.VADServiceClient, error) {
+	c, err := be.pool.Client()
+	if err != nil {
+		return nil, err
+	}
+	return countingClient{VADServiceClient: c, be: be}, nil
+}
+
+// Active returns the number of streams open on the backend.
+func (be *Backend) Active() int64 {
+	return be.active.Load()
+}
+
+// Healthy reports whether the backend's latest probe passed.
+func (be *Backend) Healthy() bool {
+	return be.healthy.Load()
+}
+
+// Available reports whether the backend takes new sessions: its latest
+// probe passed and its circuit is not open.
+func (be *Backend) Available() bool {
+	return be.healthy.Load() && be.breaker.allow()
+}
+
+// observe feeds a stream result to the circuit breaker. Only errors that
+// point at the backend itself count as failures.
+func (be *Backend) observe(err error) {
+	switch status.Code(err) {
+	case codes.OK:
+		if be.breaker.success() {
+			metrics.BackendCircuitOpen.WithLabelValues(be.Addr).Set(0)
+			be.log.Info("Backend circuit closed")
+		}
+	case codes.Unavailable, codes.DeadlineExceeded:
+		if be.breaker.failure() {
+			metrics.BackendCircuitOpen.WithLabelValues(be.Addr).Set(1)
+			be.log.Warn("Backend circuit open", "cooldown", be.breaker.cooldown.String(), "err", err)
+			be.errs.Capture(reporting.Event{Message: "Backend circuit open", Err: err, Tags: map[string]string{"backend_addr": be.Addr}})
+		}
+	}
+}
+
+type countingClient struct {
+	pb.VADServiceClient
+	be *Backend
+}
+
+// ProcessAudio opens the stream on a current pool connection: the one the
+// client was made with is closed once it breaks, and a session reconnecting
+// after an outage would otherwise never get through.
+func (c countingClient) ProcessAudio(ctx context.Context, opts ...grpc.CallOption) (pb.VADService_ProcessAudioClient, error) {
+	client, err := c.be.pool.Client()
+	if err != nil {
+		return nil, err
+	}
+	stream, err := client.ProcessAudio(ctx, opts...)
+	if err != nil {
+		if ctx.Err() == nil {
+			c.be.observe(err)
+		}
+		return nil, err
+	}
+	c.track(ctx)
+	return &observedStream{VADService_ProcessAudioClient: stream, ctx: ctx, be: c.be}, nil
+}
+
+// Ping runs a health check on the backend, for measuring its round trip.
+func (c countingClient) Ping(ctx context.Context) error {
+	return c.be.pool.Check(ctx, c.be.service)
+}
+
+// track counts a stream against the backend until ctx is done.
+func (c countingClient) track(ctx context.Context) {
+	c.be.active.Add(1)
+	gauge := metrics.BackendStreams.WithLabelValues(c.be.Addr)
+	gauge.Inc()
+	context.AfterFunc(ctx, func() {
+		c.be.active.Add(-1)
+		gauge.Dec()
+	})
+}
+
+// observedStream reports the first response, or the error that broke the
+// stream, to the backend's circuit breaker.
+type observedStream struct {
+	pb.VADService_ProcessAudioClient
+	ctx  context.Context
+	be   *Backend
+	seen bool
+}
+
+func (s *observedStream) Recv() (*pb.VADResponse, error) {
+	resp, err := s.VADService_ProcessAudioClient.Recv()
+	switch {
+	case err == nil && !s.seen:
+		s.seen = true
+		s.be.observe(nil)
+	case err != nil && s.ctx.Err() == nil:
+		s.be.observe(err)
+	}
+	return resp, err
+}
+
+// Balancer spreads new sessions across several VAD servers, each with its
+// own connection pool, skipping those that are unhealthy or failing.
+type Balancer struct {
+	cfg  BalancerConfig
+	opts []grpc.DialOption
+	log  *slog.Logger
+	// stop ends the health monitor, discovery and warm stream loops.
+	stop chan struct{}
+	// claimed wakes keepWarm.
+	claimed chan struct{}
+	wg      sync.WaitGroup
+
+	mu       sync.Mutex
+	backends []*Backend
+	// retired backends left the discovered set but still carry streams;
+	// their pools close once the last one ends.
+	retired []*Backend
+	next    int
+}
+
+// NewBalancer creates a pool for each backend and starts probing their
+// health. Only the probes and warm streams dial right away. With
+// discovery, a failed first lookup leaves the balancer empty until a
+// refresh finds backends.
+func NewBalancer(cfg BalancerConfig, logger *slog.Logger, opts ...grpc.DialOption) (*Balancer, error) {
+	if len(cfg.Addrs) == 0 && cfg.Discovery == nil {
+		return nil, errors.New("backend: no addresses")
+	}
+	switch cfg.Policy {
+	case RoundRobin, LeastConnections:
+	default:
+		return nil, fmt.Errorf("backend: unknown balancing policy %q (want %s or %s)", cfg.Policy, RoundRobin, LeastConnections)
+	}
+	b := &Balancer{cfg: cfg, opts: opts, log: logger, stop: make(chan struct{}), claimed: make(chan struct{}, 1)}
+	if cfg.Discovery != nil {
+		b.refresh()
+		if cfg.RefreshInterval > 0 {
+			b.wg.Add(1)
+			go b.discover(cfg.RefreshInterval)
+		}
+	} else {
+		for _, addr := range cfg.Addrs {
+			b.backends = append(b.backends, b.newBackend(addr))
+		}
+	}
+	if cfg.HealthInterval > 0 {
+		b.wg.Add(1)
+		go b.monitor(cfg.HealthInterval, cfg.HealthTimeout, cfg.HealthService)
+	}
+	if cfg.WarmStreams > 0 {
+		b.wg.Add(1)
+		go b.keepWarm()
+	}
+	return b, nil
+}
+
+func (b *Balancer) newBackend(addr string) *Backend {
+	be := &Backend{
+		Addr:    addr,
+		pool:    NewPool(addr, b.cfg.PoolSize, b.opts...),
+		log:     b.log.With("backend_addr", addr),
+		service: b.cfg.HealthService,
+		breaker: breaker{threshold: b.cfg.BreakerFailures, cooldown: b.cfg.BreakerCooldown},
+		errs:    b.cfg.Errors,
+	}
+	be.healthy.Store(true)
+	if b.cfg.WarmStreams > 0 {
+		be.wake = b.claimed
+	}
+	return be
+}
+
+// Backends returns the current backends, in configuration or address order.
+func (b *Balancer) Backends() []*Backend {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return slices.Clone(b.backends)
+}
+
+// Addrs returns the addresses of the current backends.
+func (b *Balancer) Addrs() []string {
+	var addrs []string
+	for _, be := range b.Backends() {
+		addrs = append(addrs, be.Addr)
+	}
+	return addrs
+}
+
+// Pick chooses an available backend for a new session. Least-connections
+// breaks ties in round-robin order, so idle backends share the load evenly.
+func (b *Balancer) Pick() (*Backend, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := len(b.backends)
+	if n == 0 {
+		return nil, ErrNoBackend
+	}
+	start := b.next % n
+	b.next++
+	var best *Backend
+	for i := range n {
+		be := b.backends[(start+i)%n]
+		if !be.Available() {
+			continue
+		}
+		if b.cfg.Policy == RoundRobin {
+			return be, nil
+		}
+		if best == nil || be.Active() < best.Active() {
+			best = be
+		}
+	}
+	if best == nil {
+		return nil, ErrNoBackend
+	}
+	return best, nil
+}
+
+// Failover chooses a backend to replace failed, on which a stream just
+// broke. The other available backends are tried in round-robin order and
+// failed itself last; the first to pass its health check is returned.
+func (b *Balancer) Failover(ctx context.Context, failed *Backend, service string) (*Backend, error) {
+	b.mu.Lock()
+	backends := slices.Clone(b.backends)
+	start := b.next
+	b.next++
+	b.mu.Unlock()
+	n := len(backends)
+	candidates := make([]*Backend, 0, n)
+	for i := range n {
+		if be := backends[(start+i)%n]; be != failed && be.Available() {
+			candidates = append(candidates, be)
+		}
+	}
+	if failed != nil && failed.Available() {
+		candidates = append(candidates, failed)
+	}
+	if len(candidates) == 0 {
+		return nil, ErrNoBackend
+	}
+	var errs []error
+	for _, be := range candidates {
+		err := be.pool.Check(ctx, service)
+		if err == nil {
+			return be, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", be.Addr, err))
+	}
+	return nil, errors.Join(errs...)
+}
+
+// Client returns a client on the backend chosen by Pick.
+func (b *Balancer) Client() (pb.VADServiceClient, error) {
+	be, err := b.Pick()
+	if err != nil {
+		return nil, err
+	}
+	return be.Client()
+}
+
+// Check succeeds if any backend passes its health check (see Pool.Check),
+// and otherwise reports every failure.
+func (b *Balancer) Check(ctx context.Context, service string) error {
+	backends := b.Backends()
+	if len(backends) == 0 {
+		return ErrNoBackend
+	}
+	var errs []error
+	for _, be := range backends {
+		err := be.pool.Check(ctx, service)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", be.Addr, err))
+	}
+	return errors.Join(errs...)
+}
+
+// Close stops the health monitor and discovery, and tears down every
+// backend's connections.
+func (b *Balancer) Close() error {
+	close(b.stop)
+	b.wg.Wait()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var errs []error
+	for _, be := range slices.Concat(b.backends, b.retired) {
+		be.warm.drain()
+		errs = append(errs, be.pool.Close())
+	}
+	return errors.Join(errs...)
+}
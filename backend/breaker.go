@@ -0,0 +1,64 @@
+// backend/breaker.go
+package backend
+
+import (
+	"sync"
+	"time"
+)
+
+// breaker is a circuit breaker over a backend's streams. After threshold
+// consecutive failures it opens and the backend is skipped for cooldown;
+// then it half-opens, letting sessions through until the next result
+// closes it again or, on failure, re-opens it at once.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+	// now is the clock, time.Now when nil.
+	now func() time.Time
+
+	mu       sync.Mutex
+	failures int
+	// openUntil is zero while closed.
+	openUntil time.Time
+}
+
+// allow reports whether the backend may take new streams.
+func (c *breaker) allow() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.openUntil.IsZero() || !c.clock().Before(c.openUntil)
+}
+
+// success records a working stream and reports whether that closed the
+// breaker.
+func (c *breaker) success() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	wasOpen := !c.openUntil.IsZero()
+	c.failures = 0
+	c.openUntil = time.Time{}
+	return wasOpen
+}
+
+// failure records a broken stream and reports whether that opened the
+// breaker. A zero threshold never opens it.
+func (c *breaker) failure() bool {
+	if c.threshold <= 0 {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failures++
+	if c.openUntil.IsZero() && c.failures < c.threshold {
+		return false
+	}
+	c.openUntil = c.clock().Add(c.cooldown)
+	return true
+}
+
+func (c *breaker) clock() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
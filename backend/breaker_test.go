@@ -0,0 +1,94 @@
+// backend/breaker_test.go
+package backend
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	type step struct {
+		// advance moves the clock before the action.
+		advance time.Duration
+		// action is "success", "failure" or "allow".
+		action string
+		// want is the action's result.
+		want bool
+	}
+	tests := []struct {
+		name      string
+		threshold int
+		steps     []step
+	}{
+		{"closed until threshold", 3, []step{
+			{0, "allow", true},
+			{0, "failure", false},
+			{0, "failure", false},
+			{0, "allow", true},
+			{0, "failure", true},
+			{0, "allow", false},
+		}},
+		{"success resets the count", 2, []step{
+			{0, "failure", false},
+			{0, "success", false},
+			{0, "failure", false},
+			{0, "allow", true},
+			{0, "failure", true},
+		}},
+		{"half-open after cooldown", 1, []step{
+			{0, "failure", true},
+			{9 * time.Second, "allow", false},
+			{time.Second, "allow", true},
+			{0, "allow", true},
+		}},
+		{"half-open closes on success", 1, []step{
+			{0, "failure", true},
+			{10 * time.Second, "success", true},
+			{0, "allow", true},
+			{0, "success", false},
+		}},
+		{"half-open re-opens on one failure", 3, []step{
+			{0, "failure", false},
+			{0, "failure", false},
+			{0, "failure", true},
+			{10 * time.Second, "allow", true},
+			{0, "failure", true},
+			{0, "allow", false},
+			{9 * time.Second, "allow", false},
+			{time.Second, "allow", true},
+		}},
+		{"failure while open extends it", 1, []step{
+			{0, "failure", true},
+			{5 * time.Second, "failure", true},
+			{5 * time.Second, "allow", false},
+			{5 * time.Second, "allow", true},
+		}},
+		{"zero threshold never opens", 0, []step{
+			{0, "failure", false},
+			{0, "failure", false},
+			{0, "allow", true},
+			{0, "success", false},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Unix(1_700_000_000, 0)
+			c := &breaker{threshold: tt.threshold, cooldown: 10 * time.Second, now: func() time.Time { return now }}
+			for i, s := range tt.steps {
+				now = now.Add(s.advance)
+				var got bool
+				switch s.action {
+				case "success":
+					got = c.success()
+				case "failure":
+					got = c.failure()
+				case "allow":
+					got = c.allow()
+				}
+				if got != s.want {
+					t.Errorf("step %d: %s = %v, want %v", i, s.action, got, s.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+// backend/credentials.go
+package backend
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Credentials describes how the bridge authenticates to the VAD backend.
+// The zero value dials in plaintext without any token.
+type Credentials struct {
+	// TLS enables transport security. CAFile overrides the system roots,
+	// CertFile/KeyFile add a client certificate for mTLS.
+	TLS        bool
+	CAFile     string
+	CertFile   string
+	KeyFile    string
+	ServerName string
+
+	// Token is sent as a bearer token on every call. TokenFile is read
+	// instead when Token is empty.
+	Token     string
+	TokenFile string
+}
+
+// DialOptions turns the credentials into gRPC dial options.
+func (c Credentials) DialOptions() ([]grpc.DialOption, error) {
+	var opts []grpc.DialOption
+
+	if c.TLS {
+		tlsCfg, err := c.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsCfg)))
+	} else {
+		if c.CAFile != "" || c.CertFile != "" {
+			return nil, errors.New("backend: CA or client certificate given without TLS")
+		}
+		opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	}
+
+	token := c.Token
+	if token == "" && c.TokenFile != "" {
+		data, err := os.ReadFile(c.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("backend: token: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	if token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(bearerToken{token: token, secure: c.TLS}))
+	}
+
+	return opts, nil
+}
+
+func (c Credentials) tlsConfig() (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: c.ServerName,
+	}
+
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("backend: CA bundle: %w", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("backend: no certificates found in %s", c.CAFile)
+		}
+		cfg.RootCAs = roots
+	}
+
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return nil, errors.New("backend: client certificate and key must be set together")
+	}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("backend: client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+// bearerToken attaches an "authorization: Bearer" header to every call.
+type bearerToken struct {
+	token  string
+	secure bool
+}
+
+func (t bearerToken) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + t.token}, nil
+}
+
+// RequireTransportSecurity keeps the token off plaintext connections unless
+// the operator explicitly dials without TLS.
+func (t bearerToken) RequireTransportSecurity() bool { return t.secure }
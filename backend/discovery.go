@@ -0,0 +1,241 @@
+// backend/discovery.go
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"vad-application/metrics"
+)
+
+// Resolver finds the current set of backend addresses.
+type Resolver interface {
+	Resolve(ctx context.Context) ([]string, error)
+}
+
+// ParseDiscovery returns the resolver for a discovery URI:
+//
+//	dns+srv://_grpc._tcp.vad.example.com          SRV records
+//	dns://vad.default.svc.cluster.local:50055     every A/AAAA record, e.g. a Kubernetes headless service
+//	consul://127.0.0.1:8500/vad?tag=&dc=          passing instances from the Consul catalog
+//
+// consul+https:// talks to Consul over TLS. The ACL token, if any, comes
+// from CONSUL_HTTP_TOKEN.
+func ParseDiscovery(uri string) (Resolver, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("backend: discovery: %w", err)
+	}
+	switch u.Scheme {
+	case "dns+srv":
+		if u.Host == "" {
+			return nil, errors.New("backend: discovery: dns+srv needs a record name")
+		}
+		return srvResolver{name: u.Host}, nil
+	case "dns":
+		host, port, err := net.SplitHostPort(u.Host)
+		if err != nil || host == "" {
+			return nil, fmt.Errorf("backend: discovery: dns needs host:port, got %q", u.Host)
+		}
+		return hostResolver{host: host, port: port}, nil
+	case "consul", "consul+https":
+		service := strings.Trim(u.Path, "/")
+		if u.Host == "" || service == "" {
+			return nil, errors.New("backend: discovery: consul needs an agent address and a service name")
+		}
+		scheme := "http"
+		if u.Scheme == "consul+https" {
+			scheme = "https"
+		}
+		q := u.Query()
+		query := url.Values{"passing": {"1"}}
+		for _, key := range []string{"tag", "dc"} {
+			if v := q.Get(key); v != "" {
+				query.Set(key, v)
+			}
+		}
+		return consulResolver{
+			url:   (&url.URL{Scheme: scheme, Host: u.Host, Path: "/v1/health/service/" + service, RawQuery: query.Encode()}).String(),
+			token: os.Getenv("CONSUL_HTTP_TOKEN"),
+		}, nil
+	}
+	return nil, fmt.Errorf("backend: discovery: unknown scheme %q (want dns+srv, dns, consul or consul+https)", u.Scheme)
+}
+
+type srvResolver struct{ name string }
+
+func (r srvResolver) Resolve(ctx context.Context) ([]string, error) {
+	_, records, err := net.DefaultResolver.LookupSRV(ctx, "", "", r.name)
+	if err != nil {
+		return nil, err
+	}
+	var addrs []string
+	for _, rec := range records {
+		host := strings.TrimSuffix(rec.Target, ".")
+		addrs = append(addrs, net.JoinHostPort(host, strconv.Itoa(int(rec.Port))))
+	}
+	return normalize(addrs), nil
+}
+
+type hostResolver struct{ host, port string }
+
+func (r hostResolver) Resolve(ctx context.Context) ([]string, error) {
+	ips, err := net.DefaultResolver.LookupHost(ctx, r.host)
+	if err != nil {
+		return nil, err
+	}
+	var addrs []string
+	for _, ip := range ips {
+		addrs = append(addrs, net.JoinHostPort(ip, r.port))
+	}
+	return normalize(addrs), nil
+}
+
+type consulResolver struct{ url, token string }
+
+// consulEntry is the part of a /v1/health/service entry the bridge uses.
+type consulEntry struct {
+	Node struct {
+		Address string
+	}
+	Service struct {
+		Address string
+		Port    int
+	}
+}
+
+func (r consulResolver) Resolve(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if r.token != "" {
+		req.Header.Set("X-Consul-Token", r.token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		return nil, fmt.Errorf("consul: status %s", resp.Status)
+	}
+	var entries []consulEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("consul: %w", err)
+	}
+	var addrs []string
+	for _, e := range entries {
+		// Services registered without an address use their node's.
+		host := e.Service.Address
+		if host == "" {
+			host = e.Node.Address
+		}
+		addrs = append(addrs, net.JoinHostPort(host, strconv.Itoa(e.Service.Port)))
+	}
+	return normalize(addrs), nil
+}
+
+// normalize sorts and deduplicates addrs so that refreshes compare equal.
+func normalize(addrs []string) []string {
+	slices.Sort(addrs)
+	return slices.Compact(addrs)
+}
+
+// discover refreshes the backend set every interval until b.stop is closed.
+func (b *Balancer) discover(interval time.Duration) {
+	defer b.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			b.refresh()
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+// refresh looks the backends up again. A failed or empty lookup keeps the
+// current set, so a resolver hiccup does not take every backend away.
+func (b *Balancer) refresh() {
+	ctx, cancel := context.WithTimeout(context.Background(), discoveryTimeout)
+	defer cancel()
+	addrs, err := b.cfg.Discovery.Resolve(ctx)
+	switch {
+	case err != nil:
+		b.log.Warn("Backend discovery failed; keeping the current backends", "err", err)
+	case len(addrs) == 0:
+		b.log.Warn("Backend discovery found no backends; keeping the current ones")
+	default:
+		b.set(addrs)
+	}
+	b.reap()
+}
+
+// set replaces the backends with addrs, keeping the pools and state of those
+// still present. Removed backends retire until their streams end.
+func (b *Balancer) set(addrs []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	current := make(map[string]*Backend, len(b.backends))
+	for _, be := range b.backends {
+		current[be.Addr] = be
+	}
+	backends := make([]*Backend, 0, len(addrs))
+	for _, addr := range addrs {
+		be, ok := current[addr]
+		switch {
+		case ok:
+			delete(current, addr)
+		default:
+			// A backend that comes back before its streams ended picks up
+			// where it left off.
+			i := slices.IndexFunc(b.retired, func(be *Backend) bool { return be.Addr == addr })
+			if i >= 0 {
+				be = b.retired[i]
+				b.retired = slices.Delete(b.retired, i, i+1)
+			} else {
+				be = b.newBackend(addr)
+			}
+			be.log.Info("Backend added")
+		}
+		backends = append(backends, be)
+	}
+	for _, be := range current {
+		be.log.Info("Backend removed", "active_streams", be.Active())
+		be.warm.drain()
+		b.retired = append(b.retired, be)
+	}
+	b.backends = backends
+}
+
+// reap closes the pools of retired backends without streams left.
+func (b *Balancer) reap() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.retired = slices.DeleteFunc(b.retired, func(be *Backend) bool {
+		if be.Active() > 0 {
+			return false
+		}
+		be.pool.Close()
+		metrics.BackendStreams.DeleteLabelValues(be.Addr)
+		metrics.BackendHealthy.DeleteLabelValues(be.Addr)
+		metrics.BackendCircuitOpen.DeleteLabelValues(be.Addr)
+		metrics.BackendWarmStreams.DeleteLabelValues(be.Addr)
+		return true
+	})
+}
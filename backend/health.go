@@ -0,0 +1,36 @@
+// backend/health.go
+package backend
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// Check asks the backend for its status using the standard gRPC health
+// protocol. An empty service name checks the server as a whole.
+//
+// Backends that do not implement the health service at all answer with
+// Unimplemented; since that answer still proves the backend is reachable it
+// is treated as healthy.
+func (p *Pool) Check(ctx context.Context, service string) error {
+	conn, err := p.Conn()
+	if err != nil {
+		return err
+	}
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+	if status.Code(err) == codes.Unimplemented {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("backend: health status %s", resp.GetStatus())
+	}
+	return nil
+}
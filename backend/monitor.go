@@ -0,0 +1,57 @@
+// backend/monitor.go
+package backend
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"vad-application/metrics"
+	"vad-application/reporting"
+)
+
+// monitor probes every backend each interval until b.stop is closed.
+func (b *Balancer) monitor(interval, timeout time.Duration, service string) {
+	defer b.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		var wg sync.WaitGroup
+		for _, be := range b.Backends() {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ctx, cancel := context.WithTimeout(context.Background(), timeout)
+				defer cancel()
+				be.probe(ctx, service)
+			}()
+		}
+		wg.Wait()
+		select {
+		case <-ticker.C:
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+// probe runs one health check and takes the backend out of rotation, or
+// puts it back, when the result changes.
+func (be *Backend) probe(ctx context.Context, service string) {
+	err := be.pool.Check(ctx, service)
+	healthy := err == nil
+	if healthy {
+		metrics.BackendHealthy.WithLabelValues(be.Addr).Set(1)
+	} else {
+		metrics.BackendHealthy.WithLabelValues(be.Addr).Set(0)
+	}
+	if be.healthy.Swap(healthy) == healthy {
+		return
+	}
+	if healthy {
+		be.log.Info("Backend healthy again")
+	} else {
+		be.log.Warn("Backend unhealthy; taking it out of rotation", "err", err)
+		be.errs.Capture(reporting.Event{Message: "Backend unhealthy", Err: err, Tags: map[string]string{"backend_addr": be.Addr}})
+	}
+}
@@ -0,0 +1,107 @@
+// backend/pool.go
+package backend
+
+import (
+	"errors"
+	"sync"
+
+	pb "vad-application/grpc_modules"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+// ErrPoolClosed is returned once Close has been called on a Pool.
+var ErrPoolClosed = errors.New("backend: pool closed")
+
+// Pool shares a fixed number of gRPC connections to the VAD backend across
+// WebSocket sessions. Connections are dialed on first use and re-dialed when
+// they are found shut down or failing.
+type Pool struct {
+	target string
+	opts   []grpc.DialOption
+
+	mu     sync.Mutex
+	conns  []*grpc.ClientConn
+	next   int
+	closed bool
+}
+
+// NewPool creates a pool of size connections to target. Nothing is dialed
+// until the first call to Conn.
+func NewPool(target string, size int, opts ...grpc.DialOption) *Pool {
+	if size < 1 {
+		size = 1
+	}
+	return &Pool{
+		target: target,
+		opts:   opts,
+		conns:  make([]*grpc.ClientConn, size),
+	}
+}
+
+// Conn returns the next connection in round-robin order, re-establishing it
+// if it is broken.
+func (p *Pool) Conn() (*grpc.ClientConn, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil, ErrPoolClosed
+	}
+
+	i := p.next % len(p.conns)
+	p.next++
+
+	conn := p.conns[i]
+	if conn != nil && !broken(conn) {
+		return conn, nil
+	}
+	if conn != nil {
+		conn.Close()
+		p.conns[i] = nil
+	}
+
+	conn, err := grpc.NewClient(p.target, p.opts...)
+	if err != nil {
+		return nil, err
+	}
+	p.conns[i] = conn
+	return conn, nil
+}
+
+// Client returns a VADService client bound to a pooled connection.
+func (p *Pool) Client() (pb.VADServiceClient, error) {
+	conn, err := p.Conn()
+	if err != nil {
+		return nil, err
+	}
+	return pb.NewVADServiceClient(conn), nil
+}
+
+// Close tears down every pooled connection.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	var errs []error
+	for i, conn := range p.conns {
+		if conn == nil {
+			continue
+		}
+		if err := conn.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		p.conns[i] = nil
+	}
+	return errors.Join(errs...)
+}
+
+func broken(conn *grpc.ClientConn) bool {
+	switch conn.GetState() {
+	case connectivity.Shutdown, connectivity.TransientFailure:
+		return true
+	}
+	return false
+}
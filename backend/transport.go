@@ -0,0 +1,45 @@
+// backend/transport.go
+package backend
+
+import (
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+)
+
+// Transport tunes the gRPC connections to the VAD backend. The zero value
+// keeps gRPC's defaults.
+type Transport struct {
+	// KeepaliveTime is how long a connection may be idle before it is
+	// pinged, and KeepaliveTimeout how long the ping may go unanswered
+	// before the connection is closed and its streams fail. gRPC pings no
+	// more often than every 10s; zero disables keepalive. Backends must
+	// allow pings this frequent, or they close the connection.
+	KeepaliveTime    time.Duration
+	KeepaliveTimeout time.Duration
+	// MaxMessageBytes caps the messages sent to and received from the
+	// backend; zero keeps gRPC's 4 MiB receive limit.
+	MaxMessageBytes int
+}
+
+// DialOptions turns the settings into gRPC dial options.
+func (t Transport) DialOptions() []grpc.DialOption {
+	var opts []grpc.DialOption
+	if t.KeepaliveTime > 0 {
+		opts = append(opts, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:    t.KeepaliveTime,
+			Timeout: t.KeepaliveTimeout,
+			// Warm and idle pooled connections must not die unnoticed
+			// either.
+			PermitWithoutStream: true,
+		}))
+	}
+	if t.MaxMessageBytes > 0 {
+		opts = append(opts, grpc.WithDefaultCallOptions(
+			grpc.MaxCallRecvMsgSize(t.MaxMessageBytes),
+			grpc.MaxCallSendMsgSize(t.MaxMessageBytes),
+		))
+	}
+	return opts
+}
@@ -0,0 +1,152 @@
+// backend/warm.go
+package backend
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	pb "vad-application/grpc_modules"
+	"vad-application/metrics"
+
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// warmMaxAge bounds how long a warm stream waits for a session. Older
+	// ones are replaced before the backend or a proxy idles them out.
+	warmMaxAge = time.Minute
+	// warmInterval is how often warm pools are topped up between claims.
+	warmInterval = 5 * time.Second
+	// warmOpenTimeout bounds opening one warm stream.
+	warmOpenTimeout = 5 * time.Second
+)
+
+// warmStream is a ProcessAudio stream opened before any session claimed it.
+type warmStream struct {
+	stream pb.VADService_ProcessAudioClient
+	cancel context.CancelFunc
+	opened time.Time
+}
+
+// warmPool holds a backend's warm streams, oldest first.
+type warmPool struct {
+	mu      sync.Mutex
+	streams []warmStream
+}
+
+// take returns the oldest stream still fresh, closing stale ones.
+func (w *warmPool) take() (warmStream, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for len(w.streams) > 0 {
+		ws := w.streams[0]
+		w.streams = w.streams[1:]
+		if time.Since(ws.opened) < warmMaxAge {
+			return ws, true
+		}
+		ws.cancel()
+	}
+	return warmStream{}, false
+}
+
+func (w *warmPool) put(ws warmStream) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.streams = append(w.streams, ws)
+}
+
+// expire closes the streams older than warmMaxAge.
+func (w *warmPool) expire() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for len(w.streams) > 0 && time.Since(w.streams[0].opened) >= warmMaxAge {
+		w.streams[0].cancel()
+		w.streams = w.streams[1:]
+	}
+}
+
+// drain closes every stream.
+func (w *warmPool) drain() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, ws := range w.streams {
+		ws.cancel()
+	}
+	w.streams = nil
+}
+
+func (w *warmPool) len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.streams)
+}
+
+// keepWarm tops up every backend's warm streams each warmInterval, or right
+// after one is claimed, until b.stop is closed.
+func (b *Balancer) keepWarm() {
+	defer b.wg.Done()
+	ticker := time.NewTicker(warmInterval)
+	defer ticker.Stop()
+	for {
+		for _, be := range b.Backends() {
+			be.fill(b.cfg.WarmStreams, b.cfg.WarmMetadata)
+		}
+		select {
+		case <-ticker.C:
+		case <-b.claimed:
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+// fill opens streams until n are warm, giving up at the first failure. A
+// backend out of rotation gets none.
+func (be *Backend) fill(n int, md metadata.MD) {
+	be.warm.expire()
+	defer func() {
+		metrics.BackendWarmStreams.WithLabelValues(be.Addr).Set(float64(be.warm.len()))
+	}()
+	for be.warm.len() < n && be.Available() {
+		client, err := be.pool.Client()
+		if err != nil {
+			return
+		}
+		ctx, cancel := context.WithCancel(metadata.NewOutgoingContext(context.Background(), md))
+		timer := time.AfterFunc(warmOpenTimeout, cancel)
+		stream, err := client.ProcessAudio(ctx)
+		if !timer.Stop() || err != nil {
+			cancel()
+			be.log.Debug("Warm stream not opened", "err", err)
+			return
+		}
+		be.warm.put(warmStream{stream: stream, cancel: cancel, opened: time.Now()})
+	}
+}
+
+// ClaimStream hands out one of the backend's warm streams, if it has any,
+// counted and observed like a stream from ProcessAudio. The stream ends
+// with ctx.
+func (c countingClient) ClaimStream(ctx context.Context) (pb.VADService_ProcessAudioClient, bool) {
+	if c.be.wake == nil {
+		return nil, false
+	}
+	ws, ok := c.be.warm.take()
+	// Have keepWarm replace it, or refill an empty pool.
+	select {
+	case c.be.wake <- struct{}{}:
+	default:
+	}
+	if !ok || !c.be.Available() {
+		if ok {
+			ws.cancel()
+		}
+		metrics.WarmStreamClaims.WithLabelValues("miss").Inc()
+		return nil, false
+	}
+	metrics.WarmStreamClaims.WithLabelValues("hit").Inc()
+	context.AfterFunc(ctx, ws.cancel)
+	c.track(ctx)
+	return &observedStream{VADService_ProcessAudioClient: ws.stream, ctx: ctx, be: c.be}, true
+}
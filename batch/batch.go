@@ -0,0 +1,314 @@
+// batch/batch.go
+package batch
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"vad-application/audio"
+	"vad-application/auth"
+	pb "vad-application/grpc_modules"
+	"vad-application/logging"
+	"vad-application/metrics"
+	"vad-application/pipeline"
+	"vad-application/quota"
+	"vad-application/session"
+	"vad-application/tenant"
+	"vad-application/tracing"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Backend events that open and close a speech segment.
+const (
+	eventStart = "start"
+	eventEnd   = "end"
+)
+
+// Clients hands out VAD backend clients; *backend.Pool is one.
+type Clients interface {
+	Client() (pb.VADServiceClient, error)
+}
+
+// Router picks the clients serving a request of tenant, "" for none, with
+// settings st, which it may complete, and the encodings it may send: nil
+// clients use the shared ones, and no encodings allow all.
+type Router func(tenant string, st *session.Settings) (Clients, []audio.Encoding)
+
+// Processing parses a request's settings and builds its audio pipeline;
+// *session.Manager is one.
+type Processing interface {
+	ParseSettings(q url.Values) (session.Settings, error)
+	NewPipeline(st session.Settings) (*pipeline.Chain, error)
+}
+
+// Handler serves POST /v1/vad: it streams an uploaded audio file through the
+// VAD backend and answers with the speech segments found in it.
+//
+// The body is a WAV, FLAC or Ogg Opus file, or headerless audio described
+// by the same query parameters the WebSocket accepts. The backend reports
+// no timestamps, so an event is dated by how much audio had been sent when
+// it arrived; times run late by the audio still in flight. Pacing the
+// upload at speed times real time bounds that lag.
+type Handler struct {
+	clients  Clients
+	proc     Processing
+	quotas   *quota.Quotas
+	route    Router
+	maxBytes int64
+	speed    float64
+	log      *slog.Logger
+}
+
+// New returns a Handler accepting bodies of up to maxBytes and sending them
+// at speed times real time, or unpaced if speed is zero. Callers' audio
+// counts against their and their tenant's quotas. route may be nil.
+func New(clients Clients, proc Processing, quotas *quota.Quotas, route Router, maxBytes int64, speed float64, logger *slog.Logger) *Handler {
+	return &Handler{clients: clients, proc: proc, quotas: quotas, route: route, maxBytes: maxBytes, speed: speed, log: logger}
+}
+
+// Result is the JSON response body. Times are in seconds of media.
+type Result struct {
+	ID       string       `json:"id"`
+	Duration float64      `json:"duration"`
+	Format   audio.Format `json:"format"`
+	Segments []Segment    `json:"segments"`
+	Events   []Event      `json:"events"`
+}
+
+// Segment is a stretch of detected speech.
+type Segment struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+// Event is one backend response with its media time.
+type Event struct {
+	Event   string  `json:"event"`
+	Message string  `json:"message,omitempty"`
+	Time    float64 `json:"time"`
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	settings, err := h.proc.ParseSettings(r.URL.Query())
+	if err != nil {
+		http.Error(w, "invalid audio settings: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	id, _ := auth.FromContext(r.Context())
+	tn := tenant.FromContext(r.Context())
+	clients, encodings := h.clients, []audio.Encoding(nil)
+	if h.route != nil {
+		var own Clients
+		if own, encodings = h.route(tn, &settings); own != nil {
+			clients = own
+		}
+	}
+	if over := h.quotas.Check(id.Subject, tn); over != nil {
+		w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(over.Resets).Seconds()+0.999)))
+		http.Error(w, over.Error(), http.StatusTooManyRequests)
+		return
+	}
+
+	body := bufio.NewReader(http.MaxBytesReader(w, r.Body, h.maxBytes))
+	src, err := audio.OpenFile(body)
+	if errors.Is(err, audio.ErrUnknownContainer) {
+		src, err = audio.NewRawSource(body, settings.Format)
+	}
+	if err == nil {
+		settings.Format = src.Format()
+		err = settings.CheckEncoding(encodings)
+	}
+	if err == nil {
+		err = settings.Options().Validate(settings.Format)
+	}
+	var pipe *pipeline.Chain
+	if err == nil {
+		pipe, err = h.proc.NewPipeline(settings)
+	}
+	if err != nil {
+		h.inputFailed(w, err, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	client, err := clients.Client()
+	if err != nil {
+		http.Error(w, "backend unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	res := Result{ID: uuid.NewString(), Format: settings.Format, Segments: []Segment{}, Events: []Event{}}
+	logger := h.log.With("batch_id", res.ID, "remote_addr", r.RemoteAddr, "format", settings.Format.String())
+	if tn != "" {
+		logger = logger.With("tenant", tn)
+	}
+	rid := logging.RequestID(r.Context())
+	if rid != "" {
+		logger = logger.With("request_id", rid)
+	}
+	started := time.Now()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, session.MetadataSessionID, res.ID)
+	if id.Subject != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, session.MetadataSubject, id.Subject)
+	}
+	if tn != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, session.MetadataTenant, tn)
+	}
+	if rid != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, session.MetadataRequestID, rid)
+	}
+	ctx = metadata.AppendToOutgoingContext(ctx, settings.Metadata()...)
+	ctx = tracing.Inject(ctx)
+	stream, err := client.ProcessAudio(ctx)
+	if err != nil {
+		metrics.StreamErrors.WithLabelValues(status.Code(err).String()).Inc()
+		logger.Error("Batch stream failed", "err", err)
+		http.Error(w, "backend stream error", http.StatusBadGateway)
+		return
+	}
+
+	// Samples sent so far, at the backend's rate.
+	var sent atomic.Int64
+	defer func() { h.quotas.Charge(id.Subject, tn, mediaTime(sent.Load())) }()
+	sendErr := make(chan error, 1)
+	go func() {
+		err := h.send(ctx, stream, src, pipe, &sent)
+		if err != nil {
+			cancel()
+		}
+		sendErr <- err
+	}()
+
+	var open *Segment
+	var recvErr error
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			recvErr = err
+			break
+		}
+		t := mediaTime(sent.Load())
+		metrics.Events.WithLabelValues(resp.GetEvent()).Inc()
+		res.Events = append(res.Events, Event{Event: resp.GetEvent(), Message: resp.GetMessage(), Time: t})
+		switch resp.GetEvent() {
+		case eventStart:
+			if open == nil {
+				open = &Segment{Start: t}
+			}
+		case eventEnd:
+			if open != nil {
+				open.End = t
+				res.Segments = append(res.Segments, *open)
+				open = nil
+			}
+		}
+	}
+	// The sender has finished or failed by now: Recv only ends after the
+	// half-close or once the stream is broken.
+	if err := <-sendErr; err != nil {
+		h.inputFailed(w, err, http.StatusBadRequest)
+		return
+	}
+	if recvErr != nil {
+		metrics.StreamErrors.WithLabelValues(status.Code(recvErr).String()).Inc()
+		logger.Error("Batch stream failed", "err", recvErr)
+		http.Error(w, "backend stream error", http.StatusBadGateway)
+		return
+	}
+
+	res.Duration = mediaTime(sent.Load())
+	if open != nil {
+		// Speech ran to the end of the file.
+		open.End = res.Duration
+		res.Segments = append(res.Segments, *open)
+	}
+	logger.Info("Batch request finished", "media_duration", res.Duration,
+		"segments", len(res.Segments), "elapsed", time.Since(started).Round(time.Millisecond).String())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// send streams src to the backend and half-closes the stream. Errors from
+// the stream itself are left for Recv to report; the returned error is the
+// input's fault.
+func (h *Handler) send(ctx context.Context, stream pb.VADService_ProcessAudioClient, src audio.Source, pipe *pipeline.Chain, sent *atomic.Int64) error {
+	defer stream.CloseSend()
+	msg := &pb.AudioChunk{}
+	// errStream stops sending once the stream has broken.
+	errStream := errors.New("stream broken")
+	sendFrame := func(frame []byte) error {
+		msg.AudioData = frame
+		if err := stream.Send(msg); err != nil {
+			return errStream
+		}
+		metrics.AudioBytes.Add(float64(len(frame)))
+		sent.Add(int64(len(frame) / audio.Backend.FrameSize()))
+		return nil
+	}
+	begin := time.Now()
+	for {
+		if h.speed > 0 {
+			media := time.Duration(mediaTime(sent.Load()) * float64(time.Second) / h.speed)
+			if wait := time.Until(begin.Add(media)); wait > 0 {
+				select {
+				case <-time.After(wait):
+				case <-ctx.Done():
+					return nil
+				}
+			}
+		}
+		frame, err := src.ReadFrame()
+		eof := err == io.EOF
+		switch {
+		case eof:
+			frame, err = pipe.Flush()
+		case err == nil:
+			frame, err = pipe.Process(frame)
+		}
+		if err != nil {
+			return err
+		}
+		if err := pipe.Frames(frame, sendFrame); err != nil || eof {
+			return nil
+		}
+	}
+}
+
+func (h *Handler) inputFailed(w http.ResponseWriter, err error, code int) {
+	var tooBig *http.MaxBytesError
+	if errors.As(err, &tooBig) {
+		http.Error(w, "audio file too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.Error(w, "invalid audio: "+err.Error(), code)
+}
+
+// mediaTime converts a sample count at the backend's rate to seconds,
+// rounded to the millisecond.
+func mediaTime(samples int64) float64 {
+	return math.Round(float64(samples)*1000/float64(audio.Backend.SampleRate)) / 1000
+}
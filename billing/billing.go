@@ -0,0 +1,338 @@
+// billing/billing.go
+package billing
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"vad-application/store"
+	"vad-application/webhook"
+
+	"github.com/google/uuid"
+)
+
+// Report formats.
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+// EventReport is the X-VAD-Event of reports posted to the billing webhook.
+const EventReport = "usage_report"
+
+// Exporting reports.
+const (
+	// settle lets the sessions that ended just before a period closed
+	// reach the database.
+	settle        = 30 * time.Second
+	postTimeout   = 30 * time.Second
+	postAttempts  = 5
+	postBaseDelay = 5 * time.Second
+)
+
+// Line is one subject's usage in a tenant, in a report.
+type Line struct {
+	Tenant        string  `json:"tenant,omitempty"`
+	Subject       string  `json:"subject"`
+	Sessions      int64   `json:"sessions"`
+	AudioMinutes  float64 `json:"audio_minutes"`
+	SpeechMinutes float64 `json:"speech_minutes"`
+	Events        int64   `json:"events"`
+}
+
+// Report is the usage of the sessions that ended in [From, Until), by
+// tenant and subject. Unauthenticated sessions have an empty subject, and
+// those belonging to no tenant an empty tenant.
+type Report struct {
+	From  time.Time `json:"from"`
+	Until time.Time `json:"until"`
+	Lines []Line    `json:"lines"`
+}
+
+// Build reports the sessions db holds that ended in [from, until).
+func Build(ctx context.Context, db *store.Store, from, until time.Time) (Report, error) {
+	totals, err := db.TotalsBySubject(ctx, from, until)
+	if err != nil {
+		return Report{}, fmt.Errorf("billing: %w", err)
+	}
+	r := Report{From: from.UTC(), Until: until.UTC(), Lines: make([]Line, 0, len(totals))}
+	for _, t := range totals {
+		r.Lines = append(r.Lines, Line{
+			Tenant:        t.Tenant,
+			Subject:       t.Subject,
+			Sessions:      t.Sessions,
+			AudioMinutes:  minutes(t.Audio),
+			SpeechMinutes: minutes(t.Speech),
+			Events:        t.Events,
+		})
+	}
+	return r, nil
+}
+
+func minutes(secs float64) float64 {
+	return math.Round(secs/60*1000) / 1000
+}
+
+// WriteCSV writes r with a header row, one line per row.
+func (r Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"from", "until", "tenant", "subject", "sessions", "audio_minutes", "speech_minutes", "events"})
+	from, until := r.From.Format(time.RFC3339), r.Until.Format(time.RFC3339)
+	for _, l := range r.Lines {
+		cw.Write([]string{
+			from, until, l.Tenant, l.Subject,
+			strconv.FormatInt(l.Sessions, 10),
+			strconv.FormatFloat(l.AudioMinutes, 'f', -1, 64),
+			strconv.FormatFloat(l.SpeechMinutes, 'f', -1, 64),
+			strconv.FormatInt(l.Events, 10),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// write encodes r in format.
+func (r Report) write(w io.Writer, format string) error {
+	if format == FormatCSV {
+		return r.WriteCSV(w)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// Config configures periodic reports.
+type Config struct {
+	// Interval is the length of a report's period; periods are aligned to
+	// it in UTC, so 24h reports cover UTC days.
+	Interval time.Duration
+	// Dir receives each report as usage-<from>.<format>; empty writes no
+	// files.
+	Dir     string
+	Formats []string
+	// WebhookURL, if set, is posted each report as JSON, signed with
+	// WebhookSecret like session webhooks are.
+	WebhookURL    string
+	WebhookSecret string
+}
+
+// Exporter writes a report of db's sessions as each period closes.
+type Exporter struct {
+	cfg    Config
+	db     *store.Store
+	log    *slog.Logger
+	client *http.Client
+	stop   context.CancelFunc
+	done   chan struct{}
+}
+
+// New starts exporting, first the latest closed period if its report is
+// missing from cfg.Dir.
+func New(cfg Config, db *store.Store, logger *slog.Logger) (*Exporter, error) {
+	if cfg.Dir != "" {
+		if err := os.MkdirAll(cfg.Dir, 0o750); err != nil {
+			return nil, fmt.Errorf("billing: %w", err)
+		}
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	e := &Exporter{
+		cfg:    cfg,
+		db:     db,
+		log:    logger.With("component", "billing"),
+		client: &http.Client{Timeout: postTimeout},
+		stop:   stop,
+		done:   make(chan struct{}),
+	}
+	go e.run(ctx)
+	return e, nil
+}
+
+func (e *Exporter) run(ctx context.Context) {
+	defer close(e.done)
+	until := time.Now().UTC().Truncate(e.cfg.Interval)
+	if e.missing(until.Add(-e.cfg.Interval)) {
+		e.export(ctx, until.Add(-e.cfg.Interval), until)
+	}
+	for {
+		from := until
+		until = from.Add(e.cfg.Interval)
+		select {
+		case <-time.After(time.Until(until.Add(settle))):
+		case <-ctx.Done():
+			return
+		}
+		e.export(ctx, from, until)
+	}
+}
+
+// missing reports whether the files of the report from from are missing.
+func (e *Exporter) missing(from time.Time) bool {
+	if e.cfg.Dir == "" {
+		return false
+	}
+	for _, f := range e.cfg.Formats {
+		if _, err := os.Stat(e.path(from, f)); errors.Is(err, os.ErrNotExist) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Exporter) path(from time.Time, format string) string {
+	return filepath.Join(e.cfg.Dir, "usage-"+from.Format("20060102T150405Z")+"."+format)
+}
+
+func (e *Exporter) export(ctx context.Context, from, until time.Time) {
+	r, err := Build(ctx, e.db, from, until)
+	if err != nil {
+		e.log.Error("Usage report failed", "from", from, "until", until, "err", err)
+		return
+	}
+	if e.cfg.Dir != "" {
+		for _, f := range e.cfg.Formats {
+			if err := e.save(r, f); err != nil {
+				e.log.Error("Writing usage report failed", "format", f, "err", err)
+			}
+		}
+	}
+	if e.cfg.WebhookURL != "" {
+		if err := e.post(ctx, r); err != nil {
+			e.log.Error("Posting usage report failed", "url", e.cfg.WebhookURL, "from", from, "err", err)
+			return
+		}
+	}
+	e.log.Info("Usage report exported", "from", from, "until", until, "lines", len(r.Lines))
+}
+
+// save writes the report file, replacing it whole.
+func (e *Exporter) save(r Report, format string) error {
+	path := e.path(r.From, format)
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	err = r.write(f, format)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// post delivers r to the webhook, retrying with backoff.
+func (e *Exporter) post(ctx context.Context, r Report) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	id := uuid.NewString()
+	delay := postBaseDelay
+	for attempt := 1; ; attempt++ {
+		err = e.attempt(ctx, id, body)
+		if err == nil || attempt == postAttempts {
+			return err
+		}
+		e.log.Debug("Retrying usage report", "attempt", attempt, "err", err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return fmt.Errorf("%w (shutting down)", err)
+		}
+		delay *= 2
+	}
+}
+
+func (e *Exporter) attempt(ctx context.Context, id string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.cfg.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "vad-bridge-billing/1")
+	req.Header.Set(webhook.HeaderEvent, EventReport)
+	req.Header.Set(webhook.HeaderDelivery, id)
+	req.Header.Set(webhook.HeaderTimestamp, ts)
+	if e.cfg.WebhookSecret != "" {
+		req.Header.Set(webhook.HeaderSignature, "sha256="+webhook.Sign(e.cfg.WebhookSecret, ts, body))
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("status %s", resp.Status)
+	}
+	return nil
+}
+
+// Close stops exporting, abandoning a report in progress.
+func (e *Exporter) Close() {
+	e.stop()
+	<-e.done
+}
+
+// Handler serves GET /admin/billing?from=&until=&format=csv|json: the report
+// of the sessions that ended in [from, until), RFC 3339 times defaulting to
+// the current UTC month so far.
+func Handler(db *store.Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		q := r.URL.Query()
+		now := time.Now().UTC()
+		from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		until := now
+		for name, dst := range map[string]*time.Time{"from": &from, "until": &until} {
+			if v := q.Get(name); v != "" {
+				t, err := time.Parse(time.RFC3339, v)
+				if err != nil {
+					http.Error(w, name+": not an RFC 3339 time", http.StatusBadRequest)
+					return
+				}
+				*dst = t
+			}
+		}
+		format := q.Get("format")
+		switch format {
+		case "":
+			format = FormatJSON
+		case FormatCSV, FormatJSON:
+		default:
+			http.Error(w, "format: want csv or json", http.StatusBadRequest)
+			return
+		}
+		report, err := Build(r.Context(), db, from, until)
+		if err != nil {
+			http.Error(w, "usage report failed", http.StatusInternalServerError)
+			return
+		}
+		if format == FormatCSV {
+			w.Header().Set("Content-Type", "text/csv")
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		report.write(w, format)
+	})
+}
@@ -0,0 +1,616 @@
+// client/client.go
+package client
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Subprotocol is the one the client speaks: VAD responses as JSON.
+const Subprotocol = "vad.json.v1"
+
+// Defaults of Config.
+const (
+	defaultRetries    = 5
+	defaultMinBackoff = 250 * time.Millisecond
+	defaultMaxBackoff = 4 * time.Second
+	defaultFrameBytes = 3200
+	handshakeTimeout  = 10 * time.Second
+)
+
+const (
+	// closeGrace bounds how long Close waits for the bridge's close frame.
+	closeGrace = time.Second
+	// seqHeaderSize is the header of sequenced audio frames: a big-endian
+	// uint32 sequence number and capture time in int64 microseconds.
+	seqHeaderSize = 12
+	eventBuffer   = 64
+)
+
+// ErrClosed is returned by the methods of a Client that has ended.
+var ErrClosed = errors.New("client: closed")
+
+// Config configures a Client.
+type Config struct {
+	// URL is the bridge's WebSocket endpoint, such as
+	// wss://vad.example.com/ws.
+	URL      string
+	Settings Settings
+	// Token is sent as a bearer token, APIKey in X-API-Key; Header holds
+	// any other request headers.
+	Token  string
+	APIKey string
+	Header http.Header
+	// Retries bounds how many attempts in a row are made at connecting
+	// again once the connection is lost or the bridge asks to retry; zero
+	// means 5, and a negative number none. The waits between them grow
+	// from MinBackoff to MaxBackoff, by default 250ms and 4s, or follow
+	// the bridge's retry hints.
+	Retries    int
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// FrameBytes is how much audio Stream sends in a frame; zero means
+	// 3200, 100 ms of 16 kHz pcm_s16le. Realtime makes Stream send no
+	// faster than the audio plays, as a live source would.
+	FrameBytes int
+	Realtime   bool
+	// Dialer dials the bridge; nil uses one with a 10s handshake timeout.
+	Dialer *websocket.Dialer
+	Logger *slog.Logger
+}
+
+// HandshakeError is returned when the bridge refuses the WebSocket
+// connection over HTTP, such as 401 without credentials or 503 during
+// maintenance.
+type HandshakeError struct {
+	StatusCode int
+	Status     string
+	// RetryAfter is the bridge's Retry-After, zero without one.
+	RetryAfter time.Duration
+}
+
+func (e *HandshakeError) Error() string {
+	return "client: bridge refused connection: " + e.Status
+}
+
+func (e *HandshakeError) retryable() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests || e.StatusCode == http.StatusRequestTimeout
+}
+
+// Client runs a session on the bridge over WebSocket. When the connection
+// is lost, or the bridge turns it away with a retryable error, it connects
+// again: to the same session when the bridge made it resumable, or else to
+// a new one with the same settings and configure and start messages.
+// Writes wait while it does.
+type Client struct {
+	cfg    Config
+	log    *slog.Logger
+	ctx    context.Context
+	cancel context.CancelFunc
+	events chan Event
+	done   chan struct{}
+
+	// wmu serializes writes, and swapping the connection with them.
+	wmu  sync.Mutex
+	conn *websocket.Conn
+	// changed is closed when conn is replaced or the client ends.
+	changed   chan struct{}
+	ended     bool
+	stopping  bool
+	sequenced bool
+	seq       uint32
+	// replay holds the configure and start messages sent, for new
+	// sessions.
+	replay [][]byte
+
+	mu        sync.Mutex
+	sessionID string
+	token     string
+	err       error
+	closeOnce sync.Once
+}
+
+// Dial opens a session, trying again as for a lost connection while the
+// bridge can't take it; ctx bounds how long that may take.
+func Dial(ctx context.Context, cfg Config) (*Client, error) {
+	if cfg.Retries == 0 {
+		cfg.Retries = defaultRetries
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = defaultMinBackoff
+	}
+	if cfg.MaxBackoff < cfg.MinBackoff {
+		cfg.MaxBackoff = max(defaultMaxBackoff, cfg.MinBackoff)
+	}
+	if cfg.FrameBytes <= 0 {
+		cfg.FrameBytes = defaultFrameBytes
+	}
+	if cfg.Dialer == nil {
+		cfg.Dialer = &websocket.Dialer{Proxy: http.ProxyFromEnvironment, HandshakeTimeout: handshakeTimeout}
+	}
+	log := cfg.Logger
+	if log == nil {
+		log = slog.New(slog.DiscardHandler)
+	}
+	if _, err := url.Parse(cfg.URL); err != nil {
+		return nil, fmt.Errorf("client: %w", err)
+	}
+	c := &Client{
+		cfg:     cfg,
+		log:     log,
+		events:  make(chan Event, eventBuffer),
+		done:    make(chan struct{}),
+		changed: make(chan struct{}),
+		// Configure may turn the header on later.
+		sequenced: cfg.Settings.Sequenced,
+	}
+	conn, _, err := c.connect(ctx, nil, 0, false)
+	if err != nil {
+		return nil, err
+	}
+	c.conn = conn
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	go c.run(conn)
+	return c, nil
+}
+
+// Events delivers the session's events, and is closed once it ends; Err
+// then tells why. Reading them promptly keeps the bridge from waiting.
+func (c *Client) Events() <-chan Event {
+	return c.events
+}
+
+// Err returns why the session ended: nil when it closed normally, after
+// Stop or Close.
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// SessionID is the session's ID, once the bridge has told it.
+func (c *Client) SessionID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sessionID
+}
+
+// SendAudio sends a frame of audio in the session's format, preceded by
+// its sequence header for sequenced sessions.
+func (c *Client) SendAudio(p []byte) error {
+	c.wmu.Lock()
+	sequenced, seq := c.sequenced, c.seq
+	if sequenced {
+		c.seq++
+	}
+	c.wmu.Unlock()
+	if !sequenced {
+		return c.write(websocket.BinaryMessage, p, false)
+	}
+	frame := make([]byte, seqHeaderSize+len(p))
+	binary.BigEndian.PutUint32(frame, seq)
+	binary.BigEndian.PutUint64(frame[4:], uint64(time.Now().UnixMicro()))
+	copy(frame[seqHeaderSize:], p)
+	return c.write(websocket.BinaryMessage, frame, false)
+}
+
+// Stream sends the audio r reads, in frames of Config.FrameBytes, then
+// stops the session. It returns once r is drained, leaving the remaining
+// events to arrive.
+func (c *Client) Stream(ctx context.Context, r io.Reader) error {
+	buf := make([]byte, c.cfg.FrameBytes)
+	rate := c.cfg.Settings.bytesPerSecond()
+	start, sent := time.Now(), 0
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			if serr := c.SendAudio(buf[:n]); serr != nil {
+				return serr
+			}
+			sent += n
+			if c.cfg.Realtime && rate > 0 {
+				due := start.Add(time.Duration(sent) * time.Second / time.Duration(rate))
+				select {
+				case <-time.After(time.Until(due)):
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		}
+		switch {
+		case err == io.EOF || err == io.ErrUnexpectedEOF:
+			return c.Stop()
+		case err != nil:
+			return err
+		case ctx.Err() != nil:
+			return ctx.Err()
+		}
+	}
+}
+
+// Configure changes the session's settings before it starts; fields
+// it leaves zero are unchanged.
+func (c *Client) Configure(st Settings) error {
+	msg := map[string]any{"type": "configure"}
+	for name, vs := range st.Query() {
+		v := vs[0]
+		if n, err := strconv.ParseFloat(v, 64); err == nil {
+			msg[name] = n
+		} else if b, err := strconv.ParseBool(v); err == nil {
+			msg[name] = b
+		} else {
+			msg[name] = v
+		}
+	}
+	if st.Sequenced {
+		c.wmu.Lock()
+		c.sequenced = true
+		c.wmu.Unlock()
+	}
+	return c.control(msg, true)
+}
+
+// Start opens the backend stream, or resumes a paused session. Sending
+// audio starts it too.
+func (c *Client) Start() error {
+	return c.control(map[string]any{"type": "start"}, true)
+}
+
+// Pause has the bridge discard audio until the next Start.
+func (c *Client) Pause() error {
+	return c.control(map[string]any{"type": "pause"}, false)
+}
+
+// Flush asks for a Flushed event once all audio sent so far has reached
+// the backend.
+func (c *Client) Flush() error {
+	return c.control(map[string]any{"type": "flush"}, false)
+}
+
+// Speak has the bridge speak text back with voice, empty for its default.
+func (c *Client) Speak(text, voice string) error {
+	msg := map[string]any{"type": "speak", "text": text}
+	if voice != "" {
+		msg["voice"] = voice
+	}
+	return c.control(msg, false)
+}
+
+// Interrupt silences the speech being played back.
+func (c *Client) Interrupt() error {
+	return c.control(map[string]any{"type": "interrupt"}, false)
+}
+
+// Stop ends the input. The bridge delivers the remaining events, then
+// closes the session, which ends Events.
+func (c *Client) Stop() error {
+	c.wmu.Lock()
+	c.stopping = true
+	c.wmu.Unlock()
+	return c.control(map[string]any{"type": "stop"}, false)
+}
+
+// Close ends the session without waiting for its remaining events.
+func (c *Client) Close() error {
+	c.closeOnce.Do(func() {
+		c.wmu.Lock()
+		c.stopping = true
+		conn := c.conn
+		c.wmu.Unlock()
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+			time.Now().Add(closeGrace))
+		select {
+		case <-c.done:
+		case <-time.After(closeGrace):
+		}
+		c.cancel()
+		c.wmu.Lock()
+		c.conn.Close()
+		c.wmu.Unlock()
+		<-c.done
+	})
+	return nil
+}
+
+func (c *Client) control(msg map[string]any, replay bool) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return c.write(websocket.TextMessage, data, replay)
+}
+
+// write sends a frame, waiting out a reconnection should the connection
+// fail; replay keeps it for new sessions.
+func (c *Client) write(typ int, data []byte, replay bool) error {
+	for {
+		c.wmu.Lock()
+		if c.ended {
+			c.wmu.Unlock()
+			return ErrClosed
+		}
+		conn, changed := c.conn, c.changed
+		err := conn.WriteMessage(typ, data)
+		if err == nil && replay {
+			c.replay = append(c.replay, data)
+		}
+		c.wmu.Unlock()
+		if err == nil {
+			return nil
+		}
+		// The read loop notices too, and connects again.
+		conn.Close()
+		select {
+		case <-changed:
+		case <-c.done:
+			return ErrClosed
+		}
+	}
+}
+
+// run reads the session's frames over conn and those after it, until the
+// session ends.
+func (c *Client) run(conn *websocket.Conn) {
+	var err error
+	defer func() {
+		c.mu.Lock()
+		c.err = err
+		c.mu.Unlock()
+		c.wmu.Lock()
+		c.ended = true
+		close(c.changed)
+		c.wmu.Unlock()
+		close(c.events)
+		close(c.done)
+	}()
+	for {
+		resuming := c.resumeToken() != ""
+		var last *Error
+		err, last = c.read(conn)
+		conn.Close()
+		c.wmu.Lock()
+		stopping := c.stopping
+		c.wmu.Unlock()
+		code := closeCode(err)
+		var hint time.Duration
+		switch {
+		case c.ctx.Err() != nil || code == websocket.CloseNormalClosure:
+			err = nil
+			return
+		case stopping:
+			err = fmt.Errorf("client: connection lost before the session ended: %w", err)
+			return
+		case code == 0 || code == websocket.CloseAbnormalClosure:
+			// Lost without a close frame: a resumable session waits for
+			// the client to come back.
+		case resuming && last != nil && last.Code == "session_not_found":
+			// The session is gone; carry on in a new one.
+			c.setToken("")
+		case last != nil && !last.Retryable:
+			err = last
+			return
+		case last != nil || code == websocket.CloseGoingAway || code == websocket.CloseInternalServerErr || code == websocket.CloseTryAgainLater:
+			// The session ended, but another may be served.
+			if last != nil {
+				hint = time.Duration(last.RetryAfter) * time.Second
+			}
+			c.setToken("")
+		default:
+			return
+		}
+		c.log.Info("Connection to the bridge lost", "err", err)
+		if conn, err = c.reconnect(err, hint); err != nil {
+			return
+		}
+	}
+}
+
+// reconnect connects again after cause and installs the new connection,
+// sending a new session the configure and start messages of the old one.
+func (c *Client) reconnect(cause error, hint time.Duration) (*websocket.Conn, error) {
+	conn, resumed, err := c.connect(c.ctx, cause, hint, true)
+	if err != nil {
+		return nil, err
+	}
+	c.wmu.Lock()
+	if !resumed {
+		c.seq = 0
+		for _, msg := range c.replay {
+			if err := conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				c.wmu.Unlock()
+				conn.Close()
+				return nil, err
+			}
+		}
+	}
+	c.conn = conn
+	close(c.changed)
+	c.changed = make(chan struct{})
+	c.wmu.Unlock()
+	c.log.Info("Reconnected to the bridge", "resumed", resumed)
+	c.emit(&Reconnected{Resumed: resumed})
+	return conn, nil
+}
+
+// connect dials the bridge, after cause when set, retrying up to
+// Config.Retries times while failures are worth it. It resumes the session
+// when the bridge made it resumable, reporting whether it did, and opens a
+// new one otherwise; notify reports the retries as Reconnecting events.
+func (c *Client) connect(ctx context.Context, cause error, hint time.Duration, notify bool) (*websocket.Conn, bool, error) {
+	delay := c.cfg.MinBackoff
+	for retry := 0; ; {
+		if cause != nil {
+			if retry >= c.cfg.Retries {
+				return nil, false, cause
+			}
+			retry++
+			// Jitter keeps clients that lost the bridge together from
+			// retrying in lockstep.
+			wait := max(hint, delay/2+rand.N(delay/2))
+			hint = 0
+			delay = min(2*delay, c.cfg.MaxBackoff)
+			if notify {
+				c.emit(&Reconnecting{Attempt: retry, Delay: wait, Err: cause})
+			}
+			c.log.Debug("Connecting to the bridge again", "attempt", retry, "retry_in", wait.String(), "err", cause)
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return nil, false, cause
+			}
+		}
+		token := c.resumeToken()
+		conn, err := c.dial(ctx, token)
+		if err == nil {
+			return conn, token != "", nil
+		}
+		cause = err
+		var he *HandshakeError
+		if errors.As(err, &he) {
+			if !he.retryable() {
+				return nil, false, err
+			}
+			hint = he.RetryAfter
+		}
+		if ctx.Err() != nil {
+			return nil, false, err
+		}
+	}
+}
+
+// dial makes one attempt, resuming the session token names, if any.
+func (c *Client) dial(ctx context.Context, token string) (*websocket.Conn, error) {
+	u, err := url.Parse(c.cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	if token != "" {
+		q.Set("resume", token)
+	} else {
+		for name, vs := range c.cfg.Settings.Query() {
+			q[name] = vs
+		}
+	}
+	u.RawQuery = q.Encode()
+	h := c.cfg.Header.Clone()
+	if h == nil {
+		h = http.Header{}
+	}
+	if c.cfg.Token != "" {
+		h.Set("Authorization", "Bearer "+c.cfg.Token)
+	}
+	if c.cfg.APIKey != "" {
+		h.Set("X-API-Key", c.cfg.APIKey)
+	}
+	d := *c.cfg.Dialer
+	d.Subprotocols = []string{Subprotocol}
+	conn, resp, err := d.DialContext(ctx, u.String(), h)
+	if err != nil {
+		if resp != nil {
+			he := &HandshakeError{StatusCode: resp.StatusCode, Status: resp.Status}
+			if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && s > 0 {
+				he.RetryAfter = time.Duration(s) * time.Second
+			}
+			return nil, he
+		}
+		return nil, fmt.Errorf("client: %w", err)
+	}
+	return conn, nil
+}
+
+// read delivers conn's frames as events until it fails, returning why and
+// the error frame just before, if any.
+func (c *Client) read(conn *websocket.Conn) (error, *Error) {
+	var (
+		last    *Error
+		playing *Play
+	)
+	for {
+		typ, data, err := conn.ReadMessage()
+		if err != nil {
+			return err, last
+		}
+		var e Event
+		if typ == websocket.BinaryMessage {
+			e = &Audio{Data: data, Play: playing}
+		} else if e, err = parseFrame(data); err != nil {
+			c.log.Warn("Frame not understood", "err", err)
+			continue
+		}
+		// Only an error frame right before the close tells why it came.
+		last = nil
+		switch e := e.(type) {
+		case *Error:
+			last = e
+			if e.SessionID != "" {
+				c.setSessionID(e.SessionID)
+			}
+		case *Resumable:
+			c.setSessionID(e.SessionID)
+			c.setToken(e.Token)
+		case *Resumed:
+			c.setSessionID(e.SessionID)
+		case *Play:
+			playing = e
+		case *Stop:
+			if playing != nil && playing.ID == e.ID {
+				playing = nil
+			}
+		}
+		if !c.emit(e) {
+			return c.ctx.Err(), last
+		}
+	}
+}
+
+// emit delivers e, unless the client is closed first.
+func (c *Client) emit(e Event) bool {
+	select {
+	case c.events <- e:
+		return true
+	case <-c.ctx.Done():
+		return false
+	}
+}
+
+func (c *Client) resumeToken() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token
+}
+
+func (c *Client) setToken(token string) {
+	c.mu.Lock()
+	c.token = token
+	c.mu.Unlock()
+}
+
+func (c *Client) setSessionID(id string) {
+	c.mu.Lock()
+	c.sessionID = id
+	c.mu.Unlock()
+}
+
+// closeCode returns the code of a close frame err reports, or zero.
+func closeCode(err error) int {
+	var closed *websocket.CloseError
+	if errors.As(err, &closed) {
+		return closed.Code
+	}
+	return 0
+}
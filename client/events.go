@@ -0,0 +1,262 @@
+// client/events.go
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Event is something that happened to the session: a frame from the bridge,
+// one of the types below, or Reconnecting and Reconnected from the client.
+type Event interface {
+	isEvent()
+}
+
+// VAD is an event from the VAD backend, such as start or end of speech.
+// The timing fields are set when the bridge measures latency or enriches
+// events.
+type VAD struct {
+	Event     string   `json:"event"`
+	Message   string   `json:"message,omitempty"`
+	LatencyMS *float64 `json:"latency_ms,omitempty"`
+	// Source is "fallback" when the bridge's built-in VAD answered.
+	Source      string     `json:"source,omitempty"`
+	Late        bool       `json:"late,omitempty"`
+	Time        *time.Time `json:"time,omitempty"`
+	MediaTime   *float64   `json:"media_time,omitempty"`
+	Seq         *int64     `json:"seq,omitempty"`
+	CaptureTime *time.Time `json:"capture_time,omitempty"`
+}
+
+// Error reports why the session, or the connection before it became one,
+// could not be served.
+type Error struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Retryable bool   `json:"retryable"`
+	SessionID string `json:"session_id,omitempty"`
+	// RetryAfter, in seconds, hints when reconnecting may succeed.
+	RetryAfter int `json:"retry_after,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("bridge: %s: %s", e.Code, e.Message)
+}
+
+// Status reports progress opening the backend stream, or riding out an
+// outage: connecting, connected, buffering or recovered.
+type Status struct {
+	Status     string `json:"status"`
+	Message    string `json:"message,omitempty"`
+	Attempt    int    `json:"attempt,omitempty"`
+	RetryInMS  int64  `json:"retry_in_ms,omitempty"`
+	BufferedMS int64  `json:"buffered_ms,omitempty"`
+}
+
+// Heartbeat is the bridge's periodic report on the session.
+type Heartbeat struct {
+	UptimeMS     int64  `json:"uptime_ms"`
+	BytesIn      int64  `json:"bytes_in"`
+	BytesOut     int64  `json:"bytes_out"`
+	QueueDepth   int    `json:"queue_depth"`
+	SendLagMS    int64  `json:"send_lag_ms"`
+	BackendRTTMS *int64 `json:"backend_rtt_ms,omitempty"`
+	ChunkRTTMS   *int64 `json:"chunk_rtt_ms,omitempty"`
+	Dropped      int64  `json:"dropped_chunks,omitempty"`
+	Lost         int64  `json:"lost_chunks,omitempty"`
+	Late         int64  `json:"late_chunks,omitempty"`
+}
+
+// AudioLevel is the loudness of the latest audio.
+type AudioLevel struct {
+	RMS      float64 `json:"rms"`
+	Peak     float64 `json:"peak"`
+	RMSDBFS  float64 `json:"rms_dbfs"`
+	PeakDBFS float64 `json:"peak_dbfs"`
+}
+
+// BufferOverrun reports stale audio skipped to keep up.
+type BufferOverrun struct {
+	LagMS int64 `json:"lag_ms"`
+}
+
+// Flushed acknowledges a flush.
+type Flushed struct{}
+
+// Resumable tells how to resume the session; the client does so itself
+// when the connection drops.
+type Resumable struct {
+	SessionID string `json:"session_id"`
+	Token     string `json:"resume_token"`
+	WindowMS  int64  `json:"resume_window_ms"`
+}
+
+// Resumed reports the session carrying on over a new connection.
+type Resumed struct {
+	SessionID string `json:"session_id"`
+	Replayed  int    `json:"replayed"`
+	Dropped   int    `json:"dropped,omitempty"`
+}
+
+// Drain warns that the bridge will close the session at Deadline, for
+// maintenance; DrainCancelled calls that off.
+type Drain struct {
+	Deadline     *time.Time `json:"deadline,omitempty"`
+	DeadlineInMS int64      `json:"deadline_in_ms,omitempty"`
+}
+
+type DrainCancelled struct{}
+
+// WakeWord reports the wake-word gate opening or closing.
+type WakeWord struct {
+	State   string `json:"state"`
+	Message string `json:"message,omitempty"`
+}
+
+// Transcript is the text of a speech segment, times in seconds of audio.
+type Transcript struct {
+	Text     string  `json:"text"`
+	Language string  `json:"language,omitempty"`
+	Start    float64 `json:"start"`
+	End      float64 `json:"end"`
+}
+
+// SpeechClip is the audio of a speech segment, as a WAV file.
+type SpeechClip struct {
+	Start      float64 `json:"start"`
+	End        float64 `json:"end"`
+	Encoding   string  `json:"encoding"`
+	SampleRate int     `json:"sample_rate"`
+	Audio      []byte  `json:"audio"`
+	Truncated  bool    `json:"truncated,omitempty"`
+}
+
+// AssistantDelta is the next piece of an assistant reply; Assistant the
+// whole of it, or why there is none.
+type AssistantDelta struct {
+	ID   string `json:"id"`
+	Text string `json:"text"`
+}
+
+type Assistant struct {
+	ID          string `json:"id"`
+	Text        string `json:"text"`
+	Utterance   string `json:"utterance,omitempty"`
+	Error       string `json:"error,omitempty"`
+	Interrupted bool   `json:"interrupted,omitempty"`
+}
+
+// Play announces the Audio events of a spoken utterance; Stop ends it.
+type Play struct {
+	ID         string `json:"id"`
+	Encoding   string `json:"encoding"`
+	SampleRate int    `json:"sample_rate"`
+	Channels   int    `json:"channels"`
+	Text       string `json:"text"`
+}
+
+type Stop struct {
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Audio is a piece of the utterance Play announced.
+type Audio struct {
+	Data []byte
+	Play *Play
+}
+
+// BargeIn reports the user speaking over playback, at Offset seconds of
+// audio.
+type BargeIn struct {
+	Offset float64 `json:"offset"`
+}
+
+// DTMF is a telephone keypad tone heard at Time seconds of audio.
+type DTMF struct {
+	Digit string  `json:"digit"`
+	Time  float64 `json:"time"`
+}
+
+// Reconnecting reports the connection lost, and the client about to try
+// again after Delay.
+type Reconnecting struct {
+	Attempt int
+	Delay   time.Duration
+	Err     error
+}
+
+// Reconnected reports a new connection. When Resumed it asks to carry on
+// the same session, which a Resumed event confirms; otherwise it starts a
+// new one with the same settings.
+type Reconnected struct {
+	Resumed bool
+}
+
+func (*VAD) isEvent()            {}
+func (*Error) isEvent()          {}
+func (*Status) isEvent()         {}
+func (*Heartbeat) isEvent()      {}
+func (*AudioLevel) isEvent()     {}
+func (*BufferOverrun) isEvent()  {}
+func (*Flushed) isEvent()        {}
+func (*Resumable) isEvent()      {}
+func (*Resumed) isEvent()        {}
+func (*Drain) isEvent()          {}
+func (*DrainCancelled) isEvent() {}
+func (*WakeWord) isEvent()       {}
+func (*Transcript) isEvent()     {}
+func (*SpeechClip) isEvent()     {}
+func (*AssistantDelta) isEvent() {}
+func (*Assistant) isEvent()      {}
+func (*Play) isEvent()           {}
+func (*Stop) isEvent()           {}
+func (*Audio) isEvent()          {}
+func (*BargeIn) isEvent()        {}
+func (*DTMF) isEvent()           {}
+func (*Reconnecting) isEvent()   {}
+func (*Reconnected) isEvent()    {}
+
+// frames makes the event of each frame the bridge generates itself; frames
+// with any other event are VAD responses.
+var frames = map[string]func() Event{
+	"error":           func() Event { return &Error{} },
+	"status":          func() Event { return &Status{} },
+	"heartbeat":       func() Event { return &Heartbeat{} },
+	"audio_level":     func() Event { return &AudioLevel{} },
+	"buffer_overrun":  func() Event { return &BufferOverrun{} },
+	"flushed":         func() Event { return &Flushed{} },
+	"resumable":       func() Event { return &Resumable{} },
+	"resumed":         func() Event { return &Resumed{} },
+	"drain":           func() Event { return &Drain{} },
+	"drain_cancelled": func() Event { return &DrainCancelled{} },
+	"wake_word":       func() Event { return &WakeWord{} },
+	"transcript":      func() Event { return &Transcript{} },
+	"speech_clip":     func() Event { return &SpeechClip{} },
+	"assistant_delta": func() Event { return &AssistantDelta{} },
+	"assistant":       func() Event { return &Assistant{} },
+	"play":            func() Event { return &Play{} },
+	"stop":            func() Event { return &Stop{} },
+	"barge_in":        func() Event { return &BargeIn{} },
+	"dtmf":            func() Event { return &DTMF{} },
+}
+
+// parseFrame decodes a text frame from the bridge.
+func parseFrame(data []byte) (Event, error) {
+	var head struct {
+		Event string `json:"event"`
+	}
+	if err := json.Unmarshal(data, &head); err != nil {
+		return nil, fmt.Errorf("client: frame is not JSON: %w", err)
+	}
+	var e Event = &VAD{}
+	if mk, ok := frames[head.Event]; ok {
+		e = mk()
+	}
+	if err := json.Unmarshal(data, e); err != nil {
+		return nil, fmt.Errorf("client: %s frame: %w", head.Event, err)
+	}
+	return e, nil
+}
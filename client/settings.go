@@ -0,0 +1,104 @@
+// client/settings.go
+package client
+
+import (
+	"net/url"
+	"strconv"
+)
+
+// Encodings of audio.
+const (
+	PCM16   = "pcm_s16le"
+	Float32 = "pcm_f32le"
+	Mulaw   = "pcm_mulaw"
+	Alaw    = "pcm_alaw"
+	Opus    = "opus"
+)
+
+// Settings are the session's audio format and backend options, sent as
+// query parameters when a session is opened. Zero fields keep the bridge's
+// defaults: 16 kHz mono pcm_s16le.
+type Settings struct {
+	Encoding   string
+	SampleRate int
+	BitDepth   int
+	Channels   int
+	// Channel picks the 1-based channel forwarded from multi-channel
+	// audio; zero downmixes.
+	Channel int
+	// Sensitivity, 0-1, is passed to the backend.
+	Sensitivity float64
+	// Locale is the speaker's BCP 47 language tag, and Model the backend
+	// model asked for.
+	Locale string
+	Model  string
+	// Endpointing durations, in milliseconds.
+	MinSpeechMS  int
+	MinSilenceMS int
+	PrerollMS    int
+	// Sequenced makes the client start every audio frame with a sequence
+	// header, for the bridge to detect lost and reordered frames.
+	Sequenced bool
+	Denoise   bool
+	// AGCTargetDBFS turns automatic gain control on.
+	AGCTargetDBFS float64
+	DTMF          bool
+}
+
+// Query returns st as the query parameters of /ws.
+func (st Settings) Query() url.Values {
+	q := url.Values{}
+	set := func(name, v string) {
+		if v != "" {
+			q.Set(name, v)
+		}
+	}
+	for name, n := range map[string]int{
+		"sample_rate":    st.SampleRate,
+		"bit_depth":      st.BitDepth,
+		"channels":       st.Channels,
+		"channel":        st.Channel,
+		"min_speech_ms":  st.MinSpeechMS,
+		"min_silence_ms": st.MinSilenceMS,
+		"preroll_ms":     st.PrerollMS,
+	} {
+		if n != 0 {
+			q.Set(name, strconv.Itoa(n))
+		}
+	}
+	for name, f := range map[string]float64{
+		"sensitivity":     st.Sensitivity,
+		"agc_target_dbfs": st.AGCTargetDBFS,
+	} {
+		if f != 0 {
+			q.Set(name, strconv.FormatFloat(f, 'g', -1, 64))
+		}
+	}
+	for name, b := range map[string]bool{
+		"sequenced": st.Sequenced,
+		"denoise":   st.Denoise,
+		"dtmf":      st.DTMF,
+	} {
+		if b {
+			q.Set(name, "true")
+		}
+	}
+	set("encoding", st.Encoding)
+	set("locale", st.Locale)
+	set("model", st.Model)
+	return q
+}
+
+// bytesPerSecond is how much of st's audio makes a second, zero for
+// packetized encodings.
+func (st Settings) bytesPerSecond() int {
+	rate, channels := st.SampleRate, st.Channels
+	if rate == 0 {
+		rate = 16000
+	}
+	if channels == 0 {
+		channels = 1
+	}
+	size := map[string]int{"": 2, PCM16: 2, Float32: 4, Mulaw: 1, Alaw: 1}[st.Encoding]
+	return rate * channels * size
+}
@@ -0,0 +1,114 @@
+// cluster/proxy.go
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"vad-application/auth"
+)
+
+// Proxying to another replica.
+const (
+	dialTimeout = 5 * time.Second
+	closeGrace  = time.Second
+)
+
+// ErrUnreachable is returned by Proxy when the owner replica can't be
+// reached; the client has then been sent nothing.
+var ErrUnreachable = errors.New("replica unreachable")
+
+// forwardedHeaders carry the client's credentials to the replica it is
+// relayed to, which authenticates it as its own.
+var forwardedHeaders = []string{
+	"Authorization", auth.APIKeyHeader, "Cookie", "User-Agent", "Accept-Language",
+}
+
+// Proxy relays client, resuming a session, to the owner replica's WebSocket
+// endpoint at path, with the query and credentials of req, until either
+// side closes or breaks. A close frame is passed on; losing either
+// connection drops the other, so the owner waits for the client to resume
+// again.
+func Proxy(client *websocket.Conn, req *http.Request, owner Owner, path string) error {
+	header := http.Header{}
+	for _, h := range forwardedHeaders {
+		if v := req.Header.Values(h); len(v) > 0 {
+			header[h] = v
+		}
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	if prior := req.Header.Get("X-Forwarded-For"); prior != "" {
+		host = prior + ", " + host
+	}
+	header.Set("X-Forwarded-For", host)
+	d := websocket.Dialer{HandshakeTimeout: dialTimeout}
+	if p := client.Subprotocol(); p != "" {
+		d.Subprotocols = []string{p}
+	}
+	// Browsers pass their token as a subprotocol entry rather than a header.
+	for _, p := range websocket.Subprotocols(req) {
+		if strings.HasPrefix(p, auth.SubprotocolTokenPrefix) {
+			d.Subprotocols = append(d.Subprotocols, p)
+		}
+	}
+	target := strings.TrimSuffix(owner.URL, "/") + path + "?" + req.URL.RawQuery
+	peer, resp, err := d.Dial(target, header)
+	if err != nil {
+		if resp != nil {
+			return fmt.Errorf("%w: %s: %v (%s)", ErrUnreachable, owner.Replica, err, resp.Status)
+		}
+		return fmt.Errorf("%w: %s: %v", ErrUnreachable, owner.Replica, err)
+	}
+	defer peer.Close()
+	errc := make(chan error, 2)
+	go func() { errc <- relay(peer, client) }()
+	go func() { errc <- relay(client, peer) }()
+	err = <-errc
+	pending := 1
+	if err == nil {
+		// A close frame went through; give its answer time to follow.
+		select {
+		case <-errc:
+			pending = 0
+		case <-time.After(closeGrace):
+		}
+	}
+	// Unblock the other direction.
+	peer.Close()
+	client.Close()
+	for ; pending > 0; pending-- {
+		<-errc
+	}
+	return err
+}
+
+// relay copies src's messages to dst until src closes or breaks.
+func relay(dst, src *websocket.Conn) error {
+	for {
+		mt, data, err := src.ReadMessage()
+		if err != nil {
+			var ce *websocket.CloseError
+			if errors.As(err, &ce) && ce.Code != websocket.CloseAbnormalClosure {
+				msg := []byte{}
+				if ce.Code != websocket.CloseNoStatusReceived {
+					msg = websocket.FormatCloseMessage(ce.Code, ce.Text)
+				}
+				dst.WriteControl(websocket.CloseMessage, msg, time.Now().Add(closeGrace))
+				return nil
+			}
+			return err
+		}
+		if err := dst.WriteMessage(mt, data); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,246 @@
+// cluster/registry.go
+package cluster
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"vad-application/session"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Publishing a replica's sessions: how often, and how long the entries
+// outlive a replica that stops.
+const (
+	syncInterval = 2 * time.Second
+	entryTTL     = 5 * syncInterval
+)
+
+// ErrNotFound is returned by Locate for a token no other replica holds.
+var ErrNotFound = errors.New("no replica holds a session for this token")
+
+// Config configures the registry.
+type Config struct {
+	// URL is a redis:// or rediss:// URL.
+	URL string
+	// Prefix starts every key.
+	Prefix string
+	// Replica names this bridge; AdvertiseURL, a ws:// or wss:// URL, is
+	// where the others reach it.
+	Replica      string
+	AdvertiseURL string
+}
+
+// Entry is a session as the registry has it, as of its replica's latest
+// sync.
+type Entry struct {
+	session.Stats
+	Subject    string `json:"subject,omitempty"`
+	Tenant     string `json:"tenant,omitempty"`
+	Route      string `json:"route,omitempty"`
+	RemoteAddr string `json:"remote_addr"`
+	Replica    string `json:"replica"`
+	// Synced is when the replica last published the entry.
+	Synced time.Time `json:"synced"`
+}
+
+// Owner is the replica holding a resumable session.
+type Owner struct {
+	Replica   string `json:"replica"`
+	URL       string `json:"url"`
+	SessionID string `json:"session_id"`
+}
+
+// Registry shares a replica's sessions with the others through Redis: each
+// replica's are a hash, <prefix>:replica:<name>, of entries by session ID,
+// and each resume token maps, by its SHA-256, from <prefix>:resume:<hash>
+// to the replica to resume it on. Both expire unless refreshed, so those of
+// a replica that died go away on their own.
+type Registry struct {
+	rdb     *redis.Client
+	cfg     Config
+	m       *session.Manager
+	log     *slog.Logger
+	changed chan struct{}
+	stop    context.CancelFunc
+	done    chan struct{}
+	// tokens are the resume keys published in the latest sync.
+	tokens []string
+}
+
+// New starts publishing m's sessions, every syncInterval and soon after
+// Changed, until Close.
+func New(cfg Config, m *session.Manager, logger *slog.Logger) (*Registry, error) {
+	opts, err := redis.ParseURL(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("cluster: %w", err)
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	r := &Registry{
+		rdb:     redis.NewClient(opts),
+		cfg:     cfg,
+		m:       m,
+		log:     logger.With("component", "cluster", "replica", cfg.Replica),
+		changed: make(chan struct{}, 1),
+		stop:    stop,
+		done:    make(chan struct{}),
+	}
+	go r.run(ctx)
+	return r, nil
+}
+
+func (r *Registry) run(ctx context.Context) {
+	defer close(r.done)
+	ticker := time.NewTicker(syncInterval)
+	defer ticker.Stop()
+	failing := false
+	for {
+		if err := r.sync(ctx); err != nil && ctx.Err() == nil {
+			if !failing {
+				r.log.Warn("Sessions not published", "err", err)
+			}
+			failing = true
+		} else if failing {
+			r.log.Info("Sessions published again")
+			failing = false
+		}
+		select {
+		case <-ticker.C:
+		case <-r.changed:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Changed asks for the sessions to be published now, as one opened or
+// ended.
+func (r *Registry) Changed() {
+	if r == nil {
+		return
+	}
+	select {
+	case r.changed <- struct{}{}:
+	default:
+	}
+}
+
+func (r *Registry) replicaKey(name string) string {
+	return r.cfg.Prefix + ":replica:" + name
+}
+
+func (r *Registry) resumeKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return r.cfg.Prefix + ":resume:" + hex.EncodeToString(sum[:])
+}
+
+func (r *Registry) sync(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, syncInterval)
+	defer cancel()
+	now := time.Now()
+	key := r.replicaKey(r.cfg.Replica)
+	pipe := r.rdb.TxPipeline()
+	pipe.Del(ctx, key)
+	var tokens []string
+	for _, s := range r.m.List() {
+		data, err := json.Marshal(Entry{
+			Stats:      s.Stats(),
+			Subject:    s.Subject,
+			Tenant:     s.Tenant,
+			Route:      s.Route,
+			RemoteAddr: s.RemoteAddr().String(),
+			Replica:    r.cfg.Replica,
+			Synced:     now,
+		})
+		if err != nil {
+			return err
+		}
+		pipe.HSet(ctx, key, s.ID, data)
+		if token := s.ResumeToken(); token != "" {
+			owner, err := json.Marshal(Owner{Replica: r.cfg.Replica, URL: r.cfg.AdvertiseURL, SessionID: s.ID})
+			if err != nil {
+				return err
+			}
+			k := r.resumeKey(token)
+			pipe.Set(ctx, k, owner, entryTTL)
+			tokens = append(tokens, k)
+		}
+	}
+	pipe.Expire(ctx, key, entryTTL)
+	// Tokens of sessions that ended go at once.
+	for _, k := range r.tokens {
+		if !slices.Contains(tokens, k) {
+			pipe.Del(ctx, k)
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	r.tokens = tokens
+	return nil
+}
+
+// Sessions lists the sessions of every replica, oldest first.
+func (r *Registry) Sessions(ctx context.Context) ([]Entry, error) {
+	var keys []string
+	iter := r.rdb.Scan(ctx, 0, r.replicaKey("*"), 100).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	list := []Entry{}
+	for _, key := range keys {
+		vals, err := r.rdb.HVals(ctx, key).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range vals {
+			var e Entry
+			if err := json.Unmarshal([]byte(v), &e); err != nil {
+				return nil, fmt.Errorf("cluster: entry in %s: %w", key, err)
+			}
+			list = append(list, e)
+		}
+	}
+	slices.SortFunc(list, func(a, b Entry) int { return a.Started.Compare(b.Started) })
+	return list, nil
+}
+
+// Locate finds the other replica holding the session token resumes.
+func (r *Registry) Locate(ctx context.Context, token string) (Owner, error) {
+	data, err := r.rdb.Get(ctx, r.resumeKey(token)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return Owner{}, ErrNotFound
+	}
+	if err != nil {
+		return Owner{}, err
+	}
+	var o Owner
+	if err := json.Unmarshal(data, &o); err != nil {
+		return Owner{}, err
+	}
+	// An entry of this replica's is stale: the session ended here.
+	if o.Replica == r.cfg.Replica {
+		return Owner{}, ErrNotFound
+	}
+	return o, nil
+}
+
+// Close withdraws the replica's sessions, until ctx expires, and
+// disconnects.
+func (r *Registry) Close(ctx context.Context) error {
+	r.stop()
+	<-r.done
+	keys := append([]string{r.replicaKey(r.cfg.Replica)}, r.tokens...)
+	return errors.Join(r.rdb.Del(ctx, keys...).Err(), r.rdb.Close())
+}
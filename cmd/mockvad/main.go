@@ -0,0 +1,144 @@
+// cmd/mockvad/main.go
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	pb "vad-application/grpc_modules"
+	"vad-application/localvad"
+	"vad-application/logging"
+	"vad-application/session"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const usage = `usage: mockvad [flags]
+
+Serves VADService over gRPC without a model, for developing the bridge and
+its clients: speech is told from silence by loudness, or the events come
+from a script. See script.example.yaml.
+
+`
+
+func main() {
+	var (
+		addr       = flag.String("addr", ":50055", "gRPC listen address")
+		scriptFile = flag.String("script", "", "YAML file of scripted events, instead of detecting speech")
+		threshold  = flag.Float64("threshold", -40, "RMS level in dBFS above which a frame is speech")
+		zcr        = flag.Float64("zcr", 0.3, "zero-crossing rate making frames up to 10 dB quieter speech")
+		minSpeech  = flag.Duration("min-speech", 100*time.Millisecond, "speech needed before a start is reported")
+		minSilence = flag.Duration("min-silence", 500*time.Millisecond, "silence needed before an end is reported")
+		latency    = flag.Duration("latency", 0, "delay before each response, as a slow model would take")
+		logFormat  = flag.String("log-format", "text", "log format: text or json")
+		logLevel   = flag.String("log-level", "info", "log level: debug, info, warn or error")
+	)
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	logger, err := logging.Setup(os.Stderr, *logFormat, *logLevel)
+	if err != nil {
+		fatal(err)
+	}
+	var srv *localvad.Server
+	mode := "energy"
+	if *scriptFile != "" {
+		s, err := loadScript(*scriptFile)
+		if err != nil {
+			fatal(err)
+		}
+		srv = &localvad.Server{New: func() (localvad.Detector, error) { return newPlayer(s), nil }}
+		mode = "script"
+	} else {
+		srv, err = localvad.NewEngineServer(localvad.EngineEnergy, 0,
+			localvad.EnergyConfig{Threshold: *threshold, ZCRThreshold: *zcr},
+			localvad.Timing{MinSpeech: *minSpeech, MinSilence: *minSilence})
+		if err != nil {
+			fatal(err)
+		}
+	}
+
+	lis, err := net.Listen("tcp", *addr)
+	if err != nil {
+		fatal(err)
+	}
+	gs := grpc.NewServer(grpc.StreamInterceptor(streams(logger, *latency)))
+	pb.RegisterVADServiceServer(gs, srv)
+	hs := health.NewServer()
+	hs.SetServingStatus("vad.VADService", healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(gs, hs)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		// A second signal kills.
+		stop()
+		logger.Info("Shutting down")
+		hs.Shutdown()
+		gs.GracefulStop()
+	}()
+	logger.Info("Mock VAD backend listening", "addr", lis.Addr().String(), "mode", mode)
+	if err := gs.Serve(lis); err != nil {
+		fatal(err)
+	}
+}
+
+// streams logs every stream with the session the bridge names in its
+// metadata, and holds each response back by latency.
+func streams(logger *slog.Logger, latency time.Duration) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		log := logger.With("method", info.FullMethod)
+		if md, ok := metadata.FromIncomingContext(ss.Context()); ok {
+			if ids := md.Get(session.MetadataSessionID); len(ids) > 0 {
+				log = log.With("session_id", ids[0])
+			}
+		}
+		log.Info("Stream opened")
+		started := time.Now()
+		if latency > 0 {
+			ss = &slowStream{ServerStream: ss, latency: latency}
+		}
+		err := handler(srv, ss)
+		elapsed := time.Since(started).Round(time.Millisecond).String()
+		if err != nil {
+			log.Info("Stream failed", "code", status.Code(err).String(), "err", err, "elapsed", elapsed)
+		} else {
+			log.Info("Stream closed", "elapsed", elapsed)
+		}
+		return err
+	}
+}
+
+// slowStream delays the responses sent on a stream.
+type slowStream struct {
+	grpc.ServerStream
+	latency time.Duration
+}
+
+func (s *slowStream) SendMsg(m any) error {
+	select {
+	case <-time.After(s.latency):
+	case <-s.Context().Done():
+		return s.Context().Err()
+	}
+	return s.ServerStream.SendMsg(m)
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "mockvad:", err)
+	os.Exit(1)
+}
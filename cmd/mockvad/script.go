@@ -0,0 +1,123 @@
+// cmd/mockvad/script.go
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"vad-application/audio"
+	pb "vad-application/grpc_modules"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v3"
+)
+
+// script is a fixed sequence of responses, each sent once a stream has
+// received audio up to its time.
+type script struct {
+	// Loop plays the script again every Loop of audio; zero plays it once.
+	Loop  time.Duration `yaml:"loop"`
+	Steps []step        `yaml:"events"`
+}
+
+type step struct {
+	At      time.Duration `yaml:"at"`
+	Event   string        `yaml:"event"`
+	Message string        `yaml:"message"`
+	// Error fails the stream with this gRPC code instead, such as
+	// unavailable or resource_exhausted.
+	Error string `yaml:"error"`
+	code  codes.Code
+}
+
+// loadScript reads a script from a YAML file.
+func loadScript(name string) (*script, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	var s script
+	if err := dec.Decode(&s); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if len(s.Steps) == 0 {
+		return nil, fmt.Errorf("%s: no events", name)
+	}
+	slices.SortStableFunc(s.Steps, func(a, b step) int { return cmp.Compare(a.At, b.At) })
+	for i := range s.Steps {
+		st := &s.Steps[i]
+		switch {
+		case st.At < 0:
+			return nil, fmt.Errorf("%s: event %d is at a negative time", name, i+1)
+		case (st.Event == "") == (st.Error == ""):
+			return nil, fmt.Errorf("%s: event %d needs either event or error", name, i+1)
+		case st.Error != "":
+			if st.code, err = parseCode(st.Error); err != nil {
+				return nil, fmt.Errorf("%s: event %d: %w", name, i+1, err)
+			}
+		}
+	}
+	if last := s.Steps[len(s.Steps)-1].At; s.Loop != 0 && s.Loop <= last {
+		return nil, fmt.Errorf("%s: loop %s must be longer than the script's %s", name, s.Loop, last)
+	}
+	return &s, nil
+}
+
+// parseCode resolves a gRPC code name, spelled as in the spec or in Go:
+// resource_exhausted or ResourceExhausted.
+func parseCode(name string) (codes.Code, error) {
+	want := strings.ReplaceAll(name, "_", "")
+	for c := codes.OK + 1; c <= codes.Unauthenticated; c++ {
+		if strings.EqualFold(c.String(), want) {
+			return c, nil
+		}
+	}
+	return codes.OK, errors.New("unknown gRPC code " + name)
+}
+
+// player is a Detector playing a script over one stream.
+type player struct {
+	s *script
+	// next is the step due next, in the loop that started at base.
+	next  int
+	base  time.Duration
+	heard time.Duration
+}
+
+func newPlayer(s *script) *player {
+	return &player{s: s}
+}
+
+// Process implements localvad.Detector.
+func (p *player) Process(pcm []byte) ([]*pb.VADResponse, error) {
+	f := audio.Backend
+	p.heard += time.Duration(len(pcm)/f.FrameSize()) * time.Second / time.Duration(f.SampleRate)
+	var out []*pb.VADResponse
+	for {
+		if p.next == len(p.s.Steps) {
+			if p.s.Loop == 0 || p.heard < p.base+p.s.Loop {
+				return out, nil
+			}
+			p.base += p.s.Loop
+			p.next = 0
+		}
+		st := p.s.Steps[p.next]
+		if p.base+st.At > p.heard {
+			return out, nil
+		}
+		p.next++
+		if st.code != codes.OK {
+			return out, status.Errorf(st.code, "scripted failure at %s", p.base+st.At)
+		}
+		out = append(out, &pb.VADResponse{Event: st.Event, Message: st.Message})
+	}
+}
@@ -0,0 +1,232 @@
+// cmd/vadctl/main.go
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"time"
+
+	"vad-application/audio"
+	"vad-application/client"
+)
+
+const usage = `usage: vadctl [flags] <file | ->
+       vadctl [flags] -mic
+
+Streams a WAV, FLAC or Ogg Opus file, headerless audio from a file or
+stdin, or the microphone to the bridge's /ws and prints its events.
+Interrupting stops the session gracefully; a second interrupt exits.
+
+`
+
+func main() {
+	var (
+		url         = flag.String("url", "ws://localhost:8080/ws", "WebSocket endpoint of the bridge")
+		token       = flag.String("token", os.Getenv("VAD_TOKEN"), "bearer token; defaults to $VAD_TOKEN")
+		apiKey      = flag.String("api-key", os.Getenv("VAD_API_KEY"), "API key; defaults to $VAD_API_KEY")
+		speed       = flag.Float64("speed", 1, "send files at this multiple of real time; 0 sends as fast as possible")
+		mic         = flag.Bool("mic", false, "stream the default microphone, until interrupted")
+		encoding    = flag.String("encoding", string(audio.PCM16), "encoding of headerless audio and the microphone")
+		sampleRate  = flag.Int("sample-rate", 16000, "sample rate of headerless audio and the microphone")
+		channels    = flag.Int("channels", 1, "channels of headerless audio and the microphone")
+		sequenced   = flag.Bool("sequenced", false, "send sequence headers, for the bridge to report lost audio")
+		sensitivity = flag.Float64("sensitivity", 0, "VAD sensitivity, 0-1; 0 keeps the bridge's default")
+		locale      = flag.String("locale", "", "BCP 47 language tag of the speaker")
+		model       = flag.String("model", "", "backend model to ask for")
+		retries     = flag.Int("retries", 5, "attempts at reconnecting after a lost connection; negative for none")
+		timeout     = flag.Duration("timeout", 10*time.Second, "how long connecting may take")
+		segments    = flag.String("segments", "", "write the speech segments and events as JSON to this file at the end; - for stdout")
+		quiet       = flag.Bool("quiet", false, "print only errors, not events")
+	)
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *mic != (flag.NArg() == 0) || flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	raw := audio.Format{SampleRate: *sampleRate, Channels: *channels}.WithEncoding(audio.ParseEncoding(*encoding))
+	var src audio.Source
+	var err error
+	if *mic {
+		var m captureSource
+		if m, err = openMic(raw); err == nil {
+			defer m.Close()
+			src = m
+		}
+		// The microphone paces itself.
+		*speed = 0
+	} else {
+		src, err = openInput(flag.Arg(0), raw)
+	}
+	if err != nil {
+		fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	dialCtx, cancel := context.WithTimeout(ctx, *timeout)
+	f := src.Format()
+	c, err := client.Dial(dialCtx, client.Config{
+		URL: *url,
+		Settings: client.Settings{
+			Encoding:    string(f.Encoding),
+			SampleRate:  f.SampleRate,
+			BitDepth:    f.BitDepth,
+			Channels:    f.Channels,
+			Sensitivity: *sensitivity,
+			Locale:      *locale,
+			Model:       *model,
+			Sequenced:   *sequenced,
+		},
+		Token:   *token,
+		APIKey:  *apiKey,
+		Retries: *retries,
+	})
+	cancel()
+	if err != nil {
+		fatal(err)
+	}
+
+	var sent atomic.Int64 // nanoseconds of audio
+	go func() {
+		err := stream(ctx, c, src, *speed, &sent)
+		// A second interrupt is the default: exit.
+		stop()
+		if err != nil && !errors.Is(err, client.ErrClosed) {
+			fmt.Fprintln(os.Stderr, "vadctl:", err)
+		}
+		if err := c.Stop(); err != nil && !errors.Is(err, client.ErrClosed) {
+			fmt.Fprintln(os.Stderr, "vadctl:", err)
+		}
+	}()
+
+	r := newReport(f, *quiet)
+	for e := range c.Events() {
+		r.add(e, time.Duration(sent.Load()))
+	}
+	r.finish(c.SessionID(), time.Duration(sent.Load()))
+	if *segments != "" {
+		if err := r.write(*segments); err != nil {
+			fatal(err)
+		}
+	}
+	if err := c.Err(); err != nil {
+		fatal(err)
+	}
+}
+
+// openInput opens a file, or stdin for "-", as headerless audio in raw
+// unless it starts with a container header.
+func openInput(name string, raw audio.Format) (audio.Source, error) {
+	var r io.Reader = os.Stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		r = f
+	}
+	br := bufio.NewReader(r)
+	src, err := audio.OpenFile(br)
+	if errors.Is(err, audio.ErrUnknownContainer) {
+		if err := raw.Validate(); err != nil {
+			return nil, err
+		}
+		return audio.NewRawSource(br, raw)
+	}
+	return src, err
+}
+
+// stream sends src's audio at speed times real time, or as fast as the
+// bridge takes it when speed is zero, until src ends or ctx is done. sent
+// counts the audio sent.
+func stream(ctx context.Context, c *client.Client, src audio.Source, speed float64, sent *atomic.Int64) error {
+	f := src.Format()
+	begin := time.Now()
+	for {
+		if speed > 0 {
+			due := begin.Add(time.Duration(float64(sent.Load()) / speed))
+			select {
+			case <-time.After(time.Until(due)):
+			case <-ctx.Done():
+				return nil
+			}
+		} else if ctx.Err() != nil {
+			return nil
+		}
+		frame, err := src.ReadFrame()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := c.SendAudio(frame); err != nil {
+			return err
+		}
+		sent.Add(int64(frameDuration(f, frame)))
+	}
+}
+
+// frameDuration is how much audio frame holds.
+func frameDuration(f audio.Format, frame []byte) time.Duration {
+	if f.Encoding == audio.Opus {
+		return opusDuration(frame)
+	}
+	if f.FrameSize() == 0 || f.SampleRate == 0 {
+		return 0
+	}
+	return time.Duration(len(frame)/f.FrameSize()) * time.Second / time.Duration(f.SampleRate)
+}
+
+// opusDuration reads the duration of an Opus packet from its TOC byte, as
+// RFC 6716 section 3.1 lays it out.
+func opusDuration(packet []byte) time.Duration {
+	if len(packet) == 0 {
+		return 0
+	}
+	toc := packet[0]
+	config := toc >> 3
+	var frame time.Duration
+	switch {
+	case config < 12: // SILK
+		frame = []time.Duration{10, 20, 40, 60}[config%4] * time.Millisecond
+	case config < 16: // hybrid
+		frame = []time.Duration{10, 20}[config%2] * time.Millisecond
+	default: // CELT
+		frame = []time.Duration{2500, 5000, 10000, 20000}[config%4] * time.Microsecond
+	}
+	frames := 1
+	switch toc & 3 {
+	case 1, 2:
+		frames = 2
+	case 3:
+		if len(packet) < 2 {
+			return 0
+		}
+		frames = int(packet[1] & 0x3f)
+	}
+	return time.Duration(frames) * frame
+}
+
+// captureSource is audio captured live, until closed.
+type captureSource interface {
+	audio.Source
+	io.Closer
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "vadctl:", err)
+	os.Exit(1)
+}
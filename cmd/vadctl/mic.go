@@ -0,0 +1,81 @@
+// cmd/vadctl/mic.go
+
+//go:build portaudio && cgo
+
+package main
+
+/*
+#cgo pkg-config: portaudio-2.0
+#include <portaudio.h>
+*/
+import "C"
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"unsafe"
+
+	"vad-application/audio"
+)
+
+// mic reads 16-bit PCM from the default input device, 20 ms at a time,
+// with PortAudio's blocking API.
+type mic struct {
+	stream unsafe.Pointer // a PaStream
+	f      audio.Format
+	pcm    []int16
+	buf    []byte
+}
+
+func openMic(f audio.Format) (captureSource, error) {
+	if f.Encoding != audio.PCM16 {
+		return nil, errors.New("the microphone is captured as " + string(audio.PCM16))
+	}
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	if rc := C.Pa_Initialize(); rc != C.paNoError {
+		return nil, paError(rc)
+	}
+	frames := max(f.SampleRate/50, 1)
+	m := &mic{f: f, pcm: make([]int16, frames*f.Channels)}
+	rc := C.Pa_OpenDefaultStream(&m.stream, C.int(f.Channels), 0, C.paInt16,
+		C.double(f.SampleRate), C.ulong(frames), nil, nil)
+	if rc != C.paNoError {
+		C.Pa_Terminate()
+		return nil, paError(rc)
+	}
+	if rc := C.Pa_StartStream(m.stream); rc != C.paNoError {
+		C.Pa_CloseStream(m.stream)
+		C.Pa_Terminate()
+		return nil, paError(rc)
+	}
+	return m, nil
+}
+
+func (m *mic) Format() audio.Format { return m.f }
+
+func (m *mic) ReadFrame() ([]byte, error) {
+	rc := C.Pa_ReadStream(m.stream, unsafe.Pointer(&m.pcm[0]), C.ulong(len(m.pcm)/m.f.Channels))
+	// An overflow lost some audio; what was read is still good.
+	if rc != C.paNoError && rc != C.paInputOverflowed {
+		return nil, paError(rc)
+	}
+	m.buf = m.buf[:0]
+	for _, v := range m.pcm {
+		m.buf = binary.LittleEndian.AppendUint16(m.buf, uint16(v))
+	}
+	return m.buf, nil
+}
+
+func (m *mic) Close() error {
+	C.Pa_StopStream(m.stream)
+	C.Pa_CloseStream(m.stream)
+	C.Pa_Terminate()
+	return nil
+}
+
+func paError(rc C.PaError) error {
+	return fmt.Errorf("portaudio: %s", C.GoString(C.Pa_GetErrorText(rc)))
+}
@@ -0,0 +1,17 @@
+// cmd/vadctl/mic_disabled.go
+
+//go:build !portaudio || !cgo
+
+package main
+
+import (
+	"errors"
+
+	"vad-application/audio"
+)
+
+var errMicDisabled = errors.New("microphone capture not compiled in (build with -tags portaudio)")
+
+func openMic(f audio.Format) (captureSource, error) {
+	return nil, errMicDisabled
+}
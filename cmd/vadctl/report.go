@@ -0,0 +1,189 @@
+// cmd/vadctl/report.go
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"vad-application/audio"
+	"vad-application/client"
+)
+
+// result is what -segments writes, in the shape of a /v1/vad response.
+// Times are in seconds of media.
+type result struct {
+	SessionID string       `json:"session_id,omitempty"`
+	Duration  float64      `json:"duration"`
+	Format    audio.Format `json:"format"`
+	Segments  []segment    `json:"segments"`
+	Events    []event      `json:"events"`
+}
+
+type segment struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+type event struct {
+	Event   string  `json:"event"`
+	Message string  `json:"message,omitempty"`
+	Time    float64 `json:"time"`
+}
+
+// report prints the session's events as they arrive and gathers its speech
+// segments.
+type report struct {
+	res   result
+	open  *segment
+	quiet bool
+}
+
+func newReport(f audio.Format, quiet bool) *report {
+	return &report{res: result{Format: f, Segments: []segment{}, Events: []event{}}, quiet: quiet}
+}
+
+// add records e, which arrived once sent of audio had been sent. VAD events
+// are dated by the bridge's media time when it has one, or else by sent,
+// which runs late by the audio still in flight.
+func (r *report) add(e client.Event, sent time.Duration) {
+	t := seconds(sent)
+	if v, ok := e.(*client.VAD); ok {
+		if v.MediaTime != nil {
+			t = *v.MediaTime
+		}
+		r.res.Events = append(r.res.Events, event{Event: v.Event, Message: v.Message, Time: t})
+		switch v.Event {
+		case "start":
+			if r.open == nil {
+				r.open = &segment{Start: t}
+			}
+		case "end":
+			if r.open != nil {
+				r.open.End = t
+				r.res.Segments = append(r.res.Segments, *r.open)
+				r.open = nil
+			}
+		}
+	}
+	if err, ok := e.(*client.Error); ok {
+		// Errors matter even when quiet.
+		fmt.Fprintf(os.Stderr, "%8.3fs  %-15s %s: %s\n", t, "error", err.Code, err.Message)
+		return
+	}
+	if !r.quiet {
+		name, detail := describe(e)
+		fmt.Printf("%8.3fs  %-15s %s\n", t, name, detail)
+	}
+}
+
+// finish closes the session's record once duration of audio was sent.
+func (r *report) finish(sessionID string, duration time.Duration) {
+	r.res.SessionID = sessionID
+	r.res.Duration = seconds(duration)
+	if r.open != nil {
+		// Speech ran to the end of the audio.
+		r.open.End = r.res.Duration
+		r.res.Segments = append(r.res.Segments, *r.open)
+		r.open = nil
+	}
+}
+
+// write writes the result as JSON to the file name, or stdout for "-".
+func (r *report) write(name string) error {
+	out := os.Stdout
+	if name != "-" {
+		f, err := os.Create(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r.res)
+}
+
+// describe names e as the bridge does and sums it up in a line.
+func describe(e client.Event) (string, string) {
+	switch e := e.(type) {
+	case *client.VAD:
+		detail := e.Message
+		if e.LatencyMS != nil {
+			detail += fmt.Sprintf(" (%.0f ms)", *e.LatencyMS)
+		}
+		return e.Event, detail
+	case *client.Status:
+		return "status", join(e.Status, e.Message)
+	case *client.Heartbeat:
+		return "heartbeat", compact(e)
+	case *client.AudioLevel:
+		return "audio_level", fmt.Sprintf("rms %.1f dBFS, peak %.1f dBFS", e.RMSDBFS, e.PeakDBFS)
+	case *client.BufferOverrun:
+		return "buffer_overrun", fmt.Sprintf("%d ms behind", e.LagMS)
+	case *client.Flushed:
+		return "flushed", ""
+	case *client.Resumable:
+		return "resumable", fmt.Sprintf("session %s for %s", e.SessionID, time.Duration(e.WindowMS)*time.Millisecond)
+	case *client.Resumed:
+		return "resumed", fmt.Sprintf("session %s, %d replayed, %d dropped", e.SessionID, e.Replayed, e.Dropped)
+	case *client.Drain:
+		return "drain", fmt.Sprintf("closing in %s", time.Duration(e.DeadlineInMS)*time.Millisecond)
+	case *client.DrainCancelled:
+		return "drain_cancelled", ""
+	case *client.WakeWord:
+		return "wake_word", join(e.State, e.Message)
+	case *client.Transcript:
+		return "transcript", fmt.Sprintf("%.2f-%.2fs %q", e.Start, e.End, e.Text)
+	case *client.SpeechClip:
+		return "speech_clip", fmt.Sprintf("%.2f-%.2fs, %d bytes of %s", e.Start, e.End, len(e.Audio), e.Encoding)
+	case *client.AssistantDelta:
+		return "assistant_delta", fmt.Sprintf("%q", e.Text)
+	case *client.Assistant:
+		if e.Error != "" {
+			return "assistant", "error: " + e.Error
+		}
+		return "assistant", fmt.Sprintf("%q", e.Text)
+	case *client.Play:
+		return "play", fmt.Sprintf("%s %s/%dHz %q", e.ID, e.Encoding, e.SampleRate, e.Text)
+	case *client.Stop:
+		return "stop", join(e.ID, join(e.Reason, e.Error))
+	case *client.Audio:
+		return "audio", fmt.Sprintf("%d bytes", len(e.Data))
+	case *client.BargeIn:
+		return "barge_in", fmt.Sprintf("at %.2fs", e.Offset)
+	case *client.DTMF:
+		return "dtmf", fmt.Sprintf("%s at %.2fs", e.Digit, e.Time)
+	case *client.Reconnecting:
+		return "reconnecting", fmt.Sprintf("attempt %d in %s: %v", e.Attempt, e.Delay.Round(time.Millisecond), e.Err)
+	case *client.Reconnected:
+		if e.Resumed {
+			return "reconnected", "resuming the session"
+		}
+		return "reconnected", "in a new session"
+	}
+	return fmt.Sprintf("%T", e), compact(e)
+}
+
+func compact(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err.Error()
+	}
+	return string(data)
+}
+
+func join(a, b string) string {
+	if a == "" || b == "" {
+		return a + b
+	}
+	return a + ": " + b
+}
+
+// seconds rounds d to the millisecond.
+func seconds(d time.Duration) float64 {
+	return math.Round(d.Seconds()*1000) / 1000
+}
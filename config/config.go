@@ -0,0 +1,1304 @@
+// config/config.go
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// VAD modes.
+const (
+	VADGRPC     = "grpc"
+	VADEmbedded = "embedded"
+)
+
+// Config holds every setting of the bridge.
+//
+// Values are resolved with the following precedence, lowest first: built-in
+// defaults, the YAML config file, VAD_* environment variables and finally
+// command-line flags. Each setting is known by a single snake_case name which
+// is used as the YAML key, as the flag name (with dashes) and as the
+// environment variable (upper-cased, prefixed with VAD_).
+type Config struct {
+	// ListenAddr is where HTTP is served, and ListenAddrs more addresses
+	// serving the same. Each is host:port, unix:<path> for a Unix socket
+	// created with UnixSocketMode, or systemd[:<name>] for the sockets
+	// systemd passes by socket activation, those named name only.
+	ListenAddr     string   `yaml:"listen_addr"`
+	ListenAddrs    []string `yaml:"listen_addrs"`
+	UnixSocketMode string   `yaml:"unix_socket_mode"`
+
+	BackendAddr     string `yaml:"backend_addr"`
+	BackendPoolSize int    `yaml:"backend_pool_size"`
+	// VAD is where sessions are served: VADGRPC, the backends below, or
+	// VADEmbedded, an in-process EmbeddedVADEngine needing no backend at
+	// all. WebRTC's aggressiveness runs from 0 to 3; the energy engine uses
+	// the fallback_energy_* thresholds. Segments start after
+	// EmbeddedVADMinSpeech of speech and end after EmbeddedVADMinSilence of
+	// silence.
+	VAD                    string        `yaml:"vad"`
+	EmbeddedVADEngine      string        `yaml:"embedded_vad_engine"`
+	EmbeddedAggressiveness int           `yaml:"embedded_vad_aggressiveness"`
+	EmbeddedVADMinSpeech   time.Duration `yaml:"embedded_vad_min_speech"`
+	EmbeddedVADMinSilence  time.Duration `yaml:"embedded_vad_min_silence"`
+	// BackendAddrs, when set, replaces BackendAddr with several VAD servers
+	// that new sessions are spread across according to BackendBalance:
+	// round_robin or least_connections.
+	BackendAddrs   []string `yaml:"backend_addrs"`
+	BackendBalance string   `yaml:"backend_balance"`
+	// BackendDiscovery, when set, replaces both with the backends a
+	// dns+srv://, dns:// or consul:// URI resolves to, looked up again
+	// every BackendDiscoveryInterval.
+	BackendDiscovery         string        `yaml:"backend_discovery"`
+	BackendDiscoveryInterval time.Duration `yaml:"backend_discovery_interval"`
+	// CanaryAddrs are VAD servers running a model under evaluation. In
+	// CanaryMode route, CanaryPercent of new sessions are served by them;
+	// in shadow mode, that share of sessions instead has its audio mirrored
+	// to them and their responses recorded next to the primary's; compare
+	// mode shadows too and reports how the two backends differed.
+	CanaryAddrs   []string `yaml:"canary_addrs"`
+	CanaryPercent float64  `yaml:"canary_percent"`
+	CanaryMode    string   `yaml:"canary_mode"`
+	// ModelRoutes serve the sessions asking for a model, or else speaking
+	// one of a route's languages, from that route's backends. Sessions
+	// asking for a model no route serves stay on the shared backends, which
+	// get its name in metadata. They are set in the config file only.
+	ModelRoutes []ModelRoute `yaml:"model_routes"`
+	// BackendHealthService is the service name checked by /readyz; empty
+	// checks the backend server as a whole.
+	BackendHealthService string `yaml:"backend_health_service"`
+	// BackendHealthInterval is how often each backend is probed, each probe
+	// taking at most BackendHealthTimeout; failing backends get no new
+	// sessions. Zero disables probing.
+	BackendHealthInterval time.Duration `yaml:"backend_health_interval"`
+	BackendHealthTimeout  time.Duration `yaml:"backend_health_timeout"`
+	// BackendBreakerFailures consecutive stream failures take a backend out
+	// of rotation for BackendBreakerCooldown; zero disables the breaker.
+	BackendBreakerFailures int           `yaml:"backend_breaker_failures"`
+	BackendBreakerCooldown time.Duration `yaml:"backend_breaker_cooldown"`
+	// BackendDialTimeout bounds opening a session's backend stream; failed
+	// attempts are retried with backoff until it passes. Zero makes a
+	// single attempt.
+	BackendDialTimeout time.Duration `yaml:"backend_dial_timeout"`
+	// BackendWarmStreams idle streams are kept open on each backend so
+	// new sessions skip opening one.
+	BackendWarmStreams int `yaml:"backend_warm_streams"`
+	// BackendKeepaliveTime is how long a backend connection may be idle
+	// before it is pinged, and BackendKeepaliveTimeout how long the ping
+	// may go unanswered before its streams fail. Zero disables keepalive.
+	BackendKeepaliveTime    time.Duration `yaml:"backend_keepalive_time"`
+	BackendKeepaliveTimeout time.Duration `yaml:"backend_keepalive_timeout"`
+	// BackendMaxMessageBytes caps gRPC messages to and from the backend;
+	// zero keeps gRPC's default.
+	BackendMaxMessageBytes int `yaml:"backend_max_message_bytes"`
+	// BackendStreamDeadline bounds every backend stream. A stream reaching
+	// it fails over like a broken one, or ends the session. Zero means no
+	// deadline.
+	BackendStreamDeadline time.Duration `yaml:"backend_stream_deadline"`
+	// BackendChunkAcks says the backends answer every chunk, in order, with
+	// one response ("continue" if nothing changed), which lets the bridge
+	// measure each chunk's latency. EchoChunkLatency adds it to the JSON
+	// responses clients get.
+	BackendChunkAcks bool `yaml:"backend_chunk_acks"`
+	EchoChunkLatency bool `yaml:"echo_chunk_latency"`
+	// EnrichEvents adds the wall-clock time, the media time and the audio
+	// frame count to the JSON responses clients get.
+	EnrichEvents bool `yaml:"enrich_events"`
+	// FillSequenceGaps replaces audio frames lost from sessions sending
+	// sequence numbers with silence, keeping the backend's media time that
+	// of the client.
+	FillSequenceGaps bool `yaml:"fill_sequence_gaps"`
+	// Denoise suppresses background noise in sessions' audio with RNNoise,
+	// in builds with the rnnoise tag, unless they ask otherwise with
+	// denoise=false.
+	Denoise bool `yaml:"denoise"`
+	// AGCTargetDBFS, when set, evens out the level of sessions' audio,
+	// bringing speech to this RMS level without letting peaks clip, unless
+	// they choose another target with agc_target_dbfs, or 0 to turn it off.
+	AGCTargetDBFS float64 `yaml:"agc_target_dbfs"`
+	// DTMF reports telephone keypad tones in sessions' audio as dtmf
+	// events, unless they ask otherwise with dtmf=false.
+	DTMF bool `yaml:"dtmf"`
+	// AudioPipeline lists the processing stages sessions' audio runs
+	// through, in order; empty means resample, dtmf, denoise, agc, frame.
+	AudioPipeline []string `yaml:"audio_pipeline"`
+	// QuerySettings, when set, are the only session settings clients may
+	// give as query parameters, such as sample_rate and sensitivity; others
+	// are refused. Empty allows them all.
+	QuerySettings []string `yaml:"query_settings"`
+	// BackendStreamConfig opens every backend stream with a config message
+	// carrying the session's endpointing settings, for backends that read
+	// it. They are passed as metadata either way.
+	BackendStreamConfig bool `yaml:"backend_stream_config"`
+	// BackendFrameDuration, when set, sends the backends audio in frames of
+	// exactly this length rather than as clients chunk it. With
+	// BackendJitterBuffer, the frames go out that much later, at the pace
+	// of real time.
+	BackendFrameDuration time.Duration `yaml:"backend_frame_duration"`
+	BackendJitterBuffer  time.Duration `yaml:"backend_jitter_buffer"`
+	// BackendFailoverAttempts is how many times a session may move to
+	// another healthy backend when its stream breaks, replaying the last
+	// BackendFailoverReplay of audio; zero attempts disables failover.
+	BackendFailoverAttempts int           `yaml:"backend_failover_attempts"`
+	BackendFailoverReplay   time.Duration `yaml:"backend_failover_replay"`
+	// BackendOutageBuffer is how long a session whose backend stream broke
+	// keeps trying to open another, holding up to that much of its audio
+	// for it; zero disables buffering.
+	BackendOutageBuffer time.Duration `yaml:"backend_outage_buffer"`
+	// WakeWordAddr, when set, gates every session behind a wake word: its
+	// audio goes to this gRPC backend, speaking the VAD protocol, and only
+	// reaches the VAD backend once that answers with WakeWordEvent. From
+	// then on it flows, starting with WakeWordPreroll of the audio held
+	// back, until WakeWordWindow passes without speech.
+	WakeWordAddr    string        `yaml:"wake_word_addr"`
+	WakeWordEvent   string        `yaml:"wake_word_event"`
+	WakeWordWindow  time.Duration `yaml:"wake_word_window"`
+	WakeWordPreroll time.Duration `yaml:"wake_word_preroll"`
+	// ASRURL, when set, sends the audio of every speech segment, from
+	// ASRPreroll before the backend reported its start, to a speech-to-
+	// text service taking OpenAI-style multipart uploads, with ASRModel and
+	// ASRAPIKey. Segments are cut at ASRMaxSegment and each request may
+	// take ASRTimeout; transcripts reach the client as transcript frames.
+	ASRURL        string        `yaml:"asr_url"`
+	ASRModel      string        `yaml:"asr_model"`
+	ASRAPIKey     string        `yaml:"asr_api_key"`
+	ASRPreroll    time.Duration `yaml:"asr_preroll"`
+	ASRMaxSegment time.Duration `yaml:"asr_max_segment"`
+	ASRTimeout    time.Duration `yaml:"asr_timeout"`
+	// SegmentClips, when set, cuts the audio of every speech segment the
+	// way ASRPreroll and ASRMaxSegment say and delivers it as a WAV clip:
+	// to the client in speech_clip frames ("client"), next to the session's
+	// recording ("recording") or as clip events for the event sinks and
+	// webhooks ("events").
+	SegmentClips []string `yaml:"segment_clips"`
+	// TTSURL, when set, lets sessions speak: text from speak messages or
+	// POST /v1/sessions/{id}/speak is synthesized by a text-to-speech
+	// service taking OpenAI-style JSON requests, with TTSModel, TTSVoice
+	// and TTSAPIKey, and answering with 16-bit mono PCM at TTSSampleRate.
+	TTSURL        string `yaml:"tts_url"`
+	TTSModel      string `yaml:"tts_model"`
+	TTSVoice      string `yaml:"tts_voice"`
+	TTSAPIKey     string `yaml:"tts_api_key"`
+	TTSSampleRate int    `yaml:"tts_sample_rate"`
+	// LLMURL, when set along with ASRURL, answers every transcript with a
+	// chat completion service taking OpenAI-style requests, with LLMModel
+	// and LLMAPIKey, given LLMPrompt and the last LLMMaxTurns exchanges.
+	// Each reply may take LLMTimeout and, with TTSURL set, is spoken.
+	LLMURL      string        `yaml:"llm_url"`
+	LLMModel    string        `yaml:"llm_model"`
+	LLMAPIKey   string        `yaml:"llm_api_key"`
+	LLMPrompt   string        `yaml:"llm_system_prompt"`
+	LLMMaxTurns int           `yaml:"llm_max_turns"`
+	LLMTimeout  time.Duration `yaml:"llm_timeout"`
+	// BargeIn lets users interrupt the assistant: when the backend reports
+	// speech, the reply being generated and the speech being played back
+	// are cancelled and the client gets a barge_in frame.
+	BargeIn bool `yaml:"barge_in"`
+	// FallbackVAD serves sessions with a built-in energy detector when no
+	// backend is reachable. A frame is speech when its RMS level reaches
+	// FallbackEnergyThreshold dBFS, or comes within 10 dB of it with a
+	// zero-crossing rate of at least FallbackZCRThreshold. Segments start
+	// after FallbackMinSpeech of speech and end after FallbackMinSilence of
+	// silence.
+	FallbackVAD             bool          `yaml:"fallback_vad"`
+	FallbackEnergyThreshold float64       `yaml:"fallback_energy_threshold"`
+	FallbackZCRThreshold    float64       `yaml:"fallback_zcr_threshold"`
+	FallbackMinSpeech       time.Duration `yaml:"fallback_min_speech"`
+	FallbackMinSilence      time.Duration `yaml:"fallback_min_silence"`
+	// MaxSessions caps the sessions open at once across all clients; zero
+	// means unlimited. Rejected clients are told to retry after
+	// CapacityRetryAfter.
+	MaxSessions        int           `yaml:"max_sessions"`
+	CapacityRetryAfter time.Duration `yaml:"capacity_retry_after"`
+	// MaxListeners caps the listen-only clients and event streams following
+	// one session; zero means unlimited.
+	MaxListeners int `yaml:"max_listeners"`
+
+	// WebSocket keepalive: ping period, how long a pong may be overdue and
+	// how long a session may go without audio. Zero disables each.
+	PingInterval time.Duration `yaml:"ping_interval"`
+	PongTimeout  time.Duration `yaml:"pong_timeout"`
+	IdleTimeout  time.Duration `yaml:"idle_timeout"`
+	// ResumeWindow is how long a WebSocket session that lost its
+	// connection waits for the client to resume it; zero ends it at once.
+	ResumeWindow time.Duration `yaml:"resume_window"`
+	// HeartbeatInterval is how often streaming clients get a heartbeat
+	// frame with their session's uptime, traffic and latency; zero sends
+	// none.
+	HeartbeatInterval time.Duration `yaml:"heartbeat_interval"`
+	// AudioLevelInterval is how much audio each audio_level frame sent to
+	// the client covers; zero sends none.
+	AudioLevelInterval time.Duration `yaml:"audio_level_interval"`
+	// MaxMessageBytes is the largest WebSocket message a client may send.
+	MaxMessageBytes int64 `yaml:"max_message_bytes"`
+	// SendQueueSize and SendQueuePolicy bound the audio waiting for a slow
+	// backend: block, drop_oldest or disconnect.
+	SendQueueSize   int    `yaml:"send_queue_size"`
+	SendQueuePolicy string `yaml:"send_queue_policy"`
+	// RealtimeLatencyBudget drops audio that waited longer than this to be
+	// sent; zero disables real-time mode.
+	RealtimeLatencyBudget time.Duration `yaml:"realtime_latency_budget"`
+	// BatchMaxBytes caps POST /v1/vad uploads; zero disables the endpoint.
+	BatchMaxBytes int64 `yaml:"batch_max_bytes"`
+	// BatchSpeed paces batch uploads at this multiple of real time so
+	// event timestamps stay close; zero sends as fast as the backend reads.
+	BatchSpeed float64 `yaml:"batch_speed"`
+	// RecordDir, when set, saves each session's audio as WAV with a JSON
+	// sidecar of its events. Files over RecordMaxFileBytes are split, and
+	// the oldest recordings go once the directory passes RecordMaxTotalBytes.
+	RecordDir           string `yaml:"record_dir"`
+	RecordMaxFileBytes  int64  `yaml:"record_max_file_bytes"`
+	RecordMaxTotalBytes int64  `yaml:"record_max_total_bytes"`
+	// RecordS3Bucket, when set, moves finished recordings to this
+	// S3-compatible bucket. Without keys, the AWS_* or MINIO_* environment
+	// variables or the instance role are used.
+	RecordS3Endpoint  string        `yaml:"record_s3_endpoint"`
+	RecordS3Bucket    string        `yaml:"record_s3_bucket"`
+	RecordS3Region    string        `yaml:"record_s3_region"`
+	RecordS3Prefix    string        `yaml:"record_s3_prefix"`
+	RecordS3AccessKey string        `yaml:"record_s3_access_key"`
+	RecordS3SecretKey string        `yaml:"record_s3_secret_key"`
+	RecordS3Insecure  bool          `yaml:"record_s3_insecure"`
+	RecordS3Retries   int           `yaml:"record_s3_retries"`
+	RecordS3Retention time.Duration `yaml:"record_s3_retention"`
+	RecordS3KeepLocal bool          `yaml:"record_s3_keep_local"`
+	// DBDSN, when set, stores sessions and their VAD events in a database
+	// served by DBDriver: sqlite (a file path) or postgres (a URL).
+	DBDriver string `yaml:"db_driver"`
+	DBDSN    string `yaml:"db_dsn"`
+	// BillingInterval, when set, exports a usage report of the stored
+	// sessions per period of that length, into BillingDir in each of
+	// BillingFormats (csv, json) and/or posted to BillingWebhookURL.
+	BillingInterval      time.Duration `yaml:"billing_interval"`
+	BillingDir           string        `yaml:"billing_dir"`
+	BillingFormats       []string      `yaml:"billing_formats"`
+	BillingWebhookURL    string        `yaml:"billing_webhook_url"`
+	BillingWebhookSecret string        `yaml:"billing_webhook_secret"`
+	// Webhooks receive signed POSTs for session events. They are set in the
+	// config file only; failed deliveries are retried up to
+	// WebhookMaxAttempts times and then go to WebhookDeadLetterFile, or the
+	// log if it is empty.
+	Webhooks              []Webhook     `yaml:"webhooks"`
+	WebhookMaxAttempts    int           `yaml:"webhook_max_attempts"`
+	WebhookTimeout        time.Duration `yaml:"webhook_timeout"`
+	WebhookDeadLetterFile string        `yaml:"webhook_dead_letter_file"`
+	// KafkaBrokers, when set, publishes VAD events (and speech segments with
+	// KafkaSegments) to KafkaTopic, keyed by session ID.
+	KafkaBrokers       []string `yaml:"kafka_brokers"`
+	KafkaTopic         string   `yaml:"kafka_topic"`
+	KafkaSegments      bool     `yaml:"kafka_segments"`
+	KafkaTLS           bool     `yaml:"kafka_tls"`
+	KafkaSASLMechanism string   `yaml:"kafka_sasl_mechanism"`
+	KafkaUsername      string   `yaml:"kafka_username"`
+	KafkaPassword      string   `yaml:"kafka_password"`
+	// NATSURL, when set, publishes each session's events on
+	// <NATSSubjectPrefix>.events.<session>. NATSAudio also accepts audio
+	// sessions over NATS; see ingest.NATS.
+	NATSURL              string        `yaml:"nats_url"`
+	NATSCredsFile        string        `yaml:"nats_creds_file"`
+	NATSSubjectPrefix    string        `yaml:"nats_subject_prefix"`
+	NATSJetStream        bool          `yaml:"nats_jetstream"`
+	NATSSegments         bool          `yaml:"nats_segments"`
+	NATSAudio            bool          `yaml:"nats_audio"`
+	NATSAudioIdleTimeout time.Duration `yaml:"nats_audio_idle_timeout"`
+	// TwilioPath, when set, serves Twilio Media Streams there; see
+	// ingest.Twilio. With TwilioAuthToken, requests must carry Twilio's
+	// signature instead of the usual credentials.
+	TwilioPath      string `yaml:"twilio_path"`
+	TwilioAuthToken string `yaml:"twilio_auth_token"`
+	// SIPAddr, when set, answers SIP calls over UDP there and runs the VAD
+	// on their RTP audio, received on a port between RTPPortMin and
+	// RTPPortMax; see ingest.SIP. SIPPublicIP is the address SDP answers
+	// give, by default the one the caller reached. SIPAllowedCIDRs, when
+	// set, are the only networks calls are taken from.
+	SIPAddr         string        `yaml:"sip_addr"`
+	SIPPublicIP     string        `yaml:"sip_public_ip"`
+	SIPAllowedCIDRs []string      `yaml:"sip_allowed_cidrs"`
+	RTPPortMin      int           `yaml:"rtp_port_min"`
+	RTPPortMax      int           `yaml:"rtp_port_max"`
+	RTPTimeout      time.Duration `yaml:"rtp_timeout"`
+	// WebRTCPath, when set, takes WHIP offers there from browsers sending
+	// their microphone over WebRTC; see ingest.WebRTC. WebRTCICEServers are
+	// STUN or TURN URLs, WebRTCPublicIP replaces the host's addresses in
+	// candidates behind a 1:1 NAT, and WebRTCUDPAddr, when set, carries all
+	// sessions' media on one UDP socket.
+	WebRTCPath       string   `yaml:"webrtc_path"`
+	WebRTCICEServers []string `yaml:"webrtc_ice_servers"`
+	WebRTCPublicIP   string   `yaml:"webrtc_public_ip"`
+	WebRTCUDPAddr    string   `yaml:"webrtc_udp_addr"`
+	// GRPCService serves the bridge's own service, vad.BridgeService, on the
+	// HTTP listener over gRPC, gRPC-Web and Connect; see grpcapi.Server.
+	GRPCService bool `yaml:"grpc_service"`
+	// MQTTURL, when set, takes the audio microphone devices publish to
+	// <MQTTTopicPrefix>/<device>/audio on that broker, every device's
+	// session settings being MQTTSettings; see ingest.MQTT.
+	MQTTURL         string        `yaml:"mqtt_url"`
+	MQTTClientID    string        `yaml:"mqtt_client_id"`
+	MQTTUsername    string        `yaml:"mqtt_username"`
+	MQTTPassword    string        `yaml:"mqtt_password"`
+	MQTTTopicPrefix string        `yaml:"mqtt_topic_prefix"`
+	MQTTSettings    string        `yaml:"mqtt_settings"`
+	MQTTIdleTimeout time.Duration `yaml:"mqtt_idle_timeout"`
+	// RedisURL, when set, broadcasts session events on Redis pub/sub
+	// channels named after RedisChannelPrefix.
+	RedisURL           string `yaml:"redis_url"`
+	RedisChannelPrefix string `yaml:"redis_channel_prefix"`
+	RedisSegments      bool   `yaml:"redis_segments"`
+	// StaticDir, when set, serves the frontend at / from disk instead of
+	// the copy built into the binary.
+	StaticDir   string `yaml:"static_dir"`
+	WSPath      string `yaml:"ws_path"`
+	MetricsPath string `yaml:"metrics_path"`
+	// ClusterRedisURL, when set, shares this replica's sessions with the
+	// others through a Redis registry, under ClusterKeyPrefix: they are
+	// listed together, and resumed on whichever replica the client reaches,
+	// which relays it to the one at ClusterAdvertiseURL. ClusterReplica
+	// names the replica, by default after its host.
+	ClusterRedisURL     string `yaml:"cluster_redis_url"`
+	ClusterKeyPrefix    string `yaml:"cluster_key_prefix"`
+	ClusterReplica      string `yaml:"cluster_replica"`
+	ClusterAdvertiseURL string `yaml:"cluster_advertise_url"`
+	// Origins allowed to open WebSocket connections besides the bridge's own.
+	// AllowAllOrigins turns the check off and is meant for development.
+	AllowedOrigins  []string `yaml:"allowed_origins"`
+	AllowAllOrigins bool     `yaml:"allow_all_origins"`
+	// CORSOrigins are the origins, in the same patterns or "*" for any,
+	// whose browser apps may call the REST, SSE and admin endpoints, with
+	// CORSMethods and CORSHeaders. CORSCredentials lets them send cookies
+	// and HTTP authentication, and CORSMaxAge is how long browsers may
+	// cache a preflight's answer.
+	CORSOrigins     []string      `yaml:"cors_origins"`
+	CORSMethods     []string      `yaml:"cors_methods"`
+	CORSHeaders     []string      `yaml:"cors_headers"`
+	CORSCredentials bool          `yaml:"cors_credentials"`
+	CORSMaxAge      time.Duration `yaml:"cors_max_age"`
+
+	// JWT authentication of /ws, enabled by setting a JWKS URL or secret.
+	JWTJWKSURL    string `yaml:"jwt_jwks_url"`
+	JWTSecret     string `yaml:"jwt_secret"`
+	JWTIssuer     string `yaml:"jwt_issuer"`
+	JWTAudience   string `yaml:"jwt_audience"`
+	JWTQueryParam string `yaml:"jwt_query_param"`
+	JWTCookie     string `yaml:"jwt_cookie"`
+
+	// API keys for machine callers, as "name:sha256[:rate_per_minute[:tenant]]"
+	// entries and/or a YAML key file. APIKeyRatePerMinute applies to keys
+	// without their own rate; zero means unlimited.
+	APIKeys             []string `yaml:"api_keys"`
+	APIKeysFile         string   `yaml:"api_keys_file"`
+	APIKeyRatePerMinute int      `yaml:"api_key_rate_per_minute"`
+	// AdminAPIKeys, in the same format, open the /admin endpoints and
+	// dashboard, which are served only when some are set. Other callers'
+	// credentials don't.
+	AdminAPIKeys []string `yaml:"admin_api_keys"`
+	// DebugEndpoints serves pprof profiles, goroutine dumps and runtime
+	// figures under /debug to admin API key holders.
+	DebugEndpoints bool `yaml:"debug_endpoints"`
+
+	// Audio quotas of authenticated callers: how much audio the backend may
+	// process for each subject per UTC day and month; zero means unlimited.
+	// QuotaOverrides, as "subject:daily:monthly" entries, replace them for
+	// some subjects.
+	QuotaDaily     time.Duration `yaml:"quota_daily"`
+	QuotaMonthly   time.Duration `yaml:"quota_monthly"`
+	QuotaOverrides []string      `yaml:"quota_overrides"`
+
+	// Tenants let one bridge serve several products. A request belongs to
+	// the tenant its credentials name, an API key's or the TenantClaim of
+	// its JWT, or else, with TenantDomain, to the one whose
+	// <tenant>.<domain> host it was sent to. TenantRequired refuses
+	// requests belonging to none. Tenants are set in the config file only.
+	Tenants        []Tenant `yaml:"tenants"`
+	TenantClaim    string   `yaml:"tenant_claim"`
+	TenantDomain   string   `yaml:"tenant_domain"`
+	TenantRequired bool     `yaml:"tenant_required"`
+
+	// Per-client-IP limits on /ws: new sessions per minute and sessions open
+	// at once. Zero disables a limit. TrustProxyHeaders takes the client IP
+	// from the last X-Forwarded-For entry, the one the proxy appended.
+	IPSessionsPerMinute int    `yaml:"ip_sessions_per_minute"`
+	IPMaxSessions       int    `yaml:"ip_max_sessions"`
+	TrustProxyHeaders   bool   `yaml:"trust_proxy_headers"`
+	LogFormat           string `yaml:"log_format"`
+	LogLevel            string `yaml:"log_level"`
+	// AccessLog logs every HTTP request once served, with the ID it was
+	// given.
+	AccessLog bool `yaml:"access_log"`
+	// ShutdownTimeout bounds how long open sessions may take to drain once
+	// SIGTERM or SIGINT is received.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+
+	// Credentials for the connection to the VAD backend.
+	BackendTLS           bool   `yaml:"backend_tls"`
+	BackendCAFile        string `yaml:"backend_ca_file"`
+	BackendCertFile      string `yaml:"backend_cert_file"`
+	BackendKeyFile       string `yaml:"backend_key_file"`
+	BackendServerName    string `yaml:"backend_server_name"`
+	BackendAuthToken     string `yaml:"backend_auth_token"`
+	BackendAuthTokenFile string `yaml:"backend_auth_token_file"`
+
+	// OpenTelemetry tracing. Spans are only exported when OTelEndpoint is set.
+	OTelEndpoint    string  `yaml:"otel_endpoint"`
+	OTelInsecure    bool    `yaml:"otel_insecure"`
+	OTelServiceName string  `yaml:"otel_service_name"`
+	OTelSampleRatio float64 `yaml:"otel_sample_ratio"`
+
+	// Error reporting to Sentry or a compatible service: panics, backends
+	// failing and clients closing with unusual codes. Only enabled when
+	// ErrorReportingDSN is set.
+	ErrorReportingDSN         string `yaml:"error_reporting_dsn"`
+	ErrorReportingEnvironment string `yaml:"error_reporting_environment"`
+	ErrorReportingRelease     string `yaml:"error_reporting_release"`
+
+	// TLS for the HTTP/WebSocket listener. Either a certificate/key pair or
+	// a list of autocert (Let's Encrypt) domains may be given, not both.
+	TLSCertFile         string   `yaml:"tls_cert_file"`
+	TLSKeyFile          string   `yaml:"tls_key_file"`
+	TLSAutocertDomains  []string `yaml:"tls_autocert_domains"`
+	TLSAutocertCacheDir string   `yaml:"tls_autocert_cache_dir"`
+	TLSAutocertEmail    string   `yaml:"tls_autocert_email"`
+	// HTTPRedirectAddr, when set together with TLS, serves plain HTTP
+	// redirects to HTTPS (and ACME challenges in autocert mode).
+	HTTPRedirectAddr string `yaml:"http_redirect_addr"`
+	// WebTransportAddr, when set together with TLS, serves WebTransport
+	// sessions over HTTP/3 on that UDP address, at WSPath; see package
+	// webtransport.
+	WebTransportAddr string `yaml:"webtransport_addr"`
+}
+
+// Webhook is one endpoint under webhooks. Events lists what it receives
+// (session_start, speech_start, speech_end, speech_clip, dtmf,
+// session_end); empty means all. speech_clip is only sent with
+// segment_clips: [events], dtmf for sessions detecting tones.
+type Webhook struct {
+	URL    string   `yaml:"url"`
+	Secret string   `yaml:"secret"`
+	Events []string `yaml:"events"`
+}
+
+// ModelRoute is one entry under model_routes. Languages are base languages
+// such as "uz", matching any locale of theirs.
+type ModelRoute struct {
+	Model        string   `yaml:"model"`
+	Languages    []string `yaml:"languages"`
+	BackendAddrs []string `yaml:"backend_addrs"`
+}
+
+// Tenant is one entry under tenants. BackendAddrs, when set, serve its
+// sessions instead of the shared backends, and Encodings, when set, are the
+// only ones its clients may send. QuotaDaily and QuotaMonthly cap the audio
+// of all its callers together; zero means unlimited. Its Webhooks receive
+// its sessions' events only.
+type Tenant struct {
+	Name         string        `yaml:"name"`
+	BackendAddrs []string      `yaml:"backend_addrs"`
+	Encodings    []string      `yaml:"encodings"`
+	QuotaDaily   time.Duration `yaml:"quota_daily"`
+	QuotaMonthly time.Duration `yaml:"quota_monthly"`
+	Webhooks     []Webhook     `yaml:"webhooks"`
+}
+
+// Default returns the settings used when nothing else is configured.
+func Default() Config {
+	return Config{
+		ListenAddr:               ":8080",
+		UnixSocketMode:           "0660",
+		BackendAddr:              "localhost:50055",
+		BackendBalance:           "round_robin",
+		BackendDiscoveryInterval: 30 * time.Second,
+		CanaryMode:               "route",
+		BackendPoolSize:          4,
+		BackendHealthInterval:    10 * time.Second,
+		BackendHealthTimeout:     2 * time.Second,
+		BackendBreakerFailures:   5,
+		BackendBreakerCooldown:   30 * time.Second,
+		BackendDialTimeout:       10 * time.Second,
+		BackendKeepaliveTimeout:  20 * time.Second,
+		BackendFailoverAttempts:  2,
+		BackendFailoverReplay:    2 * time.Second,
+		VAD:                      VADGRPC,
+		EmbeddedVADEngine:        "webrtc",
+		EmbeddedAggressiveness:   2,
+		EmbeddedVADMinSpeech:     60 * time.Millisecond,
+		EmbeddedVADMinSilence:    400 * time.Millisecond,
+		WakeWordEvent:            "wake",
+		WakeWordWindow:           8 * time.Second,
+		WakeWordPreroll:          500 * time.Millisecond,
+		ASRModel:                 "whisper-1",
+		ASRPreroll:               300 * time.Millisecond,
+		ASRMaxSegment:            30 * time.Second,
+		ASRTimeout:               30 * time.Second,
+		TTSModel:                 "tts-1",
+		TTSVoice:                 "alloy",
+		TTSSampleRate:            24000,
+		LLMModel:                 "gpt-4o-mini",
+		LLMPrompt:                "You are a helpful voice assistant. Answer briefly, in plain sentences that read well aloud.",
+		LLMMaxTurns:              10,
+		LLMTimeout:               30 * time.Second,
+		BargeIn:                  true,
+		FallbackEnergyThreshold:  -40,
+		FallbackZCRThreshold:     0.3,
+		FallbackMinSpeech:        100 * time.Millisecond,
+		FallbackMinSilence:       500 * time.Millisecond,
+		WSPath:                   "/ws",
+		MetricsPath:              "/metrics",
+		LogFormat:                "text",
+		LogLevel:                 "info",
+		AccessLog:                true,
+		CORSMethods:              []string{"GET", "POST", "PUT", "DELETE"},
+		CORSHeaders:              []string{"Authorization", "Content-Type", "X-API-Key", "X-Request-ID", "Last-Event-ID"},
+		CORSMaxAge:               10 * time.Minute,
+		ShutdownTimeout:          10 * time.Second,
+		CapacityRetryAfter:       5 * time.Second,
+		MaxListeners:             16,
+		PingInterval:             30 * time.Second,
+		PongTimeout:              10 * time.Second,
+		IdleTimeout:              5 * time.Minute,
+		MaxMessageBytes:          64 << 10,
+		SendQueueSize:            32,
+		SendQueuePolicy:          "block",
+		BatchMaxBytes:            100 << 20,
+		BatchSpeed:               8,
+		RecordMaxFileBytes:       64 << 20,
+		RecordMaxTotalBytes:      1 << 30,
+		RecordS3Endpoint:         "s3.amazonaws.com",
+		RecordS3Retries:          5,
+		DBDriver:                 "sqlite",
+		BillingDir:               "./billing",
+		BillingFormats:           []string{"csv"},
+		WebhookMaxAttempts:       6,
+		WebhookTimeout:           10 * time.Second,
+		KafkaTopic:               "vad-events",
+		NATSSubjectPrefix:        "vad",
+		NATSAudioIdleTimeout:     30 * time.Second,
+		RTPPortMin:               10000,
+		RTPPortMax:               10999,
+		RTPTimeout:               30 * time.Second,
+		MQTTClientID:             "vad-bridge",
+		MQTTTopicPrefix:          "vad",
+		MQTTIdleTimeout:          10 * time.Second,
+		RedisChannelPrefix:       "vad",
+		ClusterKeyPrefix:         "vad",
+		JWTQueryParam:            "access_token",
+		JWTCookie:                "vad_token",
+
+		OTelServiceName: "vad-bridge",
+		OTelSampleRatio: 1,
+
+		TLSAutocertCacheDir: "./autocert-cache",
+	}
+}
+
+type field struct {
+	name  string
+	usage string
+	ptr   any
+}
+
+func (c *Config) fields() []field {
+	return []field{
+		{"listen_addr", "HTTP listen address: host:port, unix:<path> or systemd[:<name>]", &c.ListenAddr},
+		{"listen_addrs", "comma-separated further HTTP listen addresses, in the same forms", &c.ListenAddrs},
+		{"unix_socket_mode", "octal permissions of unix: listen sockets", &c.UnixSocketMode},
+		{"vad", "where sessions are served: grpc backends or an embedded in-process VAD", &c.VAD},
+		{"embedded_vad_engine", "engine of the embedded VAD: webrtc or energy", &c.EmbeddedVADEngine},
+		{"embedded_vad_aggressiveness", "WebRTC VAD aggressiveness, 0 (least) to 3 (most)", &c.EmbeddedAggressiveness},
+		{"embedded_vad_min_speech", "speech the embedded VAD needs before reporting a start", &c.EmbeddedVADMinSpeech},
+		{"embedded_vad_min_silence", "silence the embedded VAD needs before reporting an end", &c.EmbeddedVADMinSilence},
+		{"backend_addr", "gRPC address of the VAD backend", &c.BackendAddr},
+		{"backend_addrs", "comma-separated VAD backends to balance sessions across (overrides backend_addr)", &c.BackendAddrs},
+		{"backend_balance", "how sessions are spread across backends: round_robin or least_connections", &c.BackendBalance},
+		{"backend_discovery", "resolve backends from a dns+srv://, dns:// or consul:// URI (overrides backend_addrs)", &c.BackendDiscovery},
+		{"backend_discovery_interval", "how often discovered backends are looked up again", &c.BackendDiscoveryInterval},
+		{"canary_addrs", "comma-separated VAD backends running a model under evaluation", &c.CanaryAddrs},
+		{"canary_percent", "share of sessions, 0-100, sent to or mirrored to the canary backends", &c.CanaryPercent},
+		{"canary_mode", "route sessions to the canary backends, shadow them there, or compare both", &c.CanaryMode},
+		{"backend_pool_size", "number of pooled gRPC connections per backend", &c.BackendPoolSize},
+		{"backend_health_service", "gRPC health service name checked by /readyz", &c.BackendHealthService},
+		{"backend_health_interval", "how often each backend is health-probed (0 disables probing)", &c.BackendHealthInterval},
+		{"backend_health_timeout", "how long one backend health probe may take", &c.BackendHealthTimeout},
+		{"backend_breaker_failures", "consecutive stream failures that open a backend's circuit (0 disables)", &c.BackendBreakerFailures},
+		{"backend_breaker_cooldown", "how long an open circuit keeps a backend out of rotation", &c.BackendBreakerCooldown},
+		{"backend_dial_timeout", "how long a session may retry opening its backend stream (0 = one attempt)", &c.BackendDialTimeout},
+		{"backend_warm_streams", "idle streams kept open on each backend for new sessions (0 = none)", &c.BackendWarmStreams},
+		{"backend_keepalive_time", "idle time before a backend connection is pinged (0 disables keepalive, minimum 10s)", &c.BackendKeepaliveTime},
+		{"backend_keepalive_timeout", "how long a backend keepalive ping may go unanswered", &c.BackendKeepaliveTimeout},
+		{"backend_max_message_bytes", "largest gRPC message sent to or received from the backend (0 = gRPC default)", &c.BackendMaxMessageBytes},
+		{"backend_stream_deadline", "deadline of every backend stream (0 = none)", &c.BackendStreamDeadline},
+		{"backend_stream_config", "open every backend stream with a message carrying the session's endpointing settings", &c.BackendStreamConfig},
+		{"backend_frame_duration", "length of the fixed-size audio frames sent to backends (0 = as clients send them)", &c.BackendFrameDuration},
+		{"backend_jitter_buffer", "delay smoothing fixed-size frames into a real-time stream to the backends (0 = none)", &c.BackendJitterBuffer},
+		{"backend_chunk_acks", "the backends answer every audio chunk with one response, for latency measurement", &c.BackendChunkAcks},
+		{"echo_chunk_latency", "add the measured chunk latency to VAD responses sent to clients", &c.EchoChunkLatency},
+		{"enrich_events", "add receive time, media time and frame sequence number to VAD responses sent to clients", &c.EnrichEvents},
+		{"fill_sequence_gaps", "replace audio frames lost from sequenced sessions with silence", &c.FillSequenceGaps},
+		{"denoise", "suppress background noise in sessions' audio unless they opt out (needs -tags rnnoise)", &c.Denoise},
+		{"agc_target_dbfs", "RMS level automatic gain control brings sessions' speech to (0 = off)", &c.AGCTargetDBFS},
+		{"dtmf", "detect telephone keypad tones in sessions' audio unless they opt out", &c.DTMF},
+		{"audio_pipeline", "processing stages of sessions' audio, in order (default resample,dtmf,denoise,agc,frame)", &c.AudioPipeline},
+		{"query_settings", "comma-separated session settings clients may give as query parameters (empty = all)", &c.QuerySettings},
+		{"backend_failover_attempts", "times a session may fail over to another backend when its stream breaks (0 disables)", &c.BackendFailoverAttempts},
+		{"backend_failover_replay", "recent audio replayed to the backend a session fails over to", &c.BackendFailoverReplay},
+		{"backend_outage_buffer", "audio held while a session's backend is unavailable, sent once it is back (0 disables)", &c.BackendOutageBuffer},
+		{"wake_word_addr", "gRPC wake-word backend sessions' audio must get past first, e.g. wakeword:50052", &c.WakeWordAddr},
+		{"wake_word_event", "event the wake-word backend answers with when it hears the wake word", &c.WakeWordEvent},
+		{"wake_word_window", "how long audio keeps flowing after the wake word or the last speech", &c.WakeWordWindow},
+		{"wake_word_preroll", "audio from before the wake word fired sent to the backend with the rest", &c.WakeWordPreroll},
+		{"asr_url", "speech-to-text endpoint transcribing every speech segment, e.g. http://whisper:8000/v1/audio/transcriptions", &c.ASRURL},
+		{"asr_model", "model field sent to the speech-to-text service", &c.ASRModel},
+		{"asr_api_key", "bearer token for the speech-to-text service", &c.ASRAPIKey},
+		{"asr_preroll", "audio before a reported speech start included in its transcription", &c.ASRPreroll},
+		{"asr_max_segment", "longest speech segment sent for transcription", &c.ASRMaxSegment},
+		{"asr_timeout", "time limit of one transcription request", &c.ASRTimeout},
+		{"segment_clips", "where each speech segment's audio goes as a WAV clip: client, recording, events", &c.SegmentClips},
+		{"tts_url", "text-to-speech endpoint sessions speak with, e.g. http://tts:8000/v1/audio/speech", &c.TTSURL},
+		{"tts_model", "model field sent to the text-to-speech service", &c.TTSModel},
+		{"tts_voice", "default voice of the text-to-speech service", &c.TTSVoice},
+		{"tts_api_key", "bearer token for the text-to-speech service", &c.TTSAPIKey},
+		{"tts_sample_rate", "sample rate of the PCM the text-to-speech service answers with", &c.TTSSampleRate},
+		{"llm_url", "chat completion endpoint answering every transcript, e.g. http://llm:8000/v1/chat/completions", &c.LLMURL},
+		{"llm_model", "model field sent to the chat completion service", &c.LLMModel},
+		{"llm_api_key", "bearer token for the chat completion service", &c.LLMAPIKey},
+		{"llm_system_prompt", "system prompt of the assistant", &c.LLMPrompt},
+		{"llm_max_turns", "past exchanges of the session sent with each transcript", &c.LLMMaxTurns},
+		{"llm_timeout", "time limit of one assistant reply", &c.LLMTimeout},
+		{"barge_in", "cancel the assistant's reply when the user starts speaking", &c.BargeIn},
+		{"fallback_vad", "serve sessions with a built-in energy VAD when no backend is reachable", &c.FallbackVAD},
+		{"fallback_energy_threshold", "RMS level in dBFS above which the fallback VAD hears speech", &c.FallbackEnergyThreshold},
+		{"fallback_zcr_threshold", "zero-crossing rate making quieter frames speech for the fallback VAD", &c.FallbackZCRThreshold},
+		{"fallback_min_speech", "speech the fallback VAD needs before reporting a start", &c.FallbackMinSpeech},
+		{"fallback_min_silence", "silence the fallback VAD needs before reporting an end", &c.FallbackMinSilence},
+		{"max_sessions", "maximum concurrent sessions across all clients (0 = unlimited)", &c.MaxSessions},
+		{"max_listeners", "listen-only clients and event streams per session (0 = unlimited)", &c.MaxListeners},
+		{"capacity_retry_after", "retry hint sent to clients rejected at capacity", &c.CapacityRetryAfter},
+		{"ping_interval", "interval between WebSocket pings (0 disables keepalive)", &c.PingInterval},
+		{"pong_timeout", "how long a pong may be overdue before the session is dropped", &c.PongTimeout},
+		{"idle_timeout", "close sessions that send no audio for this long (0 = never)", &c.IdleTimeout},
+		{"resume_window", "how long a session whose WebSocket dropped waits to be resumed (0 = not resumable)", &c.ResumeWindow},
+		{"heartbeat_interval", "interval between heartbeat frames to streaming clients (0 = none)", &c.HeartbeatInterval},
+		{"audio_level_interval", "audio covered by each audio_level frame sent to clients (0 = none)", &c.AudioLevelInterval},
+		{"max_message_bytes", "largest WebSocket message accepted from a client (0 = unlimited)", &c.MaxMessageBytes},
+		{"send_queue_size", "audio chunks buffered per session while the backend is slow", &c.SendQueueSize},
+		{"send_queue_policy", "when the send queue is full: block, drop_oldest or disconnect", &c.SendQueuePolicy},
+		{"realtime_latency_budget", "drop audio that waited longer than this for the backend (0 = keep all)", &c.RealtimeLatencyBudget},
+		{"batch_max_bytes", "largest file accepted by POST /v1/vad (0 disables the endpoint)", &c.BatchMaxBytes},
+		{"batch_speed", "pace batch audio at this multiple of real time (0 = unpaced)", &c.BatchSpeed},
+		{"record_dir", "save session audio and events here (empty disables recording)", &c.RecordDir},
+		{"record_max_file_bytes", "start a new recording file past this size (0 = never)", &c.RecordMaxFileBytes},
+		{"record_max_total_bytes", "delete the oldest recordings past this total (0 = keep all)", &c.RecordMaxTotalBytes},
+		{"record_s3_endpoint", "host[:port] of the S3-compatible service recordings go to", &c.RecordS3Endpoint},
+		{"record_s3_bucket", "upload finished recordings to this bucket (empty keeps them local)", &c.RecordS3Bucket},
+		{"record_s3_region", "region of the recordings bucket", &c.RecordS3Region},
+		{"record_s3_prefix", "object name prefix for uploaded recordings", &c.RecordS3Prefix},
+		{"record_s3_access_key", "access key for the recordings bucket", &c.RecordS3AccessKey},
+		{"record_s3_secret_key", "secret key for the recordings bucket", &c.RecordS3SecretKey},
+		{"record_s3_insecure", "reach the recordings bucket over plain HTTP", &c.RecordS3Insecure},
+		{"record_s3_retries", "retries for a failed recording upload", &c.RecordS3Retries},
+		{"record_s3_retention", "delete uploaded recordings older than this (0 = keep)", &c.RecordS3Retention},
+		{"record_s3_keep_local", "keep recordings on disk after uploading them", &c.RecordS3KeepLocal},
+		{"db_driver", "session database: sqlite or postgres", &c.DBDriver},
+		{"db_dsn", "session database file or URL (empty disables storage)", &c.DBDSN},
+		{"billing_interval", "period of exported usage reports (0 = none)", &c.BillingInterval},
+		{"billing_dir", "directory receiving usage reports (empty writes none)", &c.BillingDir},
+		{"billing_formats", "comma-separated usage report formats: csv, json", &c.BillingFormats},
+		{"billing_webhook_url", "URL usage reports are posted to as JSON", &c.BillingWebhookURL},
+		{"billing_webhook_secret", "secret signing usage reports posted to billing_webhook_url", &c.BillingWebhookSecret},
+		{"webhook_max_attempts", "deliveries of one webhook event before it is dead-lettered", &c.WebhookMaxAttempts},
+		{"webhook_timeout", "timeout of one webhook request", &c.WebhookTimeout},
+		{"webhook_dead_letter_file", "append undeliverable webhook events here (empty logs them)", &c.WebhookDeadLetterFile},
+		{"kafka_brokers", "comma-separated Kafka brokers to publish VAD events to (empty disables)", &c.KafkaBrokers},
+		{"kafka_topic", "Kafka topic for VAD events", &c.KafkaTopic},
+		{"kafka_segments", "also publish speech segments to Kafka", &c.KafkaSegments},
+		{"kafka_tls", "connect to the Kafka brokers over TLS", &c.KafkaTLS},
+		{"kafka_sasl_mechanism", "Kafka SASL mechanism: plain, scram-sha-256 or scram-sha-512 (empty disables)", &c.KafkaSASLMechanism},
+		{"kafka_username", "Kafka SASL username", &c.KafkaUsername},
+		{"kafka_password", "Kafka SASL password", &c.KafkaPassword},
+		{"nats_url", "NATS server(s) to publish session events to (empty disables)", &c.NATSURL},
+		{"nats_creds_file", "NATS credentials file", &c.NATSCredsFile},
+		{"nats_subject_prefix", "first token of the NATS subjects used", &c.NATSSubjectPrefix},
+		{"nats_jetstream", "publish NATS events through JetStream and wait for acks", &c.NATSJetStream},
+		{"nats_segments", "also publish speech segments to NATS", &c.NATSSegments},
+		{"nats_audio", "accept audio sessions over NATS", &c.NATSAudio},
+		{"twilio_path", "HTTP path serving Twilio Media Streams (empty = disabled)", &c.TwilioPath},
+		{"twilio_auth_token", "Twilio auth token verifying X-Twilio-Signature on Twilio streams", &c.TwilioAuthToken},
+		{"sip_addr", "UDP address answering SIP calls (empty = disabled)", &c.SIPAddr},
+		{"sip_public_ip", "IP address given in SDP answers (empty = the one the caller reached)", &c.SIPPublicIP},
+		{"sip_allowed_cidrs", "comma-separated networks SIP calls are taken from (empty = any)", &c.SIPAllowedCIDRs},
+		{"rtp_port_min", "lowest UDP port for SIP calls' RTP audio", &c.RTPPortMin},
+		{"rtp_port_max", "highest UDP port for SIP calls' RTP audio", &c.RTPPortMax},
+		{"rtp_timeout", "end SIP calls whose audio stops this long", &c.RTPTimeout},
+		{"webrtc_path", "HTTP path taking WebRTC (WHIP) offers (empty = disabled)", &c.WebRTCPath},
+		{"webrtc_ice_servers", "comma-separated STUN/TURN URLs for WebRTC sessions", &c.WebRTCICEServers},
+		{"webrtc_public_ip", "IP address given in WebRTC candidates behind a 1:1 NAT", &c.WebRTCPublicIP},
+		{"webrtc_udp_addr", "UDP address carrying all WebRTC media (empty = a port per session)", &c.WebRTCUDPAddr},
+		{"grpc_service", "serve sessions over gRPC, gRPC-Web and Connect (vad.BridgeService) on the HTTP listener", &c.GRPCService},
+		{"mqtt_url", "MQTT broker to take device audio from, e.g. tcp://broker:1883 (empty disables)", &c.MQTTURL},
+		{"mqtt_client_id", "client ID the bridge connects to the MQTT broker with", &c.MQTTClientID},
+		{"mqtt_username", "MQTT user name", &c.MQTTUsername},
+		{"mqtt_password", "MQTT password", &c.MQTTPassword},
+		{"mqtt_topic_prefix", "first part of the MQTT topics used", &c.MQTTTopicPrefix},
+		{"mqtt_settings", "session settings of MQTT devices, as a query string", &c.MQTTSettings},
+		{"mqtt_idle_timeout", "end MQTT device sessions silent for this long (0 = never)", &c.MQTTIdleTimeout},
+		{"nats_audio_idle_timeout", "end NATS audio sessions silent for this long (0 = never)", &c.NATSAudioIdleTimeout},
+		{"redis_url", "redis:// URL to broadcast session events to (empty disables)", &c.RedisURL},
+		{"redis_channel_prefix", "first part of the Redis channel names", &c.RedisChannelPrefix},
+		{"redis_segments", "also broadcast speech segments on Redis", &c.RedisSegments},
+		{"cluster_redis_url", "redis:// URL of the session registry shared by bridge replicas (empty = this replica alone)", &c.ClusterRedisURL},
+		{"cluster_key_prefix", "first part of the session registry's Redis keys", &c.ClusterKeyPrefix},
+		{"cluster_replica", "name of this replica in the session registry (empty = the host name)", &c.ClusterReplica},
+		{"cluster_advertise_url", "ws:// or wss:// URL the other replicas reach this one at", &c.ClusterAdvertiseURL},
+		{"static_dir", "directory served at / instead of the built-in frontend", &c.StaticDir},
+		{"backend_tls", "dial the VAD backend over TLS", &c.BackendTLS},
+		{"backend_ca_file", "CA bundle used to verify the VAD backend", &c.BackendCAFile},
+		{"backend_cert_file", "client certificate for mTLS to the VAD backend", &c.BackendCertFile},
+		{"backend_key_file", "client key for mTLS to the VAD backend", &c.BackendKeyFile},
+		{"backend_server_name", "override the TLS server name of the VAD backend", &c.BackendServerName},
+		{"backend_auth_token", "bearer token sent on every backend call", &c.BackendAuthToken},
+		{"backend_auth_token_file", "file containing the backend bearer token", &c.BackendAuthTokenFile},
+		{"ws_path", "HTTP path of the WebSocket endpoint", &c.WSPath},
+		{"metrics_path", "HTTP path of the Prometheus metrics (empty disables)", &c.MetricsPath},
+		{"allowed_origins", "comma-separated origins allowed to connect, e.g. https://*.example.com", &c.AllowedOrigins},
+		{"allow_all_origins", "accept WebSocket upgrades from any origin (development only)", &c.AllowAllOrigins},
+		{"cors_origins", "comma-separated origins whose browser apps may call the REST and SSE endpoints, or *", &c.CORSOrigins},
+		{"cors_methods", "comma-separated methods allowed in cross-origin requests", &c.CORSMethods},
+		{"cors_headers", "comma-separated request headers allowed in cross-origin requests", &c.CORSHeaders},
+		{"cors_credentials", "let cross-origin requests carry cookies and HTTP authentication", &c.CORSCredentials},
+		{"cors_max_age", "how long browsers may cache a CORS preflight's answer", &c.CORSMaxAge},
+		{"jwt_jwks_url", "JWKS URL used to verify /ws tokens", &c.JWTJWKSURL},
+		{"jwt_secret", "HMAC secret used to verify /ws tokens", &c.JWTSecret},
+		{"jwt_issuer", "required JWT issuer", &c.JWTIssuer},
+		{"jwt_audience", "required JWT audience", &c.JWTAudience},
+		{"jwt_query_param", "query parameter that may carry the JWT", &c.JWTQueryParam},
+		{"jwt_cookie", "cookie that may carry the JWT", &c.JWTCookie},
+		{"api_keys", "comma-separated name:sha256[:rate_per_minute[:tenant]] API key entries", &c.APIKeys},
+		{"api_keys_file", "YAML file listing API keys", &c.APIKeysFile},
+		{"api_key_rate_per_minute", "default per-key request rate limit (0 = unlimited)", &c.APIKeyRatePerMinute},
+		{"admin_api_keys", "comma-separated name:sha256 API key entries for the /admin endpoints", &c.AdminAPIKeys},
+		{"debug_endpoints", "serve pprof and runtime diagnostics under /debug to admin API keys", &c.DebugEndpoints},
+		{"quota_daily", "audio each authenticated subject may have processed per UTC day (0 = unlimited)", &c.QuotaDaily},
+		{"quota_monthly", "audio each authenticated subject may have processed per UTC month (0 = unlimited)", &c.QuotaMonthly},
+		{"quota_overrides", "comma-separated subject:daily:monthly quota entries", &c.QuotaOverrides},
+		{"tenant_claim", "JWT claim naming the caller's tenant", &c.TenantClaim},
+		{"tenant_domain", "parent domain of <tenant>.<domain> hosts (empty = tenants from credentials only)", &c.TenantDomain},
+		{"tenant_required", "refuse requests that belong to no tenant", &c.TenantRequired},
+		{"ip_sessions_per_minute", "new /ws sessions allowed per client IP per minute (0 = unlimited)", &c.IPSessionsPerMinute},
+		{"ip_max_sessions", "concurrent /ws sessions allowed per client IP (0 = unlimited)", &c.IPMaxSessions},
+		{"trust_proxy_headers", "take the client IP from the last X-Forwarded-For entry", &c.TrustProxyHeaders},
+		{"log_format", "log output format: text or json", &c.LogFormat},
+		{"log_level", "minimum log level: debug, info, warn or error", &c.LogLevel},
+		{"access_log", "log every HTTP request with its method, path, status and duration", &c.AccessLog},
+		{"shutdown_timeout", "time allowed for sessions to drain on shutdown", &c.ShutdownTimeout},
+		{"otel_endpoint", "OTLP/gRPC collector address for traces (empty disables)", &c.OTelEndpoint},
+		{"otel_insecure", "connect to the OTLP collector without TLS", &c.OTelInsecure},
+		{"otel_service_name", "service name reported in traces", &c.OTelServiceName},
+		{"otel_sample_ratio", "fraction of sessions to trace, 0 to 1", &c.OTelSampleRatio},
+		{"error_reporting_dsn", "Sentry DSN errors are reported to (empty disables)", &c.ErrorReportingDSN},
+		{"error_reporting_environment", "environment reported with errors", &c.ErrorReportingEnvironment},
+		{"error_reporting_release", "release reported with errors", &c.ErrorReportingRelease},
+		{"tls_cert_file", "TLS certificate file (PEM)", &c.TLSCertFile},
+		{"tls_key_file", "TLS private key file (PEM)", &c.TLSKeyFile},
+		{"tls_autocert_domains", "comma-separated domains to obtain Let's Encrypt certificates for", &c.TLSAutocertDomains},
+		{"tls_autocert_cache_dir", "directory where autocert stores certificates", &c.TLSAutocertCacheDir},
+		{"tls_autocert_email", "contact email for the ACME account", &c.TLSAutocertEmail},
+		{"http_redirect_addr", "plain HTTP address that redirects to HTTPS", &c.HTTPRedirectAddr},
+		{"webtransport_addr", "UDP address serving WebTransport sessions over HTTP/3 (requires TLS)", &c.WebTransportAddr},
+	}
+}
+
+// Load resolves the configuration from args (usually os.Args[1:]), the
+// environment and the config file named by -config or VAD_CONFIG.
+func Load(args []string) (Config, error) {
+	cfg := Default()
+
+	// Flags are only recorded here and applied last, so that they win over
+	// the file and the environment.
+	set := map[string]string{}
+	fs := flag.NewFlagSet("vad-application", flag.ContinueOnError)
+	fs.Func("config", "path to a YAML config file", func(v string) error {
+		set["config"] = v
+		return nil
+	})
+	for _, f := range cfg.fields() {
+		fs.Var(&rawFlag{name: f.name, set: set, isBool: isBool(f.ptr)},
+			flagName(f.name), f.usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+
+	path, ok := set["config"]
+	if !ok {
+		path = os.Getenv("VAD_CONFIG")
+	}
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return cfg, err
+		}
+	}
+
+	for _, f := range cfg.fields() {
+		if v, ok := os.LookupEnv(envName(f.name)); ok {
+			if err := setValue(f.ptr, v); err != nil {
+				return cfg, fmt.Errorf("config: %s: %w", envName(f.name), err)
+			}
+		}
+	}
+
+	for _, f := range cfg.fields() {
+		if v, ok := set[f.name]; ok {
+			if err := setValue(f.ptr, v); err != nil {
+				return cfg, fmt.Errorf("config: -%s: %w", flagName(f.name), err)
+			}
+		}
+	}
+
+	return cfg, cfg.validate()
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config: %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *Config) validate() error {
+	if c.ListenAddr == "" {
+		return errors.New("config: listen_addr is required")
+	}
+	for _, addr := range c.Listeners() {
+		if addr == "" || addr == "unix:" {
+			return fmt.Errorf("config: invalid listen address %q", addr)
+		}
+	}
+	if _, err := strconv.ParseUint(c.UnixSocketMode, 8, 32); err != nil {
+		return fmt.Errorf("config: unix_socket_mode %q is not an octal mode", c.UnixSocketMode)
+	}
+	switch c.VAD {
+	case VADGRPC:
+		if c.BackendAddr == "" && len(c.BackendAddrs) == 0 && c.BackendDiscovery == "" {
+			return errors.New("config: backend_addr is required")
+		}
+	case VADEmbedded:
+		switch c.EmbeddedVADEngine {
+		case "webrtc", "energy":
+		default:
+			return errors.New("config: embedded_vad_engine must be webrtc or energy")
+		}
+		if c.EmbeddedAggressiveness < 0 || c.EmbeddedAggressiveness > 3 {
+			return errors.New("config: embedded_vad_aggressiveness must be between 0 and 3")
+		}
+		if c.EmbeddedVADMinSpeech < 0 || c.EmbeddedVADMinSilence < 0 {
+			return errors.New("config: embedded_vad_min_speech and embedded_vad_min_silence must not be negative")
+		}
+		if len(c.CanaryAddrs) > 0 || c.FallbackVAD || len(c.ModelRoutes) > 0 {
+			return errors.New("config: canary_addrs, fallback_vad and model_routes need vad grpc")
+		}
+	default:
+		return errors.New("config: vad must be grpc or embedded")
+	}
+	if c.BackendDiscovery != "" && c.BackendDiscoveryInterval <= 0 {
+		return errors.New("config: backend_discovery_interval must be positive")
+	}
+	if c.CanaryPercent < 0 || c.CanaryPercent > 100 {
+		return errors.New("config: canary_percent must be between 0 and 100")
+	}
+	if c.CanaryPercent > 0 && len(c.CanaryAddrs) == 0 {
+		return errors.New("config: canary_percent needs canary_addrs")
+	}
+	switch c.CanaryMode {
+	case "route", "shadow", "compare":
+	default:
+		return errors.New("config: canary_mode must be route, shadow or compare")
+	}
+	models, languages := map[string]bool{}, map[string]string{}
+	for _, r := range c.ModelRoutes {
+		switch {
+		case r.Model == "":
+			return errors.New("config: model_routes need a model")
+		case models[r.Model]:
+			return fmt.Errorf("config: model %q is routed twice", r.Model)
+		case len(r.BackendAddrs) == 0:
+			return fmt.Errorf("config: model %q needs backend_addrs", r.Model)
+		}
+		models[r.Model] = true
+		for _, l := range r.Languages {
+			if other, ok := languages[l]; ok {
+				return fmt.Errorf("config: language %q is routed to both %q and %q", l, other, r.Model)
+			}
+			languages[l] = r.Model
+		}
+	}
+	if c.BackendPoolSize < 1 {
+		return errors.New("config: backend_pool_size must be at least 1")
+	}
+	if c.BackendHealthInterval < 0 {
+		return errors.New("config: backend_health_interval must not be negative")
+	}
+	if c.BackendHealthInterval > 0 && c.BackendHealthTimeout <= 0 {
+		return errors.New("config: backend_health_timeout must be positive")
+	}
+	if c.BackendBreakerFailures < 0 {
+		return errors.New("config: backend_breaker_failures must not be negative")
+	}
+	if c.BackendBreakerFailures > 0 && c.BackendBreakerCooldown <= 0 {
+		return errors.New("config: backend_breaker_cooldown must be positive")
+	}
+	if c.BackendDialTimeout < 0 {
+		return errors.New("config: backend_dial_timeout must not be negative")
+	}
+	if c.BackendWarmStreams < 0 {
+		return errors.New("config: backend_warm_streams must not be negative")
+	}
+	if c.BackendKeepaliveTime < 0 {
+		return errors.New("config: backend_keepalive_time must not be negative")
+	}
+	if c.BackendKeepaliveTime > 0 && c.BackendKeepaliveTimeout <= 0 {
+		return errors.New("config: backend_keepalive_timeout must be positive")
+	}
+	if c.BackendMaxMessageBytes < 0 {
+		return errors.New("config: backend_max_message_bytes must not be negative")
+	}
+	if c.BackendStreamDeadline < 0 {
+		return errors.New("config: backend_stream_deadline must not be negative")
+	}
+	if c.EchoChunkLatency && !c.BackendChunkAcks {
+		return errors.New("config: echo_chunk_latency requires backend_chunk_acks")
+	}
+	if c.BackendFrameDuration < 0 || c.BackendFrameDuration > time.Second {
+		return errors.New("config: backend_frame_duration must be between 0 and 1s")
+	}
+	if c.BackendFrameDuration > 0 && c.BackendFrameDuration < time.Millisecond {
+		return errors.New("config: backend_frame_duration must be at least 1ms")
+	}
+	if c.BackendJitterBuffer < 0 || (c.BackendJitterBuffer > 0 && c.BackendFrameDuration == 0) {
+		return errors.New("config: backend_jitter_buffer must not be negative and requires backend_frame_duration")
+	}
+	if t := c.AGCTargetDBFS; t != 0 && (t < -40 || t > -3) {
+		return errors.New("config: agc_target_dbfs must be 0 or between -40 and -3")
+	}
+	if c.BackendFailoverAttempts < 0 {
+		return errors.New("config: backend_failover_attempts must not be negative")
+	}
+	if c.BackendFailoverReplay < 0 {
+		return errors.New("config: backend_failover_replay must not be negative")
+	}
+	if c.BackendOutageBuffer < 0 {
+		return errors.New("config: backend_outage_buffer must not be negative")
+	}
+	if c.WakeWordAddr != "" && (c.WakeWordEvent == "" || c.WakeWordWindow <= 0 || c.WakeWordPreroll < 0) {
+		return errors.New("config: wake_word_event must be set, wake_word_window positive and wake_word_preroll not negative")
+	}
+	if c.ASRURL != "" && (c.ASRPreroll < 0 || c.ASRMaxSegment <= 0 || c.ASRTimeout <= 0) {
+		return errors.New("config: asr_preroll must not be negative, asr_max_segment and asr_timeout must be positive")
+	}
+	for _, d := range c.SegmentClips {
+		switch d {
+		case "client", "events":
+		case "recording":
+			if c.RecordDir == "" {
+				return errors.New("config: segment_clips recording requires record_dir")
+			}
+		default:
+			return errors.New("config: segment_clips must list client, recording or events")
+		}
+	}
+	if len(c.SegmentClips) > 0 && (c.ASRPreroll < 0 || c.ASRMaxSegment <= 0) {
+		return errors.New("config: asr_preroll must not be negative and asr_max_segment must be positive")
+	}
+	if c.TTSURL != "" && c.TTSSampleRate <= 0 {
+		return errors.New("config: tts_sample_rate must be positive")
+	}
+	if c.LLMURL != "" && c.ASRURL == "" {
+		return errors.New("config: llm_url requires asr_url")
+	}
+	if c.LLMURL != "" && (c.LLMMaxTurns < 0 || c.LLMTimeout <= 0) {
+		return errors.New("config: llm_max_turns must not be negative and llm_timeout must be positive")
+	}
+	if c.FallbackEnergyThreshold > 0 || c.FallbackEnergyThreshold < -96 {
+		return errors.New("config: fallback_energy_threshold must be between -96 and 0 dBFS")
+	}
+	if c.FallbackZCRThreshold < 0 || c.FallbackZCRThreshold > 1 {
+		return errors.New("config: fallback_zcr_threshold must be between 0 and 1")
+	}
+	if c.FallbackMinSpeech < 0 || c.FallbackMinSilence < 0 {
+		return errors.New("config: fallback_min_speech and fallback_min_silence must not be negative")
+	}
+	if !strings.HasPrefix(c.WSPath, "/") {
+		return errors.New("config: ws_path must start with /")
+	}
+	if c.MaxListeners < 0 {
+		return errors.New("config: max_listeners must not be negative")
+	}
+	if c.SendQueueSize < 1 {
+		return errors.New("config: send_queue_size must be at least 1")
+	}
+	if c.BatchSpeed < 0 {
+		return errors.New("config: batch_speed must not be negative")
+	}
+	if c.RecordMaxFileBytes != 0 && c.RecordMaxFileBytes < 64<<10 {
+		return errors.New("config: record_max_file_bytes must be 0 or at least 65536")
+	}
+	if c.RecordS3Bucket != "" && c.RecordS3Endpoint == "" {
+		return errors.New("config: record_s3_endpoint is required with record_s3_bucket")
+	}
+	if c.RecordS3Retries < 0 {
+		return errors.New("config: record_s3_retries must not be negative")
+	}
+	if c.BillingInterval < 0 {
+		return errors.New("config: billing_interval must not be negative")
+	}
+	if c.BillingInterval > 0 {
+		if c.DBDSN == "" {
+			return errors.New("config: billing_interval requires db_dsn")
+		}
+		if c.BillingInterval < time.Minute {
+			return errors.New("config: billing_interval must be at least 1m")
+		}
+		if c.BillingDir == "" && c.BillingWebhookURL == "" {
+			return errors.New("config: billing_interval needs billing_dir or billing_webhook_url")
+		}
+		for _, f := range c.BillingFormats {
+			if f != "csv" && f != "json" {
+				return fmt.Errorf("config: unknown billing format %q (want csv or json)", f)
+			}
+		}
+	}
+	if u := c.BillingWebhookURL; u != "" && !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+		return errors.New("config: billing_webhook_url must be an http(s) URL")
+	}
+	for _, w := range c.Webhooks {
+		if w.URL == "" {
+			return errors.New("config: webhooks need a url")
+		}
+	}
+	if c.WebhookMaxAttempts < 1 {
+		return errors.New("config: webhook_max_attempts must be at least 1")
+	}
+	if len(c.KafkaBrokers) > 0 && c.KafkaTopic == "" {
+		return errors.New("config: kafka_topic is required with kafka_brokers")
+	}
+	if c.NATSURL != "" && c.NATSSubjectPrefix == "" {
+		return errors.New("config: nats_subject_prefix is required with nats_url")
+	}
+	if c.NATSAudio && c.NATSURL == "" {
+		return errors.New("config: nats_audio requires nats_url")
+	}
+	if c.TwilioPath != "" && (!strings.HasPrefix(c.TwilioPath, "/") || c.TwilioPath == c.WSPath) {
+		return errors.New("config: twilio_path must start with / and differ from ws_path")
+	}
+	if c.SIPAddr != "" {
+		if c.RTPPortMin < 1 || c.RTPPortMax > 65535 || c.RTPPortMin >= c.RTPPortMax {
+			return errors.New("config: rtp_port_min and rtp_port_max must span a range of ports")
+		}
+		if c.RTPTimeout <= 0 {
+			return errors.New("config: rtp_timeout must be positive")
+		}
+		if c.SIPPublicIP != "" && net.ParseIP(c.SIPPublicIP).To4() == nil {
+			return errors.New("config: sip_public_ip must be an IPv4 address")
+		}
+		for _, cidr := range c.SIPAllowedCIDRs {
+			if _, _, err := net.ParseCIDR(cidr); err != nil {
+				return fmt.Errorf("config: sip_allowed_cidrs: %w", err)
+			}
+		}
+	}
+	if c.WebRTCPath != "" && (!strings.HasPrefix(c.WebRTCPath, "/") || c.WebRTCPath == c.WSPath || c.WebRTCPath == c.TwilioPath) {
+		return errors.New("config: webrtc_path must start with / and differ from ws_path and twilio_path")
+	}
+	if c.WebRTCPublicIP != "" && net.ParseIP(c.WebRTCPublicIP) == nil {
+		return errors.New("config: webrtc_public_ip must be an IP address")
+	}
+	if c.MQTTURL != "" && (c.MQTTTopicPrefix == "" || strings.ContainsAny(c.MQTTTopicPrefix, "+#")) {
+		return errors.New("config: mqtt_topic_prefix is required with mqtt_url and may not hold wildcards")
+	}
+	if c.MQTTIdleTimeout < 0 {
+		return errors.New("config: mqtt_idle_timeout must not be negative")
+	}
+	if c.RedisURL != "" && c.RedisChannelPrefix == "" {
+		return errors.New("config: redis_channel_prefix is required with redis_url")
+	}
+	if c.ClusterRedisURL != "" {
+		if c.ClusterKeyPrefix == "" {
+			return errors.New("config: cluster_key_prefix is required with cluster_redis_url")
+		}
+		u, err := url.Parse(c.ClusterAdvertiseURL)
+		if err != nil || (u.Scheme != "ws" && u.Scheme != "wss") || u.Host == "" {
+			return errors.New("config: cluster_advertise_url must be a ws:// or wss:// URL with cluster_redis_url")
+		}
+	}
+	if c.PingInterval > 0 && c.PongTimeout <= 0 {
+		return errors.New("config: pong_timeout must be positive when ping_interval is set")
+	}
+	if c.ResumeWindow < 0 {
+		return errors.New("config: resume_window must not be negative")
+	}
+	if c.QuotaDaily < 0 || c.QuotaMonthly < 0 {
+		return errors.New("config: quota_daily and quota_monthly must not be negative")
+	}
+	tenants := map[string]bool{}
+	for _, t := range c.Tenants {
+		switch {
+		case t.Name == "" || strings.ContainsAny(t.Name, ". :/"):
+			return fmt.Errorf("config: invalid tenant name %q", t.Name)
+		case tenants[t.Name]:
+			return fmt.Errorf("config: tenant %q is listed twice", t.Name)
+		case len(t.BackendAddrs) > 0 && c.VAD != VADGRPC:
+			return fmt.Errorf("config: tenant %q: backend_addrs require vad: grpc", t.Name)
+		case t.QuotaDaily < 0 || t.QuotaMonthly < 0:
+			return fmt.Errorf("config: tenant %q: quotas must not be negative", t.Name)
+		}
+		for _, w := range t.Webhooks {
+			if w.URL == "" {
+				return fmt.Errorf("config: tenant %q: webhooks need a url", t.Name)
+			}
+		}
+		tenants[t.Name] = true
+	}
+	if c.CORSCredentials && slices.Contains(c.CORSOrigins, "*") {
+		return errors.New("config: cors_credentials cannot be combined with cors_origins *")
+	}
+	if len(c.CORSOrigins) > 0 && len(c.CORSMethods) == 0 {
+		return errors.New("config: cors_origins needs cors_methods")
+	}
+	if c.CORSMaxAge < 0 {
+		return errors.New("config: cors_max_age must not be negative")
+	}
+	if c.DebugEndpoints && len(c.AdminAPIKeys) == 0 {
+		return errors.New("config: debug_endpoints needs admin_api_keys")
+	}
+	if c.TenantRequired && len(c.Tenants) == 0 {
+		return errors.New("config: tenant_required needs tenants")
+	}
+	if c.HeartbeatInterval < 0 {
+		return errors.New("config: heartbeat_interval must not be negative")
+	}
+	if c.AudioLevelInterval < 0 {
+		return errors.New("config: audio_level_interval must not be negative")
+	}
+	if c.OTelSampleRatio < 0 || c.OTelSampleRatio > 1 {
+		return errors.New("config: otel_sample_ratio must be between 0 and 1")
+	}
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return errors.New("config: tls_cert_file and tls_key_file must be set together")
+	}
+	if c.TLSCertFile != "" && len(c.TLSAutocertDomains) > 0 {
+		return errors.New("config: tls_cert_file and tls_autocert_domains are mutually exclusive")
+	}
+	if c.HTTPRedirectAddr != "" && !c.TLSEnabled() {
+		return errors.New("config: http_redirect_addr requires TLS")
+	}
+	if c.WebTransportAddr != "" && !c.TLSEnabled() {
+		return errors.New("config: webtransport_addr requires TLS")
+	}
+	return nil
+}
+
+// Backends lists the VAD servers to use.
+func (c *Config) Backends() []string {
+	if len(c.BackendAddrs) > 0 {
+		return c.BackendAddrs
+	}
+	return []string{c.BackendAddr}
+}
+
+// Listeners returns the HTTP listen addresses, ListenAddr first.
+func (c *Config) Listeners() []string {
+	return append([]string{c.ListenAddr}, c.ListenAddrs...)
+}
+
+// TLSEnabled reports whether the listener serves HTTPS.
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCertFile != "" || len(c.TLSAutocertDomains) > 0
+}
+
+func flagName(name string) string { return strings.ReplaceAll(name, "_", "-") }
+func envName(name string) string  { return "VAD_" + strings.ToUpper(name) }
+
+// rawFlag stores the flag's string value so it can be applied after the
+// file and the environment.
+type rawFlag struct {
+	name   string
+	set    map[string]string
+	isBool bool
+}
+
+func (f *rawFlag) String() string     { return f.set[f.name] }
+func (f *rawFlag) IsBoolFlag() bool   { return f.isBool }
+func (f *rawFlag) Set(v string) error { f.set[f.name] = v; return nil }
+
+func isBool(ptr any) bool {
+	_, ok := ptr.(*bool)
+	return ok
+}
+
+// setValue parses v into the setting pointed to by ptr.
+func setValue(ptr any, v string) error {
+	switch p := ptr.(type) {
+	case *string:
+		*p = v
+	case *int:
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		*p = n
+	case *int64:
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return err
+		}
+		*p = n
+	case *float64:
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return err
+		}
+		*p = n
+	case *bool:
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		*p = b
+	case *time.Duration:
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*p = d
+	case *[]string:
+		*p = splitList(v)
+	default:
+		return fmt.Errorf("unsupported setting type %T", ptr)
+	}
+	return nil
+}
+
+func splitList(v string) []string {
+	var out []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
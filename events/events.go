@@ -0,0 +1,137 @@
+// events/events.go
+package events
+
+import "time"
+
+// Event kinds.
+const (
+	// SessionStart is published once the backend stream is open.
+	SessionStart = "session_start"
+	// VAD carries one response from the backend.
+	VAD = "vad"
+	// Segment is published when a speech segment closes, with its Segment.
+	Segment = "segment"
+	// Shadow carries one response from the shadow backend, which the
+	// client never sees.
+	Shadow = "shadow"
+	// Comparison is published before SessionEnd when the session was
+	// compared against a shadow backend, with its Diff.
+	Comparison = "comparison"
+	// WakeWord is published when the wake word lets the session's audio
+	// through to the backend, with the wake-word backend's Message.
+	WakeWord = "wake_word"
+	// Clip carries the Audio of the speech Segment, as a WAV file.
+	Clip = "clip"
+	// Transcript carries the Text transcribed from the speech Segment.
+	Transcript = "transcript"
+	// Assistant carries the Text the assistant replied to the preceding
+	// Transcript.
+	Assistant = "assistant"
+	// DTMF carries a keypad Digit the caller pressed.
+	DTMF = "dtmf"
+	// BargeIn is published when the user spoke over the assistant and its
+	// reply was cancelled.
+	BargeIn = "barge_in"
+	// SessionEnd is published when a started session finishes, with its
+	// Summary.
+	SessionEnd = "session_end"
+)
+
+// Event is something that happened in a session, as handed to sinks.
+type Event struct {
+	Kind      string `json:"kind"`
+	SessionID string `json:"session_id"`
+	Subject   string `json:"subject,omitempty"`
+	Tenant    string `json:"tenant,omitempty"`
+	// Route is "canary" for sessions served by the canary backend.
+	Route string `json:"route,omitempty"`
+	// Source is "fallback" for events of sessions served by the built-in
+	// VAD because no backend was reachable.
+	Source string `json:"source,omitempty"`
+	// Late is set on VAD and Segment events for audio held while the
+	// backend was unavailable.
+	Late bool      `json:"late,omitempty"`
+	Time time.Time `json:"time"`
+	// Offset is how much audio, in seconds, had been sent to the backend.
+	Offset float64 `json:"offset"`
+	// Event and Message are the backend's response, for VAD and Shadow
+	// events.
+	Event   string `json:"event,omitempty"`
+	Message string `json:"message,omitempty"`
+	// Text is set on Transcript and Assistant events.
+	Text string `json:"text,omitempty"`
+	// Digit is set on DTMF events.
+	Digit string `json:"digit,omitempty"`
+	// Segment is set on Segment, Clip and Transcript events.
+	Segment *SpeechSegment `json:"segment,omitempty"`
+	// Audio is set on Clip events.
+	Audio []byte `json:"audio,omitempty"`
+	// Summary is set on SessionEnd events.
+	Summary *Summary `json:"summary,omitempty"`
+	// Diff is set on Comparison events.
+	Diff *Diff `json:"diff,omitempty"`
+}
+
+// SpeechSegment is a span of speech, in seconds of session audio.
+type SpeechSegment struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+// Diff compares the speech the primary and the shadow backend found in the
+// same session's audio. Times are in seconds of session audio.
+type Diff struct {
+	Audio           float64         `json:"audio"`
+	PrimarySegments []SpeechSegment `json:"primary_segments"`
+	ShadowSegments  []SpeechSegment `json:"shadow_segments"`
+	// Matched counts primary segments paired with an overlapping shadow
+	// segment. The deltas are shadow minus primary over the pairs: the
+	// means signed, the maxima absolute.
+	Matched        int     `json:"matched"`
+	MeanStartDelta float64 `json:"mean_start_delta"`
+	MeanEndDelta   float64 `json:"mean_end_delta"`
+	MaxStartDelta  float64 `json:"max_start_delta"`
+	MaxEndDelta    float64 `json:"max_end_delta"`
+	// Disagreements are the windows where only one backend heard speech,
+	// and Agreement the share of the audio outside them.
+	Disagreements []Disagreement `json:"disagreements"`
+	Agreement     float64        `json:"agreement"`
+}
+
+// Disagreement is a window where only the backend named by Speech,
+// "primary" or "shadow", heard speech.
+type Disagreement struct {
+	Start  float64 `json:"start"`
+	End    float64 `json:"end"`
+	Speech string  `json:"speech"`
+}
+
+// Summary describes a finished session.
+type Summary struct {
+	Started time.Time `json:"started"`
+	// Duration is wall-clock time; Audio and Speech are seconds of audio
+	// sent and of it between start and end events.
+	Duration      float64          `json:"duration"`
+	Audio         float64          `json:"audio"`
+	Speech        float64          `json:"speech"`
+	BytesIn       int64            `json:"bytes_in"`
+	BytesOut      int64            `json:"bytes_out"`
+	DroppedChunks int64            `json:"dropped_chunks"`
+	LostChunks    int64            `json:"lost_chunks,omitempty"`
+	Events        map[string]int64 `json:"events"`
+}
+
+// Sink receives events. Publish is called from the session's goroutines and
+// must not block; a slow sink queues or drops.
+type Sink interface {
+	Publish(Event)
+}
+
+// Sinks fans events out to several sinks.
+type Sinks []Sink
+
+func (s Sinks) Publish(e Event) {
+	for _, sink := range s {
+		sink.Publish(e)
+	}
+}
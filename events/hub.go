@@ -0,0 +1,102 @@
+// events/hub.go
+package events
+
+import (
+	"errors"
+	"sync"
+
+	"vad-application/metrics"
+)
+
+// hubBuffer is how many events may wait for a slow viewer before new ones
+// are dropped.
+const hubBuffer = 256
+
+// Hub errors returned by Watch.
+var (
+	ErrHubClosed      = errors.New("events: hub closed")
+	ErrTooManyViewers = errors.New("events: too many viewers for this session")
+)
+
+// Hub relays live events to viewers of a session. It is a Sink; events
+// published while nobody watches are discarded.
+type Hub struct {
+	// limit caps the viewers of one session; zero means no limit.
+	limit int
+
+	mu      sync.Mutex
+	closed  bool
+	viewers map[string]map[chan Event]struct{}
+}
+
+// NewHub returns a hub allowing up to limit viewers per session, or any
+// number if limit is zero.
+func NewHub(limit int) *Hub {
+	return &Hub{limit: limit, viewers: make(map[string]map[chan Event]struct{})}
+}
+
+// Publish hands e to the viewers of its session and, once the session ends,
+// closes their channels.
+func (h *Hub) Publish(e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.viewers[e.SessionID] {
+		select {
+		case ch <- e:
+		default:
+			metrics.SinkDropped.WithLabelValues("viewers").Inc()
+		}
+		if e.Kind == SessionEnd {
+			close(ch)
+		}
+	}
+	if e.Kind == SessionEnd {
+		delete(h.viewers, e.SessionID)
+	}
+}
+
+// Close closes every viewer's channel and refuses new ones.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for id, chs := range h.viewers {
+		for ch := range chs {
+			close(ch)
+		}
+		delete(h.viewers, id)
+	}
+}
+
+// Watch subscribes to the events of session id from now on. The channel is
+// closed after the session's SessionEnd or when the hub closes; stop
+// unsubscribes early and must be called either way.
+func (h *Hub) Watch(id string) (<-chan Event, func(), error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil, nil, ErrHubClosed
+	}
+	if h.limit > 0 && len(h.viewers[id]) >= h.limit {
+		return nil, nil, ErrTooManyViewers
+	}
+	ch := make(chan Event, hubBuffer)
+	if h.viewers[id] == nil {
+		h.viewers[id] = make(map[chan Event]struct{})
+	}
+	h.viewers[id][ch] = struct{}{}
+	return ch, func() { h.unwatch(id, ch) }, nil
+}
+
+func (h *Hub) unwatch(id string, ch chan Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	chs := h.viewers[id]
+	if _, watching := chs[ch]; !watching {
+		return
+	}
+	delete(chs, ch)
+	if len(chs) == 0 {
+		delete(h.viewers, id)
+	}
+}
@@ -23,10 +23,13 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
-// Audio chunk containing raw audio data
+// Audio chunk containing raw audio data, or the stream's settings
 type AudioChunk struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	AudioData     []byte                 `protobuf:"bytes,1,opt,name=audio_data,json=audioData,proto3" json:"audio_data,omitempty"`
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	AudioData []byte                 `protobuf:"bytes,1,opt,name=audio_data,json=audioData,proto3" json:"audio_data,omitempty"`
+	// Sent alone, before any audio, by bridges configured with
+	// backend_stream_config
+	Config        *StreamConfig `protobuf:"bytes,2,opt,name=config,proto3" json:"config,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -68,6 +71,96 @@ func (x *AudioChunk) GetAudioData() []byte {
 	return nil
 }
 
+func (x *AudioChunk) GetConfig() *StreamConfig {
+	if x != nil {
+		return x.Config
+	}
+	return nil
+}
+
+// Endpointing settings the client chose for its stream; zero fields keep
+// the backend's defaults
+type StreamConfig struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Speech needed before a start is reported
+	MinSpeechMs uint32 `protobuf:"varint,1,opt,name=min_speech_ms,json=minSpeechMs,proto3" json:"min_speech_ms,omitempty"`
+	// Silence needed before an end is reported
+	MinSilenceMs uint32 `protobuf:"varint,2,opt,name=min_silence_ms,json=minSilenceMs,proto3" json:"min_silence_ms,omitempty"`
+	// Audio before the detected start that belongs to the segment
+	PrerollMs uint32 `protobuf:"varint,3,opt,name=preroll_ms,json=prerollMs,proto3" json:"preroll_ms,omitempty"`
+	// 0-1; higher reports quieter or shorter speech
+	Sensitivity float32 `protobuf:"fixed32,4,opt,name=sensitivity,proto3" json:"sensitivity,omitempty"`
+	// BCP 47 language tag of the speaker
+	Locale        string `protobuf:"bytes,5,opt,name=locale,proto3" json:"locale,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamConfig) Reset() {
+	*x = StreamConfig{}
+	mi := &file_proto_vad_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamConfig) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamConfig) ProtoMessage() {}
+
+func (x *StreamConfig) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_vad_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamConfig.ProtoReflect.Descriptor instead.
+func (*StreamConfig) Descriptor() ([]byte, []int) {
+	return file_proto_vad_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *StreamConfig) GetMinSpeechMs() uint32 {
+	if x != nil {
+		return x.MinSpeechMs
+	}
+	return 0
+}
+
+func (x *StreamConfig) GetMinSilenceMs() uint32 {
+	if x != nil {
+		return x.MinSilenceMs
+	}
+	return 0
+}
+
+func (x *StreamConfig) GetPrerollMs() uint32 {
+	if x != nil {
+		return x.PrerollMs
+	}
+	return 0
+}
+
+func (x *StreamConfig) GetSensitivity() float32 {
+	if x != nil {
+		return x.Sensitivity
+	}
+	return 0
+}
+
+func (x *StreamConfig) GetLocale() string {
+	if x != nil {
+		return x.Locale
+	}
+	return ""
+}
+
 // VAD response with event type and message
 type VADResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
@@ -79,7 +172,7 @@ type VADResponse struct {
 
 func (x *VADResponse) Reset() {
 	*x = VADResponse{}
-	mi := &file_proto_vad_proto_msgTypes[1]
+	mi := &file_proto_vad_proto_msgTypes[2]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -91,7 +184,7 @@ func (x *VADResponse) String() string {
 func (*VADResponse) ProtoMessage() {}
 
 func (x *VADResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_vad_proto_msgTypes[1]
+	mi := &file_proto_vad_proto_msgTypes[2]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -104,7 +197,7 @@ func (x *VADResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use VADResponse.ProtoReflect.Descriptor instead.
 func (*VADResponse) Descriptor() ([]byte, []int) {
-	return file_proto_vad_proto_rawDescGZIP(), []int{1}
+	return file_proto_vad_proto_rawDescGZIP(), []int{2}
 }
 
 func (x *VADResponse) GetEvent() string {
@@ -130,7 +223,7 @@ type ResetRequest struct {
 
 func (x *ResetRequest) Reset() {
 	*x = ResetRequest{}
-	mi := &file_proto_vad_proto_msgTypes[2]
+	mi := &file_proto_vad_proto_msgTypes[3]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -142,7 +235,7 @@ func (x *ResetRequest) String() string {
 func (*ResetRequest) ProtoMessage() {}
 
 func (x *ResetRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_vad_proto_msgTypes[2]
+	mi := &file_proto_vad_proto_msgTypes[3]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -155,7 +248,7 @@ func (x *ResetRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ResetRequest.ProtoReflect.Descriptor instead.
 func (*ResetRequest) Descriptor() ([]byte, []int) {
-	return file_proto_vad_proto_rawDescGZIP(), []int{2}
+	return file_proto_vad_proto_rawDescGZIP(), []int{3}
 }
 
 // Response from reset request
@@ -168,7 +261,7 @@ type ResetResponse struct {
 
 func (x *ResetResponse) Reset() {
 	*x = ResetResponse{}
-	mi := &file_proto_vad_proto_msgTypes[3]
+	mi := &file_proto_vad_proto_msgTypes[4]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -180,7 +273,7 @@ func (x *ResetResponse) String() string {
 func (*ResetResponse) ProtoMessage() {}
 
 func (x *ResetResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_vad_proto_msgTypes[3]
+	mi := &file_proto_vad_proto_msgTypes[4]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -193,7 +286,7 @@ func (x *ResetResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ResetResponse.ProtoReflect.Descriptor instead.
 func (*ResetResponse) Descriptor() ([]byte, []int) {
-	return file_proto_vad_proto_rawDescGZIP(), []int{3}
+	return file_proto_vad_proto_rawDescGZIP(), []int{4}
 }
 
 func (x *ResetResponse) GetSuccess() bool {
@@ -207,11 +300,19 @@ var File_proto_vad_proto protoreflect.FileDescriptor
 
 const file_proto_vad_proto_rawDesc = "" +
 	"\n" +
-	"\x0fproto/vad.proto\x12\x03vad\"+\n" +
+	"\x0fproto/vad.proto\x12\x03vad\"V\n" +
 	"\n" +
 	"AudioChunk\x12\x1d\n" +
 	"\n" +
-	"audio_data\x18\x01 \x01(\fR\taudioData\"=\n" +
+	"audio_data\x18\x01 \x01(\fR\taudioData\x12)\n" +
+	"\x06config\x18\x02 \x01(\v2\x11.vad.StreamConfigR\x06config\"\xb1\x01\n" +
+	"\fStreamConfig\x12\"\n" +
+	"\rmin_speech_ms\x18\x01 \x01(\rR\vminSpeechMs\x12$\n" +
+	"\x0emin_silence_ms\x18\x02 \x01(\rR\fminSilenceMs\x12\x1d\n" +
+	"\n" +
+	"preroll_ms\x18\x03 \x01(\rR\tprerollMs\x12 \n" +
+	"\vsensitivity\x18\x04 \x01(\x02R\vsensitivity\x12\x16\n" +
+	"\x06locale\x18\x05 \x01(\tR\x06locale\"=\n" +
 	"\vVADResponse\x12\x14\n" +
 	"\x05event\x18\x01 \x01(\tR\x05event\x12\x18\n" +
 	"\amessage\x18\x02 \x01(\tR\amessage\"\x0e\n" +
@@ -235,23 +336,25 @@ func file_proto_vad_proto_rawDescGZIP() []byte {
 	return file_proto_vad_proto_rawDescData
 }
 
-var file_proto_vad_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_proto_vad_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
 var file_proto_vad_proto_goTypes = []any{
 	(*AudioChunk)(nil),    // 0: vad.AudioChunk
-	(*VADResponse)(nil),   // 1: vad.VADResponse
-	(*ResetRequest)(nil),  // 2: vad.ResetRequest
-	(*ResetResponse)(nil), // 3: vad.ResetResponse
+	(*StreamConfig)(nil),  // 1: vad.StreamConfig
+	(*VADResponse)(nil),   // 2: vad.VADResponse
+	(*ResetRequest)(nil),  // 3: vad.ResetRequest
+	(*ResetResponse)(nil), // 4: vad.ResetResponse
 }
 var file_proto_vad_proto_depIdxs = []int32{
-	0, // 0: vad.VADService.ProcessAudio:input_type -> vad.AudioChunk
-	2, // 1: vad.VADService.ResetVAD:input_type -> vad.ResetRequest
-	1, // 2: vad.VADService.ProcessAudio:output_type -> vad.VADResponse
-	3, // 3: vad.VADService.ResetVAD:output_type -> vad.ResetResponse
-	2, // [2:4] is the sub-list for method output_type
-	0, // [0:2] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	1, // 0: vad.AudioChunk.config:type_name -> vad.StreamConfig
+	0, // 1: vad.VADService.ProcessAudio:input_type -> vad.AudioChunk
+	3, // 2: vad.VADService.ResetVAD:input_type -> vad.ResetRequest
+	2, // 3: vad.VADService.ProcessAudio:output_type -> vad.VADResponse
+	4, // 4: vad.VADService.ResetVAD:output_type -> vad.ResetResponse
+	3, // [3:5] is the sub-list for method output_type
+	1, // [1:3] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
 }
 
 func init() { file_proto_vad_proto_init() }
@@ -265,7 +368,7 @@ func file_proto_vad_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_vad_proto_rawDesc), len(file_proto_vad_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   4,
+			NumMessages:   5,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
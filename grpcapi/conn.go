@@ -0,0 +1,225 @@
+// grpcapi/conn.go
+package grpcapi
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	pb "vad-application/grpc_modules"
+	"vad-application/session"
+
+	"connectrpc.com/connect"
+	"github.com/gorilla/websocket"
+)
+
+// SettingsHeader carries a Session call's settings, as the query of a
+// WebSocket URL.
+const SettingsHeader = "X-Session-Settings"
+
+// Conn is a BridgeService call seen as a WebSocket connection, as
+// session.Conn expects. Like a *websocket.Conn, it takes one reader and one
+// writer at a time; WriteControl may be called alongside either.
+type Conn struct {
+	*session.Inbox
+	ctx      context.Context
+	addr     addr
+	header   http.Header
+	settings string
+	send     func(*pb.ServerMessage) error
+
+	// wmu serializes writes. Once closing is set nothing more is written,
+	// and the call ends with code and reason.
+	wmu     sync.Mutex
+	closing bool
+	code    int
+	reason  string
+}
+
+func newConn(ctx context.Context, remoteAddr string, header http.Header, send func(*pb.ServerMessage) error) *Conn {
+	return &Conn{
+		Inbox:    session.NewInbox(16),
+		ctx:      ctx,
+		addr:     addr(remoteAddr),
+		header:   header,
+		settings: strings.Join(header.Values(SettingsHeader), "&"),
+		send:     send,
+		code:     websocket.CloseNormalClosure,
+	}
+}
+
+// addr is the client's address as the HTTP server saw it.
+type addr string
+
+func (a addr) Network() string { return "tcp" }
+func (a addr) String() string  { return string(a) }
+
+// Settings returns the session settings the client chose, as the query of
+// a WebSocket URL.
+func (c *Conn) Settings() string { return c.settings }
+
+// Header returns the call's request header.
+func (c *Conn) Header() http.Header { return c.header }
+
+// Subprotocol returns "": events go out as JSON.
+func (c *Conn) Subprotocol() string { return "" }
+
+func (c *Conn) RemoteAddr() net.Addr { return c.addr }
+
+// WriteMessage sends text messages as events and binary ones as audio.
+func (c *Conn) WriteMessage(messageType int, data []byte) error {
+	var m pb.ServerMessage
+	switch messageType {
+	case websocket.TextMessage:
+		m.Message = &pb.ServerMessage_Event{Event: string(data)}
+	case websocket.BinaryMessage:
+		m.Message = &pb.ServerMessage_Audio{Audio: data}
+	default:
+		return fmt.Errorf("grpcapi: unknown message type %d", messageType)
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closing {
+		return websocket.ErrCloseSent
+	}
+	return c.send(&m)
+}
+
+// WriteControl takes a close message as the status the call ends with, or
+// answers a ping: HTTP/2 notices when the client goes away, so the pong
+// handler runs at once while the call lasts.
+func (c *Conn) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	switch messageType {
+	case websocket.CloseMessage:
+		c.wmu.Lock()
+		defer c.wmu.Unlock()
+		if c.closing {
+			return websocket.ErrCloseSent
+		}
+		c.closing = true
+		c.code, c.reason = websocket.CloseNoStatusReceived, ""
+		if len(data) >= 2 {
+			c.code, c.reason = int(binary.BigEndian.Uint16(data)), string(data[2:])
+		}
+		return nil
+	case websocket.PingMessage:
+		if err := c.ctx.Err(); err != nil {
+			return net.ErrClosed
+		}
+		return c.Pong(string(data))
+	case websocket.PongMessage:
+		return nil
+	}
+	return fmt.Errorf("grpcapi: unknown control message type %d", messageType)
+}
+
+// Close stops further writes; the call ends once its handler returns.
+func (c *Conn) Close() error {
+	c.wmu.Lock()
+	c.closing = true
+	c.wmu.Unlock()
+	return nil
+}
+
+// status is what the call ends with, after the close message sent.
+func (c *Conn) status() error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	var code connect.Code
+	switch c.code {
+	case websocket.CloseNormalClosure:
+		return nil
+	case websocket.CloseGoingAway:
+		code = connect.CodeUnavailable
+	case websocket.CloseTryAgainLater, websocket.CloseMessageTooBig:
+		code = connect.CodeResourceExhausted
+	case websocket.ClosePolicyViolation:
+		code = connect.CodePermissionDenied
+	case websocket.CloseUnsupportedData, websocket.CloseInvalidFramePayloadData, websocket.CloseProtocolError:
+		code = connect.CodeInvalidArgument
+	case websocket.CloseInternalServerErr:
+		code = connect.CodeInternal
+	default:
+		code = connect.CodeUnknown
+	}
+	return connect.NewError(code, errors.New(c.reason))
+}
+
+// read queues the messages of a Session call's stream.
+func (c *Conn) read(recv func() (*pb.ClientMessage, error)) {
+	for {
+		m, err := recv()
+		if err != nil {
+			c.Fail(readError(err))
+			return
+		}
+		if err := c.queue(c.ctx, m); err != nil {
+			// Pushes waiting on the inbox must see the call has ended.
+			c.Fail(readError(c.ctx.Err()))
+			return
+		}
+	}
+}
+
+// push queues the messages of a Send call, then ends the client's side if
+// closing.
+func (c *Conn) push(ctx context.Context, ms []*pb.ClientMessage, closing bool) error {
+	for _, m := range ms {
+		if err := c.queue(ctx, m); err != nil {
+			return err
+		}
+	}
+	if closing {
+		c.Fail(&websocket.CloseError{Code: websocket.CloseNormalClosure})
+	}
+	return nil
+}
+
+// queue hands m to NextReader, failing once the client's side has ended
+// or ctx is done.
+func (c *Conn) queue(ctx context.Context, m *pb.ClientMessage) error {
+	var typ int
+	var data []byte
+	switch p := m.GetMessage().(type) {
+	case *pb.ClientMessage_Audio:
+		typ, data = websocket.BinaryMessage, p.Audio
+	case *pb.ClientMessage_Control:
+		typ, data = websocket.TextMessage, []byte(p.Control)
+	default:
+		return nil
+	}
+	if c.Exceeds(int64(len(data))) {
+		c.Fail(websocket.ErrReadLimit)
+		return connect.NewError(connect.CodeResourceExhausted, websocket.ErrReadLimit)
+	}
+	if err := c.Deliver(ctx, typ, data); err != nil {
+		if ctx.Err() != nil && c.ctx.Err() == nil {
+			return ctx.Err()
+		}
+		return connect.NewError(connect.CodeFailedPrecondition, errStreamClosed)
+	}
+	return nil
+}
+
+// errStreamClosed answers messages sent after the session stopped reading.
+var errStreamClosed = errors.New("stream closed")
+
+// readError turns the error receiving failed with into the one a WebSocket
+// read would: a client closing its side closes normally, and one cancelling
+// the call goes away.
+func readError(err error) error {
+	switch {
+	case errors.Is(err, io.EOF):
+		return &websocket.CloseError{Code: websocket.CloseNormalClosure}
+	case errors.Is(err, context.Canceled), connect.CodeOf(err) == connect.CodeCanceled:
+		return &websocket.CloseError{Code: websocket.CloseGoingAway}
+	}
+	return err
+}
@@ -0,0 +1,113 @@
+// grpcapi/grpcapi.go
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+
+	"vad-application/auth"
+	pb "vad-application/grpc_modules"
+	"vad-application/grpc_modules/vad_applicationconnect"
+
+	"connectrpc.com/connect"
+	"github.com/google/uuid"
+)
+
+// Path is the prefix of the service's HTTP paths, where a Server is mounted.
+const Path = "/" + vad_applicationconnect.BridgeServiceName + "/"
+
+// SendPath is that of Send calls, which carry messages for a session
+// already started rather than start one.
+const SendPath = vad_applicationconnect.BridgeServiceSendProcedure
+
+// maxMessageBytes caps a request message, as gRPC servers do by default.
+const maxMessageBytes = 4 << 20
+
+// errStreamNotFound answers Send calls for a stream that is not open, or
+// was opened by someone else.
+var errStreamNotFound = errors.New("stream not found")
+
+// Handler runs the session of a call until it ends, c standing in for the
+// client's WebSocket. The call's context carries the caller's identity.
+type Handler func(ctx context.Context, c *Conn)
+
+// Server serves the bridge's own service, vad.BridgeService, over gRPC,
+// gRPC-Web and Connect, on an HTTP listener shared with the WebSocket
+// endpoint. A Session call is a session: each ClientMessage is what a
+// WebSocket message from the client would be, audio or a JSON control
+// message, and each ServerMessage one to it. Clients unable to stream
+// requests, as browsers are, call Open instead and Send their messages. A
+// call ends with the status matching the session's close code, after the
+// error event explaining it.
+type Server struct {
+	h    Handler
+	http http.Handler
+
+	mu      sync.Mutex
+	streams map[string]*opened
+}
+
+// opened is a stream started with Open.
+type opened struct {
+	c       *Conn
+	subject string
+}
+
+// NewServer returns a server running sessions with h.
+func NewServer(h Handler) *Server {
+	s := &Server{h: h, streams: map[string]*opened{}}
+	_, s.http = vad_applicationconnect.NewBridgeServiceHandler(s, connect.WithReadMaxBytes(maxMessageBytes))
+	return s
+}
+
+// ServeHTTP serves a call; Session ones require HTTP/2.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.http.ServeHTTP(w, r)
+}
+
+func (s *Server) Session(ctx context.Context, stream *connect.BidiStream[pb.ClientMessage, pb.ServerMessage]) error {
+	c := newConn(ctx, stream.Peer().Addr, stream.RequestHeader(), stream.Send)
+	go c.read(stream.Receive)
+	s.h(ctx, c)
+	return c.status()
+}
+
+func (s *Server) Open(ctx context.Context, req *connect.Request[pb.OpenRequest], stream *connect.ServerStream[pb.ServerMessage]) error {
+	c := newConn(ctx, req.Peer().Addr, req.Header(), stream.Send)
+	c.settings = req.Msg.GetSettings()
+	id := uuid.NewString()
+	s.mu.Lock()
+	s.streams[id] = &opened{c: c, subject: subject(ctx)}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.streams, id)
+		s.mu.Unlock()
+	}()
+	if err := stream.Send(&pb.ServerMessage{Message: &pb.ServerMessage_StreamId{StreamId: id}}); err != nil {
+		return err
+	}
+	s.h(ctx, c)
+	return c.status()
+}
+
+func (s *Server) Send(ctx context.Context, req *connect.Request[pb.SendRequest]) (*connect.Response[pb.SendResponse], error) {
+	s.mu.Lock()
+	o, ok := s.streams[req.Msg.GetStreamId()]
+	s.mu.Unlock()
+	if !ok || o.subject != subject(ctx) {
+		return nil, connect.NewError(connect.CodeNotFound, errStreamNotFound)
+	}
+	if err := o.c.push(ctx, req.Msg.GetMessages(), req.Msg.GetClose()); err != nil {
+		return nil, err
+	}
+	return connect.NewResponse(&pb.SendResponse{}), nil
+}
+
+// subject is the caller's, empty when not authenticated.
+func subject(ctx context.Context) string {
+	id, _ := auth.FromContext(ctx)
+	return id.Subject
+}
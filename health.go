@@ -0,0 +1,75 @@
+// health.go
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"vad-application/admin"
+	"vad-application/backend"
+)
+
+// readyTimeout bounds the backend health check behind /readyz.
+const readyTimeout = 2 * time.Second
+
+// healthz reports that the process is up and serving HTTP.
+func (b *bridge) healthz(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok\n"))
+}
+
+// readyz reports whether new sessions can be served: the bridge is not
+// shutting down or in maintenance, and a VAD backend answers its health
+// check, unless the VAD is embedded.
+func (b *bridge) readyz(w http.ResponseWriter, r *http.Request) {
+	if b.sessions.Draining() {
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	if _, ok := b.sessions.Maintenance(); ok {
+		http.Error(w, "in maintenance", http.StatusServiceUnavailable)
+		return
+	}
+
+	if b.backends == nil {
+		w.Write([]byte("ok\n"))
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+	if err := b.backends.Check(ctx, b.cfg.BackendHealthService); err != nil {
+		b.log.Warn("Readiness check failed", "backends", b.backends.Addrs(), "err", err)
+		http.Error(w, "backend unavailable: "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ok\n"))
+}
+
+// health lists the backends for the admin feed; it is nil when the VAD is
+// embedded.
+func (b *bridge) health() admin.Health {
+	if b.backends == nil {
+		return nil
+	}
+	return func() []admin.Backend {
+		list := describeBackends(b.backends, "primary")
+		if b.canary != nil {
+			list = append(list, describeBackends(b.canary, "canary")...)
+		}
+		return list
+	}
+}
+
+func describeBackends(bal *backend.Balancer, role string) []admin.Backend {
+	var list []admin.Backend
+	for _, be := range bal.Backends() {
+		list = append(list, admin.Backend{
+			Addr:      be.Addr,
+			Role:      role,
+			Healthy:   be.Healthy(),
+			Available: be.Available(),
+			Active:    be.Active(),
+		})
+	}
+	return list
+}
@@ -0,0 +1,315 @@
+// ingest/mqtt.go
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"vad-application/audio"
+	"vad-application/events"
+	"vad-application/metrics"
+	"vad-application/session"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// mqttQuiesce is how long disconnecting waits for events still being
+// published.
+const mqttQuiesce = 250 * time.Millisecond
+
+// MQTTConfig configures the MQTT front end.
+type MQTTConfig struct {
+	// Broker is the broker's URL: tcp://, ssl:// or ws://.
+	Broker   string
+	ClientID string
+	Username string
+	Password string
+	// Prefix starts every topic; it holds no wildcards.
+	Prefix string
+	// Settings are every device's session settings, as the query of a
+	// WebSocket URL.
+	Settings string
+	// Idle ends a device's session after this long without audio; zero
+	// waits forever.
+	Idle time.Duration
+}
+
+// MQTT runs VAD sessions for microphone devices, such as ESP32 boards, that
+// publish their audio over MQTT rather than keep a WebSocket open.
+//
+// A device publishes headerless audio at QoS 0 to <prefix>/<device>/audio,
+// in the format the settings give, and an empty message to end the stream;
+// audio after that starts a new session. Its events, from session_start
+// to session_end, go as JSON to <prefix>/<device>/events, and to the sinks.
+// Every message of a device must reach the same bridge, so topics are not
+// shared between bridges.
+type MQTT struct {
+	cfg      MQTTConfig
+	client   mqtt.Client
+	clients  Clients
+	proc     Processing
+	sink     events.Sink
+	settings session.Settings
+	log      *slog.Logger
+
+	mu      sync.Mutex
+	devices map[string]*mqttDevice
+
+	// stop ends the audio of every session; ctx, once cancelled, their
+	// backend streams.
+	stop     chan struct{}
+	stopOnce sync.Once
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// NewMQTT connects to the broker, reconnecting for as long as the bridge
+// runs, and subscribes to the devices' audio. It doesn't wait for the
+// broker to answer.
+func NewMQTT(cfg MQTTConfig, clients Clients, proc Processing, sink events.Sink, logger *slog.Logger) (*MQTT, error) {
+	if strings.ContainsAny(cfg.Prefix, "+#") {
+		return nil, errors.New("mqtt: topic prefix holds a wildcard")
+	}
+	q, err := url.ParseQuery(cfg.Settings)
+	if err != nil {
+		return nil, fmt.Errorf("mqtt: invalid settings: %w", err)
+	}
+	settings, err := proc.ParseSettings(q)
+	if err != nil {
+		return nil, fmt.Errorf("mqtt: invalid settings: %w", err)
+	}
+	m := &MQTT{
+		cfg:      cfg,
+		clients:  clients,
+		proc:     proc,
+		sink:     sink,
+		settings: settings,
+		log:      logger.With("ingest", "mqtt"),
+		devices:  map[string]*mqttDevice{},
+		stop:     make(chan struct{}),
+	}
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(cfg.Broker).
+		SetClientID(cfg.ClientID).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			m.log.Warn("MQTT disconnected", "err", err)
+		}).
+		// A clean session forgets its subscriptions, so every connection
+		// makes them again.
+		SetOnConnectHandler(func(c mqtt.Client) {
+			t := c.Subscribe(m.topic("+", "audio"), 0, m.audio)
+			if t.Wait() && t.Error() != nil {
+				m.log.Error("MQTT subscribe failed", "err", t.Error())
+				return
+			}
+			m.log.Info("MQTT connected", "broker", cfg.Broker)
+		})
+	m.client = mqtt.NewClient(opts)
+	m.client.Connect()
+	return m, nil
+}
+
+// Close stops taking new sessions, ends the audio of open ones and waits,
+// until ctx expires, for their last events, then disconnects.
+func (m *MQTT) Close(ctx context.Context) error {
+	var err error
+	if t := m.client.Unsubscribe(m.topic("+", "audio")); t.WaitTimeout(time.Second) && t.Error() != nil {
+		err = t.Error()
+	}
+	// Sessions start under mu, so none does after this.
+	m.mu.Lock()
+	m.stopOnce.Do(func() { close(m.stop) })
+	m.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = errors.Join(err, ctx.Err())
+		m.cancel()
+		<-done
+	}
+	m.cancel()
+	m.client.Disconnect(uint(mqttQuiesce.Milliseconds()))
+	return err
+}
+
+func (m *MQTT) topic(device, kind string) string {
+	return m.cfg.Prefix + "/" + device + "/" + kind
+}
+
+// audio hands a device's message to its session, starting one if needed.
+// It runs on the client's only delivery goroutine, so it never waits for a
+// session.
+func (m *MQTT) audio(_ mqtt.Client, msg mqtt.Message) {
+	name, ok := strings.CutSuffix(strings.TrimPrefix(msg.Topic(), m.cfg.Prefix+"/"), "/audio")
+	if !ok {
+		return
+	}
+	data := msg.Payload()
+	m.mu.Lock()
+	d := m.devices[name]
+	if d == nil {
+		select {
+		case <-m.stop:
+			m.mu.Unlock()
+			return
+		default:
+		}
+		if len(data) == 0 {
+			m.mu.Unlock()
+			return
+		}
+		var err error
+		if d, err = m.start(name); err != nil {
+			m.mu.Unlock()
+			m.log.Warn("MQTT session failed to start", "device", name, "err", err)
+			return
+		}
+		m.devices[name] = d
+	}
+	m.mu.Unlock()
+	select {
+	case d.audio <- data:
+	default:
+		if d.dropped.Add(1) == 1 {
+			d.log.Warn("MQTT audio dropped: the session is falling behind")
+		}
+	}
+}
+
+// start opens a session for the device, its backend stream ready before
+// the first audio is read.
+func (m *MQTT) start(name string) (*mqttDevice, error) {
+	pr, pw := io.Pipe()
+	src, err := audio.NewRawSource(pr, m.settings.Format)
+	if err != nil {
+		return nil, err
+	}
+	pipe, err := m.proc.NewPipeline(m.settings)
+	if err != nil {
+		return nil, err
+	}
+	client, err := m.clients.Client()
+	if err != nil {
+		return nil, err
+	}
+
+	id := uuid.NewString()
+	log := m.log.With("device", name, "session_id", id, "format", m.settings.Format.String())
+	ctx, cancel := context.WithCancel(m.ctx)
+	ctx = metadata.AppendToOutgoingContext(ctx, session.MetadataSessionID, id)
+	ctx = metadata.AppendToOutgoingContext(ctx, m.settings.Metadata()...)
+	stream, err := client.ProcessAudio(ctx)
+	if err != nil {
+		cancel()
+		metrics.StreamErrors.WithLabelValues(status.Code(err).String()).Inc()
+		return nil, err
+	}
+	log.Info("MQTT session started")
+
+	d := &mqttDevice{m: m, name: name, audio: make(chan []byte, pendingMessages)}
+	d.stream = newStream(id, d, log)
+	d.publish(events.Event{Kind: events.SessionStart})
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer cancel()
+		go func() {
+			err := d.feed(ctx, pw)
+			m.forget(d)
+			pw.CloseWithError(err)
+		}()
+		go d.pump(stream, src, pipe)
+		d.receive(ctx, stream)
+		// Unblock the feeder and sender if the backend went first.
+		pw.CloseWithError(io.ErrClosedPipe)
+	}()
+	return d, nil
+}
+
+// forget lets the device's next audio start a new session.
+func (m *MQTT) forget(d *mqttDevice) {
+	m.mu.Lock()
+	if m.devices[d.name] == d {
+		delete(m.devices, d.name)
+	}
+	m.mu.Unlock()
+}
+
+// mqttDevice is the session of one device, and the sink of its events.
+type mqttDevice struct {
+	*stream
+	m       *MQTT
+	name    string
+	audio   chan []byte
+	dropped atomic.Int64
+}
+
+// feed copies audio messages into the pipe until an empty one, the idle
+// timeout or shutdown.
+func (d *mqttDevice) feed(ctx context.Context, pw *io.PipeWriter) error {
+	var idle <-chan time.Time
+	var timer *time.Timer
+	if d.m.cfg.Idle > 0 {
+		timer = time.NewTimer(d.m.cfg.Idle)
+		defer timer.Stop()
+		idle = timer.C
+	}
+	for {
+		select {
+		case data := <-d.audio:
+			if len(data) == 0 {
+				return nil
+			}
+			d.bytesIn.Add(int64(len(data)))
+			if _, err := pw.Write(data); err != nil {
+				return nil
+			}
+			if timer != nil {
+				timer.Reset(d.m.cfg.Idle)
+			}
+		case <-idle:
+			d.log.Info("MQTT session idle, ending it")
+			return nil
+		case <-d.m.stop:
+			return nil
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Publish sends e to the device and the sinks.
+func (d *mqttDevice) Publish(e events.Event) {
+	if d.m.sink != nil {
+		d.m.sink.Publish(e)
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	d.m.client.Publish(d.m.topic(d.name, "events"), 1, false, data)
+}
@@ -0,0 +1,254 @@
+// ingest/nats.go
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"sync"
+	"time"
+
+	"vad-application/audio"
+	"vad-application/events"
+	pb "vad-application/grpc_modules"
+	"vad-application/metrics"
+	"vad-application/pipeline"
+	"vad-application/publish"
+	"vad-application/session"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// queueGroup shares start requests between the bridges subscribed to them.
+const queueGroup = "vad-bridge"
+
+// pendingMessages bounds the audio messages waiting for a session's sender;
+// NATS drops past it and reports a slow consumer.
+const pendingMessages = 1024
+
+// Backend events that open and close a speech segment.
+const (
+	eventStart = "start"
+	eventEnd   = "end"
+)
+
+// Clients hands out VAD backend clients; *backend.Pool is one.
+type Clients interface {
+	Client() (pb.VADServiceClient, error)
+}
+
+// Processing parses a session's settings and builds its audio pipeline;
+// *session.Manager is one.
+type Processing interface {
+	ParseSettings(q url.Values) (session.Settings, error)
+	NewPipeline(st session.Settings) (*pipeline.Chain, error)
+}
+
+// StartReply answers a start request.
+type StartReply struct {
+	SessionID     string `json:"session_id,omitempty"`
+	AudioSubject  string `json:"audio_subject,omitempty"`
+	EventsSubject string `json:"events_subject,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// NATS runs VAD sessions for audio published on NATS.
+//
+// A client sends a request to <prefix>.audio.start whose body holds the
+// session settings as a URL query string, as on the WebSocket, and gets a
+// StartReply. It then publishes headerless audio to the reply's
+// AudioSubject and an empty message to end the stream. Events, ending with
+// session_end, are published to the EventsSubject by the NATS event sink.
+type NATS struct {
+	nc      *nats.Conn
+	clients Clients
+	proc    Processing
+	sink    events.Sink
+	prefix  string
+	idle    time.Duration
+	log     *slog.Logger
+	sub     *nats.Subscription
+
+	// stop ends the audio of every session; ctx, once cancelled, their
+	// backend streams.
+	stop     chan struct{}
+	stopOnce sync.Once
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// NewNATS subscribes to start requests. Sessions without audio for idle are
+// ended; zero waits forever.
+func NewNATS(nc *nats.Conn, clients Clients, proc Processing, sink events.Sink, prefix string, idle time.Duration, logger *slog.Logger) (*NATS, error) {
+	n := &NATS{
+		nc:      nc,
+		clients: clients,
+		proc:    proc,
+		sink:    sink,
+		prefix:  prefix,
+		idle:    idle,
+		log:     logger.With("ingest", "nats"),
+		stop:    make(chan struct{}),
+	}
+	n.ctx, n.cancel = context.WithCancel(context.Background())
+	sub, err := nc.QueueSubscribe(prefix+".audio.start", queueGroup, n.start)
+	if err != nil {
+		return nil, fmt.Errorf("nats: %w", err)
+	}
+	n.sub = sub
+	return n, nil
+}
+
+// Close stops taking new sessions, ends the audio of open ones and waits,
+// until ctx expires, for their last events.
+func (n *NATS) Close(ctx context.Context) error {
+	err := n.sub.Unsubscribe()
+	n.stopOnce.Do(func() { close(n.stop) })
+	done := make(chan struct{})
+	go func() {
+		n.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = errors.Join(err, ctx.Err())
+		n.cancel()
+		<-done
+	}
+	n.cancel()
+	return err
+}
+
+func (n *NATS) reply(msg *nats.Msg, r StartReply) {
+	if msg.Reply == "" {
+		return
+	}
+	data, _ := json.Marshal(r)
+	if err := msg.Respond(data); err != nil {
+		n.log.Warn("NATS reply failed", "err", err)
+	}
+}
+
+// start opens a session for a start request. The audio subscription and the
+// backend stream are both open before the reply, so no audio is lost.
+func (n *NATS) start(msg *nats.Msg) {
+	q, err := url.ParseQuery(string(msg.Data))
+	var settings session.Settings
+	if err == nil {
+		settings, err = n.proc.ParseSettings(q)
+	}
+	var pipe *pipeline.Chain
+	var src audio.Source
+	pr, pw := io.Pipe()
+	if err == nil {
+		src, err = audio.NewRawSource(pr, settings.Format)
+	}
+	if err == nil {
+		pipe, err = n.proc.NewPipeline(settings)
+	}
+	if err != nil {
+		n.reply(msg, StartReply{Error: "invalid audio settings: " + err.Error()})
+		return
+	}
+	client, err := n.clients.Client()
+	if err != nil {
+		n.reply(msg, StartReply{Error: "backend unavailable"})
+		return
+	}
+
+	id := uuid.NewString()
+	r := StartReply{
+		SessionID:     id,
+		AudioSubject:  n.prefix + ".audio." + id,
+		EventsSubject: publish.EventsSubject(n.prefix, id),
+	}
+	log := n.log.With("session_id", id, "format", settings.Format.String())
+	ch := make(chan *nats.Msg, pendingMessages)
+	sub, err := n.nc.ChanSubscribe(r.AudioSubject, ch)
+	if err != nil {
+		log.Error("NATS subscribe failed", "err", err)
+		n.reply(msg, StartReply{Error: "subscribe failed"})
+		return
+	}
+
+	ctx, cancel := context.WithCancel(n.ctx)
+	ctx = metadata.AppendToOutgoingContext(ctx, session.MetadataSessionID, id)
+	ctx = metadata.AppendToOutgoingContext(ctx, settings.Metadata()...)
+	stream, err := client.ProcessAudio(ctx)
+	if err != nil {
+		cancel()
+		sub.Unsubscribe()
+		metrics.StreamErrors.WithLabelValues(status.Code(err).String()).Inc()
+		log.Error("Backend stream failed", "err", err)
+		n.reply(msg, StartReply{Error: "backend stream error"})
+		return
+	}
+	n.reply(msg, r)
+	log.Info("NATS session started")
+
+	s := &natsSession{stream: newStream(id, n.sink, log), n: n}
+	s.publish(events.Event{Kind: events.SessionStart})
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		defer cancel()
+		go func() {
+			err := s.feed(ctx, ch, pw)
+			sub.Unsubscribe()
+			pw.CloseWithError(err)
+		}()
+		go s.pump(stream, src, pipe)
+		s.receive(ctx, stream)
+		// Unblock the feeder and sender if the backend went first.
+		pw.CloseWithError(io.ErrClosedPipe)
+	}()
+}
+
+// natsSession is one stream of NATS audio.
+type natsSession struct {
+	*stream
+	n *NATS
+}
+
+// feed copies audio messages into the pipe until an empty one, the idle
+// timeout or shutdown.
+func (s *natsSession) feed(ctx context.Context, ch <-chan *nats.Msg, pw *io.PipeWriter) error {
+	var idle <-chan time.Time
+	var timer *time.Timer
+	if s.n.idle > 0 {
+		timer = time.NewTimer(s.n.idle)
+		defer timer.Stop()
+		idle = timer.C
+	}
+	for {
+		select {
+		case msg := <-ch:
+			if len(msg.Data) == 0 {
+				return nil
+			}
+			s.bytesIn.Add(int64(len(msg.Data)))
+			if _, err := pw.Write(msg.Data); err != nil {
+				return nil
+			}
+			if timer != nil {
+				timer.Reset(s.n.idle)
+			}
+		case <-idle:
+			s.log.Info("NATS session idle, ending it")
+			return nil
+		case <-s.n.stop:
+			return nil
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
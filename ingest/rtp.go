@@ -0,0 +1,133 @@
+// ingest/rtp.go
+package ingest
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"vad-application/audio"
+	"vad-application/events"
+	pb "vad-application/grpc_modules"
+	"vad-application/metrics"
+	"vad-application/pipeline"
+)
+
+// rtpPacket is the part of an RTP packet the bridge uses.
+type rtpPacket struct {
+	pt      int
+	seq     uint16
+	ts      uint32
+	payload []byte
+}
+
+var errBadRTP = errors.New("rtp: malformed packet")
+
+// parseRTP reads an RTP packet, skipping CSRCs, the header extension and
+// padding. The payload aliases b.
+func parseRTP(b []byte) (rtpPacket, error) {
+	if len(b) < 12 || b[0]>>6 != 2 {
+		return rtpPacket{}, errBadRTP
+	}
+	n := 12 + 4*int(b[0]&0x0f)
+	if b[0]&0x10 != 0 {
+		if len(b) < n+4 {
+			return rtpPacket{}, errBadRTP
+		}
+		n += 4 + 4*int(binary.BigEndian.Uint16(b[n+2:]))
+	}
+	end := len(b)
+	if b[0]&0x20 != 0 && end > 0 {
+		end -= int(b[end-1])
+	}
+	if n > end {
+		return rtpPacket{}, errBadRTP
+	}
+	return rtpPacket{
+		pt:      int(b[1] & 0x7f),
+		seq:     binary.BigEndian.Uint16(b[2:]),
+		ts:      binary.BigEndian.Uint32(b[4:]),
+		payload: b[n:end],
+	}, nil
+}
+
+// rtpSequence follows a stream's sequence numbers and timestamps.
+type rtpSequence struct {
+	started bool
+	seq     uint16
+	ts      uint32
+}
+
+// observe notes packet p and returns how many packets before it were lost,
+// and how many samples, at the RTP clock, they held. Late packets, which
+// come after a newer one, and duplicates are reported as such.
+func (q *rtpSequence) observe(p rtpPacket) (lost int, samples uint32, late bool) {
+	if !q.started {
+		q.started, q.seq, q.ts = true, p.seq, p.ts
+		return 0, 0, false
+	}
+	d := p.seq - q.seq
+	if d == 0 || d >= 1<<15 {
+		return 0, 0, true
+	}
+	if d > 1 {
+		lost = int(d - 1)
+		// Lost packets are taken to be as long as the ones around them.
+		samples = (p.ts - q.ts) / uint32(d) * uint32(lost)
+	}
+	q.seq, q.ts = p.seq, p.ts
+	return lost, samples, false
+}
+
+// dtmfEventKeys are the keys of RFC 4733 event codes 0 to 15.
+const dtmfEventKeys = "0123456789*#ABCD"
+
+// dtmfEvent returns the key a telephone-event payload carries.
+func dtmfEvent(payload []byte) (string, bool) {
+	if len(payload) < 4 || int(payload[0]) >= len(dtmfEventKeys) {
+		return "", false
+	}
+	return dtmfEventKeys[payload[0] : payload[0]+1], true
+}
+
+// rtpInput feeds a stream the packets of one RTP source: audio of payload
+// type pt, at clock Hz, and telephone events of dtmfPT, -1 without them.
+type rtpInput struct {
+	s                 *stream
+	pt, dtmfPT, clock int
+
+	seqs     rtpSequence
+	dtmfSeen bool
+	lastDTMF uint32
+}
+
+// packet forwards p's audio, after silence standing in for packets lost
+// before it, or publishes the key it carries. Other payload types are
+// ignored.
+func (in *rtpInput) packet(bs pb.VADService_ProcessAudioClient, pipe *pipeline.Chain, p rtpPacket) error {
+	if p.pt == in.dtmfPT {
+		// An event's packets share its timestamp.
+		if key, ok := dtmfEvent(p.payload); ok && (!in.dtmfSeen || p.ts != in.lastDTMF) {
+			in.dtmfSeen, in.lastDTMF = true, p.ts
+			metrics.DTMFDigits.Inc()
+			in.s.publish(events.Event{Kind: events.DTMF, Offset: in.s.offset(), Digit: key})
+		}
+		return nil
+	}
+	if p.pt != in.pt {
+		return nil
+	}
+	lost, samples, late := in.seqs.observe(p)
+	if late {
+		metrics.SequenceAnomalies.WithLabelValues("late").Inc()
+		return nil
+	}
+	if lost > 0 {
+		metrics.SequenceAnomalies.WithLabelValues("lost").Add(float64(lost))
+		fill := int(int64(samples) * int64(audio.Backend.SampleRate) / int64(in.clock))
+		if err := in.s.fill(bs, pipe, fill); err != nil {
+			return err
+		}
+	}
+	in.s.bytesIn.Add(int64(len(p.payload)))
+	return in.s.forward(bs, pipe, p.payload, false)
+}
@@ -0,0 +1,148 @@
+// ingest/sdp.go
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"vad-application/audio"
+)
+
+// rtpCodec is an audio payload type agreed on in SDP.
+type rtpCodec struct {
+	pt       int
+	name     string
+	clock    int
+	channels int
+	format   audio.Format
+}
+
+// Payload types of the codecs that need no rtpmap.
+var staticCodecs = map[int]string{0: "PCMU/8000", 8: "PCMA/8000"}
+
+// telephoneEvent is the RTP payload of DTMF keys, RFC 4733.
+const telephoneEvent = "telephone-event"
+
+// sdpOffer is what the bridge reads of a caller's SDP offer: the codecs of
+// its audio stream in order of preference and the payload type of
+// telephone events, or -1.
+type sdpOffer struct {
+	codecs []rtpCodec
+	dtmfPT int
+}
+
+// parseOffer reads an SDP offer's first audio stream.
+func parseOffer(body string) (sdpOffer, error) {
+	offer := sdpOffer{dtmfPT: -1}
+	var pts []int
+	rtpmap := map[int]string{}
+	inAudio, seen := false, false
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		switch {
+		case k == "m":
+			fields := strings.Fields(v)
+			inAudio = !seen && len(fields) >= 3 && fields[0] == "audio"
+			if !inAudio {
+				continue
+			}
+			seen = true
+			for _, f := range fields[3:] {
+				if pt, err := strconv.Atoi(f); err == nil {
+					pts = append(pts, pt)
+				}
+			}
+		case k == "a" && inAudio:
+			m, ok := strings.CutPrefix(v, "rtpmap:")
+			if !ok {
+				continue
+			}
+			pt, enc, ok := strings.Cut(m, " ")
+			if n, err := strconv.Atoi(pt); ok && err == nil {
+				rtpmap[n] = strings.TrimSpace(enc)
+			}
+		}
+	}
+	if !seen {
+		return offer, errors.New("sdp: no audio stream")
+	}
+	for _, pt := range pts {
+		enc, ok := rtpmap[pt]
+		if !ok {
+			enc = staticCodecs[pt]
+		}
+		parts := strings.Split(enc, "/")
+		if len(parts) < 2 {
+			continue
+		}
+		name := strings.ToLower(parts[0])
+		clock, _ := strconv.Atoi(parts[1])
+		if name == telephoneEvent {
+			if offer.dtmfPT < 0 {
+				offer.dtmfPT = pt
+			}
+			continue
+		}
+		channels := 1
+		if len(parts) > 2 {
+			channels, _ = strconv.Atoi(parts[2])
+		}
+		c, ok := newCodec(pt, name, clock, channels)
+		if ok {
+			offer.codecs = append(offer.codecs, c)
+		}
+	}
+	if len(offer.codecs) == 0 {
+		return offer, errors.New("sdp: no supported audio codec offered")
+	}
+	return offer, nil
+}
+
+// newCodec returns the codec of an offered payload type, if the bridge can
+// decode it.
+func newCodec(pt int, name string, clock, channels int) (rtpCodec, bool) {
+	c := rtpCodec{pt: pt, name: name, clock: clock, channels: channels}
+	var enc audio.Encoding
+	switch name {
+	case "pcmu":
+		enc = audio.Mulaw
+	case "pcma":
+		enc = audio.Alaw
+	case "opus":
+		// Opus always signals 48000/2; libopus decodes any packet to mono.
+		enc = audio.Opus
+		channels = 1
+	default:
+		return c, false
+	}
+	c.format = audio.Format{SampleRate: clock, Channels: channels}.WithEncoding(enc)
+	return c, c.format.Validate() == nil
+}
+
+// sdpAnswer accepts codec, and telephone events if dtmfPT is not -1, for
+// audio received at ip:port. The bridge only listens.
+func sdpAnswer(ip string, port int, session int64, codec rtpCodec, dtmfPT int) string {
+	pts := strconv.Itoa(codec.pt)
+	if dtmfPT >= 0 {
+		pts += " " + strconv.Itoa(dtmfPT)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "v=0\r\no=vad %d %d IN IP4 %s\r\ns=vad\r\nc=IN IP4 %s\r\nt=0 0\r\n", session, session, ip, ip)
+	fmt.Fprintf(&b, "m=audio %d RTP/AVP %s\r\n", port, pts)
+	fmt.Fprintf(&b, "a=rtpmap:%d %s/%d", codec.pt, strings.ToUpper(codec.name), codec.clock)
+	if codec.name == "opus" {
+		b.WriteString("/2")
+	}
+	b.WriteString("\r\n")
+	if dtmfPT >= 0 {
+		fmt.Fprintf(&b, "a=rtpmap:%d %s/8000\r\na=fmtp:%d 0-15\r\n", dtmfPT, telephoneEvent, dtmfPT)
+	}
+	b.WriteString("a=ptime:20\r\na=recvonly\r\n")
+	return b.String()
+}
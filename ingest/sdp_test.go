@@ -0,0 +1,109 @@
+// ingest/sdp_test.go
+package ingest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"vad-application/audio"
+)
+
+func TestParseOffer(t *testing.T) {
+	type offerTest struct {
+		name    string
+		sdp     string
+		codecs  []string
+		dtmfPT  int
+		wantErr bool
+	}
+	tests := []offerTest{
+		{"static payload types",
+			"v=0\r\nm=audio 4000 RTP/AVP 0 8\r\n",
+			[]string{"0 pcmu/8000", "8 pcma/8000"}, -1, false},
+		{"preference order and telephone events",
+			"v=0\r\nm=audio 4000 RTP/AVP 8 101 0\r\na=rtpmap:8 PCMA/8000\r\na=rtpmap:101 telephone-event/8000\r\na=fmtp:101 0-16\r\n",
+			[]string{"8 pcma/8000", "0 pcmu/8000"}, 101, false},
+		{"dynamic payload type",
+			"m=audio 4000 RTP/AVP 96\na=rtpmap:96 PCMU/8000\n",
+			[]string{"96 pcmu/8000"}, -1, false},
+		{"unsupported codecs skipped",
+			"m=audio 4000 RTP/AVP 9 18 3 0\r\na=rtpmap:9 G722/8000\r\na=rtpmap:18 G729/8000\r\n",
+			[]string{"0 pcmu/8000"}, -1, false},
+		{"first audio stream only",
+			"m=audio 4000 RTP/AVP 0\r\nm=video 5000 RTP/AVP 97\r\na=rtpmap:97 H264/90000\r\nm=audio 6000 RTP/AVP 8\r\na=rtpmap:101 telephone-event/8000\r\n",
+			[]string{"0 pcmu/8000"}, -1, false},
+		{"rtpmap of other streams ignored",
+			"m=video 5000 RTP/AVP 96\r\na=rtpmap:96 PCMU/8000\r\nm=audio 4000 RTP/AVP 96 8\r\n",
+			[]string{"8 pcma/8000"}, -1, false},
+		{"first telephone event type",
+			"m=audio 4000 RTP/AVP 0 101 102\r\na=rtpmap:101 telephone-event/8000\r\na=rtpmap:102 telephone-event/16000\r\n",
+			[]string{"0 pcmu/8000"}, 101, false},
+		{"no audio", "v=0\r\nm=video 5000 RTP/AVP 96\r\n", nil, -1, true},
+		{"no supported codec", "m=audio 4000 RTP/AVP 9 101\r\na=rtpmap:101 telephone-event/8000\r\n", nil, -1, true},
+		{"malformed media line", "m=audio 4000\r\n", nil, -1, true},
+		{"empty", "", nil, -1, true},
+	}
+	// Opus is only offered back in builds that decode it.
+	if (audio.Format{SampleRate: 48000, Channels: 1}.WithEncoding(audio.Opus)).Validate() == nil {
+		tests = append(tests, offerTest{"opus",
+			"m=audio 4000 RTP/AVP 111 0\r\na=rtpmap:111 opus/48000/2\r\n",
+			[]string{"111 opus/48000", "0 pcmu/8000"}, -1, false})
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offer, err := parseOffer(tt.sdp)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseOffer took %q", tt.sdp)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, c := range offer.codecs {
+				got = append(got, fmt.Sprintf("%d %s/%d", c.pt, c.name, c.clock))
+				if c.format.Channels != 1 {
+					t.Errorf("codec %d decodes to %d channels, want 1", c.pt, c.format.Channels)
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tt.codecs, ",") {
+				t.Errorf("codecs = %v, want %v", got, tt.codecs)
+			}
+			if offer.dtmfPT != tt.dtmfPT {
+				t.Errorf("telephone event type = %d, want %d", offer.dtmfPT, tt.dtmfPT)
+			}
+		})
+	}
+}
+
+func TestSDPAnswer(t *testing.T) {
+	offer, err := parseOffer("m=audio 4000 RTP/AVP 8 101\r\na=rtpmap:101 telephone-event/8000\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	answer := sdpAnswer("192.0.2.1", 10002, 42, offer.codecs[0], offer.dtmfPT)
+	for _, want := range []string{
+		"c=IN IP4 192.0.2.1\r\n",
+		"m=audio 10002 RTP/AVP 8 101\r\n",
+		"a=rtpmap:8 PCMA/8000\r\n",
+		"a=rtpmap:101 telephone-event/8000\r\n",
+		"a=recvonly\r\n",
+	} {
+		if !strings.Contains(answer, want) {
+			t.Errorf("answer lacks %q:\n%s", want, answer)
+		}
+	}
+	// The answer reads back as the codecs it accepted.
+	back, err := parseOffer(answer)
+	if err != nil || len(back.codecs) != 1 || back.codecs[0].pt != 8 || back.dtmfPT != 101 {
+		t.Errorf("answer parses back as %+v, %v", back, err)
+	}
+
+	noDTMF := sdpAnswer("192.0.2.1", 10002, 42, offer.codecs[0], -1)
+	if strings.Contains(noDTMF, telephoneEvent) || !strings.Contains(noDTMF, "m=audio 10002 RTP/AVP 8\r\n") {
+		t.Errorf("answer without telephone events:\n%s", noDTMF)
+	}
+}
@@ -0,0 +1,611 @@
+// ingest/sip.go
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"vad-application/events"
+	pb "vad-application/grpc_modules"
+	"vad-application/metrics"
+	"vad-application/pipeline"
+	"vad-application/session"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// sipAllow lists the methods the SIP listener answers.
+const sipAllow = "INVITE, ACK, BYE, CANCEL, OPTIONS"
+
+// SIPConfig configures a SIP listener.
+type SIPConfig struct {
+	// Addr is the UDP address SIP requests arrive on.
+	Addr string
+	// RTPPortMin and RTPPortMax bound the UDP ports calls' audio is
+	// received on, one per call.
+	RTPPortMin, RTPPortMax int
+	// PublicIP is the address put in SDP answers; empty uses the one the
+	// caller reached.
+	PublicIP string
+	// RTPTimeout ends calls whose audio stops without a BYE.
+	RTPTimeout time.Duration
+	// AllowedNets, when set, are the only networks SIP requests and RTP
+	// audio are taken from; anything else is dropped unanswered.
+	AllowedNets []*net.IPNet
+}
+
+// Capacity admits calls against the bridge's session limit;
+// *session.Manager is one.
+type Capacity interface {
+	Reserve() (release func(), err error)
+}
+
+// SIP answers SIP calls over UDP and runs the VAD on their RTP audio, for
+// PBXes to send calls to directly.
+//
+// Every INVITE is answered at once with an SDP answer accepting the
+// caller's first PCMU, PCMA or Opus payload type, and telephone events,
+// which are published as dtmf events. The audio goes through the VAD
+// pipeline like a WebSocket session's, its events published to the sinks
+// under the Call-ID; parameters of the request URI, as in
+// sip:vad@bridge;min_silence_ms=300, are read as session settings. The
+// bridge never sends audio, and a call ends with a BYE or once its audio
+// stops for RTPTimeout.
+//
+// Calls count against the bridge's session limit, and are refused with a
+// 503 when it is reached. The listener has no authentication of its own:
+// expose it only to trusted PBXes, or restrict it with AllowedNets.
+type SIP struct {
+	cfg      SIPConfig
+	conn     *net.UDPConn
+	clients  Clients
+	proc     Processing
+	capacity Capacity
+	sink     events.Sink
+	log      *slog.Logger
+
+	mu    sync.Mutex
+	calls map[string]*sipCall
+	ports map[int]bool
+
+	// stop ends every call; ctx, once cancelled, their backend streams.
+	stop     chan struct{}
+	stopOnce sync.Once
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// NewSIP starts listening for SIP requests.
+func NewSIP(cfg SIPConfig, clients Clients, proc Processing, capacity Capacity, sink events.Sink, logger *slog.Logger) (*SIP, error) {
+	addr, err := net.ResolveUDPAddr("udp", cfg.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("sip: %w", err)
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("sip: %w", err)
+	}
+	s := &SIP{
+		cfg:      cfg,
+		conn:     conn,
+		clients:  clients,
+		proc:     proc,
+		capacity: capacity,
+		sink:     sink,
+		log:      logger.With("ingest", "sip"),
+		calls:    map[string]*sipCall{},
+		ports:    map[int]bool{},
+		stop:     make(chan struct{}),
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Addr returns the address the listener is bound to.
+func (s *SIP) Addr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+// Close stops answering, ends every call and waits, until ctx expires, for
+// their last events.
+func (s *SIP) Close(ctx context.Context) error {
+	s.stopOnce.Do(func() { close(s.stop) })
+	err := s.conn.Close()
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = errors.Join(err, ctx.Err())
+		s.cancel()
+		<-done
+	}
+	s.cancel()
+	return err
+}
+
+func (s *SIP) serve() {
+	defer s.wg.Done()
+	buf := make([]byte, 65535)
+	for {
+		n, src, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-s.stop:
+				return
+			default:
+			}
+			s.log.Warn("SIP read failed", "err", err)
+			continue
+		}
+		if !s.allowed(src.IP) {
+			s.log.Debug("Ignoring SIP message from outside the allowed networks", "remote_addr", src.String())
+			continue
+		}
+		msg, err := parseSIP(buf[:n])
+		if err != nil {
+			s.log.Debug("Ignoring malformed SIP message", "remote_addr", src.String(), "err", err)
+			continue
+		}
+		if msg.method != "" {
+			s.handle(msg, src)
+		}
+	}
+}
+
+func (s *SIP) handle(req *sipMessage, src *net.UDPAddr) {
+	id := req.get("Call-ID")
+	s.mu.Lock()
+	call := s.calls[id]
+	s.mu.Unlock()
+	switch req.method {
+	case "INVITE":
+		if call != nil {
+			// A retransmission, or a re-INVITE: the answer stands.
+			s.send(call.answer(req), src)
+			return
+		}
+		s.invite(req, src)
+	case "ACK":
+	case "BYE":
+		tag := ""
+		if call != nil {
+			tag = call.tag
+			call.hangUp()
+		}
+		s.send(req.response(200, "OK", tag, nil, ""), src)
+	case "CANCEL":
+		// Calls are answered at once, so there is nothing to cancel.
+		s.send(req.response(200, "OK", "", nil, ""), src)
+	case "OPTIONS":
+		s.send(req.response(200, "OK", "", [][2]string{{"Allow", sipAllow}}, ""), src)
+	default:
+		s.send(req.response(405, "Method Not Allowed", "", [][2]string{{"Allow", sipAllow}}, ""), src)
+	}
+}
+
+// allowed reports whether packets from ip are taken.
+func (s *SIP) allowed(ip net.IP) bool {
+	if len(s.cfg.AllowedNets) == 0 {
+		return true
+	}
+	for _, n := range s.cfg.AllowedNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// invite answers a new call and starts receiving its audio. The backend
+// stream is opened by the call's goroutine, after the answer, so a slow
+// backend holds up no other SIP request.
+func (s *SIP) invite(req *sipMessage, src *net.UDPAddr) {
+	id := req.get("Call-ID")
+	reject := func(code int, reason string, err error) {
+		s.log.Warn("SIP call rejected", "call_id", id, "remote_addr", src.String(), "status", code, "err", err)
+		s.send(req.response(code, reason, "", nil, ""), src)
+	}
+	select {
+	case <-s.stop:
+		reject(503, "Service Unavailable", errors.New("shutting down"))
+		return
+	default:
+	}
+	offer, err := parseOffer(string(req.body))
+	if err != nil {
+		reject(488, "Not Acceptable Here", err)
+		return
+	}
+	release, err := s.capacity.Reserve()
+	if err != nil {
+		reject(503, "Service Unavailable", err)
+		return
+	}
+	codec := offer.codecs[0]
+	settings, err := s.proc.ParseSettings(uriParams(req.uri))
+	if err == nil {
+		settings.Format = codec.format
+		err = settings.Options().Validate(settings.Format)
+	}
+	var pipe *pipeline.Chain
+	if err == nil {
+		pipe, err = s.proc.NewPipeline(settings)
+	}
+	if err != nil {
+		release()
+		reject(488, "Not Acceptable Here", err)
+		return
+	}
+	client, err := s.clients.Client()
+	if err != nil {
+		release()
+		reject(503, "Service Unavailable", err)
+		return
+	}
+	rtp, port, err := s.listenRTP()
+	if err != nil {
+		release()
+		reject(503, "Service Unavailable", err)
+		return
+	}
+
+	log := s.log.With("session_id", id, "remote_addr", src.String(), "format", settings.Format.String())
+
+	ip := s.cfg.PublicIP
+	if ip == "" {
+		ip = localIP(src)
+	}
+	call := &sipCall{
+		stream: newStream(id, s.sink, log),
+		s:      s,
+		rtp:    rtp,
+		port:   port,
+		codec:  codec,
+		dtmfPT: offer.dtmfPT,
+		tag:    strconv.FormatUint(rand.Uint64(), 36),
+		sdp:    sdpAnswer(ip, port, time.Now().Unix(), codec, offer.dtmfPT),
+		addr:   net.JoinHostPort(ip, strconv.Itoa(s.conn.LocalAddr().(*net.UDPAddr).Port)),
+		ended:  make(chan struct{}),
+	}
+	s.mu.Lock()
+	s.calls[id] = call
+	s.mu.Unlock()
+	s.send(call.answer(req), src)
+	log.Info("SIP call answered", "codec", codec.name, "rtp_port", port, "from", req.get("From"))
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer release()
+		ctx, cancel := context.WithCancel(s.ctx)
+		defer cancel()
+		ctx = metadata.AppendToOutgoingContext(ctx, session.MetadataSessionID, id)
+		ctx = metadata.AppendToOutgoingContext(ctx, settings.Metadata()...)
+		if bs, err := client.ProcessAudio(ctx); err != nil {
+			metrics.StreamErrors.WithLabelValues(status.Code(err).String()).Inc()
+			log.Error("Backend stream failed", "err", err)
+			s.send(call.bye(req), src)
+		} else {
+			call.run(ctx, bs, pipe)
+		}
+		s.mu.Lock()
+		delete(s.calls, id)
+		s.mu.Unlock()
+		s.releaseRTP(rtp, port)
+	}()
+}
+
+// listenRTP opens a free port of the range for a call's audio.
+func (s *SIP) listenRTP() (*net.UDPConn, int, error) {
+	ip := s.conn.LocalAddr().(*net.UDPAddr).IP
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// RTP takes even ports, leaving odd ones to RTCP.
+	for port := s.cfg.RTPPortMin + s.cfg.RTPPortMin%2; port <= s.cfg.RTPPortMax; port += 2 {
+		if s.ports[port] {
+			continue
+		}
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: ip, Port: port})
+		if err != nil {
+			continue
+		}
+		s.ports[port] = true
+		return conn, port, nil
+	}
+	return nil, 0, errors.New("sip: no free RTP port")
+}
+
+func (s *SIP) releaseRTP(conn *net.UDPConn, port int) {
+	conn.Close()
+	s.mu.Lock()
+	delete(s.ports, port)
+	s.mu.Unlock()
+}
+
+func (s *SIP) send(b []byte, to *net.UDPAddr) {
+	if _, err := s.conn.WriteToUDP(b, to); err != nil {
+		s.log.Debug("SIP response not sent", "remote_addr", to.String(), "err", err)
+	}
+}
+
+// sipCall is one answered call.
+type sipCall struct {
+	*stream
+	s      *SIP
+	rtp    *net.UDPConn
+	port   int
+	codec  rtpCodec
+	dtmfPT int
+	tag    string
+	sdp    string
+	// addr is the bridge's SIP address as the caller reaches it.
+	addr string
+
+	ended   chan struct{}
+	endOnce sync.Once
+}
+
+// answer is the 200 OK the call's INVITE gets.
+func (c *sipCall) answer(req *sipMessage) []byte {
+	return req.response(200, "OK", c.tag, [][2]string{
+		{"Contact", "<sip:vad@" + c.addr + ">"},
+		{"Allow", sipAllow},
+		{"Content-Type", "application/sdp"},
+	}, c.sdp)
+}
+
+// bye is the BYE hanging up the call req opened.
+func (c *sipCall) bye(req *sipMessage) []byte {
+	target := req.get("Contact")
+	if i, j := strings.IndexByte(target, '<'), strings.IndexByte(target, '>'); i >= 0 && j > i {
+		target = target[i+1 : j]
+	}
+	if target == "" {
+		target = req.uri
+	}
+	to := req.get("To")
+	if !strings.Contains(to, ";tag=") {
+		to += ";tag=" + c.tag
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "BYE %s SIP/2.0\r\n", target)
+	fmt.Fprintf(&b, "Via: SIP/2.0/UDP %s;branch=z9hG4bK%s\r\n", c.addr, strconv.FormatUint(rand.Uint64(), 36))
+	b.WriteString("Max-Forwards: 70\r\n")
+	fmt.Fprintf(&b, "From: %s\r\n", to)
+	fmt.Fprintf(&b, "To: %s\r\n", req.get("From"))
+	fmt.Fprintf(&b, "Call-ID: %s\r\n", req.get("Call-ID"))
+	b.WriteString("CSeq: 1 BYE\r\n")
+	b.WriteString("Content-Length: 0\r\n\r\n")
+	return []byte(b.String())
+}
+
+// hangUp ends the call's audio.
+func (c *sipCall) hangUp() {
+	c.endOnce.Do(func() {
+		close(c.ended)
+		c.rtp.SetReadDeadline(time.Now())
+	})
+}
+
+// run forwards the call's audio until it ends, then waits for the
+// backend's last events.
+func (c *sipCall) run(ctx context.Context, bs pb.VADService_ProcessAudioClient, pipe *pipeline.Chain) {
+	c.publish(events.Event{Kind: events.SessionStart})
+	received := make(chan struct{})
+	go func() {
+		defer close(received)
+		c.receive(ctx, bs)
+	}()
+	go func() {
+		select {
+		case <-c.s.stop:
+			c.log.Info("Ending SIP call: shutting down")
+			c.hangUp()
+		case <-received:
+			// The backend went first.
+			c.hangUp()
+		case <-c.ended:
+		}
+	}()
+
+	c.relay(bs, pipe)
+	if err := c.forward(bs, pipe, nil, true); err != nil {
+		c.log.Debug("Last audio not sent", "err", err)
+	}
+	bs.CloseSend()
+	<-received
+}
+
+// relay forwards RTP audio until the call is hung up or goes quiet.
+func (c *sipCall) relay(bs pb.VADService_ProcessAudioClient, pipe *pipeline.Chain) {
+	buf := make([]byte, 1500)
+	in := rtpInput{s: c.stream, pt: c.codec.pt, dtmfPT: c.dtmfPT, clock: c.codec.clock}
+	for {
+		c.rtp.SetReadDeadline(time.Now().Add(c.s.cfg.RTPTimeout))
+		select {
+		case <-c.ended:
+			return
+		default:
+		}
+		n, from, err := c.rtp.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-c.ended:
+			default:
+				c.log.Info("Ending SIP call: no audio", "err", err)
+			}
+			return
+		}
+		if !c.s.allowed(from.IP) {
+			continue
+		}
+		p, err := parseRTP(buf[:n])
+		if err != nil {
+			continue
+		}
+		if err := in.packet(bs, pipe, p); err != nil {
+			return
+		}
+	}
+}
+
+// localIP returns the local address packets to remote leave from.
+func localIP(remote *net.UDPAddr) string {
+	conn, err := net.DialUDP("udp", nil, remote)
+	if err != nil {
+		return "127.0.0.1"
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP.String()
+}
+
+// uriParams returns the ;name=value parameters of a SIP URI.
+func uriParams(uri string) url.Values {
+	q := url.Values{}
+	uri, _, _ = strings.Cut(uri, "?")
+	parts := strings.Split(uri, ";")
+	for _, p := range parts[1:] {
+		k, v, _ := strings.Cut(p, "=")
+		if k, err := url.QueryUnescape(k); err == nil {
+			v, _ = url.QueryUnescape(v)
+			q.Set(k, v)
+		}
+	}
+	return q
+}
+
+// sipMessage is a parsed SIP request or response.
+type sipMessage struct {
+	method, uri string
+	status      int
+	headers     [][2]string
+	body        []byte
+}
+
+// sipCompact maps compact and lowercased header names to the names the
+// bridge uses.
+var sipCompact = map[string]string{
+	"v": "Via", "via": "Via",
+	"f": "From", "from": "From",
+	"t": "To", "to": "To",
+	"i": "Call-ID", "call-id": "Call-ID",
+	"m": "Contact", "contact": "Contact",
+	"l": "Content-Length", "content-length": "Content-Length",
+	"c": "Content-Type", "content-type": "Content-Type",
+	"cseq": "CSeq",
+}
+
+var errBadSIP = errors.New("sip: malformed message")
+
+func parseSIP(b []byte) (*sipMessage, error) {
+	head, body, ok := bytes.Cut(b, []byte("\r\n\r\n"))
+	if !ok {
+		return nil, errBadSIP
+	}
+	lines := strings.Split(string(head), "\r\n")
+	start := strings.SplitN(lines[0], " ", 3)
+	if len(start) < 3 {
+		return nil, errBadSIP
+	}
+	m := &sipMessage{}
+	if strings.HasPrefix(start[0], "SIP/") {
+		code, err := strconv.Atoi(start[1])
+		if err != nil {
+			return nil, errBadSIP
+		}
+		m.status = code
+	} else {
+		if !strings.HasPrefix(start[2], "SIP/") {
+			return nil, errBadSIP
+		}
+		m.method, m.uri = start[0], start[1]
+	}
+	for _, line := range lines[1:] {
+		if line == "" {
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			// A folded continuation of the previous header.
+			if len(m.headers) > 0 {
+				m.headers[len(m.headers)-1][1] += " " + strings.TrimSpace(line)
+			}
+			continue
+		}
+		k, v, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, errBadSIP
+		}
+		k = strings.TrimSpace(k)
+		if name, ok := sipCompact[strings.ToLower(k)]; ok {
+			k = name
+		}
+		m.headers = append(m.headers, [2]string{k, strings.TrimSpace(v)})
+	}
+	if l := m.get("Content-Length"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n > len(body) {
+			return nil, errBadSIP
+		}
+		body = body[:n]
+	}
+	m.body = body
+	if m.get("Call-ID") == "" || m.get("CSeq") == "" {
+		return nil, errBadSIP
+	}
+	return m, nil
+}
+
+// get returns the first value of the header.
+func (m *sipMessage) get(name string) string {
+	for _, h := range m.headers {
+		if strings.EqualFold(h[0], name) {
+			return h[1]
+		}
+	}
+	return ""
+}
+
+// response builds the response to m, adding tag to its To header if it has
+// none, then the extra headers and body.
+func (m *sipMessage) response(code int, reason, tag string, extra [][2]string, body string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "SIP/2.0 %d %s\r\n", code, reason)
+	for _, h := range m.headers {
+		switch h[0] {
+		case "Via", "From", "Call-ID", "CSeq":
+			fmt.Fprintf(&b, "%s: %s\r\n", h[0], h[1])
+		case "To":
+			v := h[1]
+			if tag == "" && code > 100 {
+				tag = strconv.FormatUint(rand.Uint64(), 36)
+			}
+			if !strings.Contains(v, ";tag=") {
+				v += ";tag=" + tag
+			}
+			fmt.Fprintf(&b, "To: %s\r\n", v)
+		}
+	}
+	for _, h := range extra {
+		fmt.Fprintf(&b, "%s: %s\r\n", h[0], h[1])
+	}
+	fmt.Fprintf(&b, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return []byte(b.String())
+}
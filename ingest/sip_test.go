@@ -0,0 +1,163 @@
+// ingest/sip_test.go
+package ingest
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+const sipInvite = "INVITE sip:vad@10.0.0.1;min_silence_ms=300 SIP/2.0\r\n" +
+	"Via: SIP/2.0/UDP 10.0.0.2:5060;branch=z9hG4bK776asdhds\r\n" +
+	"Max-Forwards: 70\r\n" +
+	"To: <sip:vad@10.0.0.1>\r\n" +
+	"From: \"PBX\" <sip:pbx@10.0.0.2>;tag=1928301774\r\n" +
+	"Call-ID: a84b4c76e66710@pbx\r\n" +
+	"CSeq: 314159 INVITE\r\n" +
+	"Contact: <sip:pbx@10.0.0.2:5060>\r\n" +
+	"Content-Type: application/sdp\r\n" +
+	"Content-Length: 5\r\n" +
+	"\r\n" +
+	"v=0\r\n"
+
+func TestParseSIP(t *testing.T) {
+	m, err := parseSIP([]byte(sipInvite))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.method != "INVITE" || m.uri != "sip:vad@10.0.0.1;min_silence_ms=300" || m.status != 0 {
+		t.Errorf("request line = %q %q %d", m.method, m.uri, m.status)
+	}
+	if got := m.get("call-id"); got != "a84b4c76e66710@pbx" {
+		t.Errorf("Call-ID = %q", got)
+	}
+	if got := string(m.body); got != "v=0\r\n" {
+		t.Errorf("body = %q, want the Content-Length bytes", got)
+	}
+
+	tests := []struct {
+		name    string
+		in      string
+		check   func(*sipMessage) bool
+		wantErr bool
+	}{
+		{"compact headers", "BYE sip:vad@h SIP/2.0\r\ni: abc\r\nCSeq: 2 BYE\r\nf: <sip:a@b>\r\n\r\n",
+			func(m *sipMessage) bool { return m.get("Call-ID") == "abc" && m.get("From") == "<sip:a@b>" }, false},
+		{"folded header", "OPTIONS sip:vad@h SIP/2.0\r\nCall-ID: abc\r\nCSeq: 1 OPTIONS\r\nVia: SIP/2.0/UDP h\r\n ;branch=z9hG4bKx\r\n\r\n",
+			func(m *sipMessage) bool { return m.get("Via") == "SIP/2.0/UDP h ;branch=z9hG4bKx" }, false},
+		{"response", "SIP/2.0 200 OK\r\nCall-ID: abc\r\nCSeq: 1 BYE\r\n\r\n",
+			func(m *sipMessage) bool { return m.status == 200 && m.method == "" }, false},
+		{"body past content length", "ACK sip:vad@h SIP/2.0\r\nCall-ID: abc\r\nCSeq: 1 ACK\r\nl: 2\r\n\r\nabcdef",
+			func(m *sipMessage) bool { return string(m.body) == "ab" }, false},
+		{"content length past body", "ACK sip:vad@h SIP/2.0\r\nCall-ID: abc\r\nCSeq: 1 ACK\r\nContent-Length: 50\r\n\r\nabc", nil, true},
+		{"bad content length", "ACK sip:vad@h SIP/2.0\r\nCall-ID: abc\r\nCSeq: 1 ACK\r\nContent-Length: x\r\n\r\n", nil, true},
+		{"no call id", "OPTIONS sip:vad@h SIP/2.0\r\nCSeq: 1 OPTIONS\r\n\r\n", nil, true},
+		{"no cseq", "OPTIONS sip:vad@h SIP/2.0\r\nCall-ID: abc\r\n\r\n", nil, true},
+		{"no blank line", "OPTIONS sip:vad@h SIP/2.0\r\nCall-ID: abc\r\nCSeq: 1 OPTIONS\r\n", nil, true},
+		{"not sip", "GET / HTTP/1.1\r\nCall-ID: abc\r\nCSeq: 1 GET\r\n\r\n", nil, true},
+		{"short start line", "OPTIONS\r\nCall-ID: abc\r\nCSeq: 1 OPTIONS\r\n\r\n", nil, true},
+		{"bad status", "SIP/2.0 OK fine\r\nCall-ID: abc\r\nCSeq: 1 BYE\r\n\r\n", nil, true},
+		{"header without colon", "OPTIONS sip:vad@h SIP/2.0\r\nCall-ID abc\r\nCSeq: 1 OPTIONS\r\n\r\n", nil, true},
+		{"empty", "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := parseSIP([]byte(tt.in))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseSIP took %q", tt.in)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.check(m) {
+				t.Errorf("parseSIP(%q) = %+v", tt.in, m)
+			}
+		})
+	}
+}
+
+func TestSIPResponse(t *testing.T) {
+	req, err := parseSIP([]byte(sipInvite))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := parseSIP(req.response(200, "OK", "xyz", [][2]string{{"Contact", "<sip:vad@10.0.0.1:5060>"}}, "v=0\r\n"))
+	if err != nil {
+		t.Fatalf("response does not parse: %v", err)
+	}
+	for _, h := range []string{"Via", "From", "Call-ID", "CSeq"} {
+		if resp.get(h) != req.get(h) {
+			t.Errorf("%s = %q, want the request's %q", h, resp.get(h), req.get(h))
+		}
+	}
+	if got, want := resp.get("To"), req.get("To")+";tag=xyz"; got != want {
+		t.Errorf("To = %q, want %q", got, want)
+	}
+	if resp.status != 200 || resp.get("Contact") == "" || string(resp.body) != "v=0\r\n" {
+		t.Errorf("response = %+v", resp)
+	}
+	// Final responses always get a tag.
+	busy, _ := parseSIP(req.response(503, "Service Unavailable", "", nil, ""))
+	if to := busy.get("To"); !strings.Contains(to, ";tag=") || strings.HasSuffix(to, ";tag=") {
+		t.Errorf("503 To = %q, want a generated tag", to)
+	}
+}
+
+func TestSIPBye(t *testing.T) {
+	req, err := parseSIP([]byte(sipInvite))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &sipCall{tag: "xyz", addr: "10.0.0.1:5060"}
+	bye, err := parseSIP(c.bye(req))
+	if err != nil {
+		t.Fatalf("BYE does not parse: %v", err)
+	}
+	if bye.method != "BYE" || bye.uri != "sip:pbx@10.0.0.2:5060" {
+		t.Errorf("request line = %s %s, want BYE to the caller's contact", bye.method, bye.uri)
+	}
+	if bye.get("From") != req.get("To")+";tag=xyz" || bye.get("To") != req.get("From") {
+		t.Errorf("From = %q, To = %q; want the INVITE's swapped", bye.get("From"), bye.get("To"))
+	}
+	if bye.get("Call-ID") != req.get("Call-ID") || !strings.Contains(bye.get("Via"), "10.0.0.1:5060;branch=z9hG4bK") {
+		t.Errorf("BYE = %+v", bye)
+	}
+}
+
+func TestURIParams(t *testing.T) {
+	q := uriParams("sip:vad@bridge;min_silence_ms=300;locale=en%2DUS;transport=udp?subject=x")
+	if q.Get("min_silence_ms") != "300" || q.Get("locale") != "en-US" || q.Get("transport") != "udp" || q.Has("subject") {
+		t.Errorf("uriParams = %v", q)
+	}
+	if q := uriParams("sip:vad@bridge"); len(q) != 0 {
+		t.Errorf("uriParams without parameters = %v", q)
+	}
+}
+
+func TestSIPAllowed(t *testing.T) {
+	_, lan, _ := net.ParseCIDR("10.0.0.0/8")
+	_, v6, _ := net.ParseCIDR("fd00::/8")
+	open := &SIP{}
+	closed := &SIP{cfg: SIPConfig{AllowedNets: []*net.IPNet{lan, v6}}}
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"10.1.2.3", true},
+		{"192.168.1.1", false},
+		{"fd00::1", true},
+		{"2001:db8::1", false},
+	}
+	for _, tt := range tests {
+		ip := net.ParseIP(tt.ip)
+		if !open.allowed(ip) {
+			t.Errorf("without AllowedNets, allowed(%s) = false", tt.ip)
+		}
+		if got := closed.allowed(ip); got != tt.want {
+			t.Errorf("allowed(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
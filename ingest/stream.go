@@ -0,0 +1,163 @@
+// ingest/stream.go
+package ingest
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"vad-application/audio"
+	"vad-application/events"
+	pb "vad-application/grpc_modules"
+	"vad-application/metrics"
+	"vad-application/pipeline"
+
+	"google.golang.org/grpc/status"
+)
+
+// maxGapFill bounds the silence sent for one gap in the audio.
+const maxGapFill = 2 * time.Second
+
+// stream is one ingested audio stream: its audio goes through a pipeline
+// to a backend stream, whose responses are published as session events.
+type stream struct {
+	id      string
+	log     *slog.Logger
+	sink    events.Sink
+	started time.Time
+	// sent counts samples sent, at the backend's rate.
+	sent    atomic.Int64
+	bytesIn atomic.Int64
+	// msg is reused by forward.
+	msg pb.AudioChunk
+}
+
+func newStream(id string, sink events.Sink, log *slog.Logger) *stream {
+	return &stream{id: id, sink: sink, log: log, started: time.Now()}
+}
+
+// forward runs audio through pipe and sends the result to the backend, or
+// with eof set flushes the pipeline. Only one goroutine may forward.
+func (s *stream) forward(bs pb.VADService_ProcessAudioClient, pipe *pipeline.Chain, data []byte, eof bool) error {
+	var err error
+	if eof {
+		data, err = pipe.Flush()
+	} else {
+		data, err = pipe.Process(data)
+	}
+	if err != nil {
+		s.log.Warn("Audio conversion failed", "err", err)
+		return err
+	}
+	return s.send(bs, pipe, data)
+}
+
+// pump streams the audio read from src to the backend, then half-closes
+// the stream.
+func (s *stream) pump(bs pb.VADService_ProcessAudioClient, src audio.Source, pipe *pipeline.Chain) {
+	defer bs.CloseSend()
+	for {
+		frame, err := src.ReadFrame()
+		eof := err == io.EOF
+		if err != nil && !eof {
+			return
+		}
+		if err := s.forward(bs, pipe, frame, eof); err != nil || eof {
+			return
+		}
+	}
+}
+
+// fill sends silence standing in for samples of lost audio, at the
+// backend's rate, so that media time keeps up with the caller's.
+func (s *stream) fill(bs pb.VADService_ProcessAudioClient, pipe *pipeline.Chain, samples int) error {
+	f := audio.Backend
+	samples = min(samples, int(maxGapFill.Seconds())*f.SampleRate)
+	if samples <= 0 {
+		return nil
+	}
+	data, err := pipe.Inject(make([]byte, samples*f.FrameSize()))
+	if err != nil {
+		return err
+	}
+	return s.send(bs, pipe, data)
+}
+
+// send sends processed audio to the backend, a frame at a time.
+func (s *stream) send(bs pb.VADService_ProcessAudioClient, pipe *pipeline.Chain, data []byte) error {
+	return pipe.Frames(data, func(frame []byte) error {
+		s.msg.AudioData = frame
+		if err := bs.Send(&s.msg); err != nil {
+			return err
+		}
+		metrics.AudioBytes.Add(float64(len(frame)))
+		s.sent.Add(int64(len(frame) / audio.Backend.FrameSize()))
+		return nil
+	})
+}
+
+// receive publishes the backend's responses, and speech segments, until
+// the stream ends, then the session's end.
+func (s *stream) receive(ctx context.Context, bs pb.VADService_ProcessAudioClient) {
+	counts := map[string]int64{}
+	var open *events.SpeechSegment
+	var speech float64
+	for {
+		resp, err := bs.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				metrics.StreamErrors.WithLabelValues(status.Code(err).String()).Inc()
+				s.log.Warn("Backend stream failed", "err", err)
+			}
+			break
+		}
+		ev := resp.GetEvent()
+		counts[ev]++
+		metrics.Events.WithLabelValues(ev).Inc()
+		offset := s.offset()
+		s.publish(events.Event{Kind: events.VAD, Offset: offset, Event: ev, Message: resp.GetMessage()})
+		switch {
+		case ev == eventStart && open == nil:
+			open = &events.SpeechSegment{Start: offset}
+		case ev == eventEnd && open != nil:
+			open.End = offset
+			speech += open.End - open.Start
+			s.publish(events.Event{Kind: events.Segment, Offset: offset, Segment: open})
+			open = nil
+		}
+	}
+
+	offset := s.offset()
+	if open != nil {
+		speech += offset - open.Start
+	}
+	s.publish(events.Event{Kind: events.SessionEnd, Offset: offset, Summary: &events.Summary{
+		Started:  s.started,
+		Duration: time.Since(s.started).Seconds(),
+		Audio:    offset,
+		Speech:   speech,
+		BytesIn:  s.bytesIn.Load(),
+		Events:   counts,
+	}})
+	s.log.Info("Session ended", "duration", time.Since(s.started).Round(time.Millisecond).String(),
+		"bytes_in", s.bytesIn.Load(), "events", counts)
+}
+
+// offset is how much audio, in seconds, has been sent to the backend.
+func (s *stream) offset() float64 {
+	return float64(s.sent.Load()) / float64(audio.Backend.SampleRate)
+}
+
+func (s *stream) publish(e events.Event) {
+	if s.sink == nil {
+		return
+	}
+	e.SessionID = s.id
+	e.Time = time.Now()
+	s.sink.Publish(e)
+}
@@ -0,0 +1,309 @@
+// ingest/twilio.go
+package ingest
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"vad-application/audio"
+	"vad-application/events"
+	pb "vad-application/grpc_modules"
+	"vad-application/metrics"
+	"vad-application/pipeline"
+	"vad-application/session"
+
+	"github.com/gorilla/websocket"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// TwilioSignatureHeader carries Twilio's signature of the request URL.
+const TwilioSignatureHeader = "X-Twilio-Signature"
+
+// twilioReadTimeout bounds the wait for Twilio's next message; it sends one
+// every 20 ms while the call lasts.
+const twilioReadTimeout = 30 * time.Second
+
+// twilioMessage is a message of the Media Streams protocol. Only the part
+// of the event it carries is set.
+type twilioMessage struct {
+	Event     string `json:"event"`
+	StreamSid string `json:"streamSid"`
+	Start     *struct {
+		CallSid          string            `json:"callSid"`
+		Tracks           []string          `json:"tracks"`
+		CustomParameters map[string]string `json:"customParameters"`
+		MediaFormat      struct {
+			Encoding   string `json:"encoding"`
+			SampleRate int    `json:"sampleRate"`
+			Channels   int    `json:"channels"`
+		} `json:"mediaFormat"`
+	} `json:"start"`
+	Media *struct {
+		Track   string `json:"track"`
+		Payload []byte `json:"payload"`
+	} `json:"media"`
+	Mark *struct {
+		Name string `json:"name"`
+	} `json:"mark"`
+	DTMF *struct {
+		Digit string `json:"digit"`
+	} `json:"dtmf"`
+}
+
+// Twilio serves Twilio Media Streams, which a call's TwiML points at with
+// <Connect><Stream> or <Start><Stream>.
+//
+// The caller's audio, the inbound track, goes through the VAD pipeline like
+// a WebSocket session's, and its events, with keys the caller pressed as
+// dtmf events, are published to the sinks under the stream's SID. The URL's
+// query and the stream's custom parameters are read as session settings;
+// the audio format is the one Twilio announces.
+type Twilio struct {
+	clients  Clients
+	proc     Processing
+	sink     events.Sink
+	token    string
+	log      *slog.Logger
+	upgrader websocket.Upgrader
+
+	// stop ends the audio of every stream; ctx, once cancelled, their
+	// backend streams.
+	stop     chan struct{}
+	stopOnce sync.Once
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+
+	// mu orders counting streams in wg against Close; once closed is set
+	// no more are.
+	mu     sync.Mutex
+	closed bool
+}
+
+// NewTwilio returns a handler for Twilio Media Streams. With an auth token,
+// requests must be signed with it; without one, callers authenticate some
+// other way.
+func NewTwilio(clients Clients, proc Processing, sink events.Sink, authToken string, logger *slog.Logger) *Twilio {
+	t := &Twilio{
+		clients: clients,
+		proc:    proc,
+		sink:    sink,
+		token:   authToken,
+		log:     logger.With("ingest", "twilio"),
+		stop:    make(chan struct{}),
+	}
+	t.ctx, t.cancel = context.WithCancel(context.Background())
+	return t
+}
+
+// Close ends the audio of open streams and waits, until ctx expires, for
+// their last events.
+func (t *Twilio) Close(ctx context.Context) error {
+	t.mu.Lock()
+	t.closed = true
+	t.mu.Unlock()
+	t.stopOnce.Do(func() { close(t.stop) })
+	done := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(done)
+	}()
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		t.cancel()
+		<-done
+	}
+	t.cancel()
+	return err
+}
+
+// enter counts a stream in, unless Close has been called.
+func (t *Twilio) enter() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return false
+	}
+	t.wg.Add(1)
+	return true
+}
+
+func (t *Twilio) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if t.token != "" && !t.signed(r) {
+		http.Error(w, "invalid Twilio signature", http.StatusForbidden)
+		return
+	}
+	if !t.enter() {
+		http.Error(w, "server shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	defer t.wg.Done()
+	ws, err := t.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		t.log.Warn("WebSocket upgrade error", "remote_addr", r.RemoteAddr, "err", err)
+		return
+	}
+	defer ws.Close()
+
+	start, err := t.awaitStart(ws)
+	if err != nil {
+		t.log.Warn("Twilio stream did not start", "remote_addr", r.RemoteAddr, "err", err)
+		return
+	}
+	q := r.URL.Query()
+	for k, v := range start.Start.CustomParameters {
+		q.Set(k, v)
+	}
+	settings, err := t.proc.ParseSettings(q)
+	if err == nil {
+		mf := start.Start.MediaFormat
+		settings.Format = audio.Format{SampleRate: mf.SampleRate, Channels: mf.Channels}.WithEncoding(audio.ParseEncoding(mf.Encoding))
+		if err = settings.Format.Validate(); err == nil {
+			err = settings.Options().Validate(settings.Format)
+		}
+	}
+	log := t.log.With("session_id", start.StreamSid, "call_sid", start.Start.CallSid, "format", settings.Format.String())
+	if err != nil {
+		log.Warn("Unsupported Twilio stream", "err", err)
+		t.closeWS(ws, websocket.CloseUnsupportedData, "unsupported audio settings")
+		return
+	}
+	pipe, err := t.proc.NewPipeline(settings)
+	if err != nil {
+		log.Warn("Unsupported Twilio stream", "err", err)
+		t.closeWS(ws, websocket.CloseUnsupportedData, "unsupported audio settings")
+		return
+	}
+	client, err := t.clients.Client()
+	if err != nil {
+		log.Warn("No backend for Twilio stream", "err", err)
+		t.closeWS(ws, websocket.CloseTryAgainLater, "backend unavailable")
+		return
+	}
+
+	ctx, cancel := context.WithCancel(t.ctx)
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, session.MetadataSessionID, start.StreamSid)
+	ctx = metadata.AppendToOutgoingContext(ctx, settings.Metadata()...)
+	bs, err := client.ProcessAudio(ctx)
+	if err != nil {
+		metrics.StreamErrors.WithLabelValues(status.Code(err).String()).Inc()
+		log.Error("Backend stream failed", "err", err)
+		t.closeWS(ws, websocket.CloseInternalServerErr, "backend stream error")
+		return
+	}
+	log.Info("Twilio stream started", "tracks", start.Start.Tracks)
+
+	s := newStream(start.StreamSid, t.sink, log)
+	s.publish(events.Event{Kind: events.SessionStart})
+	received := make(chan struct{})
+	go func() {
+		defer close(received)
+		s.receive(ctx, bs)
+	}()
+	go func() {
+		// Shutdown ends the audio; the backend still finishes.
+		select {
+		case <-t.stop:
+			ws.SetReadDeadline(time.Now())
+		case <-received:
+		}
+	}()
+
+	t.relay(ws, s, bs, pipe)
+	if err := s.forward(bs, pipe, nil, true); err != nil {
+		log.Debug("Last audio not sent", "err", err)
+	}
+	bs.CloseSend()
+	<-received
+	t.closeWS(ws, websocket.CloseNormalClosure, "")
+}
+
+// awaitStart reads messages up to the start event.
+func (t *Twilio) awaitStart(ws *websocket.Conn) (*twilioMessage, error) {
+	for {
+		ws.SetReadDeadline(time.Now().Add(twilioReadTimeout))
+		var msg twilioMessage
+		if err := ws.ReadJSON(&msg); err != nil {
+			return nil, err
+		}
+		switch msg.Event {
+		case "start":
+			if msg.Start == nil {
+				return nil, errors.New("start event without start")
+			}
+			return &msg, nil
+		case "stop":
+			return nil, errors.New("stopped before starting")
+		}
+	}
+}
+
+// relay forwards the caller's audio until the stream stops, the connection
+// fails or the backend does.
+func (t *Twilio) relay(ws *websocket.Conn, s *stream, bs pb.VADService_ProcessAudioClient, pipe *pipeline.Chain) {
+	for {
+		select {
+		case <-t.stop:
+			return
+		default:
+		}
+		ws.SetReadDeadline(time.Now().Add(twilioReadTimeout))
+		var msg twilioMessage
+		if err := ws.ReadJSON(&msg); err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				s.log.Info("Twilio stream ended", "err", err)
+			}
+			return
+		}
+		switch msg.Event {
+		case "media":
+			if msg.Media == nil || (msg.Media.Track != "" && msg.Media.Track != "inbound") {
+				continue
+			}
+			s.bytesIn.Add(int64(len(msg.Media.Payload)))
+			if err := s.forward(bs, pipe, msg.Media.Payload, false); err != nil {
+				return
+			}
+		case "dtmf":
+			if msg.DTMF != nil {
+				metrics.DTMFDigits.Inc()
+				s.publish(events.Event{Kind: events.DTMF, Offset: s.offset(), Digit: msg.DTMF.Digit})
+			}
+		case "mark":
+			if msg.Mark != nil {
+				s.log.Debug("Twilio mark", "name", msg.Mark.Name)
+			}
+		case "stop":
+			return
+		}
+	}
+}
+
+// signed reports whether r carries Twilio's signature of its URL. Twilio
+// only connects over TLS, so the URL it signed is a wss one even where a
+// proxy terminates TLS.
+func (t *Twilio) signed(r *http.Request) bool {
+	got, err := base64.StdEncoding.DecodeString(r.Header.Get(TwilioSignatureHeader))
+	if err != nil || len(got) == 0 {
+		return false
+	}
+	mac := hmac.New(sha1.New, []byte(t.token))
+	mac.Write([]byte("wss://" + r.Host + r.URL.RequestURI()))
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+func (t *Twilio) closeWS(ws *websocket.Conn, code int, reason string) {
+	ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+}
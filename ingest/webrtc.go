@@ -0,0 +1,489 @@
+// ingest/webrtc.go
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"vad-application/events"
+	pb "vad-application/grpc_modules"
+	"vad-application/metrics"
+	"vad-application/pipeline"
+	"vad-application/session"
+
+	"github.com/google/uuid"
+	"github.com/pion/interceptor"
+	"github.com/pion/webrtc/v4"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// webrtcTimeout bounds ICE gathering for an answer and the wait for the
+// peer's audio once answered.
+const webrtcTimeout = 30 * time.Second
+
+// webrtcDrainTimeout bounds the wait for a session's last events to reach
+// the peer before its connection is closed.
+const webrtcDrainTimeout = time.Second
+
+// maxOfferSize bounds an SDP offer.
+const maxOfferSize = 64 << 10
+
+// webrtcEventsLabel is the label of the data channel a peer opens to get
+// its session's events.
+const webrtcEventsLabel = "events"
+
+// WebRTCConfig configures the WebRTC endpoint.
+type WebRTCConfig struct {
+	// Path is where offers are posted; sessions are at Path/<id>.
+	Path string
+	// ICEServers are the STUN or TURN URLs the bridge gathers candidates
+	// with.
+	ICEServers []string
+	// PublicIP, when set, replaces the host's own addresses in the bridge's
+	// candidates, for hosts behind a 1:1 NAT.
+	PublicIP string
+	// UDPAddr, when set, carries every session's media on one UDP socket
+	// instead of a port per session.
+	UDPAddr string
+	// CheckOrigin decides which browser origins may post offers.
+	CheckOrigin func(*http.Request) bool
+}
+
+// WebRTC lets browsers send microphone audio over an RTCPeerConnection,
+// Opus over SRTP, signalled as in WHIP (RFC 9725): the peer posts its SDP
+// offer and gets the answer, with the session's URL to DELETE when done,
+// in the response. The bridge only receives.
+//
+// The first audio track goes through the VAD pipeline like a WebSocket
+// session's, keys sent as telephone events becoming dtmf events, and the
+// offer URL's query is read as session settings. Events are published to
+// the sinks and, if the peer opens a data channel labelled "events", sent
+// on it as JSON.
+type WebRTC struct {
+	cfg     WebRTCConfig
+	api     *webrtc.API
+	ice     []webrtc.ICEServer
+	mux     io.Closer
+	clients Clients
+	proc    Processing
+	sink    events.Sink
+	log     *slog.Logger
+
+	mu    sync.Mutex
+	peers map[string]*webrtcPeer
+
+	// stop ends the audio of every session; ctx, once cancelled, their
+	// backend streams.
+	stop     chan struct{}
+	stopOnce sync.Once
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// NewWebRTC returns the WebRTC endpoint. It needs a build with Opus.
+func NewWebRTC(cfg WebRTCConfig, clients Clients, proc Processing, sink events.Sink, logger *slog.Logger) (*WebRTC, error) {
+	if c, ok := newCodec(0, "opus", 48000, 2); !ok {
+		return nil, fmt.Errorf("webrtc: %w", c.format.Validate())
+	}
+	m := &webrtc.MediaEngine{}
+	for _, c := range []webrtc.RTPCodecParameters{
+		{RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus, ClockRate: 48000, Channels: 2, SDPFmtpLine: "minptime=10;useinbandfec=1"}, PayloadType: 111},
+		{RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: "audio/" + telephoneEvent, ClockRate: 48000, SDPFmtpLine: "0-15"}, PayloadType: 110},
+		{RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: "audio/" + telephoneEvent, ClockRate: 8000, SDPFmtpLine: "0-15"}, PayloadType: 126},
+	} {
+		if err := m.RegisterCodec(c, webrtc.RTPCodecTypeAudio); err != nil {
+			return nil, fmt.Errorf("webrtc: %w", err)
+		}
+	}
+	// Receiver reports and NACKs for the sender's congestion control.
+	ir := &interceptor.Registry{}
+	if err := webrtc.RegisterDefaultInterceptors(m, ir); err != nil {
+		return nil, fmt.Errorf("webrtc: %w", err)
+	}
+	var se webrtc.SettingEngine
+	if cfg.PublicIP != "" {
+		se.SetNAT1To1IPs([]string{cfg.PublicIP}, webrtc.ICECandidateTypeHost)
+	}
+	w := &WebRTC{
+		cfg:     cfg,
+		clients: clients,
+		proc:    proc,
+		sink:    sink,
+		log:     logger.With("ingest", "webrtc"),
+		peers:   map[string]*webrtcPeer{},
+		stop:    make(chan struct{}),
+	}
+	if cfg.UDPAddr != "" {
+		conn, err := net.ListenPacket("udp", cfg.UDPAddr)
+		if err != nil {
+			return nil, fmt.Errorf("webrtc: %w", err)
+		}
+		mux := webrtc.NewICEUDPMux(nil, conn)
+		se.SetICEUDPMux(mux)
+		se.SetNetworkTypes([]webrtc.NetworkType{webrtc.NetworkTypeUDP4, webrtc.NetworkTypeUDP6})
+		w.mux = mux
+	}
+	w.api = webrtc.NewAPI(webrtc.WithMediaEngine(m), webrtc.WithInterceptorRegistry(ir), webrtc.WithSettingEngine(se))
+	for _, u := range cfg.ICEServers {
+		w.ice = append(w.ice, webrtc.ICEServer{URLs: []string{u}})
+	}
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+	return w, nil
+}
+
+// Close ends the audio of open sessions and waits, until ctx expires, for
+// their last events.
+func (w *WebRTC) Close(ctx context.Context) error {
+	w.stopOnce.Do(func() { close(w.stop) })
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		w.cancel()
+		<-done
+	}
+	w.cancel()
+	if w.mux != nil {
+		err = errors.Join(err, w.mux.Close())
+	}
+	return err
+}
+
+func (w *WebRTC) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if w.cfg.CheckOrigin != nil && !w.cfg.CheckOrigin(r) {
+		http.Error(rw, "origin not allowed", http.StatusForbidden)
+		return
+	}
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, w.cfg.Path), "/")
+	switch {
+	case id == "" && r.Method == http.MethodPost:
+		w.offer(rw, r)
+	case id != "" && r.Method == http.MethodDelete:
+		w.mu.Lock()
+		p := w.peers[id]
+		w.mu.Unlock()
+		if p == nil {
+			http.Error(rw, "no such session", http.StatusNotFound)
+			return
+		}
+		p.hangUp()
+	case id == "":
+		rw.Header().Set("Allow", http.MethodPost)
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+	default:
+		// Candidates are all in the answer, so there is no trickle ICE.
+		rw.Header().Set("Allow", http.MethodDelete)
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// offer answers a peer's offer and starts its session.
+func (w *WebRTC) offer(rw http.ResponseWriter, r *http.Request) {
+	select {
+	case <-w.stop:
+		http.Error(rw, "server shutting down", http.StatusServiceUnavailable)
+		return
+	default:
+	}
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt != "application/sdp" {
+		http.Error(rw, "offer must be application/sdp", http.StatusUnsupportedMediaType)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(rw, r.Body, maxOfferSize))
+	if err != nil {
+		http.Error(rw, "offer unreadable", http.StatusBadRequest)
+		return
+	}
+	id := uuid.NewString()
+	log := w.log.With("session_id", id, "remote_addr", r.RemoteAddr)
+
+	codec, _ := newCodec(0, "opus", 48000, 2)
+	settings, err := w.proc.ParseSettings(r.URL.Query())
+	if err == nil {
+		settings.Format = codec.format
+		err = settings.Options().Validate(settings.Format)
+	}
+	var pipe *pipeline.Chain
+	if err == nil {
+		pipe, err = w.proc.NewPipeline(settings)
+	}
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	client, err := w.clients.Client()
+	if err != nil {
+		log.Warn("No backend for WebRTC session", "err", err)
+		http.Error(rw, "backend unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	pc, err := w.api.NewPeerConnection(webrtc.Configuration{ICEServers: w.ice})
+	if err != nil {
+		log.Error("Peer connection failed", "err", err)
+		http.Error(rw, "peer connection failed", http.StatusInternalServerError)
+		return
+	}
+	p := &webrtcPeer{
+		w:      w,
+		pc:     pc,
+		next:   w.sink,
+		tracks: make(chan *webrtc.TrackRemote, 1),
+		ended:  make(chan struct{}),
+	}
+	p.stream = newStream(id, p, log)
+	pc.OnTrack(func(t *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		if t.Kind() != webrtc.RTPCodecTypeAudio {
+			return
+		}
+		select {
+		case p.tracks <- t:
+		default:
+			// Only the first audio track is listened to.
+		}
+	})
+	pc.OnDataChannel(func(dc *webrtc.DataChannel) {
+		if dc.Label() != webrtcEventsLabel {
+			return
+		}
+		dc.OnOpen(func() {
+			p.mu.Lock()
+			p.dc = dc
+			p.mu.Unlock()
+		})
+	})
+	pc.OnConnectionStateChange(func(st webrtc.PeerConnectionState) {
+		if st == webrtc.PeerConnectionStateFailed || st == webrtc.PeerConnectionStateClosed {
+			p.hangUp()
+		}
+	})
+
+	answer, err := p.answer(r.Context(), string(body))
+	if err != nil {
+		pc.Close()
+		log.Warn("WebRTC offer rejected", "err", err)
+		http.Error(rw, "offer not acceptable", http.StatusNotAcceptable)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(w.ctx)
+	ctx = metadata.AppendToOutgoingContext(ctx, session.MetadataSessionID, id)
+	ctx = metadata.AppendToOutgoingContext(ctx, settings.Metadata()...)
+	bs, err := client.ProcessAudio(ctx)
+	if err != nil {
+		cancel()
+		pc.Close()
+		metrics.StreamErrors.WithLabelValues(status.Code(err).String()).Inc()
+		log.Error("Backend stream failed", "err", err)
+		http.Error(rw, "backend stream error", http.StatusInternalServerError)
+		return
+	}
+
+	w.mu.Lock()
+	w.peers[id] = p
+	w.mu.Unlock()
+	rw.Header().Set("Content-Type", "application/sdp")
+	rw.Header().Set("Location", strings.TrimSuffix(w.cfg.Path, "/")+"/"+id)
+	rw.WriteHeader(http.StatusCreated)
+	io.WriteString(rw, answer)
+	log.Info("WebRTC session answered")
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		defer cancel()
+		p.run(ctx, bs, pipe)
+		w.mu.Lock()
+		delete(w.peers, id)
+		w.mu.Unlock()
+		p.drain()
+		pc.Close()
+	}()
+}
+
+// webrtcPeer is one browser's session. It is its stream's sink, passing
+// events on to the bridge's sinks and the peer's events data channel.
+type webrtcPeer struct {
+	*stream
+	w      *WebRTC
+	pc     *webrtc.PeerConnection
+	next   events.Sink
+	tracks chan *webrtc.TrackRemote
+
+	mu    sync.Mutex
+	dc    *webrtc.DataChannel
+	track *webrtc.TrackRemote
+
+	ended   chan struct{}
+	endOnce sync.Once
+}
+
+// answer returns the answer to offer, with every candidate gathered.
+func (p *webrtcPeer) answer(ctx context.Context, offer string) (string, error) {
+	if err := p.pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: offer}); err != nil {
+		return "", err
+	}
+	answer, err := p.pc.CreateAnswer(nil)
+	if err != nil {
+		return "", err
+	}
+	gathered := webrtc.GatheringCompletePromise(p.pc)
+	if err := p.pc.SetLocalDescription(answer); err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(ctx, webrtcTimeout)
+	defer cancel()
+	select {
+	case <-gathered:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	return p.pc.LocalDescription().SDP, nil
+}
+
+// hangUp ends the session's audio.
+func (p *webrtcPeer) hangUp() {
+	p.endOnce.Do(func() {
+		close(p.ended)
+		p.mu.Lock()
+		if p.track != nil {
+			p.track.SetReadDeadline(time.Now())
+		}
+		p.mu.Unlock()
+	})
+}
+
+// run forwards the peer's audio until the session ends, then waits for the
+// backend's last events.
+func (p *webrtcPeer) run(ctx context.Context, bs pb.VADService_ProcessAudioClient, pipe *pipeline.Chain) {
+	p.publish(events.Event{Kind: events.SessionStart})
+	received := make(chan struct{})
+	go func() {
+		defer close(received)
+		p.receive(ctx, bs)
+	}()
+	go func() {
+		select {
+		case <-p.w.stop:
+			p.log.Info("Ending WebRTC session: shutting down")
+			p.hangUp()
+		case <-received:
+			// The backend went first.
+			p.hangUp()
+		case <-p.ended:
+		}
+	}()
+
+	timer := time.NewTimer(webrtcTimeout)
+	select {
+	case t := <-p.tracks:
+		timer.Stop()
+		p.relay(bs, pipe, t)
+	case <-timer.C:
+		p.log.Info("Ending WebRTC session: no audio track")
+	case <-p.ended:
+		timer.Stop()
+	}
+	if err := p.forward(bs, pipe, nil, true); err != nil {
+		p.log.Debug("Last audio not sent", "err", err)
+	}
+	bs.CloseSend()
+	<-received
+}
+
+// relay forwards the track's audio until the session ends.
+func (p *webrtcPeer) relay(bs pb.VADService_ProcessAudioClient, pipe *pipeline.Chain, t *webrtc.TrackRemote) {
+	p.mu.Lock()
+	p.track = t
+	p.mu.Unlock()
+	select {
+	case <-p.ended:
+		// hangUp came before the track was set.
+		return
+	default:
+	}
+	in := rtpInput{s: p.stream, pt: int(t.PayloadType()), dtmfPT: p.dtmfPT(), clock: int(t.Codec().ClockRate)}
+	p.log.Info("WebRTC audio started", "codec", t.Codec().MimeType, "ssrc", uint32(t.SSRC()))
+	for {
+		pkt, _, err := t.ReadRTP()
+		if err != nil {
+			select {
+			case <-p.ended:
+			default:
+				p.log.Info("WebRTC audio ended", "err", err)
+			}
+			return
+		}
+		if err := in.packet(bs, pipe, rtpPacket{pt: int(pkt.PayloadType), seq: pkt.SequenceNumber, ts: pkt.Timestamp, payload: pkt.Payload}); err != nil {
+			return
+		}
+	}
+}
+
+// dtmfPT returns the payload type of telephone events the peer may send
+// alongside its audio, or -1.
+func (p *webrtcPeer) dtmfPT() int {
+	for _, t := range p.pc.GetTransceivers() {
+		if t.Kind() != webrtc.RTPCodecTypeAudio || t.Receiver() == nil {
+			continue
+		}
+		for _, c := range t.Receiver().GetParameters().Codecs {
+			if strings.EqualFold(c.MimeType, "audio/"+telephoneEvent) {
+				return int(c.PayloadType)
+			}
+		}
+	}
+	return -1
+}
+
+// drain waits for the events data channel to deliver what it holds.
+func (p *webrtcPeer) drain() {
+	p.mu.Lock()
+	dc := p.dc
+	p.mu.Unlock()
+	if dc == nil {
+		return
+	}
+	deadline := time.Now().Add(webrtcDrainTimeout)
+	for dc.BufferedAmount() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Publish hands e to the bridge's sinks and the peer.
+func (p *webrtcPeer) Publish(e events.Event) {
+	if p.next != nil {
+		p.next.Publish(e)
+	}
+	p.mu.Lock()
+	dc := p.dc
+	p.mu.Unlock()
+	if dc == nil {
+		return
+	}
+	b, err := json.Marshal(e)
+	if err == nil {
+		err = dc.SendText(string(b))
+	}
+	if err != nil {
+		p.log.Debug("Event not sent to peer", "kind", e.Kind, "err", err)
+	}
+}
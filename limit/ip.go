@@ -0,0 +1,142 @@
+// limit/ip.go
+package limit
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"vad-application/metrics"
+
+	"golang.org/x/time/rate"
+)
+
+// idleTTL is how long an IP without open sessions is remembered.
+const idleTTL = 10 * time.Minute
+
+// IPLimiter caps how often a client IP may open WebSocket sessions and how
+// many it may hold open at once.
+type IPLimiter struct {
+	perMinute     int
+	maxConcurrent int
+	// trustProxy takes the client IP from X-Forwarded-For, for deployments
+	// behind a reverse proxy that sets it.
+	trustProxy bool
+
+	mu        sync.Mutex
+	clients   map[string]*ipState
+	lastSweep time.Time
+}
+
+type ipState struct {
+	limiter  *rate.Limiter
+	active   int
+	lastSeen time.Time
+}
+
+// NewIPLimiter returns a limiter allowing perMinute new sessions per IP and
+// maxConcurrent open sessions per IP. Zero disables either limit.
+func NewIPLimiter(perMinute, maxConcurrent int, trustProxy bool) *IPLimiter {
+	return &IPLimiter{
+		perMinute:     perMinute,
+		maxConcurrent: maxConcurrent,
+		trustProxy:    trustProxy,
+		clients:       map[string]*ipState{},
+	}
+}
+
+// Middleware answers 429 when the caller's IP is over either limit. The
+// concurrency slot is held until next returns, which for /ws is the end of
+// the session.
+func (l *IPLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := ClientIP(r, l.trustProxy)
+		retry, reason, ok := l.acquire(ip)
+		if !ok {
+			metrics.RejectedUpgrades.WithLabelValues(reason).Inc()
+			w.Header().Set("Retry-After", strconv.Itoa(int(retry.Seconds()+0.999)))
+			http.Error(w, "too many connections from your address", http.StatusTooManyRequests)
+			return
+		}
+		defer l.release(ip)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (l *IPLimiter) acquire(ip string) (retry time.Duration, reason string, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+
+	st, ok := l.clients[ip]
+	if !ok {
+		st = &ipState{}
+		if l.perMinute > 0 {
+			st.limiter = rate.NewLimiter(rate.Limit(float64(l.perMinute)/60), l.perMinute)
+		}
+		l.clients[ip] = st
+	}
+	st.lastSeen = now
+
+	if l.maxConcurrent > 0 && st.active >= l.maxConcurrent {
+		return time.Second, "ip_concurrency", false
+	}
+	if st.limiter != nil {
+		res := st.limiter.ReserveN(now, 1)
+		if d := res.DelayFrom(now); d > 0 {
+			res.CancelAt(now)
+			return max(d, time.Second), "ip_rate", false
+		}
+	}
+	st.active++
+	return 0, "", true
+}
+
+func (l *IPLimiter) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if st, ok := l.clients[ip]; ok {
+		st.active--
+		st.lastSeen = time.Now()
+	}
+}
+
+// sweep forgets idle IPs once a minute so the map does not grow forever.
+func (l *IPLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for ip, st := range l.clients {
+		if st.active == 0 && now.Sub(st.lastSeen) > idleTTL {
+			delete(l.clients, ip)
+		}
+	}
+}
+
+// ClientIP returns the address of the caller, optionally trusting the
+// right-most X-Forwarded-For entry: the one the proxy in front of us
+// appended. Entries left of it come from the client and may be forged.
+func ClientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+			last := xff[len(xff)-1]
+			if i := strings.LastIndexByte(last, ','); i >= 0 {
+				last = last[i+1:]
+			}
+			if ip := strings.TrimSpace(last); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
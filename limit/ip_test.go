@@ -0,0 +1,56 @@
+// limit/ip_test.go
+package limit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		xff        []string
+		trustProxy bool
+		want       string
+	}{
+		{"peer address", nil, false, "203.0.113.7"},
+		{"header ignored without trust", []string{"198.51.100.1"}, false, "203.0.113.7"},
+		{"proxy entry", []string{"198.51.100.1"}, true, "198.51.100.1"},
+		{"client-supplied entry ignored", []string{"10.9.9.9, 198.51.100.1"}, true, "198.51.100.1"},
+		{"spoofed entries ignored", []string{"1.1.1.1,2.2.2.2 ,  198.51.100.1 "}, true, "198.51.100.1"},
+		{"last header line", []string{"10.9.9.9", "198.51.100.1"}, true, "198.51.100.1"},
+		{"empty last entry", []string{"198.51.100.1, "}, true, "203.0.113.7"},
+		{"empty header", []string{""}, true, "203.0.113.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/ws", nil)
+			r.RemoteAddr = "203.0.113.7:52000"
+			for _, v := range tt.xff {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if got := ClientIP(r, tt.trustProxy); got != tt.want {
+				t.Errorf("ClientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIPLimiterSpoofedHeader(t *testing.T) {
+	l := NewIPLimiter(0, 1, true)
+	if _, _, ok := l.acquire(ClientIP(request("10.0.0.1, 198.51.100.1"), true)); !ok {
+		t.Fatal("first session refused")
+	}
+	// A client rotating its own X-Forwarded-For entry is still the
+	// address the proxy appended.
+	if _, reason, ok := l.acquire(ClientIP(request("10.0.0.2, 198.51.100.1"), true)); ok || reason != "ip_concurrency" {
+		t.Errorf("second session = %v, %q; want refused for ip_concurrency", ok, reason)
+	}
+}
+
+func request(xff string) *http.Request {
+	r := httptest.NewRequest("GET", "/ws", nil)
+	r.Header.Set("X-Forwarded-For", xff)
+	return r
+}
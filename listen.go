@@ -0,0 +1,179 @@
+// listen.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// systemdFirstFD is the first file descriptor systemd passes sockets from.
+const systemdFirstFD = 3
+
+// listen opens a listener for each of addrs: host:port, unix:<path> for a
+// Unix socket given mode, or systemd[:<name>] for the sockets systemd
+// passed, all of them or those named name.
+func listen(addrs []string, mode fs.FileMode) ([]net.Listener, error) {
+	var (
+		lns []net.Listener
+		sd  *systemdSockets
+	)
+	fail := func(err error) ([]net.Listener, error) {
+		for _, l := range lns {
+			l.Close()
+		}
+		return nil, err
+	}
+	for _, addr := range addrs {
+		switch {
+		case strings.HasPrefix(addr, "unix:"):
+			l, err := listenUnix(strings.TrimPrefix(addr, "unix:"), mode)
+			if err != nil {
+				return fail(err)
+			}
+			lns = append(lns, l)
+		case addr == "systemd" || strings.HasPrefix(addr, "systemd:"):
+			if sd == nil {
+				var err error
+				if sd, err = loadSystemdSockets(); err != nil {
+					return fail(err)
+				}
+			}
+			name, _ := strings.CutPrefix(strings.TrimPrefix(addr, "systemd"), ":")
+			ls, err := sd.take(name)
+			if err != nil {
+				return fail(err)
+			}
+			lns = append(lns, ls...)
+		default:
+			l, err := net.Listen("tcp", addr)
+			if err != nil {
+				return fail(err)
+			}
+			lns = append(lns, l)
+		}
+	}
+	return lns, nil
+}
+
+// listenUnix listens on a Unix socket at path, replacing the one a previous
+// run left behind. The socket is removed when the listener is closed.
+func listenUnix(path string, mode fs.FileMode) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&fs.ModeSocket == 0 {
+			return nil, fmt.Errorf("listen unix:%s: exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	// The socket is created in a private directory, which MkdirTemp makes
+	// 0700, and given mode before it is moved into place, so nobody
+	// connects while it has the permissions the umask gave it.
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".listen-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	tmp := filepath.Join(dir, "sock")
+	l, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, err
+	}
+	ul := l.(*net.UnixListener)
+	ul.SetUnlinkOnClose(false)
+	if err := os.Chmod(tmp, mode); err != nil {
+		l.Close()
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return &unixListener{UnixListener: ul, path: path}, nil
+}
+
+// unixListener removes its socket when closed, from where it was moved to.
+type unixListener struct {
+	*net.UnixListener
+	path string
+	once sync.Once
+}
+
+func (l *unixListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: l.path, Net: "unix"}
+}
+
+func (l *unixListener) Close() error {
+	err := l.UnixListener.Close()
+	l.once.Do(func() { os.Remove(l.path) })
+	return err
+}
+
+// systemdSockets are the sockets systemd passed.
+type systemdSockets struct {
+	files []*os.File
+	names []string
+}
+
+// loadSystemdSockets reads the sockets systemd passed, as sd_listen_fds
+// does, and hides them from child processes.
+func loadSystemdSockets() (*systemdSockets, error) {
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, errors.New("listen systemd: not started by systemd socket activation")
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return nil, errors.New("listen systemd: systemd passed no sockets")
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	sd := &systemdSockets{}
+	for i := range n {
+		name := ""
+		if i < len(names) {
+			name = names[i]
+		}
+		sd.files = append(sd.files, os.NewFile(uintptr(systemdFirstFD+i), "systemd:"+name))
+		sd.names = append(sd.names, name)
+	}
+	return sd, nil
+}
+
+// take returns listeners on the sockets named name, or all of them when
+// name is empty, that no earlier call took.
+func (sd *systemdSockets) take(name string) ([]net.Listener, error) {
+	var lns []net.Listener
+	for i, f := range sd.files {
+		if f == nil || (name != "" && sd.names[i] != name) {
+			continue
+		}
+		l, err := net.FileListener(f)
+		if err != nil {
+			for _, l := range lns {
+				l.Close()
+			}
+			return nil, fmt.Errorf("listen systemd socket %d: %w", systemdFirstFD+i, err)
+		}
+		// The listener holds a duplicate of the descriptor.
+		f.Close()
+		sd.files[i] = nil
+		lns = append(lns, l)
+	}
+	if len(lns) == 0 {
+		if name != "" {
+			return nil, fmt.Errorf("listen systemd:%s: systemd passed no socket of that name", name)
+		}
+		return nil, errors.New("listen systemd: systemd passed no sockets left")
+	}
+	return lns, nil
+}
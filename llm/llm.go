@@ -0,0 +1,153 @@
+// llm/llm.go
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// maxErrorBody caps the response text kept from a failed request.
+const maxErrorBody = 512
+
+// Message roles.
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// Message is one turn of a conversation.
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Completer answers a conversation.
+type Completer interface {
+	// Complete returns the assistant's reply to messages. When delta is
+	// not nil it is called with each piece of the reply as it is
+	// generated, before Complete returns.
+	Complete(ctx context.Context, messages []Message, delta func(string)) (string, error)
+}
+
+// HTTPConfig describes an HTTP chat completion service.
+type HTTPConfig struct {
+	// URL takes requests the way OpenAI's /v1/chat/completions does,
+	// which vLLM, llama.cpp's server and Ollama accept too.
+	URL string
+	// Model is sent as the model field; empty leaves it out.
+	Model string
+	// APIKey, when set, is sent as a bearer token.
+	APIKey string
+}
+
+// HTTP is a Completer streaming replies from an HTTP service.
+type HTTP struct {
+	cfg    HTTPConfig
+	client *http.Client
+}
+
+// completionRequest is the body of a chat completion request.
+type completionRequest struct {
+	Model    string    `json:"model,omitempty"`
+	Messages []Message `json:"messages"`
+	Stream   bool      `json:"stream"`
+}
+
+// completionChunk is one server-sent event of a streamed reply, or, with
+// Message set, a whole reply from a service that does not stream.
+type completionChunk struct {
+	Choices []struct {
+		Delta   Message `json:"delta"`
+		Message Message `json:"message"`
+	} `json:"choices"`
+}
+
+// NewHTTP returns a Completer for the service at cfg.URL. Requests are
+// bounded by their context.
+func NewHTTP(cfg HTTPConfig) (*HTTP, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("llm: invalid URL %q", cfg.URL)
+	}
+	return &HTTP{cfg: cfg, client: &http.Client{}}, nil
+}
+
+// Complete implements Completer.
+func (c *HTTP) Complete(ctx context.Context, messages []Message, delta func(string)) (string, error) {
+	body, err := json.Marshal(completionRequest{Model: c.cfg.Model, Messages: messages, Stream: true})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+	if c.cfg.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.cfg.APIKey)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("llm: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return "", fmt.Errorf("llm: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+
+	if mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mt != "text/event-stream" {
+		var chunk completionChunk
+		if err := json.NewDecoder(resp.Body).Decode(&chunk); err != nil {
+			return "", fmt.Errorf("llm: decoding response: %w", err)
+		}
+		if len(chunk.Choices) == 0 {
+			return "", fmt.Errorf("llm: response has no choices")
+		}
+		reply := chunk.Choices[0].Message.Content
+		if delta != nil && reply != "" {
+			delta(reply)
+		}
+		return reply, nil
+	}
+
+	var reply strings.Builder
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for sc.Scan() {
+		data, ok := strings.CutPrefix(sc.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			break
+		}
+		var chunk completionChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return "", fmt.Errorf("llm: decoding event: %w", err)
+		}
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			continue
+		}
+		piece := chunk.Choices[0].Delta.Content
+		reply.WriteString(piece)
+		if delta != nil {
+			delta(piece)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return "", fmt.Errorf("llm: reading reply: %w", err)
+	}
+	return reply.String(), nil
+}
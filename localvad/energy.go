@@ -0,0 +1,59 @@
+// localvad/energy.go
+package localvad
+
+import (
+	"encoding/binary"
+	"math"
+
+	"vad-application/audio"
+)
+
+// EnergyConfig tunes the energy classifier.
+type EnergyConfig struct {
+	// Threshold is the RMS level, in dBFS, above which a frame is speech.
+	// Frames up to 10 dB quieter also count when their zero-crossing rate
+	// is at least ZCRThreshold, which catches unvoiced consonants.
+	Threshold    float64
+	ZCRThreshold float64
+}
+
+// Energy is a simple classifier deciding on each frame's loudness and
+// zero-crossing rate.
+type Energy struct {
+	cfg EnergyConfig
+}
+
+// NewEnergy returns an energy classifier.
+func NewEnergy(cfg EnergyConfig) *Energy {
+	return &Energy{cfg: cfg}
+}
+
+// Speech implements Classifier.
+func (e *Energy) Speech(frame []byte) (bool, error) {
+	var m audio.Meter
+	m.Write(frame)
+	rms, _ := m.Level()
+	db := audio.DBFS(rms)
+	if db >= e.cfg.Threshold {
+		return true, nil
+	}
+	return db >= e.cfg.Threshold-10 && zeroCrossingRate(frame) >= e.cfg.ZCRThreshold, nil
+}
+
+// zeroCrossingRate is the share of adjacent 16-bit samples changing sign.
+func zeroCrossingRate(pcm []byte) float64 {
+	n := len(pcm) / 2
+	if n < 2 {
+		return 0
+	}
+	crossings := 0
+	prev := int16(binary.LittleEndian.Uint16(pcm))
+	for i := 2; i+1 < len(pcm); i += 2 {
+		v := int16(binary.LittleEndian.Uint16(pcm[i:]))
+		if math.Signbit(float64(v)) != math.Signbit(float64(prev)) {
+			crossings++
+		}
+		prev = v
+	}
+	return float64(crossings) / float64(n-1)
+}
@@ -0,0 +1,95 @@
+// localvad/segmenter.go
+package localvad
+
+import (
+	"io"
+	"time"
+
+	"vad-application/audio"
+	pb "vad-application/grpc_modules"
+)
+
+// FrameDuration is the audio each speech decision covers.
+const FrameDuration = 20 * time.Millisecond
+
+// Classifier decides whether one FrameDuration frame of audio in
+// audio.Backend's format is speech. Classifiers holding resources also
+// implement io.Closer.
+type Classifier interface {
+	Speech(frame []byte) (bool, error)
+}
+
+// Timing smooths a Classifier's decisions: MinSpeech of speech frames starts
+// a segment, and MinSilence of silent ones ends it.
+type Timing struct {
+	MinSpeech  time.Duration
+	MinSilence time.Duration
+}
+
+// Segmenter is a Detector turning a Classifier's frame decisions into
+// start and end events.
+type Segmenter struct {
+	c Classifier
+	t Timing
+	// frame is the size of a decision frame in bytes; pending holds the
+	// start of the next one.
+	frame   int
+	pending []byte
+	// run is how long the frames have disagreed with speaking.
+	run      time.Duration
+	speaking bool
+}
+
+// NewSegmenter returns a Segmenter for one stream.
+func NewSegmenter(c Classifier, t Timing) *Segmenter {
+	f := audio.Backend
+	return &Segmenter{c: c, t: t, frame: int(FrameDuration.Seconds()*float64(f.SampleRate)) * f.FrameSize()}
+}
+
+// Configure implements Configurable: the stream's timing replaces the
+// server's where set.
+func (s *Segmenter) Configure(cfg *pb.StreamConfig) {
+	if ms := cfg.GetMinSpeechMs(); ms != 0 {
+		s.t.MinSpeech = time.Duration(ms) * time.Millisecond
+	}
+	if ms := cfg.GetMinSilenceMs(); ms != 0 {
+		s.t.MinSilence = time.Duration(ms) * time.Millisecond
+	}
+}
+
+// Process implements Detector.
+func (s *Segmenter) Process(pcm []byte) ([]*pb.VADResponse, error) {
+	var out []*pb.VADResponse
+	s.pending = append(s.pending, pcm...)
+	for len(s.pending) >= s.frame {
+		speech, err := s.c.Speech(s.pending[:s.frame])
+		if err != nil {
+			return out, err
+		}
+		s.pending = s.pending[s.frame:]
+		if speech == s.speaking {
+			s.run = 0
+			continue
+		}
+		s.run += FrameDuration
+		switch {
+		case speech && s.run >= s.t.MinSpeech:
+			s.speaking, s.run = true, 0
+			out = append(out, &pb.VADResponse{Event: "start", Message: "Speech detected"})
+		case !speech && s.run >= s.t.MinSilence:
+			s.speaking, s.run = false, 0
+			out = append(out, &pb.VADResponse{Event: "end", Message: "Speech ended"})
+		}
+	}
+	// Keep the leftover from pinning the caller's buffers.
+	s.pending = append([]byte(nil), s.pending...)
+	return out, nil
+}
+
+// Close releases the classifier.
+func (s *Segmenter) Close() error {
+	if c, ok := s.c.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+// localvad/server.go
+package localvad
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	pb "vad-application/grpc_modules"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// Engines for NewEngineServer.
+const (
+	EngineWebRTC = "webrtc"
+	EngineEnergy = "energy"
+)
+
+var errWebRTCDisabled = errors.New("localvad: webrtc engine not compiled in (build with CGO_ENABLED=1)")
+
+// bufferSize is the in-memory connection buffer between Client and its
+// server.
+const bufferSize = 1 << 20
+
+// Detector turns a stream of audio in audio.Backend's format into VAD
+// events, the way a backend would answer it. Detectors holding resources
+// also implement io.Closer.
+type Detector interface {
+	Process(pcm []byte) ([]*pb.VADResponse, error)
+}
+
+// Configurable is implemented by Detectors honoring the config message a
+// stream may open with.
+type Configurable interface {
+	Configure(cfg *pb.StreamConfig)
+}
+
+// Server is a VADServiceServer running a new Detector on every stream.
+type Server struct {
+	pb.UnimplementedVADServiceServer
+	New func() (Detector, error)
+}
+
+// NewEngineServer returns a Server segmenting audio with the named engine:
+// EngineWebRTC, with the given aggressiveness, or EngineEnergy, with
+// energy.
+func NewEngineServer(engine string, aggressiveness int, energy EnergyConfig, t Timing) (*Server, error) {
+	var classifier func() (Classifier, error)
+	switch engine {
+	case EngineWebRTC:
+		if !WebRTCEnabled {
+			return nil, errWebRTCDisabled
+		}
+		classifier = func() (Classifier, error) { return NewWebRTC(aggressiveness) }
+	case EngineEnergy:
+		classifier = func() (Classifier, error) { return NewEnergy(energy), nil }
+	default:
+		return nil, fmt.Errorf("localvad: unknown engine %q", engine)
+	}
+	// Fail now rather than on the first stream.
+	c, err := classifier()
+	if err != nil {
+		return nil, err
+	}
+	NewSegmenter(c, t).Close()
+	return &Server{New: func() (Detector, error) {
+		c, err := classifier()
+		if err != nil {
+			return nil, err
+		}
+		return NewSegmenter(c, t), nil
+	}}, nil
+}
+
+// ProcessAudio implements pb.VADServiceServer.
+func (s *Server) ProcessAudio(stream grpc.BidiStreamingServer[pb.AudioChunk, pb.VADResponse]) error {
+	d, err := s.New()
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	if c, ok := d.(io.Closer); ok {
+		defer c.Close()
+	}
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if cfg := chunk.GetConfig(); cfg != nil {
+			if c, ok := d.(Configurable); ok {
+				c.Configure(cfg)
+			}
+			continue
+		}
+		resps, err := d.Process(chunk.GetAudioData())
+		for _, resp := range resps {
+			if err := stream.Send(resp); err != nil {
+				return err
+			}
+		}
+		if err != nil {
+			// Detectors may fail a stream with a code of their own.
+			if _, ok := status.FromError(err); ok {
+				return err
+			}
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+}
+
+// ResetVAD implements pb.VADServiceServer. Detectors live as long as their
+// stream, so there is nothing to reset.
+func (s *Server) ResetVAD(context.Context, *pb.ResetRequest) (*pb.ResetResponse, error) {
+	return &pb.ResetResponse{Success: true}, nil
+}
+
+// Client is a VADServiceClient for a Server running in-process, so sessions
+// can use it like any backend.
+type Client struct {
+	pb.VADServiceClient
+	srv  *grpc.Server
+	conn *grpc.ClientConn
+}
+
+// NewClient starts srv in-process and connects to it.
+func NewClient(srv pb.VADServiceServer) (*Client, error) {
+	lis := bufconn.Listen(bufferSize)
+	gs := grpc.NewServer()
+	pb.RegisterVADServiceServer(gs, srv)
+	go gs.Serve(lis)
+	conn, err := grpc.NewClient("passthrough:///localvad",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		gs.Stop()
+		return nil, err
+	}
+	return &Client{VADServiceClient: pb.NewVADServiceClient(conn), srv: gs, conn: conn}, nil
+}
+
+// Client returns c itself, so that it can stand in for a backend.Balancer
+// handing out clients.
+func (c *Client) Client() (pb.VADServiceClient, error) {
+	return c, nil
+}
+
+// Close disconnects and stops the server.
+func (c *Client) Close() error {
+	err := c.conn.Close()
+	c.srv.Stop()
+	return err
+}
@@ -0,0 +1,47 @@
+// localvad/webrtc.go
+
+//go:build cgo
+
+package localvad
+
+import (
+	"fmt"
+
+	"vad-application/audio"
+
+	webrtcvad "github.com/baabaaox/go-webrtcvad"
+)
+
+// WebRTCEnabled reports whether the WebRTC classifier is built in.
+const WebRTCEnabled = true
+
+// WebRTC classifies frames with the WebRTC VAD.
+type WebRTC struct {
+	inst webrtcvad.VadInst
+}
+
+// NewWebRTC returns a WebRTC classifier with the given aggressiveness, from
+// 0, the most likely to report speech, to 3.
+func NewWebRTC(aggressiveness int) (*WebRTC, error) {
+	inst := webrtcvad.Create()
+	if err := webrtcvad.Init(inst); err != nil {
+		webrtcvad.Free(inst)
+		return nil, fmt.Errorf("localvad: %w", err)
+	}
+	if err := webrtcvad.SetMode(inst, aggressiveness); err != nil {
+		webrtcvad.Free(inst)
+		return nil, fmt.Errorf("localvad: aggressiveness %d: %w", aggressiveness, err)
+	}
+	return &WebRTC{inst: inst}, nil
+}
+
+// Speech implements Classifier.
+func (w *WebRTC) Speech(frame []byte) (bool, error) {
+	return webrtcvad.Process(w.inst, audio.Backend.SampleRate, frame, len(frame)/audio.Backend.FrameSize())
+}
+
+// Close frees the VAD state.
+func (w *WebRTC) Close() error {
+	webrtcvad.Free(w.inst)
+	return nil
+}
@@ -0,0 +1,22 @@
+// localvad/webrtc_disabled.go
+
+//go:build !cgo
+
+package localvad
+
+const WebRTCEnabled = false
+
+// WebRTC is not available without cgo.
+type WebRTC struct{}
+
+func NewWebRTC(aggressiveness int) (*WebRTC, error) {
+	return nil, errWebRTCDisabled
+}
+
+func (w *WebRTC) Speech(frame []byte) (bool, error) {
+	return false, nil
+}
+
+func (w *WebRTC) Close() error {
+	return nil
+}
@@ -0,0 +1,37 @@
+// logging/logging.go
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"strings"
+)
+
+// Setup builds the process-wide logger writing to w in the given format
+// ("text" or "json") at the given level, and installs it as the slog and
+// log default so that stray log calls from dependencies end up in the
+// same stream.
+func Setup(w io.Writer, format, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("logging: %w", err)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	var h slog.Handler
+	switch strings.ToLower(format) {
+	case "", "text":
+		h = slog.NewTextHandler(w, opts)
+	case "json":
+		h = slog.NewJSONHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("logging: unknown format %q", format)
+	}
+
+	logger := slog.New(h)
+	slog.SetDefault(logger)
+	log.SetFlags(0)
+	return logger, nil
+}
@@ -0,0 +1,46 @@
+// logging/recover.go
+package logging
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"vad-application/metrics"
+	"vad-application/reporting"
+)
+
+// Recover answers 500 to requests whose handler panics instead of letting
+// the panic reach the server, logging its stack to logger, counting it in
+// metrics.Panics and reporting it to errs, which may be nil.
+// http.ErrAbortHandler, which handlers panic with to abort on purpose,
+// goes through.
+func Recover(next http.Handler, logger *slog.Logger, errs *reporting.Reporter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if err, ok := v.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(v)
+			}
+			metrics.Panics.WithLabelValues("http").Inc()
+			logger.Error("HTTP handler panicked",
+				"request_id", RequestID(r.Context()),
+				"method", r.Method,
+				"path", r.URL.Path,
+				"panic", v,
+				"stack", string(debug.Stack()),
+			)
+			errs.Capture(reporting.Event{
+				Message: "HTTP handler panicked",
+				Panic:   v,
+				Tags:    map[string]string{"request_id": RequestID(r.Context()), "method": r.Method, "path": r.URL.Path},
+			})
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,132 @@
+// logging/request.go
+package logging
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// HeaderRequestID carries a request's ID, taken from the client when it
+// sends a usable one and echoed in the response.
+const HeaderRequestID = "X-Request-ID"
+
+// maxRequestID bounds the IDs accepted from clients.
+const maxRequestID = 128
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the request ID id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the ID Middleware gave the request of ctx, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Middleware gives each request an ID, stored in its context and sent back
+// in HeaderRequestID, and, if access is set, logs it to logger once served.
+// WebSocket and streaming requests are logged when they end.
+func Middleware(next http.Handler, logger *slog.Logger, access bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(HeaderRequestID)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		w.Header().Set(HeaderRequestID, id)
+		r = r.WithContext(WithRequestID(r.Context(), id))
+		if !access {
+			next.ServeHTTP(w, r)
+			return
+		}
+		rec := &recorder{ResponseWriter: w}
+		start := time.Now()
+		next.ServeHTTP(rec, r)
+		status := rec.status
+		switch {
+		case rec.hijacked:
+			status = http.StatusSwitchingProtocols
+		case status == 0:
+			status = http.StatusOK
+		}
+		logger.Info("HTTP request",
+			"request_id", id,
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", status,
+			"bytes", rec.bytes,
+			"duration", time.Since(start).Round(time.Microsecond),
+			"remote_addr", r.RemoteAddr,
+		)
+	})
+}
+
+// validRequestID reports whether a client's ID is short printable ASCII,
+// safe to log and to pass on as gRPC metadata.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestID {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// recorder notes the status and size of a response.
+type recorder struct {
+	http.ResponseWriter
+	status   int
+	bytes    int64
+	hijacked bool
+}
+
+func (rec *recorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *recorder) Write(p []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(p)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+// Flush implements http.Flusher, which event streams rely on.
+func (rec *recorder) Flush() {
+	http.NewResponseController(rec.ResponseWriter).Flush()
+}
+
+// Hijack implements http.Hijacker, which WebSocket upgrades rely on.
+func (rec *recorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := rec.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("logging: response does not implement http.Hijacker")
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil {
+		rec.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap lets http.ResponseController reach the wrapped writer.
+func (rec *recorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
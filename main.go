@@ -3,70 +3,1186 @@ package main
 
 import (
 	"context"
-	"log"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"math/rand/v2"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
-	pb "vad-application/grpc_modules" // replace with your actual path
+	"vad-application/admin"
+	"vad-application/asr"
+	"vad-application/auth"
+	"vad-application/backend"
+	"vad-application/batch"
+	"vad-application/billing"
+	"vad-application/cluster"
+	"vad-application/config"
+	"vad-application/events"
+	pb "vad-application/grpc_modules"
+	"vad-application/grpcapi"
+	"vad-application/ingest"
+	"vad-application/limit"
+	"vad-application/llm"
+	"vad-application/localvad"
+	"vad-application/logging"
+	"vad-application/metrics"
+	"vad-application/origin"
+	"vad-application/pipeline"
+	"vad-application/publish"
+	"vad-application/quota"
+	"vad-application/recording"
+	"vad-application/reporting"
+	"vad-application/schema"
+	"vad-application/session"
+	"vad-application/sse"
+	"vad-application/store"
+	"vad-application/tenant"
+	"vad-application/tracing"
+	"vad-application/tts"
+	"vad-application/webhook"
+	"vad-application/webtransport"
 
 	"github.com/gorilla/websocket"
+	"github.com/nats-io/nats.go"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 )
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool { return true },
+// bridge forwards browser audio from WebSocket sessions to the VAD backend.
+type bridge struct {
+	cfg config.Config
+	log *slog.Logger
+	// Pooled gRPC connections to the VAD backends, shared by all sessions.
+	backends *backend.Balancer
+	// canary serves or shadows a share of sessions; nil unless configured.
+	canary *backend.Balancer
+	// embedded serves every session in-process in embedded mode, where
+	// backends is nil.
+	embedded *localvad.Client
+	// fallback serves sessions when no backend is reachable; nil unless
+	// enabled.
+	fallback *localvad.Client
+	// wakeWord gates sessions behind a wake word; nil unless configured.
+	wakeWord *backend.Pool
+	sessions *session.Manager
+	upgrader websocket.Upgrader
+	// wt upgrades WebTransport sessions; nil unless configured.
+	wt *webtransport.Server
+	// recorder saves session audio; nil unless recording is enabled.
+	recorder *recording.Recorder
+	// db stores session history; nil unless configured.
+	db *store.Store
+	// webhooks notifies registered URLs of session events; nil without any.
+	webhooks *webhook.Dispatcher
+	// kafka publishes VAD events to Kafka; nil unless configured.
+	kafka *publish.Kafka
+	// nats carries session events and, with natsAudio, audio sessions; nil
+	// unless configured.
+	nats      *nats.Conn
+	natsSink  *publish.NATS
+	natsAudio *ingest.NATS
+	// twilio serves Twilio Media Streams, sip answers SIP calls, webrtc
+	// takes WebRTC sessions and mqtt the audio of MQTT devices; nil unless
+	// configured.
+	twilio *ingest.Twilio
+	sip    *ingest.SIP
+	webrtc *ingest.WebRTC
+	mqtt   *ingest.MQTT
+	// redis broadcasts session events; nil unless configured.
+	redis *publish.Redis
+	// registry shares the sessions with the other replicas; nil unless
+	// configured.
+	registry *cluster.Registry
+	// billing exports usage reports; nil unless configured.
+	billing *billing.Exporter
+	// quotas meters the audio of authenticated callers.
+	quotas *quota.Quotas
+	// tenants holds how each configured tenant is served, and resolver
+	// tells which one a request belongs to.
+	tenants  map[string]*tenantConfig
+	resolver *tenant.Resolver
+	// models route sessions to the backends of their model; empty unless
+	// configured.
+	models []*modelRoute
+	// viewers relays live session events to listen-only WebSocket clients
+	// and /events/{sessionID}.
+	viewers *events.Hub
+	// Authenticators guarding /ws and the REST endpoints; none means open.
+	authenticators []auth.Authenticator
 }
 
-func wsHandler(w http.ResponseWriter, r *http.Request) {
-	ws, err := upgrader.Upgrade(w, r, nil)
+func (b *bridge) wsHandler(w http.ResponseWriter, r *http.Request) {
+	if b.sessions.Draining() {
+		http.Error(w, "server shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	if r.URL.Query().Has("listen") {
+		b.listen(w, r)
+		return
+	}
+	if token := r.URL.Query().Get("resume"); token != "" {
+		b.resume(w, r, token)
+		return
+	}
+	if mt, ok := b.sessions.Maintenance(); ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(mt.RetryAfter.Round(time.Second).Seconds())))
+		http.Error(w, session.ErrMaintenance.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	settings, err := b.sessions.ParseSettings(r.URL.Query())
+	if err == nil {
+		_, tc := b.tenant(r.Context())
+		err = settings.CheckEncoding(tc.encodings)
+	}
 	if err != nil {
-		log.Println("WebSocket upgrade error:", err)
+		http.Error(w, "invalid audio settings: "+err.Error(), http.StatusBadRequest)
 		return
 	}
-	defer ws.Close()
+	if settings.Locale == "" {
+		settings.Locale = session.AcceptLanguage(r.Header.Get("Accept-Language"))
+	}
 
-	// gRPC client
-	conn, err := grpc.NewClient("localhost:50055", grpc.WithInsecure())
+	ws, err := b.upgrade(w, r)
 	if err != nil {
-		log.Fatal("gRPC dial error:", err)
+		slog.Warn("WebSocket upgrade error", "remote_addr", r.RemoteAddr, "err", err)
+		return
 	}
-	defer conn.Close()
+	defer ws.Close()
+	b.serve(r.Context(), ws, b.log.With("remote_addr", r.RemoteAddr), settings)
+}
 
-	client := pb.NewVADServiceClient(conn)
-	stream, err := client.ProcessAudio(context.Background())
+// rpcHandler runs the session of a BridgeService call.
+func (b *bridge) rpcHandler(ctx context.Context, c *grpcapi.Conn) {
+	if b.sessions.Draining() {
+		session.Reject(c, websocket.CloseGoingAway, session.CodeShuttingDown, session.ErrDraining, 0)
+		return
+	}
+	q, err := url.ParseQuery(c.Settings())
+	var settings session.Settings
+	if err == nil {
+		settings, err = b.sessions.ParseSettings(q)
+	}
+	if err == nil {
+		_, tc := b.tenant(ctx)
+		err = settings.CheckEncoding(tc.encodings)
+	}
 	if err != nil {
-		log.Fatal("gRPC stream error:", err)
+		session.Reject(c, websocket.CloseUnsupportedData, session.CodeInvalidSettings, fmt.Errorf("invalid audio settings: %w", err), 0)
+		return
+	}
+	if settings.Locale == "" {
+		settings.Locale = session.AcceptLanguage(c.Header().Get("Accept-Language"))
+	}
+	b.serve(ctx, c, b.log.With("remote_addr", c.RemoteAddr().String()), settings)
+}
+
+// serve runs a session over ws with settings until it ends, ctx carrying
+// the caller's identity and tenant.
+func (b *bridge) serve(ctx context.Context, ws session.Conn, logger *slog.Logger, settings session.Settings) {
+	backends, route := b.backends, ""
+	rid := logging.RequestID(ctx)
+	if rid != "" {
+		logger = logger.With("request_id", rid)
+	}
+	tn, tc := b.tenant(ctx)
+	if tn != "" {
+		logger = logger.With("tenant", tn)
+	}
+	if tc.backends != nil {
+		backends = tc.backends
+	} else if r := b.routeModel(&settings); r != nil {
+		backends = r.backends
+		logger = logger.With("model", r.model)
+	}
+	var (
+		be, shadow *backend.Backend
+		pickErr    error
+	)
+	if b.embedded == nil {
+		if b.canary != nil && backends == b.backends && rand.Float64()*100 < b.cfg.CanaryPercent {
+			metrics.CanarySessions.WithLabelValues(b.cfg.CanaryMode).Inc()
+			if b.cfg.CanaryMode != "route" {
+				shadow, _ = b.canary.Pick()
+			} else {
+				backends, route = b.canary, "canary"
+				logger = logger.With("route", route)
+			}
+		}
+		be, pickErr = backends.Pick()
+		if pickErr == nil {
+			logger = logger.With("backend_addr", be.Addr)
+		}
+	}
+	if shadow != nil {
+		logger = logger.With("shadow_addr", shadow.Addr)
+	}
+	id, authenticated := auth.FromContext(ctx)
+	if authenticated {
+		logger = logger.With("subject", id.Subject)
 	}
 
-	// Send audio from WebSocket to gRPC
-	go func() {
-		for {
-			_, audio, err := ws.ReadMessage()
+	if over := b.quotas.Check(id.Subject, tn); over != nil {
+		metrics.RejectedUpgrades.WithLabelValues("quota").Inc()
+		logger.Warn("Session rejected", "reason", over)
+		session.Reject(ws, websocket.CloseTryAgainLater, session.CodeQuotaExceeded, over, time.Until(over.Resets))
+		return
+	}
+	sess, err := b.sessions.New(ws, logger)
+	switch {
+	case errors.Is(err, session.ErrAtCapacity):
+		metrics.RejectedUpgrades.WithLabelValues("capacity").Inc()
+		logger.Warn("Session rejected", "reason", err, "max_sessions", b.cfg.MaxSessions)
+		session.Reject(ws, websocket.CloseTryAgainLater, session.CodeCapacityExceeded, err, b.cfg.CapacityRetryAfter)
+		return
+	case errors.Is(err, session.ErrMaintenance):
+		mt, _ := b.sessions.Maintenance()
+		session.Reject(ws, websocket.CloseGoingAway, session.CodeShuttingDown, err, mt.RetryAfter)
+		return
+	case err != nil:
+		session.Reject(ws, websocket.CloseGoingAway, session.CodeShuttingDown, err, 0)
+		return
+	}
+	b.registry.Changed()
+	defer b.registry.Changed()
+	defer b.sessions.Remove(sess.ID)
+	sess.Subject = id.Subject
+	sess.Tenant = tn
+	sess.RequestID = rid
+	sess.Settings = settings
+	sess.Encodings = tc.encodings
+	sess.Route = route
+	sess.Compare = b.cfg.CanaryMode == "compare"
+	if b.embedded == nil {
+		sess.Failover = func(ctx context.Context) (pb.VADServiceClient, error) {
+			next, err := backends.Failover(ctx, be, b.cfg.BackendHealthService)
 			if err != nil {
-				log.Println("WS read error:", err)
-				break
+				return nil, err
 			}
-			// audioDuration := float64(len(audio)) / (16000 * 2)
-			// log.Printf("Audio chunk duration: %.3f seconds\n", audioDuration)
+			sess.Logger().Info("Failing over", "from", be.Addr, "to", next.Addr)
+			be = next
+			return be.Client()
+		}
+	}
 
-			stream.Send(&pb.AudioChunk{AudioData: audio})
+	// gRPC client; without one, the session runs on the fallback VAD.
+	var client pb.VADServiceClient
+	switch {
+	case b.embedded != nil:
+		client = b.embedded
+	case pickErr != nil:
+		err = pickErr
+	default:
+		client, err = be.Client()
+	}
+	if b.fallback != nil {
+		sess.Fallback = b.fallback
+	} else if err != nil {
+		sess.Fail(session.CodeBackendUnavailable, err)
+		return
+	}
+	if shadow != nil {
+		if sess.Shadow, err = shadow.Client(); err != nil {
+			logger.Warn("Shadow backend unavailable", "err", err)
 		}
-	}()
+	}
+	sess.Run(ctx, client)
+}
 
-	// Send VAD response back to browser
-	for {
-		resp, err := stream.Recv()
-		if err != nil {
-			log.Println("gRPC recv error:", err)
-			break
+// upgrade turns r into a session connection: a WebTransport session when it
+// came over HTTP/3 asking for one, a WebSocket otherwise.
+func (b *bridge) upgrade(w http.ResponseWriter, r *http.Request) (session.Conn, error) {
+	if b.wt != nil && webtransport.IsUpgrade(r) {
+		return b.wt.Upgrade(w, r)
+	}
+	return b.upgrader.Upgrade(w, r, nil)
+}
+
+// clients hands out the VAD clients of batch and NATS sessions.
+func (b *bridge) clients() batch.Clients {
+	if b.embedded != nil {
+		return b.embedded
+	}
+	return b.backends
+}
+
+// listen attaches a listen-only client to the session named by the listen
+// query parameter.
+func (b *bridge) listen(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("listen")
+	if _, ok := b.sessionFor(r.Context(), id); !ok {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+	ws, err := b.upgrade(w, r)
+	if err != nil {
+		slog.Warn("WebSocket upgrade error", "remote_addr", r.RemoteAddr, "err", err)
+		return
+	}
+	defer ws.Close()
+
+	logger := b.log.With("remote_addr", r.RemoteAddr)
+	if rid := logging.RequestID(r.Context()); rid != "" {
+		logger = logger.With("request_id", rid)
+	}
+	if id, ok := auth.FromContext(r.Context()); ok {
+		logger = logger.With("subject", id.Subject)
+	}
+	if tn := tenant.FromContext(r.Context()); tn != "" {
+		logger = logger.With("tenant", tn)
+	}
+	b.sessions.Listen(ws, id, logger)
+}
+
+// resume serves /ws?resume=<token>: the session the token names carries on
+// over this connection.
+func (b *bridge) resume(w http.ResponseWriter, r *http.Request, token string) {
+	ws, err := b.upgrade(w, r)
+	if err != nil {
+		slog.Warn("WebSocket upgrade error", "remote_addr", r.RemoteAddr, "err", err)
+		return
+	}
+	defer ws.Close()
+
+	id, _ := auth.FromContext(r.Context())
+	done, err := b.sessions.Resume(token, id.Subject, ws)
+	if errors.Is(err, session.ErrResumeNotFound) && b.registry != nil {
+		if c, ok := ws.(*websocket.Conn); ok {
+			err = b.resumeElsewhere(c, r, token)
+			if err == nil {
+				return
+			}
 		}
-		log.Printf("Received VAD response: %v\n", resp.GetEvent())
-		ws.WriteJSON(resp)
 	}
+	if err != nil {
+		b.log.Info("Session not resumed", "remote_addr", r.RemoteAddr, "err", err)
+		session.Reject(ws, websocket.ClosePolicyViolation, session.CodeSessionNotFound, err, 0)
+		return
+	}
+	<-done
+}
+
+// resumeElsewhere relays ws to the replica holding the session token
+// resumes. It fails, leaving ws untouched, when no other replica holds it
+// or that can't be reached.
+func (b *bridge) resumeElsewhere(ws *websocket.Conn, r *http.Request, token string) error {
+	owner, err := b.registry.Locate(r.Context(), token)
+	if errors.Is(err, cluster.ErrNotFound) {
+		return session.ErrResumeNotFound
+	}
+	if err != nil {
+		return err
+	}
+	logger := b.log.With("remote_addr", r.RemoteAddr, "session_id", owner.SessionID, "replica", owner.Replica)
+	logger.Info("Relaying resumed session to its replica")
+	err = cluster.Proxy(ws, r, owner, b.cfg.WSPath)
+	if errors.Is(err, cluster.ErrUnreachable) {
+		logger.Warn("Replica unreachable", "err", err)
+		return session.ErrResumeNotFound
+	}
+	logger.Info("Relay ended", "err", err)
+	return nil
 }
 
 func main() {
-	http.Handle("/", http.FileServer(http.Dir("./static")))
-	http.HandleFunc("/ws", wsHandler)
-	log.Println("Server listening on :8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	logger, err := logging.Setup(os.Stderr, cfg.LogFormat, cfg.LogLevel)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Endpoint:    cfg.OTelEndpoint,
+		Insecure:    cfg.OTelInsecure,
+		ServiceName: cfg.OTelServiceName,
+		SampleRatio: cfg.OTelSampleRatio,
+	})
+	if err != nil {
+		fatal("Tracing setup failed", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	var errs *reporting.Reporter
+	if cfg.ErrorReportingDSN != "" {
+		errs, err = reporting.New(reporting.Config{
+			DSN:         cfg.ErrorReportingDSN,
+			Environment: cfg.ErrorReportingEnvironment,
+			Release:     cfg.ErrorReportingRelease,
+		}, logger)
+		if err != nil {
+			fatal("Invalid error reporting configuration", err)
+		}
+		// Closed last, to send what shutting down reported.
+		defer errs.Close()
+		logger.Info("Reporting errors", "environment", cfg.ErrorReportingEnvironment)
+	}
+
+	var (
+		backends, canary *backend.Balancer
+		embedded         *localvad.Client
+		fallback         *localvad.Client
+	)
+	if cfg.VAD == config.VADEmbedded {
+		embedded = startLocalVAD("Embedded VAD", cfg.EmbeddedVADEngine, localvad.Timing{
+			MinSpeech:  cfg.EmbeddedVADMinSpeech,
+			MinSilence: cfg.EmbeddedVADMinSilence,
+		}, cfg)
+		logger.Info("Serving sessions with the embedded VAD", "engine", cfg.EmbeddedVADEngine)
+	} else {
+		backends, canary = openBackends(cfg, logger, errs)
+	}
+	tenants := openTenants(cfg, logger, errs)
+	models := openModelRoutes(cfg, logger, errs)
+	if cfg.FallbackVAD {
+		fallback = startLocalVAD("Fallback VAD", localvad.EngineEnergy, localvad.Timing{
+			MinSpeech:  cfg.FallbackMinSpeech,
+			MinSilence: cfg.FallbackMinSilence,
+		}, cfg)
+		logger.Info("Fallback VAD enabled", "threshold_dbfs", cfg.FallbackEnergyThreshold)
+	}
+
+	origins, err := origin.New(cfg.AllowedOrigins, cfg.AllowAllOrigins)
+	if err != nil {
+		fatal("Invalid origin allowlist", err)
+	}
+	if cfg.AllowAllOrigins {
+		slog.Warn("Accepting WebSocket upgrades from any origin; do not use in production")
+	}
+	cors, err := newCORS(cfg)
+	if err != nil {
+		fatal("Invalid CORS origins", err)
+	}
+
+	pipe := pipeline.Config{
+		Stages:        cfg.AudioPipeline,
+		FrameDuration: cfg.BackendFrameDuration,
+		Denoise:       cfg.Denoise,
+		AGCTargetDBFS: cfg.AGCTargetDBFS,
+		DTMF:          cfg.DTMF,
+	}
+	if err := pipe.Validate(); err != nil {
+		fatal("Invalid audio pipeline", err)
+	}
+	if err := session.CheckParams(cfg.QuerySettings); err != nil {
+		fatal("Invalid query settings", err)
+	}
+	if cfg.Denoise {
+		logger.Info("Suppressing noise in sessions' audio by default")
+	}
+	var (
+		wakeWord   *backend.Pool
+		wakeClient pb.VADServiceClient
+	)
+	if cfg.WakeWordAddr != "" {
+		wakeWord = backend.NewPool(cfg.WakeWordAddr, 1, backendDialOptions(cfg)...)
+		if wakeClient, err = wakeWord.Client(); err != nil {
+			fatal("Wake-word backend unavailable", err)
+		}
+		logger.Info("Gating sessions behind a wake word", "addr", cfg.WakeWordAddr, "event", cfg.WakeWordEvent)
+	}
+	var transcriber asr.Transcriber
+	if cfg.ASRURL != "" {
+		transcriber, err = asr.NewHTTP(asr.HTTPConfig{URL: cfg.ASRURL, Model: cfg.ASRModel, APIKey: cfg.ASRAPIKey})
+		if err != nil {
+			fatal("Speech-to-text unavailable", err)
+		}
+		logger.Info("Transcribing speech segments", "url", cfg.ASRURL, "model", cfg.ASRModel)
+	}
+
+	var synthesizer tts.Synthesizer
+	if cfg.TTSURL != "" {
+		synthesizer, err = tts.NewHTTP(tts.HTTPConfig{
+			URL:        cfg.TTSURL,
+			Model:      cfg.TTSModel,
+			Voice:      cfg.TTSVoice,
+			APIKey:     cfg.TTSAPIKey,
+			SampleRate: cfg.TTSSampleRate,
+		})
+		if err != nil {
+			fatal("Text-to-speech unavailable", err)
+		}
+		logger.Info("Speaking to clients", "url", cfg.TTSURL, "voice", cfg.TTSVoice)
+	}
+	var assistant llm.Completer
+	if cfg.LLMURL != "" {
+		assistant, err = llm.NewHTTP(llm.HTTPConfig{URL: cfg.LLMURL, Model: cfg.LLMModel, APIKey: cfg.LLMAPIKey})
+		if err != nil {
+			fatal("Chat completion unavailable", err)
+		}
+		logger.Info("Answering transcripts", "url", cfg.LLMURL, "model", cfg.LLMModel)
+	}
+
+	queuePolicy, err := session.ParseQueuePolicy(cfg.SendQueuePolicy)
+	if err != nil {
+		fatal("Invalid send queue policy", err)
+	}
+
+	var recorder *recording.Recorder
+	if cfg.RecordDir != "" {
+		recorder, err = recording.New(recording.Config{
+			Dir:           cfg.RecordDir,
+			MaxFileBytes:  cfg.RecordMaxFileBytes,
+			MaxTotalBytes: cfg.RecordMaxTotalBytes,
+			Upload: recording.UploadConfig{
+				Endpoint:  cfg.RecordS3Endpoint,
+				Bucket:    cfg.RecordS3Bucket,
+				Region:    cfg.RecordS3Region,
+				Prefix:    cfg.RecordS3Prefix,
+				AccessKey: cfg.RecordS3AccessKey,
+				SecretKey: cfg.RecordS3SecretKey,
+				Insecure:  cfg.RecordS3Insecure,
+				Retries:   cfg.RecordS3Retries,
+				Retention: cfg.RecordS3Retention,
+				KeepLocal: cfg.RecordS3KeepLocal,
+			},
+		}, logger)
+		if err != nil {
+			fatal("Recording unavailable", err)
+		}
+		logger.Info("Recording sessions", "dir", cfg.RecordDir)
+	}
+
+	limits := quota.Limits{Daily: cfg.QuotaDaily, Monthly: cfg.QuotaMonthly}
+	overrides, err := quota.ParseLimits(cfg.QuotaOverrides, limits)
+	if err != nil {
+		fatal("Invalid quota overrides", err)
+	}
+	quotas := quota.New(limits, overrides, tenantLimits(cfg))
+	viewers := events.NewHub(cfg.MaxListeners)
+	sinks := events.Sinks{viewers, quotas, tenant.Metrics{}}
+	var db *store.Store
+	if cfg.DBDSN != "" {
+		db, err = store.Open(context.Background(), cfg.DBDriver, cfg.DBDSN, logger)
+		if err != nil {
+			fatal("Session database unavailable", err)
+		}
+		sinks = append(sinks, db)
+		if err := quotas.Restore(context.Background(), db.Usage, db.TenantUsage); err != nil {
+			fatal("Quota usage unavailable", err)
+		}
+	}
+	var exporter *billing.Exporter
+	if cfg.BillingInterval > 0 {
+		exporter, err = billing.New(billing.Config{
+			Interval:      cfg.BillingInterval,
+			Dir:           cfg.BillingDir,
+			Formats:       cfg.BillingFormats,
+			WebhookURL:    cfg.BillingWebhookURL,
+			WebhookSecret: cfg.BillingWebhookSecret,
+		}, db, logger)
+		if err != nil {
+			fatal("Usage reports unavailable", err)
+		}
+		logger.Info("Exporting usage reports", "interval", cfg.BillingInterval.String(), "dir", cfg.BillingDir, "webhook", cfg.BillingWebhookURL != "")
+	}
+	var webhooks *webhook.Dispatcher
+	hooks := tenantHooks(cfg)
+	for _, w := range cfg.Webhooks {
+		hooks = append(hooks, webhook.Hook{URL: w.URL, Secret: w.Secret, Events: w.Events})
+	}
+	if len(hooks) > 0 {
+		webhooks, err = webhook.New(hooks, webhook.Options{
+			MaxAttempts:    cfg.WebhookMaxAttempts,
+			Timeout:        cfg.WebhookTimeout,
+			DeadLetterFile: cfg.WebhookDeadLetterFile,
+		}, logger)
+		if err != nil {
+			fatal("Webhooks unavailable", err)
+		}
+		sinks = append(sinks, webhooks)
+	}
+	var kafka *publish.Kafka
+	if len(cfg.KafkaBrokers) > 0 {
+		kafka, err = publish.NewKafka(publish.KafkaConfig{
+			Brokers:       cfg.KafkaBrokers,
+			Topic:         cfg.KafkaTopic,
+			Segments:      cfg.KafkaSegments,
+			TLS:           cfg.KafkaTLS,
+			SASLMechanism: cfg.KafkaSASLMechanism,
+			Username:      cfg.KafkaUsername,
+			Password:      cfg.KafkaPassword,
+		}, logger)
+		if err != nil {
+			fatal("Kafka publisher unavailable", err)
+		}
+		logger.Info("Publishing VAD events to Kafka", "brokers", cfg.KafkaBrokers, "topic", cfg.KafkaTopic)
+		sinks = append(sinks, kafka)
+	}
+	var nc *nats.Conn
+	var natsSink *publish.NATS
+	if cfg.NATSURL != "" {
+		nc, err = publish.ConnectNATS(cfg.NATSURL, cfg.NATSCredsFile, logger)
+		if err == nil {
+			natsSink, err = publish.NewNATS(nc, publish.NATSConfig{
+				Prefix:    cfg.NATSSubjectPrefix,
+				JetStream: cfg.NATSJetStream,
+				Segments:  cfg.NATSSegments,
+			}, logger)
+		}
+		if err != nil {
+			fatal("NATS unavailable", err)
+		}
+		logger.Info("Publishing session events to NATS", "url", cfg.NATSURL, "subjects", publish.EventsSubject(cfg.NATSSubjectPrefix, "*"))
+		sinks = append(sinks, natsSink)
+	}
+	var redis *publish.Redis
+	if cfg.RedisURL != "" {
+		redis, err = publish.NewRedis(publish.RedisConfig{
+			URL:      cfg.RedisURL,
+			Prefix:   cfg.RedisChannelPrefix,
+			Segments: cfg.RedisSegments,
+		}, logger)
+		if err != nil {
+			fatal("Redis publisher unavailable", err)
+		}
+		logger.Info("Broadcasting session events on Redis", "channels", publish.SessionChannel(cfg.RedisChannelPrefix, "*"))
+		sinks = append(sinks, redis)
+	}
+
+	b := &bridge{
+		cfg:      cfg,
+		log:      logger,
+		backends: backends,
+		canary:   canary,
+		embedded: embedded,
+		fallback: fallback,
+		wakeWord: wakeWord,
+		sessions: session.NewManager(session.Config{
+			MaxSessions:       cfg.MaxSessions,
+			MaxMessageBytes:   cfg.MaxMessageBytes,
+			QueueSize:         cfg.SendQueueSize,
+			QueuePolicy:       queuePolicy,
+			LatencyBudget:     cfg.RealtimeLatencyBudget,
+			PingInterval:      cfg.PingInterval,
+			PongTimeout:       cfg.PongTimeout,
+			IdleTimeout:       cfg.IdleTimeout,
+			ResumeWindow:      cfg.ResumeWindow,
+			HeartbeatInterval: cfg.HeartbeatInterval,
+			LevelInterval:     cfg.AudioLevelInterval,
+			DialTimeout:       cfg.BackendDialTimeout,
+			StreamDeadline:    cfg.BackendStreamDeadline,
+			ChunkAcks:         cfg.BackendChunkAcks,
+			StreamConfig:      cfg.BackendStreamConfig || cfg.VAD == config.VADEmbedded,
+			Pipeline:          pipe,
+			QueryParams:       cfg.QuerySettings,
+			JitterBuffer:      cfg.BackendJitterBuffer,
+			EchoLatency:       cfg.EchoChunkLatency,
+			EnrichEvents:      cfg.EnrichEvents,
+			FillGaps:          cfg.FillSequenceGaps,
+			FailoverAttempts:  cfg.BackendFailoverAttempts,
+			FailoverReplay:    cfg.BackendFailoverReplay,
+			OutageBuffer:      cfg.BackendOutageBuffer,
+			WakeWord:          wakeClient,
+			WakeEvent:         cfg.WakeWordEvent,
+			WakeWindow:        cfg.WakeWordWindow,
+			WakePreroll:       cfg.WakeWordPreroll,
+			Transcriber:       transcriber,
+			TranscribePreroll: cfg.ASRPreroll,
+			MaxTranscribed:    cfg.ASRMaxSegment,
+			TranscribeTimeout: cfg.ASRTimeout,
+			Clips:             cfg.SegmentClips,
+			Synthesizer:       synthesizer,
+			Assistant:         assistant,
+			SystemPrompt:      cfg.LLMPrompt,
+			MaxTurns:          cfg.LLMMaxTurns,
+			ReplyTimeout:      cfg.LLMTimeout,
+			BargeIn:           cfg.BargeIn,
+			Recorder:          recorder,
+			Events:            sinks,
+			Viewers:           viewers,
+			Errors:            errs,
+		}),
+		recorder: recorder,
+		db:       db,
+		webhooks: webhooks,
+		kafka:    kafka,
+		nats:     nc,
+		natsSink: natsSink,
+		redis:    redis,
+		quotas:   quotas,
+		tenants:  tenants,
+		resolver: tenantResolver(cfg),
+		models:   models,
+		billing:  exporter,
+		viewers:  viewers,
+		upgrader: websocket.Upgrader{
+			CheckOrigin:  origins.CheckOrigin,
+			Subprotocols: []string{session.SubprotocolJSON, session.SubprotocolBinary},
+		},
+	}
+
+	quotas.Enforce(b.sessions)
+
+	if cfg.ClusterRedisURL != "" {
+		replica := cfg.ClusterReplica
+		if replica == "" {
+			replica, _ = os.Hostname()
+		}
+		b.registry, err = cluster.New(cluster.Config{
+			URL:          cfg.ClusterRedisURL,
+			Prefix:       cfg.ClusterKeyPrefix,
+			Replica:      replica,
+			AdvertiseURL: cfg.ClusterAdvertiseURL,
+		}, b.sessions, logger)
+		if err != nil {
+			fatal("Session registry unavailable", err)
+		}
+		logger.Info("Sharing sessions with other replicas", "replica", replica, "advertise_url", cfg.ClusterAdvertiseURL)
+	}
+
+	authenticators, err := newAuthenticators(cfg)
+	if err != nil {
+		fatal("Authentication setup failed", err)
+	}
+	b.authenticators = authenticators
+
+	if cfg.NATSAudio {
+		b.natsAudio, err = ingest.NewNATS(nc, b.clients(), b.sessions, sinks, cfg.NATSSubjectPrefix, cfg.NATSAudioIdleTimeout, logger)
+		if err != nil {
+			fatal("NATS audio unavailable", err)
+		}
+		logger.Info("Accepting audio sessions over NATS", "subject", cfg.NATSSubjectPrefix+".audio.start")
+	}
+
+	if cfg.TwilioPath != "" {
+		b.twilio = ingest.NewTwilio(b.clients(), b.sessions, sinks, cfg.TwilioAuthToken, logger)
+		var h http.Handler = b.twilio
+		if cfg.TwilioAuthToken == "" {
+			h = b.protect(h)
+		}
+		http.Handle(cfg.TwilioPath, h)
+		logger.Info("Accepting Twilio Media Streams", "path", cfg.TwilioPath, "signed", cfg.TwilioAuthToken != "")
+	}
+
+	if cfg.SIPAddr != "" {
+		var nets []*net.IPNet
+		for _, cidr := range cfg.SIPAllowedCIDRs {
+			_, n, _ := net.ParseCIDR(cidr)
+			nets = append(nets, n)
+		}
+		b.sip, err = ingest.NewSIP(ingest.SIPConfig{
+			Addr:        cfg.SIPAddr,
+			RTPPortMin:  cfg.RTPPortMin,
+			RTPPortMax:  cfg.RTPPortMax,
+			PublicIP:    cfg.SIPPublicIP,
+			RTPTimeout:  cfg.RTPTimeout,
+			AllowedNets: nets,
+		}, b.clients(), b.sessions, b.sessions, sinks, logger)
+		if err != nil {
+			fatal("SIP listener unavailable", err)
+		}
+		logger.Info("Answering SIP calls", "addr", b.sip.Addr().String(), "rtp_ports", fmt.Sprintf("%d-%d", cfg.RTPPortMin, cfg.RTPPortMax))
+	}
+
+	if cfg.WebRTCPath != "" {
+		b.webrtc, err = ingest.NewWebRTC(ingest.WebRTCConfig{
+			Path:        cfg.WebRTCPath,
+			ICEServers:  cfg.WebRTCICEServers,
+			PublicIP:    cfg.WebRTCPublicIP,
+			UDPAddr:     cfg.WebRTCUDPAddr,
+			CheckOrigin: origins.CheckOrigin,
+		}, b.clients(), b.sessions, sinks, logger)
+		if err != nil {
+			fatal("WebRTC unavailable", err)
+		}
+		h := b.protect(b.webrtc)
+		http.Handle(cfg.WebRTCPath, h)
+		http.Handle(strings.TrimSuffix(cfg.WebRTCPath, "/")+"/", h)
+		logger.Info("Accepting WebRTC sessions", "path", cfg.WebRTCPath)
+	}
+
+	if cfg.MQTTURL != "" {
+		b.mqtt, err = ingest.NewMQTT(ingest.MQTTConfig{
+			Broker:   cfg.MQTTURL,
+			ClientID: cfg.MQTTClientID,
+			Username: cfg.MQTTUsername,
+			Password: cfg.MQTTPassword,
+			Prefix:   cfg.MQTTTopicPrefix,
+			Settings: cfg.MQTTSettings,
+			Idle:     cfg.MQTTIdleTimeout,
+		}, b.clients(), b.sessions, sinks, logger)
+		if err != nil {
+			fatal("MQTT unavailable", err)
+		}
+		logger.Info("Taking device audio over MQTT", "broker", cfg.MQTTURL, "topic", cfg.MQTTTopicPrefix+"/+/audio")
+	}
+
+	static, err := staticHandler(cfg.StaticDir)
+	if err != nil {
+		fatal("Static directory unavailable", err)
+	}
+	if cfg.StaticDir != "" {
+		logger.Info("Serving the frontend from disk", "dir", cfg.StaticDir)
+	}
+	http.Handle("/", static)
+	var ipLimiter *limit.IPLimiter
+	if cfg.IPSessionsPerMinute > 0 || cfg.IPMaxSessions > 0 {
+		ipLimiter = limit.NewIPLimiter(cfg.IPSessionsPerMinute, cfg.IPMaxSessions, cfg.TrustProxyHeaders)
+	}
+	var ws http.Handler = b.protect(http.HandlerFunc(b.wsHandler))
+	if ipLimiter != nil {
+		ws = ipLimiter.Middleware(ws)
+	}
+	http.Handle(cfg.WSPath, b.explainRejections(ws))
+	if cfg.GRPCService {
+		rpc := b.protect(grpcapi.NewServer(b.rpcHandler))
+		h := rpc
+		if ipLimiter != nil {
+			h = ipLimiter.Middleware(rpc)
+			http.Handle(grpcapi.SendPath, rpc)
+		}
+		http.Handle(grpcapi.Path, h)
+		logger.Info("Serving sessions over gRPC", "service", strings.Trim(grpcapi.Path, "/"))
+	}
+	if cfg.BatchMaxBytes > 0 {
+		http.Handle("/v1/vad", cors.Middleware(b.protect(batch.New(b.clients(), b.sessions, quotas, b.routeBatch, cfg.BatchMaxBytes, cfg.BatchSpeed, logger))))
+	}
+	if db != nil {
+		api := cors.Middleware(b.protect(store.NewAPI(db)))
+		http.Handle("/v1/sessions", api)
+		http.Handle("/v1/sessions/", api)
+		http.Handle("/v1/stats", api)
+	}
+	if synthesizer != nil {
+		http.Handle("/v1/sessions/{id}/speak", cors.Middleware(b.protect(b.speakHandler())))
+	}
+	http.Handle("/events/", cors.Middleware(b.protect(sse.Handler(viewers, func(ctx context.Context, id string) bool {
+		_, ok := b.sessionFor(ctx, id)
+		return ok
+	}))))
+	admins, err := newAdminAuthenticator(cfg)
+	if err != nil {
+		fatal("Admin authentication setup failed", err)
+	}
+	if admins != nil {
+		http.Handle("/admin/", cors.Middleware(auth.Middleware(admin.Handler(b.sessions, b.health(), b.registry, quotas, logger), admins)))
+		http.Handle("/admin/dashboard/", admin.Dashboard())
+		if db != nil {
+			http.Handle("/admin/billing", cors.Middleware(auth.Middleware(billing.Handler(db), admins)))
+		}
+		if cfg.DebugEndpoints {
+			http.Handle("/debug/", auth.Middleware(admin.Debug(), admins))
+			logger.Info("Serving runtime diagnostics", "path", "/debug/")
+		}
+		logger.Info("Serving the admin API", "path", "/admin/", "dashboard", "/admin/dashboard/")
+	}
+	protos, err := fs.Sub(protoFiles, "proto")
+	if err != nil {
+		fatal("Protocol schema unavailable", err)
+	}
+	describe := cors.Middleware(schema.Handler(protos))
+	http.Handle("/schema", describe)
+	http.Handle("/schema/", describe)
+	http.HandleFunc("/healthz", b.healthz)
+	http.HandleFunc("/readyz", b.readyz)
+	if cfg.MetricsPath != "" {
+		http.Handle(cfg.MetricsPath, metrics.Handler())
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	handler := logging.Middleware(logging.Recover(http.DefaultServeMux, logger, errs), logger, cfg.AccessLog)
+	if cfg.WebTransportAddr != "" {
+		b.wt = webtransport.NewServer(cfg.WebTransportAddr, handler, b.upgrader.Subprotocols, origins.CheckOrigin)
+	}
+	srv := newServer(cfg, handler, b.wt)
+	errc := make(chan error, 1)
+	go func() { errc <- srv.ListenAndServe() }()
+
+	select {
+	case err := <-errc:
+		if err != nil {
+			fatal("Server failed", err)
+		}
+		return
+	case <-ctx.Done():
+	}
+	stop()
+
+	slog.Info("Shutting down", "sessions", b.sessions.Len(), "drain_timeout", cfg.ShutdownTimeout.String())
+	drainCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	b.shutdown(drainCtx, srv)
+}
+
+// shutdown stops accepting connections, lets open sessions flush their last
+// events, releases the backend connections and flushes what the sessions
+// left to store and upload.
+func (b *bridge) shutdown(ctx context.Context, srv *server) {
+	// Event streams are plain requests that Shutdown would wait for, as it
+	// does for gRPC sessions while they drain.
+	b.viewers.Close()
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- srv.Shutdown(ctx) }()
+	if err := b.sessions.Drain(ctx); err != nil {
+		slog.Warn("Sessions closed before draining", "sessions", b.sessions.Len(), "err", err)
+	}
+	if err := <-shutdown; err != nil {
+		slog.Warn("HTTP shutdown incomplete", "err", err)
+	}
+	if err := srv.Close(); err != nil {
+		slog.Warn("Closing WebTransport listener failed", "err", err)
+	}
+	if b.registry != nil {
+		if err := b.registry.Close(ctx); err != nil {
+			slog.Warn("Sessions left in the registry until they expire", "err", err)
+		}
+	}
+	if b.natsAudio != nil {
+		if err := b.natsAudio.Close(ctx); err != nil {
+			slog.Warn("NATS sessions closed before draining", "err", err)
+		}
+	}
+	if b.twilio != nil {
+		if err := b.twilio.Close(ctx); err != nil {
+			slog.Warn("Twilio streams closed before draining", "err", err)
+		}
+	}
+	if b.sip != nil {
+		if err := b.sip.Close(ctx); err != nil {
+			slog.Warn("SIP calls closed before draining", "err", err)
+		}
+	}
+	if b.webrtc != nil {
+		if err := b.webrtc.Close(ctx); err != nil {
+			slog.Warn("WebRTC sessions closed before draining", "err", err)
+		}
+	}
+	if b.mqtt != nil {
+		if err := b.mqtt.Close(ctx); err != nil {
+			slog.Warn("MQTT sessions closed before draining", "err", err)
+		}
+	}
+	if b.backends != nil {
+		if err := b.backends.Close(); err != nil {
+			slog.Warn("Closing backend connections failed", "err", err)
+		}
+	}
+	if b.embedded != nil {
+		b.embedded.Close()
+	}
+	if b.canary != nil {
+		if err := b.canary.Close(); err != nil {
+			slog.Warn("Closing canary backend connections failed", "err", err)
+		}
+	}
+	for _, r := range b.models {
+		if err := r.backends.Close(); err != nil {
+			slog.Warn("Closing model backend connections failed", "model", r.model, "err", err)
+		}
+	}
+	for name, tc := range b.tenants {
+		if tc.backends != nil {
+			if err := tc.backends.Close(); err != nil {
+				slog.Warn("Closing tenant backend connections failed", "tenant", name, "err", err)
+			}
+		}
+	}
+	if b.fallback != nil {
+		b.fallback.Close()
+	}
+	if b.wakeWord != nil {
+		if err := b.wakeWord.Close(); err != nil {
+			slog.Warn("Closing wake-word backend connection failed", "err", err)
+		}
+	}
+	if b.billing != nil {
+		b.billing.Close()
+	}
+	if b.db != nil {
+		if err := b.db.Close(); err != nil {
+			slog.Warn("Closing session database failed", "err", err)
+		}
+	}
+	if b.webhooks != nil {
+		if err := b.webhooks.Close(ctx); err != nil {
+			slog.Warn("Webhook deliveries dead-lettered at shutdown", "err", err)
+		}
+	}
+	if b.kafka != nil {
+		if err := b.kafka.Close(ctx); err != nil {
+			slog.Warn("Kafka events dropped at shutdown", "err", err)
+		}
+	}
+	if b.natsSink != nil {
+		if err := b.natsSink.Close(ctx); err != nil {
+			slog.Warn("NATS events dropped at shutdown", "err", err)
+		}
+	}
+	if b.nats != nil {
+		b.nats.Close()
+	}
+	if b.redis != nil {
+		if err := b.redis.Close(ctx); err != nil {
+			slog.Warn("Redis events dropped at shutdown", "err", err)
+		}
+	}
+	if b.recorder != nil {
+		if err := b.recorder.Close(ctx); err != nil {
+			slog.Warn("Recording uploads left for the next start", "err", err)
+		}
+	}
+	slog.Info("Shutdown complete")
+}
+
+// openBackends connects to the VAD backends, and the canary ones if any,
+// reporting their failures to errs.
+func openBackends(cfg config.Config, logger *slog.Logger, errs *reporting.Reporter) (backends, canary *backend.Balancer) {
+	dialOpts := backendDialOptions(cfg)
+	var discovery backend.Resolver
+	var err error
+	if cfg.BackendDiscovery != "" {
+		discovery, err = backend.ParseDiscovery(cfg.BackendDiscovery)
+		if err != nil {
+			fatal("Invalid backend configuration", err)
+		}
+	}
+	// Warm streams are opened before their session exists.
+	warmMetadata := metadata.Pairs(session.DefaultSettings().Metadata()...)
+	backends, err = backend.NewBalancer(backend.BalancerConfig{
+		Addrs:           cfg.Backends(),
+		Policy:          cfg.BackendBalance,
+		PoolSize:        cfg.BackendPoolSize,
+		HealthInterval:  cfg.BackendHealthInterval,
+		HealthTimeout:   cfg.BackendHealthTimeout,
+		HealthService:   cfg.BackendHealthService,
+		BreakerFailures: cfg.BackendBreakerFailures,
+		BreakerCooldown: cfg.BackendBreakerCooldown,
+		Discovery:       discovery,
+		RefreshInterval: cfg.BackendDiscoveryInterval,
+		WarmStreams:     cfg.BackendWarmStreams,
+		WarmMetadata:    warmMetadata,
+		Errors:          errs,
+	}, logger, dialOpts...)
+	if err != nil {
+		fatal("Invalid backend configuration", err)
+	}
+	if len(cfg.CanaryAddrs) > 0 {
+		canary, err = backend.NewBalancer(backend.BalancerConfig{
+			Addrs:           cfg.CanaryAddrs,
+			Policy:          cfg.BackendBalance,
+			PoolSize:        cfg.BackendPoolSize,
+			HealthInterval:  cfg.BackendHealthInterval,
+			HealthTimeout:   cfg.BackendHealthTimeout,
+			HealthService:   cfg.BackendHealthService,
+			BreakerFailures: cfg.BackendBreakerFailures,
+			BreakerCooldown: cfg.BackendBreakerCooldown,
+			WarmStreams:     cfg.BackendWarmStreams,
+			WarmMetadata:    warmMetadata,
+			Errors:          errs,
+		}, logger.With("canary", true), dialOpts...)
+		if err != nil {
+			fatal("Invalid canary backend configuration", err)
+		}
+		logger.Info("Canary backends enabled", "backends", cfg.CanaryAddrs, "percent", cfg.CanaryPercent, "mode", cfg.CanaryMode)
+	}
+	if discovery != nil {
+		logger.Info("Discovering backends", "uri", cfg.BackendDiscovery, "backends", backends.Addrs())
+	}
+	return backends, canary
+}
+
+// openRouteBackends connects to backends serving some of the sessions
+// only, configured like the shared ones; md is added to the metadata of
+// their warm streams.
+func openRouteBackends(cfg config.Config, addrs []string, logger *slog.Logger, errs *reporting.Reporter, md ...string) (*backend.Balancer, error) {
+	return backend.NewBalancer(backend.BalancerConfig{
+		Addrs:           addrs,
+		Policy:          cfg.BackendBalance,
+		PoolSize:        cfg.BackendPoolSize,
+		HealthInterval:  cfg.BackendHealthInterval,
+		HealthTimeout:   cfg.BackendHealthTimeout,
+		HealthService:   cfg.BackendHealthService,
+		BreakerFailures: cfg.BackendBreakerFailures,
+		BreakerCooldown: cfg.BackendBreakerCooldown,
+		WarmStreams:     cfg.BackendWarmStreams,
+		WarmMetadata:    metadata.Pairs(append(session.DefaultSettings().Metadata(), md...)...),
+		Errors:          errs,
+	}, logger, backendDialOptions(cfg)...)
+}
+
+// backendDialOptions returns the credentials and transport settings every
+// gRPC backend is dialed with.
+func backendDialOptions(cfg config.Config) []grpc.DialOption {
+	creds := backend.Credentials{
+		TLS:        cfg.BackendTLS,
+		CAFile:     cfg.BackendCAFile,
+		CertFile:   cfg.BackendCertFile,
+		KeyFile:    cfg.BackendKeyFile,
+		ServerName: cfg.BackendServerName,
+		Token:      cfg.BackendAuthToken,
+		TokenFile:  cfg.BackendAuthTokenFile,
+	}
+	dialOpts, err := creds.DialOptions()
+	if err != nil {
+		fatal("Backend credentials invalid", err)
+	}
+	return append(dialOpts, backend.Transport{
+		KeepaliveTime:    cfg.BackendKeepaliveTime,
+		KeepaliveTimeout: cfg.BackendKeepaliveTimeout,
+		MaxMessageBytes:  cfg.BackendMaxMessageBytes,
+	}.DialOptions()...)
+}
+
+// startLocalVAD runs engine in-process; what names it in log messages.
+func startLocalVAD(what, engine string, t localvad.Timing, cfg config.Config) *localvad.Client {
+	srv, err := localvad.NewEngineServer(engine, cfg.EmbeddedAggressiveness, localvad.EnergyConfig{
+		Threshold:    cfg.FallbackEnergyThreshold,
+		ZCRThreshold: cfg.FallbackZCRThreshold,
+	}, t)
+	if err != nil {
+		fatal(what+" unavailable", err)
+	}
+	client, err := localvad.NewClient(srv)
+	if err != nil {
+		fatal(what+" unavailable", err)
+	}
+	return client
+}
+
+// newCORS returns the CORS handling cfg configures, nil when it names no
+// origins.
+func newCORS(cfg config.Config) (*origin.CORS, error) {
+	if len(cfg.CORSOrigins) == 0 {
+		return nil, nil
+	}
+	patterns := slices.DeleteFunc(slices.Clone(cfg.CORSOrigins), func(p string) bool { return p == "*" })
+	origins, err := origin.New(patterns, len(patterns) < len(cfg.CORSOrigins))
+	if err != nil {
+		return nil, err
+	}
+	return &origin.CORS{
+		Origins:     origins,
+		Methods:     cfg.CORSMethods,
+		Headers:     cfg.CORSHeaders,
+		Expose:      []string{logging.HeaderRequestID, "Retry-After"},
+		Credentials: cfg.CORSCredentials,
+		MaxAge:      cfg.CORSMaxAge,
+	}, nil
+}
+
+// fatal logs err and exits the process.
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
 }
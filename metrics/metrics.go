@@ -0,0 +1,290 @@
+// metrics/metrics.go
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "vad_bridge"
+
+var (
+	// ActiveSessions is the number of WebSocket sessions currently open.
+	ActiveSessions = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_sessions",
+		Help:      "WebSocket sessions currently open.",
+	})
+
+	// AudioBytes counts audio bytes forwarded to the VAD backend.
+	AudioBytes = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "audio_bytes_total",
+		Help:      "Audio bytes forwarded from WebSocket clients to the VAD backend.",
+	})
+
+	// Events counts VAD events relayed to clients, by event type.
+	Events = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "vad_events_total",
+		Help:      "VAD events relayed to clients, by event type.",
+	}, []string{"event"})
+
+	// StreamErrors counts failed gRPC streams, by gRPC status code.
+	StreamErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "grpc_stream_errors_total",
+		Help:      "gRPC stream failures, by gRPC status code.",
+	}, []string{"code"})
+
+	// RejectedUpgrades counts WebSocket upgrades refused before a session
+	// started, by reason.
+	RejectedUpgrades = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rejected_upgrades_total",
+		Help:      "WebSocket upgrades refused before a session started, by reason.",
+	}, []string{"reason"})
+
+	// Panics counts panics recovered from, by where they happened: an HTTP
+	// handler or one of a session's goroutines.
+	Panics = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "panics_total",
+		Help:      "Panics recovered from, by where they happened.",
+	}, []string{"where"})
+
+	// InvalidFrames counts client frames that closed their session, by
+	// reason.
+	InvalidFrames = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "invalid_frames_total",
+		Help:      "Client frames rejected as oversized or malformed, by reason.",
+	}, []string{"reason"})
+
+	// QueuedChunks is the number of audio chunks waiting to be sent to the
+	// backend, across all sessions.
+	QueuedChunks = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "queued_chunks",
+		Help:      "Audio chunks waiting in send queues for the VAD backend.",
+	})
+
+	// DroppedChunks counts audio chunks given up on because a send queue was
+	// full, by queue policy.
+	DroppedChunks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "dropped_chunks_total",
+		Help:      "Audio chunks dropped because the VAD backend fell behind, by queue policy.",
+	}, []string{"policy"})
+
+	// ChunkForwardLatency measures how long an audio chunk spends in the
+	// bridge, from WebSocket receipt until it has been sent on the stream.
+	ChunkForwardLatency = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "chunk_forward_seconds",
+		Help:      "Time from receiving an audio chunk on the WebSocket until it is sent to the backend.",
+		Buckets:   []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	})
+
+	// ChunkLatency is the time from an audio chunk reaching the backend
+	// (stage backend), or the bridge (stage total), until the backend
+	// acknowledged it. Only backends acknowledging every chunk are measured.
+	ChunkLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "chunk_latency_seconds",
+		Help:      "Time from sending an audio chunk until the VAD backend's response to it, by stage.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"stage"})
+
+	// BackendStreams tracks the ProcessAudio streams open on each backend.
+	BackendStreams = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "backend_streams",
+		Help:      "ProcessAudio streams open on each VAD backend.",
+	}, []string{"backend"})
+
+	// BackendHealthy is the latest health probe result per backend.
+	BackendHealthy = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "backend_healthy",
+		Help:      "Whether the latest gRPC health probe of each VAD backend passed (1) or not (0).",
+	}, []string{"backend"})
+
+	// BackendCircuitOpen is 1 while a backend's circuit breaker is open or
+	// half-open.
+	BackendCircuitOpen = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "backend_circuit_open",
+		Help:      "Whether the circuit breaker of each VAD backend is open (1) or closed (0).",
+	}, []string{"backend"})
+
+	// BackendWarmStreams tracks the streams kept open on each backend for
+	// sessions to claim.
+	BackendWarmStreams = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "backend_warm_streams",
+		Help:      "Idle ProcessAudio streams kept open on each VAD backend for new sessions.",
+	}, []string{"backend"})
+
+	// WarmStreamClaims counts sessions that looked for a warm stream, by
+	// result: hit or miss.
+	WarmStreamClaims = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "warm_stream_claims_total",
+		Help:      "Sessions that claimed a warm backend stream (hit) or found none (miss).",
+	}, []string{"result"})
+
+	// CanarySessions counts sessions sent to or shadowed on the canary
+	// backends, by mode.
+	CanarySessions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "canary_sessions_total",
+		Help:      "Sessions routed to or shadowed on the canary VAD backends.",
+	}, []string{"mode"})
+
+	// ComparisonAgreement is the share of each compared session's audio on
+	// which the primary and shadow backends agreed.
+	ComparisonAgreement = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "comparison_agreement_ratio",
+		Help:      "Share of a compared session's audio the primary and shadow VAD backends classified alike.",
+		Buckets:   []float64{.5, .75, .9, .95, .98, .99, .995, 1},
+	})
+
+	// BackendFailovers counts sessions moved off a broken backend stream,
+	// by result: ok or failed.
+	BackendFailovers = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "backend_failovers_total",
+		Help:      "Attempts to move a session to another VAD backend after its stream broke.",
+	}, []string{"result"})
+
+	// FallbackSessions counts sessions served by the built-in VAD because
+	// no backend was reachable.
+	FallbackSessions = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "fallback_sessions_total",
+		Help:      "Sessions switched to the built-in fallback VAD because no backend was reachable.",
+	})
+
+	// WakeWords counts wake words the wake-word backend detected.
+	WakeWords = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "wake_words_total",
+		Help:      "Wake words detected in sessions' held-back audio.",
+	})
+
+	// SequenceAnomalies counts sequenced audio frames that were lost or
+	// arrived late, by kind.
+	SequenceAnomalies = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sequence_anomalies_total",
+		Help:      "Sequenced audio frames clients sent that never arrived (lost) or arrived out of order (late).",
+	}, []string{"kind"})
+
+	// SpeechClips counts speech segments cut into clips.
+	SpeechClips = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "speech_clips_total",
+		Help:      "Speech segments whose audio was delivered as a WAV clip.",
+	})
+
+	// DTMFDigits counts keypad tones heard in sessions' audio.
+	DTMFDigits = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "dtmf_digits_total",
+		Help:      "Telephone keypad digits detected in session audio.",
+	})
+
+	// Transcriptions counts speech segments sent for transcription, by
+	// result: ok, failed or dropped.
+	Transcriptions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "transcriptions_total",
+		Help:      "Speech segments handed to the speech-to-text service, by result.",
+	}, []string{"result"})
+
+	// TranscriptionLatency is how long each transcription request took.
+	TranscriptionLatency = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "transcription_duration_seconds",
+		Help:      "Time the speech-to-text service took to transcribe one speech segment.",
+		Buckets:   []float64{.1, .25, .5, 1, 2, 5, 10, 30},
+	})
+
+	// AssistantReplies counts transcripts handed to the assistant, by
+	// result: ok, failed, interrupted or dropped.
+	AssistantReplies = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "assistant_replies_total",
+		Help:      "Transcripts handed to the chat completion service, by result.",
+	}, []string{"result"})
+
+	// AssistantLatency is how long the assistant took to start replying.
+	AssistantLatency = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "assistant_first_token_seconds",
+		Help:      "Time from a transcript to the first piece of the assistant's reply.",
+		Buckets:   []float64{.1, .25, .5, 1, 2, 5, 10, 30},
+	})
+
+	// BargeIns counts assistant replies cancelled because the user spoke.
+	BargeIns = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "barge_ins_total",
+		Help:      "Times users spoke over the assistant and its reply was cancelled.",
+	})
+
+	// Utterances counts speech played back to clients, by how it ended:
+	// done, interrupted or failed.
+	Utterances = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "utterances_total",
+		Help:      "Synthesized utterances streamed to clients, by how they ended.",
+	}, []string{"reason"})
+
+	// SinkDropped counts session events an event sink could not deliver,
+	// by sink.
+	SinkDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sink_dropped_events_total",
+		Help:      "Session events lost by an event sink that fell behind or failed, by sink.",
+	}, []string{"sink"})
+
+	// TenantSessions counts the sessions started for each tenant.
+	TenantSessions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tenant_sessions_total",
+		Help:      "Sessions started, by tenant.",
+	}, []string{"tenant"})
+
+	// TenantActiveSessions is the number of each tenant's sessions open.
+	TenantActiveSessions = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "tenant_active_sessions",
+		Help:      "Sessions currently open, by tenant.",
+	}, []string{"tenant"})
+
+	// TenantAudioSeconds counts the audio each tenant's finished sessions
+	// sent to the backend.
+	TenantAudioSeconds = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tenant_audio_seconds_total",
+		Help:      "Seconds of audio sent to the backend by finished sessions, by tenant.",
+	}, []string{"tenant"})
+
+	// TenantEvents counts VAD events relayed to each tenant's clients.
+	TenantEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tenant_vad_events_total",
+		Help:      "VAD events relayed to clients, by tenant and event type.",
+	}, []string{"tenant", "event"})
+)
+
+// Handler serves the registered metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,78 @@
+// models.go
+package main
+
+import (
+	"fmt"
+	"log/slog"
+
+	"vad-application/audio"
+	"vad-application/backend"
+	"vad-application/batch"
+	"vad-application/config"
+	"vad-application/reporting"
+	"vad-application/session"
+)
+
+// modelRoute is the backends serving one model.
+type modelRoute struct {
+	model     string
+	languages []string
+	backends  *backend.Balancer
+}
+
+// openModelRoutes connects to the backends of the model routes.
+func openModelRoutes(cfg config.Config, logger *slog.Logger, errs *reporting.Reporter) []*modelRoute {
+	var routes []*modelRoute
+	for _, r := range cfg.ModelRoutes {
+		backends, err := openRouteBackends(cfg, r.BackendAddrs, logger.With("model", r.Model), errs, session.MetadataModel, r.Model)
+		if err != nil {
+			fatal("Invalid model route", fmt.Errorf("model %q: %w", r.Model, err))
+		}
+		routes = append(routes, &modelRoute{model: r.Model, languages: r.Languages, backends: backends})
+		logger.Info("Routing model", "model", r.Model, "languages", r.Languages, "backends", r.BackendAddrs)
+	}
+	return routes
+}
+
+// routeModel returns the route serving st: that of the model it asks for,
+// or else of its language, which then becomes its model. It is nil for
+// sessions the shared backends serve.
+func (b *bridge) routeModel(st *session.Settings) *modelRoute {
+	if st.Model != "" {
+		for _, r := range b.models {
+			if r.model == st.Model {
+				return r
+			}
+		}
+		return nil
+	}
+	lang := st.Language()
+	if lang == "" {
+		return nil
+	}
+	for _, r := range b.models {
+		for _, l := range r.languages {
+			if l == lang {
+				st.Model = r.model
+				return r
+			}
+		}
+	}
+	return nil
+}
+
+// routeBatch serves batch requests like sessions: from their tenant's
+// backends if it has its own, else from those of their model.
+func (b *bridge) routeBatch(tn string, st *session.Settings) (batch.Clients, []audio.Encoding) {
+	tc := b.tenants[tn]
+	if tc == nil {
+		tc = &tenantConfig{}
+	}
+	if tc.backends != nil {
+		return tc.backends, tc.encodings
+	}
+	if r := b.routeModel(st); r != nil {
+		return r.backends, tc.encodings
+	}
+	return nil, tc.encodings
+}
@@ -0,0 +1,83 @@
+// origin/cors.go
+package origin
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORS lets browser apps on the origins of an Allowlist call the endpoints
+// it wraps, answering their preflight requests.
+type CORS struct {
+	// Origins are those allowed; others get no CORS headers, which makes
+	// browsers refuse them the response.
+	Origins *Allowlist
+	// Methods and Headers are the request methods and headers allowed.
+	Methods []string
+	Headers []string
+	// Expose lists the response headers browser scripts may read.
+	Expose []string
+	// Credentials lets requests carry cookies and HTTP authentication.
+	Credentials bool
+	// MaxAge is how long browsers may cache a preflight's answer; zero
+	// leaves it to them.
+	MaxAge time.Duration
+}
+
+// Middleware adds c's headers to the responses of next, and answers
+// preflight requests itself, before next's authentication asks for
+// credentials they don't carry. A nil c returns next.
+func (c *CORS) Middleware(next http.Handler) http.Handler {
+	if c == nil {
+		return next
+	}
+	methods := strings.Join(c.Methods, ", ")
+	headers := strings.Join(c.Headers, ", ")
+	expose := strings.Join(c.Expose, ", ")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		o := r.Header.Get("Origin")
+		if o == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if !c.Origins.Allowed(o) {
+			if preflight {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		h.Set("Access-Control-Allow-Origin", o)
+		if c.Credentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if !preflight {
+			if expose != "" {
+				h.Set("Access-Control-Expose-Headers", expose)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		h.Add("Vary", "Access-Control-Request-Method")
+		h.Add("Vary", "Access-Control-Request-Headers")
+		if !slices.Contains(c.Methods, r.Header.Get("Access-Control-Request-Method")) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		h.Set("Access-Control-Allow-Methods", methods)
+		if headers != "" {
+			h.Set("Access-Control-Allow-Headers", headers)
+		}
+		if c.MaxAge > 0 {
+			h.Set("Access-Control-Max-Age", strconv.Itoa(int(c.MaxAge.Seconds())))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
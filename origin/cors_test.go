@@ -0,0 +1,103 @@
+// origin/cors_test.go
+package origin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCORS(t *testing.T) {
+	allow, err := New([]string{"https://app.example.com"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &CORS{
+		Origins:     allow,
+		Methods:     []string{"GET", "POST"},
+		Headers:     []string{"Authorization", "Content-Type"},
+		Expose:      []string{"X-Request-Id"},
+		Credentials: true,
+		MaxAge:      10 * time.Minute,
+	}
+	tests := []struct {
+		name, method, origin, requestMethod string
+		wantStatus                          int
+		wantNext                            bool
+		wantHeaders                         map[string]string
+	}{
+		{"no origin", "GET", "", "", http.StatusTeapot, true, map[string]string{
+			"Access-Control-Allow-Origin": "",
+			"Vary":                        "",
+		}},
+		{"allowed", "POST", "https://app.example.com", "", http.StatusTeapot, true, map[string]string{
+			"Access-Control-Allow-Origin":      "https://app.example.com",
+			"Access-Control-Allow-Credentials": "true",
+			"Access-Control-Expose-Headers":    "X-Request-Id",
+			"Access-Control-Allow-Methods":     "",
+			"Vary":                             "Origin",
+		}},
+		{"refused", "GET", "https://evil.example.com", "", http.StatusTeapot, true, map[string]string{
+			"Access-Control-Allow-Origin": "",
+			"Vary":                        "Origin",
+		}},
+		{"preflight", "OPTIONS", "https://app.example.com", "POST", http.StatusNoContent, false, map[string]string{
+			"Access-Control-Allow-Origin":   "https://app.example.com",
+			"Access-Control-Allow-Methods":  "GET, POST",
+			"Access-Control-Allow-Headers":  "Authorization, Content-Type",
+			"Access-Control-Max-Age":        "600",
+			"Access-Control-Expose-Headers": "",
+		}},
+		{"preflight of other method", "OPTIONS", "https://app.example.com", "DELETE", http.StatusNoContent, false, map[string]string{
+			"Access-Control-Allow-Origin":  "https://app.example.com",
+			"Access-Control-Allow-Methods": "",
+		}},
+		{"refused preflight", "OPTIONS", "https://evil.example.com", "POST", http.StatusNoContent, false, map[string]string{
+			"Access-Control-Allow-Origin":  "",
+			"Access-Control-Allow-Methods": "",
+		}},
+		{"plain OPTIONS", "OPTIONS", "https://app.example.com", "", http.StatusTeapot, true, map[string]string{
+			"Access-Control-Allow-Origin":  "https://app.example.com",
+			"Access-Control-Allow-Methods": "",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var called bool
+			h := c.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				w.WriteHeader(http.StatusTeapot)
+			}))
+			r := httptest.NewRequest(tt.method, "/v1/sessions", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if tt.requestMethod != "" {
+				r.Header.Set("Access-Control-Request-Method", tt.requestMethod)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus || called != tt.wantNext {
+				t.Errorf("status %d, next called %v; want %d, %v", w.Code, called, tt.wantStatus, tt.wantNext)
+			}
+			for k, want := range tt.wantHeaders {
+				if got := w.Header().Get(k); got != want {
+					t.Errorf("%s = %q, want %q", k, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCORSNil(t *testing.T) {
+	next := http.NotFoundHandler()
+	var c *CORS
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+	c.Middleware(next).ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound || len(w.Header().Values("Vary")) != 0 {
+		t.Errorf("nil CORS changed the response: %d %v", w.Code, w.Header())
+	}
+}
@@ -0,0 +1,99 @@
+// origin/origin.go
+package origin
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Allowlist decides which browser origins may open WebSocket connections.
+//
+// Patterns are either exact origins ("https://app.example.com",
+// "http://localhost:3000") or carry a wildcard as the leftmost host label
+// ("https://*.example.com"), which matches any subdomain but not the parent
+// domain itself. A pattern without a scheme ("*.example.com") matches any
+// scheme.
+type Allowlist struct {
+	allowAll bool
+	patterns []pattern
+}
+
+type pattern struct {
+	scheme string // empty matches any scheme
+	host   string // host[:port]; for wildcards the suffix including the dot
+	wild   bool
+}
+
+// New compiles patterns. allowAll disables the check entirely and is meant
+// for local development only.
+func New(patterns []string, allowAll bool) (*Allowlist, error) {
+	a := &Allowlist{allowAll: allowAll}
+	for _, raw := range patterns {
+		p, err := parse(raw)
+		if err != nil {
+			return nil, err
+		}
+		a.patterns = append(a.patterns, p)
+	}
+	return a, nil
+}
+
+func parse(raw string) (pattern, error) {
+	var p pattern
+	rest := strings.ToLower(strings.TrimSpace(raw))
+	if scheme, host, ok := strings.Cut(rest, "://"); ok {
+		p.scheme, rest = scheme, host
+	}
+	rest = strings.TrimSuffix(rest, "/")
+	if rest == "" || strings.Contains(rest, "/") {
+		return p, fmt.Errorf("origin: invalid pattern %q", raw)
+	}
+	if strings.HasPrefix(rest, "*.") {
+		p.wild, rest = true, rest[1:]
+	}
+	if strings.Contains(rest, "*") {
+		return p, fmt.Errorf("origin: wildcard only allowed as the first label in %q", raw)
+	}
+	p.host = rest
+	return p, nil
+}
+
+// Allowed reports whether origin (the value of an Origin header) matches the
+// allowlist.
+func (a *Allowlist) Allowed(origin string) bool {
+	if a.allowAll {
+		return true
+	}
+	u, err := url.Parse(strings.ToLower(origin))
+	if err != nil || u.Host == "" {
+		return false
+	}
+	for _, p := range a.patterns {
+		if p.scheme != "" && p.scheme != u.Scheme {
+			continue
+		}
+		if p.wild && strings.HasSuffix(u.Host, p.host) {
+			return true
+		}
+		if !p.wild && u.Host == p.host {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckOrigin is suitable for websocket.Upgrader.CheckOrigin. Requests
+// without an Origin header (non-browser clients) and same-origin requests
+// are always accepted.
+func (a *Allowlist) CheckOrigin(r *http.Request) bool {
+	o := r.Header.Get("Origin")
+	if o == "" {
+		return true
+	}
+	if u, err := url.Parse(o); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	return a.Allowed(o)
+}
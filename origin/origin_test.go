@@ -0,0 +1,103 @@
+// origin/origin_test.go
+package origin
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAllowlist(t *testing.T) {
+	a, err := New([]string{
+		"https://app.example.com",
+		"http://localhost:3000/",
+		"https://*.example.org",
+		"*.example.net",
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://app.example.com", true},
+		{"HTTPS://App.Example.com", true},
+		{"http://app.example.com", false},
+		{"https://app.example.com:8443", false},
+		{"https://evil.app.example.com", false},
+		{"https://app.example.com.evil.com", false},
+		{"http://localhost:3000", true},
+		{"http://localhost:3001", false},
+		{"https://a.example.org", true},
+		{"https://a.b.example.org", true},
+		{"https://example.org", false},
+		{"http://a.example.org", false},
+		{"https://evilexample.org", false},
+		{"http://a.example.net", true},
+		{"wss://a.example.net", true},
+		{"https://example.net", false},
+		{"null", false},
+		{"", false},
+		{"://bad", false},
+	}
+	for _, tt := range tests {
+		if got := a.Allowed(tt.origin); got != tt.want {
+			t.Errorf("Allowed(%q) = %v, want %v", tt.origin, got, tt.want)
+		}
+	}
+
+	all, err := New(nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !all.Allowed("https://anything.test") {
+		t.Error("allowAll refused an origin")
+	}
+	none, _ := New(nil, false)
+	if none.Allowed("https://app.example.com") {
+		t.Error("an empty allowlist took an origin")
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	for _, p := range []string{
+		"",
+		"https://",
+		"https://app.example.com/path",
+		"https://app.*.example.com",
+		"https://*example.com",
+		"*",
+	} {
+		if _, err := New([]string{p}, false); err == nil {
+			t.Errorf("New took pattern %q", p)
+		}
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	a, err := New([]string{"https://app.example.com"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name, host, origin string
+		want               bool
+	}{
+		{"no origin", "bridge.example.com", "", true},
+		{"same origin", "bridge.example.com", "https://bridge.example.com", true},
+		{"same origin with port", "bridge.example.com:8080", "http://Bridge.example.com:8080", true},
+		{"allowed", "bridge.example.com", "https://app.example.com", true},
+		{"other origin", "bridge.example.com", "https://evil.example.com", false},
+		{"other port", "bridge.example.com:8080", "https://bridge.example.com", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/ws", nil)
+		r.Host = tt.host
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		if got := a.CheckOrigin(r); got != tt.want {
+			t.Errorf("%s: CheckOrigin = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
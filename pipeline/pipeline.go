@@ -0,0 +1,253 @@
+// pipeline/pipeline.go
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"vad-application/audio"
+)
+
+// Built-in stages, which DefaultStages runs in this order.
+const (
+	// StageResample decodes the client's audio into audio.Backend's format.
+	// Every chain starts with it.
+	StageResample = "resample"
+	// StageDTMF reports keypad tones to Params.OnDTMF. It runs before
+	// noise suppression, which takes tones for noise.
+	StageDTMF = "dtmf"
+	// StageDenoise suppresses noise for streams asking for it.
+	StageDenoise = "denoise"
+	// StageAGC evens out the level of streams with an AGC target.
+	StageAGC = "agc"
+	// StageFrame cuts the audio into frames of Config.FrameDuration, if set.
+	// It must come last.
+	StageFrame = "frame"
+)
+
+// DefaultStages is the chain of a Config without Stages.
+var DefaultStages = []string{StageResample, StageDTMF, StageDenoise, StageAGC, StageFrame}
+
+// AudioProcessor is one stage of a chain. Process returns what pcm turns
+// into, possibly nothing yet; the result is only valid until the next call.
+// On error pcm is skipped and the processor remains usable.
+type AudioProcessor interface {
+	Process(pcm []byte) ([]byte, error)
+}
+
+// Flusher is implemented by processors holding audio back, which Flush
+// returns once the stream ends.
+type Flusher interface {
+	Flush() []byte
+}
+
+// Config describes the chain every stream runs.
+type Config struct {
+	// Stages names the processors in order, DefaultStages if empty.
+	Stages []string
+	// FrameDuration is the frame StageFrame cuts; zero leaves the audio in
+	// the chunks it came in.
+	FrameDuration time.Duration
+	// Denoise, AGCTargetDBFS and DTMF are the defaults of streams not
+	// choosing.
+	Denoise       bool
+	AGCTargetDBFS float64
+	DTMF          bool
+}
+
+// Params is what a chain and its stages are built from: the stream's
+// format as the client sends it, its options, and the callbacks of stages
+// reporting what they find, nil for streams not listening.
+type Params struct {
+	Format  audio.Format
+	Options audio.Options
+	Config  Config
+	OnDTMF  func(audio.DTMFDigit)
+}
+
+// Factory builds a stage for one stream, or returns nil when the stream
+// does not need it. Stages after StageResample get audio in audio.Backend's
+// format.
+type Factory func(Params) (AudioProcessor, error)
+
+var (
+	mu        sync.RWMutex
+	factories = map[string]Factory{
+		StageResample: newResample,
+		StageDTMF:     newDTMF,
+		StageDenoise:  newDenoise,
+		StageAGC:      newAGC,
+		StageFrame:    newFrame,
+	}
+)
+
+// Register makes a stage available under name. It panics if the name is
+// taken.
+func Register(name string, f Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := factories[name]; ok {
+		panic("pipeline: stage " + name + " registered twice")
+	}
+	factories[name] = f
+}
+
+func (c Config) stages() []string {
+	if len(c.Stages) == 0 {
+		return DefaultStages
+	}
+	return c.Stages
+}
+
+// Framed reports whether the chain cuts fixed-size frames.
+func (c Config) Framed() bool {
+	return c.FrameDuration > 0 && slices.Contains(c.stages(), StageFrame)
+}
+
+// Validate checks that the stages are known and in a workable order, and
+// that the defaults can be honored.
+func (c Config) Validate() error {
+	stages := c.stages()
+	if stages[0] != StageResample {
+		return fmt.Errorf("pipeline: first stage must be %s, not %q", StageResample, stages[0])
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	for i, name := range stages {
+		if _, ok := factories[name]; !ok {
+			return fmt.Errorf("pipeline: unknown stage %q", name)
+		}
+		if slices.Contains(stages[:i], name) {
+			return fmt.Errorf("pipeline: stage %q listed twice", name)
+		}
+		if name == StageFrame && i != len(stages)-1 {
+			return errors.New("pipeline: " + StageFrame + " must be the last stage")
+		}
+	}
+	return (audio.Options{Denoise: c.Denoise, AGCTargetDBFS: c.AGCTargetDBFS}).Validate(audio.Backend)
+}
+
+// Chain runs a stream's audio through its stages.
+type Chain struct {
+	convert   AudioProcessor
+	stages    []AudioProcessor
+	frameSize int
+}
+
+// New builds the chain of p.Config for a stream.
+func New(p Params) (*Chain, error) {
+	if err := p.Options.Validate(p.Format); err != nil {
+		return nil, err
+	}
+	c := &Chain{}
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, name := range p.Config.stages() {
+		f, ok := factories[name]
+		if !ok {
+			return nil, fmt.Errorf("pipeline: unknown stage %q", name)
+		}
+		st, err := f(p)
+		if err != nil {
+			return nil, fmt.Errorf("pipeline: %s: %w", name, err)
+		}
+		switch {
+		case name == StageResample:
+			c.convert = st
+		case st != nil:
+			c.stages = append(c.stages, st)
+		}
+		if fr, ok := st.(*framer); ok {
+			c.frameSize = fr.size
+		}
+	}
+	return c, nil
+}
+
+// Process runs client audio through the chain.
+func (c *Chain) Process(data []byte) ([]byte, error) {
+	if c.convert != nil {
+		var err error
+		if data, err = c.convert.Process(data); err != nil {
+			return nil, err
+		}
+	}
+	return c.Inject(data)
+}
+
+// Inject runs audio already in audio.Backend's format through the stages
+// after StageResample, such as silence standing in for lost audio.
+func (c *Chain) Inject(pcm []byte) ([]byte, error) {
+	for _, st := range c.stages {
+		if len(pcm) == 0 {
+			return nil, nil
+		}
+		var err error
+		if pcm, err = st.Process(pcm); err != nil {
+			return nil, err
+		}
+	}
+	return pcm, nil
+}
+
+// Flush returns the audio stages still hold once the stream ends.
+func (c *Chain) Flush() ([]byte, error) {
+	var out []byte
+	for _, st := range c.stages {
+		if len(out) > 0 {
+			pcm, err := st.Process(out)
+			if err != nil {
+				return nil, err
+			}
+			out = slices.Clone(pcm)
+		}
+		if f, ok := st.(Flusher); ok {
+			out = append(out, f.Flush()...)
+		}
+	}
+	return out, nil
+}
+
+// FrameSize returns the size of the frames the chain cuts, or zero if it
+// passes audio on as it comes.
+func (c *Chain) FrameSize() int {
+	return c.frameSize
+}
+
+// Frames calls fn with each frame of pcm, or with pcm whole if the chain
+// cuts none.
+func (c *Chain) Frames(pcm []byte, fn func([]byte) error) error {
+	size := c.frameSize
+	if size == 0 {
+		size = len(pcm)
+	}
+	for len(pcm) > 0 {
+		if err := fn(pcm[:size]); err != nil {
+			return err
+		}
+		pcm = pcm[size:]
+	}
+	return nil
+}
+
+// FromConverter adapts an audio.Converter to a stage; nil stays nil.
+func FromConverter(conv audio.Converter) AudioProcessor {
+	if conv == nil {
+		return nil
+	}
+	return &converted{conv: conv}
+}
+
+type converted struct {
+	conv audio.Converter
+	buf  []byte
+}
+
+func (c *converted) Process(pcm []byte) ([]byte, error) {
+	var err error
+	c.buf, err = c.conv.Convert(c.buf[:0], pcm)
+	return c.buf, err
+}
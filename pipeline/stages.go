@@ -0,0 +1,84 @@
+// pipeline/stages.go
+package pipeline
+
+import "vad-application/audio"
+
+func newResample(p Params) (AudioProcessor, error) {
+	conv, err := audio.NewConverter(p.Format, p.Options)
+	if err != nil {
+		return nil, err
+	}
+	return FromConverter(conv), nil
+}
+
+// dtmfStage listens for keypad tones, passing the audio on as it is.
+type dtmfStage struct {
+	d      *audio.DTMFDetector
+	report func(audio.DTMFDigit)
+}
+
+func newDTMF(p Params) (AudioProcessor, error) {
+	if p.OnDTMF == nil {
+		return nil, nil
+	}
+	return &dtmfStage{d: audio.NewDTMFDetector(audio.Backend), report: p.OnDTMF}, nil
+}
+
+func (s *dtmfStage) Process(pcm []byte) ([]byte, error) {
+	for _, d := range s.d.Detect(pcm) {
+		s.report(d)
+	}
+	return pcm, nil
+}
+
+func newDenoise(p Params) (AudioProcessor, error) {
+	if !p.Options.Denoise {
+		return nil, nil
+	}
+	conv, err := audio.NewDenoiser(audio.Backend)
+	if err != nil {
+		return nil, err
+	}
+	return FromConverter(conv), nil
+}
+
+func newAGC(p Params) (AudioProcessor, error) {
+	if p.Options.AGCTargetDBFS == 0 {
+		return nil, nil
+	}
+	return FromConverter(audio.NewGainControl(audio.Backend, p.Options.AGCTargetDBFS)), nil
+}
+
+// framer cuts audio into frames of one size for backends that need them
+// exact, holding the remainder until the next call.
+type framer struct {
+	size      int
+	held, out []byte
+}
+
+func newFrame(p Params) (AudioProcessor, error) {
+	f := audio.Backend
+	n := int(p.Config.FrameDuration.Seconds() * float64(f.SampleRate))
+	if n <= 0 {
+		return nil, nil
+	}
+	return &framer{size: n * f.FrameSize()}, nil
+}
+
+func (r *framer) Process(pcm []byte) ([]byte, error) {
+	r.held = append(r.held, pcm...)
+	n := len(r.held) / r.size * r.size
+	r.out = append(r.out[:0], r.held[:n]...)
+	r.held = append(r.held[:0], r.held[n:]...)
+	return r.out, nil
+}
+
+// Flush returns the audio held back, padded with silence to a whole frame.
+func (r *framer) Flush() []byte {
+	if len(r.held) == 0 {
+		return nil
+	}
+	out := append(r.held, make([]byte, r.size-len(r.held))...)
+	r.held = nil
+	return out
+}
@@ -0,0 +1,112 @@
+// publish/kafka.go
+package publish
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"vad-application/events"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+// SASL mechanisms for KafkaConfig.SASLMechanism.
+const (
+	SASLPlain       = "plain"
+	SASLScramSHA256 = "scram-sha-256"
+	SASLScramSHA512 = "scram-sha-512"
+)
+
+// KafkaConfig configures the Kafka sink.
+type KafkaConfig struct {
+	Brokers []string
+	Topic   string
+	// Segments also publishes each closed speech segment.
+	Segments bool
+	TLS      bool
+	// SASLMechanism, when set, authenticates with Username and Password.
+	SASLMechanism      string
+	Username, Password string
+}
+
+// Kafka publishes VAD events to a topic as JSON, keyed by session ID so that
+// each session's events stay in order on one partition.
+type Kafka struct {
+	*queue
+	w *kafka.Writer
+}
+
+// NewKafka creates the sink. Brokers are not contacted until the first
+// events are sent.
+func NewKafka(cfg KafkaConfig, logger *slog.Logger) (*Kafka, error) {
+	if len(cfg.Brokers) == 0 || cfg.Topic == "" {
+		return nil, errors.New("kafka: brokers and topic are required")
+	}
+	transport := &kafka.Transport{ClientID: "vad-bridge"}
+	if cfg.TLS {
+		transport.TLS = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	if cfg.SASLMechanism != "" {
+		mech, err := saslMechanism(cfg.SASLMechanism, cfg.Username, cfg.Password)
+		if err != nil {
+			return nil, err
+		}
+		transport.SASL = mech
+	}
+	k := &Kafka{w: &kafka.Writer{
+		Addr:     kafka.TCP(cfg.Brokers...),
+		Topic:    cfg.Topic,
+		Balancer: &kafka.Hash{},
+		// The queue batches already; don't wait for more.
+		BatchSize:    maxBatch,
+		BatchTimeout: time.Millisecond,
+		WriteTimeout: 10 * time.Second,
+		RequiredAcks: kafka.RequireOne,
+		Transport:    transport,
+	}}
+	k.queue = newQueue("kafka", kinds(cfg.Segments), k.send, logger)
+	return k, nil
+}
+
+func saslMechanism(name, user, pass string) (sasl.Mechanism, error) {
+	switch name {
+	case SASLPlain:
+		return plain.Mechanism{Username: user, Password: pass}, nil
+	case SASLScramSHA256:
+		return scram.Mechanism(scram.SHA256, user, pass)
+	case SASLScramSHA512:
+		return scram.Mechanism(scram.SHA512, user, pass)
+	}
+	return nil, fmt.Errorf("kafka: unknown SASL mechanism %q (want %s, %s or %s)",
+		name, SASLPlain, SASLScramSHA256, SASLScramSHA512)
+}
+
+func (k *Kafka) send(ctx context.Context, batch []events.Event) error {
+	msgs := make([]kafka.Message, len(batch))
+	for i, e := range batch {
+		value, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		msgs[i] = kafka.Message{
+			Key:     []byte(e.SessionID),
+			Value:   value,
+			Time:    e.Time,
+			Headers: []kafka.Header{{Key: "kind", Value: []byte(e.Kind)}},
+		}
+	}
+	return k.w.WriteMessages(ctx, msgs...)
+}
+
+// Close sends the queued events, until ctx expires, and disconnects.
+func (k *Kafka) Close(ctx context.Context) error {
+	return errors.Join(k.queue.close(ctx), k.w.Close())
+}
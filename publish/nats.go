@@ -0,0 +1,126 @@
+// publish/nats.go
+package publish
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"vad-application/events"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// NATSConfig configures the NATS sink.
+type NATSConfig struct {
+	// Prefix starts every subject: events go to <Prefix>.events.<session>.
+	Prefix string
+	// JetStream publishes through JetStream and waits for its acks; a stream
+	// must already cover the subjects.
+	JetStream bool
+	// Segments also publishes each closed speech segment.
+	Segments bool
+}
+
+// ConnectNATS dials url, reconnecting for as long as the bridge runs. It
+// doesn't wait for the server: until it answers, messages are buffered.
+func ConnectNATS(url, credsFile string, logger *slog.Logger) (*nats.Conn, error) {
+	log := logger.With("nats", url)
+	opts := []nats.Option{
+		nats.Name("vad-bridge"),
+		nats.MaxReconnects(-1),
+		nats.RetryOnFailedConnect(true),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				log.Warn("NATS disconnected", "err", err)
+			}
+		}),
+		nats.ReconnectHandler(func(*nats.Conn) {
+			log.Info("NATS reconnected")
+		}),
+	}
+	if credsFile != "" {
+		opts = append(opts, nats.UserCredentials(credsFile))
+	}
+	return nats.Connect(url, opts...)
+}
+
+// NATS publishes a session's events, including its start and end, as JSON
+// on <prefix>.events.<session>, so one subscription follows one session.
+type NATS struct {
+	*queue
+	nc     *nats.Conn
+	js     jetstream.JetStream
+	prefix string
+}
+
+// NewNATS creates the sink on an open connection, which it doesn't close.
+func NewNATS(nc *nats.Conn, cfg NATSConfig, logger *slog.Logger) (*NATS, error) {
+	n := &NATS{nc: nc, prefix: cfg.Prefix}
+	if cfg.JetStream {
+		js, err := jetstream.New(nc)
+		if err != nil {
+			return nil, err
+		}
+		n.js = js
+	}
+	k := append(kinds(cfg.Segments), events.SessionStart, events.SessionEnd)
+	n.queue = newQueue("nats", k, n.send, logger)
+	return n, nil
+}
+
+// EventsSubject is where a session's events are published.
+func EventsSubject(prefix, sessionID string) string {
+	return prefix + ".events." + sessionID
+}
+
+func (n *NATS) send(ctx context.Context, batch []events.Event) error {
+	var acks []jetstream.PubAckFuture
+	for _, e := range batch {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		msg := &nats.Msg{Subject: EventsSubject(n.prefix, e.SessionID), Data: data, Header: nats.Header{}}
+		msg.Header.Set("Kind", e.Kind)
+		if n.js == nil {
+			err = n.nc.PublishMsg(msg)
+		} else {
+			var ack jetstream.PubAckFuture
+			ack, err = n.js.PublishMsgAsync(msg)
+			acks = append(acks, ack)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	var failed int
+	var first error
+	for _, ack := range acks {
+		select {
+		case <-ack.Ok():
+		case err := <-ack.Err():
+			if failed++; first == nil {
+				first = err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if first != nil {
+		return fmt.Errorf("%d of %d events not acknowledged: %w", failed, len(acks), first)
+	}
+	return nil
+}
+
+// Close publishes the queued events, until ctx expires.
+func (n *NATS) Close(ctx context.Context) error {
+	err := n.queue.close(ctx)
+	if n.js == nil {
+		err = errors.Join(err, n.nc.FlushWithContext(ctx))
+	}
+	return err
+}
@@ -0,0 +1,119 @@
+// publish/publish.go
+package publish
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+
+	"vad-application/events"
+	"vad-application/metrics"
+)
+
+// queueSize is how many events may wait for the broker before new ones are
+// dropped, and maxBatch how many are sent at once.
+const (
+	queueSize = 4096
+	maxBatch  = 256
+)
+
+// kinds lists the events published: VAD responses, and speech segments if
+// asked for.
+func kinds(segments bool) []string {
+	if segments {
+		return []string{events.VAD, events.Segment}
+	}
+	return []string{events.VAD}
+}
+
+// queue hands events to a background sender in batches, so that Publish
+// never waits on the broker.
+type queue struct {
+	// name labels the sink in logs and metrics.
+	name  string
+	kinds []string
+	send  func(ctx context.Context, batch []events.Event) error
+	log   *slog.Logger
+
+	// ctx is cancelled when Close runs out of time.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.RWMutex
+	closed bool
+	ch     chan events.Event
+	done   chan struct{}
+}
+
+func newQueue(name string, kinds []string, send func(context.Context, []events.Event) error, logger *slog.Logger) *queue {
+	q := &queue{
+		name:  name,
+		kinds: kinds,
+		send:  send,
+		log:   logger.With("sink", name),
+		ch:    make(chan events.Event, queueSize),
+		done:  make(chan struct{}),
+	}
+	q.ctx, q.cancel = context.WithCancel(context.Background())
+	go q.run()
+	return q
+}
+
+// Publish queues e, dropping it if the sender is behind.
+func (q *queue) Publish(e events.Event) {
+	if !slices.Contains(q.kinds, e.Kind) {
+		return
+	}
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return
+	}
+	select {
+	case q.ch <- e:
+	default:
+		metrics.SinkDropped.WithLabelValues(q.name).Inc()
+	}
+}
+
+// close sends what is queued, giving up when ctx expires.
+func (q *queue) close(ctx context.Context) error {
+	q.mu.Lock()
+	q.closed = true
+	close(q.ch)
+	q.mu.Unlock()
+	defer q.cancel()
+	select {
+	case <-q.done:
+		return nil
+	case <-ctx.Done():
+		q.cancel()
+		<-q.done
+		return ctx.Err()
+	}
+}
+
+func (q *queue) run() {
+	defer close(q.done)
+	batch := make([]events.Event, 0, maxBatch)
+	for e := range q.ch {
+		batch = append(batch[:0], e)
+	fill:
+		for len(batch) < maxBatch {
+			select {
+			case e, ok := <-q.ch:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, e)
+			default:
+				break fill
+			}
+		}
+		if err := q.send(q.ctx, batch); err != nil {
+			metrics.SinkDropped.WithLabelValues(q.name).Add(float64(len(batch)))
+			q.log.Warn("Publishing session events failed", "events", len(batch), "err", err)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// publish/redis.go
+package publish
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"vad-application/events"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisConfig configures the Redis sink.
+type RedisConfig struct {
+	// URL is a redis:// or rediss:// URL.
+	URL string
+	// Prefix starts every channel name.
+	Prefix string
+	// Segments also publishes each closed speech segment.
+	Segments bool
+}
+
+// Redis broadcasts a session's events, including its start and end, as JSON
+// on the Redis channel <prefix>:session:<id>, and on <prefix>:subject:<sub>
+// for authenticated sessions, so a dashboard can follow one user as they
+// reconnect. Subscribers that are not listening miss the events.
+type Redis struct {
+	*queue
+	rdb    *redis.Client
+	prefix string
+}
+
+// NewRedis creates the sink. The server isn't contacted until the first
+// events are sent.
+func NewRedis(cfg RedisConfig, logger *slog.Logger) (*Redis, error) {
+	opts, err := redis.ParseURL(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	r := &Redis{rdb: redis.NewClient(opts), prefix: cfg.Prefix}
+	k := append(kinds(cfg.Segments), events.SessionStart, events.SessionEnd)
+	r.queue = newQueue("redis", k, r.send, logger)
+	return r, nil
+}
+
+// SessionChannel is where a session's events are published.
+func SessionChannel(prefix, sessionID string) string {
+	return prefix + ":session:" + sessionID
+}
+
+// SubjectChannel is where the events of a user's sessions are published.
+func SubjectChannel(prefix, subject string) string {
+	return prefix + ":subject:" + subject
+}
+
+func (r *Redis) send(ctx context.Context, batch []events.Event) error {
+	pipe := r.rdb.Pipeline()
+	for _, e := range batch {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		pipe.Publish(ctx, SessionChannel(r.prefix, e.SessionID), data)
+		if e.Subject != "" {
+			pipe.Publish(ctx, SubjectChannel(r.prefix, e.Subject), data)
+		}
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Close publishes the queued events, until ctx expires, and disconnects.
+func (r *Redis) Close(ctx context.Context) error {
+	return errors.Join(r.queue.close(ctx), r.rdb.Close())
+}
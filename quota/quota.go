@@ -0,0 +1,393 @@
+// quota/quota.go
+package quota
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"vad-application/events"
+	"vad-application/session"
+)
+
+// Periods a quota applies to.
+const (
+	Daily   = "daily"
+	Monthly = "monthly"
+)
+
+// Limits caps how much audio a subject may have processed per UTC day and
+// month. Zero means unlimited.
+type Limits struct {
+	Daily   time.Duration
+	Monthly time.Duration
+}
+
+// ParseLimits parses "subject:daily:monthly" entries, durations such as
+// "2h" with 0 meaning unlimited and an empty one keeping def's.
+func ParseLimits(specs []string, def Limits) (map[string]Limits, error) {
+	out := make(map[string]Limits, len(specs))
+	for _, spec := range specs {
+		// Subjects may hold colons themselves; the durations can't.
+		parts := strings.Split(spec, ":")
+		if len(parts) < 3 {
+			return nil, fmt.Errorf("quota: invalid entry %q", spec)
+		}
+		subject := strings.Join(parts[:len(parts)-2], ":")
+		l := def
+		for i, p := range []*time.Duration{&l.Daily, &l.Monthly} {
+			v := parts[len(parts)-2+i]
+			if v == "" {
+				continue
+			}
+			d, err := time.ParseDuration(v)
+			if err != nil || d < 0 {
+				return nil, fmt.Errorf("quota: invalid duration %q in entry %q", v, spec)
+			}
+			*p = d
+		}
+		if subject == "" {
+			return nil, fmt.Errorf("quota: entry %q names no subject", spec)
+		}
+		out[subject] = l
+	}
+	return out, nil
+}
+
+// ExceededError tells that the quota for Period of Subject, or of all of
+// Tenant's callers when Subject is empty, is used up until Resets.
+type ExceededError struct {
+	Subject string
+	Tenant  string
+	Period  string
+	Limit   time.Duration
+	Resets  time.Time
+}
+
+func (e *ExceededError) Error() string {
+	whose := ""
+	if e.Subject == "" {
+		whose = "tenant's "
+	}
+	return fmt.Sprintf("%s%s audio quota of %s used up; it resets at %s", whose, e.Period, e.Limit, e.Resets.Format(time.RFC3339))
+}
+
+// Usage is the audio of a subject, or of a whole tenant, processed in the
+// current UTC day and month, in seconds, beside its limits.
+type Usage struct {
+	Subject      string    `json:"subject,omitempty"`
+	Tenant       string    `json:"tenant,omitempty"`
+	Day          float64   `json:"day"`
+	Month        float64   `json:"month"`
+	DailyLimit   float64   `json:"daily_limit,omitempty"`
+	MonthlyLimit float64   `json:"monthly_limit,omitempty"`
+	DayResets    time.Time `json:"day_resets"`
+	MonthResets  time.Time `json:"month_resets"`
+}
+
+// Quotas meters the audio sent to the backend for each authenticated
+// subject and each tenant, and holds them to their limits. It is an
+// events.Sink: a session's events carry how much audio it has sent, so
+// every session publishing events is metered. Usage is kept in memory, per
+// bridge.
+type Quotas struct {
+	def       Limits
+	overrides map[string]Limits
+	tenants   map[string]Limits
+	m         *session.Manager
+
+	mu sync.Mutex
+	// day and month start the current periods.
+	day, month time.Time
+	used       map[account]*usage
+	// sessions holds what each open session has been charged.
+	sessions map[string]*metered
+}
+
+// account is what usage counts against: a subject, or a whole tenant.
+type account struct {
+	tenant bool
+	name   string
+}
+
+type usage struct {
+	day, month float64
+}
+
+type metered struct {
+	charged float64
+	// cut is set once the session was ended for its subject's quota.
+	cut bool
+}
+
+// New meters sessions, holding subjects to def unless overridden and
+// tenants to theirs; tenants without limits are unlimited.
+func New(def Limits, overrides, tenants map[string]Limits) *Quotas {
+	q := &Quotas{
+		def:       def,
+		overrides: overrides,
+		tenants:   tenants,
+		used:      map[account]*usage{},
+		sessions:  map[string]*metered{},
+	}
+	q.roll(time.Now())
+	return q
+}
+
+// Enforce lets q end the sessions of m whose subject runs over a quota
+// while they are open. It must be called before any starts.
+func (q *Quotas) Enforce(m *session.Manager) {
+	q.m = m
+}
+
+func (q *Quotas) limits(a account) Limits {
+	if a.tenant {
+		return q.tenants[a.name]
+	}
+	if l, ok := q.overrides[a.name]; ok {
+		return l
+	}
+	return q.def
+}
+
+// accounts returns those a subject's audio in tenant counts against.
+func accounts(subject, tenant string) []account {
+	var as []account
+	if subject != "" {
+		as = append(as, account{name: subject})
+	}
+	if tenant != "" {
+		as = append(as, account{tenant: true, name: tenant})
+	}
+	return as
+}
+
+// roll starts the periods now falls in, forgetting the usage of those
+// past. q.mu is held.
+func (q *Quotas) roll(now time.Time) {
+	now = now.UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if day.Equal(q.day) {
+		return
+	}
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for a, u := range q.used {
+		u.day = 0
+		if !month.Equal(q.month) {
+			u.month = 0
+		}
+		if u.month == 0 {
+			delete(q.used, a)
+		}
+	}
+	q.day, q.month = day, month
+}
+
+// exceeded reports which limit of the accounts the usage of one reached.
+// q.mu is held.
+func (q *Quotas) exceeded(as []account) *ExceededError {
+	for _, a := range as {
+		l := q.limits(a)
+		u := q.used[a]
+		if u == nil {
+			continue
+		}
+		var e *ExceededError
+		switch {
+		case l.Monthly > 0 && u.month >= l.Monthly.Seconds():
+			e = &ExceededError{Period: Monthly, Limit: l.Monthly, Resets: q.month.AddDate(0, 1, 0)}
+		case l.Daily > 0 && u.day >= l.Daily.Seconds():
+			e = &ExceededError{Period: Daily, Limit: l.Daily, Resets: q.day.AddDate(0, 0, 1)}
+		default:
+			continue
+		}
+		if a.tenant {
+			e.Tenant = a.name
+		} else {
+			e.Subject = a.name
+		}
+		return e
+	}
+	return nil
+}
+
+// Check returns the quota keeping subject, in tenant, from having more
+// audio processed now, or nil. Callers with neither, unauthenticated ones
+// belonging to no tenant, are never held.
+func (q *Quotas) Check(subject, tenant string) *ExceededError {
+	as := accounts(subject, tenant)
+	if len(as) == 0 {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.roll(time.Now())
+	return q.exceeded(as)
+}
+
+// Charge adds seconds of audio processed outside a session, such as by a
+// batch request, to the usage of subject and tenant.
+func (q *Quotas) Charge(subject, tenant string, seconds float64) {
+	as := accounts(subject, tenant)
+	if len(as) == 0 {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.charge(as, seconds)
+}
+
+// charge adds seconds to the accounts' usage, reporting whether that used
+// up one of their quotas. q.mu is held.
+func (q *Quotas) charge(as []account, seconds float64) *ExceededError {
+	q.roll(time.Now())
+	for _, a := range as {
+		u := q.used[a]
+		if u == nil {
+			u = &usage{}
+			q.used[a] = u
+		}
+		u.day += seconds
+		u.month += seconds
+	}
+	return q.exceeded(as)
+}
+
+// Publish charges the audio a session sent since its previous event, and
+// ends the session once a quota of its subject or tenant is used up.
+func (q *Quotas) Publish(e events.Event) {
+	as := accounts(e.Subject, e.Tenant)
+	if len(as) == 0 {
+		return
+	}
+	sent := e.Offset
+	if e.Kind == events.SessionEnd && e.Summary != nil {
+		sent = e.Summary.Audio
+	}
+	q.mu.Lock()
+	s := q.sessions[e.SessionID]
+	if s == nil {
+		s = &metered{}
+		q.sessions[e.SessionID] = s
+	}
+	var over *ExceededError
+	if sent > s.charged {
+		over = q.charge(as, sent-s.charged)
+		s.charged = sent
+	}
+	cut := over != nil && !s.cut
+	if cut {
+		s.cut = true
+	}
+	if e.Kind == events.SessionEnd {
+		delete(q.sessions, e.SessionID)
+		cut = false
+	}
+	q.mu.Unlock()
+
+	if !cut || q.m == nil {
+		return
+	}
+	if sess, ok := q.m.Get(e.SessionID); ok {
+		// Off the session's goroutine, which is publishing.
+		go sess.OverQuota(over, time.Until(over.Resets))
+	}
+}
+
+// Recorded returns the seconds of audio of the sessions started since a
+// time, by subject or tenant, as *store.Store's Usage and TenantUsage do.
+type Recorded func(ctx context.Context, since time.Time) (map[string]float64, error)
+
+// Restore resumes counting from the usage recorded before the bridge
+// started, by subject and by tenant.
+func (q *Quotas) Restore(ctx context.Context, bySubject, byTenant Recorded) error {
+	q.mu.Lock()
+	day, month := q.day, q.month
+	q.mu.Unlock()
+	for _, r := range []struct {
+		recorded Recorded
+		tenant   bool
+	}{{bySubject, false}, {byTenant, true}} {
+		monthly, err := r.recorded(ctx, month)
+		if err != nil {
+			return fmt.Errorf("quota: %w", err)
+		}
+		daily, err := r.recorded(ctx, day)
+		if err != nil {
+			return fmt.Errorf("quota: %w", err)
+		}
+		q.mu.Lock()
+		for name, secs := range monthly {
+			a := account{tenant: r.tenant, name: name}
+			u := q.used[a]
+			if u == nil {
+				u = &usage{}
+				q.used[a] = u
+			}
+			u.month += secs
+			u.day += daily[name]
+		}
+		q.mu.Unlock()
+	}
+	return nil
+}
+
+// Usage returns subject's usage.
+func (q *Quotas) Usage(subject string) Usage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.roll(time.Now())
+	return q.report(account{name: subject})
+}
+
+// TenantUsage returns the usage of all of tenant's callers.
+func (q *Quotas) TenantUsage(tenant string) Usage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.roll(time.Now())
+	return q.report(account{tenant: true, name: tenant})
+}
+
+// All returns the usage of every subject and tenant with some this month:
+// subjects first, by name, then tenants.
+func (q *Quotas) All() []Usage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.roll(time.Now())
+	list := make([]Usage, 0, len(q.used))
+	for a := range q.used {
+		list = append(list, q.report(a))
+	}
+	slices.SortFunc(list, func(a, b Usage) int {
+		return strings.Compare(a.Tenant+"\x00"+a.Subject, b.Tenant+"\x00"+b.Subject)
+	})
+	return list
+}
+
+// report describes a's usage. q.mu is held.
+func (q *Quotas) report(a account) Usage {
+	l := q.limits(a)
+	r := Usage{
+		DailyLimit:   l.Daily.Seconds(),
+		MonthlyLimit: l.Monthly.Seconds(),
+		DayResets:    q.day.AddDate(0, 0, 1),
+		MonthResets:  q.month.AddDate(0, 1, 0),
+	}
+	if a.tenant {
+		r.Tenant = a.name
+	} else {
+		r.Subject = a.name
+	}
+	if u := q.used[a]; u != nil {
+		r.Day, r.Month = round(u.day), round(u.month)
+	}
+	return r
+}
+
+func round(secs float64) float64 {
+	return math.Round(secs*1000) / 1000
+}
@@ -0,0 +1,50 @@
+// quota/quota_test.go
+package quota
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseLimits(t *testing.T) {
+	def := Limits{Daily: time.Hour, Monthly: 20 * time.Hour}
+	tests := []struct {
+		name    string
+		specs   []string
+		want    map[string]Limits
+		wantErr bool
+	}{
+		{"none", nil, map[string]Limits{}, false},
+		{"both", []string{"alice:2h:40h"}, map[string]Limits{"alice": {2 * time.Hour, 40 * time.Hour}}, false},
+		{"empty keeps default", []string{"bob::", "carol:30m:"}, map[string]Limits{
+			"bob":   def,
+			"carol": {30 * time.Minute, 20 * time.Hour},
+		}, false},
+		{"zero is unlimited", []string{"dave:0:0"}, map[string]Limits{"dave": {}}, false},
+		{"subject with colons", []string{"urn:tenant:eve:1h30m:0"}, map[string]Limits{"urn:tenant:eve": {90 * time.Minute, 0}}, false},
+		{"later entry wins", []string{"alice:1h:1h", "alice:2h:2h"}, map[string]Limits{"alice": {2 * time.Hour, 2 * time.Hour}}, false},
+		{"too few fields", []string{"alice:2h"}, nil, true},
+		{"no subject", []string{":2h:40h"}, nil, true},
+		{"bad duration", []string{"alice:two:40h"}, nil, true},
+		{"unitless duration", []string{"alice:2:40h"}, nil, true},
+		{"negative duration", []string{"alice:2h:-1h"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLimits(tt.specs, def)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseLimits took %q", tt.specs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseLimits(%q) = %v, want %v", tt.specs, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,394 @@
+// recording/recorder.go
+package recording
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"vad-application/audio"
+	"vad-application/events"
+)
+
+// Config controls where recordings go and how much disk they may use.
+type Config struct {
+	// Dir receives one WAV file or more and a JSON sidecar per session. It
+	// should hold nothing else, as old files are deleted from it.
+	Dir string
+	// MaxFileBytes starts a new WAV file once the current one holds this
+	// much audio; zero never splits.
+	MaxFileBytes int64
+	// MaxTotalBytes caps the size of Dir: the oldest finished recordings
+	// are deleted to stay under it. Zero keeps everything.
+	MaxTotalBytes int64
+	// Upload, if it names a bucket, moves finished recordings there.
+	Upload UploadConfig
+}
+
+// Recorder writes session recordings into a directory.
+type Recorder struct {
+	cfg Config
+	log *slog.Logger
+	up  *uploader
+
+	mu sync.Mutex
+	// active holds the base names of recordings still being written, which
+	// pruning leaves alone.
+	active map[string]bool
+	// pruneMu keeps finishing sessions from pruning at the same time.
+	pruneMu sync.Mutex
+}
+
+// New returns a Recorder writing to cfg.Dir, creating it if needed. When
+// uploading, recordings left on disk by an earlier run are uploaded too.
+func New(cfg Config, logger *slog.Logger) (*Recorder, error) {
+	if err := os.MkdirAll(cfg.Dir, 0o750); err != nil {
+		return nil, fmt.Errorf("recording: %w", err)
+	}
+	r := &Recorder{cfg: cfg, log: logger, active: make(map[string]bool)}
+	if cfg.Upload.Bucket != "" {
+		up, err := newUploader(cfg.Upload, cfg.Dir, logger)
+		if err != nil {
+			return nil, err
+		}
+		r.up = up
+		groups, err := r.list()
+		if err != nil {
+			return nil, fmt.Errorf("recording: %w", err)
+		}
+		for _, g := range groups {
+			r.finish(g.base, g.files)
+		}
+	}
+	r.prune()
+	return r, nil
+}
+
+// Close waits, until ctx expires, for pending uploads.
+func (r *Recorder) Close(ctx context.Context) error {
+	if r.up == nil {
+		return nil
+	}
+	return r.up.close(ctx)
+}
+
+// Meta describes the session a recording belongs to.
+type Meta struct {
+	SessionID string    `json:"session_id"`
+	Subject   string    `json:"subject,omitempty"`
+	Started   time.Time `json:"started"`
+}
+
+// Event is a VAD response as written to the sidecar. Offset is how much
+// audio, in seconds, had been recorded when it arrived.
+type Event struct {
+	Event    string    `json:"event"`
+	Message  string    `json:"message,omitempty"`
+	Offset   float64   `json:"offset"`
+	Received time.Time `json:"received"`
+}
+
+// Clip is the audio of one speech segment, saved to its own WAV file. Start
+// and End are in seconds of session audio.
+type Clip struct {
+	File  string  `json:"file"`
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+// sidecar is the JSON document written next to the audio.
+type sidecar struct {
+	Meta
+	Ended  time.Time    `json:"ended"`
+	Format audio.Format `json:"format"`
+	Files  []string     `json:"files"`
+	Bytes  int64        `json:"bytes"`
+	Events []Event      `json:"events"`
+	// ShadowEvents are the shadow backend's responses to the same audio,
+	// and Diff how they compare to Events.
+	ShadowEvents []Event      `json:"shadow_events,omitempty"`
+	Diff         *events.Diff `json:"diff,omitempty"`
+	Clips        []Clip       `json:"clips,omitempty"`
+}
+
+// Recording is one session's audio and events. Its methods may be called
+// from several goroutines. A nil Recording records nothing.
+type Recording struct {
+	r    *Recorder
+	base string
+	log  *slog.Logger
+
+	mu     sync.Mutex
+	doc    sidecar
+	file   *wavFile
+	failed bool
+}
+
+// Open starts recording a session whose audio is in format f, which must be
+// 16-bit PCM.
+func (r *Recorder) Open(meta Meta, f audio.Format) (*Recording, error) {
+	base := meta.Started.UTC().Format("20060102T150405Z") + "-" + meta.SessionID
+	rec := &Recording{
+		r:    r,
+		base: base,
+		log:  r.log.With("session_id", meta.SessionID),
+		doc:  sidecar{Meta: meta, Format: f, Files: []string{}, Events: []Event{}},
+	}
+	r.mu.Lock()
+	r.active[base] = true
+	r.mu.Unlock()
+	if err := rec.nextFile(); err != nil {
+		r.release(base)
+		return nil, err
+	}
+	return rec, nil
+}
+
+// nextFile closes the current WAV file, if any, and starts the next one.
+func (rec *Recording) nextFile() error {
+	if rec.file != nil {
+		if err := rec.file.Close(rec.doc.Format); err != nil {
+			return err
+		}
+	}
+	name := rec.base + ".wav"
+	if n := len(rec.doc.Files); n > 0 {
+		name = fmt.Sprintf("%s.%d.wav", rec.base, n)
+	}
+	f, err := createWAV(filepath.Join(rec.r.cfg.Dir, name), rec.doc.Format)
+	if err != nil {
+		return err
+	}
+	rec.file = f
+	rec.doc.Files = append(rec.doc.Files, name)
+	return nil
+}
+
+// Write appends audio, starting a new file when the current one is full. A
+// write error stops the recording but not the session.
+func (rec *Recording) Write(p []byte) {
+	if rec == nil {
+		return
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	limit := rec.r.cfg.MaxFileBytes
+	for len(p) > 0 && !rec.failed {
+		n := len(p)
+		if limit > 0 {
+			if room := limit - rec.file.size; int64(n) > room {
+				// Split on a sample boundary.
+				n = int(room) - int(room)%rec.doc.Format.FrameSize()
+			}
+			if n <= 0 {
+				rec.check(rec.nextFile())
+				continue
+			}
+		}
+		_, err := rec.file.Write(p[:n])
+		rec.check(err)
+		rec.doc.Bytes += int64(n)
+		p = p[n:]
+	}
+}
+
+// Event notes a VAD response against the audio written so far.
+func (rec *Recording) Event(event, message string) {
+	if rec == nil {
+		return
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.doc.Events = append(rec.doc.Events, rec.event(event, message))
+}
+
+// ShadowEvent notes a response from the shadow backend.
+func (rec *Recording) ShadowEvent(event, message string) {
+	if rec == nil {
+		return
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.doc.ShadowEvents = append(rec.doc.ShadowEvents, rec.event(event, message))
+}
+
+// Diff notes how the shadow backend's speech compared with the primary's.
+func (rec *Recording) Diff(d *events.Diff) {
+	if rec == nil {
+		return
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.doc.Diff = d
+}
+
+// Clip saves the audio of a speech segment to a WAV file of its own. A
+// failed clip is logged; the recording goes on.
+func (rec *Recording) Clip(seg events.SpeechSegment, pcm []byte) {
+	if rec == nil {
+		return
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	name := fmt.Sprintf("%s.clip%d.wav", rec.base, len(rec.doc.Clips))
+	f, err := createWAV(filepath.Join(rec.r.cfg.Dir, name), rec.doc.Format)
+	if err == nil {
+		_, err = f.Write(pcm)
+		if cerr := f.Close(rec.doc.Format); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		rec.log.Warn("Saving speech clip failed", "file", name, "err", err)
+		return
+	}
+	rec.doc.Clips = append(rec.doc.Clips, Clip{File: name, Start: seg.Start, End: seg.End})
+}
+
+func (rec *Recording) event(event, message string) Event {
+	f := rec.doc.Format
+	return Event{
+		Event:    event,
+		Message:  message,
+		Offset:   float64(rec.doc.Bytes/int64(f.FrameSize())) / float64(f.SampleRate),
+		Received: time.Now(),
+	}
+}
+
+// Close finishes the audio, writes the sidecar and makes room for the next
+// recordings.
+func (rec *Recording) Close() {
+	if rec == nil {
+		return
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	files := slices.Clone(rec.doc.Files)
+	for _, c := range rec.doc.Clips {
+		files = append(files, c.File)
+	}
+	defer func() { rec.r.finish(rec.base, files) }()
+	if err := rec.file.Close(rec.doc.Format); err != nil && !rec.failed {
+		rec.log.Warn("Closing recording failed", "err", err)
+	}
+	rec.doc.Ended = time.Now()
+	data, err := json.MarshalIndent(rec.doc, "", "  ")
+	if err == nil {
+		err = os.WriteFile(filepath.Join(rec.r.cfg.Dir, rec.base+".json"), data, 0o640)
+	}
+	if err != nil {
+		rec.log.Warn("Writing recording sidecar failed", "err", err)
+		return
+	}
+	files = append(files, rec.base+".json")
+	rec.log.Debug("Recording saved", "files", rec.doc.Files, "bytes", rec.doc.Bytes)
+}
+
+func (rec *Recording) check(err error) {
+	if err != nil && !rec.failed {
+		rec.failed = true
+		rec.log.Warn("Recording stopped: write failed", "err", err)
+	}
+}
+
+// finish hands a complete recording to the uploader, if any, and releases
+// it once uploaded.
+func (r *Recorder) finish(base string, files []string) {
+	if r.up == nil {
+		r.release(base)
+		return
+	}
+	r.mu.Lock()
+	r.active[base] = true
+	r.mu.Unlock()
+	r.up.enqueue(job{base: base, files: files, done: func() { r.release(base) }})
+}
+
+// release marks a recording finished and prunes the directory.
+func (r *Recorder) release(base string) {
+	r.mu.Lock()
+	delete(r.active, base)
+	r.mu.Unlock()
+	r.prune()
+}
+
+// prune deletes the oldest finished recordings until the directory fits
+// MaxTotalBytes.
+func (r *Recorder) prune() {
+	if r.cfg.MaxTotalBytes <= 0 {
+		return
+	}
+	r.pruneMu.Lock()
+	defer r.pruneMu.Unlock()
+	groups, err := r.list()
+	if err != nil {
+		r.log.Warn("Listing recordings failed", "err", err)
+		return
+	}
+	var total int64
+	for _, g := range groups {
+		total += g.size
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, g := range groups {
+		if total <= r.cfg.MaxTotalBytes {
+			return
+		}
+		if r.active[g.base] {
+			continue
+		}
+		for _, name := range g.files {
+			if err := os.Remove(filepath.Join(r.cfg.Dir, name)); err != nil {
+				r.log.Warn("Deleting old recording failed", "file", name, "err", err)
+			}
+		}
+		total -= g.size
+		r.log.Info("Deleted old recording", "recording", g.base, "bytes", g.size)
+	}
+}
+
+// group is one recording's files on disk.
+type group struct {
+	base  string
+	files []string
+	size  int64
+}
+
+// list returns the recordings in the directory, oldest first, each with its
+// sidecar last.
+func (r *Recorder) list() ([]*group, error) {
+	entries, err := os.ReadDir(r.cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+	// ReadDir sorts by name, and names start with the session's start time:
+	// each recording's files are adjacent and the oldest come first.
+	var groups []*group
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		base, _, _ := strings.Cut(e.Name(), ".")
+		if len(groups) == 0 || groups[len(groups)-1].base != base {
+			groups = append(groups, &group{base: base})
+		}
+		g := groups[len(groups)-1]
+		g.files = append(g.files, e.Name())
+		g.size += info.Size()
+	}
+	for _, g := range groups {
+		if i := slices.Index(g.files, g.base+".json"); i >= 0 {
+			g.files = append(slices.Delete(g.files, i, i+1), g.base+".json")
+		}
+	}
+	return groups, nil
+}
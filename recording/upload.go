@@ -0,0 +1,263 @@
+// recording/upload.go
+package recording
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// Upload retry backoff, doubling from the first delay up to the last.
+const (
+	retryBaseDelay = time.Second
+	retryMaxDelay  = time.Minute
+)
+
+// retentionSweep is how often uploaded recordings past their retention are
+// looked for.
+const retentionSweep = time.Hour
+
+// uploadWorkers is how many recordings are uploaded at once.
+const uploadWorkers = 2
+
+// UploadConfig sends finished recordings to an S3-compatible bucket, such as
+// AWS S3, MinIO or GCS through its XML API. An empty Bucket disables it.
+type UploadConfig struct {
+	// Endpoint is the host[:port] of the service, e.g. s3.amazonaws.com.
+	Endpoint string
+	Bucket   string
+	Region   string
+	// Prefix is prepended to every object name.
+	Prefix string
+	// AccessKey and SecretKey sign requests. When empty, the standard AWS
+	// and MinIO environment variables or the instance role are used.
+	AccessKey string
+	SecretKey string
+	// Insecure talks plain HTTP, for a local MinIO.
+	Insecure bool
+	// Retries is how many times a failed upload is retried before the
+	// files are left on disk for the next start.
+	Retries int
+	// Retention deletes objects under Prefix older than this; zero keeps
+	// them.
+	Retention time.Duration
+	// KeepLocal keeps uploaded files on disk, still within MaxTotalBytes.
+	KeepLocal bool
+}
+
+// job is one recording waiting to be uploaded.
+type job struct {
+	base  string
+	files []string
+	// done runs once the job is finished with, whether or not it succeeded.
+	done func()
+}
+
+// uploader copies finished recordings to the bucket in the background.
+type uploader struct {
+	cfg    UploadConfig
+	client *minio.Client
+	dir    string
+	log    *slog.Logger
+
+	// ctx is cancelled when shutdown runs out of time.
+	ctx     context.Context
+	cancel  context.CancelFunc
+	workers sync.WaitGroup
+	sweeper sync.WaitGroup
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queue  []job
+	closed bool
+}
+
+func newUploader(cfg UploadConfig, dir string, logger *slog.Logger) (*uploader, error) {
+	creds := credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, "")
+	if cfg.AccessKey == "" {
+		creds = credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.EnvMinio{},
+			&credentials.IAM{},
+		})
+	}
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  creds,
+		Secure: !cfg.Insecure,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("recording: upload: %w", err)
+	}
+	u := &uploader{cfg: cfg, client: client, dir: dir, log: logger.With("bucket", cfg.Bucket)}
+	u.cond = sync.NewCond(&u.mu)
+	u.ctx, u.cancel = context.WithCancel(context.Background())
+	for range uploadWorkers {
+		u.workers.Add(1)
+		go u.work()
+	}
+	if cfg.Retention > 0 {
+		u.sweeper.Add(1)
+		go u.expire()
+	}
+	return u, nil
+}
+
+// enqueue schedules an upload. After close the files stay on disk.
+func (u *uploader) enqueue(j job) {
+	u.mu.Lock()
+	if u.closed {
+		u.mu.Unlock()
+		j.done()
+		return
+	}
+	u.queue = append(u.queue, j)
+	u.cond.Signal()
+	u.mu.Unlock()
+}
+
+// next waits for a job; it reports false once closed and drained.
+func (u *uploader) next() (job, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for len(u.queue) == 0 && !u.closed {
+		u.cond.Wait()
+	}
+	if len(u.queue) == 0 {
+		return job{}, false
+	}
+	j := u.queue[0]
+	u.queue = u.queue[1:]
+	return j, true
+}
+
+func (u *uploader) work() {
+	defer u.workers.Done()
+	for {
+		j, ok := u.next()
+		if !ok {
+			return
+		}
+		u.upload(j)
+		j.done()
+	}
+}
+
+// upload copies a recording's files, sidecar last, and removes them locally
+// unless told to keep them.
+func (u *uploader) upload(j job) {
+	start := time.Now()
+	for _, name := range j.files {
+		if err := u.put(name); err != nil {
+			u.log.Warn("Recording upload failed; keeping it on disk", "recording", j.base, "file", name, "err", err)
+			return
+		}
+	}
+	u.log.Debug("Recording uploaded", "recording", j.base, "elapsed", time.Since(start).Round(time.Millisecond).String())
+	if u.cfg.KeepLocal {
+		return
+	}
+	for _, name := range j.files {
+		if err := os.Remove(filepath.Join(u.dir, name)); err != nil {
+			u.log.Warn("Removing uploaded recording failed", "file", name, "err", err)
+		}
+	}
+}
+
+// put uploads one file, retrying with exponential backoff.
+func (u *uploader) put(name string) error {
+	opts := minio.PutObjectOptions{ContentType: "audio/wav"}
+	if strings.HasSuffix(name, ".json") {
+		opts.ContentType = "application/json"
+	}
+	key := path.Join(u.cfg.Prefix, name)
+	delay := retryBaseDelay
+	for attempt := 0; ; attempt++ {
+		_, err := u.client.FPutObject(u.ctx, u.cfg.Bucket, key, filepath.Join(u.dir, name), opts)
+		if err == nil || errors.Is(err, os.ErrNotExist) || attempt >= u.cfg.Retries {
+			return err
+		}
+		u.log.Debug("Retrying recording upload", "file", name, "attempt", attempt+1, "err", err)
+		select {
+		case <-time.After(delay):
+		case <-u.ctx.Done():
+			return u.ctx.Err()
+		}
+		delay = min(2*delay, retryMaxDelay)
+	}
+}
+
+// expire deletes objects past the retention period, now and then hourly.
+func (u *uploader) expire() {
+	defer u.sweeper.Done()
+	ticker := time.NewTicker(retentionSweep)
+	defer ticker.Stop()
+	for {
+		cutoff := time.Now().Add(-u.cfg.Retention)
+		prefix := u.cfg.Prefix
+		if prefix != "" && !strings.HasSuffix(prefix, "/") {
+			prefix += "/"
+		}
+		var deleted int
+		for obj := range u.client.ListObjects(u.ctx, u.cfg.Bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+			if obj.Err != nil {
+				if u.ctx.Err() == nil {
+					u.log.Warn("Listing uploaded recordings failed", "err", obj.Err)
+				}
+				break
+			}
+			if obj.LastModified.After(cutoff) {
+				continue
+			}
+			if err := u.client.RemoveObject(u.ctx, u.cfg.Bucket, obj.Key, minio.RemoveObjectOptions{}); err != nil {
+				u.log.Warn("Deleting expired recording failed", "object", obj.Key, "err", err)
+				continue
+			}
+			deleted++
+		}
+		if deleted > 0 {
+			u.log.Info("Deleted expired recordings", "objects", deleted)
+		}
+		select {
+		case <-ticker.C:
+		case <-u.ctx.Done():
+			return
+		}
+	}
+}
+
+// close lets queued uploads finish until ctx expires, then abandons the
+// rest; their files stay on disk.
+func (u *uploader) close(ctx context.Context) error {
+	u.mu.Lock()
+	u.closed = true
+	u.cond.Broadcast()
+	u.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		u.workers.Wait()
+		close(done)
+	}()
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	// Abort what is left, and the retention sweep with it.
+	u.cancel()
+	<-done
+	u.sweeper.Wait()
+	return err
+}
@@ -0,0 +1,49 @@
+// recording/wav.go
+package recording
+
+import (
+	"bufio"
+	"os"
+
+	"vad-application/audio"
+)
+
+// wavFile writes 16-bit PCM to a WAV file. The header's sizes are filled in
+// by Close, so an unclosed file still opens in most players as a stream.
+type wavFile struct {
+	f    *os.File
+	w    *bufio.Writer
+	size int64
+}
+
+func createWAV(path string, format audio.Format) (*wavFile, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o640)
+	if err != nil {
+		return nil, err
+	}
+	w := &wavFile{f: f, w: bufio.NewWriterSize(f, 64<<10)}
+	if _, err := w.w.Write(audio.WAVHeader(format, 0xffffffff)); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *wavFile) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Close writes the final sizes into the header and closes the file.
+func (w *wavFile) Close(format audio.Format) error {
+	err := w.w.Flush()
+	if err == nil {
+		// Past 4 GiB the size is left open, as for a stream.
+		_, err = w.f.WriteAt(audio.WAVHeader(format, uint32(min(w.size, 0xffffffff))), 0)
+	}
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,96 @@
+// reject.go
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"vad-application/session"
+
+	"github.com/gorilla/websocket"
+)
+
+// maxRejectionBody caps the HTTP error text kept for the error frame.
+const maxRejectionBody = 512
+
+// explainRejections lets WebSocket clients see why they were turned away.
+// Browsers hide the HTTP error answering a refused upgrade, so when h, or
+// middleware inside it, writes one, the connection is upgraded anyway and
+// gets an error frame with the matching code before it is closed.
+func (b *bridge) explainRejections(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !websocket.IsWebSocketUpgrade(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		rw := &rejectionWriter{ResponseWriter: w}
+		h.ServeHTTP(rw, r)
+		if rw.status == 0 {
+			return
+		}
+		ws, err := b.upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		code, closeCode := rejection(rw.status)
+		msg := strings.TrimSpace(rw.body.String())
+		if msg == "" {
+			msg = http.StatusText(rw.status)
+		}
+		retry, _ := strconv.Atoi(w.Header().Get("Retry-After"))
+		session.Reject(ws, closeCode, code, errors.New(msg), time.Duration(retry)*time.Second)
+	})
+}
+
+// rejection maps an HTTP error status to an error code and close code.
+func rejection(status int) (string, int) {
+	switch status {
+	case http.StatusBadRequest:
+		return session.CodeInvalidSettings, websocket.ClosePolicyViolation
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return session.CodeUnauthorized, websocket.ClosePolicyViolation
+	case http.StatusTooManyRequests:
+		return session.CodeQuotaExceeded, websocket.CloseTryAgainLater
+	case http.StatusServiceUnavailable:
+		return session.CodeShuttingDown, websocket.CloseGoingAway
+	default:
+		return session.CodeRejected, websocket.ClosePolicyViolation
+	}
+}
+
+// rejectionWriter holds back an HTTP error response; anything else, such as
+// a successful upgrade, goes through.
+type rejectionWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rw *rejectionWriter) WriteHeader(status int) {
+	if status >= http.StatusBadRequest {
+		rw.status = status
+		return
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *rejectionWriter) Write(p []byte) (int, error) {
+	if rw.status == 0 {
+		return rw.ResponseWriter.Write(p)
+	}
+	if n := maxRejectionBody - rw.body.Len(); n > 0 {
+		rw.body.Write(p[:min(len(p), n)])
+	}
+	return len(p), nil
+}
+
+func (rw *rejectionWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(rw.ResponseWriter).Hijack()
+}
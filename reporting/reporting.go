@@ -0,0 +1,289 @@
+// reporting/reporting.go
+package reporting
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Levels of an Event.
+const (
+	LevelError   = "error"
+	LevelWarning = "warning"
+)
+
+// Delivery limits.
+const (
+	queueSize    = 256
+	postTimeout  = 10 * time.Second
+	flushTimeout = 5 * time.Second
+	// throttle is how long the same problem goes unreported once reported.
+	throttle = time.Minute
+	maxSeen  = 1024
+)
+
+// Config configures a Reporter.
+type Config struct {
+	// DSN is the project's Sentry DSN,
+	// https://<public key>@<host>/<project id>.
+	DSN string
+	// Environment and Release label every event; both may be empty.
+	Environment string
+	Release     string
+}
+
+// Event is one problem to report.
+type Event struct {
+	Level string
+	// Message says what went wrong; it also groups repeats, which are
+	// throttled.
+	Message string
+	// Err, if set, is reported as the exception.
+	Err error
+	// Panic, if set, is the value recovered from, reported with the stack
+	// of the goroutine capturing it, which must be the one that panicked.
+	Panic any
+	// Tags hold the context of the problem, such as the session's ID.
+	Tags map[string]string
+	// Subject is the authenticated caller, if any.
+	Subject string
+}
+
+// Reporter sends events to a Sentry-compatible endpoint in the
+// background. A nil *Reporter drops them.
+type Reporter struct {
+	cfg      Config
+	endpoint string
+	auth     string
+	server   string
+	client   *http.Client
+	log      *slog.Logger
+	queue    chan []byte
+	done     chan struct{}
+
+	mu     sync.Mutex
+	closed bool
+	seen   map[string]time.Time
+}
+
+// New parses cfg.DSN and starts sending.
+func New(cfg Config, logger *slog.Logger) (*Reporter, error) {
+	u, err := url.Parse(cfg.DSN)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User == nil {
+		return nil, errors.New("reporting: DSN is not http(s)://<key>@<host>/<project>")
+	}
+	i := strings.LastIndex(u.Path, "/")
+	if i < 0 || i == len(u.Path)-1 {
+		return nil, errors.New("reporting: DSN names no project")
+	}
+	// Sentry may be hosted under a path prefix.
+	prefix, project := strings.TrimSuffix(u.Path[:i], "/"), u.Path[i+1:]
+	server, _ := os.Hostname()
+	r := &Reporter{
+		cfg:      cfg,
+		endpoint: fmt.Sprintf("%s://%s%s/api/%s/store/", u.Scheme, u.Host, prefix, project),
+		auth:     "Sentry sentry_version=7, sentry_client=vad-bridge/1, sentry_key=" + u.User.Username(),
+		server:   server,
+		client:   &http.Client{Timeout: postTimeout},
+		log:      logger.With("component", "reporting"),
+		queue:    make(chan []byte, queueSize),
+		done:     make(chan struct{}),
+		seen:     map[string]time.Time{},
+	}
+	go r.run()
+	return r, nil
+}
+
+// payload is the JSON body of an event.
+type payload struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   time.Time         `json:"timestamp"`
+	Level       string            `json:"level"`
+	Platform    string            `json:"platform"`
+	Logger      string            `json:"logger"`
+	ServerName  string            `json:"server_name,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Release     string            `json:"release,omitempty"`
+	Message     string            `json:"message"`
+	Exception   *exceptions       `json:"exception,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	User        *user             `json:"user,omitempty"`
+}
+
+type exceptions struct {
+	Values []exception `json:"values"`
+}
+
+type exception struct {
+	Type       string      `json:"type"`
+	Value      string      `json:"value"`
+	Stacktrace *stacktrace `json:"stacktrace,omitempty"`
+}
+
+type stacktrace struct {
+	Frames []frame `json:"frames"`
+}
+
+type frame struct {
+	Function string `json:"function"`
+	Filename string `json:"filename"`
+	Lineno   int    `json:"lineno"`
+	InApp    bool   `json:"in_app"`
+}
+
+type user struct {
+	ID string `json:"id"`
+}
+
+// Capture queues e, unless the same problem was reported less than a
+// minute ago or the queue is full. It never blocks.
+func (r *Reporter) Capture(e Event) {
+	if r == nil {
+		return
+	}
+	p := payload{
+		EventID:     strings.ReplaceAll(uuid.NewString(), "-", ""),
+		Timestamp:   time.Now().UTC(),
+		Level:       e.Level,
+		Platform:    "go",
+		Logger:      "vad-bridge",
+		ServerName:  r.server,
+		Environment: r.cfg.Environment,
+		Release:     r.cfg.Release,
+		Message:     e.Message,
+		Tags:        e.Tags,
+	}
+	if p.Level == "" {
+		p.Level = LevelError
+	}
+	switch {
+	case e.Panic != nil:
+		p.Exception = &exceptions{Values: []exception{{
+			Type:  "panic",
+			Value: fmt.Sprint(e.Panic),
+			// Capture, the deferred function and the runtime's panic
+			// frames are left out.
+			Stacktrace: stack(4),
+		}}}
+	case e.Err != nil:
+		p.Exception = &exceptions{Values: []exception{{Type: fmt.Sprintf("%T", e.Err), Value: e.Err.Error()}}}
+	}
+	if e.Subject != "" {
+		p.User = &user{ID: e.Subject}
+	}
+	key := p.Level + "\x00" + e.Message
+	if p.Exception != nil {
+		key += "\x00" + p.Exception.Values[0].Value
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed || time.Since(r.seen[key]) < throttle {
+		return
+	}
+	if len(r.seen) >= maxSeen {
+		clear(r.seen)
+	}
+	r.seen[key] = time.Now()
+	body, err := json.Marshal(p)
+	if err != nil {
+		r.log.Warn("Error report not encoded", "err", err)
+		return
+	}
+	select {
+	case r.queue <- body:
+	default:
+		r.log.Warn("Error report dropped: queue full", "message", e.Message)
+	}
+}
+
+// stack returns the calling goroutine's stack, oldest frame first, skipping
+// the innermost skip frames.
+func stack(skip int) *stacktrace {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(skip, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	var out []frame
+	for {
+		f, more := frames.Next()
+		if !strings.HasPrefix(f.Function, "runtime.") {
+			out = append(out, frame{
+				Function: f.Function,
+				Filename: f.File,
+				Lineno:   f.Line,
+				InApp:    strings.HasPrefix(f.Function, "vad-application") || strings.HasPrefix(f.Function, "main."),
+			})
+		}
+		if !more {
+			break
+		}
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return &stacktrace{Frames: out}
+}
+
+func (r *Reporter) run() {
+	defer close(r.done)
+	for body := range r.queue {
+		if err := r.post(body); err != nil {
+			r.log.Warn("Error report not sent", "err", err)
+		}
+	}
+}
+
+func (r *Reporter) post(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, r.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "vad-bridge-reporting/1")
+	req.Header.Set("X-Sentry-Auth", r.auth)
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("status %s", resp.Status)
+	}
+	return nil
+}
+
+// Close stops taking events and sends those queued, giving up after a few
+// seconds.
+func (r *Reporter) Close() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return
+	}
+	r.closed = true
+	close(r.queue)
+	r.mu.Unlock()
+
+	select {
+	case <-r.done:
+	case <-time.After(flushTimeout):
+		r.log.Warn("Error reports not sent before shutdown", "queued", len(r.queue))
+	}
+}
@@ -0,0 +1,43 @@
+// schema/schema.go
+package schema
+
+import (
+	_ "embed"
+	"io/fs"
+	"net/http"
+	"path"
+)
+
+//go:generate go run ./tsgen -o ../sdk/typescript/src/protocol.ts protocol.schema.json
+
+// Protocol is the JSON Schema of the messages exchanged over /ws.
+//
+//go:embed protocol.schema.json
+var Protocol []byte
+
+// Handler describes the client protocols, unauthenticated:
+//
+//	GET /schema               the JSON Schema of the WebSocket messages
+//	GET /schema/{name}.proto  a protobuf definition in protos: vad.proto
+//	                          for vad.binary.v1 responses, bridge.proto
+//	                          for the gRPC service
+func Handler(protos fs.FS) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /schema", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/schema+json")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write(Protocol)
+	})
+	mux.HandleFunc("GET /schema/{name}", func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		data, err := fs.ReadFile(protos, name)
+		if path.Ext(name) != ".proto" || err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write(data)
+	})
+	return mux
+}
@@ -0,0 +1,375 @@
+// schema/tsgen/main.go
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// tsgen writes the TypeScript types of the protocol's JSON Schema,
+// for the SDK under sdk/typescript:
+//
+//	go run ./tsgen -o ../sdk/typescript/src/protocol.ts protocol.schema.json
+//
+// It understands the parts of JSON Schema the protocol uses: objects,
+// $ref, const, enum, oneOf and anyOf, and the scalar types.
+func main() {
+	out := flag.String("o", "", "file to write, instead of standard output")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		log.Fatal("usage: tsgen [-o file] schema.json")
+	}
+	data, err := os.ReadFile(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	ts, err := generate(data)
+	if err != nil {
+		log.Fatalf("tsgen: %s: %v", flag.Arg(0), err)
+	}
+	if *out == "" {
+		os.Stdout.Write(ts)
+		return
+	}
+	if err := os.WriteFile(*out, ts, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// schema is a JSON Schema, or one of its subschemas.
+type schema struct {
+	Ref         string             `json:"$ref"`
+	Description string             `json:"description"`
+	Type        string             `json:"type"`
+	Format      string             `json:"format"`
+	Const       any                `json:"const"`
+	Enum        []any              `json:"enum"`
+	OneOf       []*schema          `json:"oneOf"`
+	AnyOf       []*schema          `json:"anyOf"`
+	Items       *schema            `json:"items"`
+	Required    []string           `json:"required"`
+	Properties  map[string]*schema `json:"properties"`
+	Defs        map[string]*schema `json:"$defs"`
+	propOrder   []string
+	defOrder    []string
+}
+
+// root holds the top level's extensions the SDK needs as constants.
+type root struct {
+	Subprotocols map[string]string `json:"x-subprotocols"`
+	TokenPrefix  string            `json:"x-token-subprotocol-prefix"`
+	Query        struct {
+		Settings []string `json:"settings"`
+	} `json:"x-query-parameters"`
+	Binary struct {
+		Header struct {
+			Size int `json:"size"`
+		} `json:"sequence_header"`
+	} `json:"x-binary-audio"`
+}
+
+func generate(data []byte) ([]byte, error) {
+	var s schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	var r root
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	// Maps lose the order of definitions and properties, which the output
+	// keeps.
+	if err := order(data, &s); err != nil {
+		return nil, err
+	}
+	subprotocols, err := keys(data, "x-subprotocols")
+	if err != nil {
+		return nil, err
+	}
+
+	g := &generator{defs: s.Defs}
+	g.line("// Code generated by schema/tsgen from protocol.schema.json. DO NOT EDIT.")
+	g.line("")
+	g.comment("", s.Description)
+	g.line("")
+	g.comment("", "WebSocket subprotocols the bridge speaks.")
+	g.printf("export const Subprotocols = {\n")
+	for _, name := range subprotocols {
+		g.comment("  ", r.Subprotocols[name])
+		g.printf("  %s: %s,\n", constName(name), strconv.Quote(name))
+	}
+	g.printf("} as const;\n\n")
+	g.comment("", "Prefix of the Sec-WebSocket-Protocol entry carrying a bearer token, for browsers, which cannot set headers on WebSocket requests.")
+	g.printf("export const TokenSubprotocolPrefix = %s;\n\n", strconv.Quote(r.TokenPrefix))
+	g.comment("", "Size in bytes of the header sequenced audio frames start with: a big-endian uint32 sequence number, then the capture time as big-endian int64 microseconds since the Unix epoch, zero if unknown.")
+	g.printf("export const SequenceHeaderSize = %d;\n\n", r.Binary.Header.Size)
+	g.comment("", "Query parameters of /ws that set the session's settings.")
+	g.printf("export const SettingsParams = [\n")
+	for _, p := range r.Query.Settings {
+		g.printf("  %s,\n", strconv.Quote(p))
+	}
+	g.printf("] as const;\n")
+
+	for _, name := range s.defOrder {
+		d := s.Defs[name]
+		g.line("")
+		g.comment("", d.Description)
+		if d.Type == "object" || d.Properties != nil {
+			g.object(name, d)
+			continue
+		}
+		t, err := g.typ(d)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if alts := strings.Split(t, " | "); len(alts) > 1 && len(name)+len(t) > 60 {
+			// One alternative a line, as prettier would.
+			t = "\n  | " + strings.Join(alts, "\n  | ")
+		} else {
+			t = " " + t
+		}
+		g.printf("export type %s =%s;\n", name, t)
+	}
+
+	// Frames of the bridge's own, by event, for typed handlers.
+	if frames := s.Defs["ServerFrame"]; frames != nil {
+		g.line("")
+		g.comment("", "The frames the bridge generates itself, by their event.")
+		g.printf("export interface ServerEvents {\n")
+		var events []string
+		for _, sub := range append(frames.OneOf, frames.AnyOf...) {
+			name := strings.TrimPrefix(sub.Ref, "#/$defs/")
+			d := s.Defs[name]
+			if d == nil || d.Properties["event"] == nil || d.Properties["event"].Const == nil {
+				continue
+			}
+			event := strconv.Quote(fmt.Sprint(d.Properties["event"].Const))
+			events = append(events, event)
+			g.printf("  %s: %s;\n", event, name)
+		}
+		g.printf("}\n\n")
+		g.comment("", "The events of ServerEvents; frames with any other event are VAD responses.")
+		g.printf("export const ServerEventNames: ReadonlyArray<keyof ServerEvents> = [\n")
+		for _, e := range events {
+			g.printf("  %s,\n", e)
+		}
+		g.printf("];\n")
+	}
+	if g.err != nil {
+		return nil, g.err
+	}
+	return g.buf.Bytes(), nil
+}
+
+type generator struct {
+	buf  bytes.Buffer
+	defs map[string]*schema
+	err  error
+}
+
+func (g *generator) printf(format string, args ...any) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func (g *generator) line(s string) {
+	g.buf.WriteString(s)
+	g.buf.WriteByte('\n')
+}
+
+// comment writes text as a JSDoc comment, wrapped.
+func (g *generator) comment(indent, text string) {
+	if text == "" {
+		return
+	}
+	words := strings.Fields(text)
+	width := 78 - len(indent) - 3
+	var lines []string
+	cur := ""
+	for _, w := range words {
+		if cur != "" && len(cur)+1+len(w) > width {
+			lines = append(lines, cur)
+			cur = ""
+		}
+		if cur != "" {
+			cur += " "
+		}
+		cur += w
+	}
+	lines = append(lines, cur)
+	if len(lines) == 1 && len(indent)+len(lines[0])+7 <= 78 {
+		g.printf("%s/** %s */\n", indent, lines[0])
+		return
+	}
+	g.printf("%s/**\n", indent)
+	for _, l := range lines {
+		g.printf("%s * %s\n", indent, l)
+	}
+	g.printf("%s */\n", indent)
+}
+
+func (g *generator) object(name string, d *schema) {
+	g.printf("export interface %s {\n", name)
+	for _, p := range d.propOrder {
+		ps := d.Properties[p]
+		t, err := g.typ(ps)
+		if err != nil && g.err == nil {
+			g.err = fmt.Errorf("%s.%s: %w", name, p, err)
+		}
+		opt := "?"
+		for _, r := range d.Required {
+			if r == p {
+				opt = ""
+			}
+		}
+		desc := ps.Description
+		if ps.Format == "date-time" {
+			desc = strings.TrimSpace(desc + " An RFC 3339 time.")
+		}
+		g.comment("  ", desc)
+		g.printf("  %s%s: %s;\n", p, opt, t)
+	}
+	g.printf("}\n")
+}
+
+// typ returns the TypeScript type of s.
+func (g *generator) typ(s *schema) (string, error) {
+	switch {
+	case s.Ref != "":
+		name, ok := strings.CutPrefix(s.Ref, "#/$defs/")
+		if !ok || g.defs[name] == nil {
+			return "", fmt.Errorf("unresolved $ref %q", s.Ref)
+		}
+		return name, nil
+	case s.Const != nil:
+		return literal(s.Const)
+	case s.Enum != nil:
+		var alts []string
+		for _, v := range s.Enum {
+			l, err := literal(v)
+			if err != nil {
+				return "", err
+			}
+			alts = append(alts, l)
+		}
+		return strings.Join(alts, " | "), nil
+	case s.OneOf != nil || s.AnyOf != nil:
+		var alts []string
+		for _, sub := range append(s.OneOf, s.AnyOf...) {
+			t, err := g.typ(sub)
+			if err != nil {
+				return "", err
+			}
+			alts = append(alts, t)
+		}
+		return strings.Join(alts, " | "), nil
+	}
+	switch s.Type {
+	case "string":
+		return "string", nil
+	case "integer", "number":
+		return "number", nil
+	case "boolean":
+		return "boolean", nil
+	case "array":
+		if s.Items == nil {
+			return "unknown[]", nil
+		}
+		t, err := g.typ(s.Items)
+		if err != nil {
+			return "", err
+		}
+		if strings.Contains(t, " ") {
+			t = "(" + t + ")"
+		}
+		return t + "[]", nil
+	case "object":
+		return "Record<string, unknown>", nil
+	}
+	return "", fmt.Errorf("unsupported schema of type %q", s.Type)
+}
+
+func literal(v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return strconv.Quote(v), nil
+	case float64, bool:
+		return fmt.Sprint(v), nil
+	}
+	return "", fmt.Errorf("unsupported literal %v", v)
+}
+
+// constName turns a subprotocol's name into a property name: vad.json.v1
+// becomes json.
+func constName(name string) string {
+	parts := strings.Split(name, ".")
+	if len(parts) == 3 {
+		return parts[1]
+	}
+	return strconv.Quote(name)
+}
+
+// order records the order of s's definitions and of their properties.
+func order(data []byte, s *schema) error {
+	var raw struct {
+		Defs map[string]json.RawMessage `json:"$defs"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	var err error
+	if s.defOrder, err = keys(data, "$defs"); err != nil {
+		return err
+	}
+	for _, name := range s.defOrder {
+		if s.Defs[name].propOrder, err = keys(raw.Defs[name], "properties"); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// keys returns the keys of the object under field of the object in data, in
+// order.
+func keys(data []byte, field string) ([]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil, fmt.Errorf("not an object")
+	}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		var v json.RawMessage
+		if err := dec.Decode(&v); err != nil {
+			return nil, err
+		}
+		if t != field {
+			continue
+		}
+		inner := json.NewDecoder(bytes.NewReader(v))
+		if t, err := inner.Token(); err != nil || t != json.Delim('{') {
+			return nil, fmt.Errorf("%s is not an object", field)
+		}
+		var out []string
+		for inner.More() {
+			k, err := inner.Token()
+			if err != nil {
+				return nil, err
+			}
+			var skip json.RawMessage
+			if err := inner.Decode(&skip); err != nil {
+				return nil, err
+			}
+			out = append(out, k.(string))
+		}
+		return out, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,222 @@
+// sdk/typescript/src/client.ts
+
+import {
+  ClientMessage,
+  ConfigureMessage,
+  PlayFrame,
+  SequenceHeaderSize,
+  ServerEventNames,
+  ServerEvents,
+  Subprotocols,
+  TokenSubprotocolPrefix,
+  VADResponse,
+} from "./protocol";
+
+/** Session settings, as in a configure message or the /ws query. */
+export type Settings = Omit<ConfigureMessage, "type" | "language">;
+
+/** The constructor of a WebSocket implementation, such as the ws package's. */
+export type WebSocketConstructor = new (
+  url: string,
+  protocols?: string | string[],
+) => WebSocket;
+
+export interface ConnectOptions {
+  /** The bridge's base URL, such as wss://vad.example.com. */
+  url: string;
+  /** Path of the WebSocket endpoint; /ws by default. */
+  path?: string;
+  /** JWT sent in Sec-WebSocket-Protocol, as browsers can't set headers. */
+  token?: string;
+  /** Settings sent in the query, ahead of any configure message. */
+  settings?: Settings;
+  /** Resume token of a session to carry on, from its resumable frame. */
+  resume?: string;
+  /** WebSocket implementation; the global one by default. */
+  WebSocket?: WebSocketConstructor;
+}
+
+/** The timing of a sequenced audio frame. */
+export interface Sequence {
+  seq: number;
+  /** Capture time in milliseconds since the Unix epoch. */
+  captureTime?: number;
+}
+
+type Handler<T> = (frame: T) => void;
+
+/**
+ * VADClient runs one session over /ws, in the vad.json.v1 subprotocol: it
+ * sends audio and control messages and hands each frame the bridge sends to
+ * the handlers registered for it.
+ */
+export class VADClient {
+  /** The session's ID, once the bridge has told it. */
+  sessionId?: string;
+  /** The token resuming the session, when the bridge offers one. */
+  resumeToken?: string;
+
+  private handlers = new Map<string, Set<Handler<any>>>();
+  private vadHandlers = new Set<Handler<VADResponse>>();
+  private audioHandlers = new Set<(data: ArrayBuffer, play?: PlayFrame) => void>();
+  private closeHandlers = new Set<(code: number, reason: string) => void>();
+  private playing?: PlayFrame;
+  private flushes: Array<() => void> = [];
+
+  private constructor(private ws: WebSocket) {
+    ws.binaryType = "arraybuffer";
+    ws.onmessage = (e) => this.receive(e.data);
+    ws.onclose = (e) => {
+      for (const h of this.closeHandlers) h(e.code, e.reason);
+    };
+    this.on("resumable", (f) => {
+      this.sessionId = f.session_id;
+      this.resumeToken = f.resume_token;
+    });
+    this.on("resumed", (f) => (this.sessionId = f.session_id));
+    this.on("error", (f) => (this.sessionId ??= f.session_id));
+    this.on("flushed", () => this.flushes.shift()?.());
+    this.on("play", (f) => (this.playing = f));
+    this.on("stop", (f) => {
+      if (this.playing?.id === f.id) this.playing = undefined;
+    });
+  }
+
+  /** connect opens a session, resolving once the connection is open. */
+  static connect(opts: ConnectOptions): Promise<VADClient> {
+    const url = new URL(opts.path ?? "/ws", opts.url);
+    for (const [k, v] of Object.entries(opts.settings ?? {})) {
+      if (v !== undefined) url.searchParams.set(k, String(v));
+    }
+    if (opts.resume) url.searchParams.set("resume", opts.resume);
+    const protocols: string[] = [Subprotocols.json];
+    if (opts.token) protocols.push(TokenSubprotocolPrefix + opts.token);
+
+    const WS = opts.WebSocket ?? globalThis.WebSocket;
+    const ws = new WS(url.toString(), protocols);
+    const client = new VADClient(ws);
+    return new Promise((resolve, reject) => {
+      ws.onopen = () => resolve(client);
+      ws.onerror = () => reject(new Error(`vad: cannot connect to ${url.origin}`));
+    });
+  }
+
+  /** on registers h for the frames of event, returning its removal. */
+  on<K extends keyof ServerEvents>(event: K, h: Handler<ServerEvents[K]>): () => void {
+    let set = this.handlers.get(event);
+    if (!set) this.handlers.set(event, (set = new Set()));
+    set.add(h);
+    return () => set!.delete(h);
+  }
+
+  /** onVAD registers h for the backend's VAD responses. */
+  onVAD(h: Handler<VADResponse>): () => void {
+    this.vadHandlers.add(h);
+    return () => this.vadHandlers.delete(h);
+  }
+
+  /**
+   * onAudio registers h for the audio of spoken utterances, with the play
+   * frame announcing it.
+   */
+  onAudio(h: (data: ArrayBuffer, play?: PlayFrame) => void): () => void {
+    this.audioHandlers.add(h);
+    return () => this.audioHandlers.delete(h);
+  }
+
+  /** onClose registers h for the end of the connection. */
+  onClose(h: (code: number, reason: string) => void): () => void {
+    this.closeHandlers.add(h);
+    return () => this.closeHandlers.delete(h);
+  }
+
+  /** send sends a control message. */
+  send(msg: ClientMessage): void {
+    this.ws.send(JSON.stringify(msg));
+  }
+
+  /**
+   * sendAudio sends a frame of audio in the session's format, with its
+   * sequence header when the session is sequenced.
+   */
+  sendAudio(data: ArrayBuffer | ArrayBufferView, seq?: Sequence): void {
+    if (!seq) {
+      this.ws.send(data);
+      return;
+    }
+    const body = data instanceof ArrayBuffer
+      ? new Uint8Array(data)
+      : new Uint8Array(data.buffer, data.byteOffset, data.byteLength);
+    this.ws.send(withSequenceHeader(body, seq));
+  }
+
+  configure(settings: Settings): void {
+    this.send({ type: "configure", ...settings });
+  }
+
+  start(): void {
+    this.send({ type: "start" });
+  }
+
+  pause(): void {
+    this.send({ type: "pause" });
+  }
+
+  /** stop ends the input; the bridge closes once its events are sent. */
+  stop(): void {
+    this.send({ type: "stop" });
+  }
+
+  /**
+   * flush resolves once all audio sent so far has reached the backend.
+   */
+  flush(): Promise<void> {
+    return new Promise((resolve) => {
+      this.flushes.push(resolve);
+      this.send({ type: "flush" });
+    });
+  }
+
+  speak(text: string, voice?: string): void {
+    this.send({ type: "speak", text, voice });
+  }
+
+  interrupt(): void {
+    this.send({ type: "interrupt" });
+  }
+
+  /** close closes the connection without waiting for the session's end. */
+  close(code = 1000, reason = ""): void {
+    this.ws.close(code, reason);
+  }
+
+  private receive(data: unknown): void {
+    if (data instanceof ArrayBuffer) {
+      for (const h of this.audioHandlers) h(data, this.playing);
+      return;
+    }
+    let frame: { event?: string };
+    try {
+      frame = JSON.parse(String(data));
+    } catch {
+      return;
+    }
+    const event = frame.event;
+    if (event !== undefined && (ServerEventNames as readonly string[]).includes(event)) {
+      for (const h of this.handlers.get(event) ?? []) h(frame);
+      return;
+    }
+    for (const h of this.vadHandlers) h(frame as VADResponse);
+  }
+}
+
+/** withSequenceHeader returns audio preceded by its sequence header. */
+export function withSequenceHeader(audio: Uint8Array, seq: Sequence): Uint8Array {
+  const out = new Uint8Array(SequenceHeaderSize + audio.byteLength);
+  const view = new DataView(out.buffer);
+  view.setUint32(0, seq.seq >>> 0);
+  const us = seq.captureTime === undefined ? 0n : BigInt(Math.round(seq.captureTime * 1000));
+  view.setBigInt64(4, us);
+  out.set(audio, SequenceHeaderSize);
+  return out;
+}
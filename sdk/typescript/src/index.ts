@@ -0,0 +1,4 @@
+// sdk/typescript/src/index.ts
+
+export * from "./protocol";
+export * from "./client";
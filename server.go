@@ -0,0 +1,139 @@
+// server.go
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+
+	"vad-application/config"
+	"vad-application/webtransport"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// server is the HTTP/WebSocket listeners, served over TLS when a certificate
+// or autocert domains are configured, plus the optional HTTP redirector and
+// WebTransport listener.
+type server struct {
+	cfg      config.Config
+	srv      *http.Server
+	redirect *http.Server
+	wt       *webtransport.Server
+}
+
+func newServer(cfg config.Config, h http.Handler, wt *webtransport.Server) *server {
+	s := &server{cfg: cfg, srv: &http.Server{Addr: cfg.ListenAddr, Handler: h}, wt: wt}
+	if !cfg.TLSEnabled() {
+		if cfg.GRPCService {
+			// gRPC clients speak HTTP/2 without negotiating it.
+			s.srv.Protocols = new(http.Protocols)
+			s.srv.Protocols.SetHTTP1(true)
+			s.srv.Protocols.SetUnencryptedHTTP2(true)
+		}
+		return s
+	}
+
+	redirect := httpsRedirect(cfg.ListenAddr)
+	if len(cfg.TLSAutocertDomains) > 0 {
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.TLSAutocertDomains...),
+			Cache:      autocert.DirCache(cfg.TLSAutocertCacheDir),
+			Email:      cfg.TLSAutocertEmail,
+		}
+		s.srv.TLSConfig = m.TLSConfig()
+		// ACME http-01 challenges arrive on the plain HTTP listener.
+		redirect = m.HTTPHandler(redirect)
+	}
+	if cfg.HTTPRedirectAddr != "" {
+		s.redirect = &http.Server{Addr: cfg.HTTPRedirectAddr, Handler: redirect}
+	}
+	return s
+}
+
+// ListenAndServe blocks until a listener fails or Shutdown is called, in
+// which case it returns nil.
+func (s *server) ListenAndServe() error {
+	mode, _ := strconv.ParseUint(s.cfg.UnixSocketMode, 8, 32)
+	lns, err := listen(s.cfg.Listeners(), fs.FileMode(mode))
+	if err != nil {
+		return err
+	}
+	errc := make(chan error, len(lns))
+	if !s.cfg.TLSEnabled() {
+		for _, l := range lns {
+			slog.Info("Server listening", "addr", l.Addr().String(), "network", l.Addr().Network())
+			go func() { errc <- s.srv.Serve(l) }()
+		}
+	} else {
+		if s.redirect != nil {
+			go func() {
+				slog.Info("Redirecting HTTP to HTTPS", "addr", s.cfg.HTTPRedirectAddr)
+				if err := s.redirect.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					slog.Error("HTTP redirect listener failed", "err", err)
+				}
+			}()
+		}
+		if s.wt != nil {
+			// Taken before ServeTLS may set a TLSConfig of its own.
+			tlsConf := s.srv.TLSConfig
+			go func() {
+				slog.Info("WebTransport listening", "addr", s.cfg.WebTransportAddr)
+				err := s.wt.ListenAndServe(s.cfg.TLSCertFile, s.cfg.TLSKeyFile, tlsConf)
+				if err != nil && !errors.Is(err, http.ErrServerClosed) && !errors.Is(err, net.ErrClosed) {
+					slog.Error("WebTransport listener failed", "err", err)
+				}
+			}()
+		}
+		for _, l := range lns {
+			slog.Info("Server listening with TLS", "addr", l.Addr().String(), "network", l.Addr().Network())
+			go func() { errc <- s.srv.ServeTLS(l, s.cfg.TLSCertFile, s.cfg.TLSKeyFile) }()
+		}
+	}
+	// Shutdown makes every Serve return; the first to return tells why.
+	err = <-errc
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Shutdown stops accepting connections. Hijacked WebSocket connections and
+// WebTransport sessions are not affected; they are drained by the session
+// manager, and the latter closed with Close.
+func (s *server) Shutdown(ctx context.Context) error {
+	var errs []error
+	if s.redirect != nil {
+		errs = append(errs, s.redirect.Shutdown(ctx))
+	}
+	errs = append(errs, s.srv.Shutdown(ctx))
+	return errors.Join(errs...)
+}
+
+// httpsRedirect sends every request to the same URL on the HTTPS listener.
+func httpsRedirect(tlsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(tlsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
+
+// Close closes the WebTransport listener and what is left of its sessions.
+func (s *server) Close() error {
+	if s.wt == nil {
+		return nil
+	}
+	return s.wt.Close()
+}
@@ -0,0 +1,49 @@
+// session/bargein.go
+package session
+
+import (
+	"context"
+	"errors"
+
+	"vad-application/events"
+	"vad-application/metrics"
+)
+
+// errBargeIn cancels an assistant reply the user spoke over.
+var errBargeIn = errors.New("user started speaking")
+
+// bargeInFrame tells the client that its user spoke over the assistant, at
+// Offset seconds of session audio; the speech being played back stops.
+type bargeInFrame struct {
+	Event  string  `json:"event"`
+	Offset float64 `json:"offset"`
+}
+
+// bargeIn runs when the backend reports speech: whatever the assistant is
+// generating or playing back is cancelled, so that the user has the floor.
+func (s *Session) bargeIn() {
+	s.replyMu.Lock()
+	cancel := s.cancelReply
+	s.replyMu.Unlock()
+	if cancel == nil && !s.player.busy() {
+		return
+	}
+	metrics.BargeIns.Inc()
+	s.log.Debug("User spoke over the assistant")
+	s.publish(events.Event{Kind: events.BargeIn})
+	if err := s.writeJSON(bargeInFrame{Event: "barge_in", Offset: s.audioOffset()}); err != nil {
+		s.log.Debug("Barge-in not sent", "err", err)
+	}
+	if cancel != nil {
+		cancel(errBargeIn)
+	}
+	s.Interrupt()
+}
+
+// setReply records the cancel function of the reply being generated, or
+// clears it with nil.
+func (s *Session) setReply(cancel context.CancelCauseFunc) {
+	s.replyMu.Lock()
+	s.cancelReply = cancel
+	s.replyMu.Unlock()
+}
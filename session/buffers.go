@@ -0,0 +1,56 @@
+// session/buffers.go
+package session
+
+import (
+	"io"
+	"sync"
+)
+
+const (
+	// initialBufferSize fits about 250 ms of 16 kHz 16-bit mono audio.
+	initialBufferSize = 8 << 10
+	// maxPooledBuffer keeps the occasional oversized frame from pinning a
+	// large buffer in the pool.
+	maxPooledBuffer = 64 << 10
+)
+
+// bufferPool recycles audio frame buffers across all sessions.
+var bufferPool = sync.Pool{
+	New: func() any {
+		b := make([]byte, 0, initialBufferSize)
+		return &b
+	},
+}
+
+func getBuffer() *[]byte {
+	return bufferPool.Get().(*[]byte)
+}
+
+func putBuffer(b *[]byte) {
+	if b == nil || cap(*b) > maxPooledBuffer {
+		return
+	}
+	*b = (*b)[:0]
+	bufferPool.Put(b)
+}
+
+// readFrame reads the rest of r into b, growing it as needed, and stores
+// the result back in b.
+func readFrame(r io.Reader, b *[]byte) error {
+	buf := (*b)[:0]
+	for {
+		if len(buf) == cap(buf) {
+			buf = append(buf, 0)[:len(buf)]
+		}
+		n, err := r.Read(buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+		if err == io.EOF {
+			*b = buf
+			return nil
+		}
+		if err != nil {
+			*b = buf
+			return err
+		}
+	}
+}
@@ -0,0 +1,62 @@
+// session/clips.go
+package session
+
+import (
+	"slices"
+
+	"vad-application/audio"
+	"vad-application/events"
+	"vad-application/metrics"
+)
+
+// Destinations of speech clips, for Config.Clips.
+const (
+	// ClipClient sends each clip to the client in a speech_clip frame.
+	ClipClient = "client"
+	// ClipRecording saves each clip next to the session's recording.
+	ClipRecording = "recording"
+	// ClipEvents publishes each clip as a Clip event.
+	ClipEvents = "events"
+)
+
+// clipFrame carries the audio of one speech segment as a base64 WAV file,
+// with its span in seconds of session audio. Truncated is set when the
+// segment ran past the longest clip kept and its end is missing.
+type clipFrame struct {
+	Event      string  `json:"event"`
+	Start      float64 `json:"start"`
+	End        float64 `json:"end"`
+	Encoding   string  `json:"encoding"`
+	SampleRate int     `json:"sample_rate"`
+	Audio      []byte  `json:"audio"`
+	Truncated  bool    `json:"truncated,omitempty"`
+}
+
+// clip delivers the audio of a closed speech segment to the configured
+// destinations as a WAV clip.
+func (s *Session) clip(pcm []byte, seg events.SpeechSegment, truncated bool) {
+	if len(s.cfg.Clips) == 0 || len(pcm) == 0 {
+		return
+	}
+	wav := append(audio.WAVHeader(audio.Backend, uint32(len(pcm))), pcm...)
+	if slices.Contains(s.cfg.Clips, ClipClient) {
+		if err := s.writeJSON(clipFrame{
+			Event:      "speech_clip",
+			Start:      seg.Start,
+			End:        seg.End,
+			Encoding:   "wav",
+			SampleRate: audio.Backend.SampleRate,
+			Audio:      wav,
+			Truncated:  truncated,
+		}); err != nil {
+			s.log.Debug("Speech clip not sent", "err", err)
+		}
+	}
+	if slices.Contains(s.cfg.Clips, ClipRecording) {
+		s.rec.Clip(seg, pcm)
+	}
+	if slices.Contains(s.cfg.Clips, ClipEvents) {
+		s.publish(events.Event{Kind: events.Clip, Segment: &seg, Audio: wav})
+	}
+	metrics.SpeechClips.Inc()
+}
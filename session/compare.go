@@ -0,0 +1,93 @@
+// session/compare.go
+package session
+
+import (
+	"math"
+
+	"vad-application/events"
+)
+
+// compare diffs the speech segments two backends found in audio seconds of
+// the same session. Each primary segment is matched with the shadow segment
+// overlapping it most.
+func compare(primary, shadow []events.SpeechSegment, audio float64) *events.Diff {
+	c := &events.Diff{
+		Audio:           audio,
+		PrimarySegments: primary,
+		ShadowSegments:  shadow,
+		Disagreements:   []events.Disagreement{},
+	}
+	used := make([]bool, len(shadow))
+	var startSum, endSum float64
+	for _, p := range primary {
+		best, bestOverlap := -1, 0.0
+		for i, sh := range shadow {
+			if o := overlap(p, sh); !used[i] && o > bestOverlap {
+				best, bestOverlap = i, o
+			}
+		}
+		if best < 0 {
+			continue
+		}
+		used[best] = true
+		c.Matched++
+		ds, de := shadow[best].Start-p.Start, shadow[best].End-p.End
+		startSum += ds
+		endSum += de
+		c.MaxStartDelta = max(c.MaxStartDelta, math.Abs(ds))
+		c.MaxEndDelta = max(c.MaxEndDelta, math.Abs(de))
+	}
+	if c.Matched > 0 {
+		c.MeanStartDelta = startSum / float64(c.Matched)
+		c.MeanEndDelta = endSum / float64(c.Matched)
+	}
+
+	// Walk both timelines at once; wherever exactly one backend hears
+	// speech is a disagreement.
+	var disagreed float64
+	var i, j int
+	var cur *events.Disagreement
+	for t := 0.0; t < audio; {
+		inP, nextP := position(primary, &i, t, audio)
+		inS, nextS := position(shadow, &j, t, audio)
+		next := min(nextP, nextS)
+		if inP != inS {
+			by := "primary"
+			if inS {
+				by = "shadow"
+			}
+			if cur != nil && cur.End == t && cur.Speech == by {
+				cur.End = next
+			} else {
+				c.Disagreements = append(c.Disagreements, events.Disagreement{Start: t, End: next, Speech: by})
+				cur = &c.Disagreements[len(c.Disagreements)-1]
+			}
+			disagreed += next - t
+		}
+		t = next
+	}
+	if audio > 0 {
+		c.Agreement = 1 - disagreed/audio
+	}
+	return c
+}
+
+// position reports whether t falls in one of segs, sorted and disjoint, and
+// where that next changes. *i is the first segment not ending before t.
+func position(segs []events.SpeechSegment, i *int, t, end float64) (bool, float64) {
+	for *i < len(segs) && segs[*i].End <= t {
+		*i++
+	}
+	if *i == len(segs) {
+		return false, end
+	}
+	s := segs[*i]
+	if t < s.Start {
+		return false, min(s.Start, end)
+	}
+	return true, min(s.End, end)
+}
+
+func overlap(a, b events.SpeechSegment) float64 {
+	return max(0, min(a.End, b.End)-max(a.Start, b.Start))
+}
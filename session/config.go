@@ -0,0 +1,139 @@
+// session/config.go
+package session
+
+import (
+	"time"
+
+	"vad-application/asr"
+	"vad-application/events"
+	pb "vad-application/grpc_modules"
+	"vad-application/llm"
+	"vad-application/pipeline"
+	"vad-application/recording"
+	"vad-application/reporting"
+	"vad-application/tts"
+)
+
+// Config holds the settings shared by every session of a Manager.
+type Config struct {
+	// MaxSessions caps the open sessions; zero means unlimited.
+	MaxSessions int
+	// MaxMessageBytes is the largest WebSocket message accepted from a
+	// client; larger ones close the connection. Zero means unlimited.
+	MaxMessageBytes int64
+	// QueueSize is how many audio chunks may wait for the backend, and
+	// QueuePolicy what happens to new ones once that many do.
+	QueueSize   int
+	QueuePolicy QueuePolicy
+	// LatencyBudget enables real-time mode: queued audio older than this by
+	// the time it could be sent is dropped. Zero keeps every chunk.
+	LatencyBudget time.Duration
+
+	// DialTimeout bounds opening a backend stream, retries included; zero
+	// makes a single attempt.
+	DialTimeout time.Duration
+	// StreamDeadline bounds each backend stream; zero means none.
+	StreamDeadline time.Duration
+	// ChunkAcks says the backend answers every chunk, in order, with one
+	// response, "continue" when nothing changed; the bridge then measures
+	// each chunk's latency and keeps the acknowledgements to itself.
+	// EchoLatency adds the latency to JSON responses.
+	ChunkAcks   bool
+	EchoLatency bool
+	// EnrichEvents adds to JSON responses when the bridge received them,
+	// and how much audio, in seconds and frames, the client had sent.
+	EnrichEvents bool
+	// FillGaps replaces frames lost from sequenced audio with silence.
+	FillGaps bool
+	// Pipeline processes each session's audio for the backend. When it
+	// cuts frames, a JitterBuffer delays them this much and paces them at
+	// real time.
+	Pipeline     pipeline.Config
+	JitterBuffer time.Duration
+	// StreamConfig opens every backend stream with a config message
+	// carrying the session's Settings.
+	StreamConfig bool
+	// FailoverAttempts is how many times a session may move to another
+	// backend after its stream breaks; zero disables failover.
+	// FailoverReplay is how much of the latest audio is sent again to the
+	// new backend.
+	FailoverAttempts int
+	FailoverReplay   time.Duration
+	// OutageBuffer is how long a session whose backend stream broke keeps
+	// trying to open another, holding up to that much of the client's
+	// audio for it; zero leaves broken streams to failover alone.
+	OutageBuffer time.Duration
+
+	// QueryParams, when set, are the only SettingsParams clients may set
+	// in the URL; configure messages may still change the others.
+	QueryParams []string
+
+	// PingInterval is how often the client is pinged, and PongTimeout how
+	// long past that it may stay silent before the session is dropped. Zero
+	// PingInterval disables keepalive.
+	PingInterval time.Duration
+	PongTimeout  time.Duration
+	// IdleTimeout closes sessions that have sent no audio for this long;
+	// zero disables it.
+	IdleTimeout time.Duration
+	// ResumeWindow is how long a WebSocket session whose connection was
+	// lost waits for its client to resume it on a new one; zero ends it
+	// at once.
+	ResumeWindow time.Duration
+	// HeartbeatInterval is how often the client gets a heartbeat frame
+	// once streaming; zero sends none.
+	HeartbeatInterval time.Duration
+	// LevelInterval is how much audio each audio_level frame covers; zero
+	// sends none.
+	LevelInterval time.Duration
+
+	// WakeWord, when set, hears each session's audio before the backend
+	// does: nothing reaches the backend until it answers with WakeEvent.
+	// The audio then flows, starting with the last WakePreroll held back,
+	// until WakeWindow passes without speech.
+	WakeWord    pb.VADServiceClient
+	WakeEvent   string
+	WakeWindow  time.Duration
+	WakePreroll time.Duration
+
+	// Transcriber, when set, gets the audio of every speech segment, from
+	// TranscribePreroll before its start, and at most MaxTranscribed of
+	// it; each request may take TranscribeTimeout. Transcripts are sent to
+	// the client and published.
+	Transcriber       asr.Transcriber
+	TranscribePreroll time.Duration
+	MaxTranscribed    time.Duration
+	TranscribeTimeout time.Duration
+	// Clips, when set, cuts the audio of every speech segment the same way
+	// and delivers it as a WAV clip to each of its destinations: ClipClient,
+	// ClipRecording or ClipEvents.
+	Clips []string
+
+	// Synthesizer, when set, lets sessions speak to their client: text
+	// passed to Speak, or sent in speak messages, is synthesized and
+	// streamed back as binary frames between play and stop frames.
+	Synthesizer tts.Synthesizer
+
+	// Assistant, when set along with a Transcriber, replies to every
+	// transcript, seeing SystemPrompt and the last MaxTurns exchanges of
+	// the session; each reply may take ReplyTimeout. Replies stream to the
+	// client and, with a Synthesizer, are spoken.
+	Assistant    llm.Completer
+	SystemPrompt string
+	MaxTurns     int
+	ReplyTimeout time.Duration
+	// BargeIn cancels the reply being generated or spoken when the
+	// backend reports the start of speech.
+	BargeIn bool
+
+	// Recorder, when set, saves each session's audio and VAD events.
+	Recorder *recording.Recorder
+	// Events, when set, receives every session's lifecycle and VAD events.
+	Events events.Sink
+	// Viewers, when set, lets listen-only clients follow sessions. It must
+	// be among the Events sinks.
+	Viewers *events.Hub
+	// Errors, when set, is told of panics, sessions no backend could
+	// serve and clients closing with unusual codes.
+	Errors *reporting.Reporter
+}
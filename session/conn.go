@@ -0,0 +1,24 @@
+// session/conn.go
+package session
+
+import (
+	"io"
+	"net"
+	"time"
+)
+
+// Conn is a client connection carrying the session protocol: text and
+// binary messages, and WebSocket control messages. *websocket.Conn is one,
+// as is a WebTransport session adapted by package webtransport.
+type Conn interface {
+	Subprotocol() string
+	RemoteAddr() net.Addr
+	NextReader() (messageType int, r io.Reader, err error)
+	ReadMessage() (messageType int, p []byte, err error)
+	WriteMessage(messageType int, data []byte) error
+	WriteControl(messageType int, data []byte, deadline time.Time) error
+	SetReadDeadline(t time.Time) error
+	SetReadLimit(limit int64)
+	SetPongHandler(h func(appData string) error)
+	Close() error
+}
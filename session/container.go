@@ -0,0 +1,82 @@
+// session/container.go
+package session
+
+import (
+	"errors"
+
+	"vad-application/audio"
+)
+
+// maxHeaderBytes bounds how much of a stream is held while waiting for the
+// end of a WAV header.
+const maxHeaderBytes = 64 << 10
+
+// wavStream unwraps audio streamed as a WAV file, header and all, instead of
+// raw samples. The header then decides the format, overriding the session's
+// settings, and frames need not end on sample boundaries.
+type wavStream struct {
+	// sniffed is set once the start of the stream has been examined, and
+	// active if it held a WAV header.
+	sniffed, active bool
+	f               audio.Format
+	header          []byte
+	// left counts the data chunk bytes still to come, or is -1 if the
+	// writer left the size open. Anything after the data chunk is dropped.
+	left int64
+	// partial holds a sample split across frames.
+	partial, scratch []byte
+}
+
+// unwrap reduces the binary frame in *buf to the whole samples it carries,
+// possibly none while a header is still arriving. It returns the format when
+// the frame completes a header.
+func (w *wavStream) unwrap(buf *[]byte) (*audio.Format, error) {
+	var found *audio.Format
+	if !w.sniffed {
+		w.header = append(w.header, *buf...)
+		f, offset, size, err := audio.ParseStreamHeader(w.header)
+		switch {
+		case errors.Is(err, audio.ErrUnknownContainer):
+			w.sniffed, w.header = true, nil
+			return nil, nil
+		case errors.Is(err, audio.ErrShortHeader):
+			if len(w.header) > maxHeaderBytes {
+				return nil, errors.New("wav header too large")
+			}
+			*buf = (*buf)[:0]
+			return nil, nil
+		case err != nil:
+			return nil, err
+		}
+		w.sniffed, w.active = true, true
+		w.f, w.left = f, size
+		*buf = append((*buf)[:0], w.header[offset:]...)
+		w.header = nil
+		found = &f
+	}
+	if !w.active {
+		return nil, nil
+	}
+
+	data := *buf
+	if w.left >= 0 {
+		data = data[:min(int64(len(data)), w.left)]
+		w.left -= int64(len(data))
+	}
+	if len(w.partial) > 0 {
+		w.scratch = append(append(w.scratch[:0], w.partial...), data...)
+		data = append((*buf)[:0], w.scratch...)
+	}
+	n := len(data) - len(data)%w.f.FrameSize()
+	w.partial = append(w.partial[:0], data[n:]...)
+	*buf = data[:n]
+	return found, nil
+}
+
+// format is the stream's audio format: the header's, if it had one.
+func (w *wavStream) format(configured audio.Format) audio.Format {
+	if w.active {
+		return w.f
+	}
+	return configured
+}
@@ -0,0 +1,136 @@
+// session/container_test.go
+package session
+
+import (
+	"bytes"
+	"testing"
+
+	"vad-application/audio"
+)
+
+// unwrapAll feeds frames through a wavStream, returning the samples it let
+// through, the formats it reported and the first error.
+func unwrapAll(frames [][]byte) (samples []byte, found []audio.Format, err error) {
+	var w wavStream
+	for _, fr := range frames {
+		buf := append([]byte(nil), fr...)
+		f, err := w.unwrap(&buf)
+		if err != nil {
+			return samples, found, err
+		}
+		if f != nil {
+			found = append(found, *f)
+		}
+		samples = append(samples, buf...)
+	}
+	return samples, found, nil
+}
+
+// split cuts b at the given offsets.
+func split(b []byte, at ...int) [][]byte {
+	var frames [][]byte
+	prev := 0
+	for _, i := range at {
+		frames = append(frames, b[prev:i])
+		prev = i
+	}
+	return append(frames, b[prev:])
+}
+
+func TestWAVStreamUnwrap(t *testing.T) {
+	pcm := audio.Format{SampleRate: 16000, Channels: 1}.WithEncoding(audio.PCM16)
+	stereo := audio.Format{SampleRate: 8000, Channels: 2}.WithEncoding(audio.PCM16)
+	samples := make([]byte, 100)
+	for i := range samples {
+		samples[i] = byte(i + 1)
+	}
+	h := audio.WAVHeaderSize
+	sized := append(audio.WAVHeader(pcm, 100), samples...)
+	open := append(audio.WAVHeader(pcm, 0xffffffff), samples...)
+	trailing := append(append([]byte(nil), sized...), "LIST\x04\x00\x00\x00junk"...)
+
+	tests := []struct {
+		name   string
+		frames [][]byte
+		format *audio.Format
+		want   []byte
+	}{
+		{"one frame", [][]byte{sized}, &pcm, samples},
+		{"header split", split(sized, 3, 20, h-1), &pcm, samples},
+		{"header and samples split", split(sized, h+5), &pcm, samples},
+		{"odd sample boundaries", split(sized, h+1, h+4, h+7, h+50), &pcm, samples},
+		{"byte by byte", split(sized, func() []int {
+			var at []int
+			for i := 1; i < len(sized); i++ {
+				at = append(at, i)
+			}
+			return at
+		}()...), &pcm, samples},
+		{"open-ended", split(open, h+3, h+60), &pcm, samples},
+		{"past the data chunk", split(trailing, h+51), &pcm, samples},
+		{"stereo frames", split(append(audio.WAVHeader(stereo, 100), samples...), h+2, h+5), &stereo, samples},
+		{"raw audio", split(samples, 3, 50), nil, samples},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found, err := unwrapAll(tt.frames)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.format == nil && len(found) != 0 || tt.format != nil && (len(found) != 1 || found[0] != *tt.format) {
+				t.Errorf("formats found = %v, want %v", found, tt.format)
+			}
+			// Only whole samples go through; the rest waits for more.
+			want := tt.want
+			if tt.format != nil {
+				want = want[:len(want)-len(want)%tt.format.FrameSize()]
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("samples = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestWAVStreamUnwrapErrors(t *testing.T) {
+	pcm := audio.Format{SampleRate: 16000, Channels: 1}.WithEncoding(audio.PCM16)
+	// A chunk before fmt so large that the header never ends.
+	endless := append([]byte("RIFF\x00\x00\x00\x00WAVELIST\xff\xff\xff\x7f"), make([]byte, maxHeaderBytes)...)
+	// A fmt chunk of 4 GiB.
+	hugeFmt := append(audio.WAVHeader(pcm, 0)[:16], 0xff, 0xff, 0xff, 0xff)
+	hugeFmt = append(hugeFmt, audio.WAVHeader(pcm, 0)[20:]...)
+	tests := []struct {
+		name   string
+		frames [][]byte
+	}{
+		{"header too large", split(endless, 100, 1000)},
+		{"fmt chunk too large", [][]byte{hugeFmt}},
+		{"flac", [][]byte{[]byte("fLaC\x00\x00\x00\x22")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := unwrapAll(tt.frames); err == nil {
+				t.Error("unwrap took the stream")
+			}
+		})
+	}
+}
+
+func TestWAVStreamFormat(t *testing.T) {
+	configured := audio.Backend
+	stereo := audio.Format{SampleRate: 8000, Channels: 2}.WithEncoding(audio.PCM16)
+
+	var raw wavStream
+	buf := []byte{1, 2, 3, 4}
+	raw.unwrap(&buf)
+	if got := raw.format(configured); got != configured {
+		t.Errorf("raw stream format = %v, want the configured %v", got, configured)
+	}
+
+	var wav wavStream
+	buf = audio.WAVHeader(stereo, 0xffffffff)
+	wav.unwrap(&buf)
+	if got := wav.format(configured); got != stereo {
+		t.Errorf("WAV stream format = %v, want the header's %v", got, stereo)
+	}
+}
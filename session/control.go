@@ -0,0 +1,553 @@
+// session/control.go
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"vad-application/audio"
+	pb "vad-application/grpc_modules"
+
+	"golang.org/x/text/language"
+)
+
+// gRPC metadata keys carrying the client's settings to the backend. The
+// format keys describe the audio as the backend receives it, after any
+// conversion by the bridge; the client format keys, as the client declared
+// it.
+const (
+	MetadataEncoding       = "x-vad-encoding"
+	MetadataSampleRate     = "x-vad-sample-rate"
+	MetadataChannels       = "x-vad-channels"
+	MetadataSensitivity    = "x-vad-sensitivity"
+	MetadataLocale         = "x-vad-locale"
+	MetadataModel          = "x-vad-model"
+	MetadataMinSpeech      = "x-vad-min-speech-ms"
+	MetadataMinSilence     = "x-vad-min-silence-ms"
+	MetadataPreroll        = "x-vad-preroll-ms"
+	MetadataDenoised       = "x-vad-denoised"
+	MetadataClientEncoding = "x-vad-client-encoding"
+	MetadataClientRate     = "x-vad-client-sample-rate"
+	MetadataClientChannels = "x-vad-client-channels"
+)
+
+// maxEndpointingMS bounds the endpointing durations a client may ask for.
+const maxEndpointingMS = 10000
+
+// maxModelName bounds the model names a client may ask for.
+const maxModelName = 64
+
+// Control message types. Clients send them as JSON text frames, interleaved
+// with binary audio frames:
+//
+//	{"type": "configure", "encoding": "pcm_s16le", "sample_rate": 16000, "channels": 1}
+//	{"type": "configure", "min_silence_ms": 1200, "sensitivity": 0.7}
+//	{"type": "configure", "language": "uz", "model": "vad-uz-v2"}
+//	{"type": "configure", "sequenced": true, "denoise": true, "agc_target_dbfs": -20}
+//	{"type": "start"}
+//	{"type": "speak", "text": "Hello!"}
+const (
+	// ControlStart opens the backend stream, or resumes a paused session.
+	// Sending audio without it starts the session implicitly.
+	ControlStart = "start"
+	// ControlStop ends the input; remaining VAD events are still delivered
+	// before the session closes.
+	ControlStop = "stop"
+	// ControlPause discards incoming audio until the next start.
+	ControlPause = "pause"
+	// ControlConfigure chooses the audio format and backend settings. It
+	// must precede start.
+	ControlConfigure = "configure"
+	// ControlFlush asks for a "flushed" event once all audio received so
+	// far has been handed to the backend.
+	ControlFlush = "flush"
+	// ControlSpeak queues Text to be spoken back with Voice, when the
+	// bridge has a speech synthesizer.
+	ControlSpeak = "speak"
+	// ControlInterrupt silences the speech being played back and drops
+	// the queued utterances.
+	ControlInterrupt = "interrupt"
+)
+
+// controlMessage is a control frame sent by the client. Zero fields are left
+// unchanged by configure.
+type controlMessage struct {
+	Type        string         `json:"type"`
+	Encoding    audio.Encoding `json:"encoding,omitempty"`
+	SampleRate  int            `json:"sample_rate,omitempty"`
+	BitDepth    int            `json:"bit_depth,omitempty"`
+	Channels    int            `json:"channels,omitempty"`
+	Channel     *int           `json:"channel,omitempty"`
+	Sensitivity *float64       `json:"sensitivity,omitempty"`
+	Locale      string         `json:"locale,omitempty"`
+	Language    string         `json:"language,omitempty"`
+	Model       string         `json:"model,omitempty"`
+	Text        string         `json:"text,omitempty"`
+	Voice       string         `json:"voice,omitempty"`
+
+	// Endpointing durations, in milliseconds.
+	MinSpeechMS  *int `json:"min_speech_ms,omitempty"`
+	MinSilenceMS *int `json:"min_silence_ms,omitempty"`
+	PrerollMS    *int `json:"preroll_ms,omitempty"`
+
+	// Sequenced makes every audio frame start with a sequence header,
+	// Denoise suppresses noise in the audio and DTMF listens for keypad
+	// tones.
+	Sequenced *bool `json:"sequenced,omitempty"`
+	Denoise   *bool `json:"denoise,omitempty"`
+	DTMF      *bool `json:"dtmf,omitempty"`
+	// AGCTargetDBFS turns automatic gain control on, or off with zero.
+	AGCTargetDBFS *float64 `json:"agc_target_dbfs,omitempty"`
+}
+
+// Settings describe a session's audio and backend options. Clients may set
+// them with query parameters and then configure messages; they are fixed
+// once the session starts.
+type Settings struct {
+	Format audio.Format `json:"format"`
+	// Channel picks the 1-based channel forwarded from multi-channel
+	// audio; zero downmixes.
+	Channel int `json:"channel,omitempty"`
+	// Sensitivity is passed to the backend; zero keeps its default.
+	Sensitivity float64 `json:"sensitivity,omitempty"`
+	// Locale is the client's BCP 47 language tag, passed to the backend.
+	Locale string `json:"locale,omitempty"`
+	// Model names the backend model the client asks for. Sessions are
+	// routed by it, or else by Locale's language, to the backends serving
+	// it, and it is passed to the backend.
+	Model string `json:"model,omitempty"`
+	// MinSpeechMS and MinSilenceMS are how much speech starts a segment and
+	// how much silence ends it, and PrerollMS how much audio from before
+	// the start belongs to it, for the backend and the transcriber. Zero
+	// keeps their defaults.
+	MinSpeechMS  int `json:"min_speech_ms,omitempty"`
+	MinSilenceMS int `json:"min_silence_ms,omitempty"`
+	PrerollMS    int `json:"preroll_ms,omitempty"`
+	// Sequenced audio frames start with a sequence number and capture
+	// time, letting the bridge detect lost and reordered frames.
+	Sequenced bool `json:"sequenced,omitempty"`
+	// Denoise suppresses background noise before the backend hears it,
+	// and AGCTargetDBFS, when set, evens out its level.
+	Denoise       bool    `json:"denoise,omitempty"`
+	AGCTargetDBFS float64 `json:"agc_target_dbfs,omitempty"`
+	// DTMF reports telephone keypad tones in the audio as dtmf events.
+	DTMF bool `json:"dtmf,omitempty"`
+}
+
+// DefaultSettings assume the audio is already in the backend's format.
+func DefaultSettings() Settings {
+	return Settings{Format: audio.Backend}
+}
+
+// CheckEncoding fails unless st's audio is in one of encodings; none allows
+// all of them.
+func (st Settings) CheckEncoding(encodings []audio.Encoding) error {
+	if len(encodings) == 0 || slices.Contains(encodings, st.Format.Encoding) {
+		return nil
+	}
+	return fmt.Errorf("encoding %s not allowed (want one of %v)", st.Format.Encoding, encodings)
+}
+
+// SettingsParams are the query parameters settings are read from, named
+// after the configure message's fields.
+var SettingsParams = []string{
+	"encoding", "sample_rate", "bit_depth", "channels", "channel", "sensitivity", "locale", "model",
+	"min_speech_ms", "min_silence_ms", "preroll_ms", "sequenced", "denoise", "agc_target_dbfs", "dtmf",
+}
+
+// CheckParams fails if names holds one that isn't in SettingsParams.
+func CheckParams(names []string) error {
+	for _, name := range names {
+		if !slices.Contains(SettingsParams, name) {
+			return fmt.Errorf("unknown settings parameter %q (want one of %v)", name, SettingsParams)
+		}
+	}
+	return nil
+}
+
+// paramAliases are shorter names of settings parameters, for hand-written
+// URLs.
+var paramAliases = map[string]string{
+	"rate":     "sample_rate",
+	"lang":     "locale",
+	"language": "locale",
+}
+
+// sensitivityLevels may stand for a sensitivity in the query.
+var sensitivityLevels = map[string]float64{
+	"low":    0.25,
+	"medium": 0.5,
+	"high":   0.75,
+}
+
+// ParseSettings reads settings from the WebSocket URL's query parameters,
+// which use the names of the configure message's fields or their aliases.
+func ParseSettings(q url.Values) (Settings, error) {
+	return parseSettings(q, DefaultSettings(), nil)
+}
+
+// canonicalParams returns q with aliases replaced by the names they stand
+// for, failing if it sets a parameter allowed doesn't list; an empty allowed
+// lists them all.
+func canonicalParams(q url.Values, allowed []string) (url.Values, error) {
+	out := maps.Clone(q)
+	for alias, name := range paramAliases {
+		vs, ok := q[alias]
+		if !ok {
+			continue
+		}
+		if out.Has(name) {
+			return nil, fmt.Errorf("%s and %s both given", alias, name)
+		}
+		out[name] = vs
+		delete(out, alias)
+	}
+	if len(allowed) > 0 {
+		for _, name := range SettingsParams {
+			if out.Has(name) && !slices.Contains(allowed, name) {
+				return nil, fmt.Errorf("%s may not be set in the URL", name)
+			}
+		}
+	}
+	return out, nil
+}
+
+// parseSettings reads settings from query parameters over st, refusing
+// those allowed doesn't list.
+func parseSettings(q url.Values, st Settings, allowed []string) (Settings, error) {
+	q, err := canonicalParams(q, allowed)
+	if err != nil {
+		return st, err
+	}
+	var msg controlMessage
+	msg.Encoding = audio.Encoding(q.Get("encoding"))
+	var channel, minSpeech, minSilence, preroll int
+	for name, dst := range map[string]*int{
+		"sample_rate":    &msg.SampleRate,
+		"bit_depth":      &msg.BitDepth,
+		"channels":       &msg.Channels,
+		"channel":        &channel,
+		"min_speech_ms":  &minSpeech,
+		"min_silence_ms": &minSilence,
+		"preroll_ms":     &preroll,
+	} {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return st, fmt.Errorf("%s: %q is not an integer", name, v)
+			}
+			*dst = n
+		}
+	}
+	if q.Has("channel") {
+		msg.Channel = &channel
+	}
+	if q.Has("min_speech_ms") {
+		msg.MinSpeechMS = &minSpeech
+	}
+	if q.Has("min_silence_ms") {
+		msg.MinSilenceMS = &minSilence
+	}
+	if q.Has("preroll_ms") {
+		msg.PrerollMS = &preroll
+	}
+	for name, dst := range map[string]**float64{
+		"sensitivity":     &msg.Sensitivity,
+		"agc_target_dbfs": &msg.AGCTargetDBFS,
+	} {
+		if v := q.Get(name); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if name == "sensitivity" {
+				if level, ok := sensitivityLevels[v]; ok {
+					f, err = level, nil
+				} else if err != nil {
+					return st, fmt.Errorf("%s: %q is not a number, low, medium or high", name, v)
+				}
+			}
+			if err != nil {
+				return st, fmt.Errorf("%s: %q is not a number", name, v)
+			}
+			*dst = &f
+		}
+	}
+	for name, dst := range map[string]**bool{
+		"sequenced": &msg.Sequenced,
+		"denoise":   &msg.Denoise,
+		"dtmf":      &msg.DTMF,
+	} {
+		if v := q.Get(name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return st, fmt.Errorf("%s: %q is not a boolean", name, v)
+			}
+			*dst = &b
+		}
+	}
+	msg.Locale = q.Get("locale")
+	msg.Model = q.Get("model")
+	err = st.apply(msg)
+	return st, err
+}
+
+// validModel reports whether name may name a model: up to maxModelName
+// letters, digits and . _ - : / characters.
+func validModel(name string) bool {
+	if len(name) > maxModelName {
+		return false
+	}
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case strings.ContainsRune("._-:/", r):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Language returns the base language of st's Locale, such as "uz" for
+// "uz-Latn-UZ", or "" without one.
+func (st Settings) Language() string {
+	tag, err := language.Parse(st.Locale)
+	if st.Locale == "" || err != nil {
+		return ""
+	}
+	base, _ := tag.Base()
+	return base.String()
+}
+
+// AcceptLanguage returns the client's preferred language from an
+// Accept-Language header, for sessions that declare no locale.
+func AcceptLanguage(header string) string {
+	tags, _, err := language.ParseAcceptLanguage(header)
+	if err != nil || len(tags) == 0 {
+		return ""
+	}
+	return tags[0].String()
+}
+
+// apply merges a configure message into st, leaving st unchanged if the
+// result is invalid.
+func (st *Settings) apply(msg controlMessage) error {
+	next := *st
+	if msg.Encoding != "" {
+		next.Format = next.Format.WithEncoding(audio.ParseEncoding(string(msg.Encoding)))
+	}
+	if msg.SampleRate != 0 {
+		next.Format.SampleRate = msg.SampleRate
+	}
+	if msg.BitDepth != 0 {
+		next.Format.BitDepth = msg.BitDepth
+	}
+	if msg.Channels != 0 {
+		next.Format.Channels = msg.Channels
+	}
+	if msg.Channel != nil {
+		next.Channel = *msg.Channel
+	}
+	if msg.Denoise != nil {
+		next.Denoise = *msg.Denoise
+	}
+	if msg.AGCTargetDBFS != nil {
+		next.AGCTargetDBFS = *msg.AGCTargetDBFS
+	}
+	if msg.DTMF != nil {
+		next.DTMF = *msg.DTMF
+	}
+	if err := next.Format.Validate(); err != nil {
+		return err
+	}
+	if err := next.Options().Validate(next.Format); err != nil {
+		return err
+	}
+	if msg.Sensitivity != nil {
+		if *msg.Sensitivity < 0 || *msg.Sensitivity > 1 {
+			return fmt.Errorf("sensitivity %g out of range 0-1", *msg.Sensitivity)
+		}
+		next.Sensitivity = *msg.Sensitivity
+	}
+	for _, d := range []struct {
+		name string
+		v    *int
+		dst  *int
+	}{
+		{"min_speech_ms", msg.MinSpeechMS, &next.MinSpeechMS},
+		{"min_silence_ms", msg.MinSilenceMS, &next.MinSilenceMS},
+		{"preroll_ms", msg.PrerollMS, &next.PrerollMS},
+	} {
+		if d.v == nil {
+			continue
+		}
+		if *d.v < 0 || *d.v > maxEndpointingMS {
+			return fmt.Errorf("%s %d out of range 0-%d", d.name, *d.v, maxEndpointingMS)
+		}
+		*d.dst = *d.v
+	}
+	if msg.Sequenced != nil {
+		next.Sequenced = *msg.Sequenced
+	}
+	if msg.Locale == "" {
+		msg.Locale = msg.Language
+	}
+	if msg.Locale != "" {
+		tag, err := language.Parse(msg.Locale)
+		if err != nil {
+			return fmt.Errorf("locale %q is not a BCP 47 language tag", msg.Locale)
+		}
+		next.Locale = tag.String()
+	}
+	if msg.Model != "" {
+		if !validModel(msg.Model) {
+			return fmt.Errorf("model %q is not a valid model name", msg.Model)
+		}
+		next.Model = msg.Model
+	}
+	*st = next
+	return nil
+}
+
+// Options are the conversion options the settings ask for.
+func (st Settings) Options() audio.Options {
+	return audio.Options{Channel: st.Channel, Denoise: st.Denoise, AGCTargetDBFS: st.AGCTargetDBFS}
+}
+
+// Metadata returns the settings as gRPC metadata key/value pairs.
+func (st Settings) Metadata() []string {
+	// Whatever the client sends is converted to this.
+	f := audio.Backend
+	kv := []string{
+		MetadataEncoding, string(f.Encoding),
+		MetadataSampleRate, strconv.Itoa(f.SampleRate),
+		MetadataChannels, strconv.Itoa(f.Channels),
+		MetadataClientEncoding, string(st.Format.Encoding),
+		MetadataClientRate, strconv.Itoa(st.Format.SampleRate),
+		MetadataClientChannels, strconv.Itoa(st.Format.Channels),
+	}
+	if st.Sensitivity != 0 {
+		kv = append(kv, MetadataSensitivity, strconv.FormatFloat(st.Sensitivity, 'g', -1, 64))
+	}
+	if st.Locale != "" {
+		kv = append(kv, MetadataLocale, st.Locale)
+	}
+	if st.Model != "" {
+		kv = append(kv, MetadataModel, st.Model)
+	}
+	if st.Denoise {
+		kv = append(kv, MetadataDenoised, "true")
+	}
+	for _, d := range []struct {
+		key string
+		ms  int
+	}{
+		{MetadataMinSpeech, st.MinSpeechMS},
+		{MetadataMinSilence, st.MinSilenceMS},
+		{MetadataPreroll, st.PrerollMS},
+	} {
+		if d.ms != 0 {
+			kv = append(kv, d.key, strconv.Itoa(d.ms))
+		}
+	}
+	return kv
+}
+
+// StreamConfig returns the settings the backend acts on as the config
+// message opening a stream.
+func (st Settings) StreamConfig() *pb.StreamConfig {
+	return &pb.StreamConfig{
+		MinSpeechMs:  uint32(st.MinSpeechMS),
+		MinSilenceMs: uint32(st.MinSilenceMS),
+		PrerollMs:    uint32(st.PrerollMS),
+		Sensitivity:  float32(st.Sensitivity),
+		Locale:       st.Locale,
+	}
+}
+
+// flushedFrame acknowledges a flush request.
+type flushedFrame struct {
+	Event string `json:"event"`
+}
+
+// handleControl acts on one control frame. It reports whether the client
+// asked to stop; a non-nil error means the session can no longer queue audio.
+// Malformed or misplaced messages are answered with an error frame only.
+func (s *Session) handleControl(ctx context.Context, data []byte, queue *chunkQueue) (stop bool, err error) {
+	var msg controlMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		s.sendError(CodeInvalidControl, fmt.Errorf("control message is not valid JSON: %w", err))
+		return false, nil
+	}
+	s.log.Debug("Control message", "type", msg.Type)
+
+	switch msg.Type {
+	case ControlStart:
+		s.paused.Store(false)
+		s.start()
+	case ControlStop:
+		return true, nil
+	case ControlPause:
+		if !s.hasStarted() {
+			s.sendError(CodeInvalidControl, errors.New("pause before start"))
+			break
+		}
+		s.paused.Store(true)
+	case ControlConfigure:
+		if s.hasStarted() {
+			s.sendError(CodeInvalidControl, errors.New("configure must be sent before start"))
+			break
+		}
+		next := s.Settings
+		err := next.apply(msg)
+		if err == nil {
+			err = next.CheckEncoding(s.Encodings)
+		}
+		if err != nil {
+			s.sendError(CodeInvalidControl, err)
+			break
+		}
+		s.Settings = next
+	case ControlFlush:
+		// The marker reaches the sender after all audio queued before it.
+		flushed := func() {
+			s.writeJSON(flushedFrame{Event: "flushed"})
+		}
+		if err := s.flushPipeline(ctx, queue); err != nil {
+			return false, err
+		}
+		return false, queue.push(ctx, chunk{flushed: flushed})
+	case ControlSpeak:
+		if msg.Text == "" {
+			s.sendError(CodeInvalidControl, errors.New("speak needs text"))
+			break
+		}
+		if _, err := s.Speak(msg.Text, msg.Voice); err != nil {
+			s.sendError(CodeInvalidControl, err)
+		}
+	case ControlInterrupt:
+		s.Interrupt()
+	default:
+		s.sendError(CodeInvalidControl, fmt.Errorf("unknown control message type %q", msg.Type))
+	}
+	return false, nil
+}
+
+// start lets Run open the backend stream. It is called from the read loop.
+func (s *Session) start() {
+	s.startOnce.Do(func() { close(s.started) })
+}
+
+func (s *Session) hasStarted() bool {
+	select {
+	case <-s.started:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,142 @@
+// session/dial.go
+package session
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	pb "vad-application/grpc_modules"
+	"vad-application/metrics"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Backoff between attempts to open a backend stream.
+const (
+	dialBaseDelay = 250 * time.Millisecond
+	dialMaxDelay  = 4 * time.Second
+)
+
+// Status frame states sent while the backend stream is being opened.
+const (
+	statusConnecting = "connecting"
+	statusConnected  = "connected"
+)
+
+// dial opens a ProcessAudio stream, retrying recoverable failures with
+// jittered exponential backoff until timeout has passed; zero makes a
+// single attempt. Retries go to the backend Failover offers, when
+// set, and the client hears about them in status frames. cancel ends the
+// stream.
+func (s *Session) dial(ctx context.Context, client pb.VADServiceClient, timeout time.Duration) (pb.VADService_ProcessAudioClient, context.CancelFunc, error) {
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	delay := dialBaseDelay
+	for attempt := 1; ; attempt++ {
+		stream, cancel, err := s.openStream(ctx, client, deadline)
+		if err == nil {
+			if attempt > 1 {
+				s.log.Info("Backend stream opened", "attempts", attempt)
+				s.sendStatus(statusFrame{Event: "status", Status: statusConnected})
+			}
+			return stream, cancel, nil
+		}
+		metrics.StreamErrors.WithLabelValues(status.Code(err).String()).Inc()
+		// Full jitter over the upper half keeps sessions that failed
+		// together from retrying in lockstep.
+		wait := delay/2 + rand.N(delay/2)
+		if deadline.IsZero() || ctx.Err() != nil || !recoverable(err) || time.Until(deadline) < wait {
+			return nil, nil, err
+		}
+		s.log.Info("Backend stream not opened; retrying", "attempt", attempt, "retry_in", wait.Round(time.Millisecond).String(), "err", err)
+		s.sendStatus(statusFrame{
+			Event:     "status",
+			Status:    statusConnecting,
+			Message:   "connecting to speech backend…",
+			Attempt:   attempt,
+			RetryInMS: wait.Milliseconds(),
+		})
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, nil, err
+		}
+		delay = min(2*delay, dialMaxDelay)
+		if s.Failover != nil {
+			fctx, fcancel := context.WithDeadline(ctx, deadline)
+			if next, err := s.Failover(fctx); err == nil {
+				client = next
+			}
+			fcancel()
+		}
+	}
+}
+
+// WarmClient is implemented by clients that keep streams open ahead of
+// sessions, like those of backend.Backend. Warm streams predate the session,
+// so they carry none of its metadata but that of DefaultSettings; sessions
+// with other settings, such as a locale, open their own.
+type WarmClient interface {
+	// ClaimStream hands out a warm stream, if there is one, that ends with
+	// ctx.
+	ClaimStream(ctx context.Context) (pb.VADService_ProcessAudioClient, bool)
+}
+
+// openStream makes one attempt, given up at deadline unless that is zero.
+func (s *Session) openStream(ctx context.Context, client pb.VADServiceClient, deadline time.Time) (pb.VADService_ProcessAudioClient, context.CancelFunc, error) {
+	var cancel context.CancelFunc
+	if s.cfg.StreamDeadline > 0 {
+		ctx, cancel = context.WithTimeout(ctx, s.cfg.StreamDeadline)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	if w, ok := client.(WarmClient); ok && slices.Equal(s.Settings.Metadata(), DefaultSettings().Metadata()) {
+		if stream, ok := w.ClaimStream(ctx); ok {
+			s.log.Debug("Claimed warm backend stream")
+			return deadlineStream{stream, ctx}, cancel, nil
+		}
+	}
+	if deadline.IsZero() {
+		stream, err := client.ProcessAudio(ctx)
+		if err != nil {
+			cancel()
+			return nil, nil, err
+		}
+		return deadlineStream{stream, ctx}, cancel, nil
+	}
+	// The deadline bounds opening the stream, not the stream itself.
+	timer := time.AfterFunc(time.Until(deadline), cancel)
+	stream, err := client.ProcessAudio(ctx)
+	if !timer.Stop() {
+		err = status.Error(codes.DeadlineExceeded, "no backend stream before the dial deadline")
+	}
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	return deadlineStream{stream, ctx}, cancel, nil
+}
+
+// errStreamDeadline ends a stream that reached Config.StreamDeadline.
+var errStreamDeadline = status.Error(codes.DeadlineExceeded, "backend stream deadline reached")
+
+// deadlineStream tells a stream that reached its deadline apart from one the
+// backend broke.
+type deadlineStream struct {
+	pb.VADService_ProcessAudioClient
+	ctx context.Context
+}
+
+func (d deadlineStream) Recv() (*pb.VADResponse, error) {
+	resp, err := d.VADService_ProcessAudioClient.Recv()
+	if err != nil && errors.Is(d.ctx.Err(), context.DeadlineExceeded) {
+		return nil, errStreamDeadline
+	}
+	return resp, err
+}
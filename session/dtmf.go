@@ -0,0 +1,28 @@
+// session/dtmf.go
+package session
+
+import (
+	"vad-application/audio"
+	"vad-application/events"
+	"vad-application/metrics"
+)
+
+// dtmfFrame reports a keypad digit the caller pressed, Time seconds into
+// the session's audio.
+type dtmfFrame struct {
+	Event string  `json:"event"`
+	Digit string  `json:"digit"`
+	Time  float64 `json:"time"`
+}
+
+// dtmf tells the client and the event sinks about a digit the pipeline
+// heard.
+func (s *Session) dtmf(d audio.DTMFDigit) {
+	t := round(d.At.Seconds(), 3)
+	s.log.Debug("DTMF digit", "digit", d.Digit, "time", t)
+	metrics.DTMFDigits.Inc()
+	if err := s.writeJSON(dtmfFrame{Event: "dtmf", Digit: d.Digit, Time: t}); err != nil {
+		s.log.Debug("DTMF digit not sent", "err", err)
+	}
+	s.publish(events.Event{Kind: events.DTMF, Digit: d.Digit})
+}
@@ -0,0 +1,66 @@
+// session/errors.go
+package session
+
+// Error codes sent to clients in error frames:
+//
+//	{"event": "error", "code": "backend_unavailable", "message": "...",
+//	 "retryable": true, "session_id": "...", "retry_after": 5}
+//
+// retryable tells whether reconnecting with the same settings may succeed,
+// after retry_after seconds when given; session_id is omitted when the
+// connection was turned away before becoming a session.
+const (
+	// The backend could not be reached, or its stream broke or timed out.
+	CodeBackendUnavailable    = "backend_unavailable"
+	CodeBackendStreamError    = "backend_stream_error"
+	CodeBackendStreamDeadline = "backend_stream_deadline"
+	CodeBackendOverloaded     = "backend_overloaded"
+	// The wake-word backend could not be reached or its stream broke.
+	CodeWakeWordUnavailable = "wake_word_unavailable"
+
+	// The client's audio or messages were rejected.
+	CodeUnsupportedFormat = "unsupported_format"
+	CodeUndecodableAudio  = "undecodable_audio"
+	CodeInvalidFrame      = "invalid_frame"
+	CodeInvalidControl    = "invalid_control"
+	CodeInvalidSettings   = "invalid_settings"
+	CodeIdleTimeout       = "idle_timeout"
+
+	// An operator closed the session.
+	CodeTerminated = "terminated"
+	// The bridge failed serving the session.
+	CodeInternalError = "internal_error"
+
+	// The connection was refused before it became a session.
+	CodeUnauthorized     = "unauthorized"
+	CodeQuotaExceeded    = "quota_exceeded"
+	CodeCapacityExceeded = "capacity_exceeded"
+	CodeShuttingDown     = "shutting_down"
+	CodeRejected         = "rejected"
+
+	// Listen-only clients could not follow the session they asked for.
+	CodeListenUnavailable = "listen_unavailable"
+	CodeTooManyListeners  = "too_many_listeners"
+	CodeSessionNotFound   = "session_not_found"
+)
+
+// retryableCodes are the error codes worth reconnecting after.
+var retryableCodes = map[string]bool{
+	CodeBackendUnavailable:    true,
+	CodeBackendStreamError:    true,
+	CodeBackendStreamDeadline: true,
+	CodeBackendOverloaded:     true,
+	CodeInternalError:         true,
+	CodeWakeWordUnavailable:   true,
+	CodeIdleTimeout:           true,
+	CodeQuotaExceeded:         true,
+	CodeCapacityExceeded:      true,
+	CodeShuttingDown:          true,
+	CodeTooManyListeners:      true,
+}
+
+// Retryable reports whether a client that got code may reconnect and
+// succeed.
+func Retryable(code string) bool {
+	return retryableCodes[code]
+}
@@ -0,0 +1,144 @@
+// session/events.go
+package session
+
+import (
+	"time"
+
+	"vad-application/audio"
+	"vad-application/events"
+	"vad-application/metrics"
+)
+
+// Backend events that open and close a speech segment.
+const (
+	eventSpeechStart = "start"
+	eventSpeechEnd   = "end"
+)
+
+// recentEvents is how many of its latest events a session keeps for Recent.
+const recentEvents = 50
+
+// publish hands e to the configured sink, filling in the session's details.
+func (s *Session) publish(e events.Event) {
+	e.SessionID = s.ID
+	e.Subject = s.Subject
+	e.Tenant = s.Tenant
+	e.Route = s.Route
+	if e.Kind != events.Shadow {
+		e.Source = s.source()
+	}
+	e.Time = time.Now()
+	e.Offset = s.audioOffset()
+	s.remember(e)
+	if s.cfg.Events != nil {
+		s.cfg.Events.Publish(e)
+	}
+}
+
+// remember keeps e among the recent events, without the audio of clips.
+func (s *Session) remember(e events.Event) {
+	e.Audio = nil
+	s.recentMu.Lock()
+	defer s.recentMu.Unlock()
+	if len(s.recent) < recentEvents {
+		s.recent = append(s.recent, e)
+		return
+	}
+	s.recent[s.recentNext] = e
+	s.recentNext = (s.recentNext + 1) % recentEvents
+}
+
+// Recent returns the session's latest events, oldest first.
+func (s *Session) Recent() []events.Event {
+	s.recentMu.Lock()
+	defer s.recentMu.Unlock()
+	out := make([]events.Event, 0, len(s.recent))
+	out = append(out, s.recent[s.recentNext:]...)
+	return append(out, s.recent[:s.recentNext]...)
+}
+
+// publishEnd reports the finished session. It runs once both pumps are done.
+func (s *Session) publishEnd() {
+	st := s.Stats()
+	offset := s.audioOffset()
+	s.publish(events.Event{Kind: events.SessionEnd, Summary: &events.Summary{
+		Started:       s.Started,
+		Duration:      time.Since(s.Started).Seconds(),
+		Audio:         offset,
+		Speech:        s.speech.seconds(offset),
+		BytesIn:       st.BytesIn,
+		BytesOut:      st.BytesOut,
+		DroppedChunks: st.DroppedChunks,
+		LostChunks:    st.LostChunks,
+		Events:        st.Events,
+	}})
+}
+
+// audioOffset is how much audio, in seconds, has been sent to the backend.
+func (s *Session) audioOffset() float64 {
+	return seconds(s.stats.audioSent.Load())
+}
+
+// seconds converts bytes of backend audio to seconds.
+func seconds(n int64) float64 {
+	f := audio.Backend
+	return float64(n/int64(f.FrameSize())) / float64(f.SampleRate)
+}
+
+// publishDiff compares the speech the primary and shadow backends found, once
+// both streams are done.
+func (s *Session) publishDiff() {
+	audio := s.audioOffset()
+	d := compare(s.speech.collected(audio), s.shadowSpeech.collected(seconds(s.stats.shadowSent.Load())), audio)
+	s.log.Info("Backends compared", "agreement", d.Agreement, "matched", d.Matched,
+		"primary_segments", len(d.PrimarySegments), "shadow_segments", len(d.ShadowSegments),
+		"mean_start_delta", d.MeanStartDelta, "mean_end_delta", d.MeanEndDelta)
+	metrics.ComparisonAgreement.Observe(d.Agreement)
+	s.rec.Diff(d)
+	s.publish(events.Event{Kind: events.Comparison, Diff: d})
+}
+
+// speechTracker adds up the audio between speech start and end events. Only
+// the event loop touches it.
+type speechTracker struct {
+	open  bool
+	since float64
+	total float64
+	// keep makes it collect the segments it closes.
+	keep     bool
+	segments []events.SpeechSegment
+}
+
+// observe returns the segment an end event closes, if any.
+func (t *speechTracker) observe(event string, offset float64) *events.SpeechSegment {
+	switch {
+	case event == eventSpeechStart && !t.open:
+		t.open, t.since = true, offset
+	case event == eventSpeechEnd && t.open:
+		t.open = false
+		t.total += offset - t.since
+		seg := events.SpeechSegment{Start: t.since, End: offset}
+		if t.keep {
+			t.segments = append(t.segments, seg)
+		}
+		return &seg
+	}
+	return nil
+}
+
+// collected returns the kept segments, closing an open one at end.
+func (t *speechTracker) collected(end float64) []events.SpeechSegment {
+	segs := t.segments
+	if t.open && end > t.since {
+		segs = append(segs, events.SpeechSegment{Start: t.since, End: end})
+	}
+	return segs
+}
+
+// seconds is the speech so far, counting an open segment up to end.
+func (t *speechTracker) seconds(end float64) float64 {
+	if t.open {
+		return t.total + end - t.since
+	}
+	return t.total
+}
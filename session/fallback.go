@@ -0,0 +1,37 @@
+// session/fallback.go
+package session
+
+import (
+	"errors"
+
+	pb "vad-application/grpc_modules"
+	"vad-application/metrics"
+)
+
+// SourceFallback marks the events and responses of sessions that fell back
+// to the built-in VAD.
+const SourceFallback = "fallback"
+
+// errNoBackend is why a session given no client falls back.
+var errNoBackend = errors.New("no backend available")
+
+// useFallback returns the Fallback client to replace current once no
+// backend could serve the session, because of err. It returns nil when there
+// is no fallback or current is already it.
+func (s *Session) useFallback(current pb.VADServiceClient, err error) pb.VADServiceClient {
+	if s.Fallback == nil || current == s.Fallback {
+		return nil
+	}
+	s.log.Warn("No backend reachable; using the fallback VAD", "err", err)
+	metrics.FallbackSessions.Inc()
+	return s.Fallback
+}
+
+// source is what the session's events are tagged with: empty for a
+// backend, SourceFallback for the built-in VAD.
+func (s *Session) source() string {
+	if s.fallback.Load() {
+		return SourceFallback
+	}
+	return ""
+}
@@ -0,0 +1,216 @@
+// session/frames.go
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"vad-application/audio"
+	pb "vad-application/grpc_modules"
+	"vad-application/reporting"
+
+	"github.com/gorilla/websocket"
+	"google.golang.org/protobuf/proto"
+)
+
+// errorFrame is sent to the browser when its session cannot be served; see
+// the error codes.
+type errorFrame struct {
+	Event     string `json:"event"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Retryable bool   `json:"retryable"`
+	SessionID string `json:"session_id,omitempty"`
+	// RetryAfter, in seconds, hints when reconnecting may succeed.
+	RetryAfter int `json:"retry_after,omitempty"`
+}
+
+func newErrorFrame(code string, err error) errorFrame {
+	return errorFrame{Event: "error", Code: code, Message: err.Error(), Retryable: Retryable(code)}
+}
+
+// overrunFrame tells the client that stale audio was skipped to keep VAD
+// results close to real time.
+type overrunFrame struct {
+	Event string `json:"event"`
+	// LagMS is how far behind the first skipped chunk was.
+	LagMS int64 `json:"lag_ms"`
+}
+
+// levelFrame reports the loudness of the latest audio, as fractions of full
+// scale and in dBFS.
+type levelFrame struct {
+	Event    string  `json:"event"`
+	RMS      float64 `json:"rms"`
+	Peak     float64 `json:"peak"`
+	RMSDBFS  float64 `json:"rms_dbfs"`
+	PeakDBFS float64 `json:"peak_dbfs"`
+}
+
+// statusFrame tells the client how opening the backend stream is going.
+type statusFrame struct {
+	Event   string `json:"event"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+	Attempt int    `json:"attempt,omitempty"`
+	// RetryInMS is how long until the next attempt.
+	RetryInMS int64 `json:"retry_in_ms,omitempty"`
+	// BufferedMS is how much audio held during an outage the backend gets
+	// late.
+	BufferedMS int64 `json:"buffered_ms,omitempty"`
+}
+
+// Reject turns away a connection that never became a session: the client
+// receives an error frame, then a close frame with closeCode.
+func Reject(ws Conn, closeCode int, code string, err error, retryAfter time.Duration) {
+	frame := newErrorFrame(code, err)
+	reason := err.Error()
+	if retryAfter > 0 {
+		frame.RetryAfter = int(retryAfter.Round(time.Second).Seconds())
+		reason = fmt.Sprintf("%s; retry after %ds", reason, frame.RetryAfter)
+	}
+	if data, err := json.Marshal(frame); err == nil {
+		ws.WriteMessage(websocket.TextMessage, data)
+	}
+	ws.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(closeCode, reason),
+		time.Now().Add(closeGrace))
+}
+
+// Fail logs err and reports it to the client as an error frame.
+func (s *Session) Fail(code string, err error) {
+	s.log.Error("Session failed", "code", code, "err", err)
+	if code == CodeBackendUnavailable {
+		s.cfg.Errors.Capture(reporting.Event{Message: "No backend could serve the session", Err: err, Tags: s.reportTags("code", code), Subject: s.Subject})
+	}
+	s.sendError(code, err)
+}
+
+// sendError reports err to the client as an error frame.
+func (s *Session) sendError(code string, err error) {
+	frame := newErrorFrame(code, err)
+	frame.SessionID = s.ID
+	if werr := s.writeJSON(frame); werr != nil {
+		s.log.Warn("WS write error", "err", werr)
+	}
+}
+
+// sendOverrun reports the start of a burst of skipped audio.
+func (s *Session) sendOverrun(lag time.Duration) {
+	s.log.Debug("Skipping stale audio", "lag", lag.Round(time.Millisecond).String())
+	if err := s.writeJSON(overrunFrame{Event: "buffer_overrun", LagMS: lag.Milliseconds()}); err != nil {
+		s.log.Warn("WS write error", "err", err)
+	}
+}
+
+// sendLevel reports the level of the audio since the previous report.
+func (s *Session) sendLevel(rms, peak float64) {
+	frame := levelFrame{
+		Event:    "audio_level",
+		RMS:      round(rms, 4),
+		Peak:     round(peak, 4),
+		RMSDBFS:  round(audio.DBFS(rms), 1),
+		PeakDBFS: round(audio.DBFS(peak), 1),
+	}
+	if err := s.writeJSON(frame); err != nil {
+		s.log.Debug("Audio level not sent", "err", err)
+	}
+}
+
+// round rounds v to the given number of decimals.
+func round(v float64, decimals int) float64 {
+	p := math.Pow10(decimals)
+	return math.Round(v*p) / p
+}
+
+// sendStatus reports progress opening the backend stream.
+func (s *Session) sendStatus(frame statusFrame) {
+	if err := s.writeJSON(frame); err != nil {
+		s.log.Warn("WS write error", "err", err)
+	}
+}
+
+// responseFrame is a JSON VAD response with the chunk latency measured for
+// it, or the source of a response not from a backend.
+type responseFrame struct {
+	Event     string   `json:"event,omitempty"`
+	Message   string   `json:"message,omitempty"`
+	LatencyMS *float64 `json:"latency_ms,omitempty"`
+	Source    string   `json:"source,omitempty"`
+	// Late marks a response for audio held during a backend outage.
+	Late bool `json:"late,omitempty"`
+	// Time, MediaTime and Seq place the response against the client's
+	// audio: when the bridge received it, how many seconds of audio the
+	// client had sent by then, and how many audio frames, or the latest
+	// frame's sequence number, with its CaptureTime, for sequenced audio.
+	Time        *time.Time `json:"time,omitempty"`
+	MediaTime   *float64   `json:"media_time,omitempty"`
+	Seq         *int64     `json:"seq,omitempty"`
+	CaptureTime *time.Time `json:"capture_time,omitempty"`
+}
+
+// writeResponse relays a VAD response, received at received, in the format
+// the client negotiated. In JSON, it carries the chunk latency when
+// withLatency is set, the source when the session fell back to the
+// built-in VAD, whether it is late, and timestamps with Config.EnrichEvents.
+func (s *Session) writeResponse(resp *pb.VADResponse, received time.Time, latency time.Duration, withLatency, late bool) error {
+	if s.ws.Subprotocol() != SubprotocolBinary {
+		source := s.source()
+		if withLatency || source != "" || late || s.cfg.EnrichEvents {
+			frame := responseFrame{Event: resp.GetEvent(), Message: resp.GetMessage(), Source: source, Late: late}
+			if withLatency {
+				ms := float64(latency.Microseconds()) / 1000
+				frame.LatencyMS = &ms
+			}
+			if s.cfg.EnrichEvents {
+				media := seconds(s.stats.audioReceived.Load())
+				seq := s.stats.audioFrames.Load()
+				if s.Settings.Sequenced {
+					seq = s.stats.lastSeq.Load()
+					if ns := s.stats.lastCapture.Load(); ns != 0 {
+						captured := time.Unix(0, ns)
+						frame.CaptureTime = &captured
+					}
+				}
+				frame.Time, frame.MediaTime, frame.Seq = &received, &media, &seq
+			}
+			return s.writeJSON(frame)
+		}
+		return s.writeJSON(resp)
+	}
+	data, err := proto.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	return s.writeFrame(websocket.BinaryMessage, data)
+}
+
+// writeJSON sends v as a text frame. It may be called from any goroutine.
+func (s *Session) writeJSON(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.writeFrame(websocket.TextMessage, data)
+}
+
+// writeFrame sends one data frame and accounts for its size.
+func (s *Session) writeFrame(messageType int, data []byte) error {
+	s.writeMu.Lock()
+	err := s.ws.WriteMessage(messageType, data)
+	s.writeMu.Unlock()
+	if err != nil {
+		return err
+	}
+	s.stats.bytesOut.Add(int64(len(data)))
+	return nil
+}
+
+// sendClose starts the WebSocket close handshake.
+func (s *Session) sendClose(code int, reason string) {
+	s.ws.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(code, reason),
+		time.Now().Add(closeGrace))
+}
@@ -0,0 +1,90 @@
+// session/heartbeat.go
+package session
+
+import (
+	"context"
+	"time"
+)
+
+// maxPingTimeout bounds the backend round trip measured for a heartbeat.
+const maxPingTimeout = 2 * time.Second
+
+// Pinger is implemented by clients that can measure a round trip to their
+// backend, like those of backend.Backend.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// heartbeatFrame tells the client how its session is doing, every
+// Config.HeartbeatInterval.
+type heartbeatFrame struct {
+	Event    string `json:"event"`
+	UptimeMS int64  `json:"uptime_ms"`
+	BytesIn  int64  `json:"bytes_in"`
+	BytesOut int64  `json:"bytes_out"`
+	// QueueDepth is how many chunks wait for the backend, and SendLagMS
+	// how long the latest one sent had waited.
+	QueueDepth int   `json:"queue_depth"`
+	SendLagMS  int64 `json:"send_lag_ms"`
+	// BackendRTTMS is a health check round trip to the session's backend,
+	// when it could be measured.
+	BackendRTTMS *int64 `json:"backend_rtt_ms,omitempty"`
+	// ChunkRTTMS is the latest chunk latency, when the backend
+	// acknowledges chunks.
+	ChunkRTTMS *int64 `json:"chunk_rtt_ms,omitempty"`
+	Dropped    int64  `json:"dropped_chunks,omitempty"`
+	Lost       int64  `json:"lost_chunks,omitempty"`
+	Late       int64  `json:"late_chunks,omitempty"`
+}
+
+// heartbeat sends a heartbeat frame each interval until ctx is done.
+func (s *Session) heartbeat(ctx context.Context, queue *chunkQueue) {
+	t := time.NewTicker(s.cfg.HeartbeatInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		frame := heartbeatFrame{
+			Event:      "heartbeat",
+			UptimeMS:   time.Since(s.Started).Milliseconds(),
+			BytesIn:    s.stats.bytesIn.Load(),
+			BytesOut:   s.stats.bytesOut.Load(),
+			QueueDepth: len(queue.ch),
+			SendLagMS:  s.sendLag.Load() / int64(time.Millisecond),
+			Dropped:    s.stats.dropped.Load(),
+			Lost:       s.stats.lost.Load(),
+			Late:       s.stats.late.Load(),
+		}
+		if rtt, ok := s.pingBackend(ctx); ok {
+			ms := rtt.Milliseconds()
+			frame.BackendRTTMS = &ms
+		}
+		if rtt := s.chunkRTT.Load(); rtt > 0 {
+			ms := rtt / int64(time.Millisecond)
+			frame.ChunkRTTMS = &ms
+		}
+		if err := s.writeJSON(frame); err != nil {
+			s.log.Debug("Heartbeat not sent", "err", err)
+		}
+	}
+}
+
+// pingBackend measures a round trip to the current backend.
+func (s *Session) pingBackend(ctx context.Context) (time.Duration, bool) {
+	s.mu.Lock()
+	p, ok := s.client.(Pinger)
+	s.mu.Unlock()
+	if !ok {
+		return 0, false
+	}
+	ctx, cancel := context.WithTimeout(ctx, min(s.cfg.HeartbeatInterval, maxPingTimeout))
+	defer cancel()
+	start := time.Now()
+	if err := p.Ping(ctx); err != nil {
+		return 0, false
+	}
+	return time.Since(start), true
+}
@@ -0,0 +1,175 @@
+// session/inbox.go
+package session
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrInboxClosed is returned by Inbox.Deliver once the inbox has failed.
+var ErrInboxClosed = errors.New("session: inbox closed")
+
+type inboxMessage struct {
+	typ  int
+	data []byte
+}
+
+// Inbox is the reading side of a Conn whose messages arrive on their own
+// goroutine rather than from a *websocket.Conn: it queues what the
+// transport delivers and serves NextReader with the read deadline, read
+// limit and pong handler a *websocket.Conn keeps. Transports embed it,
+// delivering messages with Deliver until they Fail it.
+type Inbox struct {
+	msgs chan inboxMessage
+
+	mu       sync.Mutex
+	deadline time.Time
+	// wake tells a waiting NextReader the deadline moved.
+	wake  chan struct{}
+	limit int64
+	pong  func(string) error
+
+	// failed is closed, with err set, once no more messages will come.
+	failed   chan struct{}
+	failOnce sync.Once
+	err      error
+}
+
+// NewInbox returns an inbox queueing up to size messages.
+func NewInbox(size int) *Inbox {
+	return &Inbox{
+		msgs:   make(chan inboxMessage, size),
+		wake:   make(chan struct{}, 1),
+		failed: make(chan struct{}),
+	}
+}
+
+// NextReader returns the next message delivered.
+func (in *Inbox) NextReader() (int, io.Reader, error) {
+	for {
+		in.mu.Lock()
+		deadline := in.deadline
+		in.mu.Unlock()
+		m, err := in.await(deadline)
+		if err == errWoken {
+			continue
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		return m.typ, bytes.NewReader(m.data), nil
+	}
+}
+
+// errWoken stops await when the read deadline moves.
+var errWoken = errors.New("session: read deadline changed")
+
+// await waits for the next message until deadline.
+func (in *Inbox) await(deadline time.Time) (inboxMessage, error) {
+	var expired <-chan time.Time
+	if !deadline.IsZero() {
+		d := time.Until(deadline)
+		if d <= 0 {
+			return inboxMessage{}, os.ErrDeadlineExceeded
+		}
+		t := time.NewTimer(d)
+		defer t.Stop()
+		expired = t.C
+	}
+	select {
+	case m := <-in.msgs:
+		return m, nil
+	case <-in.failed:
+		// Messages delivered before the failure come first.
+		select {
+		case m := <-in.msgs:
+			return m, nil
+		default:
+			return inboxMessage{}, in.err
+		}
+	case <-expired:
+		return inboxMessage{}, os.ErrDeadlineExceeded
+	case <-in.wake:
+		return inboxMessage{}, errWoken
+	}
+}
+
+func (in *Inbox) ReadMessage() (int, []byte, error) {
+	mt, r, err := in.NextReader()
+	if err != nil {
+		return mt, nil, err
+	}
+	p, err := io.ReadAll(r)
+	return mt, p, err
+}
+
+func (in *Inbox) SetReadDeadline(t time.Time) error {
+	in.mu.Lock()
+	in.deadline = t
+	in.mu.Unlock()
+	select {
+	case in.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (in *Inbox) SetReadLimit(limit int64) {
+	in.mu.Lock()
+	in.limit = limit
+	in.mu.Unlock()
+}
+
+func (in *Inbox) SetPongHandler(h func(appData string) error) {
+	in.mu.Lock()
+	in.pong = h
+	in.mu.Unlock()
+}
+
+// Pong runs the pong handler, if one is set, as a pong with appData
+// arriving would.
+func (in *Inbox) Pong(appData string) error {
+	in.mu.Lock()
+	h := in.pong
+	in.mu.Unlock()
+	if h != nil {
+		return h(appData)
+	}
+	return nil
+}
+
+// Exceeds reports whether a message of n bytes is over the read limit.
+// Transports check before reading the message, then Fail with
+// websocket.ErrReadLimit.
+func (in *Inbox) Exceeds(n int64) bool {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return in.limit > 0 && n > in.limit
+}
+
+// Deliver queues a message for NextReader, waiting for room until the
+// inbox fails or ctx is done.
+func (in *Inbox) Deliver(ctx context.Context, messageType int, data []byte) error {
+	select {
+	case in.msgs <- inboxMessage{typ: messageType, data: data}:
+		return nil
+	case <-in.failed:
+		return ErrInboxClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Fail ends the messages: once those already queued are read, NextReader
+// returns err. Only the first call counts.
+func (in *Inbox) Fail(err error) {
+	in.failOnce.Do(func() {
+		in.err = err
+		close(in.failed)
+	})
+}
@@ -0,0 +1,59 @@
+// session/keepalive.go
+package session
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// keepalive pings the client and closes the session once it has sent no
+// audio for IdleTimeout. It returns when ctx is done.
+func (s *Session) keepalive(ctx context.Context) {
+	var ping, idle <-chan time.Time
+	if s.cfg.PingInterval > 0 {
+		t := time.NewTicker(s.cfg.PingInterval)
+		defer t.Stop()
+		ping = t.C
+	}
+	if s.cfg.IdleTimeout > 0 {
+		t := time.NewTicker(max(s.cfg.IdleTimeout/10, time.Second))
+		defer t.Stop()
+		idle = t.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ping:
+			// A failed ping surfaces as a read error once the pong deadline
+			// passes, so the error itself can be ignored.
+			s.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(s.cfg.PongTimeout))
+		case <-idle:
+			silent := time.Since(time.Unix(0, s.lastAudio.Load()))
+			if silent < s.cfg.IdleTimeout {
+				continue
+			}
+			s.log.Info("Closing idle session", "silent_for", silent.Round(time.Second).String())
+			s.sendError(CodeIdleTimeout, fmt.Errorf("no audio received for %s", s.cfg.IdleTimeout))
+			s.end(websocket.CloseNormalClosure, "idle timeout")
+			return
+		}
+	}
+}
+
+// extendReadDeadline gives the client another ping period to show signs of
+// life. It is a no-op once the session has stopped reading.
+func (s *Session) extendReadDeadline() {
+	if s.cfg.PingInterval <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.stopReading {
+		s.ws.SetReadDeadline(time.Now().Add(s.cfg.PingInterval + s.cfg.PongTimeout))
+	}
+}
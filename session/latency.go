@@ -0,0 +1,87 @@
+// session/latency.go
+package session
+
+import (
+	"sync"
+	"time"
+
+	"vad-application/metrics"
+)
+
+// eventContinue is the response a backend acknowledging every chunk sends
+// for chunks that change nothing.
+const eventContinue = "continue"
+
+// maxPendingAcks bounds the stamps kept for chunks the backend has not yet
+// answered.
+const maxPendingAcks = 4096
+
+// stamp is when a chunk reached the bridge and when it went to the backend.
+type stamp struct {
+	received time.Time
+	sent     time.Time
+}
+
+// ackTracker pairs the chunks sent on one stream with the backend's
+// responses, for backends that answer every chunk in order with exactly one
+// response. The send loop adds stamps and the event loop takes them.
+type ackTracker struct {
+	mu      sync.Mutex
+	pending []stamp
+	// overflowed is set once stamps had to be dropped, which means the
+	// backend does not answer every chunk; warned once that was logged.
+	overflowed bool
+	warned     bool
+}
+
+func (t *ackTracker) sent(received time.Time) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.pending) == maxPendingAcks {
+		t.pending = t.pending[1:]
+		t.overflowed = true
+	}
+	t.pending = append(t.pending, stamp{received: received, sent: time.Now()})
+}
+
+// answered takes the stamp of the oldest unanswered chunk. It reports
+// false when there is none.
+func (t *ackTracker) answered() (stamp, bool) {
+	if t == nil {
+		return stamp{}, false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.pending) == 0 {
+		return stamp{}, false
+	}
+	st := t.pending[0]
+	t.pending = t.pending[1:]
+	return st, true
+}
+
+// observeAck measures the chunk latency a response acknowledges: from the
+// chunk reaching the backend, and from it reaching the bridge, until the
+// response came back.
+func (s *Session) observeAck(acks *ackTracker) (time.Duration, bool) {
+	st, ok := acks.answered()
+	if !ok {
+		return 0, false
+	}
+	now := time.Now()
+	backend := now.Sub(st.sent)
+	metrics.ChunkLatency.WithLabelValues("backend").Observe(backend.Seconds())
+	metrics.ChunkLatency.WithLabelValues("total").Observe(now.Sub(st.received).Seconds())
+	s.chunkRTT.Store(int64(backend))
+	acks.mu.Lock()
+	warn := acks.overflowed && !acks.warned
+	acks.warned = acks.warned || warn
+	acks.mu.Unlock()
+	if warn {
+		s.log.Warn("Backend does not answer every chunk; chunk latencies are unreliable")
+	}
+	return backend, true
+}
@@ -0,0 +1,124 @@
+// session/listen.go
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"vad-application/events"
+	pb "vad-application/grpc_modules"
+
+	"github.com/gorilla/websocket"
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrNotFound is returned by Listen for a session that isn't open.
+var ErrNotFound = errors.New("session not found")
+
+// Listen attaches a listen-only client to session id. The client receives
+// the session's VAD responses, framed as for the client sending the audio,
+// and a normal close once the session ends; it may not send data frames.
+// Listen returns when either side is done.
+func (m *Manager) Listen(ws Conn, id string, logger *slog.Logger) {
+	if m.cfg.Viewers == nil {
+		Reject(ws, websocket.ClosePolicyViolation, CodeListenUnavailable, errors.New("listening is disabled"), 0)
+		return
+	}
+	evs, stop, err := m.cfg.Viewers.Watch(id)
+	switch {
+	case errors.Is(err, events.ErrTooManyViewers):
+		Reject(ws, websocket.CloseTryAgainLater, CodeTooManyListeners, err, 0)
+		return
+	case err != nil:
+		Reject(ws, websocket.CloseGoingAway, CodeShuttingDown, ErrDraining, 0)
+		return
+	}
+	defer stop()
+	// Checked after watching, so an end in between isn't missed.
+	if _, ok := m.Get(id); !ok {
+		Reject(ws, websocket.ClosePolicyViolation, CodeSessionNotFound, ErrNotFound, 0)
+		return
+	}
+	log := logger.With("listen_session_id", id)
+	log.Info("Listener attached")
+	defer log.Info("Listener detached")
+
+	done := make(chan struct{})
+	go m.readListener(ws, done)
+
+	var ping <-chan time.Time
+	if m.cfg.PingInterval > 0 {
+		t := time.NewTicker(m.cfg.PingInterval)
+		defer t.Stop()
+		ping = t.C
+	}
+	var ended bool
+	for {
+		select {
+		case e, ok := <-evs:
+			if !ok {
+				code, reason := websocket.CloseNormalClosure, "session ended"
+				if !ended {
+					code, reason = websocket.CloseGoingAway, "server shutting down"
+				}
+				ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason),
+					time.Now().Add(closeGrace))
+				// Give the client a moment to answer the close.
+				select {
+				case <-done:
+				case <-time.After(closeGrace):
+				}
+				return
+			}
+			ended = e.Kind == events.SessionEnd
+			if e.Kind != events.VAD {
+				continue
+			}
+			if err := writeListener(ws, &pb.VADResponse{Event: e.Event, Message: e.Message}); err != nil {
+				log.Debug("Listener write failed", "err", err)
+				return
+			}
+		case <-ping:
+			ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(m.cfg.PongTimeout))
+		case <-done:
+			return
+		}
+	}
+}
+
+// readListener handles the listener's control frames and closes the
+// connection on anything else. It closes done once reading stops.
+func (m *Manager) readListener(ws Conn, done chan<- struct{}) {
+	defer close(done)
+	if m.cfg.PingInterval > 0 {
+		deadline := func() { ws.SetReadDeadline(time.Now().Add(m.cfg.PingInterval + m.cfg.PongTimeout)) }
+		deadline()
+		ws.SetPongHandler(func(string) error {
+			deadline()
+			return nil
+		})
+	}
+	if _, _, err := ws.ReadMessage(); err == nil {
+		ws.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "listen-only connection"),
+			time.Now().Add(closeGrace))
+	}
+}
+
+// writeListener frames resp as writeResponse does for the sending client.
+func writeListener(ws Conn, resp *pb.VADResponse) error {
+	if ws.Subprotocol() == SubprotocolBinary {
+		data, err := proto.Marshal(resp)
+		if err != nil {
+			return err
+		}
+		return ws.WriteMessage(websocket.BinaryMessage, data)
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	return ws.WriteMessage(websocket.TextMessage, data)
+}
@@ -0,0 +1,98 @@
+// session/maintenance.go
+package session
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrMaintenance is returned by Manager.New in maintenance mode.
+var ErrMaintenance = errors.New("server is in maintenance")
+
+// Maintenance describes maintenance mode, in which new sessions are refused
+// and open ones drained once Deadline passes.
+type Maintenance struct {
+	Since    time.Time
+	Deadline time.Time
+	// RetryAfter is how long refused clients are told to wait.
+	RetryAfter time.Duration
+}
+
+// drainFrame tells the client the session will be drained at Deadline, so
+// it can reconnect elsewhere first, or, as "drain_cancelled", that it won't.
+type drainFrame struct {
+	Event    string     `json:"event"`
+	Deadline *time.Time `json:"deadline,omitempty"`
+	// DeadlineInMS is how long until Deadline.
+	DeadlineInMS int64 `json:"deadline_in_ms,omitempty"`
+}
+
+// EnterMaintenance refuses new sessions, their clients told to retry after
+// retryAfter, and gives open ones grace to finish: each gets a drain notice
+// and is drained once grace has passed. Entering again, while in
+// maintenance, moves the deadline.
+func (m *Manager) EnterMaintenance(grace, retryAfter time.Duration) Maintenance {
+	now := time.Now()
+	m.mu.Lock()
+	mt := Maintenance{Since: now, Deadline: now.Add(grace), RetryAfter: retryAfter}
+	if m.maintenance != nil {
+		mt.Since = m.maintenance.Since
+		m.maintenanceTimer.Stop()
+	}
+	m.maintenance = &mt
+	m.maintenanceTimer = time.AfterFunc(grace, m.drainForMaintenance)
+	m.mu.Unlock()
+
+	for _, s := range m.List() {
+		s.noticeDrain(mt.Deadline)
+	}
+	return mt
+}
+
+// ExitMaintenance takes new sessions again; those told they would be
+// drained are told they won't.
+func (m *Manager) ExitMaintenance() {
+	m.mu.Lock()
+	if m.maintenance == nil {
+		m.mu.Unlock()
+		return
+	}
+	m.maintenance = nil
+	m.maintenanceTimer.Stop()
+	m.mu.Unlock()
+
+	for _, s := range m.List() {
+		if err := s.writeJSON(drainFrame{Event: "drain_cancelled"}); err != nil {
+			s.log.Debug("Drain cancellation not sent", "err", err)
+		}
+	}
+}
+
+// Maintenance reports whether the manager is in maintenance mode, and how.
+func (m *Manager) Maintenance() (Maintenance, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.maintenance == nil {
+		return Maintenance{}, false
+	}
+	return *m.maintenance, true
+}
+
+// drainForMaintenance drains the sessions still open at the deadline.
+func (m *Manager) drainForMaintenance() {
+	// A timer stopped as it fired may still run.
+	if mt, ok := m.Maintenance(); !ok || time.Now().Before(mt.Deadline) {
+		return
+	}
+	for _, s := range m.List() {
+		s.drain(ErrMaintenance)
+	}
+}
+
+// noticeDrain tells the client the session will be drained at deadline.
+func (s *Session) noticeDrain(deadline time.Time) {
+	frame := drainFrame{Event: "drain", Deadline: &deadline, DeadlineInMS: time.Until(deadline).Milliseconds()}
+	if err := s.writeJSON(frame); err != nil {
+		s.log.Debug("Drain notice not sent", "err", err)
+	}
+}
@@ -0,0 +1,180 @@
+// session/manager.go
+package session
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"vad-application/pipeline"
+)
+
+// Errors returned by Manager.New, besides ErrMaintenance.
+var (
+	ErrDraining   = errors.New("server is shutting down")
+	ErrAtCapacity = errors.New("server at capacity")
+)
+
+// Manager keeps track of the sessions that are currently open.
+type Manager struct {
+	cfg Config
+
+	mu       sync.RWMutex
+	sessions map[string]*Session
+	// reserved counts the streams Reserve admitted that aren't sessions.
+	reserved int
+	draining bool
+	wg       sync.WaitGroup
+	// maintenance is set in maintenance mode, and maintenanceTimer drains
+	// the sessions then.
+	maintenance      *Maintenance
+	maintenanceTimer *time.Timer
+}
+
+// NewManager returns an empty session registry whose sessions share cfg.
+func NewManager(cfg Config) *Manager {
+	return &Manager{cfg: cfg, sessions: map[string]*Session{}}
+}
+
+// ParseSettings is like the package's ParseSettings, with the pipeline's
+// defaults for sessions not choosing, and refuses the parameters outside
+// Config.QueryParams.
+func (m *Manager) ParseSettings(q url.Values) (Settings, error) {
+	st := DefaultSettings()
+	st.Denoise = m.cfg.Pipeline.Denoise
+	st.AGCTargetDBFS = m.cfg.Pipeline.AGCTargetDBFS
+	st.DTMF = m.cfg.Pipeline.DTMF
+	return parseSettings(q, st, m.cfg.QueryParams)
+}
+
+// NewPipeline builds the audio pipeline for a stream with settings st.
+// Nobody hears its DTMF tones.
+func (m *Manager) NewPipeline(st Settings) (*pipeline.Chain, error) {
+	return pipeline.New(pipeline.Params{Format: st.Format, Options: st.Options(), Config: m.cfg.Pipeline})
+}
+
+// New creates a session for ws and registers it. Callers must Remove it once
+// the session has finished.
+func (m *Manager) New(ws Conn, logger *slog.Logger) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.admit(); err != nil {
+		return nil, err
+	}
+	s := New(ws, m.cfg, logger)
+	m.sessions[s.ID] = s
+	m.wg.Add(1)
+	return s, nil
+}
+
+// Reserve counts a stream served outside the manager, such as a SIP call,
+// against MaxSessions, refusing it like New would. The stream's slot is
+// freed by calling release, once.
+func (m *Manager) Reserve() (release func(), err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.admit(); err != nil {
+		return nil, err
+	}
+	m.reserved++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			m.mu.Lock()
+			m.reserved--
+			m.mu.Unlock()
+		})
+	}, nil
+}
+
+// admit reports why a new stream can't be opened, if it can't. m.mu must
+// be held.
+func (m *Manager) admit() error {
+	if m.draining {
+		return ErrDraining
+	}
+	if m.maintenance != nil {
+		return ErrMaintenance
+	}
+	if m.cfg.MaxSessions > 0 && len(m.sessions)+m.reserved >= m.cfg.MaxSessions {
+		return ErrAtCapacity
+	}
+	return nil
+}
+
+// Remove unregisters the session with the given ID.
+func (m *Manager) Remove(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.sessions[id]; ok {
+		delete(m.sessions, id)
+		m.wg.Done()
+	}
+}
+
+// Get returns the open session with the given ID.
+func (m *Manager) Get(id string) (*Session, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	s, ok := m.sessions[id]
+	return s, ok
+}
+
+// Len returns the number of open sessions.
+func (m *Manager) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.sessions)
+}
+
+// List returns the open sessions, oldest first.
+func (m *Manager) List() []*Session {
+	m.mu.RLock()
+	list := make([]*Session, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		list = append(list, s)
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Started.Before(list[j].Started) })
+	return list
+}
+
+// Draining reports whether Drain has been called.
+func (m *Manager) Draining() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.draining
+}
+
+// Drain refuses new sessions and asks every open session to finish. Sessions
+// still open when ctx expires are closed forcibly and ctx's error returned.
+func (m *Manager) Drain(ctx context.Context) error {
+	m.mu.Lock()
+	m.draining = true
+	m.mu.Unlock()
+
+	for _, s := range m.List() {
+		s.Drain()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		for _, s := range m.List() {
+			s.Close()
+		}
+		return ctx.Err()
+	}
+}
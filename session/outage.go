@@ -0,0 +1,182 @@
+// session/outage.go
+package session
+
+import (
+	"math"
+	"time"
+
+	"vad-application/audio"
+	"vad-application/metrics"
+)
+
+// lateGrace is how long after the last buffered chunk went out the
+// backend's responses still count as late: without chunk acknowledgements
+// the bridge can't tell which audio a response is for.
+const lateGrace = 250 * time.Millisecond
+
+// statusBuffering and statusRecovered bracket a backend outage in status
+// frames.
+const (
+	statusBuffering = "buffering"
+	statusRecovered = "recovered"
+)
+
+// outageBacklog holds the audio a client sends while its backend stream is
+// broken, up to Config.OutageBuffer of it with the oldest dropped first, so
+// the stream replacing it gets that audio late rather than never. It fills
+// from the send queue between start and halt; the send loop empties it
+// otherwise.
+type outageBacklog struct {
+	limit  int
+	size   int
+	chunks []chunk
+	// since is when the outage began; zero once the backlog is sent.
+	since time.Time
+	// dropped counts the chunks dropped in this outage, and lost each.
+	dropped int
+	lost    func()
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// newOutageBacklog holds up to d of backend audio; zero disables buffering
+// and returns nil.
+func newOutageBacklog(d time.Duration, lost func()) *outageBacklog {
+	if d <= 0 {
+		return nil
+	}
+	f := audio.Backend
+	return &outageBacklog{limit: int(d.Seconds()*float64(f.SampleRate)) * f.FrameSize(), lost: lost}
+}
+
+// start moves audio from queue into the backlog until halt. An outage that
+// begins before the backlog of the last one was sent continues it.
+func (b *outageBacklog) start(queue *chunkQueue) {
+	if b.since.IsZero() {
+		b.since = time.Now()
+		b.dropped = 0
+	}
+	b.stop, b.done = make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(b.done)
+		for {
+			select {
+			case c, ok := <-queue.ch:
+				if !ok {
+					return
+				}
+				metrics.QueuedChunks.Dec()
+				b.add(c)
+			case <-b.stop:
+				return
+			}
+		}
+	}()
+}
+
+// filling reports whether the backlog is between start and halt.
+func (b *outageBacklog) filling() bool {
+	return b != nil && b.stop != nil
+}
+
+// halt stops filling the backlog.
+func (b *outageBacklog) halt() {
+	if !b.filling() {
+		return
+	}
+	close(b.stop)
+	<-b.done
+	b.stop, b.done = nil, nil
+}
+
+func (b *outageBacklog) add(c chunk) {
+	b.chunks = append(b.chunks, c)
+	b.size += len(c.data)
+	for b.size > b.limit {
+		old := b.chunks[0]
+		b.chunks = b.chunks[1:]
+		b.size -= len(old.data)
+		if old.flushed == nil {
+			b.dropped++
+			b.lost()
+			metrics.DroppedChunks.WithLabelValues("outage").Inc()
+		}
+		old.done()
+	}
+}
+
+// pop takes the oldest chunk held. It reports false once none are left.
+func (b *outageBacklog) pop() (chunk, bool) {
+	if b == nil || len(b.chunks) == 0 {
+		return chunk{}, false
+	}
+	c := b.chunks[0]
+	b.chunks = b.chunks[1:]
+	b.size -= len(c.data)
+	if len(b.chunks) == 0 {
+		b.since = time.Time{}
+	}
+	return c, true
+}
+
+// discard releases the chunks that will never be sent.
+func (b *outageBacklog) discard() {
+	b.halt()
+	for {
+		c, ok := b.pop()
+		if !ok {
+			return
+		}
+		c.done()
+	}
+}
+
+// bufferOutage starts holding the client's audio once err broke the backend
+// stream, reporting whether it did: the session then waits for a backend
+// until the outage is Config.OutageBuffer old.
+func (s *Session) bufferOutage(backlog *outageBacklog, queue *chunkQueue, err error) bool {
+	if backlog == nil {
+		return false
+	}
+	s.log.Warn("Backend stream failed; buffering audio until it is back", "buffer", s.cfg.OutageBuffer.String(), "err", err)
+	backlog.start(queue)
+	s.sendStatus(statusFrame{Event: "status", Status: statusBuffering, Message: "speech backend unavailable; buffering audio…"})
+	return true
+}
+
+// outageTimeout is how long to try opening a stream during an outage: until
+// it is Config.OutageBuffer old, after a last attempt.
+func (s *Session) outageTimeout(backlog *outageBacklog) time.Duration {
+	return time.Until(backlog.since.Add(s.cfg.OutageBuffer))
+}
+
+// recovered tells the client that a stream is open again, and how much of
+// its audio it gets late.
+func (s *Session) recovered(backlog *outageBacklog) {
+	buffered := seconds(int64(backlog.size))
+	s.log.Info("Backend is back; sending buffered audio", "buffered", buffered, "dropped_chunks", backlog.dropped,
+		"outage", time.Since(backlog.since).Round(time.Millisecond).String())
+	s.sendStatus(statusFrame{
+		Event:      "status",
+		Status:     statusRecovered,
+		Message:    "speech backend is back; catching up on buffered audio",
+		BufferedMS: int64(buffered * 1000),
+	})
+}
+
+// catchUp marks the responses the backend sends from now on as late, until
+// caughtUp.
+func (s *Session) catchUp() {
+	s.lateUntil.Store(math.MaxInt64)
+}
+
+// caughtUp lets late responses trail the last buffered chunk by lateGrace.
+func (s *Session) caughtUp() {
+	s.lateUntil.Store(time.Now().Add(lateGrace).UnixNano())
+}
+
+// late reports whether a response received now is likely for audio held
+// during an outage.
+func (s *Session) late() bool {
+	return time.Now().UnixNano() < s.lateUntil.Load()
+}
@@ -0,0 +1,150 @@
+// session/pipeline.go
+package session
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"vad-application/events"
+	"vad-application/llm"
+	"vad-application/metrics"
+
+	"github.com/google/uuid"
+)
+
+// turnQueueSize is how many transcripts may wait for the assistant before
+// new ones are dropped.
+const turnQueueSize = 4
+
+// assistantFrame carries the assistant's reply to a transcript: pieces of
+// it in assistant_delta frames as they are generated, then the whole of it,
+// or the error that ended it, in an assistant frame. Utterance is the ID of
+// the play and stop frames speaking the reply.
+type assistantFrame struct {
+	Event     string `json:"event"`
+	ID        string `json:"id"`
+	Text      string `json:"text"`
+	Utterance string `json:"utterance,omitempty"`
+	Error     string `json:"error,omitempty"`
+	// Interrupted is set when the user spoke over the reply.
+	Interrupted bool `json:"interrupted,omitempty"`
+}
+
+// trimHistory keeps the messages of the last turns exchanges. An exchange
+// starts with a user message.
+func trimHistory(history []llm.Message, turns int) []llm.Message {
+	start := len(history)
+	for i := len(history) - 1; i >= 0 && turns > 0; i-- {
+		if history[i].Role == llm.RoleUser {
+			start = i
+			turns--
+		}
+	}
+	return history[start:]
+}
+
+// queueTurn hands a transcript to the assistant, if there is one.
+func (s *Session) queueTurn(text string) {
+	if s.turns == nil || strings.TrimSpace(text) == "" {
+		return
+	}
+	select {
+	case s.turns <- text:
+	default:
+		metrics.AssistantReplies.WithLabelValues("dropped").Inc()
+		s.log.Warn("Assistant behind; transcript not answered")
+	}
+}
+
+// converse answers each queued transcript until the channel closes or ctx
+// is done, keeping the session's conversation, and speaks the replies when
+// the session has a Synthesizer.
+func (s *Session) converse(ctx context.Context, turns <-chan string) {
+	var history []llm.Message
+	for {
+		var text string
+		select {
+		case <-ctx.Done():
+			return
+		case t, ok := <-turns:
+			if !ok {
+				return
+			}
+			text = t
+		}
+
+		messages := make([]llm.Message, 0, len(history)+2)
+		if s.cfg.SystemPrompt != "" {
+			messages = append(messages, llm.Message{Role: llm.RoleSystem, Content: s.cfg.SystemPrompt})
+		}
+		messages = append(messages, history...)
+		messages = append(messages, llm.Message{Role: llm.RoleUser, Content: text})
+
+		id := uuid.NewString()
+		rctx, stop := context.WithCancelCause(ctx)
+		s.setReply(stop)
+		rctx, cancel := context.WithTimeout(rctx, s.cfg.ReplyTimeout)
+		start := time.Now()
+		first := true
+		reply, err := s.cfg.Assistant.Complete(rctx, messages, func(piece string) {
+			if first {
+				first = false
+				metrics.AssistantLatency.Observe(time.Since(start).Seconds())
+			}
+			if err := s.writeJSON(assistantFrame{Event: "assistant_delta", ID: id, Text: piece}); err != nil {
+				s.log.Debug("Assistant reply not sent", "err", err)
+			}
+		})
+		cancel()
+		s.setReply(nil)
+		interrupted := errors.Is(context.Cause(rctx), errBargeIn)
+		stop(nil)
+		if ctx.Err() != nil {
+			return
+		}
+		if interrupted {
+			// The user goes on; what they said so far stays in the
+			// conversation, the reply they cut off does not.
+			metrics.AssistantReplies.WithLabelValues("interrupted").Inc()
+			history = trimHistory(append(history, llm.Message{Role: llm.RoleUser, Content: text}), s.cfg.MaxTurns)
+			if err := s.writeJSON(assistantFrame{Event: "assistant", ID: id, Interrupted: true}); err != nil {
+				s.log.Debug("Assistant reply not sent", "err", err)
+			}
+			continue
+		}
+		if err != nil {
+			metrics.AssistantReplies.WithLabelValues("failed").Inc()
+			s.log.Warn("Assistant reply failed", "err", err)
+			if werr := s.writeJSON(assistantFrame{Event: "assistant", ID: id, Error: err.Error()}); werr != nil {
+				s.log.Debug("Assistant reply not sent", "err", werr)
+			}
+			continue
+		}
+		metrics.AssistantReplies.WithLabelValues("ok").Inc()
+		s.log.Debug("Assistant replied", "chars", len(reply))
+
+		history = append(history,
+			llm.Message{Role: llm.RoleUser, Content: text},
+			llm.Message{Role: llm.RoleAssistant, Content: reply})
+		history = trimHistory(history, s.cfg.MaxTurns)
+
+		frame := assistantFrame{Event: "assistant", ID: id, Text: reply}
+		if s.player != nil && strings.TrimSpace(reply) != "" {
+			utterance, err := s.Speak(reply, "")
+			switch {
+			case errors.Is(err, ErrPlaybackUnsupported):
+			case err != nil:
+				s.log.Warn("Assistant reply not spoken", "err", err)
+			default:
+				frame.Utterance = utterance
+			}
+		}
+		s.rec.Event(events.Assistant, reply)
+		s.publish(events.Event{Kind: events.Assistant, Text: reply})
+		if err := s.writeJSON(frame); err != nil {
+			s.log.Debug("Assistant reply not sent", "err", err)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+// session/playback.go
+package session
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"vad-application/audio"
+	"vad-application/metrics"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// Playback limits: speech goes out in playbackFrame pieces, at most
+// playbackLead ahead of real time so that an interruption silences it
+// promptly, and up to playbackQueueSize utterances wait their turn.
+const (
+	playbackFrame     = 100 * time.Millisecond
+	playbackLead      = time.Second
+	playbackQueueSize = 16
+)
+
+// Playback stop reasons.
+const (
+	playbackDone        = "done"
+	playbackInterrupted = "interrupted"
+	playbackFailed      = "failed"
+)
+
+// Errors returned by Speak.
+var (
+	ErrNoSynthesizer       = errors.New("session: no speech synthesizer configured")
+	ErrPlaybackUnsupported = errors.New("session: speech playback needs the " + SubprotocolJSON + " subprotocol")
+	ErrPlaybackQueueFull   = errors.New("session: too many utterances queued")
+)
+
+// playFrame announces the binary frames of one utterance that follow it.
+type playFrame struct {
+	Event      string         `json:"event"`
+	ID         string         `json:"id"`
+	Encoding   audio.Encoding `json:"encoding"`
+	SampleRate int            `json:"sample_rate"`
+	Channels   int            `json:"channels"`
+	Text       string         `json:"text"`
+}
+
+// stopFrame ends an utterance, or reports one that never played.
+type stopFrame struct {
+	Event  string `json:"event"`
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+	Error  string `json:"error,omitempty"`
+}
+
+// utterance is text waiting to be spoken to the client.
+type utterance struct {
+	id    string
+	text  string
+	voice string
+}
+
+// player queues a session's utterances. The play loop speaks them one at a
+// time; Interrupt cancels the current one and drops the rest.
+type player struct {
+	queue chan utterance
+	mu    sync.Mutex
+	// cancel stops the utterance being spoken; nil between utterances.
+	cancel context.CancelFunc
+}
+
+// Speak queues text to be synthesized with voice, empty for the default, and
+// streamed to the client. It returns the utterance ID the play and stop
+// frames carry.
+func (s *Session) Speak(text, voice string) (string, error) {
+	if s.cfg.Synthesizer == nil {
+		return "", ErrNoSynthesizer
+	}
+	if s.ws.Subprotocol() == SubprotocolBinary {
+		return "", ErrPlaybackUnsupported
+	}
+	u := utterance{id: uuid.NewString(), text: text, voice: voice}
+	select {
+	case s.player.queue <- u:
+		return u.id, nil
+	default:
+		return "", ErrPlaybackQueueFull
+	}
+}
+
+// Interrupt silences the utterance being spoken and drops the queued ones.
+// It reports whether there was anything to stop.
+func (s *Session) Interrupt() bool {
+	if s.player == nil {
+		return false
+	}
+	stopped := false
+drain:
+	for {
+		select {
+		case u := <-s.player.queue:
+			stopped = true
+			s.stopPlayback(u.id, playbackInterrupted, nil)
+		default:
+			break drain
+		}
+	}
+	s.player.mu.Lock()
+	if s.player.cancel != nil {
+		s.player.cancel()
+		stopped = true
+	}
+	s.player.mu.Unlock()
+	return stopped
+}
+
+// busy reports whether there is speech playing or queued; a nil player
+// never is.
+func (p *player) busy() bool {
+	if p == nil {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.cancel != nil || len(p.queue) > 0
+}
+
+// play speaks queued utterances until ctx is done.
+func (s *Session) play(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case u := <-s.player.queue:
+			s.speak(ctx, u)
+		}
+	}
+}
+
+// speak synthesizes one utterance and streams it to the client, paced to
+// stay at most playbackLead ahead of real time.
+func (s *Session) speak(ctx context.Context, u utterance) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	s.player.mu.Lock()
+	s.player.cancel = cancel
+	s.player.mu.Unlock()
+	defer func() {
+		s.player.mu.Lock()
+		s.player.cancel = nil
+		s.player.mu.Unlock()
+	}()
+
+	synth := s.cfg.Synthesizer
+	body, err := synth.Synthesize(ctx, u.text, u.voice)
+	if err != nil {
+		s.endUtterance(ctx, u.id, err)
+		return
+	}
+	defer body.Close()
+	f := synth.Format()
+	if err := s.writeJSON(playFrame{
+		Event:      "play",
+		ID:         u.id,
+		Encoding:   f.Encoding,
+		SampleRate: f.SampleRate,
+		Channels:   f.Channels,
+		Text:       u.text,
+	}); err != nil {
+		return
+	}
+	s.log.Debug("Speaking", "utterance", u.id, "chars", len(u.text))
+
+	frame := make([]byte, int(playbackFrame.Seconds()*float64(f.SampleRate))*f.FrameSize())
+	bytesPerSecond := float64(f.SampleRate * f.FrameSize())
+	started := time.Now()
+	var sent time.Duration
+	for {
+		n, err := io.ReadFull(body, frame)
+		// Only whole samples are sent.
+		if n -= n % f.FrameSize(); n > 0 {
+			if wait := sent - time.Since(started) - playbackLead; wait > 0 {
+				select {
+				case <-ctx.Done():
+				case <-time.After(wait):
+				}
+			}
+			if ctx.Err() != nil {
+				s.endUtterance(ctx, u.id, ctx.Err())
+				return
+			}
+			if werr := s.writeFrame(websocket.BinaryMessage, frame[:n]); werr != nil {
+				return
+			}
+			sent += time.Duration(float64(n) / bytesPerSecond * float64(time.Second))
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			s.endUtterance(ctx, u.id, nil)
+			return
+		}
+		if err != nil {
+			s.endUtterance(ctx, u.id, err)
+			return
+		}
+	}
+}
+
+// endUtterance sends the stop frame of an utterance that ended with err.
+func (s *Session) endUtterance(ctx context.Context, id string, err error) {
+	switch {
+	case err == nil:
+		s.stopPlayback(id, playbackDone, nil)
+	case ctx.Err() != nil:
+		s.stopPlayback(id, playbackInterrupted, nil)
+	default:
+		s.log.Warn("Speech synthesis failed", "utterance", id, "err", err)
+		s.stopPlayback(id, playbackFailed, err)
+	}
+}
+
+func (s *Session) stopPlayback(id, reason string, err error) {
+	metrics.Utterances.WithLabelValues(reason).Inc()
+	frame := stopFrame{Event: "stop", ID: id, Reason: reason}
+	if err != nil {
+		frame.Error = err.Error()
+	}
+	if werr := s.writeJSON(frame); werr != nil {
+		s.log.Debug("Playback stop not sent", "err", werr)
+	}
+}
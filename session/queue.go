@@ -0,0 +1,145 @@
+// session/queue.go
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"vad-application/metrics"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// QueuePolicy decides what happens to new audio when the send queue is full
+// because the backend consumes it slower than the client produces it.
+type QueuePolicy string
+
+const (
+	// PolicyBlock stops reading from the client until there is room.
+	PolicyBlock QueuePolicy = "block"
+	// PolicyDropOldest discards the oldest queued chunk to make room.
+	PolicyDropOldest QueuePolicy = "drop_oldest"
+	// PolicyDisconnect closes the session.
+	PolicyDisconnect QueuePolicy = "disconnect"
+)
+
+// ParseQueuePolicy validates a policy name from the configuration.
+func ParseQueuePolicy(name string) (QueuePolicy, error) {
+	switch p := QueuePolicy(name); p {
+	case PolicyBlock, PolicyDropOldest, PolicyDisconnect:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown queue policy %q (want block, drop_oldest or disconnect)", name)
+}
+
+// errQueueFull is returned by push under PolicyDisconnect.
+var errQueueFull = errors.New("backend is not keeping up with the audio stream")
+
+// chunk is one audio frame waiting to be sent to the backend.
+type chunk struct {
+	data []byte
+	// buf backs data and goes back to the pool once the chunk is done.
+	buf      *[]byte
+	received time.Time
+	// ctx carries span, the trace span covering the chunk until it is sent.
+	ctx  context.Context
+	span trace.Span
+	// flushed, when set, marks a flush request rather than audio.
+	flushed func()
+}
+
+// done ends the chunk's span and recycles its buffer. The chunk must not be
+// used afterwards.
+func (c chunk) done() {
+	if c.span != nil {
+		c.span.End()
+	}
+	putBuffer(c.buf)
+	if c.flushed != nil {
+		c.flushed()
+	}
+}
+
+// chunkQueue is the bounded hand-off between the WebSocket read loop and the
+// gRPC send loop. It has a single producer and a single consumer.
+type chunkQueue struct {
+	ch      chan chunk
+	policy  QueuePolicy
+	dropped func()
+}
+
+func newChunkQueue(size int, policy QueuePolicy, dropped func()) *chunkQueue {
+	if size < 1 {
+		size = 1
+	}
+	return &chunkQueue{ch: make(chan chunk, size), policy: policy, dropped: dropped}
+}
+
+// push enqueues c according to the queue's policy. It fails when ctx is done
+// or, under PolicyDisconnect, when the queue is full.
+func (q *chunkQueue) push(ctx context.Context, c chunk) error {
+	select {
+	case q.ch <- c:
+		metrics.QueuedChunks.Inc()
+		return nil
+	default:
+	}
+
+	switch q.policy {
+	case PolicyDisconnect:
+		metrics.DroppedChunks.WithLabelValues(string(q.policy)).Inc()
+		c.done()
+		return errQueueFull
+	case PolicyDropOldest:
+		for {
+			select {
+			case q.ch <- c:
+				metrics.QueuedChunks.Inc()
+				return nil
+			case old := <-q.ch:
+				metrics.QueuedChunks.Dec()
+				metrics.DroppedChunks.WithLabelValues(string(q.policy)).Inc()
+				old.done()
+				q.dropped()
+			}
+		}
+	default:
+		select {
+		case q.ch <- c:
+			metrics.QueuedChunks.Inc()
+			return nil
+		case <-ctx.Done():
+			c.done()
+			return ctx.Err()
+		}
+	}
+}
+
+// close tells the consumer that no more chunks will be pushed.
+func (q *chunkQueue) close() {
+	close(q.ch)
+}
+
+// pop returns the next chunk, or false once the queue is closed and empty or
+// ctx is done. Chunks left behind stay queued for the next consumer.
+func (q *chunkQueue) pop(ctx context.Context) (chunk, bool) {
+	select {
+	case c, ok := <-q.ch:
+		if ok {
+			metrics.QueuedChunks.Dec()
+		}
+		return c, ok
+	case <-ctx.Done():
+		return chunk{}, false
+	}
+}
+
+// discard releases chunks that will never be sent.
+func (q *chunkQueue) discard() {
+	for c := range q.ch {
+		metrics.QueuedChunks.Dec()
+		c.done()
+	}
+}
@@ -0,0 +1,48 @@
+// session/recover.go
+package session
+
+import (
+	"errors"
+	"runtime/debug"
+
+	"vad-application/metrics"
+	"vad-application/reporting"
+
+	"github.com/gorilla/websocket"
+)
+
+var errInternal = errors.New("internal error")
+
+// recoverPanic, deferred first thing in the session's goroutines, turns a
+// panic in one of them into the end of this session alone: the stack is
+// logged, metrics.Panics counts it and the client is told.
+func (s *Session) recoverPanic(where string) {
+	v := recover()
+	if v == nil {
+		return
+	}
+	metrics.Panics.WithLabelValues(where).Inc()
+	s.log.Error("Session panicked", "where", where, "panic", v, "stack", string(debug.Stack()))
+	s.cfg.Errors.Capture(reporting.Event{Message: "Session panicked", Panic: v, Tags: s.reportTags("where", where), Subject: s.Subject})
+	s.sendError(CodeInternalError, errInternal)
+	s.end(websocket.CloseInternalServerErr, "internal error")
+}
+
+// reportTags returns the session's context for an error report, plus the
+// key and value pairs kv.
+func (s *Session) reportTags(kv ...string) map[string]string {
+	tags := map[string]string{"session_id": s.ID}
+	if s.Tenant != "" {
+		tags["tenant"] = s.Tenant
+	}
+	if s.RequestID != "" {
+		tags["request_id"] = s.RequestID
+	}
+	if s.Settings.Model != "" {
+		tags["model"] = s.Settings.Model
+	}
+	for i := 0; i+1 < len(kv); i += 2 {
+		tags[kv[i]] = kv[i+1]
+	}
+	return tags
+}
@@ -0,0 +1,100 @@
+// session/reframe.go
+package session
+
+import (
+	"context"
+	"time"
+)
+
+// queueAudio queues processed audio, one chunk per frame when the pipeline
+// cuts frames, as copies of c. The last chunk ends c's span; if there is
+// none, the span ends now.
+func (s *Session) queueAudio(ctx context.Context, queue *chunkQueue, pcm []byte, c chunk) error {
+	size := s.pipe.FrameSize()
+	if size == 0 {
+		size = len(pcm)
+	}
+	if len(pcm) == 0 {
+		if c.span != nil {
+			c.span.End()
+		}
+		return nil
+	}
+	n := len(pcm) / size
+	for i := range n {
+		frame := c
+		buf := getBuffer()
+		*buf = append((*buf)[:0], pcm[i*size:(i+1)*size]...)
+		frame.data, frame.buf = *buf, buf
+		if i < n-1 {
+			frame.span = nil
+		}
+		if err := queue.push(ctx, frame); err != nil {
+			if frame.span == nil && c.span != nil {
+				c.span.End()
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// flushPipeline queues the audio the pipeline holds back, such as the last
+// partial frame padded with silence, so that nothing the client sent waits
+// for more.
+func (s *Session) flushPipeline(ctx context.Context, queue *chunkQueue) error {
+	if s.pipe == nil {
+		return nil
+	}
+	pcm, err := s.pipe.Flush()
+	if err != nil || len(pcm) == 0 {
+		return err
+	}
+	s.stats.audioReceived.Add(int64(len(pcm)))
+	return s.queueAudio(ctx, queue, pcm, chunk{received: time.Now(), ctx: ctx})
+}
+
+// pacer releases frames to the backend at the pace of real time, starting
+// jitter late so that frames arriving unevenly go out evenly. A stream
+// falling more than jitter behind starts over.
+type pacer struct {
+	frame, jitter time.Duration
+	start         time.Time
+	n             int64
+}
+
+// newPacer returns a pacer for frames of duration frame, or nil without a
+// jitter buffer.
+func newPacer(frame, jitter time.Duration) *pacer {
+	if frame <= 0 || jitter <= 0 {
+		return nil
+	}
+	return &pacer{frame: frame, jitter: jitter}
+}
+
+// wait blocks until the next frame is due, reporting false if ctx ended
+// first.
+func (p *pacer) wait(ctx context.Context) bool {
+	if p == nil {
+		return true
+	}
+	now := time.Now()
+	due := p.start.Add(time.Duration(p.n) * p.frame)
+	if p.start.IsZero() || now.Sub(due) > p.jitter {
+		p.start, p.n = now.Add(p.jitter), 0
+		due = p.start
+	}
+	p.n++
+	d := time.Until(due)
+	if d <= 0 {
+		return true
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,39 @@
+// session/replay.go
+package session
+
+import (
+	"time"
+
+	"vad-application/audio"
+)
+
+// replayBuffer keeps the audio most recently sent to the backend, so that a
+// stream opened after a failover starts with the context the old one had.
+// Chunks keep their original framing. Only the send loop touches it.
+type replayBuffer struct {
+	limit  int
+	size   int
+	chunks [][]byte
+}
+
+// newReplayBuffer holds up to d of backend audio; zero keeps nothing.
+func newReplayBuffer(d time.Duration) *replayBuffer {
+	f := audio.Backend
+	return &replayBuffer{limit: int(d.Seconds()*float64(f.SampleRate)) * f.FrameSize()}
+}
+
+// add copies data in, evicting the oldest chunks beyond the limit.
+func (r *replayBuffer) add(data []byte) {
+	if len(data) > r.limit {
+		return
+	}
+	var b []byte
+	for r.size+len(data) > r.limit {
+		// Reuse the evicted chunk's storage.
+		b = r.chunks[0]
+		r.size -= len(b)
+		r.chunks = r.chunks[1:]
+	}
+	r.chunks = append(r.chunks, append(b[:0], data...))
+	r.size += len(data)
+}
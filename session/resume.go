@@ -0,0 +1,401 @@
+// session/resume.go
+package session
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// resumeBufferBytes caps the frames held for a client while it is away;
+// the oldest go first.
+const resumeBufferBytes = 1 << 20
+
+// Errors returned by Manager.Resume.
+var (
+	ErrResumeNotFound = errors.New("no session to resume with this token")
+	ErrResumeMismatch = errors.New("resuming connection must use the session's subprotocol")
+)
+
+// resumableFrame gives the client the token that resumes its session on
+// a new connection, within WindowMS of losing this one.
+type resumableFrame struct {
+	Event     string `json:"event"`
+	SessionID string `json:"session_id"`
+	Token     string `json:"resume_token"`
+	WindowMS  int64  `json:"resume_window_ms"`
+}
+
+// resumedFrame starts a resumed connection, before the frames the client
+// missed; Dropped counts those that didn't fit the buffer.
+type resumedFrame struct {
+	Event     string `json:"event"`
+	SessionID string `json:"session_id"`
+	Replayed  int    `json:"replayed"`
+	Dropped   int    `json:"dropped,omitempty"`
+}
+
+// newResumeToken returns a secret naming a session to its client alone.
+func newResumeToken() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Resume moves the session holding token onto ws, a reconnection of
+// subject's client, once the one the session had is lost. It returns a
+// channel closed when the session no longer uses ws; the caller keeps ws
+// open until then.
+func (m *Manager) Resume(token, subject string, ws Conn) (<-chan struct{}, error) {
+	m.mu.RLock()
+	var found *Session
+	for _, s := range m.sessions {
+		if s.resume != nil && subtle.ConstantTimeCompare([]byte(s.resume.token), []byte(token)) == 1 {
+			found = s
+			break
+		}
+	}
+	m.mu.RUnlock()
+	if found == nil || found.Subject != subject {
+		return nil, ErrResumeNotFound
+	}
+	return found.resumeOn(ws)
+}
+
+// resumeOn attaches ws, telling the client what it missed.
+func (s *Session) resumeOn(ws Conn) (<-chan struct{}, error) {
+	done, replayed, dropped, err := s.resume.attach(ws, func(replayed, dropped int) []byte {
+		data, _ := json.Marshal(resumedFrame{Event: "resumed", SessionID: s.ID, Replayed: replayed, Dropped: dropped})
+		return data
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.log.Info("Session resumed", "new_remote_addr", ws.RemoteAddr().String(), "replayed", replayed, "dropped", dropped)
+	s.extendReadDeadline()
+	return done, nil
+}
+
+// ResumeToken is the secret resuming the session, or empty if it can't be
+// resumed.
+func (s *Session) ResumeToken() string {
+	if s.resume == nil {
+		return ""
+	}
+	return s.resume.token
+}
+
+// sendResumable tells the client how to resume the session.
+func (s *Session) sendResumable() {
+	frame := resumableFrame{Event: "resumable", SessionID: s.ID, Token: s.resume.token, WindowMS: s.cfg.ResumeWindow.Milliseconds()}
+	if err := s.writeJSON(frame); err != nil {
+		s.log.Debug("Resume token not sent", "err", err)
+	}
+}
+
+// resumableConn is the client's connection as a session sees it when it
+// may be resumed. Losing the connection without a close frame detaches it:
+// reads wait, up to window, for the client to come back on a new one, and
+// data frames are held for it meanwhile.
+type resumableConn struct {
+	token       string
+	window      time.Duration
+	subprotocol string
+	log         *slog.Logger
+
+	// wmu serializes data frames, and attach with them.
+	wmu sync.Mutex
+
+	mu sync.Mutex
+	// conn is nil while detached; done is closed when it stops being used.
+	conn Conn
+	done chan struct{}
+	addr net.Addr
+	// lost is when the connection was; attached wakes a waiting reader.
+	lost     time.Time
+	attached chan struct{}
+	// Settings kept for the next connection.
+	limit int64
+	pong  func(string) error
+	// pending holds the frames written while detached.
+	pending      []heldFrame
+	pendingBytes int
+	dropped      int
+	// halted is closed once the session stops reading; closed once it
+	// ends.
+	halted   chan struct{}
+	haltOnce sync.Once
+	closed   bool
+}
+
+// heldFrame is a data frame held for the client.
+type heldFrame struct {
+	typ  int
+	data []byte
+}
+
+func newResumableConn(ws Conn, window time.Duration, log *slog.Logger) *resumableConn {
+	return &resumableConn{
+		token:       newResumeToken(),
+		window:      window,
+		subprotocol: ws.Subprotocol(),
+		log:         log,
+		conn:        ws,
+		addr:        ws.RemoteAddr(),
+		attached:    make(chan struct{}, 1),
+		halted:      make(chan struct{}),
+	}
+}
+
+func (r *resumableConn) Subprotocol() string { return r.subprotocol }
+
+func (r *resumableConn) RemoteAddr() net.Addr {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.addr
+}
+
+// NextReader reads from the current connection, waiting for a new one
+// after the client lost it.
+func (r *resumableConn) NextReader() (int, io.Reader, error) {
+	for {
+		r.mu.Lock()
+		c := r.conn
+		r.mu.Unlock()
+		if c == nil {
+			if err := r.await(); err != nil {
+				return 0, nil, err
+			}
+			continue
+		}
+		mt, rd, err := c.NextReader()
+		if err == nil {
+			return mt, rd, nil
+		}
+		if !r.resumable(err) {
+			return 0, nil, err
+		}
+		r.detach(c, err)
+	}
+}
+
+// resumable reports whether the client may come back after err: it went
+// away without closing, or stopped answering pings.
+func (r *resumableConn) resumable(err error) bool {
+	select {
+	case <-r.halted:
+		return false
+	default:
+	}
+	var ce *websocket.CloseError
+	if errors.As(err, &ce) {
+		return ce.Code == websocket.CloseAbnormalClosure
+	}
+	return !errors.Is(err, websocket.ErrReadLimit)
+}
+
+// detach drops c, unless the client already replaced it.
+func (r *resumableConn) detach(c Conn, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conn != c {
+		return
+	}
+	c.Close()
+	r.conn = nil
+	r.lost = time.Now()
+	if r.done != nil {
+		close(r.done)
+		r.done = nil
+	}
+	r.log.Info("Client connection lost; waiting for it to resume", "window", r.window.String(), "err", err)
+}
+
+// await waits for the client to come back, until the window closes or the
+// session stops reading.
+func (r *resumableConn) await() error {
+	r.mu.Lock()
+	left := r.window - time.Since(r.lost)
+	r.mu.Unlock()
+	t := time.NewTimer(left)
+	defer t.Stop()
+	select {
+	case <-r.attached:
+		return nil
+	case <-r.halted:
+		return net.ErrClosed
+	case <-t.C:
+		return fmt.Errorf("client did not resume within %s", r.window)
+	}
+}
+
+// attach makes ws the connection, after writing it hello and the frames
+// held for it. A connection still attached is dropped.
+func (r *resumableConn) attach(ws Conn, hello func(replayed, dropped int) []byte) (<-chan struct{}, int, int, error) {
+	if ws.Subprotocol() != r.subprotocol {
+		return nil, 0, 0, ErrResumeMismatch
+	}
+	r.wmu.Lock()
+	defer r.wmu.Unlock()
+	r.mu.Lock()
+	select {
+	case <-r.halted:
+		r.mu.Unlock()
+		return nil, 0, 0, ErrResumeNotFound
+	default:
+	}
+	if old := r.conn; old != nil {
+		old.Close()
+		if r.done != nil {
+			close(r.done)
+		}
+	}
+	pending, dropped := r.pending, r.dropped
+	r.pending, r.pendingBytes, r.dropped = nil, 0, 0
+	if r.limit > 0 {
+		ws.SetReadLimit(r.limit)
+	}
+	ws.SetPongHandler(r.pong)
+	r.conn, r.addr = ws, ws.RemoteAddr()
+	done := make(chan struct{})
+	r.done = done
+	r.mu.Unlock()
+
+	ws.WriteMessage(websocket.TextMessage, hello(len(pending), dropped))
+	for _, m := range pending {
+		if err := ws.WriteMessage(m.typ, m.data); err != nil {
+			break
+		}
+	}
+	select {
+	case r.attached <- struct{}{}:
+	default:
+	}
+	return done, len(pending), dropped, nil
+}
+
+func (r *resumableConn) ReadMessage() (int, []byte, error) {
+	mt, rd, err := r.NextReader()
+	if err != nil {
+		return mt, nil, err
+	}
+	p, err := io.ReadAll(rd)
+	return mt, p, err
+}
+
+// WriteMessage writes to the current connection, or holds the frame for
+// the next one. A failed write counts as losing the connection.
+func (r *resumableConn) WriteMessage(messageType int, data []byte) error {
+	r.wmu.Lock()
+	defer r.wmu.Unlock()
+	r.mu.Lock()
+	c := r.conn
+	r.mu.Unlock()
+	if c != nil {
+		err := c.WriteMessage(messageType, data)
+		if err == nil || !r.resumable(err) {
+			return err
+		}
+		r.detach(c, err)
+	}
+	r.hold(heldFrame{typ: messageType, data: append([]byte(nil), data...)})
+	return nil
+}
+
+func (r *resumableConn) hold(m heldFrame) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+	r.pending = append(r.pending, m)
+	r.pendingBytes += len(m.data)
+	for r.pendingBytes > resumeBufferBytes {
+		r.pendingBytes -= len(r.pending[0].data)
+		r.pending = r.pending[1:]
+		r.dropped++
+	}
+}
+
+// WriteControl goes to the current connection; while detached, pings are
+// skipped and a close message ends the wait for the client.
+func (r *resumableConn) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	r.mu.Lock()
+	c := r.conn
+	r.mu.Unlock()
+	if c != nil {
+		return c.WriteControl(messageType, data, deadline)
+	}
+	if messageType == websocket.CloseMessage {
+		r.halt()
+	}
+	return nil
+}
+
+// SetReadDeadline applies to the current connection; one already passed
+// stops reads, as the session only sets such to stop them.
+func (r *resumableConn) SetReadDeadline(t time.Time) error {
+	if !t.IsZero() && !t.After(time.Now()) {
+		r.halt()
+	}
+	r.mu.Lock()
+	c := r.conn
+	r.mu.Unlock()
+	if c == nil {
+		return nil
+	}
+	return c.SetReadDeadline(t)
+}
+
+func (r *resumableConn) halt() {
+	r.haltOnce.Do(func() { close(r.halted) })
+}
+
+func (r *resumableConn) SetReadLimit(limit int64) {
+	r.mu.Lock()
+	r.limit = limit
+	c := r.conn
+	r.mu.Unlock()
+	if c != nil {
+		c.SetReadLimit(limit)
+	}
+}
+
+func (r *resumableConn) SetPongHandler(h func(appData string) error) {
+	r.mu.Lock()
+	r.pong = h
+	c := r.conn
+	r.mu.Unlock()
+	if c != nil {
+		c.SetPongHandler(h)
+	}
+}
+
+// Close closes the current connection and refuses new ones.
+func (r *resumableConn) Close() error {
+	r.halt()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	r.pending = nil
+	if r.done != nil {
+		close(r.done)
+		r.done = nil
+	}
+	if r.conn == nil {
+		return nil
+	}
+	c := r.conn
+	r.conn = nil
+	return c.Close()
+}
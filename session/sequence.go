@@ -0,0 +1,106 @@
+// session/sequence.go
+package session
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"vad-application/audio"
+	"vad-application/metrics"
+)
+
+// seqHeaderSize is the header sequenced audio frames start with: a
+// big-endian uint32 sequence number, then the capture time as big-endian
+// int64 microseconds since the Unix epoch, zero if unknown.
+const seqHeaderSize = 12
+
+// maxGapFill bounds the silence inserted for one gap, so a client that
+// skips ahead does not stall the backend.
+const maxGapFill = 2 * time.Second
+
+// splitSequenced strips the sequence header from the frame in *buf.
+func splitSequenced(buf *[]byte) (seq uint32, captured time.Time, err error) {
+	b := *buf
+	if len(b) < seqHeaderSize {
+		return 0, time.Time{}, fmt.Errorf("sequenced audio frame of %d bytes lacks its %d-byte header", len(b), seqHeaderSize)
+	}
+	seq = binary.BigEndian.Uint32(b)
+	if us := int64(binary.BigEndian.Uint64(b[4:])); us != 0 {
+		captured = time.UnixMicro(us)
+	}
+	*buf = append(b[:0], b[seqHeaderSize:]...)
+	return seq, captured, nil
+}
+
+// sequencer follows the sequence numbers of a client's audio frames.
+type sequencer struct {
+	started bool
+	next    uint32
+}
+
+// observe notes frame seq and returns how many frames went missing before
+// it, or whether it arrived after a later one, or twice, and comes too late
+// to be used. Numbers wrap around.
+func (q *sequencer) observe(seq uint32) (missing uint32, late bool) {
+	if !q.started {
+		q.started, q.next = true, seq+1
+		return 0, false
+	}
+	d := seq - q.next
+	if d >= 1<<31 {
+		return 0, true
+	}
+	q.next = seq + 1
+	return d, false
+}
+
+// sequenced accounts for a sequenced frame, reporting whether it should be
+// dropped, and how many frames were lost before it.
+func (s *Session) sequenced(seq uint32, captured time.Time, seqs *sequencer) (gap uint32, drop bool) {
+	gap, late := seqs.observe(seq)
+	if late {
+		metrics.SequenceAnomalies.WithLabelValues("late").Inc()
+		if s.stats.late.Add(1) == 1 {
+			s.log.Warn("Dropping audio frames arriving out of order", "seq", seq)
+		}
+		return 0, true
+	}
+	s.stats.lastSeq.Store(int64(seq))
+	if !captured.IsZero() {
+		s.stats.lastCapture.Store(captured.UnixNano())
+	}
+	if gap > 0 {
+		metrics.SequenceAnomalies.WithLabelValues("lost").Add(float64(gap))
+		if s.stats.lost.Add(int64(gap)) == int64(gap) {
+			s.log.Warn("Audio frames lost", "seq", seq, "missing", gap)
+		}
+	}
+	return gap, false
+}
+
+// fillGap runs silence standing in for missing frames through the
+// pipeline and queues it, so the backend's media time stays that of the
+// client. Each frame is assumed as long as the frames before it were on
+// average.
+func (s *Session) fillGap(ctx context.Context, queue *chunkQueue, missing uint32, received time.Time) error {
+	f := audio.Backend
+	frames := s.stats.audioFrames.Load() - 1
+	if frames <= 0 {
+		return nil
+	}
+	frameBytes := int(s.stats.audioReceived.Load()/frames) / f.FrameSize() * f.FrameSize()
+	limit := int(maxGapFill.Seconds()*float64(f.SampleRate)) * f.FrameSize()
+	n := min(int(missing)*frameBytes, limit)
+	if n <= 0 {
+		return nil
+	}
+	pcm, err := s.pipe.Inject(make([]byte, n))
+	if err != nil {
+		// Only the fill is lost.
+		return nil
+	}
+	s.stats.audioReceived.Add(int64(len(pcm)))
+	return s.queueAudio(ctx, queue, pcm, chunk{received: received, ctx: ctx})
+}
@@ -0,0 +1,67 @@
+// session/sequence_test.go
+package session
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestSequencer(t *testing.T) {
+	type step struct {
+		seq     uint32
+		missing uint32
+		late    bool
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"in order", []step{{5, 0, false}, {6, 0, false}, {7, 0, false}}},
+		{"gap", []step{{0, 0, false}, {1, 0, false}, {4, 2, false}, {5, 0, false}}},
+		{"duplicate", []step{{10, 0, false}, {11, 0, false}, {11, 0, true}, {12, 0, false}}},
+		{"reordered", []step{{1, 0, false}, {3, 1, false}, {2, 0, true}, {4, 0, false}}},
+		{"wraparound", []step{{0xfffffffe, 0, false}, {0xffffffff, 0, false}, {0, 0, false}, {1, 0, false}}},
+		{"gap across wraparound", []step{{0xfffffffd, 0, false}, {2, 4, false}}},
+		{"late across wraparound", []step{{0xffffffff, 0, false}, {1, 1, false}, {0xffffffff, 0, true}, {0, 0, true}}},
+		{"first frame any number", []step{{0x80000000, 0, false}, {0x80000001, 0, false}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var q sequencer
+			for i, s := range tt.steps {
+				missing, late := q.observe(s.seq)
+				if missing != s.missing || late != s.late {
+					t.Errorf("step %d: observe(%d) = %d, %v; want %d, %v", i, s.seq, missing, late, s.missing, s.late)
+				}
+			}
+		})
+	}
+}
+
+func TestSplitSequenced(t *testing.T) {
+	captured := time.UnixMicro(1_700_000_000_123_456)
+	frame := binary.BigEndian.AppendUint32(nil, 0xfffffffe)
+	frame = binary.BigEndian.AppendUint64(frame, uint64(captured.UnixMicro()))
+	frame = append(frame, 1, 2, 3, 4)
+
+	buf := frame
+	seq, at, err := splitSequenced(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seq != 0xfffffffe || !at.Equal(captured) || !bytes.Equal(buf, []byte{1, 2, 3, 4}) {
+		t.Errorf("splitSequenced = %d, %v, %v; want %d, %v, [1 2 3 4]", seq, at, buf, uint32(0xfffffffe), captured)
+	}
+
+	buf = []byte{0, 0, 0, 9, 0, 0, 0, 0, 0, 0, 0, 0}
+	if seq, at, err := splitSequenced(&buf); err != nil || seq != 9 || !at.IsZero() || len(buf) != 0 {
+		t.Errorf("header alone = %d, %v, %v, %v; want 9, no capture time, no audio", seq, at, buf, err)
+	}
+
+	buf = make([]byte, seqHeaderSize-1)
+	if _, _, err := splitSequenced(&buf); err == nil {
+		t.Error("splitSequenced took a frame shorter than its header")
+	}
+}
@@ -0,0 +1,1130 @@
+// session/session.go
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"vad-application/audio"
+	"vad-application/events"
+	pb "vad-application/grpc_modules"
+	"vad-application/metrics"
+	"vad-application/pipeline"
+	"vad-application/recording"
+	"vad-application/reporting"
+	"vad-application/tracing"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// gRPC metadata keys set on every ProcessAudio stream.
+const (
+	MetadataSessionID = "x-session-id"
+	MetadataSubject   = "x-user-subject"
+	MetadataTenant    = "x-tenant"
+	MetadataRequestID = "x-request-id"
+)
+
+// WebSocket subprotocols. Audio always arrives in binary frames; they differ
+// in how VAD responses are sent back.
+const (
+	// SubprotocolJSON, the default, sends responses as JSON text frames.
+	// Clients only need to offer it when they also pass a token through
+	// Sec-WebSocket-Protocol.
+	SubprotocolJSON = "vad.json.v1"
+	// SubprotocolBinary sends responses as binary frames holding a
+	// serialized VADResponse. Frames generated by the bridge itself, such
+	// as errors, stay JSON text.
+	SubprotocolBinary = "vad.binary.v1"
+)
+
+// closeGrace bounds how long the close handshake may take once a session ends.
+const closeGrace = time.Second
+
+// levelWindow is how much audio each level in Stats covers when no
+// LevelInterval is set.
+const levelWindow = 100 * time.Millisecond
+
+// failoverTimeout bounds the search for a backend to fail over to.
+const failoverTimeout = 5 * time.Second
+
+// Failover returns a client on another backend once the session's stream to
+// the current one broke.
+type Failover func(ctx context.Context) (pb.VADServiceClient, error)
+
+// Session binds one WebSocket connection to one ProcessAudio stream on the
+// VAD backend. Both directions share a context that is cancelled as soon as
+// either side goes away, so neither pump can outlive the other.
+type Session struct {
+	ID      string
+	Started time.Time
+	// Subject is the authenticated user, if any. It must be set before Run.
+	Subject string
+	// Tenant is the tenant the session belongs to, if any. It must be set
+	// before Run.
+	Tenant string
+	// RequestID is that of the request that opened the session, if any,
+	// passed on to the backend. It must be set before Run.
+	RequestID string
+	// Failover, when set, replaces a backend whose stream broke, up to
+	// Config.FailoverAttempts times. It must be set before Run.
+	Failover Failover
+	// Shadow, when set, receives a copy of the audio; its responses are
+	// recorded and published as Shadow events for comparison, never sent
+	// to the client. It must be set before Run.
+	Shadow pb.VADServiceClient
+	// Fallback, when set, serves the session once no backend can: when
+	// Run is given a nil client, the backend stream cannot be opened, or
+	// failover finds no backend. Its events are tagged SourceFallback. It
+	// must be set before Run.
+	Fallback pb.VADServiceClient
+	// Compare, with Shadow, diffs the speech both backends found once the
+	// session ends and publishes it as a Comparison event.
+	Compare bool
+	// Route labels every published event; see events.Event.
+	Route string
+	// Settings start out as DefaultSettings and may be replaced before Run;
+	// configure messages change them until the session starts.
+	Settings Settings
+	// Encodings, when set, are the only ones configure messages may switch
+	// to. It must be set before Run.
+	Encodings []audio.Encoding
+
+	cfg   Config
+	ws    Conn
+	log   *slog.Logger
+	stats counters
+	// writeMu serializes data frames; control frames need no lock.
+	writeMu sync.Mutex
+	// lastAudio is the UnixNano time of the latest audio frame.
+	lastAudio atomic.Int64
+	// sendLag is how long, in nanoseconds, the latest chunk sent to the
+	// backend had been queued.
+	sendLag atomic.Int64
+	// chunkRTT is the latest chunk latency measured, in nanoseconds.
+	chunkRTT atomic.Int64
+	// lateUntil is the UnixNano time until which backend responses are
+	// for audio held during an outage.
+	lateUntil atomic.Int64
+	// pipe processes the client's audio for the backend; nil until the
+	// first audio frame.
+	pipe *pipeline.Chain
+	// rec records the audio sent to the backend; nil when not recording.
+	rec *recording.Recording
+	// shadow feeds runShadow; nil without a Shadow client.
+	shadow chan []byte
+	// speech measures the speech the backend reported, and shadowSpeech
+	// that of the shadow backend.
+	speech       speechTracker
+	shadowSpeech speechTracker
+	// segments collects the audio of speech segments, nil without a
+	// Transcriber or Clips, and transcripts queues them for transcribe,
+	// nil without a Transcriber.
+	segments    *segmentAudio
+	transcripts chan segment
+	// turns queues transcripts for converse; nil without an Assistant.
+	turns chan string
+	// cancelReply stops the assistant reply being generated; nil between
+	// replies.
+	replyMu     sync.Mutex
+	cancelReply context.CancelCauseFunc
+	// wake holds audio back until the wake word fires; nil without a
+	// WakeWord client.
+	wake *wakeGate
+	// player queues speech for the client; nil without a Synthesizer.
+	player *player
+	// resume is ws when the client may resume the session on a new
+	// connection, and nil otherwise.
+	resume *resumableConn
+
+	// recent holds the latest events published, as a ring starting at
+	// recentNext once full.
+	recentMu   sync.Mutex
+	recent     []events.Event
+	recentNext int
+
+	// started is closed once the client starts streaming; Settings are
+	// fixed from then on.
+	started   chan struct{}
+	startOnce sync.Once
+	// paused makes the reader discard audio.
+	paused atomic.Bool
+
+	// fallback is set while the session streams to its Fallback client.
+	fallback atomic.Bool
+
+	// draining is set by Drain: the client stops being read, but events
+	// still in flight from the backend are delivered before closing.
+	draining atomic.Bool
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	// client is the backend the session currently streams to.
+	client      pb.VADServiceClient
+	closed      bool
+	stopReading bool
+	// closeCode and closeReason, when set, override the close frame sent
+	// at the end of Run.
+	closeCode   int
+	closeReason string
+}
+
+// New wraps an upgraded WebSocket connection and assigns it a fresh ID.
+// Every entry the session logs carries the attributes of logger plus the
+// session ID.
+func New(ws Conn, cfg Config, logger *slog.Logger) *Session {
+	id := uuid.NewString()
+	s := &Session{
+		ID:       id,
+		Started:  time.Now(),
+		cfg:      cfg,
+		ws:       ws,
+		log:      logger.With("session_id", id),
+		started:  make(chan struct{}),
+		Settings: DefaultSettings(),
+	}
+	if cfg.Synthesizer != nil {
+		s.player = &player{queue: make(chan utterance, playbackQueueSize)}
+	}
+	// Other connections end along with the request they came in, so only
+	// WebSocket sessions outlive theirs.
+	if _, ok := ws.(*websocket.Conn); ok && cfg.ResumeWindow > 0 {
+		s.resume = newResumableConn(ws, cfg.ResumeWindow, s.log)
+		s.ws = s.resume
+	}
+	s.lastAudio.Store(s.Started.UnixNano())
+	s.stats.level.Store(math.Float64bits(audio.FloorDBFS))
+	return s
+}
+
+// Logger returns the session's logger.
+func (s *Session) Logger() *slog.Logger {
+	return s.log
+}
+
+// RemoteAddr returns the client's address.
+func (s *Session) RemoteAddr() net.Addr {
+	return s.ws.RemoteAddr()
+}
+
+// Stats returns a snapshot of the session's traffic counters.
+func (s *Session) Stats() Stats {
+	return Stats{
+		ID:            s.ID,
+		Started:       s.Started,
+		BytesIn:       s.stats.bytesIn.Load(),
+		BytesOut:      s.stats.bytesOut.Load(),
+		DroppedChunks: s.stats.dropped.Load(),
+		LostChunks:    s.stats.lost.Load(),
+		LateChunks:    s.stats.late.Load(),
+		Events:        s.stats.eventCounts(),
+		LevelDBFS:     math.Round(math.Float64frombits(s.stats.level.Load())*10) / 10,
+		Speaking:      s.stats.speaking.Load(),
+	}
+}
+
+// Run opens a ProcessAudio stream once the client starts streaming, and pumps
+// audio and VAD events until the client or the backend closes. It returns
+// once both pumps have exited. A nil client makes it use Fallback.
+func (s *Session) Run(ctx context.Context, client pb.VADServiceClient) {
+	defer s.recoverPanic("session")
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if !s.setCancel(cancel) {
+		return
+	}
+	if s.resume != nil {
+		defer s.resume.Close()
+		s.sendResumable()
+	}
+
+	s.log.Info("Session started")
+	metrics.ActiveSessions.Inc()
+	defer metrics.ActiveSessions.Dec()
+	defer func() {
+		st := s.Stats()
+		s.log.Info("Session ended",
+			"duration", time.Since(s.Started).Round(time.Millisecond).String(),
+			"bytes_in", st.BytesIn, "bytes_out", st.BytesOut,
+			"dropped_chunks", st.DroppedChunks, "events", st.Events)
+	}()
+
+	ctx, span := tracing.Tracer().Start(ctx, "vad.session", trace.WithAttributes(
+		attribute.String("session.id", s.ID),
+		attribute.String("client.address", s.ws.RemoteAddr().String()),
+	))
+	defer span.End()
+
+	ws := s.ws
+	if s.cfg.MaxMessageBytes > 0 {
+		ws.SetReadLimit(s.cfg.MaxMessageBytes)
+	}
+	ws.SetPongHandler(func(string) error {
+		s.extendReadDeadline()
+		return nil
+	})
+	s.extendReadDeadline()
+
+	var wg sync.WaitGroup
+	// opened is set once the backend stream is open.
+	var opened bool
+	// transcribed is closed once every segment has been transcribed.
+	transcribed := make(chan struct{})
+	compare := s.Compare && s.Shadow != nil
+	s.speech.keep, s.shadowSpeech.keep = compare, compare
+	defer func() {
+		cancel()
+		wg.Wait()
+		if opened && compare {
+			s.publishDiff()
+		}
+		s.rec.Close()
+		if opened {
+			s.publishEnd()
+		}
+	}()
+	if s.cfg.PingInterval > 0 || s.cfg.IdleTimeout > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer s.recoverPanic("keepalive")
+			s.keepalive(ctx)
+		}()
+	}
+	if s.player != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer s.recoverPanic("play")
+			s.play(ctx)
+		}()
+	}
+
+	// The reader runs from the start so that configure messages can arrive
+	// before the backend stream is opened; audio queues up meanwhile.
+	queue := newChunkQueue(s.cfg.QueueSize, s.cfg.QueuePolicy, s.dropped)
+	readerDone := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(readerDone)
+		defer s.recoverPanic("read")
+		stopped := s.readClient(ctx, queue)
+		if err := s.flushPipeline(ctx, queue); err != nil {
+			s.log.Debug("Last audio frame not queued", "err", err)
+		}
+		queue.close()
+		// The client is gone: nobody is left to read the remaining events.
+		// After a stop request or when draining, the backend is instead
+		// given the chance to flush.
+		if !stopped && !s.draining.Load() {
+			cancel()
+		}
+	}()
+
+	select {
+	case <-s.started:
+	case <-readerDone:
+	case <-ctx.Done():
+	}
+	if !s.hasStarted() {
+		s.sendClose(s.closeStatus())
+		s.haltReads()
+		return
+	}
+
+	// Let the backend correlate its logs and traces with ours.
+	ctx = metadata.AppendToOutgoingContext(ctx, MetadataSessionID, s.ID)
+	if s.Subject != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, MetadataSubject, s.Subject)
+	}
+	if s.Tenant != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, MetadataTenant, s.Tenant)
+	}
+	if s.RequestID != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, MetadataRequestID, s.RequestID)
+	}
+	ctx = metadata.AppendToOutgoingContext(ctx, s.Settings.Metadata()...)
+	ctx = tracing.Inject(ctx)
+	replay := newReplayBuffer(s.cfg.FailoverReplay)
+	backlog := newOutageBacklog(s.cfg.OutageBuffer, func() { s.stats.dropped.Add(1) })
+	defer backlog.discard()
+	if client == nil {
+		client = s.useFallback(nil, errNoBackend)
+	}
+	for failovers := 0; ; failovers++ {
+		if client == nil {
+			s.Fail(CodeBackendUnavailable, errNoBackend)
+			s.end(websocket.CloseNormalClosure, "")
+			break
+		}
+		timeout := s.cfg.DialTimeout
+		outage := backlog.filling()
+		if outage {
+			timeout = s.outageTimeout(backlog)
+		}
+		stream, cancelStream, err := s.dial(ctx, client, timeout)
+		backlog.halt()
+		if err == nil && outage {
+			s.recovered(backlog)
+		}
+		if err != nil && ctx.Err() == nil {
+			if next := s.useFallback(client, err); next != nil {
+				client = next
+				continue
+			}
+		}
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(otelcodes.Error, "backend stream error")
+			s.Fail(CodeBackendStreamError, err)
+			if !opened {
+				s.end(websocket.CloseNormalClosure, "")
+			}
+			break
+		}
+		s.mu.Lock()
+		s.client = client
+		s.mu.Unlock()
+		s.fallback.Store(s.Fallback != nil && client == s.Fallback)
+		if !opened {
+			opened = true
+			s.streamOpened()
+			if s.cfg.HeartbeatInterval > 0 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					defer s.recoverPanic("heartbeat")
+					s.heartbeat(ctx, queue)
+				}()
+			}
+			if s.Shadow != nil {
+				s.shadow = make(chan []byte, shadowQueueSize)
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					defer s.recoverPanic("shadow")
+					s.runShadow(ctx, s.shadow)
+				}()
+			}
+			if s.cfg.WakeWord != nil {
+				s.wake = newWakeGate(s.cfg.WakeWindow, s.cfg.WakePreroll)
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					defer s.recoverPanic("wake")
+					s.runWake(ctx, s.wake.audio)
+				}()
+			}
+			if s.cfg.Transcriber != nil || len(s.cfg.Clips) > 0 {
+				preroll := s.cfg.TranscribePreroll
+				if s.Settings.PrerollMS != 0 {
+					preroll = time.Duration(s.Settings.PrerollMS) * time.Millisecond
+				}
+				s.segments = newSegmentAudio(preroll, s.cfg.MaxTranscribed)
+			}
+			if s.cfg.Transcriber != nil {
+				s.transcripts = make(chan segment, transcriptQueueSize)
+				if s.cfg.Assistant != nil {
+					s.turns = make(chan string, turnQueueSize)
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						defer s.recoverPanic("assistant")
+						s.converse(ctx, s.turns)
+					}()
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					defer close(transcribed)
+					if s.turns != nil {
+						defer close(s.turns)
+					}
+					defer s.recoverPanic("transcribe")
+					s.transcribe(ctx, s.transcripts)
+				}()
+			}
+		}
+		err = s.pump(ctx, stream, queue, replay, backlog, failovers > 0)
+		cancelStream()
+		if err == nil {
+			break
+		}
+		span.RecordError(err)
+		// Audio keeps coming while another stream is sought.
+		buffering := ctx.Err() == nil && recoverable(err) && !errors.Is(err, errStreamDeadline) &&
+			s.bufferOutage(backlog, queue, err)
+		if next := s.failover(ctx, err, failovers); next != nil {
+			client = next
+			continue
+		}
+		if buffering {
+			// The backend that just broke is unlikely to be back at once.
+			select {
+			case <-time.After(dialBaseDelay):
+			case <-ctx.Done():
+			}
+			continue
+		}
+		if ctx.Err() == nil && recoverable(err) && !errors.Is(err, errStreamDeadline) {
+			if next := s.useFallback(client, err); next != nil {
+				client = next
+				continue
+			}
+		}
+		span.SetStatus(otelcodes.Error, "backend stream error")
+		if errors.Is(err, errStreamDeadline) {
+			s.Fail(CodeBackendStreamDeadline, fmt.Errorf("backend stream reached its %s deadline", s.cfg.StreamDeadline))
+		} else {
+			s.Fail(CodeBackendStreamError, err)
+		}
+		break
+	}
+	if s.shadow != nil {
+		close(s.shadow)
+	}
+	if s.wake != nil {
+		close(s.wake.audio)
+	}
+	// Speech still open when the audio ended is clipped and transcribed
+	// too.
+	if s.segments != nil && s.speech.open {
+		s.segmentEvent(eventSpeechEnd, &events.SpeechSegment{Start: s.speech.since, End: s.audioOffset()})
+	}
+	if s.transcripts != nil {
+		close(s.transcripts)
+		select {
+		case <-transcribed:
+		case <-ctx.Done():
+		case <-time.After(transcriptGrace):
+		}
+	}
+	// Nothing will send the audio still queued.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		queue.discard()
+	}()
+	cancel()
+
+	// Unblock the read pump if the backend side ended first.
+	s.sendClose(s.closeStatus())
+	s.haltReads()
+}
+
+// streamOpened runs once the first backend stream is open.
+func (s *Session) streamOpened() {
+	s.publish(events.Event{Kind: events.SessionStart})
+	if s.cfg.Recorder != nil {
+		var err error
+		s.rec, err = s.cfg.Recorder.Open(recording.Meta{SessionID: s.ID, Subject: s.Subject, Started: s.Started}, audio.Backend)
+		if err != nil {
+			s.log.Warn("Recording not started", "err", err)
+		}
+	}
+}
+
+// pump runs one backend stream: queued audio goes out, preceded by the
+// replay buffer when resumed after a failover and by the audio held during
+// an outage, and events come back until either side ends it. It returns the
+// error that broke the stream, if any, leaving unsent audio queued.
+func (s *Session) pump(ctx context.Context, stream pb.VADService_ProcessAudioClient, queue *chunkQueue, replay *replayBuffer, backlog *outageBacklog, resumed bool) error {
+	var acks *ackTracker
+	if s.cfg.ChunkAcks {
+		acks = &ackTracker{}
+	}
+	sendCtx, stopSending := context.WithCancel(ctx)
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		defer s.recoverPanic("send")
+		s.sendAudio(sendCtx, stream, queue, replay, backlog, resumed, acks)
+	}()
+	err := s.forwardEvents(ctx, stream, resumed, acks)
+	stopSending()
+	<-sent
+	return err
+}
+
+// failover asks for a client on another backend once err broke the stream,
+// or returns nil if the session cannot fail over.
+func (s *Session) failover(ctx context.Context, err error, attempt int) pb.VADServiceClient {
+	if s.Failover == nil || attempt >= s.cfg.FailoverAttempts || ctx.Err() != nil || !recoverable(err) {
+		return nil
+	}
+	if errors.Is(err, errStreamDeadline) {
+		s.log.Info("Backend stream reached its deadline; reopening", "attempt", attempt+1, "deadline", s.cfg.StreamDeadline.String())
+	} else {
+		s.log.Warn("Backend stream failed; failing over", "attempt", attempt+1, "err", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, failoverTimeout)
+	defer cancel()
+	client, err := s.Failover(ctx)
+	if err != nil {
+		metrics.BackendFailovers.WithLabelValues("failed").Inc()
+		s.log.Warn("No backend to fail over to", "err", err)
+		return nil
+	}
+	metrics.BackendFailovers.WithLabelValues("ok").Inc()
+	return client
+}
+
+// recoverable reports whether a stream error is worth failing over for:
+// the backend broke, rather than rejecting the audio, or the stream reached
+// its deadline.
+func recoverable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.Aborted, codes.Internal, codes.Unknown:
+		return true
+	}
+	// A fresh stream picks up where one that ran out of time left off.
+	return errors.Is(err, errStreamDeadline)
+}
+
+// closeStatus picks the close frame sent when Run ends.
+func (s *Session) closeStatus() (int, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case s.closeCode != 0:
+		return s.closeCode, s.closeReason
+	case s.draining.Load():
+		return websocket.CloseGoingAway, "server shutting down"
+	default:
+		return websocket.CloseNormalClosure, ""
+	}
+}
+
+func (s *Session) setCancel(cancel context.CancelFunc) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.cancel = cancel
+	return true
+}
+
+// Drain stops reading audio from the client and half-closes the backend
+// stream. Run returns once the backend has flushed its remaining events.
+// The client is told first, so it can reconnect elsewhere.
+func (s *Session) Drain() {
+	s.drain(ErrDraining)
+}
+
+// drain drains the session, telling the client err.
+func (s *Session) drain(err error) {
+	s.draining.Store(true)
+	s.sendError(CodeShuttingDown, err)
+	s.haltReads()
+}
+
+// Close aborts the session immediately.
+func (s *Session) Close() {
+	s.end(0, "")
+}
+
+// Terminate closes the session on an operator's behalf, telling the client
+// why.
+func (s *Session) Terminate(reason string) {
+	s.log.Info("Session terminated", "reason", reason)
+	s.sendError(CodeTerminated, errors.New(reason))
+	s.end(websocket.ClosePolicyViolation, "terminated")
+}
+
+// OverQuota ends the session as its caller used up an audio quota, telling
+// the client when it may come back.
+func (s *Session) OverQuota(err error, retryAfter time.Duration) {
+	s.log.Info("Session over quota", "err", err)
+	frame := newErrorFrame(CodeQuotaExceeded, err)
+	frame.SessionID = s.ID
+	frame.RetryAfter = int(retryAfter.Round(time.Second).Seconds())
+	if werr := s.writeJSON(frame); werr != nil {
+		s.log.Warn("WS write error", "err", werr)
+	}
+	s.end(websocket.CloseTryAgainLater, "quota exceeded")
+}
+
+// end aborts the session. A non-zero code chooses the close frame sent to
+// the client unless an earlier call already did.
+func (s *Session) end(code int, reason string) {
+	s.mu.Lock()
+	s.closed = true
+	if s.closeCode == 0 {
+		s.closeCode, s.closeReason = code, reason
+	}
+	cancel := s.cancel
+	s.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	s.haltReads()
+}
+
+// haltReads makes the pending and any future WebSocket read fail at once.
+func (s *Session) haltReads() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopReading = true
+	s.ws.SetReadDeadline(time.Now())
+}
+
+// readClient queues audio frames from the WebSocket and acts on control
+// messages until the client stops sending, the session is told to stop
+// reading, or the queue rejects a frame. It reports whether the client
+// asked to stop.
+func (s *Session) readClient(ctx context.Context, queue *chunkQueue) (stopped bool) {
+	tracer := tracing.Tracer()
+	var (
+		wav   wavStream
+		meter audio.Meter
+		seqs  sequencer
+	)
+	// Levels are measured for every LevelInterval of audio, and reported
+	// to the client when it is set.
+	window := s.cfg.LevelInterval
+	if window <= 0 {
+		window = levelWindow
+	}
+	levelSamples := int(window.Seconds() * float64(audio.Backend.SampleRate))
+	for {
+		mt, r, err := s.ws.NextReader()
+		if err != nil {
+			s.logReadError(err)
+			return false
+		}
+		buf := getBuffer()
+		err = readFrame(r, buf)
+		received := time.Now()
+		if err != nil {
+			putBuffer(buf)
+			s.logReadError(err)
+			return false
+		}
+		s.extendReadDeadline()
+
+		if mt == websocket.TextMessage {
+			stop, err := s.handleControl(ctx, *buf, queue)
+			putBuffer(buf)
+			if err != nil {
+				s.queueFailed(queue, err)
+				return false
+			}
+			if stop {
+				return true
+			}
+			continue
+		}
+
+		size := len(*buf)
+		var gap uint32
+		if s.Settings.Sequenced {
+			seq, captured, err := splitSequenced(buf)
+			if err != nil {
+				putBuffer(buf)
+				s.rejectFrame(websocket.CloseInvalidFramePayloadData, err)
+				return false
+			}
+			var drop bool
+			if gap, drop = s.sequenced(seq, captured, &seqs); drop {
+				s.stats.bytesIn.Add(int64(size))
+				putBuffer(buf)
+				continue
+			}
+		}
+		found, err := wav.unwrap(buf)
+		if err == nil && found != nil {
+			s.log.Info("Audio format taken from WAV header", "format", found.String())
+			err = s.Settings.Options().Validate(*found)
+			if err == nil && !s.hasStarted() {
+				// This is the format the client declared, as far as the
+				// backend is told.
+				s.Settings.Format = *found
+			}
+		}
+		if err != nil {
+			putBuffer(buf)
+			s.Fail(CodeUnsupportedFormat, err)
+			s.end(websocket.CloseUnsupportedData, "unsupported audio format")
+			return false
+		}
+		data := *buf
+		format := wav.format(s.Settings.Format)
+		if !wav.active {
+			if err := checkAudioFrame(data, format); err != nil {
+				putBuffer(buf)
+				s.rejectFrame(websocket.CloseInvalidFramePayloadData, err)
+				return false
+			}
+		}
+		s.lastAudio.Store(received.UnixNano())
+		s.stats.bytesIn.Add(int64(size))
+		s.stats.audioFrames.Add(1)
+		if len(data) == 0 {
+			// Only header bytes, or part of a sample.
+			putBuffer(buf)
+			continue
+		}
+		s.start()
+		if s.pipe == nil {
+			// Settings are final now that the session has started.
+			p := pipeline.Params{Format: format, Options: s.Settings.Options(), Config: s.cfg.Pipeline}
+			if s.Settings.DTMF {
+				p.OnDTMF = s.dtmf
+			}
+			pipe, err := pipeline.New(p)
+			if err != nil {
+				putBuffer(buf)
+				s.Fail(CodeUnsupportedFormat, err)
+				s.end(websocket.CloseUnsupportedData, "unsupported audio format")
+				return false
+			}
+			s.pipe = pipe
+		}
+		if s.paused.Load() {
+			putBuffer(buf)
+			continue
+		}
+		if gap > 0 && s.cfg.FillGaps {
+			if err := s.fillGap(ctx, queue, gap, received); err != nil {
+				putBuffer(buf)
+				s.queueFailed(queue, err)
+				return false
+			}
+		}
+		// The pipeline may hand back buf itself, so it is released only
+		// once queueAudio has copied what it holds.
+		data, err = s.pipe.Process(data)
+		if err != nil {
+			putBuffer(buf)
+			s.undecodable(err)
+			continue
+		}
+		if len(data) == 0 {
+			// A stage, such as the resampler, is still filling up.
+			putBuffer(buf)
+			continue
+		}
+		s.stats.audioReceived.Add(int64(len(data)))
+
+		meter.Write(data)
+		if meter.Samples() >= levelSamples {
+			rms, peak := meter.Level()
+			s.stats.level.Store(math.Float64bits(audio.DBFS(rms)))
+			if s.cfg.LevelInterval > 0 {
+				s.sendLevel(rms, peak)
+			}
+			meter.Reset()
+		}
+
+		chunkCtx, chunkSpan := tracer.Start(ctx, "ws.receive", trace.WithTimestamp(received),
+			trace.WithAttributes(attribute.Int("audio.bytes", len(data))))
+		c := chunk{received: received, ctx: chunkCtx, span: chunkSpan}
+		err = s.queueAudio(ctx, queue, data, c)
+		putBuffer(buf)
+		if err != nil {
+			s.queueFailed(queue, err)
+			return false
+		}
+	}
+}
+
+// queueFailed handles a chunk the send queue would not take.
+func (s *Session) queueFailed(queue *chunkQueue, err error) {
+	if errors.Is(err, errQueueFull) {
+		s.log.Warn("Closing session: send queue full", "queue_size", cap(queue.ch))
+		s.sendError(CodeBackendOverloaded, err)
+		s.end(websocket.CloseTryAgainLater, "backend overloaded")
+	}
+}
+
+// sendAudio forwards queued audio to gRPC until ctx is done, or the queue is
+// closed and the stream is half-closed so the backend sees end of input.
+// A resumed stream first gets the replay buffer, then the audio held during
+// an outage, sent as fast as the stream takes it.
+func (s *Session) sendAudio(ctx context.Context, stream pb.VADService_ProcessAudioClient, queue *chunkQueue, replay *replayBuffer, backlog *outageBacklog, resumed bool, acks *ackTracker) {
+	defer stream.CloseSend()
+	tracer := tracing.Tracer()
+	// gRPC has marshalled the message by the time Send returns, so both it
+	// and the chunk's buffer can be reused for the next chunk.
+	msg := &pb.AudioChunk{}
+	if s.cfg.StreamConfig {
+		if err := stream.Send(&pb.AudioChunk{Config: s.Settings.StreamConfig()}); err != nil {
+			return
+		}
+	}
+	if resumed {
+		for _, data := range replay.chunks {
+			msg.AudioData = data
+			if err := stream.Send(msg); err != nil {
+				return
+			}
+			acks.sent(time.Now())
+		}
+		msg.AudioData = nil
+	}
+	var pace *pacer
+	if s.cfg.Pipeline.Framed() {
+		pace = newPacer(s.cfg.Pipeline.FrameDuration, s.cfg.JitterBuffer)
+	}
+	overrun := false
+	catchingUp := false
+	defer func() {
+		if catchingUp {
+			s.caughtUp()
+		}
+	}()
+	for {
+		c, held := backlog.pop()
+		if held && !catchingUp {
+			catchingUp = true
+			s.catchUp()
+		}
+		if !held && catchingUp {
+			catchingUp = false
+			s.caughtUp()
+		}
+		ok := held
+		if !held {
+			c, ok = queue.pop(ctx)
+		}
+		if !ok {
+			return
+		}
+		if c.flushed != nil {
+			c.done()
+			continue
+		}
+		if lag := time.Since(c.received); !held && s.cfg.LatencyBudget > 0 && lag > s.cfg.LatencyBudget {
+			// Real-time mode: late audio only delays the results for the
+			// audio behind it, so skip it and tell the client once per burst.
+			c.span.SetAttributes(attribute.Bool("audio.dropped", true))
+			c.done()
+			s.stats.dropped.Add(1)
+			metrics.DroppedChunks.WithLabelValues("realtime").Inc()
+			if !overrun {
+				overrun = true
+				s.sendOverrun(lag)
+			}
+			continue
+		}
+		overrun = false
+
+		if s.wake != nil {
+			pass, shut := s.wake.pass(time.Now())
+			if shut {
+				s.log.Debug("Wake-word window over; holding audio back")
+				s.sendWake(wakeClosed, "")
+			}
+			if !pass {
+				s.wake.hold(c.data)
+				c.done()
+				continue
+			}
+			for _, data := range s.wake.release() {
+				replay.add(data)
+				msg.AudioData = data
+				err := stream.Send(msg)
+				msg.AudioData = nil
+				if err != nil {
+					c.done()
+					return
+				}
+				s.forwarded(data)
+			}
+		}
+
+		if !held && !pace.wait(ctx) {
+			c.done()
+			return
+		}
+		// A chunk whose send fails is replayed on the next stream.
+		replay.add(c.data)
+		_, sendSpan := tracer.Start(c.ctx, "grpc.send")
+		msg.AudioData = c.data
+		err := stream.Send(msg)
+		msg.AudioData = nil
+		if err != nil {
+			sendSpan.RecordError(err)
+			sendSpan.SetStatus(otelcodes.Error, "send failed")
+		}
+		sendSpan.End()
+		if err == nil {
+			acks.sent(c.received)
+			s.forwarded(c.data)
+		}
+		c.done()
+		if err != nil {
+			// The real cause is reported by Recv.
+			return
+		}
+		lag := time.Since(c.received)
+		s.sendLag.Store(int64(lag))
+		metrics.ChunkForwardLatency.Observe(lag.Seconds())
+	}
+}
+
+// forwarded accounts for audio the backend received.
+func (s *Session) forwarded(data []byte) {
+	s.rec.Write(data)
+	s.mirror(data)
+	s.segments.write(data)
+	s.stats.audioSent.Add(int64(len(data)))
+	metrics.AudioBytes.Add(float64(len(data)))
+}
+
+// dropped records a chunk discarded by the send queue.
+func (s *Session) dropped() {
+	if s.stats.dropped.Add(1) == 1 {
+		s.log.Warn("Backend is not keeping up; dropping oldest audio", "queue_size", s.cfg.QueueSize)
+	}
+}
+
+// undecodable skips a frame the converter rejected. The client hears about
+// the first one only; a lossy network may corrupt many.
+func (s *Session) undecodable(err error) {
+	metrics.InvalidFrames.WithLabelValues("undecodable").Inc()
+	if s.stats.undecodable.Add(1) == 1 {
+		s.log.Warn("Skipping undecodable audio", "err", err)
+		s.sendError(CodeUndecodableAudio, err)
+	}
+}
+
+// checkAudioFrame validates an inbound audio frame before it is forwarded.
+func checkAudioFrame(data []byte, f audio.Format) error {
+	if len(data) == 0 {
+		return errors.New("empty audio frame")
+	}
+	if n := f.FrameSize(); n > 0 && len(data)%n != 0 {
+		return fmt.Errorf("audio frame of %d bytes is not a whole number of %s samples", len(data), f)
+	}
+	return nil
+}
+
+// rejectFrame closes a session whose client sent a malformed frame.
+func (s *Session) rejectFrame(closeCode int, err error) {
+	metrics.InvalidFrames.WithLabelValues("malformed").Inc()
+	s.log.Warn("Closing session: invalid frame", "err", err)
+	s.sendError(CodeInvalidFrame, err)
+	s.end(closeCode, err.Error())
+}
+
+// logReadError reports why the client stopped being read, unless the
+// session stopped it on purpose.
+func (s *Session) logReadError(err error) {
+	s.mu.Lock()
+	stopped := s.stopReading
+	s.mu.Unlock()
+
+	var netErr net.Error
+	switch {
+	case stopped,
+		websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway):
+	case errors.Is(err, websocket.ErrReadLimit):
+		metrics.InvalidFrames.WithLabelValues("too_large").Inc()
+		s.log.Warn("Closing session: message exceeds read limit", "limit", s.cfg.MaxMessageBytes)
+	case errors.As(err, &netErr) && netErr.Timeout():
+		s.log.Info("Client stopped answering pings")
+	default:
+		s.log.Warn("WS read error", "err", err)
+		var ce *websocket.CloseError
+		if errors.As(err, &ce) && ce.Code != websocket.CloseNoStatusReceived && ce.Code != websocket.CloseAbnormalClosure {
+			s.cfg.Errors.Capture(reporting.Event{
+				Level:   reporting.LevelWarning,
+				Message: fmt.Sprintf("Client closed the session with code %d", ce.Code),
+				Err:     err,
+				Tags:    s.reportTags("close_code", strconv.Itoa(ce.Code)),
+				Subject: s.Subject,
+			})
+		}
+	}
+}
+
+// forwardEvents sends VAD responses back to the browser. It returns the
+// error that broke the stream, or nil if it ended or the client went away.
+func (s *Session) forwardEvents(ctx context.Context, stream pb.VADService_ProcessAudioClient, resumed bool, acks *ackTracker) error {
+	tracer := tracing.Tracer()
+	// The replayed audio may make a new backend repeat a speech start the
+	// client has already seen.
+	skipStart := resumed && s.speech.open
+	for {
+		_, recvSpan := tracer.Start(ctx, "grpc.recv")
+		resp, err := stream.Recv()
+		if err != nil && err != io.EOF {
+			recvSpan.RecordError(err)
+		}
+		recvSpan.SetAttributes(attribute.String("vad.event", resp.GetEvent()))
+		recvSpan.End()
+
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			// Cancellation means the client left first; nothing to report.
+			if ctx.Err() != nil || status.Code(err) == codes.Canceled {
+				return nil
+			}
+			metrics.StreamErrors.WithLabelValues(status.Code(err).String()).Inc()
+			return err
+		}
+		received := time.Now()
+		s.log.Debug("Received VAD response", "event", resp.GetEvent())
+		latency, acked := s.observeAck(acks)
+		if acked && resp.GetEvent() == eventContinue {
+			// Acknowledgements are for the bridge only.
+			continue
+		}
+		if skipStart {
+			skipStart = false
+			if resp.GetEvent() == eventSpeechStart {
+				continue
+			}
+		}
+		s.rec.Event(resp.GetEvent(), resp.GetMessage())
+		seg := s.speech.observe(resp.GetEvent(), s.audioOffset())
+		s.stats.speaking.Store(s.speech.open)
+		s.wake.observe(resp.GetEvent(), received)
+		if s.cfg.BargeIn && resp.GetEvent() == eventSpeechStart {
+			s.bargeIn()
+		}
+		s.segmentEvent(resp.GetEvent(), seg)
+		late := s.late()
+		s.publish(events.Event{Kind: events.VAD, Event: resp.GetEvent(), Message: resp.GetMessage(), Late: late})
+		if seg != nil {
+			s.publish(events.Event{Kind: events.Segment, Segment: seg, Late: late})
+		}
+		s.stats.addEvent(resp.GetEvent())
+		metrics.Events.WithLabelValues(resp.GetEvent()).Inc()
+
+		_, writeSpan := tracer.Start(ctx, "ws.write")
+		if !s.cfg.EchoLatency {
+			acked = false
+		}
+		err = s.writeResponse(resp, received, latency, acked, late)
+		writeSpan.End()
+		if err != nil {
+			if !errors.Is(err, websocket.ErrCloseSent) {
+				s.log.Warn("WS write error", "err", err)
+			}
+			return nil
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// session/shadow.go
+package session
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"vad-application/events"
+	pb "vad-application/grpc_modules"
+	"vad-application/metrics"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Shadow stream limits: how many chunks may wait for it before new ones are
+// dropped, and how long it may take to flush once the session's audio ends.
+const (
+	shadowQueueSize = 64
+	shadowGrace     = 2 * time.Second
+)
+
+// mirror hands a copy of audio sent to the primary backend to the shadow
+// stream. It never blocks, so a slow shadow cannot hold the session back.
+func (s *Session) mirror(data []byte) {
+	if s.shadow == nil {
+		return
+	}
+	select {
+	case s.shadow <- append([]byte(nil), data...):
+	default:
+		metrics.DroppedChunks.WithLabelValues("shadow").Inc()
+	}
+}
+
+// runShadow streams the mirrored audio to the shadow backend until the
+// channel closes, recording and publishing its responses as Shadow events.
+// Its failures are logged and never reach the client.
+func (s *Session) runShadow(ctx context.Context, audio <-chan []byte) {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+	stream, err := s.Shadow.ProcessAudio(ctx)
+	if err != nil {
+		s.log.Warn("Shadow stream not opened", "err", err)
+		for range audio {
+		}
+		return
+	}
+	received := make(chan struct{})
+	go func() {
+		defer close(received)
+		defer s.recoverPanic("shadow")
+		for {
+			resp, err := stream.Recv()
+			if err != nil {
+				if err != io.EOF && status.Code(err) != codes.Canceled {
+					s.log.Warn("Shadow stream failed", "err", err)
+				}
+				return
+			}
+			s.shadowSpeech.observe(resp.GetEvent(), seconds(s.stats.shadowSent.Load()))
+			s.rec.ShadowEvent(resp.GetEvent(), resp.GetMessage())
+			s.publish(events.Event{Kind: events.Shadow, Event: resp.GetEvent(), Message: resp.GetMessage()})
+		}
+	}()
+	msg := &pb.AudioChunk{}
+	for data := range audio {
+		msg.AudioData = data
+		if stream.Send(msg) != nil {
+			// Recv reports why.
+			for range audio {
+			}
+			break
+		}
+		s.stats.shadowSent.Add(int64(len(data)))
+	}
+	stream.CloseSend()
+	timer := time.AfterFunc(shadowGrace, cancel)
+	<-received
+	timer.Stop()
+}
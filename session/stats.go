@@ -0,0 +1,78 @@
+// session/stats.go
+package session
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a point-in-time snapshot of a session's traffic.
+type Stats struct {
+	ID       string    `json:"id"`
+	Started  time.Time `json:"started"`
+	BytesIn  int64     `json:"bytes_in"`
+	BytesOut int64     `json:"bytes_out"`
+	// DroppedChunks counts audio chunks discarded because the backend fell
+	// behind.
+	DroppedChunks int64 `json:"dropped_chunks"`
+	// LostChunks and LateChunks count sequenced frames that never arrived,
+	// and that arrived out of order and were dropped.
+	LostChunks int64            `json:"lost_chunks"`
+	LateChunks int64            `json:"late_chunks"`
+	Events     map[string]int64 `json:"events"`
+	// LevelDBFS is the RMS level of the latest audio, and Speaking whether
+	// the backend is hearing speech.
+	LevelDBFS float64 `json:"level_dbfs"`
+	Speaking  bool    `json:"speaking"`
+}
+
+// counters accumulates traffic for a live session.
+type counters struct {
+	bytesIn  atomic.Int64
+	bytesOut atomic.Int64
+	dropped  atomic.Int64
+	// audioSent counts bytes of converted audio sent to the backend, and
+	// shadowSent those sent to the shadow backend.
+	audioSent  atomic.Int64
+	shadowSent atomic.Int64
+	// audioFrames counts audio frames received from the client, and
+	// audioReceived the bytes of converted audio they held.
+	audioFrames   atomic.Int64
+	audioReceived atomic.Int64
+	// lost and late count sequenced frames missing and out of order, and
+	// lastSeq and lastCapture hold the latest frame's number and capture
+	// time, in Unix nanoseconds.
+	lost        atomic.Int64
+	late        atomic.Int64
+	lastSeq     atomic.Int64
+	lastCapture atomic.Int64
+	// undecodable counts frames the audio converter rejected.
+	undecodable atomic.Int64
+	// level holds the latest LevelDBFS, as float64 bits, and speaking the
+	// backend's speech state.
+	level    atomic.Uint64
+	speaking atomic.Bool
+
+	mu     sync.Mutex
+	events map[string]int64
+}
+
+func (c *counters) addEvent(event string) {
+	c.mu.Lock()
+	if c.events == nil {
+		c.events = map[string]int64{}
+	}
+	c.events[event]++
+	c.mu.Unlock()
+}
+
+func (c *counters) eventCounts() map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make(map[string]int64, len(c.events))
+	for k, v := range c.events {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,165 @@
+// session/transcribe.go
+package session
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"vad-application/audio"
+	"vad-application/events"
+	"vad-application/metrics"
+
+	"golang.org/x/text/language"
+)
+
+// Transcription limits: how many segments may wait for the transcriber
+// before new ones are dropped, and how long the client waits for the last
+// transcripts once its audio ends.
+const (
+	transcriptQueueSize = 8
+	transcriptGrace     = 5 * time.Second
+)
+
+// transcriptFrame carries what was said in one speech segment, in seconds
+// of session audio.
+type transcriptFrame struct {
+	Event    string  `json:"event"`
+	Text     string  `json:"text"`
+	Language string  `json:"language,omitempty"`
+	Start    float64 `json:"start"`
+	End      float64 `json:"end"`
+}
+
+// segment is the audio of one speech segment awaiting transcription.
+type segment struct {
+	pcm  []byte
+	span events.SpeechSegment
+}
+
+// segmentAudio collects the audio sent to the backend between a speech start
+// and end. While no segment is open it keeps the latest preroll bytes, since
+// the backend reports a start only after hearing some of the speech.
+type segmentAudio struct {
+	mu      sync.Mutex
+	preroll int
+	max     int
+	data    []byte
+	open    bool
+	// truncated is set once the open segment exceeded max.
+	truncated bool
+}
+
+func newSegmentAudio(preroll, limit time.Duration) *segmentAudio {
+	size := func(d time.Duration) int {
+		return int(d.Seconds()*float64(audio.Backend.SampleRate)) * audio.Backend.FrameSize()
+	}
+	return &segmentAudio{preroll: size(preroll), max: size(limit)}
+}
+
+func (a *segmentAudio) write(pcm []byte) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.open {
+		a.data = append(a.data, pcm...)
+		if n := len(a.data) - a.preroll; n > 0 {
+			a.data = append(a.data[:0], a.data[n:]...)
+		}
+		return
+	}
+	if room := a.max - len(a.data); room < len(pcm) {
+		pcm = pcm[:max(room, 0)]
+		a.truncated = true
+	}
+	a.data = append(a.data, pcm...)
+}
+
+// start opens a segment with the preroll kept so far.
+func (a *segmentAudio) start() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.open, a.truncated = true, false
+}
+
+// end closes the open segment and returns its audio, and whether it was cut
+// short.
+func (a *segmentAudio) end() ([]byte, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	pcm, truncated := a.data, a.truncated
+	a.data, a.open = nil, false
+	return pcm, truncated
+}
+
+// segmentEvent feeds a VAD response to the transcription and the clips: a
+// start opens a segment and the closed segment seg, if any, is cut into a
+// clip and queued for transcription.
+func (s *Session) segmentEvent(event string, seg *events.SpeechSegment) {
+	if s.segments == nil {
+		return
+	}
+	switch {
+	case seg != nil:
+		pcm, truncated := s.segments.end()
+		if truncated {
+			s.log.Warn("Speech segment cut short", "max", s.cfg.MaxTranscribed.String())
+		}
+		s.clip(pcm, *seg, truncated)
+		if s.transcripts == nil {
+			return
+		}
+		select {
+		case s.transcripts <- segment{pcm: pcm, span: *seg}:
+		default:
+			metrics.Transcriptions.WithLabelValues("dropped").Inc()
+			s.log.Warn("Transcriber behind; segment not transcribed", "start", seg.Start)
+		}
+	case event == eventSpeechStart:
+		s.segments.start()
+	}
+}
+
+// transcribe sends each queued segment to the transcriber until the channel
+// closes, pushing transcripts to the client and publishing them as
+// Transcript events. Requests may run past the session's end, each within
+// Config.TranscribeTimeout.
+func (s *Session) transcribe(ctx context.Context, segments <-chan segment) {
+	ctx = context.WithoutCancel(ctx)
+	lang := ""
+	if tag, err := language.Parse(s.Settings.Locale); err == nil {
+		base, _ := tag.Base()
+		lang = base.String()
+	}
+	for seg := range segments {
+		if len(seg.pcm) == 0 {
+			continue
+		}
+		rctx, cancel := context.WithTimeout(ctx, s.cfg.TranscribeTimeout)
+		start := time.Now()
+		tr, err := s.cfg.Transcriber.Transcribe(rctx, seg.pcm, lang)
+		cancel()
+		metrics.TranscriptionLatency.Observe(time.Since(start).Seconds())
+		if err != nil {
+			metrics.Transcriptions.WithLabelValues("failed").Inc()
+			s.log.Warn("Transcription failed", "start", seg.span.Start, "err", err)
+			continue
+		}
+		metrics.Transcriptions.WithLabelValues("ok").Inc()
+		s.log.Debug("Segment transcribed", "start", seg.span.Start, "chars", len(tr.Text))
+		s.rec.Event(events.Transcript, tr.Text)
+		s.publish(events.Event{Kind: events.Transcript, Text: tr.Text, Segment: &seg.span})
+		if err := s.writeJSON(transcriptFrame{
+			Event:    "transcript",
+			Text:     tr.Text,
+			Language: tr.Language,
+			Start:    seg.span.Start,
+			End:      seg.span.End,
+		}); err != nil {
+			s.log.Debug("Transcript not sent", "err", err)
+		}
+		s.queueTurn(tr.Text)
+	}
+}
@@ -0,0 +1,185 @@
+// session/wake.go
+package session
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"vad-application/events"
+	pb "vad-application/grpc_modules"
+	"vad-application/metrics"
+
+	"github.com/gorilla/websocket"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// wakeQueueSize is how many chunks may wait for the wake-word stream before
+// new ones are dropped.
+const wakeQueueSize = 64
+
+// Wake gate states sent in wake_word frames.
+const (
+	wakeOpen   = "open"
+	wakeClosed = "closed"
+)
+
+// errWakeWordLost reports a wake-word backend that ended its stream early.
+var errWakeWordLost = errors.New("wake-word stream ended")
+
+// wakeFrame tells the client that its audio started or stopped reaching the
+// backend. Message is the wake-word backend's, on open.
+type wakeFrame struct {
+	Event   string `json:"event"`
+	State   string `json:"state"`
+	Message string `json:"message,omitempty"`
+}
+
+// wakeGate holds a session's audio back from the backend until the wake
+// word fires, then lets it through until Config.WakeWindow passes without
+// speech.
+type wakeGate struct {
+	window time.Duration
+	// preroll keeps the latest held-back audio, sent ahead of the rest once
+	// the gate opens. Only the send loop touches it.
+	preroll *replayBuffer
+	// audio feeds runWake while the gate is shut.
+	audio chan []byte
+
+	mu       sync.Mutex
+	open     bool
+	speaking bool
+	until    time.Time
+}
+
+func newWakeGate(window, preroll time.Duration) *wakeGate {
+	return &wakeGate{
+		window:  window,
+		preroll: newReplayBuffer(preroll),
+		audio:   make(chan []byte, wakeQueueSize),
+	}
+}
+
+// fire opens the gate for a window, reporting whether it was shut.
+func (g *wakeGate) fire(now time.Time) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	opened := !g.open
+	g.open, g.until = true, now.Add(g.window)
+	return opened
+}
+
+// observe keeps the gate open while the backend hears speech, and for a
+// window after.
+func (g *wakeGate) observe(event string, now time.Time) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	switch event {
+	case eventSpeechStart:
+		g.speaking = true
+	case eventSpeechEnd:
+		g.speaking = false
+	default:
+		return
+	}
+	if g.open {
+		g.until = now.Add(g.window)
+	}
+}
+
+// pass reports whether audio arriving now goes to the backend, and whether
+// the gate has just shut.
+func (g *wakeGate) pass(now time.Time) (pass, shut bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.open && !g.speaking && now.After(g.until) {
+		g.open = false
+		return false, true
+	}
+	return g.open, false
+}
+
+// hold keeps data back from the backend and hands it to the wake-word
+// stream instead. It never blocks.
+func (g *wakeGate) hold(data []byte) {
+	g.preroll.add(data)
+	select {
+	case g.audio <- append([]byte(nil), data...):
+	default:
+		metrics.DroppedChunks.WithLabelValues("wake_word").Inc()
+	}
+}
+
+// release empties the preroll, returning the chunks it held.
+func (g *wakeGate) release() [][]byte {
+	chunks := g.preroll.chunks
+	g.preroll.chunks, g.preroll.size = nil, 0
+	return chunks
+}
+
+// sendWake tells the client about the gate.
+func (s *Session) sendWake(state, message string) {
+	if err := s.writeJSON(wakeFrame{Event: "wake_word", State: state, Message: message}); err != nil {
+		s.log.Debug("Wake-word state not sent", "err", err)
+	}
+}
+
+// runWake streams the held-back audio to the wake-word backend until the
+// channel closes, opening the gate whenever it answers with
+// Config.WakeEvent. The session fails if the stream does, since its audio
+// could never reach the backend again.
+func (s *Session) runWake(ctx context.Context, audio <-chan []byte) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := s.cfg.WakeWord.ProcessAudio(ctx)
+	if err == nil {
+		go func() {
+			defer cancel()
+			defer s.recoverPanic("wake")
+			for {
+				resp, rerr := stream.Recv()
+				if rerr != nil {
+					if rerr == io.EOF {
+						rerr = errWakeWordLost
+					}
+					if ctx.Err() == nil && status.Code(rerr) != codes.Canceled {
+						s.wakeFailed(rerr)
+					}
+					return
+				}
+				if resp.GetEvent() != s.cfg.WakeEvent {
+					continue
+				}
+				metrics.WakeWords.Inc()
+				if s.wake.fire(time.Now()) {
+					s.log.Info("Wake word detected", "message", resp.GetMessage())
+					s.rec.Event(events.WakeWord, resp.GetMessage())
+					s.publish(events.Event{Kind: events.WakeWord, Message: resp.GetMessage()})
+					s.sendWake(wakeOpen, resp.GetMessage())
+				}
+			}
+		}()
+	} else {
+		s.wakeFailed(err)
+	}
+	msg := &pb.AudioChunk{}
+	for data := range audio {
+		if err != nil || ctx.Err() != nil {
+			continue
+		}
+		msg.AudioData = data
+		// On failure, Recv reports why.
+		err = stream.Send(msg)
+	}
+}
+
+func (s *Session) wakeFailed(err error) {
+	s.Fail(CodeWakeWordUnavailable, err)
+	s.end(websocket.CloseTryAgainLater, "wake-word backend unavailable")
+}
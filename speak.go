@@ -0,0 +1,65 @@
+// speak.go
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"vad-application/session"
+)
+
+// maxSpeakBody caps the JSON body of a speak request.
+const maxSpeakBody = 64 << 10
+
+// speakRequest is the body of POST /v1/sessions/{id}/speak.
+type speakRequest struct {
+	Text  string `json:"text"`
+	Voice string `json:"voice,omitempty"`
+}
+
+// speakHandler lets the application behind the bridge talk to a live
+// session's client:
+//
+//	POST   /v1/sessions/{id}/speak  {"text": "...", "voice": "..."}  queue speech
+//	DELETE /v1/sessions/{id}/speak                                   interrupt it
+func (b *bridge) speakHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/sessions/{id}/speak", func(w http.ResponseWriter, r *http.Request) {
+		sess, ok := b.sessionFor(r.Context(), r.PathValue("id"))
+		if !ok {
+			http.Error(w, "session not found", http.StatusNotFound)
+			return
+		}
+		var req speakRequest
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxSpeakBody)).Decode(&req); err != nil || req.Text == "" {
+			http.Error(w, "body must be a JSON object with text", http.StatusBadRequest)
+			return
+		}
+		id, err := sess.Speak(req.Text, req.Voice)
+		switch {
+		case errors.Is(err, session.ErrPlaybackQueueFull):
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(struct {
+			ID string `json:"id"`
+		}{id})
+	})
+	mux.HandleFunc("DELETE /v1/sessions/{id}/speak", func(w http.ResponseWriter, r *http.Request) {
+		sess, ok := b.sessionFor(r.Context(), r.PathValue("id"))
+		if !ok {
+			http.Error(w, "session not found", http.StatusNotFound)
+			return
+		}
+		sess.Interrupt()
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
@@ -0,0 +1,82 @@
+// sse/sse.go
+package sse
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"vad-application/events"
+)
+
+// keepaliveInterval keeps idle streams open through proxies.
+const keepaliveInterval = 15 * time.Second
+
+// Handler serves GET /events/{sessionID}: the session's events from now on,
+// each as an SSE event named after its kind with the JSON event as data.
+// The stream ends after session_end. live reports whether a session is
+// open to the caller whose request ctx is; unknown sessions get 404.
+func Handler(hub *events.Hub, live func(ctx context.Context, id string) bool) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /events/{sessionID}", func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("sessionID")
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+		ch, stop, err := hub.Watch(id)
+		switch {
+		case errors.Is(err, events.ErrTooManyViewers):
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		case err != nil:
+			http.Error(w, "server shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		defer stop()
+		// Checked after watching, so an end in between isn't missed.
+		if !live(r.Context(), id) {
+			http.Error(w, "session not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		// Stops nginx from buffering the stream.
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		keepalive := time.NewTicker(keepaliveInterval)
+		defer keepalive.Stop()
+		var seq int
+		for {
+			select {
+			case e, ok := <-ch:
+				if !ok {
+					return
+				}
+				data, err := json.Marshal(e)
+				if err != nil {
+					return
+				}
+				seq++
+				if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", seq, e.Kind, data); err != nil {
+					return
+				}
+			case <-keepalive.C:
+				if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+					return
+				}
+			case <-r.Context().Done():
+				return
+			}
+			flusher.Flush()
+		}
+	})
+	return mux
+}
@@ -0,0 +1,237 @@
+// static.go
+package main
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed static
+var staticFiles embed.FS
+
+// protoFiles are the protobuf definitions clients build on, for /schema.
+//
+//go:embed proto/vad.proto proto/bridge.proto
+var protoFiles embed.FS
+
+// staticTypes are the content types browsers insist on: audio worklets and
+// modules load only as JavaScript, and WebAssembly streams only as
+// application/wasm, whatever the host's mime.types says.
+var staticTypes = map[string]string{
+	".js":          "text/javascript; charset=utf-8",
+	".mjs":         "text/javascript; charset=utf-8",
+	".wasm":        "application/wasm",
+	".html":        "text/html; charset=utf-8",
+	".css":         "text/css; charset=utf-8",
+	".json":        "application/json",
+	".map":         "application/json",
+	".svg":         "image/svg+xml",
+	".webmanifest": "application/manifest+json",
+}
+
+// staticEncodings are the precompressed variants looked for next to a file,
+// in order of preference.
+var staticEncodings = []struct{ name, ext string }{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// fingerprinted matches names carrying a content hash, such as
+// app.3f9c2d1e.js, which may be cached for good.
+var fingerprinted = regexp.MustCompile(`[.-][0-9a-fA-F]{8,}\.[a-z0-9]+$`)
+
+// staticHandler serves the frontend at /: from dir when set, so that it can
+// be changed without a rebuild, or else the copy built into the binary.
+func staticHandler(dir string) (http.Handler, error) {
+	if dir == "" {
+		files, err := fs.Sub(staticFiles, "static")
+		if err != nil {
+			return nil, err
+		}
+		return &staticServer{files: files}, nil
+	}
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	return &staticServer{files: os.DirFS(dir)}, nil
+}
+
+// staticServer serves a single-page app: paths naming no file, and not
+// looking like one, get index.html so that the app routes them itself.
+// Files are served with an ETag, a Cache-Control fitting how often they
+// change and, when the client takes it, their .br or .gz variant.
+type staticServer struct {
+	files fs.FS
+
+	mu    sync.Mutex
+	etags map[etagKey]string // by file and version
+}
+
+type etagKey struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (s *staticServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" {
+		name = "index.html"
+	}
+	if s.isDir(name) {
+		name = path.Join(name, "index.html")
+	}
+	if !s.exists(name) {
+		// Client-side routes have no extension; missing assets do and get
+		// a 404 rather than a page the browser can't use.
+		if path.Ext(name) != "" || !s.exists("index.html") {
+			http.NotFound(w, r)
+			return
+		}
+		name = "index.html"
+	}
+	s.serve(w, r, name)
+}
+
+func (s *staticServer) serve(w http.ResponseWriter, r *http.Request, name string) {
+	h := w.Header()
+	ctype, ok := staticTypes[path.Ext(name)]
+	if !ok {
+		ctype = mime.TypeByExtension(path.Ext(name))
+	}
+	if ctype != "" {
+		h.Set("Content-Type", ctype)
+	}
+	h.Set("Cache-Control", cacheControl(name))
+
+	file, encoding, variants := name, "", false
+	for _, e := range staticEncodings {
+		if !s.exists(name + e.ext) {
+			continue
+		}
+		variants = true
+		if encoding == "" && acceptsEncoding(r, e.name) {
+			file, encoding = name+e.ext, e.name
+		}
+	}
+	if variants {
+		// Caches must keep the variants apart even when this client gets
+		// the plain file.
+		h.Add("Vary", "Accept-Encoding")
+	}
+	f, err := s.files.Open(file)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if encoding != "" {
+		h.Set("Content-Encoding", encoding)
+	}
+	if etag, err := s.etag(file, fi, content); err == nil {
+		h.Set("ETag", etag)
+	}
+	// The ETag decides revalidation: embedded files carry no modification
+	// time, and a directory's may move backwards on deploy.
+	http.ServeContent(w, r, name, time.Time{}, content)
+}
+
+// etag returns the ETag of file, hashing its content once per version.
+func (s *staticServer) etag(file string, fi fs.FileInfo, content io.ReadSeeker) (string, error) {
+	key := etagKey{file, fi.Size(), fi.ModTime()}
+	s.mu.Lock()
+	etag, ok := s.etags[key]
+	s.mu.Unlock()
+	if ok {
+		return etag, nil
+	}
+	sum := sha256.New()
+	if _, err := io.Copy(sum, content); err != nil {
+		return "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	etag = strconv.Quote(hex.EncodeToString(sum.Sum(nil))[:32])
+	s.mu.Lock()
+	if s.etags == nil {
+		s.etags = map[etagKey]string{}
+	}
+	s.etags[key] = etag
+	s.mu.Unlock()
+	return etag, nil
+}
+
+func (s *staticServer) exists(name string) bool {
+	fi, err := fs.Stat(s.files, name)
+	return err == nil && !fi.IsDir()
+}
+
+func (s *staticServer) isDir(name string) bool {
+	fi, err := fs.Stat(s.files, name)
+	return err == nil && fi.IsDir()
+}
+
+// cacheControl lets browsers keep fingerprinted files for a year, and has
+// them revalidate pages, which name the current assets, every time.
+func cacheControl(name string) string {
+	switch {
+	case path.Ext(name) == ".html":
+		return "no-cache"
+	case fingerprinted.MatchString(path.Base(name)):
+		return "public, max-age=31536000, immutable"
+	default:
+		return "public, max-age=300"
+	}
+}
+
+// acceptsEncoding reports whether r's Accept-Encoding takes coding.
+func acceptsEncoding(r *http.Request, coding string) bool {
+	for _, v := range r.Header.Values("Accept-Encoding") {
+		for _, part := range strings.Split(v, ",") {
+			token, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+			if !strings.EqualFold(strings.TrimSpace(token), coding) {
+				continue
+			}
+			q, found := strings.CutPrefix(strings.TrimSpace(params), "q=")
+			if !found {
+				return true
+			}
+			n, err := strconv.ParseFloat(q, 64)
+			return err == nil && n > 0
+		}
+	}
+	return false
+}
@@ -0,0 +1,341 @@
+// store/query.go
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"vad-application/tenant"
+)
+
+// Limits on how many sessions one query returns.
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+)
+
+// ErrNotFound is returned for an unknown session.
+var ErrNotFound = errors.New("session not found")
+
+// Session is a stored session. Ended is nil while it is open, or if the
+// bridge stopped before it finished.
+type Session struct {
+	ID            string     `json:"id"`
+	Subject       string     `json:"subject,omitempty"`
+	Tenant        string     `json:"tenant,omitempty"`
+	Started       time.Time  `json:"started"`
+	Ended         *time.Time `json:"ended,omitempty"`
+	Duration      float64    `json:"duration"`
+	Audio         float64    `json:"audio"`
+	Speech        float64    `json:"speech"`
+	BytesIn       int64      `json:"bytes_in"`
+	BytesOut      int64      `json:"bytes_out"`
+	DroppedChunks int64      `json:"dropped_chunks"`
+	EventCount    int64      `json:"event_count"`
+}
+
+// Event is a stored VAD event.
+type Event struct {
+	Seq     int64     `json:"seq"`
+	Time    time.Time `json:"time"`
+	Offset  float64   `json:"offset"`
+	Event   string    `json:"event"`
+	Message string    `json:"message,omitempty"`
+}
+
+// Filter selects sessions by start time, subject and tenant. Zero fields
+// match everything.
+type Filter struct {
+	Since, Until time.Time
+	Subject      string
+	Tenant       string
+	Limit        int
+}
+
+// where renders f as a WHERE clause and its arguments.
+func (f Filter) where() (string, []any) {
+	var conds []string
+	var args []any
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if !f.Since.IsZero() {
+		add("started_ms >= $%d", f.Since.UnixMilli())
+	}
+	if !f.Until.IsZero() {
+		add("started_ms < $%d", f.Until.UnixMilli())
+	}
+	if f.Subject != "" {
+		add("subject = $%d", f.Subject)
+	}
+	if f.Tenant != "" {
+		add("tenant = $%d", f.Tenant)
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+const sessionColumns = `id, subject, tenant, started_ms, ended_ms, duration_seconds, audio_seconds, speech_seconds,
+	bytes_in, bytes_out, dropped_chunks, event_count`
+
+func scanSession(row interface{ Scan(...any) error }) (Session, error) {
+	var ss Session
+	var started int64
+	var ended sql.NullInt64
+	err := row.Scan(&ss.ID, &ss.Subject, &ss.Tenant, &started, &ended, &ss.Duration, &ss.Audio, &ss.Speech,
+		&ss.BytesIn, &ss.BytesOut, &ss.DroppedChunks, &ss.EventCount)
+	ss.Started = fromMillis(started)
+	if ended.Valid {
+		t := fromMillis(ended.Int64)
+		ss.Ended = &t
+	}
+	return ss, err
+}
+
+// Sessions returns the sessions matching f, newest first.
+func (s *Store) Sessions(ctx context.Context, f Filter) ([]Session, error) {
+	where, args := f.where()
+	limit := f.Limit
+	switch {
+	case limit <= 0:
+		limit = defaultLimit
+	case limit > maxLimit:
+		limit = maxLimit
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+sessionColumns+` FROM sessions`+where+` ORDER BY started_ms DESC LIMIT `+strconv.Itoa(limit), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Session{}
+	for rows.Next() {
+		ss, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, ss)
+	}
+	return out, rows.Err()
+}
+
+// Session returns one session and its events in order.
+func (s *Store) Session(ctx context.Context, id string) (Session, []Event, error) {
+	ss, err := scanSession(s.db.QueryRowContext(ctx, `SELECT `+sessionColumns+` FROM sessions WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Session{}, nil, ErrNotFound
+	}
+	if err != nil {
+		return Session{}, nil, err
+	}
+	evs, err := s.events(ctx, "events", id)
+	return ss, evs, err
+}
+
+// ShadowEvents returns the shadow backend's responses for one session, in
+// order.
+func (s *Store) ShadowEvents(ctx context.Context, id string) ([]Event, error) {
+	return s.events(ctx, "shadow_events", id)
+}
+
+func (s *Store) events(ctx context.Context, table, id string) ([]Event, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT seq, time_ms, offset_seconds, event, message FROM `+table+` WHERE session_id = $1 ORDER BY seq`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	evs := []Event{}
+	for rows.Next() {
+		var e Event
+		var ms int64
+		if err := rows.Scan(&e.Seq, &ms, &e.Offset, &e.Event, &e.Message); err != nil {
+			return nil, err
+		}
+		e.Time = fromMillis(ms)
+		evs = append(evs, e)
+	}
+	return evs, rows.Err()
+}
+
+// Totals aggregates finished sessions.
+type Totals struct {
+	Sessions int64   `json:"sessions"`
+	Audio    float64 `json:"audio"`
+	Speech   float64 `json:"speech"`
+	// SpeechRatio is Speech over Audio.
+	SpeechRatio float64 `json:"speech_ratio"`
+}
+
+// Totals sums the finished sessions matching f; its limit is ignored.
+func (s *Store) Totals(ctx context.Context, f Filter) (Totals, error) {
+	where, args := f.where()
+	if where == "" {
+		where = " WHERE ended_ms IS NOT NULL"
+	} else {
+		where += " AND ended_ms IS NOT NULL"
+	}
+	var t Totals
+	err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*), COALESCE(SUM(audio_seconds), 0), COALESCE(SUM(speech_seconds), 0) FROM sessions`+where,
+		args...).Scan(&t.Sessions, &t.Audio, &t.Speech)
+	if t.Audio > 0 {
+		t.SpeechRatio = t.Speech / t.Audio
+	}
+	return t, err
+}
+
+// SubjectTotals aggregates one subject's finished sessions in a tenant.
+type SubjectTotals struct {
+	Tenant   string  `json:"tenant,omitempty"`
+	Subject  string  `json:"subject"`
+	Sessions int64   `json:"sessions"`
+	Audio    float64 `json:"audio"`
+	Speech   float64 `json:"speech"`
+	Events   int64   `json:"events"`
+}
+
+// TotalsBySubject sums the sessions that ended in [from, until), by tenant
+// and subject. A session counts once, in the period it ended in.
+func (s *Store) TotalsBySubject(ctx context.Context, from, until time.Time) ([]SubjectTotals, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT tenant, subject, COUNT(*), COALESCE(SUM(audio_seconds), 0), COALESCE(SUM(speech_seconds), 0), COALESCE(SUM(event_count), 0)
+		FROM sessions WHERE ended_ms >= $1 AND ended_ms < $2 GROUP BY tenant, subject ORDER BY tenant, subject`,
+		from.UnixMilli(), until.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []SubjectTotals{}
+	for rows.Next() {
+		var t SubjectTotals
+		if err := rows.Scan(&t.Tenant, &t.Subject, &t.Sessions, &t.Audio, &t.Speech, &t.Events); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// Usage sums the audio, in seconds, of each subject's finished sessions
+// started since since.
+func (s *Store) Usage(ctx context.Context, since time.Time) (map[string]float64, error) {
+	return s.usage(ctx, "subject", since)
+}
+
+// TenantUsage is Usage by tenant.
+func (s *Store) TenantUsage(ctx context.Context, since time.Time) (map[string]float64, error) {
+	return s.usage(ctx, "tenant", since)
+}
+
+func (s *Store) usage(ctx context.Context, by string, since time.Time) (map[string]float64, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+by+`, SUM(audio_seconds) FROM sessions WHERE started_ms >= $1 AND `+by+` <> '' AND ended_ms IS NOT NULL GROUP BY `+by,
+		since.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[string]float64{}
+	for rows.Next() {
+		var name string
+		var audio float64
+		if err := rows.Scan(&name, &audio); err != nil {
+			return nil, err
+		}
+		out[name] = audio
+	}
+	return out, rows.Err()
+}
+
+// NewAPI serves read-only queries over HTTP:
+//
+//	GET /v1/sessions?since=&until=&subject=&limit=  sessions, newest first
+//	GET /v1/sessions/{id}                           one session, its events and shadow events
+//	GET /v1/stats?since=&until=&subject=            totals and speech ratio
+//
+// since and until are RFC 3339 times. Callers belonging to a tenant only
+// see its sessions.
+func NewAPI(s *Store) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/sessions", func(w http.ResponseWriter, r *http.Request) {
+		f, ok := parseFilter(w, r)
+		if !ok {
+			return
+		}
+		list, err := s.Sessions(r.Context(), f)
+		s.reply(w, list, err)
+	})
+	mux.HandleFunc("GET /v1/sessions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		ss, evs, err := s.Session(r.Context(), r.PathValue("id"))
+		if t := tenant.FromContext(r.Context()); err == nil && t != "" && ss.Tenant != t {
+			err = ErrNotFound
+		}
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		var shadow []Event
+		if err == nil {
+			shadow, err = s.ShadowEvents(r.Context(), ss.ID)
+		}
+		s.reply(w, struct {
+			Session
+			Events       []Event `json:"events"`
+			ShadowEvents []Event `json:"shadow_events,omitempty"`
+		}{ss, evs, shadow}, err)
+	})
+	mux.HandleFunc("GET /v1/stats", func(w http.ResponseWriter, r *http.Request) {
+		f, ok := parseFilter(w, r)
+		if !ok {
+			return
+		}
+		t, err := s.Totals(r.Context(), f)
+		s.reply(w, t, err)
+	})
+	return mux
+}
+
+func parseFilter(w http.ResponseWriter, r *http.Request) (Filter, bool) {
+	q := r.URL.Query()
+	f := Filter{Subject: q.Get("subject"), Tenant: tenant.FromContext(r.Context())}
+	for name, dst := range map[string]*time.Time{"since": &f.Since, "until": &f.Until} {
+		if v := q.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				http.Error(w, name+": not an RFC 3339 time", http.StatusBadRequest)
+				return f, false
+			}
+			*dst = t
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "limit: not a positive integer", http.StatusBadRequest)
+			return f, false
+		}
+		f.Limit = n
+	}
+	return f, true
+}
+
+func (s *Store) reply(w http.ResponseWriter, v any, err error) {
+	if err != nil {
+		s.log.Warn("Session query failed", "err", err)
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
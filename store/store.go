@@ -0,0 +1,243 @@
+// store/store.go
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"vad-application/events"
+	"vad-application/metrics"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
+
+// Supported database drivers.
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+// queueSize is how many events may wait for the writer before new ones are
+// dropped, and maxBatch how many are written per transaction.
+const (
+	queueSize = 4096
+	maxBatch  = 256
+)
+
+// schema works on both SQLite and Postgres. Times are Unix milliseconds.
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS sessions (
+		id               TEXT PRIMARY KEY,
+		subject          TEXT NOT NULL DEFAULT '',
+		tenant           TEXT NOT NULL DEFAULT '',
+		started_ms       BIGINT NOT NULL,
+		ended_ms         BIGINT,
+		duration_seconds DOUBLE PRECISION NOT NULL DEFAULT 0,
+		audio_seconds    DOUBLE PRECISION NOT NULL DEFAULT 0,
+		speech_seconds   DOUBLE PRECISION NOT NULL DEFAULT 0,
+		bytes_in         BIGINT NOT NULL DEFAULT 0,
+		bytes_out        BIGINT NOT NULL DEFAULT 0,
+		dropped_chunks   BIGINT NOT NULL DEFAULT 0,
+		event_count      BIGINT NOT NULL DEFAULT 0
+	)`,
+	`CREATE INDEX IF NOT EXISTS sessions_started ON sessions (started_ms)`,
+	`CREATE INDEX IF NOT EXISTS sessions_ended ON sessions (ended_ms)`,
+	`CREATE TABLE IF NOT EXISTS events (
+		session_id     TEXT NOT NULL,
+		seq            BIGINT NOT NULL,
+		time_ms        BIGINT NOT NULL,
+		offset_seconds DOUBLE PRECISION NOT NULL,
+		event          TEXT NOT NULL,
+		message        TEXT NOT NULL DEFAULT '',
+		PRIMARY KEY (session_id, seq)
+	)`,
+	// shadow_events holds the shadow backend's responses, for comparison
+	// with the events of the same session.
+	`CREATE TABLE IF NOT EXISTS shadow_events (
+		session_id     TEXT NOT NULL,
+		seq            BIGINT NOT NULL,
+		time_ms        BIGINT NOT NULL,
+		offset_seconds DOUBLE PRECISION NOT NULL,
+		event          TEXT NOT NULL,
+		message        TEXT NOT NULL DEFAULT '',
+		PRIMARY KEY (session_id, seq)
+	)`,
+}
+
+// migrations bring tables created by earlier versions up to date: each
+// change is applied when its probe fails.
+var migrations = []struct{ probe, change string }{
+	{`SELECT tenant FROM sessions LIMIT 0`, `ALTER TABLE sessions ADD COLUMN tenant TEXT NOT NULL DEFAULT ''`},
+}
+
+// Store records sessions and their VAD events in a SQL database. It is an
+// events.Sink: events are written in the background, in batches.
+type Store struct {
+	db  *sql.DB
+	log *slog.Logger
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan events.Event
+	done   chan struct{}
+	// seq and shadowSeq number the events and shadow events of each open
+	// session; only the writer uses them.
+	seq       map[string]int64
+	shadowSeq map[string]int64
+}
+
+// Open connects to the database, creates the tables if needed and starts
+// the writer.
+func Open(ctx context.Context, driver, dsn string, logger *slog.Logger) (*Store, error) {
+	name := driver
+	switch driver {
+	case DriverSQLite:
+	case DriverPostgres:
+		name = "pgx"
+	default:
+		return nil, fmt.Errorf("store: unknown driver %q (want %s or %s)", driver, DriverSQLite, DriverPostgres)
+	}
+	db, err := sql.Open(name, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("store: %w", err)
+	}
+	if driver == DriverSQLite {
+		// SQLite allows one writer at a time; queue at the pool instead of
+		// failing with SQLITE_BUSY.
+		db.SetMaxOpenConns(1)
+	}
+	for _, stmt := range schema {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("store: creating schema: %w", err)
+		}
+	}
+	for _, m := range migrations {
+		rows, err := db.QueryContext(ctx, m.probe)
+		if err == nil {
+			rows.Close()
+			continue
+		}
+		if _, err := db.ExecContext(ctx, m.change); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("store: migrating schema: %w", err)
+		}
+	}
+	s := &Store{
+		db:        db,
+		log:       logger.With("sink", "db"),
+		queue:     make(chan events.Event, queueSize),
+		done:      make(chan struct{}),
+		seq:       make(map[string]int64),
+		shadowSeq: make(map[string]int64),
+	}
+	go s.write()
+	return s, nil
+}
+
+// Publish queues e for writing, dropping it if the writer is behind.
+func (s *Store) Publish(e events.Event) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.queue <- e:
+	default:
+		metrics.SinkDropped.WithLabelValues("db").Inc()
+	}
+}
+
+// Close writes the queued events and closes the database.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	close(s.queue)
+	s.mu.Unlock()
+	<-s.done
+	return s.db.Close()
+}
+
+// write drains the queue, one transaction per batch of events.
+func (s *Store) write() {
+	defer close(s.done)
+	batch := make([]events.Event, 0, maxBatch)
+	for e := range s.queue {
+		batch = append(batch[:0], e)
+	fill:
+		for len(batch) < maxBatch {
+			select {
+			case e, ok := <-s.queue:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, e)
+			default:
+				break fill
+			}
+		}
+		if err := s.writeBatch(batch); err != nil {
+			metrics.SinkDropped.WithLabelValues("db").Add(float64(len(batch)))
+			s.log.Warn("Writing session events failed", "events", len(batch), "err", err)
+		}
+	}
+}
+
+func (s *Store) writeBatch(batch []events.Event) error {
+	ctx := context.Background()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, e := range batch {
+		if err := s.writeEvent(ctx, tx, e); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *Store) writeEvent(ctx context.Context, tx *sql.Tx, e events.Event) error {
+	var err error
+	switch e.Kind {
+	case events.SessionStart:
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO sessions (id, subject, tenant, started_ms) VALUES ($1, $2, $3, $4) ON CONFLICT (id) DO NOTHING`,
+			e.SessionID, e.Subject, e.Tenant, e.Time.UnixMilli())
+	case events.VAD:
+		s.seq[e.SessionID]++
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO events (session_id, seq, time_ms, offset_seconds, event, message) VALUES ($1, $2, $3, $4, $5, $6)`,
+			e.SessionID, s.seq[e.SessionID], e.Time.UnixMilli(), e.Offset, e.Event, e.Message)
+	case events.Shadow:
+		s.shadowSeq[e.SessionID]++
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO shadow_events (session_id, seq, time_ms, offset_seconds, event, message) VALUES ($1, $2, $3, $4, $5, $6)`,
+			e.SessionID, s.shadowSeq[e.SessionID], e.Time.UnixMilli(), e.Offset, e.Event, e.Message)
+	case events.SessionEnd:
+		delete(s.seq, e.SessionID)
+		delete(s.shadowSeq, e.SessionID)
+		sum := e.Summary
+		var count int64
+		for _, n := range sum.Events {
+			count += n
+		}
+		_, err = tx.ExecContext(ctx,
+			`UPDATE sessions SET ended_ms = $2, duration_seconds = $3, audio_seconds = $4, speech_seconds = $5,
+				bytes_in = $6, bytes_out = $7, dropped_chunks = $8, event_count = $9 WHERE id = $1`,
+			e.SessionID, e.Time.UnixMilli(), sum.Duration, sum.Audio, sum.Speech,
+			sum.BytesIn, sum.BytesOut, sum.DroppedChunks, count)
+	}
+	return err
+}
+
+func fromMillis(ms int64) time.Time {
+	return time.UnixMilli(ms).UTC()
+}
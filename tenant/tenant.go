@@ -0,0 +1,125 @@
+// tenant/tenant.go
+package tenant
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"vad-application/auth"
+	"vad-application/events"
+	"vad-application/metrics"
+)
+
+// Errors returned by Resolver.Resolve.
+var (
+	ErrNoTenant = errors.New("request names no tenant")
+	ErrUnknown  = errors.New("unknown tenant")
+	ErrMismatch = errors.New("credentials belong to another tenant")
+)
+
+type tenantKey struct{}
+
+// WithTenant returns a copy of ctx carrying the tenant name.
+func WithTenant(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, name)
+}
+
+// FromContext returns the tenant stored by Middleware, or "" for requests
+// that belong to none.
+func FromContext(ctx context.Context) string {
+	name, _ := ctx.Value(tenantKey{}).(string)
+	return name
+}
+
+// Resolver tells which tenant a request belongs to: the one its
+// credentials name, or else the one whose subdomain of Domain it was sent
+// to, as acme.vad.example.com is acme's.
+type Resolver struct {
+	// Domain is the parent domain of tenants' subdomains; empty looks at
+	// credentials only.
+	Domain string
+	// Known lists the tenants; others are refused.
+	Known map[string]bool
+	// Required refuses requests that belong to no tenant.
+	Required bool
+}
+
+// Resolve returns r's tenant, or "" if it belongs to none.
+func (res *Resolver) Resolve(r *http.Request) (string, error) {
+	var cred string
+	if id, ok := auth.FromContext(r.Context()); ok {
+		cred = id.Tenant
+	}
+	host := res.subdomain(r.Host)
+	if cred != "" && host != "" && cred != host {
+		return "", ErrMismatch
+	}
+	name := cred
+	if name == "" {
+		name = host
+	}
+	switch {
+	case name == "" && res.Required:
+		return "", ErrNoTenant
+	case name != "" && !res.Known[name]:
+		return "", ErrUnknown
+	}
+	return name, nil
+}
+
+// subdomain returns the label host has under Domain, or "".
+func (res *Resolver) subdomain(host string) string {
+	if res.Domain == "" {
+		return ""
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	label, ok := strings.CutSuffix(strings.ToLower(host), "."+strings.ToLower(res.Domain))
+	if !ok || strings.Contains(label, ".") {
+		return ""
+	}
+	return label
+}
+
+// Middleware stores each request's tenant in its context, answering 403
+// to requests Resolve refuses. It runs after authentication.
+func (res *Resolver) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, err := res.Resolve(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if name != "" {
+			r = r.WithContext(WithTenant(r.Context(), name))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Metrics counts each tenant's sessions, audio and VAD events. It is an
+// events.Sink.
+type Metrics struct{}
+
+// Publish implements events.Sink.
+func (Metrics) Publish(e events.Event) {
+	if e.Tenant == "" {
+		return
+	}
+	switch e.Kind {
+	case events.SessionStart:
+		metrics.TenantSessions.WithLabelValues(e.Tenant).Inc()
+		metrics.TenantActiveSessions.WithLabelValues(e.Tenant).Inc()
+	case events.VAD:
+		metrics.TenantEvents.WithLabelValues(e.Tenant, e.Event).Inc()
+	case events.SessionEnd:
+		metrics.TenantActiveSessions.WithLabelValues(e.Tenant).Dec()
+		if e.Summary != nil {
+			metrics.TenantAudioSeconds.WithLabelValues(e.Tenant).Add(e.Summary.Audio)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// tenants.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"vad-application/audio"
+	"vad-application/backend"
+	"vad-application/config"
+	"vad-application/quota"
+	"vad-application/reporting"
+	"vad-application/session"
+	"vad-application/tenant"
+	"vad-application/webhook"
+)
+
+// tenantConfig is how the bridge serves one tenant's sessions.
+type tenantConfig struct {
+	// backends serve them; nil uses the shared ones.
+	backends *backend.Balancer
+	// encodings are those their clients may send; empty allows all.
+	encodings []audio.Encoding
+}
+
+// openTenants connects to the backends of the tenants that have their own.
+func openTenants(cfg config.Config, logger *slog.Logger, errs *reporting.Reporter) map[string]*tenantConfig {
+	tenants := make(map[string]*tenantConfig, len(cfg.Tenants))
+	for _, t := range cfg.Tenants {
+		tc := &tenantConfig{}
+		for _, name := range t.Encodings {
+			e := audio.ParseEncoding(name)
+			if err := audio.Backend.WithEncoding(e).Validate(); err != nil {
+				fatal("Invalid tenant configuration", fmt.Errorf("tenant %q: %w", t.Name, err))
+			}
+			tc.encodings = append(tc.encodings, e)
+		}
+		if len(t.BackendAddrs) > 0 {
+			var err error
+			tc.backends, err = openRouteBackends(cfg, t.BackendAddrs, logger.With("tenant", t.Name), errs, session.MetadataTenant, t.Name)
+			if err != nil {
+				fatal("Invalid tenant backend configuration", fmt.Errorf("tenant %q: %w", t.Name, err))
+			}
+		}
+		tenants[t.Name] = tc
+		logger.Info("Serving tenant", "tenant", t.Name, "backends", t.BackendAddrs, "encodings", t.Encodings)
+	}
+	return tenants
+}
+
+// tenantLimits returns the tenants' aggregate quotas.
+func tenantLimits(cfg config.Config) map[string]quota.Limits {
+	limits := make(map[string]quota.Limits, len(cfg.Tenants))
+	for _, t := range cfg.Tenants {
+		limits[t.Name] = quota.Limits{Daily: t.QuotaDaily, Monthly: t.QuotaMonthly}
+	}
+	return limits
+}
+
+// tenantHooks returns the tenants' webhooks, each limited to its tenant.
+func tenantHooks(cfg config.Config) []webhook.Hook {
+	var hooks []webhook.Hook
+	for _, t := range cfg.Tenants {
+		for _, w := range t.Webhooks {
+			hooks = append(hooks, webhook.Hook{URL: w.URL, Secret: w.Secret, Events: w.Events, Tenant: t.Name})
+		}
+	}
+	return hooks
+}
+
+// tenantResolver tells which tenant requests belong to.
+func tenantResolver(cfg config.Config) *tenant.Resolver {
+	known := make(map[string]bool, len(cfg.Tenants))
+	for _, t := range cfg.Tenants {
+		known[t.Name] = true
+	}
+	return &tenant.Resolver{Domain: cfg.TenantDomain, Known: known, Required: cfg.TenantRequired}
+}
+
+// tenant returns the tenant of the request ctx is, and how to serve it;
+// requests belonging to none get an empty tenantConfig.
+func (b *bridge) tenant(ctx context.Context) (string, *tenantConfig) {
+	name := tenant.FromContext(ctx)
+	if tc := b.tenants[name]; tc != nil {
+		return name, tc
+	}
+	return name, &tenantConfig{}
+}
+
+// sessionFor returns the open session id if it is the caller's to see:
+// callers belonging to a tenant only see its sessions.
+func (b *bridge) sessionFor(ctx context.Context, id string) (*session.Session, bool) {
+	s, ok := b.sessions.Get(id)
+	if !ok {
+		return nil, false
+	}
+	if name := tenant.FromContext(ctx); name != "" && s.Tenant != name {
+		return nil, false
+	}
+	return s, true
+}
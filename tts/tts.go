@@ -0,0 +1,99 @@
+// tts/tts.go
+package tts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"vad-application/audio"
+)
+
+// maxErrorBody caps the response text kept from a failed request.
+const maxErrorBody = 512
+
+// Synthesizer turns text into speech.
+type Synthesizer interface {
+	// Synthesize starts speaking text with the given voice, empty for the
+	// default one. The audio, in Format, streams from the returned reader
+	// as it is synthesized; the caller must close it.
+	Synthesize(ctx context.Context, text, voice string) (io.ReadCloser, error)
+	Format() audio.Format
+}
+
+// HTTPConfig describes an HTTP text-to-speech service.
+type HTTPConfig struct {
+	// URL takes JSON requests the way OpenAI's /v1/audio/speech does,
+	// answering with raw 16-bit mono PCM at SampleRate.
+	URL        string
+	Model      string
+	Voice      string
+	APIKey     string
+	SampleRate int
+}
+
+// HTTP is a Synthesizer asking an HTTP service for PCM speech.
+type HTTP struct {
+	cfg    HTTPConfig
+	client *http.Client
+}
+
+// speechRequest is the body of a synthesis request.
+type speechRequest struct {
+	Model          string `json:"model,omitempty"`
+	Input          string `json:"input"`
+	Voice          string `json:"voice,omitempty"`
+	ResponseFormat string `json:"response_format"`
+}
+
+// NewHTTP returns a Synthesizer for the service at cfg.URL. Requests are
+// bounded by their context.
+func NewHTTP(cfg HTTPConfig) (*HTTP, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("tts: invalid URL %q", cfg.URL)
+	}
+	t := &HTTP{cfg: cfg, client: &http.Client{}}
+	if err := t.Format().Validate(); err != nil {
+		return nil, fmt.Errorf("tts: %w", err)
+	}
+	return t, nil
+}
+
+// Format implements Synthesizer.
+func (t *HTTP) Format() audio.Format {
+	return audio.Format{Encoding: audio.PCM16, SampleRate: t.cfg.SampleRate, BitDepth: 16, Channels: 1}
+}
+
+// Synthesize implements Synthesizer.
+func (t *HTTP) Synthesize(ctx context.Context, text, voice string) (io.ReadCloser, error) {
+	if voice == "" {
+		voice = t.cfg.Voice
+	}
+	body, err := json.Marshal(speechRequest{Model: t.cfg.Model, Input: text, Voice: voice, ResponseFormat: "pcm"})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if t.cfg.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+t.cfg.APIKey)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("tts: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return nil, fmt.Errorf("tts: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return resp.Body, nil
+}
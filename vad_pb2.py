@@ -24,7 +24,7 @@ _sym_db = _symbol_database.Default()
 
 
 
-DESCRIPTOR = _descriptor_pool.Default().AddSerializedFile(b'\n\tvad.proto\x12\x03vad\" \n\nAudioChunk\x12\x12\n\naudio_data\x18\x01 \x01(\x0c\"-\n\x0bVADResponse\x12\r\n\x05\x65vent\x18\x01 \x01(\t\x12\x0f\n\x07message\x18\x02 \x01(\t\"\x0e\n\x0cResetRequest\" \n\rResetResponse\x12\x0f\n\x07success\x18\x01 \x01(\x08\x32v\n\nVADService\x12\x35\n\x0cProcessAudio\x12\x0f.vad.AudioChunk\x1a\x10.vad.VADResponse(\x01\x30\x01\x12\x31\n\x08ResetVAD\x12\x11.vad.ResetRequest\x1a\x12.vad.ResetResponseb\x06proto3')
+DESCRIPTOR = _descriptor_pool.Default().AddSerializedFile(b'\n\tvad.proto\x12\x03vad\"C\n\nAudioChunk\x12\x12\n\naudio_data\x18\x01 \x01(\x0c\x12!\n\x06\x63onfig\x18\x02 \x01(\x0b\x32\x11.vad.StreamConfig\"v\n\x0cStreamConfig\x12\x15\n\rmin_speech_ms\x18\x01 \x01(\r\x12\x16\n\x0emin_silence_ms\x18\x02 \x01(\r\x12\x12\n\npreroll_ms\x18\x03 \x01(\r\x12\x13\n\x0bsensitivity\x18\x04 \x01(\x02\x12\x0e\n\x06locale\x18\x05 \x01(\t\"-\n\x0bVADResponse\x12\r\n\x05\x65vent\x18\x01 \x01(\t\x12\x0f\n\x07message\x18\x02 \x01(\t\"\x0e\n\x0cResetRequest\" \n\rResetResponse\x12\x0f\n\x07success\x18\x01 \x01(\x08\x32v\n\nVADService\x12\x35\n\x0cProcessAudio\x12\x0f.vad.AudioChunk\x1a\x10.vad.VADResponse(\x01\x30\x01\x12\x31\n\x08ResetVAD\x12\x11.vad.ResetRequest\x1a\x12.vad.ResetResponseb\x06proto3')
 
 _globals = globals()
 _builder.BuildMessageAndEnumDescriptors(DESCRIPTOR, _globals)
@@ -32,13 +32,15 @@ _builder.BuildTopDescriptorsAndMessages(DESCRIPTOR, 'vad_pb2', _globals)
 if not _descriptor._USE_C_DESCRIPTORS:
   DESCRIPTOR._loaded_options = None
   _globals['_AUDIOCHUNK']._serialized_start=18
-  _globals['_AUDIOCHUNK']._serialized_end=50
-  _globals['_VADRESPONSE']._serialized_start=52
-  _globals['_VADRESPONSE']._serialized_end=97
-  _globals['_RESETREQUEST']._serialized_start=99
-  _globals['_RESETREQUEST']._serialized_end=113
-  _globals['_RESETRESPONSE']._serialized_start=115
-  _globals['_RESETRESPONSE']._serialized_end=147
-  _globals['_VADSERVICE']._serialized_start=149
-  _globals['_VADSERVICE']._serialized_end=267
+  _globals['_AUDIOCHUNK']._serialized_end=85
+  _globals['_STREAMCONFIG']._serialized_start=87
+  _globals['_STREAMCONFIG']._serialized_end=205
+  _globals['_VADRESPONSE']._serialized_start=207
+  _globals['_VADRESPONSE']._serialized_end=252
+  _globals['_RESETREQUEST']._serialized_start=254
+  _globals['_RESETREQUEST']._serialized_end=268
+  _globals['_RESETRESPONSE']._serialized_start=270
+  _globals['_RESETRESPONSE']._serialized_end=302
+  _globals['_VADSERVICE']._serialized_start=304
+  _globals['_VADSERVICE']._serialized_end=422
 # @@protoc_insertion_point(module_scope)
@@ -0,0 +1,62 @@
+# wakeword_server.py
+#
+# Wake-word backend for the bridge's wake_word_addr: it speaks the VAD
+# protocol, takes 16 kHz 16-bit mono audio, and answers with a "wake" event
+# whenever openWakeWord hears one of its models.
+#
+#   pip install openwakeword grpcio numpy
+#   python wakeword_server.py --model hey_jarvis --port 50052
+import argparse
+from concurrent import futures
+
+import grpc
+import numpy as np
+from openwakeword.model import Model
+
+import vad_pb2
+import vad_pb2_grpc
+
+# openWakeWord scores 80 ms frames of 16 kHz audio.
+FRAME_SAMPLES = 1280
+
+
+class WakeWordServicer(vad_pb2_grpc.VADServiceServicer):
+    def __init__(self, models, threshold):
+        self.models = models
+        self.threshold = threshold
+
+    def ProcessAudio(self, request_iterator, context):
+        # Every stream gets its own model, as openWakeWord keeps state
+        # between frames.
+        model = Model(wakeword_models=self.models)
+        pending = np.zeros(0, dtype=np.int16)
+        for request in request_iterator:
+            pending = np.concatenate([pending, np.frombuffer(request.audio_data, np.int16)])
+            while len(pending) >= FRAME_SAMPLES:
+                frame, pending = pending[:FRAME_SAMPLES], pending[FRAME_SAMPLES:]
+                for name, score in model.predict(frame).items():
+                    if score >= self.threshold:
+                        model.reset()
+                        yield vad_pb2.VADResponse(event="wake", message=name)
+
+    def ResetVAD(self, request, context):
+        return vad_pb2.ResetResponse(success=True)
+
+
+def main():
+    parser = argparse.ArgumentParser()
+    parser.add_argument("--model", action="append", help="openWakeWord model name or path; repeatable")
+    parser.add_argument("--threshold", type=float, default=0.5)
+    parser.add_argument("--port", type=int, default=50052)
+    args = parser.parse_args()
+
+    server = grpc.server(futures.ThreadPoolExecutor(max_workers=10))
+    vad_pb2_grpc.add_VADServiceServicer_to_server(WakeWordServicer(args.model or ["hey_jarvis"], args.threshold), server)
+    server.add_insecure_port(f"[::]:{args.port}")
+    server.start()
+    print(f"Wake-word server listening on port {args.port}")
+    server.wait_for_termination()
+
+
+if __name__ == "__main__":
+    main()
@@ -0,0 +1,72 @@
+// webhook/deadletter.go
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// deadLetter is one line of the dead-letter file.
+type deadLetter struct {
+	Time     time.Time       `json:"time"`
+	URL      string          `json:"url"`
+	Event    string          `json:"event"`
+	Delivery string          `json:"delivery_id"`
+	Attempts int             `json:"attempts"`
+	Error    string          `json:"error"`
+	Payload  json.RawMessage `json:"payload"`
+}
+
+// deadLetters records deliveries that gave up. Every one is logged; with a
+// file they are also appended to it so they can be replayed.
+type deadLetters struct {
+	log *slog.Logger
+	mu  sync.Mutex
+	f   *os.File
+}
+
+func openDeadLetters(path string, logger *slog.Logger) (*deadLetters, error) {
+	d := &deadLetters{log: logger.With("sink", "webhook")}
+	if path == "" {
+		return d, nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("webhook: dead-letter file: %w", err)
+	}
+	d.f = f
+	return d, nil
+}
+
+func (d *deadLetters) add(url string, dl delivery, attempts int, err error) {
+	d.log.Warn("Webhook delivery failed", "url", url, "event", dl.event, "delivery", dl.id,
+		"attempts", attempts, "err", err)
+	if d.f == nil {
+		return
+	}
+	line, _ := json.Marshal(deadLetter{
+		Time:     time.Now().UTC(),
+		URL:      url,
+		Event:    dl.event,
+		Delivery: dl.id,
+		Attempts: attempts,
+		Error:    err.Error(),
+		Payload:  dl.body,
+	})
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, werr := d.f.Write(append(line, '\n')); werr != nil {
+		d.log.Error("Writing dead letter failed", "err", werr)
+	}
+}
+
+func (d *deadLetters) close() error {
+	if d.f == nil {
+		return nil
+	}
+	return d.f.Close()
+}
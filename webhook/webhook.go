@@ -0,0 +1,338 @@
+// webhook/webhook.go
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"vad-application/events"
+	"vad-application/metrics"
+
+	"github.com/google/uuid"
+)
+
+// Event types a webhook may subscribe to.
+const (
+	SessionStart = "session_start"
+	SpeechStart  = "speech_start"
+	SpeechEnd    = "speech_end"
+	SpeechClip   = "speech_clip"
+	DTMF         = "dtmf"
+	SessionEnd   = "session_end"
+)
+
+var eventTypes = []string{SessionStart, SpeechStart, SpeechEnd, SpeechClip, DTMF, SessionEnd}
+
+// Request headers. The signature is the hex HMAC-SHA256, keyed with the
+// hook's secret, of the timestamp, a dot and the body.
+const (
+	HeaderEvent     = "X-VAD-Event"
+	HeaderDelivery  = "X-VAD-Delivery"
+	HeaderTimestamp = "X-VAD-Timestamp"
+	HeaderSignature = "X-VAD-Signature"
+)
+
+// Per-hook delivery limits.
+const (
+	queueSize = 1024
+	workers   = 4
+	baseDelay = time.Second
+	maxDelay  = 5 * time.Minute
+)
+
+// Hook is one registered endpoint.
+type Hook struct {
+	URL string
+	// Secret signs each request; empty sends them unsigned.
+	Secret string
+	// Events lists the event types sent; empty means all of them.
+	Events []string
+	// Tenant, when set, limits the hook to that tenant's sessions.
+	Tenant string
+}
+
+// Options apply to every hook.
+type Options struct {
+	// MaxAttempts bounds deliveries of one event, the first included.
+	MaxAttempts int
+	// Timeout bounds each attempt.
+	Timeout time.Duration
+	// DeadLetterFile collects events that could not be delivered, one JSON
+	// object per line. Empty logs them instead.
+	DeadLetterFile string
+}
+
+// Payload is the JSON body of a webhook request.
+type Payload struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	Time      time.Time       `json:"time"`
+	SessionID string          `json:"session_id"`
+	Subject   string          `json:"subject,omitempty"`
+	Tenant    string          `json:"tenant,omitempty"`
+	Offset    float64         `json:"offset"`
+	Message   string          `json:"message,omitempty"`
+	Summary   *events.Summary `json:"summary,omitempty"`
+	// Segment and Audio, a base64 WAV file, are set on speech_clip.
+	Segment *events.SpeechSegment `json:"segment,omitempty"`
+	Audio   []byte                `json:"audio,omitempty"`
+	// Digit is set on dtmf.
+	Digit string `json:"digit,omitempty"`
+}
+
+// delivery is one payload on its way to one hook.
+type delivery struct {
+	id    string
+	event string
+	body  []byte
+}
+
+// Dispatcher posts session events to the registered hooks. It is an
+// events.Sink; deliveries to a hook run concurrently and may arrive out of
+// order.
+type Dispatcher struct {
+	hooks []*hook
+	dead  *deadLetters
+	log   *slog.Logger
+	// ctx is cancelled when shutdown runs out of time.
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+type hook struct {
+	Hook
+	d      *Dispatcher
+	opts   Options
+	client *http.Client
+	queue  chan delivery
+}
+
+// New validates the hooks and starts their workers.
+func New(hooks []Hook, opts Options, logger *slog.Logger) (*Dispatcher, error) {
+	dead, err := openDeadLetters(opts.DeadLetterFile, logger)
+	if err != nil {
+		return nil, err
+	}
+	d := &Dispatcher{dead: dead, log: logger.With("sink", "webhook")}
+	d.ctx, d.cancel = context.WithCancel(context.Background())
+	for _, hk := range hooks {
+		u, err := url.Parse(hk.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("webhook: %q is not an http(s) URL", hk.URL)
+		}
+		for _, ev := range hk.Events {
+			if !slices.Contains(eventTypes, ev) {
+				return nil, fmt.Errorf("webhook: %s: unknown event %q (want one of %v)", hk.URL, ev, eventTypes)
+			}
+		}
+		h := &hook{
+			Hook:   hk,
+			d:      d,
+			opts:   opts,
+			client: &http.Client{Timeout: opts.Timeout},
+			queue:  make(chan delivery, queueSize),
+		}
+		d.hooks = append(d.hooks, h)
+	}
+	for _, h := range d.hooks {
+		for range workers {
+			d.wg.Add(1)
+			go h.work()
+		}
+	}
+	return d, nil
+}
+
+// eventType maps a session event to a webhook event type, or "" if hooks
+// never see it.
+func eventType(e events.Event) string {
+	switch e.Kind {
+	case events.SessionStart:
+		return SessionStart
+	case events.SessionEnd:
+		return SessionEnd
+	case events.Clip:
+		return SpeechClip
+	case events.DTMF:
+		return DTMF
+	case events.VAD:
+		switch e.Event {
+		case "start":
+			return SpeechStart
+		case "end":
+			return SpeechEnd
+		}
+	}
+	return ""
+}
+
+// Publish queues e for the hooks subscribed to it. A hook whose queue is
+// full has the event dead-lettered.
+func (d *Dispatcher) Publish(e events.Event) {
+	typ := eventType(e)
+	if typ == "" {
+		return
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return
+	}
+	var dl *delivery
+	for _, h := range d.hooks {
+		if len(h.Events) > 0 && !slices.Contains(h.Events, typ) || h.Tenant != "" && h.Tenant != e.Tenant {
+			continue
+		}
+		if dl == nil {
+			p := Payload{
+				ID:        uuid.NewString(),
+				Type:      typ,
+				Time:      e.Time,
+				SessionID: e.SessionID,
+				Subject:   e.Subject,
+				Tenant:    e.Tenant,
+				Offset:    e.Offset,
+				Message:   e.Message,
+				Summary:   e.Summary,
+				Segment:   e.Segment,
+				Audio:     e.Audio,
+				Digit:     e.Digit,
+			}
+			body, err := json.Marshal(p)
+			if err != nil {
+				d.log.Error("Encoding webhook payload failed", "err", err)
+				return
+			}
+			dl = &delivery{id: p.ID, event: typ, body: body}
+		}
+		select {
+		case h.queue <- *dl:
+		default:
+			metrics.SinkDropped.WithLabelValues("webhook").Inc()
+			d.dead.add(h.URL, *dl, 0, errors.New("delivery queue full"))
+		}
+	}
+}
+
+// Close stops accepting events and waits, until ctx expires, for queued
+// deliveries. Whatever is left is dead-lettered.
+func (d *Dispatcher) Close(ctx context.Context) error {
+	d.mu.Lock()
+	d.closed = true
+	for _, h := range d.hooks {
+		close(h.queue)
+	}
+	d.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		// Pending retries give up and dead-letter their events.
+		d.cancel()
+		<-done
+	}
+	d.cancel()
+	return errors.Join(err, d.dead.close())
+}
+
+func (h *hook) work() {
+	defer h.d.wg.Done()
+	for dl := range h.queue {
+		h.deliver(dl)
+	}
+}
+
+// deliver posts dl with exponential backoff between attempts. Client errors
+// other than 408 and 429 are not retried.
+func (h *hook) deliver(dl delivery) {
+	delay := baseDelay
+	var err error
+	attempt := 1
+	for ; ; attempt++ {
+		var retry bool
+		retry, err = h.post(dl)
+		if err == nil {
+			return
+		}
+		if !retry || attempt >= h.opts.MaxAttempts {
+			break
+		}
+		h.d.log.Debug("Retrying webhook", "url", h.URL, "delivery", dl.id, "attempt", attempt, "err", err)
+		select {
+		case <-time.After(delay):
+		case <-h.d.ctx.Done():
+			err = fmt.Errorf("%w (shutting down)", err)
+			h.d.dead.add(h.URL, dl, attempt, err)
+			return
+		}
+		delay = min(2*delay, maxDelay)
+	}
+	metrics.SinkDropped.WithLabelValues("webhook").Inc()
+	h.d.dead.add(h.URL, dl, attempt, err)
+}
+
+// post makes one attempt and reports whether a failure is worth retrying.
+func (h *hook) post(dl delivery) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(h.d.ctx, http.MethodPost, h.URL, bytes.NewReader(dl.body))
+	if err != nil {
+		return false, err
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "vad-bridge-webhook/1")
+	req.Header.Set(HeaderEvent, dl.event)
+	req.Header.Set(HeaderDelivery, dl.id)
+	req.Header.Set(HeaderTimestamp, ts)
+	if h.Secret != "" {
+		req.Header.Set(HeaderSignature, "sha256="+Sign(h.Secret, ts, dl.body))
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests,
+		resp.StatusCode >= 500:
+		return true, fmt.Errorf("status %s", resp.Status)
+	}
+	return false, fmt.Errorf("status %s", resp.Status)
+}
+
+// Sign computes the signature receivers check against HeaderSignature,
+// without its "sha256=" prefix.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,275 @@
+// webhook/webhook_test.go
+package webhook
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"vad-application/events"
+)
+
+func TestSign(t *testing.T) {
+	// printf '1700000000.{"id":"d1","type":"speech_start"}' |
+	//   openssl dgst -sha256 -hmac whsec_test
+	got := Sign("whsec_test", "1700000000", []byte(`{"id":"d1","type":"speech_start"}`))
+	if want := "ba919ba40753b338cd07de5d48acd20f04bcfa5b7b718b4265beb9bb270a0b22"; got != want {
+		t.Errorf("Sign = %s, want %s", got, want)
+	}
+}
+
+// receiver records the requests a hook endpoint gets and answers each with
+// the next of statuses, then 200.
+type receiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	got      []*http.Request
+	bodies   [][]byte
+	arrived  chan struct{}
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	rc := &receiver{statuses: statuses, arrived: make(chan struct{}, 64)}
+	rc.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		rc.mu.Lock()
+		rc.got = append(rc.got, r)
+		rc.bodies = append(rc.bodies, body)
+		status := http.StatusOK
+		if len(rc.statuses) > 0 {
+			status, rc.statuses = rc.statuses[0], rc.statuses[1:]
+		}
+		rc.mu.Unlock()
+		w.WriteHeader(status)
+		rc.arrived <- struct{}{}
+	}))
+	t.Cleanup(rc.Close)
+	return rc
+}
+
+func (rc *receiver) events() []string {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	var out []string
+	for _, r := range rc.got {
+		out = append(out, r.Header.Get(HeaderEvent))
+	}
+	return out
+}
+
+func (rc *receiver) wait(t *testing.T, n int) {
+	t.Helper()
+	for range n {
+		select {
+		case <-rc.arrived:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("gave up waiting for %d requests", n)
+		}
+	}
+}
+
+func discard() *slog.Logger { return slog.New(slog.NewTextHandler(io.Discard, nil)) }
+
+func TestDeliverySigned(t *testing.T) {
+	rc := newReceiver(t)
+	d, err := New([]Hook{{URL: rc.URL, Secret: "whsec_test"}}, Options{MaxAttempts: 1, Timeout: time.Second}, discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Publish(events.Event{Kind: events.VAD, Event: "start", SessionID: "s1", Offset: 1.5})
+	rc.wait(t, 1)
+	if err := d.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	r, body := rc.got[0], rc.bodies[0]
+	if got, want := r.Header.Get(HeaderSignature), "sha256="+Sign("whsec_test", r.Header.Get(HeaderTimestamp), body); got != want {
+		t.Errorf("%s = %q, want %q", HeaderSignature, got, want)
+	}
+	var p Payload
+	if err := json.Unmarshal(body, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Type != SpeechStart || p.SessionID != "s1" || p.Offset != 1.5 || p.ID != r.Header.Get(HeaderDelivery) {
+		t.Errorf("payload = %+v, headers = %v", p, r.Header)
+	}
+}
+
+func TestDeliveryUnsigned(t *testing.T) {
+	rc := newReceiver(t)
+	d, err := New([]Hook{{URL: rc.URL}}, Options{MaxAttempts: 1, Timeout: time.Second}, discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Publish(events.Event{Kind: events.SessionStart, SessionID: "s1"})
+	rc.wait(t, 1)
+	d.Close(context.Background())
+	if sig := rc.got[0].Header.Get(HeaderSignature); sig != "" {
+		t.Errorf("hook without a secret got %s %q", HeaderSignature, sig)
+	}
+}
+
+func TestPublishFilters(t *testing.T) {
+	all := newReceiver(t)
+	speech := newReceiver(t)
+	acme := newReceiver(t)
+	d, err := New([]Hook{
+		{URL: all.URL},
+		{URL: speech.URL, Events: []string{SpeechStart, SpeechEnd}},
+		{URL: acme.URL, Tenant: "acme", Events: []string{SessionEnd}},
+	}, Options{MaxAttempts: 1, Timeout: time.Second}, discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []events.Event{
+		{Kind: events.SessionStart, Tenant: "acme"},
+		{Kind: events.VAD, Event: "start"},
+		{Kind: events.VAD, Event: "other"},       // not a hook event
+		{Kind: events.Transcript, Text: "hello"}, // not a hook event
+		{Kind: events.VAD, Event: "end"},
+		{Kind: events.SessionEnd, Tenant: "globex"},
+		{Kind: events.SessionEnd, Tenant: "acme"},
+	} {
+		d.Publish(e)
+	}
+	if err := d.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// Deliveries run concurrently, so compare them as sets.
+	tests := []struct {
+		name string
+		rc   *receiver
+		want map[string]int
+	}{
+		{"all events", all, map[string]int{SessionStart: 1, SpeechStart: 1, SpeechEnd: 1, SessionEnd: 2}},
+		{"speech only", speech, map[string]int{SpeechStart: 1, SpeechEnd: 1}},
+		{"one tenant", acme, map[string]int{SessionEnd: 1}},
+	}
+	for _, tt := range tests {
+		got := map[string]int{}
+		for _, ev := range tt.rc.events() {
+			got[ev]++
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for ev, n := range tt.want {
+			if got[ev] != n {
+				t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	for _, h := range []Hook{
+		{URL: "ftp://example.com/hook"},
+		{URL: "/relative"},
+		{URL: "https://example.com/hook", Events: []string{"speech_started"}},
+	} {
+		if _, err := New([]Hook{h}, Options{MaxAttempts: 1}, discard()); err == nil {
+			t.Errorf("New took %+v", h)
+		}
+	}
+}
+
+// readDeadLetters reads the dead-letter file at path.
+func readDeadLetters(t *testing.T, path string) []deadLetter {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var out []deadLetter
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var dl deadLetter
+		if err := json.Unmarshal(sc.Bytes(), &dl); err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, dl)
+	}
+	return out
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		requests int
+		dead     bool
+	}{
+		{"server error retried", []int{http.StatusServiceUnavailable}, 2, false},
+		{"rate limit retried", []int{http.StatusTooManyRequests}, 2, false},
+		{"client error not retried", []int{http.StatusBadRequest}, 1, true},
+		{"gives up after max attempts", []int{500, 500, 500}, 2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc := newReceiver(t, tt.statuses...)
+			path := filepath.Join(t.TempDir(), "dead.jsonl")
+			d, err := New([]Hook{{URL: rc.URL}}, Options{MaxAttempts: 2, Timeout: time.Second, DeadLetterFile: path}, discard())
+			if err != nil {
+				t.Fatal(err)
+			}
+			d.Publish(events.Event{Kind: events.SessionStart, SessionID: "s1"})
+			rc.wait(t, tt.requests)
+			if err := d.Close(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if len(rc.got) != tt.requests {
+				t.Errorf("%d requests, want %d", len(rc.got), tt.requests)
+			}
+			if id := rc.got[0].Header.Get(HeaderDelivery); id != rc.got[len(rc.got)-1].Header.Get(HeaderDelivery) {
+				t.Error("retry has a new delivery ID")
+			}
+			if dead := readDeadLetters(t, path); (len(dead) == 1) != tt.dead {
+				t.Errorf("dead letters = %+v, want dead-lettered = %v", dead, tt.dead)
+			}
+		})
+	}
+}
+
+func TestRetryStopsOnShutdown(t *testing.T) {
+	rc := newReceiver(t, 500, 500, 500, 500)
+	path := filepath.Join(t.TempDir(), "dead.jsonl")
+	d, err := New([]Hook{{URL: rc.URL}}, Options{MaxAttempts: 10, Timeout: time.Second, DeadLetterFile: path}, discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Publish(events.Event{Kind: events.SessionStart, SessionID: "s1"})
+	rc.wait(t, 1)
+
+	// The delivery now waits out its first backoff; shutdown running out
+	// of time ends the wait rather than letting it retry.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := d.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Close = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed >= baseDelay {
+		t.Errorf("Close took %v, as long as the backoff", elapsed)
+	}
+	if len(rc.got) != 1 {
+		t.Errorf("%d requests, want 1", len(rc.got))
+	}
+	dead := readDeadLetters(t, path)
+	if len(dead) != 1 || dead[0].Attempts != 1 || dead[0].Event != SessionStart {
+		t.Errorf("dead letters = %+v, want the event after 1 attempt", dead)
+	}
+}
@@ -0,0 +1,227 @@
+// webtransport/conn.go
+package webtransport
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"vad-application/session"
+
+	"github.com/gorilla/websocket"
+	wt "github.com/quic-go/webtransport-go"
+)
+
+// headerSize is the size of a message's type and length.
+const headerSize = 5
+
+// closeWait bounds the wait for a session's close reason once its stream
+// was reset.
+const closeWait = 100 * time.Millisecond
+
+// Conn is a WebTransport session seen as a WebSocket connection, as
+// session.Conn expects. Like a *websocket.Conn, it takes one reader and one
+// writer at a time; WriteControl may be called alongside either.
+type Conn struct {
+	*session.Inbox
+	sess        *wt.Session
+	str         *wt.Stream
+	subprotocol string
+
+	// wmu serializes writes. Once closing is set nothing more is written;
+	// closed is closed when the session is.
+	wmu     sync.Mutex
+	closing bool
+	closed  chan struct{}
+}
+
+func newConn(sess *wt.Session, str *wt.Stream, subprotocol string) *Conn {
+	c := &Conn{
+		Inbox:       session.NewInbox(16),
+		sess:        sess,
+		str:         str,
+		subprotocol: subprotocol,
+		closed:      make(chan struct{}),
+	}
+	go c.readStream()
+	go c.readDatagrams()
+	return c
+}
+
+// Subprotocol returns the subprotocol the client asked for, or "".
+func (c *Conn) Subprotocol() string { return c.subprotocol }
+
+func (c *Conn) RemoteAddr() net.Addr { return c.sess.RemoteAddr() }
+
+func (c *Conn) WriteMessage(messageType int, data []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	return c.write(messageType, data)
+}
+
+// WriteControl sends a close message, after which the client has until
+// deadline to close the session, or answers a ping: QUIC keeps the
+// connection alive and notices when it dies, so the pong handler runs at
+// once while the session lasts.
+func (c *Conn) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	switch messageType {
+	case websocket.CloseMessage:
+		c.wmu.Lock()
+		defer c.wmu.Unlock()
+		err := c.write(messageType, data)
+		if err != nil {
+			return err
+		}
+		c.closing = true
+		c.str.Close()
+		code, reason := websocket.CloseNoStatusReceived, ""
+		if len(data) >= 2 {
+			code, reason = int(binary.BigEndian.Uint16(data)), string(data[2:])
+		}
+		go c.linger(deadline, code, reason)
+		return nil
+	case websocket.PingMessage:
+		if err := c.sess.Context().Err(); err != nil {
+			return net.ErrClosed
+		}
+		return c.Pong(string(data))
+	case websocket.PongMessage:
+		return nil
+	}
+	return fmt.Errorf("webtransport: unknown control message type %d", messageType)
+}
+
+// Close closes the session, once its close message has had its time if
+// one was sent.
+func (c *Conn) Close() error {
+	c.wmu.Lock()
+	closing := c.closing
+	c.closing = true
+	c.wmu.Unlock()
+	if closing {
+		<-c.closed
+		return nil
+	}
+	defer close(c.closed)
+	return c.sess.CloseWithError(0, "")
+}
+
+// write sends one message on the stream. The caller holds wmu.
+func (c *Conn) write(messageType int, data []byte) error {
+	if c.closing {
+		return websocket.ErrCloseSent
+	}
+	var hdr [headerSize]byte
+	hdr[0] = byte(messageType)
+	binary.BigEndian.PutUint32(hdr[1:], uint32(len(data)))
+	if _, err := c.str.Write(hdr[:]); err != nil {
+		return err
+	}
+	_, err := c.str.Write(data)
+	return err
+}
+
+// linger gives the client until deadline to read what was sent and close
+// the session, then closes it.
+func (c *Conn) linger(deadline time.Time, code int, reason string) {
+	defer close(c.closed)
+	t := time.NewTimer(time.Until(deadline))
+	defer t.Stop()
+	select {
+	case <-c.sess.Context().Done():
+	case <-t.C:
+	}
+	c.sess.CloseWithError(wt.SessionErrorCode(code), reason)
+}
+
+func (c *Conn) readStream() {
+	var hdr [headerSize]byte
+	for {
+		if _, err := io.ReadFull(c.str, hdr[:]); err != nil {
+			c.Fail(c.readError(err))
+			return
+		}
+		n := binary.BigEndian.Uint32(hdr[1:])
+		if c.Exceeds(int64(n)) {
+			c.Fail(websocket.ErrReadLimit)
+			return
+		}
+		data := make([]byte, n)
+		if _, err := io.ReadFull(c.str, data); err != nil {
+			c.Fail(c.readError(err))
+			return
+		}
+		switch typ := int(hdr[0]); typ {
+		case websocket.TextMessage, websocket.BinaryMessage:
+			if c.Deliver(context.Background(), typ, data) != nil {
+				return
+			}
+		case websocket.CloseMessage:
+			ce := &websocket.CloseError{Code: websocket.CloseNoStatusReceived}
+			if len(data) >= 2 {
+				ce.Code, ce.Text = int(binary.BigEndian.Uint16(data)), string(data[2:])
+			}
+			c.Fail(ce)
+			return
+		default:
+			c.Fail(fmt.Errorf("webtransport: unknown message type %d", typ))
+			return
+		}
+	}
+}
+
+func (c *Conn) readDatagrams() {
+	for {
+		b, err := c.sess.ReceiveDatagram(c.sess.Context())
+		if err != nil {
+			return
+		}
+		if c.Exceeds(int64(len(b))) {
+			c.Fail(websocket.ErrReadLimit)
+			return
+		}
+		if c.Deliver(context.Background(), websocket.BinaryMessage, b) != nil {
+			return
+		}
+	}
+}
+
+// readError turns the error the message stream failed with into the one a
+// WebSocket read would: a client ending its stream closes normally, and
+// one closing the session does so with the session's code, 0 counting as
+// a normal closure.
+func (c *Conn) readError(err error) error {
+	if errors.Is(err, io.EOF) {
+		return &websocket.CloseError{Code: websocket.CloseNormalClosure}
+	}
+	// A client closing the session resets its streams just before the
+	// reason arrives, which AcceptStream then returns at once.
+	t := time.NewTimer(closeWait)
+	select {
+	case <-c.sess.Context().Done():
+	case <-t.C:
+	}
+	t.Stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	str, cerr := c.sess.AcceptStream(ctx)
+	if str != nil {
+		// Only one stream is used.
+		str.CancelRead(0)
+		str.CancelWrite(0)
+	}
+	var se *wt.SessionError
+	if !errors.As(cerr, &se) {
+		return err
+	}
+	code := int(se.ErrorCode)
+	if code == 0 {
+		code = websocket.CloseNormalClosure
+	}
+	return &websocket.CloseError{Code: code, Text: se.Message}
+}
@@ -0,0 +1,98 @@
+// webtransport/webtransport.go
+package webtransport
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	wt "github.com/quic-go/webtransport-go"
+)
+
+// streamTimeout bounds the wait for a new session's message stream.
+const streamTimeout = 10 * time.Second
+
+// keepAlivePeriod is how often QUIC pings an idle connection, standing in
+// for the session's WebSocket pings.
+const keepAlivePeriod = 10 * time.Second
+
+// Server accepts WebTransport sessions over HTTP/3, for clients on lossy
+// networks where TCP's head-of-line blocking makes WebSocket audio stutter.
+//
+// A session carries the WebSocket protocol: the client opens one
+// bidirectional stream right after connecting, sending its first message on
+// it so that the server sees the stream, and messages go both ways on it,
+// each a byte holding the WebSocket opcode (1 text, 2 binary, 8 close)
+// followed by the payload's length, a big-endian uint32, and the payload.
+// Binary messages, such as audio frames, may instead be sent as datagrams,
+// one message each; they are neither retransmitted nor ordered, so audio
+// sent that way should be sequenced, its lost frames becoming gaps. Since
+// browsers cannot set WebSocket subprotocols here, the subprotocol query
+// parameter names one.
+type Server struct {
+	s            wt.Server
+	subprotocols []string
+}
+
+// NewServer returns a server for addr handing requests to h, which upgrades
+// those IsUpgrade reports on. Only subprotocols may be asked for.
+func NewServer(addr string, h http.Handler, subprotocols []string, checkOrigin func(*http.Request) bool) *Server {
+	s := &Server{subprotocols: subprotocols}
+	s.s.H3 = http3.Server{Addr: addr, Handler: h, QUICConfig: &quic.Config{KeepAlivePeriod: keepAlivePeriod}}
+	s.s.CheckOrigin = checkOrigin
+	return s
+}
+
+// IsUpgrade reports whether r asks for a WebTransport session.
+func IsUpgrade(r *http.Request) bool {
+	return r.Method == http.MethodConnect && r.Proto == "webtransport"
+}
+
+// ListenAndServe serves with tlsConf, or when it is nil the certificate and
+// key files, until Close.
+func (s *Server) ListenAndServe(certFile, keyFile string, tlsConf *tls.Config) error {
+	if tlsConf != nil {
+		s.s.H3.TLSConfig = http3.ConfigureTLSConfig(tlsConf)
+		return s.s.ListenAndServe()
+	}
+	return s.s.ListenAndServeTLS(certFile, keyFile)
+}
+
+// Close closes the listener and every session.
+func (s *Server) Close() error {
+	return s.s.Close()
+}
+
+// Upgrade accepts the session r asks for and waits for the client to open
+// its message stream.
+func (s *Server) Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	// The upgrade needs the HTTP/3 writer itself, not a middleware's.
+	for {
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			break
+		}
+		w = u.Unwrap()
+	}
+	sess, err := s.s.Upgrade(w, r)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), streamTimeout)
+	defer cancel()
+	str, err := sess.AcceptStream(ctx)
+	if err != nil {
+		sess.CloseWithError(websocket.CloseProtocolError, "no message stream")
+		return nil, err
+	}
+	sub := r.URL.Query().Get("subprotocol")
+	if !slices.Contains(s.subprotocols, sub) {
+		sub = ""
+	}
+	return newConn(sess, str, sub), nil
+}